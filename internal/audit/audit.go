@@ -0,0 +1,245 @@
+// Package audit keeps the tamper-evident audit log of security-relevant events, separate from
+// the debug output of the server. The log is an append-only file of JSON records, one per
+// line, chained by SHA-256: each record carries the hash of the record before it and its own
+// hash over its content and that link, so editing, removing or reordering records breaks the
+// chain that Verify checks. Records never carry clear key material.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Events recorded in the audit log.
+const (
+	EventKeyGenerated       = "key_generated"
+	EventKeyExported        = "key_exported"
+	EventClearKeyDisplayed  = "clear_key_displayed"
+	EventClearPINDisplayed  = "clear_pin_displayed"
+	EventLMKChanged         = "lmk_changed"
+	EventAuthorizationState = "authorization_changed"
+	EventAuthorizedCommand  = "authorized_command"
+	EventKeyAttributes      = "key_attributes_changed"
+	EventHAPromoted         = "ha_promoted"
+)
+
+// genesisHash is the previous hash of the first record.
+const genesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// tailSize bounds the bytes read from the end of the log to find the last record.
+const tailSize = 64 << 10
+
+// ErrChainBroken is returned by Verify when a record does not match the chain.
+var ErrChainBroken = errors.New("audit chain broken")
+
+// HostCommandEvents maps the host commands recorded when they succeed to their events.
+var HostCommandEvents = map[string]string{
+	"A0": EventKeyGenerated,
+	"EI": EventKeyGenerated,
+	"GS": EventKeyGenerated,
+	"GY": EventKeyGenerated,
+	"HC": EventKeyGenerated,
+	"A8": EventKeyExported,
+	"GK": EventKeyExported,
+	"GC": EventClearKeyDisplayed,
+}
+
+// Record is one entry of the audit log.
+type Record struct {
+	// Seq numbers the records from 1.
+	Seq int64 `json:"seq"`
+	// Time is when the event was recorded.
+	Time time.Time `json:"time"`
+	// Event names the event.
+	Event string `json:"event"`
+	// User and PID identify the recording process.
+	User string `json:"user"`
+	PID  int    `json:"pid"`
+	// Fields describe the event.
+	Fields map[string]string `json:"fields,omitempty"`
+	// Prev is the hash of the previous record.
+	Prev string `json:"prev"`
+	// Hash is the SHA-256 over Prev and the record without Hash, in hex.
+	Hash string `json:"hash,omitempty"`
+}
+
+// Log appends records to an audit log file. Appends are serialized across the processes
+// sharing the file with an advisory lock.
+type Log struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// Open opens the audit log at path for appending, creating it and its directory when
+// needed.
+func Open(path string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("create audit log directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+
+	return &Log{file: f}, nil
+}
+
+// Append records one event in the audit log at path. An empty path disables the audit log.
+func Append(path, event string, fields map[string]string) error {
+	if path == "" {
+		return nil
+	}
+	l, err := Open(path)
+	if err != nil {
+		return err
+	}
+	if err := l.Record(event, fields); err != nil {
+		_ = l.Close()
+
+		return err
+	}
+
+	return l.Close()
+}
+
+// Record appends an event with fields to the log. It does nothing on a nil log.
+func (l *Log) Record(event string, fields map[string]string) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := lockFile(l.file); err != nil {
+		return fmt.Errorf("lock audit log: %w", err)
+	}
+	defer func() {
+		_ = unlockFile(l.file)
+	}()
+
+	last, err := l.last()
+	if err != nil {
+		return err
+	}
+	r := Record{
+		Seq:    last.Seq + 1,
+		Time:   time.Now().UTC(),
+		Event:  event,
+		User:   currentUser(),
+		PID:    os.Getpid(),
+		Fields: fields,
+		Prev:   last.Hash,
+	}
+	if r.Seq == 1 {
+		r.Prev = genesisHash
+	}
+	if r.Hash, err = r.hash(); err != nil {
+		return err
+	}
+	line, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("encode audit record: %w", err)
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write audit record: %w", err)
+	}
+
+	return nil
+}
+
+// Close closes the log file.
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+
+	return l.file.Close()
+}
+
+// last returns the last record of the log, or the zero record when it is empty.
+func (l *Log) last() (Record, error) {
+	info, err := l.file.Stat()
+	if err != nil {
+		return Record{}, fmt.Errorf("stat audit log: %w", err)
+	}
+	if info.Size() == 0 {
+		return Record{}, nil
+	}
+	offset := max(info.Size()-tailSize, 0)
+	tail := make([]byte, info.Size()-offset)
+	if _, err := l.file.ReadAt(tail, offset); err != nil {
+		return Record{}, fmt.Errorf("read audit log: %w", err)
+	}
+
+	tail = bytes.TrimRight(tail, "\n")
+	var r Record
+	if err := json.Unmarshal(tail[bytes.LastIndexByte(tail, '\n')+1:], &r); err != nil {
+		return Record{}, fmt.Errorf("invalid last audit record: %w", err)
+	}
+
+	return r, nil
+}
+
+// hash returns the chain hash of r.
+func (r Record) hash() (string, error) {
+	r.Hash = ""
+	content, err := json.Marshal(r)
+	if err != nil {
+		return "", fmt.Errorf("encode audit record: %w", err)
+	}
+	sum := sha256.Sum256(append([]byte(r.Prev), content...))
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Verify checks the chain of the audit log read from r and returns the number of records.
+// A broken chain is reported with ErrChainBroken and the line of the first bad record.
+func Verify(r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), tailSize)
+	prev, n := genesisHash, 0
+	for scanner.Scan() {
+		n++
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return n - 1, fmt.Errorf("%w: line %d: %v", ErrChainBroken, n, err)
+		}
+		want, err := rec.hash()
+		if err != nil {
+			return n - 1, err
+		}
+		switch {
+		case rec.Seq != int64(n):
+			return n - 1, fmt.Errorf("%w: line %d: sequence %d", ErrChainBroken, n, rec.Seq)
+		case rec.Prev != prev:
+			return n - 1, fmt.Errorf("%w: line %d: previous hash does not match", ErrChainBroken, n)
+		case rec.Hash != want:
+			return n - 1, fmt.Errorf("%w: line %d: record hash does not match", ErrChainBroken, n)
+		}
+		prev = rec.Hash
+	}
+	if err := scanner.Err(); err != nil {
+		return n, fmt.Errorf("read audit log: %w", err)
+	}
+
+	return n, nil
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+
+	return "unknown"
+}
@@ -0,0 +1,16 @@
+//go:build !unix && !windows
+
+package audit
+
+import "os"
+
+// Platforms without file locking rely on the mutex of the Log alone, so only appends from
+// one process are serialized.
+
+func lockFile(*os.File) error {
+	return nil
+}
+
+func unlockFile(*os.File) error {
+	return nil
+}
@@ -0,0 +1,65 @@
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogVerify(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "audit", "chain.jsonl")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if err := l.Record(EventKeyGenerated, map[string]string{"command": "A0"}); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	// A second writer continues the chain of the first.
+	if err := Append(path, EventLMKChanged, map[string]string{"lmk_id": "01"}); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	if err := Append(path, EventKeyExported, nil); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if n, err := Verify(bytes.NewReader(data)); err != nil || n != 3 {
+		t.Fatalf("Verify() = %d, %v, want 3 records", n, err)
+	}
+
+	lines := strings.SplitAfter(string(data), "\n")
+	for name, tampered := range map[string]string{
+		"edited":    lines[0] + strings.Replace(lines[1], `"01"`, `"02"`, 1) + lines[2],
+		"removed":   lines[0] + lines[2],
+		"reordered": lines[1] + lines[0] + lines[2],
+		"truncated": lines[0] + lines[1] + lines[2][:10],
+	} {
+		if _, err := Verify(strings.NewReader(tampered)); !errors.Is(err, ErrChainBroken) {
+			t.Errorf("Verify() of %s log error = %v, want ErrChainBroken", name, err)
+		}
+	}
+}
+
+func TestAppendDisabled(t *testing.T) {
+	t.Parallel()
+
+	if err := Append("", EventKeyGenerated, nil); err != nil {
+		t.Errorf("Append() with empty path error = %v", err)
+	}
+	var l *Log
+	if err := l.Record(EventKeyGenerated, nil); err != nil {
+		t.Errorf("Record() on nil log error = %v", err)
+	}
+}
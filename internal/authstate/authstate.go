@@ -0,0 +1,65 @@
+// Package authstate gates privileged key management operations behind the authorized state,
+// modelled on the payShield authorized state. The server keeps the authorized state of each
+// LMK in the HSM, entered by a host command carrying the configured password or until a
+// configured deadline, and refuses sensitive host commands for LMKs outside it. Console
+// commands that change keys under an LMK directly enter the same state with the same
+// password for their own invocation.
+package authstate
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/andrei-cloud/go_hsm/internal/privileged"
+	"github.com/rs/zerolog"
+)
+
+// MaxWindow bounds how far ahead a configured deadline may lie, so the HSM cannot be left in
+// authorized state indefinitely.
+const MaxWindow = 12 * time.Hour
+
+var (
+	// ErrNotAuthorized is returned when the authorized state has not been entered.
+	ErrNotAuthorized = errors.New("HSM is not in authorized state")
+	// ErrExpired is returned when the configured deadline has passed.
+	ErrExpired = errors.New("authorized state expired")
+	// ErrWindowTooLong is returned when the configured deadline exceeds MaxWindow.
+	ErrWindowTooLong = errors.New("authorized state window exceeds 12h")
+)
+
+// deadline gates the authorized state.
+var deadline = privileged.Deadline{
+	Setting:          "authorized.until",
+	Max:              MaxWindow,
+	ErrDisabled:      ErrNotAuthorized,
+	ErrExpired:       ErrExpired,
+	ErrWindowTooLong: ErrWindowTooLong,
+}
+
+// Gate decides whether the configured authorized state is in effect.
+type Gate struct {
+	// Until is an RFC 3339 deadline after which the configured authorized state lapses.
+	Until string
+}
+
+// Check returns nil when the authorized state is in effect at now.
+func (g Gate) Check(now time.Time) error {
+	return deadline.Check(false, g.Until, now)
+}
+
+// Trail records privileged operations in the audit log. Clear key material is never
+// recorded; callers pass identifying data such as key check values only.
+type Trail struct {
+	w *privileged.AuditWriter
+}
+
+// NewTrail echoes audit records to stderr and appends them to the audit log at path.
+func NewTrail(stderr io.Writer, path string) *Trail {
+	return &Trail{w: privileged.NewAuditWriter(stderr, path)}
+}
+
+// Record records event, a privileged operation, with the given fields.
+func (t *Trail) Record(event string, fields map[string]string) error {
+	return t.w.Write(zerolog.InfoLevel, event, fields, "privileged operation in authorized state")
+}
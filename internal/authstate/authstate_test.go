@@ -0,0 +1,67 @@
+package authstate
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andrei-cloud/go_hsm/internal/audit"
+)
+
+func TestGateCheck(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		gate Gate
+		want error
+	}{
+		{"not authorized", Gate{}, ErrNotAuthorized},
+		{"within window", Gate{Until: "2024-05-01T18:00:00Z"}, nil},
+		{"expired", Gate{Until: "2024-05-01T11:59:59Z"}, ErrExpired},
+		{"window too long", Gate{Until: "2024-05-02T12:00:00Z"}, ErrWindowTooLong},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			if err := tc.gate.Check(now); !errors.Is(err, tc.want) {
+				t.Errorf("Check() = %v, want %v", err, tc.want)
+			}
+		})
+	}
+
+	if err := (Gate{Until: "tomorrow"}).Check(now); err == nil {
+		t.Error("expected error for invalid deadline")
+	}
+}
+
+func TestTrailRecord(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "audit", "audit.jsonl")
+	var stderr bytes.Buffer
+	trail := NewTrail(&stderr, path)
+	if err := trail.Record("key_attributes_changed", map[string]string{"kcv": "EE23D8"}); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+
+	logged, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read audit log: %v", err)
+	}
+	if n, err := audit.Verify(bytes.NewReader(logged)); err != nil || n != 1 {
+		t.Errorf("audit.Verify() = %d, %v, want 1 record", n, err)
+	}
+	for _, out := range []string{stderr.String(), string(logged)} {
+		if !strings.Contains(out, `"event":"key_attributes_changed"`) ||
+			!strings.Contains(out, `"kcv":"EE23D8"`) {
+			t.Errorf("audit record = %s", out)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package authstate
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultWindow is how long the authorized state entered by host command lasts.
+	DefaultWindow = time.Hour
+	// PasswordEnv is the environment variable holding the authorized state password when
+	// none is configured.
+	PasswordEnv = "GO_HSM_AUTHORIZED_PASSWORD"
+)
+
+// DefaultCommands are the host commands refused outside the authorized state: exporting keys
+// (A8, GK), generating and forming keys from clear components (GC, GY) and translating keys
+// from the old LMK (BW).
+var DefaultCommands = []string{"A8", "BW", "GC", "GK", "GY"}
+
+// ErrPasswordRejected is returned when a request to enter the authorized state does not carry
+// the configured password, or no password is configured.
+var ErrPasswordRejected = errors.New("authorized state password rejected")
+
+// State is the authorized state of the LMKs of an HSM. Each LMK is in authorized state until
+// its own deadline, as payShield LMKs are authorized one by one.
+type State struct {
+	mu    sync.Mutex
+	until map[string]time.Time
+}
+
+// NewState returns a state in which no LMK is authorized.
+func NewState() *State {
+	return &State{until: make(map[string]time.Time)}
+}
+
+// Enter puts the LMK lmkID in authorized state until the deadline.
+func (s *State) Enter(lmkID string, until time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.until[lmkID] = until
+}
+
+// Cancel leaves the authorized state of the LMK lmkID.
+func (s *State) Cancel(lmkID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.until, lmkID)
+}
+
+// Until returns the deadline of the authorized state of the LMK lmkID at now, and false when
+// the LMK is not authorized.
+func (s *State) Until(lmkID string, now time.Time) (time.Time, bool) {
+	if s == nil {
+		return time.Time{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	until, ok := s.until[lmkID]
+	if ok && !now.Before(until) {
+		delete(s.until, lmkID)
+		ok = false
+	}
+
+	return until, ok
+}
+
+// HostRules configures the authorized state of host commands.
+type HostRules struct {
+	// Commands lists the host commands refused outside the authorized state; nil selects
+	// DefaultCommands.
+	Commands []string `mapstructure:"commands"`
+	// Password authenticates the requests entering the authorized state; empty refuses them.
+	Password string `mapstructure:"password"`
+	// Window is how long the authorized state entered by host command lasts; 0 selects
+	// DefaultWindow.
+	Window time.Duration `mapstructure:"window"`
+	// EnterCommand and CancelCommand are the command codes answered by the server core to
+	// enter and cancel the authorized state of an LMK; empty disables them.
+	EnterCommand  string `mapstructure:"enter_command"`
+	CancelCommand string `mapstructure:"cancel_command"`
+}
+
+// Host gates host commands behind the authorized state of the LMK they use.
+type Host struct {
+	state    *State
+	commands []string
+	password []byte
+	window   time.Duration
+	enter    string
+	cancel   string
+}
+
+// NewHost validates rules and returns a gate keeping state.
+func NewHost(rules HostRules, state *State) (*Host, error) {
+	h := &Host{
+		state:    state,
+		commands: DefaultCommands,
+		password: []byte(rules.Password),
+		window:   rules.Window,
+		enter:    strings.ToUpper(rules.EnterCommand),
+		cancel:   strings.ToUpper(rules.CancelCommand),
+	}
+	if h.window == 0 {
+		h.window = DefaultWindow
+	}
+	if h.window < 0 {
+		return nil, fmt.Errorf("invalid authorized state window %s", h.window)
+	}
+	if h.window > MaxWindow {
+		return nil, fmt.Errorf("%w: window %s", ErrWindowTooLong, h.window)
+	}
+	for _, code := range []string{h.enter, h.cancel} {
+		if code != "" && len(code) != 2 {
+			return nil, fmt.Errorf("authorized state command %q must be a 2-character code", code)
+		}
+	}
+	if h.enter != "" && h.enter == h.cancel {
+		return nil, fmt.Errorf("authorized state enter and cancel commands are both %s", h.enter)
+	}
+	if rules.Commands != nil {
+		h.commands = make([]string, len(rules.Commands))
+		for i, cmd := range rules.Commands {
+			if len(cmd) != 2 {
+				return nil, fmt.Errorf("invalid authorized state command %q", cmd)
+			}
+			h.commands[i] = strings.ToUpper(cmd)
+		}
+	}
+
+	return h, nil
+}
+
+// Commands returns the codes of the commands entering and cancelling the authorized state.
+func (h *Host) Commands() (enter, cancel string) {
+	if h == nil {
+		return "", ""
+	}
+
+	return h.enter, h.cancel
+}
+
+// Gates reports whether cmd is refused outside the authorized state.
+func (h *Host) Gates(cmd string) bool {
+	return h != nil && slices.Contains(h.commands, cmd)
+}
+
+// Refuses reports whether cmd for the LMK lmkID must be refused at now because the LMK is
+// not in authorized state.
+func (h *Host) Refuses(cmd, lmkID string, now time.Time) bool {
+	if !h.Gates(cmd) {
+		return false
+	}
+	_, ok := h.state.Until(lmkID, now)
+
+	return !ok
+}
+
+// Enter puts the LMK lmkID in authorized state for the window of the rules when password
+// matches, and returns the deadline.
+func (h *Host) Enter(lmkID string, password []byte, now time.Time) (time.Time, error) {
+	if len(h.password) == 0 || subtle.ConstantTimeCompare(h.password, password) != 1 {
+		return time.Time{}, ErrPasswordRejected
+	}
+	until := now.Add(h.window)
+	h.state.Enter(lmkID, until)
+
+	return until, nil
+}
+
+// Cancel leaves the authorized state of the LMK lmkID.
+func (h *Host) Cancel(lmkID string) {
+	h.state.Cancel(lmkID)
+}
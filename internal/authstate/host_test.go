@@ -0,0 +1,88 @@
+package authstate
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHost(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	h, err := NewHost(HostRules{Password: "secret", EnterCommand: "ra", CancelCommand: "RC"}, NewState())
+	if err != nil {
+		t.Fatalf("NewHost: %v", err)
+	}
+	if enter, cancel := h.Commands(); enter != "RA" || cancel != "RC" {
+		t.Errorf("Commands() = %s, %s", enter, cancel)
+	}
+
+	if !h.Refuses("A8", "00", now) {
+		t.Error("A8 allowed outside authorized state")
+	}
+	if h.Refuses("CA", "00", now) {
+		t.Error("CA refused outside authorized state")
+	}
+	if _, err := h.Enter("00", []byte("wrong"), now); !errors.Is(err, ErrPasswordRejected) {
+		t.Errorf("Enter() with wrong password = %v", err)
+	}
+
+	until, err := h.Enter("00", []byte("secret"), now)
+	if err != nil || !until.Equal(now.Add(DefaultWindow)) {
+		t.Fatalf("Enter() = %v, %v", until, err)
+	}
+	if h.Refuses("A8", "00", now) {
+		t.Error("A8 refused in authorized state")
+	}
+	if !h.Refuses("A8", "01", now) {
+		t.Error("A8 allowed for an LMK outside authorized state")
+	}
+	if !h.Refuses("A8", "00", until) {
+		t.Error("A8 allowed after the authorized state expired")
+	}
+
+	if _, err := h.Enter("00", []byte("secret"), now); err != nil {
+		t.Fatalf("Enter() = %v", err)
+	}
+	h.Cancel("00")
+	if !h.Refuses("A8", "00", now) {
+		t.Error("A8 allowed after the authorized state was cancelled")
+	}
+
+	var nilHost *Host
+	if nilHost.Refuses("A8", "00", now) {
+		t.Error("nil host refuses commands")
+	}
+}
+
+func TestNewHostInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, rules := range []HostRules{
+		{Window: 13 * time.Hour},
+		{Window: -time.Minute},
+		{EnterCommand: "RAX"},
+		{EnterCommand: "RA", CancelCommand: "ra"},
+		{Commands: []string{"A"}},
+	} {
+		if _, err := NewHost(rules, NewState()); err == nil {
+			t.Errorf("NewHost(%+v) succeeded", rules)
+		}
+	}
+	if _, err := NewHost(HostRules{}, NewState()); err != nil {
+		t.Errorf("NewHost() with default rules = %v", err)
+	}
+}
+
+func TestHostWithoutPassword(t *testing.T) {
+	t.Parallel()
+
+	h, err := NewHost(HostRules{}, NewState())
+	if err != nil {
+		t.Fatalf("NewHost: %v", err)
+	}
+	if _, err := h.Enter("00", nil, time.Now()); !errors.Is(err, ErrPasswordRejected) {
+		t.Errorf("Enter() without configured password = %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+// Package audit provides the commands checking the tamper-evident audit log.
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/andrei-cloud/go_hsm/internal/audit"
+	"github.com/andrei-cloud/go_hsm/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// NewAuditCommand creates the audit command group.
+func NewAuditCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Tamper-evident audit log",
+		Long: `Check the audit log of security-relevant events: key generation, key export,
+clear key and PIN display, LMK changes and authorized state changes. Each record of the
+log is chained to the previous one by SHA-256, so an edited, removed or reordered record
+breaks the chain from that record on.`,
+	}
+
+	// Add subcommands.
+	cmd.AddCommand(newVerifyCommand())
+
+	return cmd
+}
+
+func newVerifyCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "verify",
+		Short:   "Verify the hash chain of the audit log",
+		Example: "  go_hsm audit verify --file ~/.go_hsm/audit-chain.jsonl",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			path, _ := cmd.Flags().GetString("file")
+			if path == "" {
+				path = config.Get().Audit.Path
+			}
+			if path == "" {
+				return errors.New("audit log path is not configured (use --file)")
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				return fmt.Errorf("open audit log: %w", err)
+			}
+			defer f.Close()
+
+			n, err := audit.Verify(f)
+			if err != nil {
+				return fmt.Errorf("%s: %w (%d records verified)", path, err, n)
+			}
+			cmd.Printf("%s: %d records, chain intact\n", path, n)
+
+			return nil
+		},
+	}
+
+	cmd.Flags().String("file", "", "Audit log file (default from audit.path config)")
+
+	return cmd
+}
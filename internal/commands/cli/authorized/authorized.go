@@ -0,0 +1,141 @@
+// Package authorized provides the console commands entering and cancelling the authorized
+// state of a running HSM.
+package authorized
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/andrei-cloud/go_hsm/internal/authstate"
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/internal/isobridge"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// NewAuthorizedCommand creates the authorized command group.
+func NewAuthorizedCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "authorized",
+		Short: "Authorized state of a running HSM",
+		Long: `Enter or cancel the authorized state of an LMK of a running HSM, as the payShield
+console does. With authorized.enabled the server refuses sensitive host commands, such as
+key export, clear component key forming and old LMK translation, with error 17 for LMKs
+outside the authorized state. The state is changed with the host commands configured as
+authorized.enter_command and authorized.cancel_command; entering it requires the
+authorized.password of the server and lasts for authorized.window.`,
+	}
+
+	cmd.PersistentFlags().String("addr", "", "HSM address (default from server.host and server.port)")
+	cmd.PersistentFlags().String("lmk-id", "00", "LMK ID")
+	cmd.PersistentFlags().String("command", "",
+		"Host command code (default from authorized.enter_command or authorized.cancel_command)")
+	cmd.PersistentFlags().Duration("timeout", 5*time.Second, "HSM response timeout")
+
+	// Add subcommands.
+	cmd.AddCommand(newEnterCommand())
+	cmd.AddCommand(newCancelCommand())
+
+	return cmd
+}
+
+func newEnterCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "enter",
+		Short:   "Enter the authorized state of an LMK",
+		Example: "  GO_HSM_AUTHORIZED_PASSWORD=secret go_hsm authorized enter --lmk-id 00",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			password, _ := cmd.Flags().GetString("password")
+			if password == "" {
+				password = os.Getenv(authstate.PasswordEnv)
+			}
+			if password == "" {
+				return fmt.Errorf("password is required (use --password or set %s)", authstate.PasswordEnv)
+			}
+			resp, err := exchange(cmd, "authorized.enter_command", password)
+			if err != nil {
+				return err
+			}
+			until, err := time.Parse("20060102150405", string(resp))
+			if err != nil {
+				return fmt.Errorf("invalid authorized state deadline %q", resp)
+			}
+
+			lmkID, _ := cmd.Flags().GetString("lmk-id")
+			cmd.Printf("LMK %s in authorized state until %s\n", lmkID, until.Format(time.RFC3339))
+
+			return nil
+		},
+	}
+
+	cmd.Flags().String("password", "", "Authorized state password (or set "+authstate.PasswordEnv+")")
+
+	return cmd
+}
+
+func newCancelCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "cancel",
+		Short: "Cancel the authorized state of an LMK",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if _, err := exchange(cmd, "authorized.cancel_command", ""); err != nil {
+				return err
+			}
+
+			lmkID, _ := cmd.Flags().GetString("lmk-id")
+			cmd.Printf("LMK %s authorized state cancelled\n", lmkID)
+
+			return nil
+		},
+	}
+}
+
+// exchange sends the host command configured under key for the LMK of the --lmk-id flag,
+// followed by data, and returns the response after the error code.
+func exchange(cmd *cobra.Command, key, data string) ([]byte, error) {
+	code, _ := cmd.Flags().GetString("command")
+	if code == "" {
+		code = viper.GetString(key)
+	}
+	if len(code) != 2 {
+		return nil, fmt.Errorf("host command code is required (use --command or set %s)", key)
+	}
+	lmkID, _ := cmd.Flags().GetString("lmk-id")
+	if len(lmkID) != 2 {
+		return nil, fmt.Errorf("invalid LMK ID %q", lmkID)
+	}
+	addr, _ := cmd.Flags().GetString("addr")
+	if addr == "" {
+		addr = net.JoinHostPort(viper.GetString("server.host"), strconv.Itoa(viper.GetInt("server.port")))
+	}
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+
+	hsm := &isobridge.TCPExchanger{Addr: addr, Timeout: timeout}
+	defer func() {
+		_ = hsm.Close()
+	}()
+	resp, err := hsm.Exchange([]byte(code + lmkID + data))
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) < 4 {
+		return nil, errors.New("short response from hsm")
+	}
+
+	switch errCode := string(resp[2:4]); errCode {
+	case errorcodes.Err00.CodeOnly():
+		return resp[4:], nil
+	case errorcodes.Err13.CodeOnly():
+		return nil, fmt.Errorf("hsm error 13: LMK %s is not installed", lmkID)
+	case errorcodes.Err17.CodeOnly():
+		return nil, errors.New("hsm error 17: authorized state password rejected")
+	case errorcodes.Err68.CodeOnly():
+		return nil, fmt.Errorf("hsm does not support command %s (check authorized.enabled)", code)
+	default:
+		return nil, fmt.Errorf("hsm error %s", errCode)
+	}
+}
@@ -0,0 +1,84 @@
+// Package commands provides the HSM command documentation CLI.
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/andrei-cloud/go_hsm/internal/hsm/cmddoc"
+	"github.com/spf13/cobra"
+)
+
+// NewCommandsCommand creates the commands command group.
+func NewCommandsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "commands",
+		Short: "HSM command documentation",
+		Long: `Show the request and response layout and error codes of HSM commands.
+A <CMD>.json descriptor next to the plugins overrides the built-in documentation.`,
+	}
+	cmd.PersistentFlags().String("plugin-dir", "", "Directory with plugin descriptor files (default: ./plugins)")
+
+	cmd.AddCommand(newDescribeCommand())
+	cmd.AddCommand(newListCommand())
+
+	return cmd
+}
+
+func newDescribeCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:     "describe <CMD>",
+		Short:   "Describe an HSM command",
+		Example: "  go_hsm commands describe DC",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			d, err := cmddoc.Lookup(args[0], pluginDir(cmd))
+			if err != nil {
+				return err
+			}
+
+			return d.Write(cmd.OutOrStdout())
+		},
+	}
+}
+
+func newListCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List documented HSM commands",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			dir := pluginDir(cmd)
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 3, ' ', 0)
+			_, _ = fmt.Fprintln(w, "Command\tResponse\tTitle")
+			for _, code := range cmddoc.Commands(dir) {
+				d, err := cmddoc.Lookup(code, dir)
+				if err != nil {
+					_, _ = fmt.Fprintf(w, "%s\t\t%v\n", code, err)
+					continue
+				}
+				_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", d.Command, d.Response, d.Title)
+			}
+
+			return w.Flush()
+		},
+	}
+}
+
+// pluginDir resolves the directory holding companion descriptor files: the --plugin-dir
+// flag, ./plugins when running from source, or the plugins directory next to the binary.
+func pluginDir(cmd *cobra.Command) string {
+	if dir, _ := cmd.Flags().GetString("plugin-dir"); dir != "" {
+		return dir
+	}
+	if _, err := os.Stat("plugins"); err == nil {
+		return "plugins"
+	}
+	exePath, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(filepath.Dir(exePath), "plugins")
+}
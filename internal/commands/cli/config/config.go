@@ -0,0 +1,68 @@
+// Package config provides the configuration file commands.
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/andrei-cloud/go_hsm/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// NewConfigCommand creates the config command group.
+func NewConfigCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Configuration file management",
+		Long: `Check the configuration file of the server. The file is given with --config or
+` + config.EnvConfigFile + `, or found as config.yaml, config.toml or config.json in the working
+directory, $HOME/.go_hsm or /etc/go_hsm. Its extension selects YAML, TOML or JSON.
+Environment variables GOHSM_<SECTION>_<KEY>, for example GOHSM_SERVER_PORT, override the
+settings of the file.`,
+	}
+
+	cmd.AddCommand(newValidateCommand())
+
+	return cmd
+}
+
+func newValidateCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "validate [file]",
+		Short: "Validate the configuration",
+		Long: `Validate the configuration file, or the file given as argument, with its environment
+overrides. Settings are checked the way the server checks them at startup, and keys that
+match no setting, typically misspelled ones, are reported. The command fails when any
+problem is found.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: runValidate,
+	}
+}
+
+func runValidate(cmd *cobra.Command, args []string) error {
+	if len(args) == 1 {
+		if err := config.Initialize(args[0]); err != nil {
+			return err
+		}
+	}
+
+	file := config.File()
+	if file == "" {
+		file = "defaults"
+	}
+
+	var problems []error
+	for _, key := range config.UnknownKeys() {
+		problems = append(problems, fmt.Errorf("unknown setting %q", key))
+	}
+	if err := config.Get().Validate(); err != nil {
+		problems = append(problems, err)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration %s:\n%w", file, errors.Join(problems...))
+	}
+
+	cmd.Printf("Configuration %s is valid\n", file)
+
+	return nil
+}
@@ -0,0 +1,74 @@
+// Package debug provides clear-key command implementation.
+package debug
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/andrei-cloud/go_hsm/internal/audit"
+	"github.com/andrei-cloud/go_hsm/pkg/crypto"
+	"github.com/spf13/cobra"
+)
+
+func newClearKeyCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "clear-key",
+		Short: "Print the clear value of a key encrypted under LMK",
+		Example: `  go_hsm debug clear-key --insecure-test-features --key U1234... --type 001
+  go_hsm debug clear-key --insecure-test-features --key S1009... --lmk-id 01`,
+		RunE: runClearKey,
+	}
+
+	// Add flags.
+	cmd.Flags().String("key", "", "Key encrypted under LMK (scheme prefix and hex, or key block)")
+	cmd.Flags().String("type", "", "Key type code for variant keys (e.g. 000, 001, 002)")
+	cmd.Flags().String("lmk-id", "00", "LMK ID the key is encrypted under")
+	cmd.Flags().Bool("pci", false, "Override the configured PCI compliance mode")
+
+	if err := cmd.MarkFlagRequired("key"); err != nil {
+		panic(err)
+	}
+
+	return cmd
+}
+
+func runClearKey(cmd *cobra.Command, _ []string) error {
+	key, _ := cmd.Flags().GetString("key")
+	keyType, _ := cmd.Flags().GetString("type")
+	lmkID, _ := cmd.Flags().GetString("lmk-id")
+
+	auditor, err := authorize(cmd, "clear-key")
+	if err != nil {
+		return err
+	}
+
+	clearKey, err := decryptKey(strings.ToUpper(key), keyType, lmkID, pciMode(cmd, lmkID))
+	if err != nil {
+		return fmt.Errorf("failed to decrypt key under LMK %s: %w", lmkID, err)
+	}
+	// The first check value is the legacy one for DES key lengths; keys that may be AES keys
+	// also get their AES check values.
+	kcvs := crypto.KeyCheckValues(clearKey)
+	if len(kcvs) == 0 {
+		return fmt.Errorf("no check value for a %d byte key", len(clearKey))
+	}
+	kcv := strings.ToUpper(hex.EncodeToString(kcvs[0].Value))
+
+	fields := map[string]string{
+		"lmk_id":   lmkID,
+		"key_type": keyType,
+		"kcv":      kcv,
+	}
+	if err := auditor.Record(audit.EventClearKeyDisplayed, fields); err != nil {
+		return err
+	}
+
+	cmd.Printf("Clear Key: %s\n", strings.ToUpper(hex.EncodeToString(clearKey)))
+	cmd.Printf("KCV: %s\n", kcv)
+	for _, other := range kcvs[1:] {
+		cmd.Printf("KCV (%s): %X\n", other.Type, other.Value)
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+// Package debug provides clear-pin command implementation.
+package debug
+
+import (
+	"crypto/des"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/andrei-cloud/go_hsm/internal/audit"
+	"github.com/andrei-cloud/go_hsm/internal/pinblock"
+	"github.com/andrei-cloud/go_hsm/pkg/crypto"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/spf13/cobra"
+)
+
+func newClearPINCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "clear-pin",
+		Short: "Print the clear PIN of a PIN block encrypted under a TPK or ZPK",
+		Example: `  go_hsm debug clear-pin --insecure-test-features --key U1234... --type 001 \
+    --pinblock 0123456789ABCDEF --pan 550000025321 --format 01`,
+		RunE: runClearPIN,
+	}
+
+	// Add flags.
+	cmd.Flags().String("key", "", "TPK or ZPK encrypted under LMK (scheme prefix and hex, or key block)")
+	cmd.Flags().String("type", "001", "Key type code of the PIN key (001=ZPK, 002=TPK)")
+	cmd.Flags().String("lmk-id", "00", "LMK ID the PIN key is encrypted under")
+	cmd.Flags().Bool("pci", false, "Override the configured PCI compliance mode")
+	cmd.Flags().String("pinblock", "", "Encrypted PIN block (16 hex characters)")
+	cmd.Flags().String("pan", "", "Account number used to form the PIN block")
+	cmd.Flags().String("format", "01", "Thales PIN block format code (e.g. 01 for ISO 0)")
+
+	for _, name := range []string{"key", "pinblock", "pan"} {
+		if err := cmd.MarkFlagRequired(name); err != nil {
+			panic(err)
+		}
+	}
+
+	return cmd
+}
+
+func runClearPIN(cmd *cobra.Command, _ []string) error {
+	key, _ := cmd.Flags().GetString("key")
+	keyType, _ := cmd.Flags().GetString("type")
+	lmkID, _ := cmd.Flags().GetString("lmk-id")
+	pinBlockHex, _ := cmd.Flags().GetString("pinblock")
+	pan, _ := cmd.Flags().GetString("pan")
+	formatCode, _ := cmd.Flags().GetString("format")
+
+	auditor, err := authorize(cmd, "clear-pin")
+	if err != nil {
+		return err
+	}
+
+	pinKey, err := decryptKey(strings.ToUpper(key), keyType, lmkID, pciMode(cmd, lmkID))
+	if err != nil {
+		return fmt.Errorf("failed to decrypt PIN key under LMK %s: %w", lmkID, err)
+	}
+
+	encrypted, err := hex.DecodeString(pinBlockHex)
+	if err != nil || len(encrypted) != des.BlockSize {
+		return fmt.Errorf("PIN block must be %d hex characters", 2*des.BlockSize)
+	}
+	block, err := cryptoprovider.NewTripleDESCipher(cryptoutils.PrepareTripleDESKey(pinKey))
+	if err != nil {
+		return fmt.Errorf("invalid PIN key: %w", err)
+	}
+	clearBlock := make([]byte, des.BlockSize)
+	block.Decrypt(clearBlock, encrypted)
+
+	pin, err := pinblock.ExtractPinBlock(hex.EncodeToString(clearBlock), pan, formatCode)
+	if err != nil {
+		return fmt.Errorf("failed to extract PIN: %w", err)
+	}
+
+	fields := map[string]string{
+		"lmk_id":   lmkID,
+		"key_type": keyType,
+		"key_kcv":  strings.ToUpper(hex.EncodeToString(crypto.CalculateKCV(pinKey))),
+		"format":   formatCode,
+	}
+	if err := auditor.Record(audit.EventClearPINDisplayed, fields); err != nil {
+		return err
+	}
+
+	cmd.Printf("Clear PIN Block: %s\n", strings.ToUpper(hex.EncodeToString(clearBlock)))
+	cmd.Printf("PIN: %s\n", pin)
+
+	return nil
+}
@@ -0,0 +1,99 @@
+// Package debug provides test-only commands that disclose clear keys and PINs.
+package debug
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/andrei-cloud/go_hsm/internal/config"
+	"github.com/andrei-cloud/go_hsm/internal/hsm/logic"
+	"github.com/andrei-cloud/go_hsm/internal/insecure"
+	"github.com/andrei-cloud/go_hsm/pkg/keyschemes"
+	"github.com/spf13/cobra"
+)
+
+// NewDebugCommand creates the debug command group.
+func NewDebugCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "debug",
+		Short: "Insecure test features (clear key and clear PIN output)",
+		Long: `Insecure test features that print clear keys and PINs for debugging.
+The commands are refused unless --insecure-test-features is given or the configuration
+sets insecure.test_features_until to a deadline at most 24h ahead. Every use is appended
+to the audit log (audit.path) and echoed to stderr. Never enable them in production.`,
+	}
+
+	cmd.PersistentFlags().
+		Bool("insecure-test-features", false, "Enable insecure test features for this invocation")
+
+	// Add subcommands.
+	cmd.AddCommand(newClearKeyCommand())
+	cmd.AddCommand(newClearPINCommand())
+
+	return cmd
+}
+
+// authorize checks that test features are enabled and returns the auditor recording the
+// use of feature.
+func authorize(cmd *cobra.Command, feature string) (*insecure.Auditor, error) {
+	flag, _ := cmd.Flags().GetBool("insecure-test-features")
+	cfg := config.Get()
+
+	gate := insecure.Gate{Flag: flag, Until: cfg.Insecure.TestFeaturesUntil}
+	if err := gate.Check(time.Now()); err != nil {
+		return nil, fmt.Errorf("%s refused: %w", feature, err)
+	}
+
+	auditor := insecure.NewAuditor(cmd.ErrOrStderr(), cfg.Audit.Path)
+	cmd.PrintErrln("WARNING: insecure test feature enabled; clear values will be printed and audited.")
+
+	return auditor, nil
+}
+
+// decryptKey decrypts a key under the LMK with the given ID. Variant keys carry a scheme
+// prefix (X, U or T); key blocks start with S, R or K.
+func decryptKey(key, keyType, lmkID string, pciMode bool) ([]byte, error) {
+	if key == "" {
+		return nil, errors.New("key is empty")
+	}
+
+	engine, ok := logic.LMKRegistry[lmkID]
+	if !ok {
+		return nil, fmt.Errorf("no LMK registered under id %s", lmkID)
+	}
+
+	scheme := key[0]
+	if engine.GetLMKType() == logic.LMKTypeKeyBlock {
+		return engine.DecryptUnderLMK([]byte(key), keyType, scheme, lmkID)
+	}
+
+	parsed, err := keyschemes.ParseLMKKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encrypted key: %w", err)
+	}
+	if keyType == "" {
+		return nil, errors.New("--type is required for variant keys")
+	}
+	encrypted, err := parsed.Bytes()
+	if err != nil {
+		return nil, fmt.Errorf("invalid encrypted key format: %w", err)
+	}
+	if variant, ok := engine.(logic.VariantLMKProvider); ok {
+		engine = variant.WithPCIMode(pciMode)
+	}
+
+	return engine.DecryptUnderLMK(encrypted, strings.ToUpper(keyType), scheme, lmkID)
+}
+
+// pciMode returns the --pci flag when given, or the configured mode of the LMK.
+func pciMode(cmd *cobra.Command, lmkID string) bool {
+	if cmd.Flags().Changed("pci") {
+		enabled, _ := cmd.Flags().GetBool("pci")
+
+		return enabled
+	}
+
+	return config.Get().PCIMode(lmkID)
+}
@@ -0,0 +1,62 @@
+// Package fuzz provides the protocol fuzzing command.
+package fuzz
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/andrei-cloud/go_hsm/internal/fuzz"
+	"github.com/spf13/cobra"
+)
+
+// NewFuzzCommand creates the fuzz command.
+func NewFuzzCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "fuzz",
+		Short: "Fuzz a running HSM server with malformed requests",
+		Long: `Send a corpus of negative test cases to a running HSM server: malformed frames,
+wrong length headers, truncated commands and invalid hex, followed by random mutations
+of the corpus. Every case must be answered or the connection closed cleanly, and the
+server must keep answering requests throughout. The command fails otherwise, so it can
+be used as a smoke test in CI.`,
+		RunE: runFuzz,
+	}
+
+	cmd.Flags().String("target", "localhost:1500", "HSM server address")
+	cmd.Flags().Int("iterations", 200, "Number of random mutations after the corpus")
+	cmd.Flags().Uint64("seed", 0, "Mutation seed for reproducible runs (0 for random)")
+	cmd.Flags().Duration("timeout", 2*time.Second, "Response timeout per case")
+
+	return cmd
+}
+
+func runFuzz(cmd *cobra.Command, _ []string) error {
+	target, _ := cmd.Flags().GetString("target")
+	iterations, _ := cmd.Flags().GetInt("iterations")
+	seed, _ := cmd.Flags().GetUint64("seed")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+
+	report, err := fuzz.Run(fuzz.Config{
+		Target:     target,
+		Iterations: iterations,
+		Seed:       seed,
+		Timeout:    timeout,
+	})
+
+	cmd.Printf("Seed: %d\n", report.Seed)
+	cmd.Printf("Cases: %d (responses: %d, closed: %d, failures: %d)\n",
+		report.Cases, report.Responses, report.Closed, len(report.Failures))
+	for _, f := range report.Failures {
+		cmd.Printf("FAIL %s: %s\n", f.Case, f.Reason)
+	}
+
+	if err != nil {
+		return fmt.Errorf("fuzzing aborted: %w", err)
+	}
+	if len(report.Failures) > 0 {
+		return errors.New("server did not handle all cases cleanly")
+	}
+
+	return nil
+}
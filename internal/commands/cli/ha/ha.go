@@ -0,0 +1,104 @@
+// Package ha provides high-availability pair simulation commands.
+package ha
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/andrei-cloud/go_hsm/internal/hapair"
+	"github.com/andrei-cloud/go_hsm/pkg/common"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// NewHACommand creates the ha command group.
+func NewHACommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ha",
+		Short: "High-availability pair simulation",
+		Long: `Utilities for running two HSM instances as a high-availability pair.
+Start the instances with 'serve --ha-role primary|standby' so that key store and
+counter state is replicated, and put 'ha vip' in front of them as the virtual
+address hosts connect to.`,
+	}
+
+	// Add subcommands.
+	cmd.AddCommand(newVIPCommand())
+
+	return cmd
+}
+
+func newVIPCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "vip",
+		Short: "Run a virtual address in front of an HA pair",
+		Long: `Listen on a virtual address and forward host connections to the active HSM of
+the pair. When the active HSM stops accepting connections the virtual address
+moves to the other HSM and established connections are dropped. With --flip-every
+the virtual address moves periodically to exercise host failover logic.`,
+		RunE: runVIP,
+	}
+
+	cmd.Flags().String("listen", "localhost:1600", "Virtual address listen address")
+	cmd.Flags().StringSlice("backends", nil, "HSM addresses of the pair, active first")
+	cmd.Flags().Duration("check-interval", time.Second, "Health check interval")
+	cmd.Flags().Duration("flip-every", 0, "Force a failover at this period (test mode)")
+
+	if err := cmd.MarkFlagRequired("backends"); err != nil {
+		panic(err)
+	}
+
+	return cmd
+}
+
+func runVIP(cmd *cobra.Command, _ []string) error {
+	listen, _ := cmd.Flags().GetString("listen")
+	backends, _ := cmd.Flags().GetStringSlice("backends")
+	checkInterval, _ := cmd.Flags().GetDuration("check-interval")
+	flipEvery, _ := cmd.Flags().GetDuration("flip-every")
+
+	common.InitLogger(
+		strings.EqualFold(viper.GetString("log.level"), "debug"),
+		!strings.EqualFold(viper.GetString("log.format"), "json"),
+	)
+
+	vip := &hapair.VirtualAddress{
+		Backends:      backends,
+		CheckInterval: checkInterval,
+		FlipEvery:     flipEvery,
+	}
+
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", listen, err)
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Move the virtual address on SIGUSR1, where the platform has it.
+	flipChan := make(chan os.Signal, 1)
+	if failoverSignal != nil {
+		signal.Notify(flipChan, failoverSignal)
+	}
+	defer signal.Stop(flipChan)
+	go func() {
+		for range flipChan {
+			vip.Failover()
+		}
+	}()
+
+	log.Info().
+		Str("listen", listen).
+		Strs("backends", backends).
+		Str("active", vip.Active()).
+		Msg("ha virtual address started")
+
+	return vip.Serve(ctx, ln)
+}
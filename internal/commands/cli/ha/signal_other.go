@@ -0,0 +1,9 @@
+//go:build !unix
+
+package ha
+
+import "os"
+
+// failoverSignal is nil where there is no SIGUSR1: the virtual address only moves on
+// --flip-every or backend failure.
+var failoverSignal os.Signal
@@ -0,0 +1,11 @@
+//go:build unix
+
+package ha
+
+import (
+	"os"
+	"syscall"
+)
+
+// failoverSignal moves the virtual address to the other backend.
+var failoverSignal os.Signal = syscall.SIGUSR1
@@ -0,0 +1,104 @@
+// Package iso8583 provides ISO 8583 integration commands.
+package iso8583
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/andrei-cloud/go_hsm/internal/isobridge"
+	"github.com/andrei-cloud/go_hsm/pkg/common"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// NewISO8583Command creates the iso8583 command group.
+func NewISO8583Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "iso8583",
+		Short: "ISO 8583 integration utilities",
+		Long:  `Utilities for integrating card switches that speak ISO 8583 with the HSM.`,
+	}
+
+	// Add subcommands.
+	cmd.AddCommand(newBridgeCommand())
+
+	return cmd
+}
+
+func newBridgeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bridge",
+		Short: "Forward PIN operations from ISO 8583 messages to the HSM",
+		Long: `Listen for length-prefixed ISO 8583 messages, build a DC (verify) or CA (translate)
+host command from DE2/DE35, DE52 and DE53, send it to the HSM and answer with the
+request echoed back as a response message. DE39 carries the outcome and, in
+translate mode, DE52 carries the translated PIN block.`,
+		RunE: runBridge,
+	}
+
+	cmd.Flags().String("listen", "localhost:8583", "ISO 8583 listen address")
+	cmd.Flags().String("hsm", "localhost:1500", "HSM server address")
+	cmd.Flags().String("mode", isobridge.ModeVerify, "Operation mode (verify, translate)")
+	cmd.Flags().String("tpk", "", "TPK encrypted under LMK, with scheme tag")
+	cmd.Flags().String("zpk", "", "Destination ZPK encrypted under LMK, with scheme tag")
+	cmd.Flags().String("pvk", "", "PVK encrypted under LMK, with scheme tag")
+	cmd.Flags().String("dst-format", "", "Destination PIN block format code (default: source)")
+	cmd.Flags().String("pvki", "1", "PVK index for verification")
+	cmd.Flags().String("pvv", "", "Expected PVV for verification")
+	cmd.Flags().Duration("timeout", 5*time.Second, "HSM request timeout")
+
+	return cmd
+}
+
+func runBridge(cmd *cobra.Command, _ []string) error {
+	listen, _ := cmd.Flags().GetString("listen")
+	hsmAddr, _ := cmd.Flags().GetString("hsm")
+	mode, _ := cmd.Flags().GetString("mode")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+
+	cfg := isobridge.Config{Mode: strings.ToLower(mode)}
+	cfg.TPK, _ = cmd.Flags().GetString("tpk")
+	cfg.ZPK, _ = cmd.Flags().GetString("zpk")
+	cfg.PVK, _ = cmd.Flags().GetString("pvk")
+	cfg.DstFormat, _ = cmd.Flags().GetString("dst-format")
+	cfg.PVKI, _ = cmd.Flags().GetString("pvki")
+	cfg.PVV, _ = cmd.Flags().GetString("pvv")
+
+	common.InitLogger(
+		strings.EqualFold(viper.GetString("log.level"), "debug"),
+		!strings.EqualFold(viper.GetString("log.format"), "json"),
+	)
+
+	exchanger := &isobridge.TCPExchanger{Addr: hsmAddr, Timeout: timeout}
+	defer func() {
+		_ = exchanger.Close()
+	}()
+
+	bridge, err := isobridge.New(cfg, exchanger)
+	if err != nil {
+		return err
+	}
+
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", listen, err)
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Info().
+		Str("listen", listen).
+		Str("hsm", hsmAddr).
+		Str("mode", cfg.Mode).
+		Msg("iso8583 bridge started")
+
+	return bridge.Serve(ctx, ln)
+}
+
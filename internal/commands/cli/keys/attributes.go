@@ -0,0 +1,142 @@
+// Package keys provides the key block attribute change command implementation.
+package keys
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/andrei-cloud/go_hsm/internal/audit"
+	"github.com/andrei-cloud/go_hsm/internal/authstate"
+	"github.com/andrei-cloud/go_hsm/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func newChangeAttributesCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "change-attributes <key block>",
+		Short: "Rewrap a key block with a new mode of use or exportability",
+		Long: `Rewrap a key block under its LMK with a new mode of use or exportability, keeping the
+key, the other header fields and the optional blocks.
+
+The LMK of the key block must be in authorized state, entered for this invocation with the
+authorized state password of the server (authorized.password or GO_HSM_AUTHORIZED_PASSWORD),
+given with --password or GO_HSM_AUTHORIZED_PASSWORD. Only restrictive changes are permitted,
+to a mode of use that allows a subset of the operations (e.g. B to E) and to a stricter
+exportability (S, then E, then N); --relax overrides this.
+Every change is recorded in the audit log (audit.path).`,
+		Args: cobra.ExactArgs(1),
+		RunE: runChangeAttributes,
+	}
+
+	cmd.Flags().String("mode-of-use", "", "New mode of use (e.g. E, D, G, V, N)")
+	cmd.Flags().String("exportability", "", "New exportability (E, N or S)")
+	cmd.Flags().Bool("relax", false, "Permit changes that relax the key restrictions")
+	cmd.Flags().String("password", "", "Authorized state password (or set "+authstate.PasswordEnv+")")
+	cmd.Flags().String("lmk-id", "", "Key block LMK ID (default: the LMK named in the key block header)")
+
+	return cmd
+}
+
+func runChangeAttributes(cmd *cobra.Command, args []string) error {
+	modeOfUse, err := attributeFlag(cmd, "mode-of-use")
+	if err != nil {
+		return err
+	}
+	exportability, err := attributeFlag(cmd, "exportability")
+	if err != nil {
+		return err
+	}
+	if modeOfUse == 0 && exportability == 0 {
+		return errors.New("--mode-of-use or --exportability is required")
+	}
+
+	keyBlock := []byte(args[0])
+	engine, lmkID, err := keyBlockLMK(cmd, keyBlock)
+	if err != nil {
+		return err
+	}
+	cfg := config.Get()
+	until, err := enterAuthorizedState(cmd, cfg, lmkID)
+	if err != nil {
+		return fmt.Errorf("attribute change refused: %w", err)
+	}
+	relax, _ := cmd.Flags().GetBool("relax")
+	out, old, err := engine.ChangeAttributes(keyBlock, modeOfUse, exportability, relax)
+	if err != nil {
+		return fmt.Errorf("failed to change key block attributes: %w", err)
+	}
+	header, _, key, err := engine.Unwrap(out)
+	if err != nil {
+		return fmt.Errorf("failed to unwrap changed key block: %w", err)
+	}
+	kcv, err := verifyCheckValue(header.Algorithm, key)
+	if err != nil {
+		return err
+	}
+
+	trail := authstate.NewTrail(cmd.ErrOrStderr(), cfg.Audit.Path)
+	err = trail.Record(audit.EventKeyAttributes, map[string]string{
+		"lmk_id":           lmkID,
+		"key_usage":        header.KeyUsage,
+		"kcv":              fmt.Sprintf("%X", kcv),
+		"mode_of_use":      fmt.Sprintf("%c->%c", old.ModeOfUse, header.ModeOfUse),
+		"exportability":    fmt.Sprintf("%c->%c", old.Exportability, header.Exportability),
+		"relax":            fmt.Sprintf("%t", relax),
+		"authorized_until": until.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return fmt.Errorf("attribute change not audited: %w", err)
+	}
+
+	w := cmd.OutOrStdout()
+	_, _ = fmt.Fprintf(w, "Mode of Use: %c -> %c (%s)\n",
+		old.ModeOfUse, header.ModeOfUse, getModeOfUseMeaning(header.ModeOfUse))
+	_, _ = fmt.Fprintf(w, "Exportability: %c -> %c (%s)\n",
+		old.Exportability, header.Exportability, getExportabilityMeaning(header.Exportability))
+	_, _ = fmt.Fprintf(w, "KCV: %X\n", kcv)
+	_, _ = fmt.Fprintf(w, "Key Block: %s\n", out)
+
+	return nil
+}
+
+// enterAuthorizedState puts the LMK lmkID in authorized state for this invocation with the
+// password of the --password flag, as the host command entering it does, and returns the
+// deadline. The password must match the one the server is configured with.
+func enterAuthorizedState(cmd *cobra.Command, cfg *config.Config, lmkID string) (time.Time, error) {
+	rules := cfg.Authorized.HostRules
+	if rules.Password == "" {
+		rules.Password = os.Getenv(authstate.PasswordEnv)
+	}
+	gate, err := authstate.NewHost(rules, authstate.NewState())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid authorized state configuration: %w", err)
+	}
+
+	password, _ := cmd.Flags().GetString("password")
+	if password == "" {
+		password = os.Getenv(authstate.PasswordEnv)
+	}
+	if password == "" {
+		return time.Time{}, fmt.Errorf("%w (use --password or set %s)",
+			authstate.ErrNotAuthorized, authstate.PasswordEnv)
+	}
+
+	return gate.Enter(lmkID, []byte(password), time.Now())
+}
+
+// attributeFlag returns the single character value of an attribute flag, or 0 when the
+// flag is not given.
+func attributeFlag(cmd *cobra.Command, name string) (byte, error) {
+	value, _ := cmd.Flags().GetString(name)
+	switch len(value) {
+	case 0:
+		return 0, nil
+	case 1:
+		return strings.ToUpper(value)[0], nil
+	default:
+		return 0, fmt.Errorf("--%s must be a single character, got %q", name, value)
+	}
+}
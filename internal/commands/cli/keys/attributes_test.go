@@ -0,0 +1,94 @@
+package keys
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/authstate"
+	"github.com/andrei-cloud/go_hsm/internal/config"
+	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+)
+
+// TestChangeAttributes verifies the authorized state and direction checks of an attribute
+// change and that the change is audited. It sets the audit log and the authorized state
+// password of the configuration, so it does not run in parallel.
+func TestChangeAttributes(t *testing.T) {
+	auditPath := filepath.Join(t.TempDir(), "audit.jsonl")
+	cfg := config.Get()
+	defer func(path, password string) {
+		cfg.Audit.Path = path
+		cfg.Authorized.Password = password
+	}(cfg.Audit.Path, cfg.Authorized.Password)
+	cfg.Audit.Path = auditPath
+	cfg.Authorized.Password = "secret"
+	t.Setenv(authstate.PasswordEnv, "")
+
+	block, err := keyblocklmk.WrapKeyBlock(keyblocklmk.DefaultTestAESLMK, keyblocklmk.Header{
+		Version:       '1',
+		KeyUsage:      "K0",
+		Algorithm:     'A',
+		ModeOfUse:     'B',
+		KeyVersionNum: "00",
+		Exportability: 'E',
+	}, nil, bytes.Repeat([]byte{0x11}, 16))
+	if err != nil {
+		t.Fatalf("failed to wrap key block: %v", err)
+	}
+
+	run := func(args ...string) (string, string, error) {
+		var out, errOut bytes.Buffer
+		cmd := newChangeAttributesCommand()
+		cmd.SetOut(&out)
+		cmd.SetErr(&errOut)
+		cmd.SetArgs(append([]string{string(block)}, args...))
+		err := cmd.Execute()
+
+		return out.String(), errOut.String(), err
+	}
+
+	if _, _, err := run("--mode-of-use", "E"); err == nil ||
+		!strings.Contains(err.Error(), authstate.ErrNotAuthorized.Error()) {
+		t.Errorf("change outside authorized state error = %v", err)
+	}
+	if _, _, err := run("--mode-of-use", "E", "--password", "wrong"); err == nil ||
+		!strings.Contains(err.Error(), authstate.ErrPasswordRejected.Error()) {
+		t.Errorf("change with wrong password error = %v", err)
+	}
+
+	out, echo, err := run("--mode-of-use", "e", "--exportability", "N", "--password", "secret")
+	if err != nil {
+		t.Fatalf("restrictive change error = %v", err)
+	}
+	if !strings.Contains(out, "Mode of Use: B -> E") || !strings.Contains(out, "Exportability: E -> N") {
+		t.Errorf("output = %q", out)
+	}
+	if !strings.Contains(echo, `"event":"key_attributes_changed"`) || !strings.Contains(echo, `"mode_of_use":"B->E"`) {
+		t.Errorf("echoed audit record = %q", echo)
+	}
+	logged, err := os.ReadFile(auditPath)
+	if err != nil {
+		t.Fatalf("read audit log: %v", err)
+	}
+	if !strings.Contains(string(logged), `"event":"key_attributes_changed"`) ||
+		!strings.Contains(string(logged), `"key_usage":"K0"`) {
+		t.Errorf("audit log = %s", logged)
+	}
+
+	if _, _, err := run("--exportability", "S", "--password", "secret"); err == nil {
+		t.Error("relaxing change accepted without --relax")
+	}
+	t.Setenv(authstate.PasswordEnv, "secret")
+	if _, _, err := run("--exportability", "S", "--relax"); err != nil {
+		t.Errorf("relaxing change with --relax error = %v", err)
+	}
+	cfg.Authorized.Password = ""
+	if _, _, err := run("--exportability", "N", "--password", "wrong"); err == nil {
+		t.Error("change accepted with a password other than GO_HSM_AUTHORIZED_PASSWORD")
+	}
+	if _, _, err := run("--password", "secret"); err == nil {
+		t.Error("change without attributes accepted")
+	}
+}
@@ -0,0 +1,78 @@
+package keys
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/audit"
+	"github.com/andrei-cloud/go_hsm/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// TestKeyEventsAudited verifies that generating, splitting and exporting keys is recorded in
+// the audit log. It sets the audit log of the configuration, so it does not run in parallel.
+func TestKeyEventsAudited(t *testing.T) {
+	auditPath := filepath.Join(t.TempDir(), "audit.jsonl")
+	cfg := config.Get()
+	defer func(path string) { cfg.Audit.Path = path }(cfg.Audit.Path)
+	cfg.Audit.Path = auditPath
+
+	storePath := filepath.Join(t.TempDir(), "keystore.json")
+	run := func(cmd func() *cobra.Command, args ...string) string {
+		t.Helper()
+
+		var out bytes.Buffer
+		c := cmd()
+		c.SetOut(&out)
+		c.SetErr(&out)
+		c.SetArgs(args)
+		if err := c.Execute(); err != nil {
+			t.Fatalf("%v failed: %v\n%s", args, err, out.String())
+		}
+
+		return out.String()
+	}
+
+	generated := run(newGenerateKeyCommand, "--type", "001", "--count", "2", "--output", "ndjson")
+	var zpk generatedKey
+	if err := json.Unmarshal([]byte(strings.SplitN(generated, "\n", 2)[0]), &zpk); err != nil {
+		t.Fatalf("invalid generate output %q: %v", generated, err)
+	}
+	run(newComponentsCommand, "--count", "3")
+	run(newComponentsCommand, "--key", "0123456789ABCDEFFEDCBA9876543210")
+	run(newStoreCommand, "--id", "zpk", "--key", zpk.Key, "--type", "001", "--store", storePath)
+	run(newExportCommand, "zpk", "--store", storePath)
+
+	data, err := os.ReadFile(auditPath)
+	if err != nil {
+		t.Fatalf("read audit log: %v", err)
+	}
+	if n, err := audit.Verify(bytes.NewReader(data)); err != nil || n != 5 {
+		t.Fatalf("audit.Verify() = %d, %v, want 5 records", n, err)
+	}
+	var events []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var r audit.Record
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("invalid audit record %q: %v", line, err)
+		}
+		events = append(events, r.Fields["command"]+": "+r.Event)
+	}
+	want := []string{
+		"keys generate: " + audit.EventKeyGenerated,
+		"keys generate: " + audit.EventKeyGenerated,
+		"keys components: " + audit.EventKeyGenerated,
+		"keys components: " + audit.EventKeyExported,
+		"keys export: " + audit.EventKeyExported,
+	}
+	if strings.Join(events, ", ") != strings.Join(want, ", ") {
+		t.Errorf("audited events = %q, want %q", events, want)
+	}
+	if !strings.Contains(string(data), `"kcv":"`+zpk.KCV+`"`) {
+		t.Errorf("audit log lacks the KCV %s of the generated key", zpk.KCV)
+	}
+}
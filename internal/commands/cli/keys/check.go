@@ -5,13 +5,15 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"strconv"
 	"strings"
 	"text/tabwriter"
 
 	"github.com/andrei-cloud/go_hsm/internal/hsm/logic"
-	"github.com/andrei-cloud/go_hsm/pkg/crypto"
 	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+	"github.com/andrei-cloud/go_hsm/pkg/keyschemes"
 	"github.com/andrei-cloud/go_hsm/pkg/variantlmk"
 	"github.com/spf13/cobra"
 )
@@ -25,10 +27,14 @@ func newCheckKeyCommand() *cobra.Command {
 	// Add flags.
 	cmd.Flags().String("key", "", "Encrypted key with scheme prefix (e.g. U1234...)")
 	cmd.Flags().String("type", "", "Key type code (e.g. 000, 001, 002)")
-	cmd.Flags().String("scheme", "", "Key scheme override (X=single, U=double, T=triple length)")
-	cmd.Flags().Bool("pci", false, "Enable PCI compliance mode")
+	cmd.Flags().String("scheme", "",
+		"Key scheme override (X=single, U=double, T=triple length, A/B/C=AES-128/192/256)")
+	cmd.Flags().Bool("pci", false, "Override the configured PCI compliance mode")
 	cmd.Flags().String("keyblock", "", "Key block string to parse.")
 	cmd.Flags().String("lmk-id", "00", "LMK ID for key validation (00=variant, 01=key block)")
+	cmd.Flags().String("ksn", "", "KSN to check against a DUKPT BDK or initial key block")
+	cmd.Flags().String("batch", "", "NDJSON file of {\"key\",\"type\"} records to check (- for stdin)")
+	cmd.Flags().Bool("gzip", false, "Gzip compress batch output")
 
 	return cmd
 }
@@ -45,10 +51,13 @@ func runCheckKey(cmd *cobra.Command, _ []string) error {
 	}
 
 	// Variant key mode: decrypt via registry
+	if batch, _ := cmd.Flags().GetString("batch"); batch != "" {
+		return runCheckKeyBatch(cmd, batch, lmkID)
+	}
 	encryptedKeyHex, _ := cmd.Flags().GetString("key")
 	keyType, _ := cmd.Flags().GetString("type")
 	schemeStr, _ := cmd.Flags().GetString("scheme")
-	pciMode, _ := cmd.Flags().GetBool("pci")
+	pciMode := pciModeFlag(cmd, lmkID)
 	if encryptedKeyHex == "" {
 		return errors.New("--key is required when not parsing a key block")
 	}
@@ -56,74 +65,132 @@ func runCheckKey(cmd *cobra.Command, _ []string) error {
 		return errors.New("--type is required when not parsing a key block")
 	}
 
-	// Validate encrypted key format.
-	if len(encryptedKeyHex) < 2 {
-		return errors.New("encrypted key must include scheme prefix")
-	}
-
-	// Extract scheme from key if not explicitly provided.
-	keyScheme := encryptedKeyHex[0]
-	keyHex := encryptedKeyHex[1:]
-	// Determine scheme to use for validation and output.
-	persistScheme := string(keyScheme)
-
 	// Override scheme if provided.
 	if schemeStr != "" {
 		schemeStr = strings.ToUpper(schemeStr)
-		if schemeStr != "X" && schemeStr != "U" && schemeStr != "T" {
-			return errors.New("scheme must be X (single), U (double), or T (triple)")
+		if !isVariantScheme(schemeStr) {
+			return errors.New("scheme must be X (single), U (double), T (triple), or A, B or C (AES)")
 		}
-		keyScheme = schemeStr[0]
-		persistScheme = schemeStr
+		encryptedKeyHex = schemeStr + encryptedKeyHex[1:]
+	}
+
+	result, err := checkVariantKey(lmkID, encryptedKeyHex, keyType, pciMode)
+	if err != nil {
+		return err
 	}
 
-	// Validate scheme character.
-	if keyScheme != 'X' && keyScheme != 'U' && keyScheme != 'T' {
-		return fmt.Errorf("invalid scheme character: %c", keyScheme)
+	// Output results.
+	cmd.Printf("Key Type: %s\n", result.kt.String())
+	cmd.Printf("Key Scheme: %c\n", result.scheme)
+	cmd.Printf("Encrypted Key: %s\n", result.Key)
+	cmd.Printf("KCV: %s\n", result.KCV)
+	if result.ParityValid != nil {
+		cmd.Printf("Parity Valid: %t\n", *result.ParityValid)
 	}
 
-	// Decode encrypted key.
-	encryptedKey, err := hex.DecodeString(keyHex)
+	return nil
+}
+
+// checkedKey is the result of checking a variant key, and one record of NDJSON batch output.
+type checkedKey struct {
+	Key         string `json:"key"`
+	Type        string `json:"type"`
+	KCV         string `json:"kcv,omitempty"`
+	ParityValid *bool  `json:"parity_valid,omitempty"`
+	Error       string `json:"error,omitempty"`
+
+	kt     variantlmk.KeyType
+	scheme byte
+}
+
+// checkVariantKey decrypts a variant key under the LMK and reports its KCV and parity.
+func checkVariantKey(lmkID, encryptedKeyHex, keyType string, pciMode bool) (checkedKey, error) {
+	key, err := keyschemes.ParseLMKKey(encryptedKeyHex)
 	if err != nil {
-		return fmt.Errorf("invalid encrypted key format: %w", err)
+		return checkedKey{}, fmt.Errorf("invalid encrypted key: %w", err)
+	}
+	keyScheme := key.Scheme
+	encryptedKey, err := key.Bytes()
+	if err != nil {
+		return checkedKey{}, fmt.Errorf("invalid encrypted key format: %w", err)
 	}
 
 	// Validate key type.
 	kt, err := variantlmk.GetKeyTypeDetails(keyType, pciMode)
 	if err != nil {
-		return fmt.Errorf("invalid key type: %w", err)
+		return checkedKey{}, fmt.Errorf("invalid key type: %w", err)
 	}
 
 	// Lookup LMK engine for variant.
 	engine, ok := logic.LMKRegistry[lmkID]
 	if !ok || engine.GetLMKType() != logic.LMKTypeVariant {
-		return fmt.Errorf("invalid or unsupported LMK ID '%s' for variant key", lmkID)
+		return checkedKey{}, fmt.Errorf("invalid or unsupported LMK ID '%s' for variant key", lmkID)
+	}
+	if variant, ok := engine.(logic.VariantLMKProvider); ok {
+		engine = variant.WithPCIMode(pciMode)
 	}
 
 	// Decrypt using registry engine.
 	clearKey, err := engine.DecryptUnderLMK(encryptedKey, keyType, keyScheme, lmkID)
 	if err != nil {
-		return fmt.Errorf("failed to decrypt key under LMK %s: %w", lmkID, err)
+		return checkedKey{}, fmt.Errorf("failed to decrypt key under LMK %s: %w", lmkID, err)
 	}
 
-	// Verify key parity.
-	parityValid := cryptoutils.CheckKeyParity(clearKey)
+	kcv, err := variantKeyCheckValue(keyScheme, clearKey)
+	if err != nil {
+		return checkedKey{}, fmt.Errorf("failed to calculate KCV: %w", err)
+	}
+	result := checkedKey{
+		Key:    fmt.Sprintf("%c%s", keyScheme, strings.ToUpper(hex.EncodeToString(encryptedKey))),
+		Type:   keyType,
+		KCV:    strings.ToUpper(hex.EncodeToString(kcv)),
+		kt:     kt,
+		scheme: keyScheme,
+	}
+	// Verify key parity; AES keys have none.
+	if !keyschemes.IsAES(keyScheme) {
+		parityValid := cryptoutils.CheckKeyParity(clearKey)
+		result.ParityValid = &parityValid
+	}
 
-	// Calculate KCV.
-	kcv := crypto.CalculateKCV(clearKey)
+	return result, nil
+}
 
-	// Output results.
-	cmd.Printf("Key Type: %s\n", kt.String())
-	cmd.Printf("Key Scheme: %c\n", keyScheme)
-	cmd.Printf(
-		"Encrypted Key: %s%s\n",
-		persistScheme,
-		strings.ToUpper(hex.EncodeToString(encryptedKey)),
-	)
-	cmd.Printf("KCV: %s\n", strings.ToUpper(hex.EncodeToString(kcv)))
-	cmd.Printf("Parity Valid: %t\n", parityValid)
+// runCheckKeyBatch checks the variant keys of an NDJSON batch, streaming one result per
+// key. A key that fails the check is reported in its record; malformed input stops the batch.
+func runCheckKeyBatch(cmd *cobra.Command, path, lmkID string) error {
+	compress, _ := cmd.Flags().GetBool("gzip")
+	pciMode := pciModeFlag(cmd, lmkID)
 
-	return nil
+	dec, closeBatch, err := openNDJSON(cmd, path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = closeBatch()
+	}()
+
+	out := newNDJSONWriter(cmd.OutOrStdout(), compress)
+	for n := 1; ; n++ {
+		var in checkedKey
+		if err := dec.Decode(&in); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			_ = out.Close()
+
+			return fmt.Errorf("invalid batch record %d: %w", n, err)
+		}
+
+		result, err := checkVariantKey(lmkID, in.Key, in.Type, pciMode)
+		if err != nil {
+			result = checkedKey{Key: in.Key, Type: in.Type, Error: err.Error()}
+		}
+		if err := out.Write(result); err != nil {
+			return fmt.Errorf("failed to write batch result %d: %w", n, err)
+		}
+	}
+
+	return out.Close()
 }
 
 // runCheckKeyBlock parses and validates a key block using registry LMK.
@@ -134,7 +201,7 @@ func runCheckKeyBlock(cmd *cobra.Command, keyBlock string) {
 	}
 
 	scheme := keyBlock[0]
-	if scheme != 'S' && scheme != 'K' && scheme != 'R' {
+	if !keyschemes.IsKeyBlock(scheme) {
 		cmd.Println("Error: key block must start with S, K, or R prefix.")
 		return
 	}
@@ -216,11 +283,18 @@ func runCheckKeyBlock(cmd *cobra.Command, keyBlock string) {
 	)
 	_, _ = fmt.Fprintf(w, "12-13\tNumber of optional blocks\t%s\t%d optional blocks\n",
 		optCountStr, optCount)
-	_, _ = fmt.Fprintf(w, "14-15\tLMK ID\t%s\t%s\n", reserved, getLMKIDMeaning(reserved))
+	if scheme == keyblocklmk.TR31SchemeTag {
+		// TR-31 blocks carry the key context in byte 14 and reserve byte 15.
+		_, _ = fmt.Fprintf(w, "14\tKey context\t%c\t%s\n", header[14], getKeyContextMeaning(header[14]))
+		_, _ = fmt.Fprintf(w, "15\tReserved\t%c\t\n", header[15])
+	} else {
+		_, _ = fmt.Fprintf(w, "14-15\tLMK ID\t%s\t%s\n", reserved, getLMKIDMeaning(reserved))
+	}
 	_ = w.Flush()
 
 	// Parse optional header blocks.
 	totalOptionalLength := 0
+	optBlocks := make([]keyblocklmk.OptionalBlock, 0, optCount)
 	if optCount > 0 {
 		cmd.Printf("\nOptional Header Blocks\n")
 
@@ -281,12 +355,19 @@ func runCheckKeyBlock(cmd *cobra.Command, keyBlock string) {
 			}
 			_ = wOpt.Flush()
 
+			optBlocks = append(optBlocks, keyblocklmk.OptionalBlock{Tag: identifier, Value: blockData})
 			offset += int(blockLength)
 			totalOptionalLength += int(blockLength)
 		}
 
 		cmd.Printf("\nTotal Optional Header Length: %d bytes\n", totalOptionalLength)
-	} // For Thales 'S' format, the remaining data after header and optional blocks is hex-encoded.
+	}
+	if usageCode == keyblocklmk.KeyUsageBDK || usageCode == keyblocklmk.KeyUsageIPEK {
+		ksn, _ := cmd.Flags().GetString("ksn")
+		printDUKPTNamespace(cmd, &keyblocklmk.Header{KeyUsage: usageCode}, optBlocks, ksn)
+	}
+
+	// For Thales 'S' format, the remaining data after header and optional blocks is hex-encoded.
 	macStartIdx := offset
 	hexEncodedData := data[macStartIdx:]
 
@@ -365,16 +446,26 @@ func runCheckKeyBlock(cmd *cobra.Command, keyBlock string) {
 	cmd.Printf("- Encrypted Key Data: %d bytes\n", encryptedKeyBytes)
 	cmd.Printf("- MAC: %d bytes\n", macBytes)
 
-	// Determine key-block LMK ID
+	// Determine key-block LMK ID: the LMK named in the header unless --lmk-id selects one.
 	lmkID, _ := cmd.Flags().GetString("lmk-id")
-	if lmkID == "00" {
-		lmkID = "01"
-	}
-
-	engine, ok := logic.LMKRegistry[lmkID]
-	if !ok || engine.GetLMKType() != logic.LMKTypeKeyBlock {
-		cmd.Printf("Error: invalid LMK ID '%s' for key block\n", lmkID)
-		return
+	var engine logic.LMKEngine
+	if cmd.Flags().Changed("lmk-id") {
+		if lmkID == "00" {
+			lmkID = "01"
+		}
+		var ok bool
+		engine, ok = logic.LMKRegistry[lmkID]
+		if !ok || engine.GetLMKType() != logic.LMKTypeKeyBlock {
+			cmd.Printf("Error: invalid LMK ID '%s' for key block\n", lmkID)
+			return
+		}
+	} else {
+		lmk, id, err := logic.KeyBlockLMKFor([]byte(keyBlock))
+		if err != nil {
+			cmd.Printf("Error: %v\n", err)
+			return
+		}
+		engine, lmkID = lmk, id
 	}
 
 	// Decrypt key block
@@ -392,3 +483,36 @@ func runCheckKeyBlock(cmd *cobra.Command, keyBlock string) {
 	cmd.Println("Key block validated.")
 	cmd.Printf("Clear Key: %X\n", clearKey)
 }
+
+// printDUKPTNamespace reports the KSN namespace of a DUKPT key block and, when ksn is set,
+// whether the KSN belongs to it.
+func printDUKPTNamespace(
+	cmd *cobra.Command,
+	header *keyblocklmk.Header,
+	optBlocks []keyblocklmk.OptionalBlock,
+	ksn string,
+) {
+	cmd.Printf("\nDUKPT Key Namespace\n")
+	if err := keyblocklmk.ValidateDUKPTBlocks(header, optBlocks); err != nil {
+		cmd.Printf("Error: %v\n", err)
+		return
+	}
+	for _, tag := range []string{
+		keyblocklmk.OptionalBlockBDKID,
+		keyblocklmk.OptionalBlockKSN,
+		keyblocklmk.OptionalBlockInitialKeyID,
+	} {
+		if b, ok := keyblocklmk.FindOptionalBlock(optBlocks, tag); ok {
+			cmd.Printf("%s: %s\n", getOptionalBlockMeaning(tag),
+				getOptionalBlockDataMeaning(tag, string(b.Value)))
+		}
+	}
+	if ksn == "" {
+		return
+	}
+	if err := keyblocklmk.CheckKSN(header, optBlocks, ksn); err != nil {
+		cmd.Printf("KSN %s rejected: %v\n", ksn, err)
+		return
+	}
+	cmd.Printf("KSN %s belongs to this key.\n", strings.ToUpper(ksn))
+}
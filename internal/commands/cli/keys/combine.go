@@ -0,0 +1,60 @@
+package keys
+
+import (
+	"fmt"
+
+	"github.com/andrei-cloud/go_hsm/pkg/crypto"
+	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+	"github.com/spf13/cobra"
+)
+
+func newCombineCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "combine <component key block>...",
+		Short: "Combine component key blocks into a key block",
+		Long: `Combine key components held in key blocks into the final key block.
+Each component key block carries key version c1 to cN for a set of N components, and all
+components must share the same header apart from the key version. The component keys are
+XOR-combined and the result is wrapped with key version 00.`,
+		Args: cobra.RangeArgs(keyblocklmk.MinComponents, keyblocklmk.MaxComponents),
+		RunE: runCombine,
+	}
+
+	cmd.Flags().String("lmk-id", "", "Key block LMK ID (default: the LMK named in the first component header)")
+
+	return cmd
+}
+
+func runCombine(cmd *cobra.Command, args []string) error {
+	engine, _, err := keyBlockLMK(cmd, []byte(args[0]))
+	if err != nil {
+		return err
+	}
+
+	blocks := make([][]byte, len(args))
+	for i, arg := range args {
+		blocks[i] = []byte(arg)
+	}
+	keyBlock, clearKey, err := engine.CombineComponents(blocks)
+	if err != nil {
+		return fmt.Errorf("failed to combine components: %w", err)
+	}
+
+	header, err := keyblocklmk.ParseHeader(keyBlock)
+	if err != nil {
+		return fmt.Errorf("failed to parse combined key block: %w", err)
+	}
+	kcv := crypto.CalculateKCV(clearKey)
+	if header.Algorithm == 'A' {
+		if kcv, err = keyblocklmk.CalculateCMACCheckValue(clearKey); err != nil {
+			return fmt.Errorf("failed to calculate check value: %w", err)
+		}
+		kcv = kcv[:crypto.KCVLength]
+	}
+
+	cmd.Printf("Components: %d\n", len(blocks))
+	cmd.Printf("Key Block: %s\n", keyBlock)
+	cmd.Printf("KCV: %X\n", kcv)
+
+	return nil
+}
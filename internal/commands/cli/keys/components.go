@@ -0,0 +1,107 @@
+// Package keys provides key component mailer command implementation.
+package keys
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/andrei-cloud/go_hsm/internal/audit"
+	"github.com/andrei-cloud/go_hsm/internal/config"
+	"github.com/andrei-cloud/go_hsm/pkg/crypto"
+	"github.com/spf13/cobra"
+)
+
+func newComponentsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "components",
+		Short: "Split a clear key into printed key components",
+		Long: `Split a clear key into XOR components and render each one in the standard
+component mailer format: groups of 4 hex characters, a check digit per line and the
+component KCV. Without --key a random key of the given scheme is generated.
+With --spool-dir each form is written to its own file for printing, one per custodian.
+The key is recorded in the audit log (audit.path) with its KCV, as generated or, when
+given with --key, as exported in components.`,
+		RunE: runComponents,
+	}
+
+	// Add flags.
+	cmd.Flags().String("key", "", "Clear key to split (hex); random if omitted")
+	cmd.Flags().String("scheme", "U", "Key scheme for a random key (X=single, U=double, T=triple length)")
+	cmd.Flags().Int("count", 2, "Number of components (2-9)")
+	cmd.Flags().String("spool-dir", "", "Write each component form to a file in this directory")
+
+	return cmd
+}
+
+func runComponents(cmd *cobra.Command, _ []string) error {
+	keyHex, _ := cmd.Flags().GetString("key")
+	scheme, _ := cmd.Flags().GetString("scheme")
+	count, _ := cmd.Flags().GetInt("count")
+	spoolDir, _ := cmd.Flags().GetString("spool-dir")
+
+	if count < 2 || count > 9 {
+		return fmt.Errorf("invalid component count %d: must be 2-9", count)
+	}
+
+	event := audit.EventKeyExported
+	if keyHex == "" {
+		event = audit.EventKeyGenerated
+		bits := map[string]int{"X": crypto.KeyLength64, "U": crypto.KeyLength128, "T": crypto.KeyLength192}
+		length, ok := bits[strings.ToUpper(scheme)]
+		if !ok {
+			return fmt.Errorf("invalid scheme: %s (must be X, U, or T)", scheme)
+		}
+		var err error
+		if keyHex, _, err = crypto.GenerateKey(length, true); err != nil {
+			return fmt.Errorf("failed to generate key: %w", err)
+		}
+	}
+
+	components, kcv, err := crypto.SplitKey(keyHex, count)
+	if err != nil {
+		return fmt.Errorf("failed to split key: %w", err)
+	}
+	if err := audit.Append(config.Get().Audit.Path, event, map[string]string{
+		"command":    "keys components",
+		"kcv":        strings.ToUpper(kcv),
+		"components": strconv.Itoa(count),
+	}); err != nil {
+		return fmt.Errorf("key components not audited: %w", err)
+	}
+
+	if spoolDir != "" {
+		if err := os.MkdirAll(spoolDir, 0o700); err != nil {
+			return fmt.Errorf("failed to create spool directory: %w", err)
+		}
+	}
+
+	for i, component := range components {
+		form, err := crypto.FormatComponentMailer(component, i+1, count)
+		if err != nil {
+			return fmt.Errorf("failed to format component %d: %w", i+1, err)
+		}
+
+		if spoolDir == "" {
+			cmd.Println(form)
+
+			continue
+		}
+		path := filepath.Join(spoolDir, fmt.Sprintf("component_%d_of_%d.txt", i+1, count))
+		if err := os.WriteFile(path, []byte(form), 0o600); err != nil {
+			return fmt.Errorf("failed to spool component %d: %w", i+1, err)
+		}
+		cmd.Printf("Component %d spooled to %s\n", i+1, path)
+	}
+
+	raw, _ := hex.DecodeString(keyHex)
+	cmd.Printf("Key KCV: %s\n", strings.ToUpper(kcv))
+	if len(raw) > 0 && !crypto.ValidateKeyParity(raw) {
+		cmd.Println("Warning: key does not have odd parity")
+	}
+
+	return nil
+}
@@ -4,9 +4,14 @@ package keys
 import (
 	"encoding/hex"
 	"fmt"
+	"strconv"
 	"strings"
 
+	"github.com/andrei-cloud/go_hsm/internal/audit"
+	"github.com/andrei-cloud/go_hsm/internal/config"
 	"github.com/andrei-cloud/go_hsm/pkg/crypto"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/keyschemes"
 	"github.com/andrei-cloud/go_hsm/pkg/variantlmk"
 	"github.com/spf13/cobra"
 )
@@ -17,15 +22,21 @@ func newGenerateKeyCommand() *cobra.Command {
 		Short: "Generate a random cryptographic key",
 		Long: `Generate a random cryptographic key of specified type and scheme.
 The command outputs the key encrypted under LMK, its Key Check Value (KCV),
-and key type description. Optionally displays the clear key for testing purposes.`,
+and key type description. Optionally displays the clear key for testing purposes.
+Every generated key is recorded in the audit log (audit.path) with its KCV.
+With --count and --output ndjson, keys are streamed one JSON record per line, optionally
+gzip compressed with --gzip, for bulk migrations.`,
 		RunE: runGenerateKey,
 	}
 
 	// Add flags.
 	cmd.Flags().String("type", "", "Key type code (e.g. 000, 001, 002)")
-	cmd.Flags().String("scheme", "U", "Key scheme (X=single, U=double, T=triple length)")
+	cmd.Flags().String("scheme", "U",
+		"Key scheme (X=single, U=double, T=triple length, A/B/C=AES-128/192/256)")
 	cmd.Flags().Bool("clear", false, "Display clear key value")
-	cmd.Flags().Bool("pci", false, "Enable PCI compliance mode")
+	cmd.Flags().Bool("pci", false, "Override the configured PCI compliance mode")
+	cmd.Flags().Int("count", 1, "Number of keys to generate")
+	addBulkFlags(cmd)
 
 	if err := cmd.MarkFlagRequired("type"); err != nil {
 		panic(err)
@@ -34,12 +45,29 @@ and key type description. Optionally displays the clear key for testing purposes
 	return cmd
 }
 
+// generatedKey is one key of NDJSON generate output.
+type generatedKey struct {
+	KeyType  string `json:"type"`
+	Scheme   string `json:"scheme"`
+	Key      string `json:"key"`
+	KCV      string `json:"kcv"`
+	ClearKey string `json:"clear_key,omitempty"`
+}
+
 func runGenerateKey(cmd *cobra.Command, _ []string) error {
 	// Get command flags.
 	keyType, _ := cmd.Flags().GetString("type")
 	scheme, _ := cmd.Flags().GetString("scheme")
 	showClear, _ := cmd.Flags().GetBool("clear")
-	pciMode, _ := cmd.Flags().GetBool("pci")
+	count, _ := cmd.Flags().GetInt("count")
+	pciMode := pciModeFlag(cmd, "00")
+	output, compress, err := bulkOutput(cmd)
+	if err != nil {
+		return err
+	}
+	if count < 1 {
+		return fmt.Errorf("invalid count: %d", count)
+	}
 
 	// Load LMK set.
 	lmkSet, err := variantlmk.LoadDefaultLMKSet()
@@ -55,12 +83,130 @@ func runGenerateKey(cmd *cobra.Command, _ []string) error {
 
 	// Validate and normalize scheme.
 	scheme = strings.ToUpper(scheme)
-	if scheme != "X" && scheme != "U" && scheme != "T" {
-		return fmt.Errorf("invalid scheme: %s (must be X, U, or T)", scheme)
+	if !isVariantScheme(scheme) {
+		return fmt.Errorf("invalid scheme: %s (must be X, U, T, A, B or C)", scheme)
 	}
 
 	schemeChar := scheme[0]
 
+	auditLog, err := openAuditLog()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = auditLog.Close() }()
+
+	var out *ndjsonWriter
+	if output == outputNDJSON {
+		out = newNDJSONWriter(cmd.OutOrStdout(), compress)
+	}
+	for i := range count {
+		clearKey, encrypted, kcv, err := generateVariantKey(lmkSet, keyType, schemeChar, pciMode)
+		if err != nil {
+			return err
+		}
+		if err := auditLog.Record(audit.EventKeyGenerated, map[string]string{
+			"command":  "keys generate",
+			"lmk_id":   "00",
+			"key_type": keyType,
+			"scheme":   scheme,
+			"kcv":      strings.ToUpper(hex.EncodeToString(kcv)),
+			"clear":    strconv.FormatBool(showClear),
+		}); err != nil {
+			return fmt.Errorf("key %d generated but not audited: %w", i+1, err)
+		}
+
+		if out != nil {
+			record := generatedKey{
+				KeyType: keyType,
+				Scheme:  scheme,
+				Key:     scheme + strings.ToUpper(hex.EncodeToString(encrypted)),
+				KCV:     strings.ToUpper(hex.EncodeToString(kcv)),
+			}
+			if showClear {
+				record.ClearKey = strings.ToUpper(hex.EncodeToString(clearKey))
+			}
+			if err := out.Write(record); err != nil {
+				return fmt.Errorf("failed to write key %d: %w", i+1, err)
+			}
+
+			continue
+		}
+
+		// Output results.
+		if i > 0 {
+			cmd.Println()
+		}
+		cmd.Printf("Key Type: %s\n", kt.String())
+		cmd.Printf("Key Scheme: %c\n", schemeChar)
+		cmd.Printf("Encrypted Key: %s%s\n", scheme, strings.ToUpper(hex.EncodeToString(encrypted)))
+		cmd.Printf("KCV: %s\n", strings.ToUpper(hex.EncodeToString(kcv)))
+
+		if showClear {
+			cmd.Printf("Clear Key: %s\n", strings.ToUpper(hex.EncodeToString(clearKey)))
+		}
+	}
+	if out != nil {
+		return out.Close()
+	}
+
+	return nil
+}
+
+// openAuditLog opens the configured audit log. When the audit log is disabled it returns a
+// nil log, which records nothing.
+func openAuditLog() (*audit.Log, error) {
+	path := config.Get().Audit.Path
+	if path == "" {
+		return nil, nil
+	}
+
+	return audit.Open(path)
+}
+
+// generateVariantKey generates a random key of the given scheme and returns it in the clear,
+// encrypted under the variant LMK set, and its KCV.
+func generateVariantKey(
+	lmkSet variantlmk.LMKSet,
+	keyType string,
+	schemeChar byte,
+	pciMode bool,
+) ([]byte, []byte, []byte, error) {
+	clearKey, err := randomVariantKey(schemeChar)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Encrypt under variant LMK.
+	encrypted, err := variantlmk.EncryptKeyUnderScheme(
+		keyType,
+		schemeChar,
+		clearKey,
+		lmkSet,
+		false,
+		pciMode,
+	)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to encrypt key: %w", err)
+	}
+	kcv, err := variantKeyCheckValue(schemeChar, clearKey)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to calculate KCV: %w", err)
+	}
+
+	return clearKey, encrypted, kcv, nil
+}
+
+// randomVariantKey generates a random clear key of the length of the scheme.
+func randomVariantKey(schemeChar byte) ([]byte, error) {
+	if keyschemes.IsAES(schemeChar) {
+		clearKey, err := cryptoutils.GenerateRandomAESKey(keyschemes.LMKLength(schemeChar))
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate key: %w", err)
+		}
+
+		return clearKey, nil
+	}
+
 	// Determine key length based on scheme.
 	var keyLen int
 	switch schemeChar {
@@ -71,45 +217,20 @@ func runGenerateKey(cmd *cobra.Command, _ []string) error {
 	case 'T':
 		keyLen = 192 // Triple length DES: 24 bytes = 192 bits.
 	default:
-		return fmt.Errorf("unsupported scheme: %c", schemeChar)
+		return nil, fmt.Errorf("unsupported scheme: %c", schemeChar)
 	}
 
 	// Generate random key.
 	clearKeyHex, _, err := crypto.GenerateKey(keyLen, true)
 	if err != nil {
-		return fmt.Errorf("failed to generate key: %w", err)
+		return nil, fmt.Errorf("failed to generate key: %w", err)
 	}
 
 	// Convert hex string to bytes.
 	clearKey, err := hex.DecodeString(clearKeyHex)
 	if err != nil {
-		return fmt.Errorf("failed to decode generated key: %w", err)
-	}
-
-	// Calculate KCV.
-	kcv := crypto.CalculateKCV(clearKey)
-
-	// Encrypt under variant LMK.
-	encrypted, err := variantlmk.EncryptKeyUnderScheme(
-		keyType,
-		schemeChar,
-		clearKey,
-		lmkSet,
-		false,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to encrypt key: %w", err)
+		return nil, fmt.Errorf("failed to decode generated key: %w", err)
 	}
 
-	// Output results.
-	cmd.Printf("Key Type: %s\n", kt.String())
-	cmd.Printf("Key Scheme: %c\n", schemeChar)
-	cmd.Printf("Encrypted Key: %s%s\n", scheme, strings.ToUpper(hex.EncodeToString(encrypted)))
-	cmd.Printf("KCV: %s\n", strings.ToUpper(hex.EncodeToString(kcv)))
-
-	if showClear {
-		cmd.Printf("Clear Key: %s\n", strings.ToUpper(hex.EncodeToString(clearKey)))
-	}
-
-	return nil
+	return clearKey, nil
 }
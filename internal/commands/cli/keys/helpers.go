@@ -1,7 +1,14 @@
 // Package keys provides helper functions for key block parsing.
 package keys
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/andrei-cloud/go_hsm/internal/hsm/logic"
+	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+	"github.com/spf13/cobra"
+)
 
 func getVersionMeaning(b byte) string {
 	switch b {
@@ -176,7 +183,9 @@ func getOptionalBlockMeaning(identifier string) string {
 		"04": "End Date/Time",
 		"05": "Text",
 		// TR-31 standard optional header blocks.
-		"KS": "Key Set Identifier",
+		"BI": "Base Derivation Key Identifier",
+		"IK": "Initial Key Identifier (AES DUKPT)",
+		"KS": "Key Set Identifier / Initial KSN (TDES DUKPT)",
 		"KV": "Key Block version",
 		"PB": "Padding block",
 		// Additional TR-31 blocks.
@@ -249,6 +258,17 @@ func getOptionalBlockDataMeaning(identifier, data string) string {
 		return fmt.Sprintf("End date/time: %s", data)
 	case "05": // Text.
 		return fmt.Sprintf("Text data: %s", data)
+	case "BI": // Base Derivation Key Identifier.
+		switch {
+		case strings.HasPrefix(data, "00"):
+			return fmt.Sprintf("TDES Key Set ID: %s", data[2:])
+		case strings.HasPrefix(data, "01"):
+			return fmt.Sprintf("AES BDK ID: %s", data[2:])
+		default:
+			return fmt.Sprintf("BDK ID: %s", data)
+		}
+	case "IK": // Initial Key Identifier.
+		return fmt.Sprintf("Initial Key ID: %s", data)
 	case "KS": // Key Set Identifier.
 		return fmt.Sprintf("Key Set ID: %s", data)
 	case "KV": // Key Block version.
@@ -330,3 +350,38 @@ func getLMKIDMeaning(lmkID string) string {
 
 	return fmt.Sprintf("Invalid LMK ID: %s", lmkID)
 }
+
+// keyBlockLMK returns the key block LMK selected by --lmk-id or, when the flag is empty, the
+// LMK named in the header of keyBlock, with its ID.
+func keyBlockLMK(cmd *cobra.Command, keyBlock []byte) (logic.KeyBlockLMKProvider, string, error) {
+	lmkID, _ := cmd.Flags().GetString("lmk-id")
+	if lmkID == "" {
+		engine, id, err := logic.KeyBlockLMKFor(keyBlock)
+		if err != nil {
+			return logic.KeyBlockLMKProvider{}, "", fmt.Errorf("cannot select key block LMK: %w", err)
+		}
+
+		return engine, id, nil
+	}
+
+	engine, ok := logic.LMKRegistry[lmkID].(logic.KeyBlockLMKProvider)
+	if !ok {
+		return logic.KeyBlockLMKProvider{}, "", fmt.Errorf("invalid LMK ID '%s' for key block", lmkID)
+	}
+
+	return engine, lmkID, nil
+}
+
+// getKeyContextMeaning returns the meaning of a TR-31 key context digit.
+func getKeyContextMeaning(context byte) string {
+	switch context - '0' {
+	case keyblocklmk.KeyContextAny:
+		return "Determined by the wrapping key"
+	case keyblocklmk.KeyContextStorage:
+		return "Storage only (must not be exchanged)"
+	case keyblocklmk.KeyContextExchange:
+		return "Exchange only (must not be imported into storage)"
+	default:
+		return fmt.Sprintf("Invalid key context: %c", context)
+	}
+}
@@ -10,11 +10,14 @@ import (
 	"github.com/andrei-cloud/go_hsm/internal/hsm/logic"
 	"github.com/andrei-cloud/go_hsm/pkg/crypto"
 	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
-	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+	"github.com/andrei-cloud/go_hsm/pkg/keyschemes"
 	"github.com/andrei-cloud/go_hsm/pkg/variantlmk"
 	"github.com/spf13/cobra"
 )
 
+// errWeakKey rejects the import of DES keys with a weak or semi-weak component.
+var errWeakKey = errors.New("key is a weak or semi-weak DES key")
+
 func newImportKeyCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "import",
@@ -30,10 +33,12 @@ which will fix the parity before importing.`,
 	// Add flags.
 	cmd.Flags().String("key", "", "Clear key in hex format")
 	cmd.Flags().String("type", "", "Key type code (e.g. 000, 001, 002) - required for variant LMK")
-	cmd.Flags().String("scheme", "", "Key scheme (X=single, U=double, T=triple length)")
+	cmd.Flags().String("scheme", "",
+		"Key scheme (X=single, U=double, T=triple length, A/B/C=AES-128/192/256)")
 	cmd.Flags().String("lmk-id", "00", "LMK ID for key encryption (00=variant, 01=key block)")
 	cmd.Flags().Bool("force-parity", false, "Fix key parity if invalid")
-	cmd.Flags().Bool("pci", false, "Enable PCI compliance mode")
+	cmd.Flags().Bool("pci", false, "Override the configured PCI compliance mode")
+	cmd.Flags().Bool("strict-compat", false, "Produce payShield byte-compatible key blocks")
 
 	if err := cmd.MarkFlagRequired("key"); err != nil {
 		panic(err)
@@ -50,7 +55,8 @@ func runImportKey(cmd *cobra.Command, _ []string) error {
 	scheme, _ := cmd.Flags().GetString("scheme")
 	lmkID, _ := cmd.Flags().GetString("lmk-id")
 	forceParity, _ := cmd.Flags().GetBool("force-parity")
-	pciMode, _ := cmd.Flags().GetBool("pci")
+	pciMode := pciModeFlag(cmd, lmkID)
+	strictCompat, _ := cmd.Flags().GetBool("strict-compat")
 
 	// Decode key from hex.
 	clearKey, err := hex.DecodeString(keyHex)
@@ -75,7 +81,7 @@ func runImportKey(cmd *cobra.Command, _ []string) error {
 		return runImportVariantKey(cmd, clearKey, keyType, scheme, forceParity, pciMode)
 	case logic.LMKTypeKeyBlock:
 		// For key block LMK, type is configured in the TUI.
-		return runImportKeyBlockKey(cmd, clearKey, engine)
+		return runImportKeyBlockKey(cmd, clearKey, engine, strictCompat)
 	default:
 		return fmt.Errorf("unsupported LMK type for ID '%s'", lmkID)
 	}
@@ -110,24 +116,20 @@ func runImportVariantKey(cmd *cobra.Command, clearKey []byte, keyType, scheme st
 		case 24:
 			scheme = "T"
 			expectedLen = 24
+		case 32:
+			scheme = "C"
+			expectedLen = 32
 		default:
-			return fmt.Errorf("invalid key length: %d bytes (expected 8, 16, or 24)", len(clearKey))
+			return fmt.Errorf("invalid key length: %d bytes (expected 8, 16, 24 or 32)", len(clearKey))
 		}
 		cmd.Printf("Auto-detected scheme: %s (%d bytes)\n", scheme, expectedLen)
 	} else {
 		// Validate provided scheme.
 		scheme = strings.ToUpper(scheme)
-		var expectedLen int
-		switch scheme {
-		case "X":
-			expectedLen = 8
-		case "U":
-			expectedLen = 16
-		case "T":
-			expectedLen = 24
-		default:
-			return fmt.Errorf("invalid scheme: %s (must be X, U, or T)", scheme)
+		if !isVariantScheme(scheme) {
+			return fmt.Errorf("invalid scheme: %s (must be X, U, T, A, B or C)", scheme)
 		}
+		expectedLen := keyschemes.LMKLength(scheme[0])
 
 		if len(clearKey) != expectedLen {
 			return fmt.Errorf("key length %d bytes does not match scheme %s (expected %d bytes)",
@@ -137,8 +139,8 @@ func runImportVariantKey(cmd *cobra.Command, clearKey []byte, keyType, scheme st
 
 	schemeChar := scheme[0]
 
-	// Check and fix parity if needed.
-	parityOK := cryptoutils.CheckKeyParity(clearKey)
+	// Check and fix parity if needed. AES keys have no parity.
+	parityOK := keyschemes.IsAES(schemeChar) || cryptoutils.CheckKeyParity(clearKey)
 	if !parityOK && !forceParity {
 		return errors.New("key has invalid DES parity (use --force-parity to fix)")
 	}
@@ -146,9 +148,15 @@ func runImportVariantKey(cmd *cobra.Command, clearKey []byte, keyType, scheme st
 		cmd.Printf("Warning: Key has invalid parity, fixing...\n")
 		clearKey = cryptoutils.FixKeyParity(clearKey)
 	}
+	if !keyschemes.IsAES(schemeChar) && cryptoutils.IsWeakDESKey(clearKey) {
+		return errWeakKey
+	}
 
 	// Calculate KCV.
-	kcv := crypto.CalculateKCV(clearKey)
+	kcv, err := variantKeyCheckValue(schemeChar, clearKey)
+	if err != nil {
+		return fmt.Errorf("failed to calculate KCV: %w", err)
+	}
 
 	// Encrypt under variant LMK.
 	encrypted, err := variantlmk.EncryptKeyUnderScheme(
@@ -157,6 +165,7 @@ func runImportVariantKey(cmd *cobra.Command, clearKey []byte, keyType, scheme st
 		clearKey,
 		lmkSet,
 		false,
+		pciMode,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to encrypt key: %w", err)
@@ -174,8 +183,12 @@ func runImportVariantKey(cmd *cobra.Command, clearKey []byte, keyType, scheme st
 
 // runImportKeyBlockKey handles importing keys under key block LMK.
 func runImportKeyBlockKey(cmd *cobra.Command, clearKey []byte,
-	_ logic.LMKEngine,
+	engine logic.LMKEngine, strictCompat bool,
 ) error {
+	lmk, ok := engine.(logic.KeyBlockLMKProvider)
+	if !ok {
+		return errors.New("LMK is not a key block LMK")
+	}
 	cmd.Println("Importing key under Key Block LMK...")
 	cmd.Println("Please configure the key block header parameters:")
 
@@ -188,11 +201,17 @@ func runImportKeyBlockKey(cmd *cobra.Command, clearKey []byte,
 	if !ok {
 		return errors.New("operation canceled by user")
 	}
+	if (header.Algorithm == 'D' || header.Algorithm == 'T') && cryptoutils.IsWeakDESKey(clearKey) {
+		return errWeakKey
+	}
 
 	// Use the key usage configured in the TUI (no override needed).
 
-	// Get the default AES LMK and encrypt key under key block using the configured header.
-	keyBlock, err := keyblocklmk.WrapKeyBlock(keyblocklmk.DefaultTestAESLMK, header, nil, clearKey)
+	// Encrypt the key under the selected LMK using the configured header.
+	if strictCompat {
+		lmk = lmk.WithStrictCompat(true)
+	}
+	keyBlock, err := lmk.WrapWithHeader(header, clearKey)
 	if err != nil {
 		return fmt.Errorf("failed to encrypt key under key block: %w", err)
 	}
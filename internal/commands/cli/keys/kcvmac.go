@@ -0,0 +1,101 @@
+// Package keys provides component check value MAC command implementation.
+package keys
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/andrei-cloud/go_hsm/internal/hsm/logic"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/spf13/cobra"
+)
+
+func newKCVMACCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "kcv-mac",
+		Short: "Generate or verify a MAC over key component check values",
+		Long: `Generate or verify a combined check value over the KCVs of key components.
+During a key ceremony each custodian reports the KCV of their component. The MAC,
+calculated under a TAK encrypted under the LMK, binds the complete ordered set of
+component KCVs so that the set can be confirmed without exposing any component.
+This is the CLI counterpart of the KC host command.`,
+		RunE: runKCVMAC,
+	}
+
+	// Add flags.
+	cmd.Flags().String("tak", "", "TAK encrypted under LMK with scheme prefix (e.g. U1234...)")
+	cmd.Flags().StringSlice("kcv", nil, "Component KCVs in ceremony order (6 hex chars each)")
+	cmd.Flags().String("verify", "", "Expected MAC (8 hex chars); verify instead of generate")
+	cmd.Flags().String("lmk-id", "00", "LMK ID for TAK decryption (00=variant)")
+
+	for _, name := range []string{"tak", "kcv"} {
+		if err := cmd.MarkFlagRequired(name); err != nil {
+			panic(err)
+		}
+	}
+
+	return cmd
+}
+
+func runKCVMAC(cmd *cobra.Command, _ []string) error {
+	takHex, _ := cmd.Flags().GetString("tak")
+	kcvHex, _ := cmd.Flags().GetStringSlice("kcv")
+	expected, _ := cmd.Flags().GetString("verify")
+	lmkID, _ := cmd.Flags().GetString("lmk-id")
+
+	if len(kcvHex) < 2 {
+		return errors.New("at least two component KCVs are required")
+	}
+	kcvs := make([][]byte, len(kcvHex))
+	for i, v := range kcvHex {
+		kcv, err := hex.DecodeString(v)
+		if err != nil || len(kcv) != 3 {
+			return fmt.Errorf("invalid component KCV %q: must be 6 hex chars", v)
+		}
+		kcvs[i] = kcv
+	}
+
+	if len(takHex) != 33 || takHex[0] != 'U' {
+		return errors.New("tak must be a double-length key with U scheme prefix")
+	}
+	encryptedTAK, err := hex.DecodeString(takHex[1:])
+	if err != nil {
+		return fmt.Errorf("invalid TAK format: %w", err)
+	}
+
+	// Lookup LMK engine for variant.
+	engine, ok := logic.LMKRegistry[lmkID]
+	if !ok || engine.GetLMKType() != logic.LMKTypeVariant {
+		return fmt.Errorf("invalid or unsupported LMK ID '%s' for variant key", lmkID)
+	}
+
+	clearTAK, err := engine.DecryptUnderLMK(encryptedTAK, "003", 'U', lmkID)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt TAK under LMK %s: %w", lmkID, err)
+	}
+	if !cryptoutils.CheckKeyParity(clearTAK) {
+		return errors.New("TAK parity check failed")
+	}
+
+	mac, err := cryptoutils.ComponentKCVMAC(kcvs, clearTAK)
+	if err != nil {
+		return fmt.Errorf("failed to calculate MAC: %w", err)
+	}
+	macHex := strings.ToUpper(hex.EncodeToString(mac))
+
+	if expected == "" {
+		cmd.Printf("Components: %d\n", len(kcvs))
+		cmd.Printf("MAC: %s\n", macHex)
+
+		return nil
+	}
+
+	if !strings.EqualFold(expected, macHex) {
+		return errors.New("component KCV MAC verification failed")
+	}
+	cmd.Println("Component KCV MAC verified.")
+
+	return nil
+}
@@ -2,9 +2,18 @@
 package keys
 
 import (
+	"strings"
+
+	"github.com/andrei-cloud/go_hsm/internal/config"
+	"github.com/andrei-cloud/go_hsm/pkg/crypto"
+	"github.com/andrei-cloud/go_hsm/pkg/keyschemes"
 	"github.com/spf13/cobra"
 )
 
+// variantSchemes lists the scheme tags of keys under a variant LMK: X, U and T for single,
+// double and triple length DES keys, and A, B and C for AES-128, AES-192 and AES-256 keys.
+const variantSchemes = "XUTABC"
+
 // NewKeysCommand creates the keys command group.
 func NewKeysCommand() *cobra.Command {
 	cmd := &cobra.Command{
@@ -20,6 +29,45 @@ under Local Master Keys (LMK) with proper validation and parity checking.`,
 	cmd.AddCommand(newImportKeyCommand())
 	cmd.AddCommand(newCheckKeyCommand())
 	cmd.AddCommand(newTypesCommand())
+	cmd.AddCommand(newKCVMACCommand())
+	cmd.AddCommand(newComponentsCommand())
+	cmd.AddCommand(newCombineCommand())
+	cmd.AddCommand(newVerifyBlockCommand())
+	cmd.AddCommand(newReportCommand())
+	cmd.AddCommand(newSplitSecretCommand())
+	cmd.AddCommand(newChangeAttributesCommand())
+	cmd.AddCommand(newStoreCommand())
+	cmd.AddCommand(newStoreListCommand())
+	cmd.AddCommand(newStoreDeleteCommand())
+	cmd.AddCommand(newExportCommand())
+	cmd.AddCommand(newMigrateCommand())
 
 	return cmd
 }
+
+// pciModeFlag returns the --pci flag when it is given, overriding the configured PCI-HSM
+// compliance mode of the variant LMK with the given ID for this request.
+func pciModeFlag(cmd *cobra.Command, lmkID string) bool {
+	if cmd.Flags().Changed("pci") {
+		pciMode, _ := cmd.Flags().GetBool("pci")
+
+		return pciMode
+	}
+
+	return config.Get().PCIMode(lmkID)
+}
+
+// isVariantScheme reports whether scheme is one of variantSchemes.
+func isVariantScheme(scheme string) bool {
+	return len(scheme) == 1 && strings.Contains(variantSchemes, scheme)
+}
+
+// variantKeyCheckValue returns the check value of a clear key under the variant scheme: the
+// start of the AES-CMAC of a zero block for AES keys, else the DES check value.
+func variantKeyCheckValue(scheme byte, clearKey []byte) ([]byte, error) {
+	if !keyschemes.IsAES(scheme) {
+		return crypto.CalculateKCV(clearKey), nil
+	}
+
+	return crypto.CalculateKCVType(clearKey, crypto.KCVCMAC)
+}
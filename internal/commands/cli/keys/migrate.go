@@ -0,0 +1,313 @@
+// Package keys provides the key migration command implementation.
+package keys
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	keystorecli "github.com/andrei-cloud/go_hsm/internal/commands/cli/keystore"
+	lmkcli "github.com/andrei-cloud/go_hsm/internal/commands/cli/lmk"
+	"github.com/andrei-cloud/go_hsm/internal/hsm/logic"
+	"github.com/andrei-cloud/go_hsm/internal/lmkstore"
+	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+	"github.com/andrei-cloud/go_hsm/pkg/keyschemes"
+	"github.com/spf13/cobra"
+)
+
+func newMigrateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Translate keys from the old LMK to the new LMK",
+		Long: `Translate keys encrypted under an old LMK to the LMK with the same ID, as the BW
+host command does, for an LMK rollover. The old LMKs are loaded from key change storage
+of the LMK store ('lmk install --old') and the new LMKs are the active LMKs of the store or
+the built-in LMKs.
+
+Translate a single key with --key, an NDJSON batch of {"key","type","lmk_id"} records with
+--batch, or every key of the key store held under an LMK with an old LMK with --stored,
+which updates the key store in place. Each key is reported with its new value and check
+value, which matches the check value under the old LMK; a key that fails is reported with
+its error and left unchanged.`,
+		Example: `  go_hsm keys migrate --key U1234...ABCD --type 001
+  go_hsm keys migrate --batch keys.ndjson --output ndjson > migrated.ndjson
+  go_hsm keys migrate --stored --store keys.json`,
+		RunE: runMigrate,
+	}
+
+	// Add flags.
+	cmd.Flags().String("key", "", "Key under the old LMK with scheme prefix, or key block")
+	cmd.Flags().String("type", "", "Key type code of a variant key (e.g. 000, 001, 002)")
+	cmd.Flags().String("lmk-id", "",
+		"LMK ID of the keys (default 00, or the LMK of the key block header)")
+	cmd.Flags().String("batch", "", "NDJSON file of {\"key\",\"type\"} records to migrate (- for stdin)")
+	cmd.Flags().Bool("stored", false, "Migrate the keys of the key store in place")
+	cmd.Flags().Bool("pci", false, "Override the configured PCI compliance mode")
+	cmd.Flags().String("lmk-store", "", "LMK store file (default from lmk.store config)")
+	cmd.Flags().String("passphrase", "",
+		"LMK store master passphrase (or set "+lmkstore.PassphraseEnv+")")
+	cmd.Flags().String("kek", "",
+		"Hex LMK store key encryption key (or set "+lmkstore.KEKEnv+")")
+	addBulkFlags(cmd)
+	keystorecli.AddStoreFlag(cmd)
+
+	cmd.MarkFlagsOneRequired("key", "batch", "stored")
+	cmd.MarkFlagsMutuallyExclusive("key", "batch", "stored")
+
+	return cmd
+}
+
+// migratedKey is a key to translate from the old LMK, and one record of migration output.
+type migratedKey struct {
+	ID     string `json:"id,omitempty"`
+	Key    string `json:"key"`
+	Type   string `json:"type,omitempty"`
+	LMKID  string `json:"lmk_id,omitempty"`
+	NewKey string `json:"new_key,omitempty"`
+	KCV    string `json:"kcv,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// migration streams the results of translating keys and counts the failures.
+type migration struct {
+	cmd    *cobra.Command
+	output string
+	out    *ndjsonWriter
+	total  int
+	failed int
+}
+
+func runMigrate(cmd *cobra.Command, _ []string) error {
+	output, compress, err := bulkOutput(cmd)
+	if err != nil {
+		return err
+	}
+	oldIDs, err := loadMigrationLMKs(cmd)
+	if err != nil {
+		return err
+	}
+
+	m := &migration{cmd: cmd, output: output, out: newNDJSONWriter(cmd.OutOrStdout(), compress)}
+	lmkID, _ := cmd.Flags().GetString("lmk-id")
+	switch {
+	case cmd.Flags().Changed("stored"):
+		err = m.migrateStored(oldIDs, lmkID)
+	case cmd.Flags().Changed("batch"):
+		path, _ := cmd.Flags().GetString("batch")
+		err = m.migrateBatch(path, lmkID)
+	default:
+		key, _ := cmd.Flags().GetString("key")
+		keyType, _ := cmd.Flags().GetString("type")
+		err = m.report(m.migrate(migratedKey{Key: key, Type: keyType, LMKID: lmkID}))
+	}
+	if closeErr := m.out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if output == outputText {
+		cmd.Printf("Migrated %d of %d keys\n", m.total-m.failed, m.total)
+	}
+	if m.failed > 0 {
+		return fmt.Errorf("%d of %d keys failed to migrate", m.failed, m.total)
+	}
+
+	return nil
+}
+
+// loadMigrationLMKs registers the active and old LMKs of the LMK store and returns the IDs
+// of the old LMKs.
+func loadMigrationLMKs(cmd *cobra.Command) ([]string, error) {
+	path, _ := cmd.Flags().GetString("lmk-store")
+	store, err := lmkcli.OpenUnlockedStore(cmd, path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := lmkstore.Register(store); err != nil {
+		return nil, fmt.Errorf("failed to register LMKs: %w", err)
+	}
+	oldIDs, err := lmkstore.RegisterOld(store)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register old LMKs: %w", err)
+	}
+	if len(oldIDs) == 0 {
+		return nil, fmt.Errorf("no old LMK in key change storage of %s (use 'lmk install --old')",
+			store.Path())
+	}
+
+	return oldIDs, nil
+}
+
+// migrateBatch translates the keys of an NDJSON batch. Malformed input stops the batch.
+func (m *migration) migrateBatch(path, lmkID string) error {
+	dec, closeBatch, err := openNDJSON(m.cmd, path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = closeBatch()
+	}()
+
+	for n := 1; ; n++ {
+		var in migratedKey
+		if err := dec.Decode(&in); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("invalid batch record %d: %w", n, err)
+		}
+		if in.LMKID == "" {
+			in.LMKID = lmkID
+		}
+		if err := m.report(m.migrate(in)); err != nil {
+			return fmt.Errorf("failed to write batch result %d: %w", n, err)
+		}
+	}
+}
+
+// migrateStored translates the keys of the key store held under an LMK with an old LMK, or
+// under lmkID when it is given, and saves the translated keys.
+func (m *migration) migrateStored(oldIDs []string, lmkID string) error {
+	store, err := keystorecli.OpenStore(m.cmd)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range store.List() {
+		if !slices.Contains(oldIDs, key.LMKID) || (lmkID != "" && key.LMKID != lmkID) {
+			continue
+		}
+		value, variant := key.Value, len(key.Scheme) == 1 && !keyschemes.IsKeyBlock(key.Scheme[0])
+		if variant {
+			value = key.Scheme + value
+		}
+
+		result := m.migrate(migratedKey{ID: key.ID, Key: value, Type: key.KeyType, LMKID: key.LMKID})
+		if result.Error == "" && key.KCV != "" && !strings.HasPrefix(result.KCV, key.KCV) {
+			result.Error = fmt.Sprintf("check value %s does not match stored check value %s",
+				result.KCV, key.KCV)
+		}
+		if result.Error == "" {
+			key.Value = result.NewKey
+			if variant {
+				key.Value = result.NewKey[1:]
+			}
+			if err := store.Put(key); err != nil {
+				result.Error = err.Error()
+			}
+		}
+		if err := m.report(result); err != nil {
+			return err
+		}
+	}
+
+	return store.Save()
+}
+
+// migrate translates one key from its old LMK, recording a failure in the result.
+func (m *migration) migrate(in migratedKey) migratedKey {
+	in.Key = strings.TrimSpace(in.Key)
+	var err error
+	switch {
+	case in.Key == "":
+		err = errors.New("key is empty")
+	case keyschemes.IsKeyBlock(in.Key[0]):
+		in.NewKey, in.KCV, err = migrateKeyBlock(in.Key, in.LMKID)
+	default:
+		if in.LMKID == "" {
+			in.LMKID = "00"
+		}
+		in.NewKey, in.KCV, err = migrateVariantKey(strings.ToUpper(in.Key), in.Type, in.LMKID,
+			pciModeFlag(m.cmd, in.LMKID))
+	}
+	if err != nil {
+		in.NewKey, in.KCV, in.Error = "", "", err.Error()
+	}
+
+	return in
+}
+
+// report writes the result of one key.
+func (m *migration) report(result migratedKey) error {
+	m.total++
+	if result.Error != "" {
+		m.failed++
+	}
+	if m.output == outputNDJSON {
+		return m.out.Write(result)
+	}
+
+	name := result.ID
+	if name == "" {
+		name = result.Key
+	}
+	if result.Error != "" {
+		m.cmd.Printf("%s: error: %s\n", name, result.Error)
+	} else {
+		m.cmd.Printf("%s: %s (KCV: %s)\n", name, result.NewKey, result.KCV)
+	}
+
+	return nil
+}
+
+// migrateVariantKey translates a scheme-prefixed variant key from the old LMK of lmkID and
+// returns it with its check value under the new LMK.
+func migrateVariantKey(value, keyType, lmkID string, pciMode bool) (string, string, error) {
+	if keyType == "" {
+		return "", "", errors.New("key type is required for variant keys")
+	}
+	key, err := keyschemes.ParseLMKKey(value)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid encrypted key: %w", err)
+	}
+	encryptedKey, err := key.Bytes()
+	if err != nil {
+		return "", "", fmt.Errorf("invalid encrypted key format: %w", err)
+	}
+	if err := logic.SetVariantPCIMode(lmkID, pciMode); err != nil {
+		return "", "", err
+	}
+
+	translated, err := logic.TranslateFromOldLMK(encryptedKey, keyType, key.Scheme, lmkID)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to translate key: %w", err)
+	}
+	newKey := fmt.Sprintf("%c%s", key.Scheme, strings.ToUpper(hex.EncodeToString(translated)))
+	checked, err := checkVariantKey(lmkID, newKey, keyType, pciMode)
+	if err != nil {
+		return "", "", err
+	}
+
+	return newKey, checked.KCV, nil
+}
+
+// migrateKeyBlock rewraps a key block from the old LMK of lmkID, or of the LMK of its
+// header when lmkID is empty, and returns it with its check value.
+func migrateKeyBlock(value, lmkID string) (string, string, error) {
+	translated, err := logic.TranslateFromOldLMK([]byte(value), "", value[0], lmkID)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to translate key block: %w", err)
+	}
+	engine, id, err := logic.KeyBlockLMKFor(translated)
+	if err != nil {
+		return "", "", err
+	}
+	header, err := keyblocklmk.ParseHeader(translated)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid key block: %w", err)
+	}
+	clearKey, err := engine.DecryptUnderLMK(translated, "", translated[0], id)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to unwrap key block: %w", err)
+	}
+	kcv, err := verifyCheckValue(header.Algorithm, clearKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	return string(translated), fmt.Sprintf("%X", kcv), nil
+}
@@ -0,0 +1,137 @@
+package keys
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/hsm/logic"
+	"github.com/andrei-cloud/go_hsm/internal/keystore"
+	"github.com/andrei-cloud/go_hsm/internal/lmkstore"
+	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+	"github.com/andrei-cloud/go_hsm/pkg/variantlmk"
+)
+
+// TestMigrateStoredKeys translates a variant key and a key block of the key store from the
+// old LMKs of an LMK store. It registers old LMKs, so it does not run in parallel.
+func TestMigrateStoredKeys(t *testing.T) {
+	dir := t.TempDir()
+	kek := bytes.Repeat([]byte{0x5A}, lmkstore.KEKSize)
+	oldVariant := bytes.Repeat([]byte{0x1F}, variantlmk.LMKSetSize)
+	oldKeyBlock := bytes.Repeat([]byte{0x3C}, lmkstore.KeyBlockLMKSize)
+	defer delete(logic.OldLMKRegistry, "00")
+	defer delete(logic.OldLMKRegistry, logic.DefaultKeyBlockLMKID)
+
+	lmks, err := lmkstore.Open(filepath.Join(dir, "lmk.json"))
+	if err != nil {
+		t.Fatalf("failed to open LMK store: %v", err)
+	}
+	if err := lmks.UnlockKEK(kek); err != nil {
+		t.Fatalf("unlock failed: %v", err)
+	}
+	if _, err := lmks.InstallOld("00", lmkstore.TypeVariant, oldVariant); err != nil {
+		t.Fatalf("install old variant LMK failed: %v", err)
+	}
+	if _, err := lmks.InstallOld(logic.DefaultKeyBlockLMKID, lmkstore.TypeKeyBlock, oldKeyBlock); err != nil {
+		t.Fatalf("install old key block LMK failed: %v", err)
+	}
+	if err := lmks.Save(); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	// Encrypt the test key under both old LMKs.
+	clearKey, _ := hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+	set, _ := variantlmk.ParseLMKSet(oldVariant)
+	logic.RegisterOldVariantLMKSet("00", set)
+	underOld, err := logic.OldLMKRegistry["00"].EncryptUnderLMK(clearKey, "001", 'U', "00")
+	if err != nil {
+		t.Fatalf("failed to encrypt under old LMK: %v", err)
+	}
+	block, err := keyblocklmk.WrapKeyBlock(oldKeyBlock, keyblocklmk.Header{
+		Version:       '1',
+		KeyUsage:      "K0",
+		Algorithm:     'T',
+		ModeOfUse:     'B',
+		KeyVersionNum: "00",
+		Exportability: 'E',
+		KeyContext:    1,
+	}, nil, clearKey)
+	if err != nil {
+		t.Fatalf("failed to wrap key block: %v", err)
+	}
+
+	keysPath := filepath.Join(dir, "keystore.json")
+	keys, err := keystore.Open(keysPath)
+	if err != nil {
+		t.Fatalf("failed to open key store: %v", err)
+	}
+	for _, k := range []keystore.Key{
+		{ID: "zpk", LMKID: "00", KeyType: "001", Scheme: "U", Value: strings.ToUpper(hex.EncodeToString(underOld)), KCV: "08D7B4"},
+		{ID: "kbpk", LMKID: "01", Scheme: "S", Usage: "K0", Value: string(block), KCV: "08D7B4"},
+		{ID: "other", LMKID: "02", Scheme: "S", Value: "S10096K0TB00E0000"},
+	} {
+		if err := keys.Add(k); err != nil {
+			t.Fatalf("failed to add key %s: %v", k.ID, err)
+		}
+	}
+	if err := keys.Save(); err != nil {
+		t.Fatalf("failed to save key store: %v", err)
+	}
+
+	var out bytes.Buffer
+	cmd := newMigrateCommand()
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	cmd.SetArgs([]string{
+		"--stored", "--store", keysPath, "--lmk-store", lmks.Path(),
+		"--kek", hex.EncodeToString(kek), "--output", "ndjson",
+	})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("migrate failed: %v\n%s", err, out.String())
+	}
+
+	results := map[string]migratedKey{}
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var result migratedKey
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			t.Fatalf("invalid migrate output %q: %v", scanner.Text(), err)
+		}
+		results[result.ID] = result
+	}
+	if len(results) != 2 || results["zpk"].Error != "" || results["kbpk"].Error != "" {
+		t.Fatalf("migrate results = %+v, want zpk and kbpk", results)
+	}
+
+	migrated, err := keystore.Open(keysPath)
+	if err != nil {
+		t.Fatalf("failed to reopen key store: %v", err)
+	}
+	zpk, _ := migrated.Get("zpk")
+	checked, err := checkVariantKey("00", "U"+zpk.Value, "001", false)
+	if err != nil || !strings.HasPrefix(checked.KCV, "08D7B4") {
+		t.Errorf("migrated zpk checks as %+v, %v", checked, err)
+	}
+	kbpk, _ := migrated.Get("kbpk")
+	if _, clear, err := keyblocklmk.UnwrapKeyBlock(keyblocklmk.DefaultTestAESLMK, []byte(kbpk.Value)); err != nil ||
+		!bytes.Equal(clear, clearKey) {
+		t.Errorf("migrated kbpk unwraps to %X, %v", clear, err)
+	}
+	if other, _ := migrated.Get("other"); other.Value != "S10096K0TB00E0000" {
+		t.Errorf("key under LMK without old LMK changed to %s", other.Value)
+	}
+
+	// A key that fails to translate is reported and fails the command.
+	out.Reset()
+	cmd = newMigrateCommand()
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	cmd.SetArgs([]string{"--key", "U" + zpk.Value, "--lmk-store", lmks.Path(), "--kek", hex.EncodeToString(kek)})
+	if err := cmd.Execute(); err == nil || !strings.Contains(out.String(), "key type is required") {
+		t.Errorf("migrate without key type = %v\n%s", err, out.String())
+	}
+}
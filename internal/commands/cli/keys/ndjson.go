@@ -0,0 +1,115 @@
+// Package keys provides NDJSON streaming for bulk key operations.
+package keys
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// Output formats of bulk key operations.
+const (
+	outputText   = "text"
+	outputNDJSON = "ndjson"
+)
+
+// gzipMagic starts every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// ndjsonWriter streams one JSON record per line, optionally gzip compressed, so bulk
+// operations never hold their results in memory.
+type ndjsonWriter struct {
+	enc *json.Encoder
+	buf *bufio.Writer
+	zw  *gzip.Writer
+}
+
+// newNDJSONWriter returns a writer of NDJSON records to w, compressed when compress is set.
+func newNDJSONWriter(w io.Writer, compress bool) *ndjsonWriter {
+	nw := &ndjsonWriter{}
+	if compress {
+		nw.zw = gzip.NewWriter(w)
+		w = nw.zw
+	}
+	nw.buf = bufio.NewWriter(w)
+	nw.enc = json.NewEncoder(nw.buf)
+
+	return nw
+}
+
+// Write writes one record.
+func (w *ndjsonWriter) Write(record any) error {
+	return w.enc.Encode(record)
+}
+
+// Close flushes buffered records and ends the gzip stream.
+func (w *ndjsonWriter) Close() error {
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	if w.zw != nil {
+		return w.zw.Close()
+	}
+
+	return nil
+}
+
+// openNDJSON opens a file of NDJSON records, or standard input for "-", decompressing it
+// when it is gzip compressed.
+func openNDJSON(cmd *cobra.Command, path string) (*json.Decoder, func() error, error) {
+	var (
+		in      io.Reader = cmd.InOrStdin()
+		closeFn           = func() error { return nil }
+	)
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open batch file: %w", err)
+		}
+		in, closeFn = f, f.Close
+	}
+
+	br := bufio.NewReader(in)
+	if magic, err := br.Peek(len(gzipMagic)); err == nil && bytes.Equal(magic, gzipMagic) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			_ = closeFn()
+
+			return nil, nil, fmt.Errorf("failed to read compressed batch: %w", err)
+		}
+
+		return json.NewDecoder(zr), closeFn, nil
+	}
+
+	return json.NewDecoder(br), closeFn, nil
+}
+
+// addBulkFlags adds the output flags of bulk key operations.
+func addBulkFlags(cmd *cobra.Command) {
+	cmd.Flags().String("output", outputText, "Output format (text or ndjson)")
+	cmd.Flags().Bool("gzip", false, "Gzip compress NDJSON output")
+}
+
+// bulkOutput reads the output flags, rejecting compression of text output.
+func bulkOutput(cmd *cobra.Command) (string, bool, error) {
+	output, _ := cmd.Flags().GetString("output")
+	compress, _ := cmd.Flags().GetBool("gzip")
+	switch output {
+	case outputText:
+		if compress {
+			return "", false, fmt.Errorf("--gzip requires --output %s", outputNDJSON)
+		}
+	case outputNDJSON:
+	default:
+		return "", false, fmt.Errorf("invalid output format %q (must be %s or %s)",
+			output, outputText, outputNDJSON)
+	}
+
+	return output, compress, nil
+}
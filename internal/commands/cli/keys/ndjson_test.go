@@ -0,0 +1,143 @@
+package keys
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+)
+
+// TestBulkGenerateAndCheck streams generated keys as gzipped NDJSON into a batch check.
+func TestBulkGenerateAndCheck(t *testing.T) {
+	t.Parallel()
+
+	var generated bytes.Buffer
+	cmd := newGenerateKeyCommand()
+	cmd.SetOut(&generated)
+	cmd.SetArgs([]string{"--type", "000", "--count", "3", "--output", "ndjson", "--gzip"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(generated.Bytes()))
+	if err != nil {
+		t.Fatalf("generate output is not gzip: %v", err)
+	}
+	var keys []generatedKey
+	scanner := bufio.NewScanner(zr)
+	for scanner.Scan() {
+		var k generatedKey
+		if err := json.Unmarshal(scanner.Bytes(), &k); err != nil {
+			t.Fatalf("invalid NDJSON line %q: %v", scanner.Text(), err)
+		}
+		keys = append(keys, k)
+	}
+	if len(keys) != 3 || keys[0].Key == keys[1].Key || keys[0].ClearKey != "" {
+		t.Fatalf("generated keys = %+v", keys)
+	}
+
+	// Check the generated keys and a malformed one, which is reported in its own record.
+	var batch bytes.Buffer
+	for _, k := range keys {
+		_ = json.NewEncoder(&batch).Encode(map[string]string{"key": k.Key, "type": k.KeyType})
+	}
+	batch.WriteString(`{"key":"U0011","type":"000"}` + "\n")
+
+	var checked bytes.Buffer
+	cmd = newCheckKeyCommand()
+	cmd.SetIn(&batch)
+	cmd.SetOut(&checked)
+	cmd.SetArgs([]string{"--batch", "-"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("check failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(checked.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("check output = %q, want 4 records", checked.String())
+	}
+	for i, k := range keys {
+		var r checkedKey
+		if err := json.Unmarshal([]byte(lines[i]), &r); err != nil {
+			t.Fatalf("invalid result %q: %v", lines[i], err)
+		}
+		if r.Error != "" || r.KCV != k.KCV || r.ParityValid == nil || !*r.ParityValid {
+			t.Errorf("result %d = %s, want KCV %s", i, lines[i], k.KCV)
+		}
+	}
+	if !strings.Contains(lines[3], `"error":`) {
+		t.Errorf("bad key result = %s, want an error", lines[3])
+	}
+
+	// The gzipped generate output is itself a batch; compression is detected.
+	checked.Reset()
+	cmd = newCheckKeyCommand()
+	cmd.SetIn(bytes.NewReader(generated.Bytes()))
+	cmd.SetOut(&checked)
+	cmd.SetArgs([]string{"--batch", "-"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("check of generate output failed: %v", err)
+	}
+	for _, k := range keys {
+		if !strings.Contains(checked.String(), `"kcv":"`+k.KCV+`"`) {
+			t.Errorf("check output %q lacks KCV %s", checked.String(), k.KCV)
+		}
+	}
+}
+
+// TestBulkOutputFlags verifies the validation of bulk output flags.
+func TestBulkOutputFlags(t *testing.T) {
+	t.Parallel()
+
+	for _, args := range [][]string{
+		{"--type", "000", "--gzip"},
+		{"--type", "000", "--output", "xml"},
+		{"--type", "000", "--count", "0"},
+	} {
+		cmd := newGenerateKeyCommand()
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs(args)
+		if err := cmd.Execute(); err == nil {
+			t.Errorf("generate %v: expected error", args)
+		}
+	}
+}
+
+// TestGenerateAESKeys verifies AES keys under the variant LMK and their CMAC check values.
+func TestGenerateAESKeys(t *testing.T) {
+	t.Parallel()
+
+	for scheme, length := range map[string]int{"A": 16, "B": 24, "C": 32} {
+		var generated bytes.Buffer
+		cmd := newGenerateKeyCommand()
+		cmd.SetOut(&generated)
+		cmd.SetArgs([]string{"--type", "000", "--scheme", scheme, "--clear", "--output", "ndjson"})
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("generate scheme %s failed: %v", scheme, err)
+		}
+		var k generatedKey
+		if err := json.Unmarshal(generated.Bytes(), &k); err != nil {
+			t.Fatalf("invalid NDJSON %q: %v", generated.String(), err)
+		}
+		if len(k.ClearKey) != 2*length || len(k.Key) != 1+2*length {
+			t.Fatalf("scheme %s key = %+v", scheme, k)
+		}
+		want, err := cryptoutils.AESKeyCV([]byte(k.ClearKey), 6)
+		if err != nil || k.KCV != string(want) {
+			t.Errorf("scheme %s KCV = %s, want %s (%v)", scheme, k.KCV, want, err)
+		}
+
+		r, err := checkVariantKey("00", k.Key, "000", false)
+		if err != nil {
+			t.Fatalf("check scheme %s failed: %v", scheme, err)
+		}
+		if r.KCV != k.KCV || r.ParityValid != nil {
+			t.Errorf("check scheme %s = %+v, want KCV %s without parity", scheme, r, k.KCV)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package keys
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+)
+
+// TestReport verifies the Markdown report, a custom template and an unauthenticated block.
+func TestReport(t *testing.T) {
+	t.Parallel()
+
+	clearKey, _ := hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+	ksn, err := keyblocklmk.NewKSNBlock("FFFF9876543210E00000")
+	if err != nil {
+		t.Fatalf("failed to build KSN block: %v", err)
+	}
+	block, err := keyblocklmk.WrapKeyBlock(keyblocklmk.DefaultTestAESLMK, keyblocklmk.Header{
+		Version:        '1',
+		KeyUsage:       "B1",
+		Algorithm:      'T',
+		ModeOfUse:      'X',
+		KeyVersionNum:  "00",
+		Exportability:  'N',
+		OptionalBlocks: 1,
+	}, []keyblocklmk.OptionalBlock{ksn}, clearKey)
+	if err != nil {
+		t.Fatalf("failed to wrap key block: %v", err)
+	}
+	tampered := append(bytes.Clone(block[:len(block)-1]), '0')
+	if tampered[len(tampered)-1] == block[len(block)-1] {
+		tampered[len(tampered)-1] = '1'
+	}
+
+	customTemplate := filepath.Join(t.TempDir(), "report.tmpl")
+	if err := os.WriteFile(customTemplate, []byte("{{ .KeyBlock }} {{ .KCV }}"), 0o600); err != nil {
+		t.Fatalf("failed to write template: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		notWant string
+	}{
+		{
+			name:    "markdown",
+			args:    []string{string(block)},
+			want:    []string{"# Key Block Report", "| 5-6 | Key usage | `B1` |", "| `KS` |", "| MAC | valid |", "| KCV | `08D7B4` |"},
+			notWant: "0123456789ABCDEF",
+		},
+		{
+			name: "custom template",
+			args: []string{string(block), "--template", customTemplate},
+			want: []string{string(block) + " 08D7B4"},
+		},
+		{
+			name:    "tampered",
+			args:    []string{string(tampered)},
+			want:    []string{"| MAC | **failed**", "could not be authenticated"},
+			notWant: "| KCV |",
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var out bytes.Buffer
+			cmd := newReportCommand()
+			cmd.SetOut(&out)
+			cmd.SetErr(&out)
+			cmd.SetArgs(tc.args)
+			if err := cmd.Execute(); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("report does not contain %q:\n%s", want, out.String())
+				}
+			}
+			if tc.notWant != "" && strings.Contains(out.String(), tc.notWant) {
+				t.Errorf("report contains %q:\n%s", tc.notWant, out.String())
+			}
+		})
+	}
+}
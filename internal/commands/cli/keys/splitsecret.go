@@ -0,0 +1,77 @@
+package keys
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/andrei-cloud/go_hsm/internal/secrets"
+	"github.com/spf13/cobra"
+)
+
+func newSplitSecretCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "split-secret",
+		Short: "Split an LMK secret into k-of-n Shamir shares",
+		Long: `Split the secret that unlocks an LMK (a passphrase or the LMK in hex) into Shamir
+shares for split-knowledge custody. Any --threshold of the --shares shares unlock the LMK at
+startup with the "shamir" secret source; fewer reveal nothing about it.
+Without --secret the secret is read from the first line of standard input.
+With --spool-dir each share is written to its own file, one per custodian.`,
+		RunE: runSplitSecret,
+	}
+
+	cmd.Flags().String("secret", "", "Secret to split; read from standard input if omitted")
+	cmd.Flags().IntP("threshold", "k", 2, "Number of shares required to unlock the secret")
+	cmd.Flags().IntP("shares", "n", 3, "Number of shares to create")
+	cmd.Flags().String("spool-dir", "", "Write each share to a file in this directory")
+
+	return cmd
+}
+
+func runSplitSecret(cmd *cobra.Command, _ []string) error {
+	secret, _ := cmd.Flags().GetString("secret")
+	threshold, _ := cmd.Flags().GetInt("threshold")
+	count, _ := cmd.Flags().GetInt("shares")
+	spoolDir, _ := cmd.Flags().GetString("spool-dir")
+
+	if secret == "" {
+		scanner := bufio.NewScanner(cmd.InOrStdin())
+		if scanner.Scan() {
+			secret = strings.TrimSpace(scanner.Text())
+		}
+		if secret == "" {
+			return errors.New("secret is required (use --secret or standard input)")
+		}
+	}
+
+	shares, err := secrets.SplitSecret([]byte(secret), count, threshold)
+	if err != nil {
+		return fmt.Errorf("failed to split secret: %w", err)
+	}
+
+	if spoolDir != "" {
+		if err := os.MkdirAll(spoolDir, 0o700); err != nil {
+			return fmt.Errorf("failed to create spool directory: %w", err)
+		}
+	}
+
+	for i, share := range shares {
+		if spoolDir == "" {
+			cmd.Printf("Share %d of %d: %s\n", i+1, count, share)
+
+			continue
+		}
+		path := filepath.Join(spoolDir, fmt.Sprintf("share_%d_of_%d.txt", i+1, count))
+		if err := os.WriteFile(path, []byte(share+"\n"), 0o600); err != nil {
+			return fmt.Errorf("failed to spool share %d: %w", i+1, err)
+		}
+		cmd.Printf("Share %d spooled to %s\n", i+1, path)
+	}
+	cmd.Printf("Any %d of %d shares unlock the secret\n", threshold, count)
+
+	return nil
+}
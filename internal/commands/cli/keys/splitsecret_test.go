@@ -0,0 +1,40 @@
+package keys
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/secrets"
+)
+
+func TestSplitSecretCommand(t *testing.T) {
+	t.Parallel()
+
+	cmd := newSplitSecretCommand()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetIn(strings.NewReader("lab passphrase\n"))
+	cmd.SetArgs([]string{"-k", "2", "-n", "3"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("split-secret failed: %v", err)
+	}
+
+	shares := regexp.MustCompile(`Share \d of 3: (\S+)`).FindAllStringSubmatch(out.String(), -1)
+	if len(shares) != 3 {
+		t.Fatalf("output = %q", out.String())
+	}
+	secret, err := secrets.CombineShares([]string{shares[2][1], shares[0][1]})
+	if err != nil || string(secret) != "lab passphrase" {
+		t.Errorf("CombineShares() = %q, %v", secret, err)
+	}
+
+	cmd = newSplitSecretCommand()
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	cmd.SetArgs([]string{"--secret", "x", "-k", "4", "-n", "3"})
+	if err := cmd.Execute(); err == nil {
+		t.Error("expected error for a threshold above the share count")
+	}
+}
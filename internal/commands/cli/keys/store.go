@@ -0,0 +1,221 @@
+// Package keys provides key store command implementation.
+package keys
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/andrei-cloud/go_hsm/internal/audit"
+	keystorecli "github.com/andrei-cloud/go_hsm/internal/commands/cli/keystore"
+	"github.com/andrei-cloud/go_hsm/internal/config"
+	"github.com/andrei-cloud/go_hsm/internal/keystore"
+	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+	"github.com/andrei-cloud/go_hsm/pkg/keyschemes"
+	"github.com/spf13/cobra"
+)
+
+func newStoreCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "store",
+		Short: "Store a key encrypted under LMK in the key store",
+		Long: `Store a key encrypted under LMK in the key store.
+The key is decrypted under its LMK to check it and compute its check value; only the
+LMK-encrypted value is stored. Variant keys carry their scheme tag (X, U, T, A, B or C) and
+need --type; key blocks (S, K or R) record the key usage of their header.`,
+		Example: `  go_hsm keys store --id zpk-acme --key U1234...ABCD --type 001 --tag partner=acme
+  go_hsm keys store --id bdk --key S10096B0TX00E0000...`,
+		RunE: runStoreKey,
+	}
+
+	// Add flags.
+	cmd.Flags().String("id", "", "Unique key identifier")
+	cmd.Flags().String("key", "", "Key encrypted under LMK with scheme prefix, or key block")
+	cmd.Flags().String("type", "", "Key type code of a variant key (e.g. 000, 001, 002)")
+	cmd.Flags().String("lmk-id", "",
+		"LMK ID the key is encrypted under (default 00, or the LMK of the key block header)")
+	cmd.Flags().Bool("pci", false, "Override the configured PCI compliance mode")
+	cmd.Flags().StringArray("tag", nil, "Tag to attach (name=value, repeatable)")
+	keystorecli.AddStoreFlag(cmd)
+
+	for _, name := range []string{"id", "key"} {
+		if err := cmd.MarkFlagRequired(name); err != nil {
+			panic(err)
+		}
+	}
+
+	return cmd
+}
+
+func newExportCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export <id>",
+		Short: "Print a stored key encrypted under LMK",
+		Long: `Print a key from the key store as host commands take it: the scheme-prefixed
+variant key or the key block. The key stays encrypted under LMK. Every export is recorded
+in the audit log (audit.path) with the key ID and KCV.`,
+		Args: cobra.ExactArgs(1),
+		RunE: runExportKey,
+	}
+
+	cmd.Flags().Bool("json", false, "Print the key with its metadata as JSON")
+	keystorecli.AddStoreFlag(cmd)
+
+	return cmd
+}
+
+// newStoreListCommand creates keys list, the keystore list command under keys.
+func newStoreListCommand() *cobra.Command {
+	cmd := keystorecli.NewListCommand()
+	keystorecli.AddStoreFlag(cmd)
+
+	return cmd
+}
+
+// newStoreDeleteCommand creates keys delete, the keystore delete command under keys.
+func newStoreDeleteCommand() *cobra.Command {
+	cmd := keystorecli.NewDeleteCommand()
+	keystorecli.AddStoreFlag(cmd)
+
+	return cmd
+}
+
+func runStoreKey(cmd *cobra.Command, _ []string) error {
+	id, _ := cmd.Flags().GetString("id")
+	value, _ := cmd.Flags().GetString("key")
+	keyType, _ := cmd.Flags().GetString("type")
+	lmkID, _ := cmd.Flags().GetString("lmk-id")
+	tagPairs, _ := cmd.Flags().GetStringArray("tag")
+
+	tags, err := keystore.ParseTags(tagPairs)
+	if err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		tags = nil
+	}
+
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return errors.New("--key is required")
+	}
+
+	var key keystore.Key
+	if keyschemes.IsKeyBlock(value[0]) {
+		key, err = storedKeyBlock(cmd, value)
+	} else {
+		if lmkID == "" {
+			lmkID = "00"
+		}
+		key, err = storedVariantKey(cmd, lmkID, strings.ToUpper(value), keyType)
+	}
+	if err != nil {
+		return err
+	}
+	key.ID = id
+	key.Tags = tags
+
+	store, err := keystorecli.OpenStore(cmd)
+	if err != nil {
+		return err
+	}
+	if err := store.Add(key); err != nil {
+		return fmt.Errorf("failed to store key: %w", err)
+	}
+	if err := store.Save(); err != nil {
+		return err
+	}
+
+	cmd.Printf("Key %s stored in %s (KCV: %s)\n", id, store.Path(), key.KCV)
+
+	return nil
+}
+
+// storedVariantKey checks a scheme-prefixed variant key and returns its store entry.
+func storedVariantKey(cmd *cobra.Command, lmkID, value, keyType string) (keystore.Key, error) {
+	if keyType == "" {
+		return keystore.Key{}, errors.New("--type is required for variant keys")
+	}
+	checked, err := checkVariantKey(lmkID, value, keyType, pciModeFlag(cmd, lmkID))
+	if err != nil {
+		return keystore.Key{}, err
+	}
+
+	return keystore.Key{
+		LMKID:   lmkID,
+		KeyType: keyType,
+		Scheme:  string(checked.scheme),
+		Value:   checked.Key[1:],
+		KCV:     checked.KCV,
+	}, nil
+}
+
+// storedKeyBlock unwraps a key block under its LMK and returns its store entry.
+func storedKeyBlock(cmd *cobra.Command, value string) (keystore.Key, error) {
+	keyBlock := []byte(value)
+	engine, lmkID, err := keyBlockLMK(cmd, keyBlock)
+	if err != nil {
+		return keystore.Key{}, err
+	}
+	header, err := keyblocklmk.ParseHeader(keyBlock)
+	if err != nil {
+		return keystore.Key{}, fmt.Errorf("invalid key block: %w", err)
+	}
+	clearKey, err := engine.DecryptUnderLMK(keyBlock, "", keyBlock[0], lmkID)
+	if err != nil {
+		return keystore.Key{}, fmt.Errorf("failed to unwrap key block: %w", err)
+	}
+	kcv, err := verifyCheckValue(header.Algorithm, clearKey)
+	if err != nil {
+		return keystore.Key{}, err
+	}
+	keyType, _ := cmd.Flags().GetString("type")
+
+	return keystore.Key{
+		LMKID:   lmkID,
+		KeyType: keyType,
+		Scheme:  string(keyBlock[0]),
+		Usage:   header.KeyUsage,
+		Value:   value,
+		KCV:     fmt.Sprintf("%X", kcv),
+	}, nil
+}
+
+func runExportKey(cmd *cobra.Command, args []string) error {
+	asJSON, _ := cmd.Flags().GetBool("json")
+
+	store, err := keystorecli.OpenStore(cmd)
+	if err != nil {
+		return err
+	}
+	key, err := store.Get(args[0])
+	if err != nil {
+		return err
+	}
+	if err := audit.Append(config.Get().Audit.Path, audit.EventKeyExported, map[string]string{
+		"command":  "keys export",
+		"key_id":   key.ID,
+		"lmk_id":   key.LMKID,
+		"key_type": key.KeyType,
+		"kcv":      key.KCV,
+		"store":    store.Path(),
+	}); err != nil {
+		return fmt.Errorf("key %s not exported: %w", key.ID, err)
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(key)
+	}
+
+	value := key.Value
+	if len(key.Scheme) == 1 && !keyschemes.IsKeyBlock(key.Scheme[0]) {
+		value = key.Scheme + value
+	}
+	cmd.Println(value)
+
+	return nil
+}
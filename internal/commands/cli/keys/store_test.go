@@ -0,0 +1,87 @@
+package keys
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/keystore"
+	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+	"github.com/spf13/cobra"
+)
+
+// TestStoreListExportDelete stores a variant key and a key block, then lists, exports and
+// deletes them through the keys commands.
+func TestStoreListExportDelete(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "keystore.json")
+	run := func(cmd func() *cobra.Command, args ...string) string {
+		t.Helper()
+
+		var out bytes.Buffer
+		c := cmd()
+		c.SetOut(&out)
+		c.SetErr(&out)
+		c.SetArgs(append(args, "--store", path))
+		if err := c.Execute(); err != nil {
+			t.Fatalf("%v failed: %v\n%s", args, err, out.String())
+		}
+
+		return out.String()
+	}
+
+	var generated bytes.Buffer
+	gen := newGenerateKeyCommand()
+	gen.SetOut(&generated)
+	gen.SetArgs([]string{"--type", "001", "--scheme", "U", "--output", "ndjson"})
+	if err := gen.Execute(); err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	var zpk generatedKey
+	if err := json.Unmarshal(generated.Bytes(), &zpk); err != nil {
+		t.Fatalf("invalid generate output %q: %v", generated.String(), err)
+	}
+
+	clearKey, _ := hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+	block, err := keyblocklmk.WrapKeyBlock(keyblocklmk.DefaultTestAESLMK, keyblocklmk.Header{
+		Version:       '0',
+		KeyUsage:      "K0",
+		Algorithm:     'T',
+		ModeOfUse:     'B',
+		KeyVersionNum: "00",
+		Exportability: 'E',
+	}, nil, clearKey)
+	if err != nil {
+		t.Fatalf("failed to wrap key block: %v", err)
+	}
+
+	run(newStoreCommand, "--id", "zpk", "--key", zpk.Key, "--type", "001", "--tag", "partner=acme")
+	run(newStoreCommand, "--id", "kbpk", "--key", string(block))
+
+	var listed []keystore.Key
+	if err := json.Unmarshal([]byte(run(newStoreListCommand, "--usage", "k0", "--json")), &listed); err != nil {
+		t.Fatalf("invalid list output: %v", err)
+	}
+	if len(listed) != 1 || listed[0].ID != "kbpk" || listed[0].KCV != "08D7B4" {
+		t.Errorf("listed keys = %+v, want kbpk with KCV 08D7B4", listed)
+	}
+	if out := run(newStoreListCommand, "--kcv", zpk.KCV); !strings.Contains(out, "zpk") || strings.Contains(out, "kbpk") {
+		t.Errorf("list by KCV = %q", out)
+	}
+
+	if got := strings.TrimSpace(run(newExportCommand, "zpk")); got != zpk.Key {
+		t.Errorf("export zpk = %s, want %s", got, zpk.Key)
+	}
+	if got := strings.TrimSpace(run(newExportCommand, "kbpk")); got != string(block) {
+		t.Errorf("export kbpk = %s, want %s", got, block)
+	}
+
+	run(newStoreDeleteCommand, "zpk")
+	if out := run(newStoreListCommand); strings.Contains(out, "zpk") {
+		t.Errorf("deleted key still listed: %q", out)
+	}
+}
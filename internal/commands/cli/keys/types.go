@@ -26,7 +26,7 @@ Use --pci flag to show PCI-HSM compliant key types.`,
 }
 
 func runTypes(cmd *cobra.Command, _ []string) error {
-	pciMode, _ := cmd.Flags().GetBool("pci")
+	pciMode := pciModeFlag(cmd, "00")
 
 	var keyTypes map[string]variantlmk.KeyType
 	if pciMode {
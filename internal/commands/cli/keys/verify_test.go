@@ -0,0 +1,64 @@
+package keys
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+)
+
+// TestVerifyBlockAgainstClear verifies the pass/fail report for clear keys and components.
+func TestVerifyBlockAgainstClear(t *testing.T) {
+	t.Parallel()
+
+	clearKey, _ := hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+	block, err := keyblocklmk.WrapKeyBlock(keyblocklmk.DefaultTestAESLMK, keyblocklmk.Header{
+		Version:       '0',
+		KeyUsage:      "K0",
+		Algorithm:     'T',
+		ModeOfUse:     'B',
+		KeyVersionNum: "00",
+		Exportability: 'E',
+	}, nil, clearKey)
+	if err != nil {
+		t.Fatalf("failed to wrap key block: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr error
+	}{
+		{"clear key", []string{"--clear", hex.EncodeToString(clearKey)}, "Result: PASS", nil},
+		{"parity differs", []string{"--clear", "0023456789ABCDEFFEDCBA9876543210"}, "Result: PASS", nil},
+		{"components", []string{
+			"--component", "11111111111111111111111111111111",
+			"--component", "1032547698BADCFEEFCDAB8967452301",
+		}, "Components: 2", nil},
+		{"wrong key", []string{"--clear", "FEDCBA98765432100123456789ABCDEF"}, "Result: FAIL", errVerifyMismatch},
+		{"wrong length", []string{"--clear", "0123456789ABCDEF"}, "Result: FAIL", errVerifyMismatch},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var out bytes.Buffer
+			cmd := newVerifyBlockCommand()
+			cmd.SetOut(&out)
+			cmd.SetErr(&out)
+			cmd.SetArgs(append([]string{string(block)}, tc.args...))
+			err := cmd.Execute()
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("Execute() error = %v, want %v", err, tc.wantErr)
+			}
+			if !strings.Contains(out.String(), tc.want) {
+				t.Errorf("output %q does not contain %q", out.String(), tc.want)
+			}
+		})
+	}
+}
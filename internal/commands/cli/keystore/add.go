@@ -0,0 +1,83 @@
+// Package keystore provides key store add command implementation.
+package keystore
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/andrei-cloud/go_hsm/internal/keystore"
+	"github.com/spf13/cobra"
+)
+
+func newAddCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "add",
+		Short: "Add a key encrypted under LMK to the store",
+		Long: `Add a key that is already encrypted under LMK to the key store.
+The key value is stored as given; it is never decrypted by this command.`,
+		RunE: runAdd,
+	}
+
+	// Add flags.
+	cmd.Flags().String("id", "", "Unique key identifier")
+	cmd.Flags().String("key", "", "Key encrypted under LMK (hex, or key block)")
+	cmd.Flags().String("type", "", "Key type code (e.g. 000, 001, 002)")
+	cmd.Flags().String("scheme", "", "Key scheme (X, U, T, or S for key block)")
+	cmd.Flags().String("lmk-id", "00", "LMK ID the key is encrypted under")
+	cmd.Flags().String("kcv", "", "Key check value")
+	cmd.Flags().String("usage", "", "Key block key usage (e.g. K0, P0)")
+	cmd.Flags().StringArray("tag", nil, "Tag to attach (name=value, repeatable)")
+
+	for _, name := range []string{"id", "key"} {
+		if err := cmd.MarkFlagRequired(name); err != nil {
+			panic(err)
+		}
+	}
+
+	return cmd
+}
+
+func runAdd(cmd *cobra.Command, _ []string) error {
+	id, _ := cmd.Flags().GetString("id")
+	value, _ := cmd.Flags().GetString("key")
+	keyType, _ := cmd.Flags().GetString("type")
+	scheme, _ := cmd.Flags().GetString("scheme")
+	lmkID, _ := cmd.Flags().GetString("lmk-id")
+	kcv, _ := cmd.Flags().GetString("kcv")
+	usage, _ := cmd.Flags().GetString("usage")
+	tagPairs, _ := cmd.Flags().GetStringArray("tag")
+
+	store, err := OpenStore(cmd)
+	if err != nil {
+		return err
+	}
+
+	tags, err := keystore.ParseTags(tagPairs)
+	if err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		tags = nil
+	}
+
+	key := keystore.Key{
+		ID:      id,
+		LMKID:   lmkID,
+		KeyType: keyType,
+		Scheme:  strings.ToUpper(scheme),
+		Value:   strings.ToUpper(value),
+		KCV:     strings.ToUpper(kcv),
+		Usage:   strings.ToUpper(usage),
+		Tags:    tags,
+	}
+	if err := store.Add(key); err != nil {
+		return fmt.Errorf("failed to add key: %w", err)
+	}
+	if err := store.Save(); err != nil {
+		return err
+	}
+
+	cmd.Printf("Key %s added to %s\n", id, store.Path())
+
+	return nil
+}
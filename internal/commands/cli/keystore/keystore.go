@@ -0,0 +1,70 @@
+// Package keystore provides key store management commands.
+package keystore
+
+import (
+	"errors"
+	"os"
+
+	"github.com/andrei-cloud/go_hsm/internal/config"
+	"github.com/andrei-cloud/go_hsm/internal/keystore"
+	"github.com/spf13/cobra"
+)
+
+// passphraseEnv is the environment variable consulted when --passphrase is not given.
+const passphraseEnv = "GOHSM_KEYSTORE_PASSPHRASE"
+
+// NewKeystoreCommand creates the keystore command group.
+func NewKeystoreCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "keystore",
+		Short: "Key store management",
+		Long: `Manage keys kept in the simulator key store.
+Keys are stored encrypted under LMK together with their metadata. The store can be
+backed up to a passphrase-protected archive and restored into another environment.`,
+	}
+
+	AddStoreFlag(cmd)
+
+	// Add subcommands.
+	cmd.AddCommand(newAddCommand())
+	cmd.AddCommand(NewListCommand())
+	cmd.AddCommand(NewDeleteCommand())
+	cmd.AddCommand(newTagCommand())
+	cmd.AddCommand(newBackupCommand())
+	cmd.AddCommand(newRestoreCommand())
+
+	return cmd
+}
+
+// AddStoreFlag adds the --store flag selecting the key store to cmd and its subcommands.
+func AddStoreFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().String("store", "",
+		"Key store file or backend URL, e.g. sql:sqlite:keys.db (default from keystore.path config)")
+}
+
+// OpenStore opens the key store selected by the --store flag or configuration. The location
+// is a file path or a backend URL accepted by keystore.OpenURL.
+func OpenStore(cmd *cobra.Command) (*keystore.Store, error) {
+	path, _ := cmd.Flags().GetString("store")
+	if path == "" {
+		path = config.Get().Keystore.Path
+	}
+	if path == "" {
+		return nil, errors.New("key store path is not configured (use --store)")
+	}
+
+	return keystore.OpenURL(path)
+}
+
+// passphrase returns the archive passphrase from the flag or environment.
+func passphrase(cmd *cobra.Command) (string, error) {
+	pass, _ := cmd.Flags().GetString("passphrase")
+	if pass == "" {
+		pass = os.Getenv(passphraseEnv)
+	}
+	if pass == "" {
+		return "", errors.New("passphrase is required (use --passphrase or " + passphraseEnv + ")")
+	}
+
+	return pass, nil
+}
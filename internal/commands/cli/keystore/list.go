@@ -0,0 +1,159 @@
+// Package keystore provides key store listing commands.
+package keystore
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/andrei-cloud/go_hsm/internal/keystore"
+	"github.com/andrei-cloud/go_hsm/pkg/variantlmk"
+	"github.com/spf13/cobra"
+)
+
+// NewListCommand creates the command listing keys in the store selected by --store.
+func NewListCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List keys in the store",
+		Long: `List keys in the key store with their metadata.
+Keys can be filtered by tag (--tag name=value, repeatable; --tag name matches any value),
+by key type code or name (--type 001 or --type ZPK), by key block key usage (--usage K0,
+repeatable) and by check value (--kcv, matching its leading digits).`,
+		Example: `  go_hsm keystore list --tag partner=acme --type ZPK
+  go_hsm keystore list --tag env=uat --json
+  go_hsm keys list --usage P0 --kcv 0A1B2C`,
+		RunE: runList,
+	}
+
+	cmd.Flags().StringArray("tag", nil, "Only list keys with this tag (name=value)")
+	cmd.Flags().String("type", "", "Only list keys of this type code or name")
+	cmd.Flags().StringArray("usage", nil, "Only list key blocks with this key usage (repeatable)")
+	cmd.Flags().String("kcv", "", "Only list keys whose check value starts with this value")
+	cmd.Flags().Bool("json", false, "Print keys as JSON")
+
+	return cmd
+}
+
+// NewDeleteCommand creates the command deleting a key from the store selected by --store.
+func NewDeleteCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete <id>",
+		Short: "Delete a key from the store",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runDelete,
+	}
+}
+
+func runList(cmd *cobra.Command, _ []string) error {
+	tagPairs, _ := cmd.Flags().GetStringArray("tag")
+	keyType, _ := cmd.Flags().GetString("type")
+	usages, _ := cmd.Flags().GetStringArray("usage")
+	kcv, _ := cmd.Flags().GetString("kcv")
+	asJSON, _ := cmd.Flags().GetBool("json")
+
+	store, err := OpenStore(cmd)
+	if err != nil {
+		return err
+	}
+
+	tags, err := keystore.ParseTags(tagPairs)
+	if err != nil {
+		return err
+	}
+	filter := keystore.Filter{Tags: tags, Usages: usages, KCV: kcv}
+	if keyType != "" {
+		filter.KeyTypes = keyTypeCodes(keyType)
+	}
+	keys := store.Find(filter)
+
+	if asJSON {
+		if keys == nil {
+			keys = []keystore.Key{}
+		}
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(keys)
+	}
+
+	// Create tabwriter for aligned output.
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ID\tLMK\tType\tUsage\tScheme\tKCV\tCreated\tTags")
+	_, _ = fmt.Fprintln(w, "--\t---\t----\t-----\t------\t---\t-------\t----")
+
+	for _, k := range keys {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			k.ID,
+			k.LMKID,
+			k.KeyType,
+			k.Usage,
+			k.Scheme,
+			k.KCV,
+			k.CreatedAt.Format(time.RFC3339),
+			formatTags(k.Tags))
+	}
+
+	return w.Flush()
+}
+
+// keyTypeCodes resolves a key type code or name (e.g. ZPK, TPK) to the codes it denotes in
+// the variant key type tables. Unknown values are matched literally, which also covers key
+// block key usages.
+func keyTypeCodes(keyType string) []string {
+	codes := []string{keyType}
+	for _, table := range []map[string]variantlmk.KeyType{variantlmk.KeyTypes, variantlmk.KeyTypesPCI} {
+		for code, kt := range table {
+			if keyTypeNameMatches(kt.Name, keyType) {
+				codes = append(codes, code)
+			}
+		}
+	}
+
+	return codes
+}
+
+// keyTypeNameMatches compares name against each alternative of a table name such as
+// "TPK/TMK/PEK", ignoring qualifiers in parentheses.
+func keyTypeNameMatches(tableName, name string) bool {
+	base, _, _ := strings.Cut(tableName, "(")
+	for _, alt := range strings.Split(base, "/") {
+		if strings.EqualFold(strings.TrimSpace(alt), name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// formatTags renders tags as sorted name=value pairs.
+func formatTags(tags map[string]string) string {
+	pairs := make([]string, 0, len(tags))
+	for name, value := range tags {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
+}
+
+func runDelete(cmd *cobra.Command, args []string) error {
+	store, err := OpenStore(cmd)
+	if err != nil {
+		return err
+	}
+
+	if err := store.Delete(args[0]); err != nil {
+		return err
+	}
+	if err := store.Save(); err != nil {
+		return err
+	}
+
+	cmd.Printf("Key %s deleted\n", args[0])
+
+	return nil
+}
@@ -0,0 +1,49 @@
+// Package keystore provides key store tagging commands.
+package keystore
+
+import (
+	"github.com/andrei-cloud/go_hsm/internal/keystore"
+	"github.com/spf13/cobra"
+)
+
+func newTagCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tag <id> [name=value...]",
+		Short: "Set or remove tags on a stored key",
+		Long: `Attach free-form tags such as environment, partner or expiry to a stored key.
+Existing tags with the same name are replaced; --remove deletes tags by name.`,
+		Example: `  go_hsm keystore tag zpk1 partner=acme env=uat expiry=2025-12-31
+  go_hsm keystore tag zpk1 --remove expiry`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: runTag,
+	}
+
+	cmd.Flags().StringArray("remove", nil, "Tag name to remove (repeatable)")
+
+	return cmd
+}
+
+func runTag(cmd *cobra.Command, args []string) error {
+	remove, _ := cmd.Flags().GetStringArray("remove")
+
+	store, err := OpenStore(cmd)
+	if err != nil {
+		return err
+	}
+
+	tags, err := keystore.ParseTags(args[1:])
+	if err != nil {
+		return err
+	}
+	if err := store.Tag(args[0], tags, remove); err != nil {
+		return err
+	}
+	if err := store.Save(); err != nil {
+		return err
+	}
+
+	k, _ := store.Get(args[0])
+	cmd.Printf("Key %s tags: %s\n", k.ID, formatTags(k.Tags))
+
+	return nil
+}
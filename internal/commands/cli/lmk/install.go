@@ -0,0 +1,145 @@
+// Package lmk provides LMK generate and install command implementation.
+package lmk
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/andrei-cloud/go_hsm/internal/lmkstore"
+	"github.com/spf13/cobra"
+)
+
+func newGenerateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "generate",
+		Short: "Generate LMK components and install their LMK",
+		Long: `Generate random components of a new LMK, print them with their check values
+for the key custodians, and install the LMK they combine to. The LMK is installed
+inactive; use 'lmk activate' to register it at the next server start.`,
+		Example: `  go_hsm lmk generate --id 02 --type keyblock --components 3
+  go_hsm lmk generate --id 03 --type variant`,
+		RunE: runGenerate,
+	}
+
+	cmd.Flags().String("id", "", "LMK ID (00-19)")
+	cmd.Flags().String("type", string(lmkstore.TypeKeyBlock), "LMK type (variant or keyblock)")
+	cmd.Flags().Int("components", 2, "Number of components (1-9)")
+
+	if err := cmd.MarkFlagRequired("id"); err != nil {
+		panic(err)
+	}
+
+	return cmd
+}
+
+func newInstallCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "install",
+		Short: "Install an LMK from its components",
+		Long: `Install an LMK by XOR-combining components entered by the key custodians, as
+printed by 'lmk generate'. A variant LMK component holds the 20 LMK pairs, 640 hex
+characters; a key block LMK component holds 64. The LMK is installed inactive.
+With --old the LMK is loaded into key change storage as the old LMK of the ID instead,
+replacing any old LMK held for it, to translate keys with BW or 'keys migrate'.`,
+		Example: `  go_hsm lmk install --id 02 --type keyblock --component <hex> --component <hex>
+  go_hsm lmk install --id 00 --type variant --old --component <hex>`,
+		RunE: runInstall,
+	}
+
+	cmd.Flags().String("id", "", "LMK ID (00-19)")
+	cmd.Flags().String("type", string(lmkstore.TypeKeyBlock), "LMK type (variant or keyblock)")
+	cmd.Flags().StringArray("component", nil, "LMK component in hex (repeatable)")
+	cmd.Flags().Bool("old", false, "Install into key change storage as the old LMK")
+
+	for _, name := range []string{"id", "component"} {
+		if err := cmd.MarkFlagRequired(name); err != nil {
+			panic(err)
+		}
+	}
+
+	return cmd
+}
+
+func runGenerate(cmd *cobra.Command, _ []string) error {
+	id, _ := cmd.Flags().GetString("id")
+	typeName, _ := cmd.Flags().GetString("type")
+	n, _ := cmd.Flags().GetInt("components")
+
+	t, err := lmkstore.ParseType(typeName)
+	if err != nil {
+		return err
+	}
+	components, err := lmkstore.GenerateComponents(t, n)
+	if err != nil {
+		return err
+	}
+	for i, component := range components {
+		kcv, err := lmkstore.CheckValue(t, component)
+		if err != nil {
+			return err
+		}
+		cmd.Printf("Component %d: %X\n", i+1, component)
+		cmd.Printf("Component %d KCV: %s\n", i+1, kcv)
+	}
+
+	return install(cmd, id, t, components, false)
+}
+
+func runInstall(cmd *cobra.Command, _ []string) error {
+	id, _ := cmd.Flags().GetString("id")
+	typeName, _ := cmd.Flags().GetString("type")
+	componentsHex, _ := cmd.Flags().GetStringArray("component")
+	old, _ := cmd.Flags().GetBool("old")
+
+	t, err := lmkstore.ParseType(typeName)
+	if err != nil {
+		return err
+	}
+	components := make([][]byte, len(componentsHex))
+	for i, c := range componentsHex {
+		if components[i], err = hex.DecodeString(strings.TrimSpace(c)); err != nil {
+			return fmt.Errorf("invalid component %d: %w", i+1, err)
+		}
+	}
+
+	return install(cmd, id, t, components, old)
+}
+
+// install combines components into an LMK and installs it under id, as the old LMK of id
+// when old is set.
+func install(cmd *cobra.Command, id string, t lmkstore.Type, components [][]byte, old bool) error {
+	if err := lmkstore.ValidateID(id); err != nil {
+		return err
+	}
+	value, err := lmkstore.CombineComponents(t, components)
+	if err != nil {
+		return err
+	}
+
+	store, err := openUnlockedStore(cmd)
+	if err != nil {
+		return err
+	}
+	installLMK, kind, change := store.Install, "LMK", "installed"
+	if old {
+		installLMK, kind, change = store.InstallOld, "Old LMK", "installed in key change storage"
+	}
+	lmk, err := installLMK(id, t, value)
+	if err != nil {
+		return fmt.Errorf("failed to install LMK: %w", err)
+	}
+	if err := store.Save(); err != nil {
+		return err
+	}
+	if err := recordChange(store, lmk.ID, change, map[string]string{
+		"type": string(lmk.Type),
+		"kcv":  lmk.KCV,
+	}); err != nil {
+		return err
+	}
+
+	cmd.Printf("%s %s (%s) installed in %s, KCV: %s\n", kind, lmk.ID, lmk.Type, store.Path(), lmk.KCV)
+
+	return nil
+}
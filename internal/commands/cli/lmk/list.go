@@ -0,0 +1,125 @@
+// Package lmk provides LMK listing and status command implementation.
+package lmk
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/andrei-cloud/go_hsm/internal/lmkstore"
+	"github.com/spf13/cobra"
+)
+
+func newListCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List installed LMKs",
+		Long: `List the LMKs installed in the LMK store with their type, status and check value,
+followed by the old LMKs held in key change storage with status "old". Listing does not
+unseal the LMKs and needs no passphrase.`,
+		RunE: runList,
+	}
+
+	cmd.Flags().Bool("json", false, "Print LMKs as JSON")
+
+	return cmd
+}
+
+func newActivateCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "activate <id>",
+		Short: "Activate an installed LMK",
+		Long: `Activate an installed or retired LMK. The server registers active LMKs at startup,
+replacing a built-in LMK with the same ID.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return setStatus(cmd, args[0], (*lmkstore.Store).Activate, "activated")
+		},
+	}
+}
+
+func newRetireCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "retire <id>",
+		Short: "Retire an active LMK",
+		Long:  `Retire an LMK. It stays in the store but is no longer registered at startup.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return setStatus(cmd, args[0], (*lmkstore.Store).Retire, "retired")
+		},
+	}
+}
+
+func newDeleteCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "delete <id>",
+		Short: "Delete an inactive LMK from the store",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if old, _ := cmd.Flags().GetBool("old"); old {
+				return setStatus(cmd, args[0], (*lmkstore.Store).DeleteOld, "deleted from key change storage")
+			}
+
+			return setStatus(cmd, args[0], (*lmkstore.Store).Delete, "deleted")
+		},
+	}
+
+	cmd.Flags().Bool("old", false, "Delete the old LMK held in key change storage")
+
+	return cmd
+}
+
+func runList(cmd *cobra.Command, _ []string) error {
+	asJSON, _ := cmd.Flags().GetBool("json")
+
+	store, err := openStore(cmd)
+	if err != nil {
+		return err
+	}
+	lmks := append(store.List(), store.ListOld()...)
+
+	if asJSON {
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(lmks)
+	}
+
+	// Create tabwriter for aligned output.
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ID\tType\tStatus\tKCV\tCreated")
+	_, _ = fmt.Fprintln(w, "--\t----\t------\t---\t-------")
+
+	for _, lmk := range lmks {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			lmk.ID,
+			lmk.Type,
+			lmk.Status,
+			lmk.KCV,
+			lmk.CreatedAt.Format(time.RFC3339))
+	}
+
+	return w.Flush()
+}
+
+// setStatus applies change to the LMK installed under id and saves the store.
+func setStatus(cmd *cobra.Command, id string, change func(*lmkstore.Store, string) error, done string) error {
+	store, err := openStore(cmd)
+	if err != nil {
+		return err
+	}
+	if err := change(store, id); err != nil {
+		return err
+	}
+	if err := store.Save(); err != nil {
+		return err
+	}
+	if err := recordChange(store, id, done, nil); err != nil {
+		return err
+	}
+
+	cmd.Printf("LMK %s %s\n", id, done)
+
+	return nil
+}
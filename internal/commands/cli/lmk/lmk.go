@@ -0,0 +1,111 @@
+// Package lmk provides LMK management commands.
+package lmk
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/andrei-cloud/go_hsm/internal/audit"
+	"github.com/andrei-cloud/go_hsm/internal/config"
+	"github.com/andrei-cloud/go_hsm/internal/lmkstore"
+	"github.com/spf13/cobra"
+)
+
+// NewLMKCommand creates the lmk command group.
+func NewLMKCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "lmk",
+		Short: "LMK management",
+		Long: `Generate, install and activate the LMKs of the simulator.
+LMKs are kept in the LMK store sealed under a key encryption key, given with --kek or
+derived from the master passphrase. At startup the server registers the active LMKs of
+the store under their IDs (00-19), replacing the built-in test LMKs, and loads the old
+LMKs of key change storage for BW key translation.`,
+	}
+
+	cmd.PersistentFlags().String("store", "", "LMK store file (default from lmk.store config)")
+	cmd.PersistentFlags().String("passphrase", "",
+		"Master passphrase (or set "+lmkstore.PassphraseEnv+")")
+	cmd.PersistentFlags().String("kek", "",
+		"Hex AES-256 key encryption key, instead of a passphrase (or set "+lmkstore.KEKEnv+")")
+
+	// Add subcommands.
+	cmd.AddCommand(newGenerateCommand())
+	cmd.AddCommand(newInstallCommand())
+	cmd.AddCommand(newListCommand())
+	cmd.AddCommand(newStatusCommand())
+	cmd.AddCommand(newActivateCommand())
+	cmd.AddCommand(newRetireCommand())
+	cmd.AddCommand(newDeleteCommand())
+
+	return cmd
+}
+
+// recordChange records a change of the LMK id in the store to the audit log.
+func recordChange(store *lmkstore.Store, id, change string, fields map[string]string) error {
+	if fields == nil {
+		fields = map[string]string{}
+	}
+	fields["lmk_id"], fields["change"], fields["store"] = id, change, store.Path()
+	if err := audit.Append(config.Get().Audit.Path, audit.EventLMKChanged, fields); err != nil {
+		return fmt.Errorf("LMK %s %s but not audited: %w", id, change, err)
+	}
+
+	return nil
+}
+
+// openStore opens the LMK store selected by the --store flag or configuration.
+func openStore(cmd *cobra.Command) (*lmkstore.Store, error) {
+	path, _ := cmd.Flags().GetString("store")
+
+	return openStorePath(path)
+}
+
+// openStorePath opens the LMK store at path, or the configured one when path is empty.
+func openStorePath(path string) (*lmkstore.Store, error) {
+	if path == "" {
+		path = config.Get().LMK.Store
+	}
+	if path == "" {
+		return nil, errors.New("LMK store path is not configured (use --store)")
+	}
+
+	return lmkstore.Open(path)
+}
+
+// openUnlockedStore opens the LMK store selected by the --store flag or configuration and
+// unlocks it.
+func openUnlockedStore(cmd *cobra.Command) (*lmkstore.Store, error) {
+	path, _ := cmd.Flags().GetString("store")
+
+	return OpenUnlockedStore(cmd, path)
+}
+
+// OpenUnlockedStore opens the LMK store at path, or the configured one when path is empty,
+// and unlocks it with the KEK or passphrase given by the --kek and --passphrase flags of
+// cmd or the environment.
+func OpenUnlockedStore(cmd *cobra.Command, path string) (*lmkstore.Store, error) {
+	store, err := openStorePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	kek, _ := cmd.Flags().GetString("kek")
+	if kek == "" {
+		kek = os.Getenv(lmkstore.KEKEnv)
+	}
+	pass, _ := cmd.Flags().GetString("passphrase")
+	if pass == "" {
+		pass = os.Getenv(lmkstore.PassphraseEnv)
+	}
+	if kek == "" && pass == "" {
+		return nil, errors.New("passphrase or KEK is required (use --passphrase, --kek, " +
+			lmkstore.PassphraseEnv + " or " + lmkstore.KEKEnv + ")")
+	}
+	if err := store.UnlockWith(pass, kek); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
@@ -0,0 +1,100 @@
+package lmk
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/andrei-cloud/go_hsm/internal/config"
+	"github.com/andrei-cloud/go_hsm/internal/hsm/logic"
+	"github.com/andrei-cloud/go_hsm/internal/lmkstore"
+	"github.com/spf13/cobra"
+)
+
+func newStatusCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the check values of the registered LMKs",
+		Long: `Show the LMKs the server registers at startup with their scheme, algorithm and check
+value, computed from the LMKs themselves. The check value is the one the NC command reports
+for the LMK; its first 6 digits are the KCV shown by 'lmk list'. When the LMK store has
+active LMKs they are unsealed and replace the built-in test LMKs with the same ID, which
+needs the passphrase or KEK.`,
+		RunE: runStatus,
+	}
+
+	cmd.Flags().Bool("json", false, "Print LMKs as JSON")
+
+	return cmd
+}
+
+func runStatus(cmd *cobra.Command, _ []string) error {
+	asJSON, _ := cmd.Flags().GetBool("json")
+
+	if err := registerStoreLMKs(cmd); err != nil {
+		return err
+	}
+	for id := range logic.LMKRegistry {
+		if err := logic.SetLMKTest(id, config.Get().TestLMK(id)); err != nil {
+			return err
+		}
+	}
+
+	infos, err := logic.LMKStatus()
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(infos)
+	}
+
+	// Create tabwriter for aligned output.
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ID\tScheme\tAlgorithm\tCheck Value\tTest")
+	_, _ = fmt.Fprintln(w, "--\t------\t---------\t-----------\t----")
+
+	for _, info := range infos {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\n",
+			info.ID,
+			info.Scheme,
+			info.Algorithm,
+			info.CheckValue,
+			info.Test)
+	}
+
+	return w.Flush()
+}
+
+// registerStoreLMKs registers the active LMKs of the LMK store selected by the --store flag
+// or configuration, as the server does at startup. Without a store, or without active LMKs
+// in it, the built-in LMKs are left as they are.
+func registerStoreLMKs(cmd *cobra.Command) error {
+	path, _ := cmd.Flags().GetString("store")
+	if path == "" && config.Get().LMK.Store == "" {
+		return nil
+	}
+	store, err := openStorePath(path)
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(store.List(), func(lmk lmkstore.LMK) bool {
+		return lmk.Status == lmkstore.StatusActive
+	}) {
+		return nil
+	}
+
+	store, err = OpenUnlockedStore(cmd, path)
+	if err != nil {
+		return err
+	}
+	if _, err := lmkstore.Register(store); err != nil {
+		return fmt.Errorf("failed to register LMKs: %w", err)
+	}
+
+	return nil
+}
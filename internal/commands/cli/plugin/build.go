@@ -0,0 +1,200 @@
+// Package plugin provides plugin build commands.
+package plugin
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/andrei-cloud/go_hsm/internal/plugingen"
+	"github.com/spf13/cobra"
+)
+
+// buildOptions configures a plugin build.
+type buildOptions struct {
+	srcDir  string
+	outDir  string
+	tinygo  string
+	version string
+	author  string
+	verify  bool
+}
+
+// NewBuildCommand creates the build command.
+func NewBuildCommand() *cobra.Command {
+	opts := buildOptions{}
+	cmd := &cobra.Command{
+		Use:   "build [CMD...]",
+		Short: "Build command plugins into WASM modules",
+		Long: `Build the command plugins under the plugin source directory, or only the named ones,
+into WASM modules. For each plugin this:
+1. Generates the wrapper from the plugingen directive in gen.go
+2. Compiles it with TinyGo for GOOS=wasip1 GOARCH=wasm
+3. Verifies the module exports the functions the plugin manager requires
+4. Installs it as CMD.wasm in the output directory
+
+The embedded version is the gen.go version with the git revision as build metadata,
+for example 1.0.0+v0.4.0-3-gbd7a979; --version and --author override the metadata.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runBuildPlugins(cmd, args, opts)
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.srcDir, "src", filepath.Join("internal", "commands", "plugins"),
+		"Plugin source directory")
+	cmd.Flags().StringVarP(&opts.outDir, "out", "o", "plugins", "Directory to install built plugins into")
+	cmd.Flags().StringVar(&opts.tinygo, "tinygo", "tinygo", "TinyGo compiler")
+	cmd.Flags().StringVar(&opts.version, "version", "", "Plugin version (default: gen.go version and git revision)")
+	cmd.Flags().StringVar(&opts.author, "author", "", "Plugin author (default: from gen.go)")
+	cmd.Flags().BoolVar(&opts.verify, "verify", true, "Verify the exports of built plugins")
+
+	return cmd
+}
+
+func runBuildPlugins(cmd *cobra.Command, args []string, opts buildOptions) error {
+	names, err := pluginNames(opts.srcDir, args)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(opts.outDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	revision := gitRevision()
+	var failed []string
+	for _, name := range names {
+		if err := buildPlugin(cmd, name, revision, opts); err != nil {
+			cmd.PrintErrf("  - %s: %v\n", name, err)
+			failed = append(failed, name)
+
+			continue
+		}
+		cmd.Printf("  - %s.wasm\n", name)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to build %d of %d plugins: %s",
+			len(failed), len(names), strings.Join(failed, ", "))
+	}
+	cmd.Printf("Built %d plugins into %s\n", len(names), opts.outDir)
+
+	return nil
+}
+
+// pluginNames returns the plugins to build: the requested ones, or every directory of srcDir
+// with a gen.go stub.
+func pluginNames(srcDir string, requested []string) ([]string, error) {
+	if len(requested) > 0 {
+		names := make([]string, len(requested))
+		for i, name := range requested {
+			names[i] = strings.ToUpper(name)
+			if _, err := os.Stat(filepath.Join(srcDir, names[i], "gen.go")); err != nil {
+				return nil, fmt.Errorf("plugin %s not found in %s", names[i], srcDir)
+			}
+		}
+
+		return names, nil
+	}
+
+	entries, err := os.ReadDir(srcDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plugin source directory: %w", err)
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(srcDir, e.Name(), "gen.go")); err == nil {
+			names = append(names, e.Name())
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no plugins found in %s", srcDir)
+	}
+	slices.Sort(names)
+
+	return names, nil
+}
+
+// buildPlugin generates, compiles, verifies and installs one plugin.
+func buildPlugin(cmd *cobra.Command, name, revision string, opts buildOptions) error {
+	dir := filepath.Join(opts.srcDir, name)
+	stub, err := os.ReadFile(filepath.Join(dir, "gen.go"))
+	if err != nil {
+		return fmt.Errorf("failed to read plugin stub: %w", err)
+	}
+	data, err := plugingen.ParseDirective(stub)
+	if err != nil {
+		return fmt.Errorf("invalid plugin stub: %w", err)
+	}
+	switch {
+	case opts.version != "":
+		data.Version = opts.version
+	case revision != "":
+		data.Version += "+" + revision
+	}
+	if opts.author != "" {
+		data.Author = opts.author
+	}
+
+	wrapperPath, err := plugingen.WriteWrapper(dir, data)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(wrapperPath)
+	}()
+
+	// Build next to the destination so a module failing verification is never installed.
+	tmp, err := os.CreateTemp(opts.outDir, "."+name+"-*.wasm")
+	if err != nil {
+		return fmt.Errorf("failed to create build output: %w", err)
+	}
+	tmpPath := tmp.Name()
+	_ = tmp.Close()
+	defer func() {
+		_ = os.Remove(tmpPath)
+	}()
+
+	tinygo := exec.CommandContext(cmd.Context(), opts.tinygo, "build",
+		"-o", tmpPath,
+		"-target=wasi", "-scheduler=none", "-opt=z", "-no-debug",
+		wrapperPath)
+	tinygo.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	var stderr bytes.Buffer
+	tinygo.Stdout = cmd.OutOrStdout()
+	tinygo.Stderr = &stderr
+	if err := tinygo.Run(); err != nil {
+		return fmt.Errorf("compile failed: %w\n%s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	if opts.verify {
+		wasm, err := os.ReadFile(tmpPath)
+		if err != nil {
+			return fmt.Errorf("failed to read built plugin: %w", err)
+		}
+		if err := plugingen.VerifyExports(cmd.Context(), wasm); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Rename(tmpPath, filepath.Join(opts.outDir, name+".wasm")); err != nil {
+		return fmt.Errorf("failed to install plugin: %w", err)
+	}
+
+	return nil
+}
+
+// gitRevision describes the source revision with git, or returns "" outside a work tree.
+func gitRevision() string {
+	out, err := exec.Command("git", "describe", "--tags", "--always", "--dirty").Output()
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(out))
+}
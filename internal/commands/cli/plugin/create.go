@@ -2,12 +2,13 @@
 package plugin
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
+	"github.com/andrei-cloud/go_hsm/internal/hsm/cmddoc"
 	"github.com/spf13/cobra"
 )
 
@@ -137,13 +138,35 @@ package main
 		return fmt.Errorf("failed to create plugin stub: %w", err)
 	}
 
-	// 3. Generate the wrapper.
-	if err := runMake("gen", "CMD="+name); err != nil {
-		return fmt.Errorf("failed to generate plugin wrapper: %w", err)
+	// Scaffold the command descriptor served by "commands describe".
+	descPath := filepath.Join("internal", "hsm", "cmddoc", "descriptors", name+".json")
+	descContent, err := json.MarshalIndent(cmddoc.Descriptor{
+		Command:  name,
+		Response: string([]byte{name[0], name[1] + 1}),
+		Title:    pluginDesc,
+		Synopsis: pluginDesc,
+		Request:  []cmddoc.Field{},
+		Reply:    []cmddoc.Field{{Name: "Error code", Length: "2N", Description: "00 on success"}},
+		Errors:   []cmddoc.ErrorCode{{Code: "15", Meaning: "Invalid input data"}},
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to create command descriptor: %w", err)
+	}
+	if err := os.WriteFile(descPath, append(descContent, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write command descriptor: %w", err)
 	}
 
-	// 4. Build the plugin.
-	if err := runMake("plugins", "CMD="+name); err != nil {
+	// 3. Generate the wrapper and 4. build the plugin.
+	opts := buildOptions{
+		srcDir: filepath.Join("internal", "commands", "plugins"),
+		outDir: "plugins",
+		tinygo: "tinygo",
+		verify: true,
+	}
+	if err := os.MkdirAll(opts.outDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	if err := buildPlugin(cmd, name, gitRevision(), opts); err != nil {
 		return fmt.Errorf("failed to build plugin: %w", err)
 	}
 
@@ -151,11 +174,3 @@ package main
 
 	return nil
 }
-
-func runMake(target string, args ...string) error {
-	makeCmd := exec.Command("make", append([]string{target}, args...)...)
-	makeCmd.Stdout = os.Stdout
-	makeCmd.Stderr = os.Stderr
-
-	return makeCmd.Run()
-}
@@ -6,14 +6,16 @@ import "github.com/spf13/cobra"
 // NewPluginCommand creates the main plugin command group.
 func NewPluginCommand() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "plugin",
-		Short: "Plugin management commands",
-		Long:  `Commands for managing HSM command plugins.`,
+		Use:     "plugin",
+		Aliases: []string{"plugins"},
+		Short:   "Plugin management commands",
+		Long:    `Commands for managing HSM command plugins.`,
 	}
 
 	// Add subcommands.
 	cmd.AddCommand(NewCreateCommand())
 	cmd.AddCommand(NewListCommand())
+	cmd.AddCommand(NewBuildCommand())
 
 	return cmd
 }
@@ -4,10 +4,21 @@ package cli
 import (
 	"fmt"
 
+	"github.com/andrei-cloud/go_hsm/internal/commands/cli/audit"
+	"github.com/andrei-cloud/go_hsm/internal/commands/cli/authorized"
+	"github.com/andrei-cloud/go_hsm/internal/commands/cli/commands"
+	"github.com/andrei-cloud/go_hsm/internal/commands/cli/config"
+	"github.com/andrei-cloud/go_hsm/internal/commands/cli/debug"
+	"github.com/andrei-cloud/go_hsm/internal/commands/cli/fuzz"
+	"github.com/andrei-cloud/go_hsm/internal/commands/cli/ha"
+	"github.com/andrei-cloud/go_hsm/internal/commands/cli/iso8583"
 	"github.com/andrei-cloud/go_hsm/internal/commands/cli/keys"
+	"github.com/andrei-cloud/go_hsm/internal/commands/cli/keystore"
+	"github.com/andrei-cloud/go_hsm/internal/commands/cli/lmk"
 	"github.com/andrei-cloud/go_hsm/internal/commands/cli/pb"
 	"github.com/andrei-cloud/go_hsm/internal/commands/cli/plugin"
 	"github.com/andrei-cloud/go_hsm/internal/commands/cli/server"
+	"github.com/andrei-cloud/go_hsm/internal/commands/cli/soak"
 	"github.com/spf13/cobra"
 )
 
@@ -15,6 +26,11 @@ import (
 func RegisterCommands(root *cobra.Command) error {
 	// Root commands.
 	root.AddCommand(keys.NewKeysCommand())
+	root.AddCommand(keystore.NewKeystoreCommand())
+	root.AddCommand(lmk.NewLMKCommand())
+	root.AddCommand(config.NewConfigCommand())
+	root.AddCommand(authorized.NewAuthorizedCommand())
+	root.AddCommand(audit.NewAuditCommand())
 
 	pinblockCmd, err := pb.NewPinBlockCommand()
 	if err != nil {
@@ -24,6 +40,12 @@ func RegisterCommands(root *cobra.Command) error {
 
 	root.AddCommand(server.NewServeCommand())
 	root.AddCommand(plugin.NewPluginCommand())
+	root.AddCommand(commands.NewCommandsCommand())
+	root.AddCommand(iso8583.NewISO8583Command())
+	root.AddCommand(ha.NewHACommand())
+	root.AddCommand(fuzz.NewFuzzCommand())
+	root.AddCommand(soak.NewSoakCommand())
+	root.AddCommand(debug.NewDebugCommand())
 
 	return nil
 }
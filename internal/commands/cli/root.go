@@ -22,7 +22,7 @@ and other cryptographic functions for payment card processing.`,
 		SilenceUsage:  true,
 		PersistentPreRunE: func(_ *cobra.Command, _ []string) error {
 			// Initialize configuration before running any command.
-			if err := config.Initialize(); err != nil {
+			if err := config.Initialize(cfgFile); err != nil {
 				return fmt.Errorf("failed to initialize configuration: %w", err)
 			}
 
@@ -32,7 +32,8 @@ and other cryptographic functions for payment card processing.`,
 
 	// Add persistent flags that affect all commands.
 	rootCmd.PersistentFlags().
-		StringVar(&cfgFile, "config", "", "config file (default is $HOME/.go_hsm/config.yaml)")
+		StringVar(&cfgFile, "config", "",
+			"config file, YAML, TOML or JSON (default is $"+config.EnvConfigFile+" or $HOME/.go_hsm/config.yaml)")
 
 	// Add global flags that can override config file settings.
 	rootCmd.PersistentFlags().
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/andrei-cloud/go_hsm/internal/config"
+	"github.com/andrei-cloud/go_hsm/internal/console"
+	"github.com/andrei-cloud/go_hsm/internal/hsm"
+	"github.com/andrei-cloud/go_hsm/internal/pcipolicy"
+	"github.com/andrei-cloud/go_hsm/internal/server"
+	"github.com/rs/zerolog/log"
+)
+
+// startConsole starts the payShield console emulation on addr until ctx is canceled.
+func startConsole(
+	ctx context.Context,
+	addr string,
+	srv *server.Server,
+	h *hsm.HSM,
+	cfg *config.Config,
+	pciMode func(string) bool,
+) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to start console: %v", err)
+	}
+
+	c := console.New(h, consoleSettings(srv, cfg, pciMode))
+	go func() {
+		if err := c.Serve(ctx, l); err != nil {
+			log.Error().Err(err).Msg("console stopped")
+		}
+	}()
+	log.Info().Str("address", addr).Msg("console emulation started")
+
+	return nil
+}
+
+// consoleSettings returns the security settings of srv viewed and changed from the console.
+func consoleSettings(srv *server.Server, cfg *config.Config, pciMode func(string) bool) []console.Setting {
+	return []console.Setting{
+		{
+			Name:        "diagnostics",
+			Description: "Append internal error reasons to error responses (Y/N)",
+			Get:         func() string { return console.FormatYesNo(srv.Diagnostics()) },
+			Set: func(value string) error {
+				enabled, err := console.ParseYesNo(value)
+				if err != nil {
+					return err
+				}
+				srv.SetDiagnostics(enabled)
+
+				return nil
+			},
+		},
+		{
+			Name:        "pci_policy",
+			Description: "Enforce PCI-HSM key usage rules for LMKs in PCI-HSM mode (Y/N)",
+			Get:         func() string { return console.FormatYesNo(srv.PCIPolicy() != nil) },
+			Set: func(value string) error {
+				enabled, err := console.ParseYesNo(value)
+				if err != nil {
+					return err
+				}
+				if !enabled {
+					srv.SetPCIPolicy(nil)
+
+					return nil
+				}
+				rules, err := cfg.PCIPolicyRules()
+				if err != nil {
+					return err
+				}
+				policy, err := pcipolicy.New(rules, pciMode)
+				if err != nil {
+					return fmt.Errorf("invalid PCI policy configuration: %v", err)
+				}
+				srv.SetPCIPolicy(policy)
+
+				return nil
+			},
+		},
+		{
+			Name:        "max_message_size",
+			Description: "Largest command accepted in bytes, 0 for the frame maximum",
+			Get:         func() string { return strconv.Itoa(srv.MaxMessageSize()) },
+			Set: func(value string) error {
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 0 {
+					return fmt.Errorf("invalid size %q", value)
+				}
+				srv.SetMaxMessageSize(n)
+
+				return nil
+			},
+		},
+		{
+			Name:        "rate_limit",
+			Description: "Per-client rate limits; commands allowed/refused since startup",
+			Get: func() string {
+				limiter := srv.RateLimits()
+				if limiter == nil {
+					return "N"
+				}
+				stats := limiter.Stats()
+
+				return fmt.Sprintf("Y %d/%d", stats.Allowed, stats.RateLimited+stats.InFlightLimited)
+			},
+		},
+		{
+			Name:        "authorized_state",
+			Description: "Refuse sensitive host commands outside the authorized state (Y/N)",
+			Get:         func() string { return console.FormatYesNo(cfg.Authorized.Enabled) },
+		},
+	}
+}
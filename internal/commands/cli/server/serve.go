@@ -3,15 +3,29 @@ package server
 
 import (
 	"context"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
+	"github.com/andrei-cloud/go_hsm/internal/audit"
+	"github.com/andrei-cloud/go_hsm/internal/authstate"
 	"github.com/andrei-cloud/go_hsm/internal/config"
+	"github.com/andrei-cloud/go_hsm/internal/faults"
+	"github.com/andrei-cloud/go_hsm/internal/hapair"
 	"github.com/andrei-cloud/go_hsm/internal/hsm"
+	"github.com/andrei-cloud/go_hsm/internal/hsm/logic"
+	"github.com/andrei-cloud/go_hsm/internal/lmkstore"
+	"github.com/andrei-cloud/go_hsm/internal/pcipolicy"
+	"github.com/andrei-cloud/go_hsm/internal/pintries"
 	"github.com/andrei-cloud/go_hsm/internal/plugins"
+	"github.com/andrei-cloud/go_hsm/internal/profiling"
+	"github.com/andrei-cloud/go_hsm/internal/ratelimit"
+	"github.com/andrei-cloud/go_hsm/internal/secrets"
 	"github.com/andrei-cloud/go_hsm/internal/server"
 	"github.com/andrei-cloud/go_hsm/pkg/common"
 	"github.com/rs/zerolog/log"
@@ -19,22 +33,58 @@ import (
 	"github.com/spf13/viper"
 )
 
+// maxFrameSize is the largest command a frame can carry: the 2-byte frame length less the
+// 4-byte task ID.
+const maxFrameSize = 65535 - 4
+
 // NewServeCommand creates the serve command.
 func NewServeCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "serve",
 		Short: "Start the HSM server",
-		Long:  `Start the Hardware Security Module (HSM) server to process cryptographic commands over TCP.`,
-		RunE:  runServe,
+		Long: `Start the Hardware Security Module (HSM) server to process cryptographic commands over TCP.
+
+With --stdio the server reads length-framed requests from stdin and writes the responses
+to stdout instead of listening on TCP, so it can run under inetd or as a subprocess of a
+test. Logs go to stderr in this mode.`,
+		RunE: runServe,
 	}
 
 	// Add serve command specific flags that can override config.
 	cmd.Flags().String("host", "localhost", "Server host")
 	cmd.Flags().Int("port", 1500, "Server port")
+	cmd.Flags().Bool("diagnostics", false, "Append internal error reasons to error responses")
+	cmd.Flags().Bool("faults", false, "Enable fault injection rules from the configuration")
+	cmd.Flags().Bool("pin-tries", false, "Enable PIN try limits from the configuration")
+	cmd.Flags().Bool("rate-limit", false, "Enable per-client rate limits from the configuration")
+	cmd.Flags().Bool("pci", false, "Override the configured PCI-HSM compliance mode of all variant LMKs")
+	cmd.Flags().String("plugin-engine", plugins.EngineAuto, "WASM engine of plugins (auto, compiler, interpreter)")
+	cmd.Flags().Duration("keepalive", 30*time.Second, "TCP keepalive period (negative disables)")
+	cmd.Flags().String("health-command", "", "Command code answered by the server core for health checks")
+	cmd.Flags().Int("header-length", 4, "Message header length configured in the clients (4-255)")
+	cmd.Flags().String("profile", "", "Record command profiles to this report file (.csv or pprof)")
+	cmd.Flags().Bool("stdio", false, "Serve length-framed requests on stdin/stdout instead of TCP")
+	cmd.Flags().String("console", "", "Listen address of the payShield console emulation")
+	cmd.Flags().String("ha-role", "", "HA pair role (primary, standby)")
+	cmd.Flags().String("ha-listen", "", "HA replication listen address")
+	cmd.Flags().String("ha-peer", "", "HA replication address of the primary (standby only)")
 
 	// Bind serve command flags to viper.
 	_ = viper.BindPFlag("server.host", cmd.Flags().Lookup("host"))
 	_ = viper.BindPFlag("server.port", cmd.Flags().Lookup("port"))
+	_ = viper.BindPFlag("server.diagnostics", cmd.Flags().Lookup("diagnostics"))
+	_ = viper.BindPFlag("server.keepalive", cmd.Flags().Lookup("keepalive"))
+	_ = viper.BindPFlag("server.health_command", cmd.Flags().Lookup("health-command"))
+	_ = viper.BindPFlag("server.header_length", cmd.Flags().Lookup("header-length"))
+	_ = viper.BindPFlag("server.profile", cmd.Flags().Lookup("profile"))
+	_ = viper.BindPFlag("server.console", cmd.Flags().Lookup("console"))
+	_ = viper.BindPFlag("plugin.runtime.engine", cmd.Flags().Lookup("plugin-engine"))
+	_ = viper.BindPFlag("faults.enabled", cmd.Flags().Lookup("faults"))
+	_ = viper.BindPFlag("pin_tries.enabled", cmd.Flags().Lookup("pin-tries"))
+	_ = viper.BindPFlag("rate_limit.enabled", cmd.Flags().Lookup("rate-limit"))
+	_ = viper.BindPFlag("ha.role", cmd.Flags().Lookup("ha-role"))
+	_ = viper.BindPFlag("ha.listen", cmd.Flags().Lookup("ha-listen"))
+	_ = viper.BindPFlag("ha.peer", cmd.Flags().Lookup("ha-peer"))
 
 	return cmd
 }
@@ -50,27 +100,100 @@ func runServe(cmd *cobra.Command, _ []string) error {
 	logFormat = strings.TrimSpace(strings.ToLower(logFormat))
 
 	// Initialize logger using config values (with CLI flags overriding config via viper).
-	common.InitLogger(
+	// Stdout carries responses in stdio mode, so logs go to stderr.
+	stdio, _ := cmd.Flags().GetBool("stdio")
+	logOut := os.Stdout
+	if stdio {
+		logOut = os.Stderr
+	}
+	common.InitLoggerTo(
+		logOut,
 		logLevel == "debug",
 		logFormat == "human",
 	)
 
+	// Register the active LMKs of the LMK store.
+	lmkStore, err := loadLMKStore(cfg.LMK.Store)
+	if err != nil {
+		return err
+	}
+
+	// Apply the PCI-HSM compliance mode of each variant LMK; --pci overrides the configuration.
+	pciOverride, _ := cmd.Flags().GetBool("pci")
+	pciMode := func(id string) bool {
+		if cmd.Flags().Changed("pci") {
+			return pciOverride
+		}
+
+		return cfg.PCIMode(id)
+	}
+	for id, engine := range logic.LMKRegistry {
+		if engine.GetLMKType() == logic.LMKTypeVariant {
+			if err := logic.SetVariantPCIMode(id, pciMode(id)); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Load key block LMKs held in external secret managers.
+	for _, secret := range cfg.LMK.Secrets {
+		if stdio && secret.Source == "shamir" && strings.Contains(secret.Ref, secrets.ShamirConsole) {
+			return fmt.Errorf("LMK %s: console share entry is not available with --stdio", secret.ID)
+		}
+		lmk, err := secret.Resolve(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("failed to load LMK from secret manager: %v", err)
+		}
+		if err := logic.RegisterKeyBlockLMK(secret.ID, hex.EncodeToString(lmk)); err != nil {
+			return fmt.Errorf("failed to register LMK %s: %v", secret.ID, err)
+		}
+		log.Info().Str("lmk_id", secret.ID).Str("source", secret.Source).Msg("LMK loaded from secret manager")
+	}
+
+	// Apply the test or live designation of each LMK.
+	for id := range logic.LMKRegistry {
+		if err := logic.SetLMKTest(id, cfg.TestLMK(id)); err != nil {
+			return err
+		}
+		if cfg.TestLMK(id) {
+			log.Warn().Str("lmk_id", id).Msg("LMK designated as test LMK")
+		}
+	}
+
 	// Initialize the HSM instance.
-	hsmInstance, err := hsm.NewHSM(hsm.FirmwareVersion, false)
+	hsmInstance, err := hsm.NewHSM(hsm.FirmwareVersion, pciMode(defaultVariantLMKID))
 	if err != nil {
 		return fmt.Errorf("failed to initialize HSM instance: %v", err)
 	}
+	if lmk, err := lmkStore.Get(defaultVariantLMKID); err == nil &&
+		lmk.Status == lmkstore.StatusActive && lmk.Type == lmkstore.TypeVariant {
+		if hsmInstance.VariantLmkSet, err = lmkStore.VariantSet(defaultVariantLMKID); err != nil {
+			return fmt.Errorf("failed to load variant LMK %s: %v", defaultVariantLMKID, err)
+		}
+	}
 
 	// Make sure plugin directory exists.
 	if err := os.MkdirAll(cfg.Plugin.Path, 0o755); err != nil {
 		return fmt.Errorf("failed to create plugin directory: %v", err)
 	}
 
+	// Validate decimalization profiles before passing them to plugins.
+	if err := logic.ConfigureDecimalization(cfg.Decimalization); err != nil {
+		return fmt.Errorf("invalid decimalization configuration: %v", err)
+	}
+
 	// Initialize the PluginManager with HSM instance.
 	pluginManager := plugins.NewPluginManager(
 		cmd.Context(),
 		hsmInstance,
 	)
+	pluginManager.SetEnv(logic.DecimalizationEnv, cfg.Decimalization)
+	if err := pluginManager.SetPoolConfig(cfg.Plugin.Pool, cfg.Plugin.Pools); err != nil {
+		return fmt.Errorf("invalid plugin pool configuration: %v", err)
+	}
+	if err := pluginManager.SetRuntimeConfig(cfg.Plugin.Runtime); err != nil {
+		return fmt.Errorf("invalid plugin runtime configuration: %v", err)
+	}
 
 	// Load plugins from the configured directory.
 	if err := pluginManager.LoadAll(cfg.Plugin.Path); err != nil {
@@ -88,17 +211,161 @@ func runServe(cmd *cobra.Command, _ []string) error {
 			Msg("plugin details")
 	}
 
-	// Initialize the server with configured host and port.
-	serverAddr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
-	srv, err := server.NewServer(serverAddr, pluginManager)
-	if err != nil {
-		return fmt.Errorf("failed to initialize server: %v", err)
+	// Initialize the server with configured host and port, or on stdin/stdout.
+	var srv *server.Server
+	if stdio {
+		srv = server.NewStreamServer(pluginManager)
+	} else {
+		serverAddr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
+		opts := server.Options{
+			KeepAlive:   cfg.Server.KeepAlive,
+			IdleTimeout: cfg.Server.IdleTimeout,
+		}
+		if cmd.Flags().Changed("keepalive") {
+			opts.KeepAlive = viper.GetDuration("server.keepalive")
+		}
+		if srv, err = server.NewServerWithOptions(serverAddr, pluginManager, opts); err != nil {
+			return fmt.Errorf("failed to initialize server: %v", err)
+		}
+	}
+	if cfg.Server.MaxMessageSize < 0 || cfg.Server.MaxMessageSize > maxFrameSize {
+		return fmt.Errorf("max message size %d must be between 0 and %d bytes",
+			cfg.Server.MaxMessageSize, maxFrameSize)
+	}
+	srv.SetMaxMessageSize(cfg.Server.MaxMessageSize)
+	headerLength := cfg.Server.HeaderLength
+	if cmd.Flags().Changed("header-length") {
+		headerLength = viper.GetInt("server.header_length")
+	}
+	if err := srv.SetHeaderLength(headerLength); err != nil {
+		return err
+	}
+	srv.SetTrailer(cfg.Server.Trailer)
+	healthCommand := cfg.Server.HealthCommand
+	if cmd.Flags().Changed("health-command") {
+		healthCommand = viper.GetString("server.health_command")
+	}
+	if healthCommand != "" {
+		if len(healthCommand) != 2 {
+			return fmt.Errorf("health check command %q must be a 2-character code", healthCommand)
+		}
+		srv.SetHealthCommand(healthCommand)
+		log.Info().Str("command", healthCommand).Msg("health check command enabled")
+	}
+	diagnostics := cfg.Server.Diagnostics || viper.GetBool("server.diagnostics")
+	srv.SetDiagnostics(diagnostics)
+	if diagnostics {
+		log.Warn().Msg("diagnostic mode enabled: error responses include internal details")
+	}
+	if cfg.Faults.Enabled || viper.GetBool("faults.enabled") {
+		injector, err := faults.New(cfg.Faults.Rules, cfg.Faults.Seed)
+		if err != nil {
+			return fmt.Errorf("invalid fault injection configuration: %v", err)
+		}
+		srv.SetFaults(injector)
+		log.Warn().Int("rules", len(cfg.Faults.Rules)).Msg("fault injection enabled")
+	}
+	if cfg.PCIPolicy.Enabled || viper.GetBool("pci_policy.enabled") {
+		rules, err := cfg.PCIPolicyRules()
+		if err != nil {
+			return err
+		}
+		policy, err := pcipolicy.New(rules, pciMode)
+		if err != nil {
+			return fmt.Errorf("invalid PCI policy configuration: %v", err)
+		}
+		srv.SetPCIPolicy(policy)
+		log.Info().Str("file", cfg.PCIPolicy.File).Msg("PCI-HSM key usage enforcement enabled")
+	}
+	// The counters of the instance are kept in the state replicated to the standby of an HA
+	// pair.
+	haCfg := haConfig(cfg)
+	counters := hapair.NewState(cfg.Keystore.Path)
+	if haCfg.Role != "" {
+		srv.SetDUKPTCounters(counters)
+	}
+	if cfg.PINTries.Enabled || viper.GetBool("pin_tries.enabled") {
+		tracker, err := pintries.New(cfg.PINTries.Rules, cfg.PINTries.ErrorCode, counters)
+		if err != nil {
+			return fmt.Errorf("invalid PIN tries configuration: %v", err)
+		}
+		resetCommand := cfg.PINTries.ResetCommand
+		if resetCommand != "" && len(resetCommand) != 2 {
+			return fmt.Errorf("PIN tries reset command %q must be a 2-character code", resetCommand)
+		}
+		srv.SetPINTries(tracker)
+		srv.SetPINTriesResetCommand(resetCommand)
+		log.Warn().
+			Int("rules", len(cfg.PINTries.Rules)).
+			Str("reset_command", resetCommand).
+			Msg("PIN try limits enabled")
+	}
+	if cfg.RateLimit.Enabled || viper.GetBool("rate_limit.enabled") {
+		limiter, err := ratelimit.New(cfg.RateLimit.Limits)
+		if err != nil {
+			return fmt.Errorf("invalid rate limit configuration: %v", err)
+		}
+		srv.SetRateLimits(limiter)
+		defer logRateLimitStats(limiter)
+		log.Info().
+			Float64("rate", cfg.RateLimit.Rate).
+			Int("burst", cfg.RateLimit.Burst).
+			Int("max_in_flight", cfg.RateLimit.MaxInFlight).
+			Msg("per-client rate limits enabled")
+	}
+	if cfg.Audit.Path != "" {
+		auditLog, err := audit.Open(cfg.Audit.Path)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = auditLog.Close()
+		}()
+		srv.SetAuditLog(auditLog)
+		log.Info().Str("file", cfg.Audit.Path).Msg("audit log enabled")
+	}
+	if cfg.Authorized.Enabled {
+		if err := configureAuthorization(srv, hsmInstance, cfg); err != nil {
+			return err
+		}
+	}
+
+	profilePath := cfg.Server.Profile
+	if cmd.Flags().Changed("profile") {
+		profilePath = viper.GetString("server.profile")
+	}
+	if profilePath != "" {
+		profiler := profiling.New()
+		srv.SetProfiler(profiler)
+		stopProfile := dumpProfileOnSignal(profiler, profilePath)
+		defer stopProfile()
+		log.Info().Str("report", profilePath).Msg("command profiling enabled; SIGUSR1 writes the report")
+	}
+
+	// In stdio mode the server runs until stdin is closed.
+	if stdio {
+		return srv.ServeStream(os.Stdin, os.Stdout)
+	}
+
+	for _, l := range cfg.Server.Listeners {
+		if err := srv.AddListener(l); err != nil {
+			return err
+		}
 	}
 
 	// Create a context that will be canceled when the server is stopping.
 	ctx, cancel := context.WithCancel(cmd.Context())
 	defer cancel()
 
+	if err := startHA(ctx, haCfg, counters, cfg.Audit.Path); err != nil {
+		return err
+	}
+	if addr := settingOr(cfg.Server.Console, "server.console"); addr != "" {
+		if err := startConsole(ctx, addr, srv, hsmInstance, cfg, pciMode); err != nil {
+			return err
+		}
+	}
+
 	// Reload plugins on SIGHUP.
 	reloadChan := make(chan os.Signal, 1)
 	signal.Notify(reloadChan, syscall.SIGHUP)
@@ -108,6 +375,10 @@ func runServe(cmd *cobra.Command, _ []string) error {
 
 			// Create new plugin manager.
 			newPM := plugins.NewPluginManager(ctx, hsmInstance)
+			newPM.SetEnv(logic.DecimalizationEnv, cfg.Decimalization)
+			// the configuration was validated at startup.
+			_ = newPM.SetPoolConfig(cfg.Plugin.Pool, cfg.Plugin.Pools)
+			_ = newPM.SetRuntimeConfig(cfg.Plugin.Runtime)
 			if err := newPM.LoadAll(cfg.Plugin.Path); err != nil {
 				log.Error().Err(err).Msg("failed to reload plugins")
 				continue
@@ -149,3 +420,179 @@ func runServe(cmd *cobra.Command, _ []string) error {
 
 	return nil
 }
+
+// logRateLimitStats logs the commands accepted and refused by limiter.
+func logRateLimitStats(limiter *ratelimit.Limiter) {
+	stats := limiter.Stats()
+	log.Info().
+		Uint64("allowed", stats.Allowed).
+		Uint64("rate_limited", stats.RateLimited).
+		Uint64("in_flight_limited", stats.InFlightLimited).
+		Msg("rate limit statistics")
+}
+
+// dumpProfileOnSignal writes the profile report to path on SIGUSR1, where the platform has
+// it, and returns a function that stops listening and writes the final report.
+func dumpProfileOnSignal(profiler *profiling.Profiler, path string) func() {
+	write := func() {
+		if err := profiler.WriteFile(path); err != nil {
+			log.Error().Err(err).Msg("failed to write profile report")
+
+			return
+		}
+		log.Info().Str("report", path).Msg("profile report written")
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	if profileSignal != nil {
+		signal.Notify(sigChan, profileSignal)
+	}
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-sigChan:
+				write()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigChan)
+		close(done)
+		write()
+	}
+}
+
+// haConfig returns the HA pair configuration of the instance, with an empty role when the
+// instance is not a member of a pair.
+func haConfig(cfg *config.Config) hapair.Config {
+	return hapair.Config{
+		Role:            hapair.Role(strings.ToLower(settingOr(cfg.HA.Role, "ha.role"))),
+		Listen:          settingOr(cfg.HA.Listen, "ha.listen"),
+		Peer:            settingOr(cfg.HA.Peer, "ha.peer"),
+		Interval:        cfg.HA.Interval,
+		FailoverTimeout: cfg.HA.FailoverTimeout,
+	}
+}
+
+// startHA starts the replication of state when the instance is a member of an HA pair, and
+// records the promotion of a standby in the audit log at auditPath.
+func startHA(ctx context.Context, haCfg hapair.Config, state *hapair.State, auditPath string) error {
+	if haCfg.Role == "" {
+		return nil
+	}
+
+	node, err := hapair.NewNode(haCfg, state)
+	if err != nil {
+		return fmt.Errorf("invalid ha configuration: %v", err)
+	}
+	node.OnPromote = func() {
+		err := audit.Append(auditPath, audit.EventHAPromoted, map[string]string{
+			"peer":   haCfg.Peer,
+			"listen": haCfg.Listen,
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("failed to record ha promotion")
+		}
+		log.Warn().Str("listen", haCfg.Listen).Msg("serving as primary with the replicated state")
+	}
+	go func() {
+		if err := node.Run(ctx); err != nil {
+			log.Error().Err(err).Msg("ha replication stopped")
+		}
+	}()
+	log.Info().Str("role", string(haCfg.Role)).Msg("ha pair member started")
+
+	return nil
+}
+
+// defaultVariantLMKID is the variant LMK used by plugin host functions.
+const defaultVariantLMKID = "00"
+
+// configureAuthorization gates sensitive host commands behind the authorized state of the
+// HSM, which authorized.until enters for every registered LMK.
+func configureAuthorization(srv *server.Server, h *hsm.HSM, cfg *config.Config) error {
+	rules := cfg.Authorized.HostRules
+	if rules.Password == "" {
+		rules.Password = os.Getenv(authstate.PasswordEnv)
+	}
+	gate, err := authstate.NewHost(rules, h.Authorization)
+	if err != nil {
+		return fmt.Errorf("invalid authorized state configuration: %v", err)
+	}
+
+	if cfg.Authorized.Until != "" {
+		err := authstate.Gate{Until: cfg.Authorized.Until}.Check(time.Now())
+		switch {
+		case errors.Is(err, authstate.ErrExpired):
+			log.Warn().Err(err).Msg("configured authorized state has expired")
+		case err != nil:
+			return err
+		default:
+			until, _ := time.Parse(time.RFC3339, cfg.Authorized.Until)
+			for _, id := range logic.RegisteredLMKIDs() {
+				h.Authorization.Enter(id, until)
+			}
+			log.Warn().Time("until", until).Msg("LMKs in authorized state")
+		}
+	}
+
+	srv.SetAuthorization(gate)
+	enter, cancel := gate.Commands()
+	log.Info().
+		Str("enter_command", enter).
+		Str("cancel_command", cancel).
+		Msg("authorized state enforced for host commands")
+
+	return nil
+}
+
+// loadLMKStore opens the LMK store at path and registers its active LMKs and the old LMKs
+// of key change storage. The store is unlocked with the passphrase or KEK from the
+// environment only when it has active or old LMKs.
+func loadLMKStore(path string) (*lmkstore.Store, error) {
+	store, err := lmkstore.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	active := false
+	for _, lmk := range store.List() {
+		active = active || lmk.Status == lmkstore.StatusActive
+	}
+	if !active && len(store.ListOld()) == 0 {
+		return store, nil
+	}
+
+	if err := store.UnlockWith(os.Getenv(lmkstore.PassphraseEnv), os.Getenv(lmkstore.KEKEnv)); err != nil {
+		return nil, fmt.Errorf("failed to unlock LMK store %s (set %s or %s): %v",
+			path, lmkstore.PassphraseEnv, lmkstore.KEKEnv, err)
+	}
+	ids, err := lmkstore.Register(store)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register LMKs from %s: %v", path, err)
+	}
+	for _, id := range ids {
+		log.Info().Str("lmk_id", id).Str("store", path).Msg("LMK loaded from LMK store")
+	}
+	oldIDs, err := lmkstore.RegisterOld(store)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register old LMKs from %s: %v", path, err)
+	}
+	for _, id := range oldIDs {
+		log.Info().Str("lmk_id", id).Str("store", path).Msg("Old LMK loaded into key change storage")
+	}
+
+	return store, nil
+}
+
+// settingOr returns the command line override bound to key, or value when none is set.
+func settingOr(value, key string) string {
+	if v := viper.GetString(key); v != "" {
+		return v
+	}
+
+	return value
+}
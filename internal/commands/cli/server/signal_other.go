@@ -0,0 +1,9 @@
+//go:build !unix
+
+package server
+
+import "os"
+
+// profileSignal is nil where there is no SIGUSR1: the profile report is only written at
+// shutdown.
+var profileSignal os.Signal
@@ -0,0 +1,11 @@
+//go:build unix
+
+package server
+
+import (
+	"os"
+	"syscall"
+)
+
+// profileSignal requests a profile report.
+var profileSignal os.Signal = syscall.SIGUSR1
@@ -0,0 +1,113 @@
+// Package soak provides the plugin runtime soak test command.
+package soak
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/andrei-cloud/go_hsm/internal/config"
+	"github.com/andrei-cloud/go_hsm/internal/hsm"
+	"github.com/andrei-cloud/go_hsm/internal/plugins"
+	"github.com/andrei-cloud/go_hsm/internal/soak"
+	"github.com/spf13/cobra"
+)
+
+// NewSoakCommand creates the soak command.
+func NewSoakCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "soak",
+		Short: "Run a command mix against the plugins for hours and watch memory",
+		Long: `Load the WASM plugins in process and run a command mix against them for a long
+period. Every interval the WASM memory of each plugin instance pool, the buffer pool
+statistics and the Go heap and GC metrics are logged. The command fails when memory grows
+beyond --max-growth-mb over the baseline taken after the warm-up, so it can prove or rule
+out slow leaks in instance pooling. Interrupting the run ends it early.
+
+Mix entries have the form [weight*]CODE[:payload], for example --mix 3*NC --mix A0:0002U.
+Without --mix a default mix of NC and A0 key generation is used.`,
+		RunE: runSoak,
+	}
+
+	cmd.Flags().String("plugin-dir", "plugins", "Directory holding the WASM plugins")
+	cmd.Flags().StringArray("mix", nil, "Command mix entry [weight*]CODE[:payload] (repeatable)")
+	cmd.Flags().Duration("duration", time.Hour, "Length of the run")
+	cmd.Flags().Duration("interval", time.Minute, "Time between memory samples")
+	cmd.Flags().Duration("warmup", 5*time.Minute, "Time before the baseline sample")
+	cmd.Flags().Int("workers", 4, "Number of concurrent clients")
+	cmd.Flags().Uint64("max-growth-mb", 64, "Allowed memory growth over the baseline in MiB (0 disables the check)")
+
+	return cmd
+}
+
+func runSoak(cmd *cobra.Command, _ []string) error {
+	pluginDir, _ := cmd.Flags().GetString("plugin-dir")
+	entries, _ := cmd.Flags().GetStringArray("mix")
+	duration, _ := cmd.Flags().GetDuration("duration")
+	interval, _ := cmd.Flags().GetDuration("interval")
+	warmup, _ := cmd.Flags().GetDuration("warmup")
+	workers, _ := cmd.Flags().GetInt("workers")
+	maxGrowth, _ := cmd.Flags().GetUint64("max-growth-mb")
+
+	var mix []soak.Op
+	for _, e := range entries {
+		op, err := soak.ParseOp(e)
+		if err != nil {
+			return err
+		}
+		mix = append(mix, op)
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+	defer stop()
+
+	hsmInst, err := hsm.NewHSM(hsm.FirmwareVersion, false)
+	if err != nil {
+		return fmt.Errorf("failed to create HSM instance: %w", err)
+	}
+	pluginManager := plugins.NewPluginManager(ctx, hsmInst)
+	defer func() {
+		_ = pluginManager.Close()
+	}()
+	// size the pools and the runtime as the server does, so the memory measured matches.
+	cfg := config.Get()
+	if err := pluginManager.SetPoolConfig(cfg.Plugin.Pool, cfg.Plugin.Pools); err != nil {
+		return fmt.Errorf("invalid plugin pool configuration: %w", err)
+	}
+	if err := pluginManager.SetRuntimeConfig(cfg.Plugin.Runtime); err != nil {
+		return fmt.Errorf("invalid plugin runtime configuration: %w", err)
+	}
+	if err := pluginManager.LoadAll(pluginDir); err != nil {
+		return fmt.Errorf("failed to load plugins: %w", err)
+	}
+
+	report, err := soak.Run(ctx, pluginManager, soak.Config{
+		Mix:       mix,
+		Duration:  duration,
+		Interval:  interval,
+		Warmup:    warmup,
+		Workers:   workers,
+		MaxGrowth: maxGrowth << 20,
+	})
+
+	out := cmd.OutOrStdout()
+	if n := len(report.Samples); n > 0 {
+		last := report.Samples[n-1]
+		_, _ = fmt.Fprintf(out, "Elapsed: %s\n", last.Elapsed.Round(time.Second))
+		_, _ = fmt.Fprintf(out, "Requests: %d (errors: %d)\n", last.Requests, last.Errors)
+		_, _ = fmt.Fprintf(out, "Memory: baseline %d, last %d, peak %d bytes (growth %d)\n",
+			report.Baseline.Memory(), last.Memory(), report.Peak, report.Growth())
+		for code, pool := range last.Runtime.Pools {
+			_, _ = fmt.Fprintf(out, "Pool %s: %d instances (%d idle, %d created, %d dropped), %d bytes\n",
+				code, pool.Instances, pool.Idle, pool.Created, pool.Dropped, pool.MemoryBytes)
+		}
+	}
+
+	if errors.Is(err, soak.ErrMemoryGrowth) {
+		return fmt.Errorf("soak test failed: %w", err)
+	}
+
+	return err
+}
@@ -0,0 +1,2 @@
+//go:generate plugingen -cmd=A6 -logic=github.com/andrei-cloud/go_hsm/internal/hsm/logic -version=1.0.0 -desc "Import a key from ZMK to LMK" -author "Andrey Babikov" -out=.
+package main
@@ -0,0 +1,2 @@
+//go:generate plugingen -cmd=A8 -logic=github.com/andrei-cloud/go_hsm/internal/hsm/logic -version=1.0.0 -desc "Export a key from LMK to ZMK" -author "Andrey Babikov" -out=.
+package main
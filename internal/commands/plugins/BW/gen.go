@@ -0,0 +1,2 @@
+//go:generate plugingen -cmd=BW -logic=github.com/andrei-cloud/go_hsm/internal/hsm/logic -version=1.0.0 -desc "Translate keys from old LMK to new LMK" -author "Andrey Babikov" -out=.
+package main
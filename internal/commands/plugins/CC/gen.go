@@ -0,0 +1,2 @@
+//go:generate plugingen -cmd=CC -logic=github.com/andrei-cloud/go_hsm/internal/hsm/logic -version=1.0.0 -desc "Translate a ZPK from ZMK to LMK" -author "Andrey Babikov" -out=.
+package main
@@ -0,0 +1,2 @@
+//go:generate plugingen -cmd=CI -logic=github.com/andrei-cloud/go_hsm/internal/hsm/logic -version=1.0.0 -desc "Translate a DUKPT PIN block to a ZPK" -author "Andrey Babikov" -out=.
+package main
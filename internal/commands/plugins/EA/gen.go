@@ -0,0 +1,2 @@
+//go:generate plugingen -cmd=EA -logic=github.com/andrei-cloud/go_hsm/internal/hsm/logic -version=1.0.0 -desc "Verify an interchange PIN using the IBM method" -author "Andrey Babikov" -out=.
+package main
@@ -0,0 +1,2 @@
+//go:generate plugingen -cmd=EI -logic=github.com/andrei-cloud/go_hsm/internal/hsm/logic -version=1.0.0 -desc "Generate an RSA key pair with the private key under the LMK or in a key block" -author "Andrey Babikov" -out=.
+package main
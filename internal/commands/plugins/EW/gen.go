@@ -0,0 +1,2 @@
+//go:generate plugingen -cmd=EW -logic=github.com/andrei-cloud/go_hsm/internal/hsm/logic -version=1.0.0 -desc "Generate an RSA signature with a private key under the LMK" -author "Andrey Babikov" -out=.
+package main
@@ -0,0 +1,2 @@
+//go:generate plugingen -cmd=EY -logic=github.com/andrei-cloud/go_hsm/internal/hsm/logic -version=1.0.0 -desc "Verify an RSA signature with a public key" -author "Andrey Babikov" -out=.
+package main
@@ -0,0 +1,2 @@
+//go:generate plugingen -cmd=GC -logic=github.com/andrei-cloud/go_hsm/internal/hsm/logic -version=1.0.0 -desc "Generate ZMK components" -author "Andrey Babikov" -out=.
+package main
@@ -0,0 +1,2 @@
+//go:generate plugingen -cmd=GI -logic=github.com/andrei-cloud/go_hsm/internal/hsm/logic -version=1.0.0 -desc "Import a key encrypted under an RSA public key (PKCS#1 v1.5 or OAEP) to the LMK" -author "Andrey Babikov" -out=.
+package main
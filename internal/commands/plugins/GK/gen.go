@@ -0,0 +1,2 @@
+//go:generate plugingen -cmd=GK -logic=github.com/andrei-cloud/go_hsm/internal/hsm/logic -version=1.0.0 -desc "Export a key under an RSA public key (PKCS#1 v1.5 or OAEP) for remote key loading" -author "Andrey Babikov" -out=.
+package main
@@ -0,0 +1,2 @@
+//go:generate plugingen -cmd=GS -logic=github.com/andrei-cloud/go_hsm/internal/hsm/logic -version=1.0.0 -desc "Derive a DUKPT initial key from a BDK" -author "Andrey Babikov" -out=.
+package main
@@ -0,0 +1,2 @@
+//go:generate plugingen -cmd=GY -logic=github.com/andrei-cloud/go_hsm/internal/hsm/logic -version=1.0.0 -desc "Form a ZMK from clear components" -author "Andrey Babikov" -out=.
+package main
@@ -0,0 +1,2 @@
+//go:generate plugingen -cmd=JA -logic=github.com/andrei-cloud/go_hsm/internal/hsm/logic -version=1.0.0 -desc "Translate a PIN with key block PIN keys" -author "Andrey Babikov" -out=.
+package main
@@ -0,0 +1,2 @@
+//go:generate plugingen -cmd=JC -logic=github.com/andrei-cloud/go_hsm/internal/hsm/logic -version=1.0.0 -desc "Verify a PIN using the Visa PVV with key block keys" -author "Andrey Babikov" -out=.
+package main
@@ -0,0 +1,2 @@
+//go:generate plugingen -cmd=KC -logic=github.com/andrei-cloud/go_hsm/internal/hsm/logic -version=1.0.0 -desc "MAC on Component Check Values" -author "Andrey Babikov" -out=.
+package main
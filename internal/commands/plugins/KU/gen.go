@@ -0,0 +1,2 @@
+//go:generate plugingen -cmd=KU -logic=github.com/andrei-cloud/go_hsm/internal/hsm/logic -version=1.0.0 -desc "Generate Secure Message" -author "Andrey Babikov" -out=.
+package main
@@ -0,0 +1,2 @@
+//go:generate plugingen -cmd=KW -logic=github.com/andrei-cloud/go_hsm/internal/hsm/logic -version=1.0.0 -desc "ARQC verification and/or ARPC generation with a key block MK-AC" -author "Andrey Babikov" -out=.
+package main
@@ -0,0 +1,2 @@
+//go:generate plugingen -cmd=M6 -logic=github.com/andrei-cloud/go_hsm/internal/hsm/logic -version=1.0.0 -desc "Generate AES CMAC with key block TAK" -author "Andrey Babikov" -out=.
+package main
@@ -0,0 +1,2 @@
+//go:generate plugingen -cmd=M8 -logic=github.com/andrei-cloud/go_hsm/internal/hsm/logic -version=1.0.0 -desc "Verify AES CMAC with key block TAK" -author "Andrey Babikov" -out=.
+package main
@@ -0,0 +1,2 @@
+//go:generate plugingen -cmd=MC -logic=github.com/andrei-cloud/go_hsm/internal/hsm/logic -version=1.0.0 -desc "Verify X9.9/X9.19 MAC" -author "Andrey Babikov" -out=.
+package main
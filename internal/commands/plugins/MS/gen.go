@@ -0,0 +1,2 @@
+//go:generate plugingen -cmd=MS -logic=github.com/andrei-cloud/go_hsm/internal/hsm/logic -version=1.0.0 -desc "Generate a MAC on a large message" -author "Andrey Babikov" -out=.
+package main
@@ -1,2 +1,2 @@
-//go:generate plugingen -cmd=NC -logic=github.com/andrei-cloud/go_hsm/internal/hsm/logic -version=1.0.0 -desc "Perform Diagnostics" -author "Andrey Babikov" -out=.
+//go:generate plugingen -cmd=NC -logic=github.com/andrei-cloud/go_hsm/internal/hsm/logic -version=1.0.1 -desc "Perform Diagnostics" -author "Andrey Babikov" -out=.
 package main
@@ -0,0 +1,2 @@
+//go:generate plugingen -cmd=PV -logic=github.com/andrei-cloud/go_hsm/internal/hsm/logic -version=1.0.0 -desc "PVV Key Index Rollover" -author "Andrey Babikov" -out=.
+package main
@@ -0,0 +1,332 @@
+// Package compat replays a corpus of request/response pairs against the command
+// implementations. Every response must match byte for byte unless an allowlist entry masks
+// the fields of a known deviation. The corpus currently holds regression pairs recorded
+// from this implementation only, so it guards against regressions but does not show
+// compatibility with a payShield; captures from a device are tagged SourcePayShield.
+package compat
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Case sources.
+const (
+	SourcePayShield  = "payshield"  // captured from a payShield 10k
+	SourceRegression = "regression" // recorded from this implementation
+)
+
+// Case is a single request/response pair. Request and response include the two-character
+// command code and are given either as ASCII or, for binary fields, as hex.
+type Case struct {
+	Name        string `json:"name"`
+	Source      string `json:"source"`
+	Request     string `json:"request,omitempty"`
+	RequestHex  string `json:"request_hex,omitempty"`
+	Response    string `json:"response,omitempty"`
+	ResponseHex string `json:"response_hex,omitempty"`
+	Note        string `json:"note,omitempty"`
+}
+
+// Command returns the command code of the request.
+func (c Case) Command() string {
+	req, err := c.RequestBytes()
+	if err != nil || len(req) < 2 {
+		return ""
+	}
+
+	return string(req[:2])
+}
+
+// RequestBytes returns the raw request.
+func (c Case) RequestBytes() ([]byte, error) {
+	return rawField(c.Request, c.RequestHex)
+}
+
+// ResponseBytes returns the raw expected response.
+func (c Case) ResponseBytes() ([]byte, error) {
+	return rawField(c.Response, c.ResponseHex)
+}
+
+// rawField returns the value of a field given as ASCII or hex. Exactly one must be set.
+func rawField(ascii, hexValue string) ([]byte, error) {
+	switch {
+	case ascii != "" && hexValue != "":
+		return nil, errors.New("both ascii and hex values set")
+	case hexValue != "":
+		return hex.DecodeString(hexValue)
+	case ascii != "":
+		return []byte(ascii), nil
+	default:
+		return nil, errors.New("value missing")
+	}
+}
+
+// Span is a byte range of a response.
+type Span struct {
+	Offset int `json:"offset"`
+	Length int `json:"length"`
+}
+
+// Deviation is an allowlist entry for a known difference in the responses to Command. The
+// masked response bytes are ignored and the rest must still match, so every entry names
+// the fields it covers. Case limits the entry to one case name; empty applies it to all
+// cases of Command.
+type Deviation struct {
+	Command string `json:"command"`
+	Case    string `json:"case,omitempty"`
+	Mask    []Span `json:"mask,omitempty"`
+	Reason  string `json:"reason"`
+}
+
+// Allowlist is the set of known deviations.
+type Allowlist []Deviation
+
+// lookup returns the deviation that applies to c, preferring one naming the case.
+func (a Allowlist) lookup(c Case) (Deviation, bool) {
+	var found *Deviation
+	for i := range a {
+		d := &a[i]
+		if d.Command != c.Command() || (d.Case != "" && d.Case != c.Name) {
+			continue
+		}
+		if found == nil || d.Case != "" {
+			found = d
+		}
+	}
+	if found == nil {
+		return Deviation{}, false
+	}
+
+	return *found, true
+}
+
+// Executor runs a request, including its command code, and returns the response.
+type Executor func(request []byte) ([]byte, error)
+
+// Status is the outcome of a case.
+type Status int
+
+// Case outcomes.
+const (
+	StatusMatch     Status = iota // byte-exact response
+	StatusDeviation               // differs only as allowed by the allowlist
+	StatusMismatch                // unexpected difference
+)
+
+// String returns the status name.
+func (s Status) String() string {
+	switch s {
+	case StatusMatch:
+		return "match"
+	case StatusDeviation:
+		return "known deviation"
+	default:
+		return "mismatch"
+	}
+}
+
+// Result is the outcome of one case.
+type Result struct {
+	Case   Case
+	Status Status
+	Got    []byte
+	Want   []byte
+	Reason string
+}
+
+// Report summarizes a run.
+type Report struct {
+	Results []Result
+}
+
+// Mismatches returns the results with unexpected differences.
+func (r Report) Mismatches() []Result {
+	var out []Result
+	for _, res := range r.Results {
+		if res.Status == StatusMismatch {
+			out = append(out, res)
+		}
+	}
+
+	return out
+}
+
+// Count returns the number of results with the given status.
+func (r Report) Count(s Status) int {
+	n := 0
+	for _, res := range r.Results {
+		if res.Status == s {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Run executes every case and compares the responses.
+func Run(cases []Case, allow Allowlist, exec Executor) Report {
+	var report Report
+	for _, c := range cases {
+		report.Results = append(report.Results, runCase(c, allow, exec))
+	}
+
+	return report
+}
+
+// runCase executes and compares a single case.
+func runCase(c Case, allow Allowlist, exec Executor) Result {
+	res := Result{Case: c, Status: StatusMismatch}
+
+	req, err := c.RequestBytes()
+	if err != nil {
+		res.Reason = fmt.Sprintf("invalid request: %v", err)
+
+		return res
+	}
+	res.Want, err = c.ResponseBytes()
+	if err != nil {
+		res.Reason = fmt.Sprintf("invalid response: %v", err)
+
+		return res
+	}
+	res.Got, err = exec(req)
+	if err != nil {
+		res.Reason = fmt.Sprintf("execute: %v", err)
+
+		return res
+	}
+
+	if bytes.Equal(res.Got, res.Want) {
+		res.Status = StatusMatch
+
+		return res
+	}
+
+	dev, ok := allow.lookup(c)
+	if !ok {
+		res.Reason = describeDiff(res.Got, res.Want)
+
+		return res
+	}
+	if !maskedEqual(res.Got, res.Want, dev.Mask) {
+		res.Reason = describeDiff(res.Got, res.Want) + " outside allowed mask"
+
+		return res
+	}
+	res.Status = StatusDeviation
+	res.Reason = dev.Reason
+
+	return res
+}
+
+// maskedEqual compares got and want ignoring the masked bytes. The lengths must match.
+func maskedEqual(got, want []byte, mask []Span) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] == want[i] {
+			continue
+		}
+		if !slices.ContainsFunc(mask, func(s Span) bool {
+			return i >= s.Offset && i < s.Offset+s.Length
+		}) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// describeDiff reports the first differing offset.
+func describeDiff(got, want []byte) string {
+	n := min(len(got), len(want))
+	i := 0
+	for i < n && got[i] == want[i] {
+		i++
+	}
+
+	return fmt.Sprintf("first difference at offset %d (got %d bytes, want %d)", i, len(got), len(want))
+}
+
+// LoadCorpus reads every *.jsonl file in dir. Each non-empty line is a Case; lines
+// starting with '#' are comments.
+func LoadCorpus(dir string) ([]Case, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(files)
+
+	var cases []Case
+	for _, file := range files {
+		fileCases, err := loadCorpusFile(file)
+		if err != nil {
+			return nil, err
+		}
+		cases = append(cases, fileCases...)
+	}
+
+	return cases, nil
+}
+
+// loadCorpusFile reads the cases of a single corpus file.
+func loadCorpusFile(path string) ([]Case, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var cases []Case
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		var c Case
+		if err := json.Unmarshal([]byte(text), &c); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if c.Name == "" {
+			return nil, fmt.Errorf("%s:%d: case name missing", path, line)
+		}
+		if c.Source != SourcePayShield && c.Source != SourceRegression {
+			return nil, fmt.Errorf("%s:%d: unknown source %q", path, line, c.Source)
+		}
+		cases = append(cases, c)
+	}
+
+	return cases, scanner.Err()
+}
+
+// LoadAllowlist reads a JSON array of deviations.
+func LoadAllowlist(path string) (Allowlist, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var allow Allowlist
+	if err := json.Unmarshal(data, &allow); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, d := range allow {
+		if d.Command == "" || d.Reason == "" || len(d.Mask) == 0 {
+			return nil, fmt.Errorf("%s: entry %d needs a command, a mask and a reason", path, i)
+		}
+	}
+
+	return allow, nil
+}
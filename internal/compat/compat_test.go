@@ -0,0 +1,91 @@
+package compat
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/hsm"
+)
+
+// TestCorpus replays the regression corpus. It replaces the logic LMK provider, so it
+// does not run in parallel.
+func TestCorpus(t *testing.T) {
+	cases, err := LoadCorpus(filepath.Join("testdata", "corpus"))
+	if err != nil {
+		t.Fatalf("LoadCorpus: %v", err)
+	}
+	if len(cases) == 0 {
+		t.Fatal("empty corpus")
+	}
+	allow, err := LoadAllowlist(filepath.Join("testdata", "allowlist.json"))
+	if err != nil {
+		t.Fatalf("LoadAllowlist: %v", err)
+	}
+	h, err := hsm.NewHSM(hsm.FirmwareVersion, false)
+	if err != nil {
+		t.Fatalf("NewHSM: %v", err)
+	}
+
+	report := Run(cases, allow, NewLogicExecutor(h))
+	for _, res := range report.Results {
+		if res.Status == StatusDeviation {
+			t.Logf("%s (%s): known deviation: %s", res.Case.Name, res.Case.Source, res.Reason)
+		}
+	}
+	for _, res := range report.Mismatches() {
+		t.Errorf("%s (%s): %s\n got: %q\nwant: %q",
+			res.Case.Name, res.Case.Source, res.Reason, res.Got, res.Want)
+	}
+}
+
+func TestRunAllowlist(t *testing.T) {
+	t.Parallel()
+
+	echo := func(resp string) Executor {
+		return func([]byte) ([]byte, error) { return []byte(resp), nil }
+	}
+	nc := Case{Name: "nc", Source: SourcePayShield, Request: "NC", Response: "ND00AAAA1500"}
+	allow := Allowlist{
+		{Command: "NC", Mask: []Span{{Offset: 4, Length: 4}}, Reason: "check value"},
+		{Command: "CW", Reason: "no mask"},
+		{Command: "CY", Case: "other", Reason: "other case"},
+	}
+
+	tests := []struct {
+		name string
+		c    Case
+		got  string
+		want Status
+	}{
+		{"exact", nc, "ND00AAAA1500", StatusMatch},
+		{"masked", nc, "ND00BBBB1500", StatusDeviation},
+		{"outside mask", nc, "ND00BBBB1600", StatusMismatch},
+		{"length differs", nc, "ND00BBBB15000", StatusMismatch},
+		{"no mask", Case{Name: "cw", Request: "CW", Response: "CX00123"}, "CX00999", StatusMismatch},
+		{"other case", Case{Name: "cy", Request: "CY", Response: "CZ00"}, "CZ01", StatusMismatch},
+		{"bad hex", Case{Name: "hex", RequestHex: "ZZ", Response: "CZ00"}, "CZ00", StatusMismatch},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			report := Run([]Case{tc.c}, allow, echo(tc.got))
+			if got := report.Results[0].Status; got != tc.want {
+				t.Errorf("status = %s, want %s (%s)", got, tc.want, report.Results[0].Reason)
+			}
+		})
+	}
+}
+
+func TestLoadAllowlistRequiresMask(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "allowlist.json")
+	if err := os.WriteFile(path, []byte(`[{"command": "KQ", "reason": "any"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadAllowlist(path); err == nil {
+		t.Error("LoadAllowlist() accepted an entry without a mask")
+	}
+}
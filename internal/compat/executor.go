@@ -0,0 +1,73 @@
+package compat
+
+import (
+	"fmt"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/internal/hsm"
+	"github.com/andrei-cloud/go_hsm/internal/hsm/logic"
+	"github.com/andrei-cloud/go_hsm/pkg/hsmplugin"
+)
+
+// commands maps the command codes covered by the suite to their logic.
+var commands = map[string]func([]byte) ([]byte, error){
+	"NC": logic.ExecuteNC,
+	"DC": logic.ExecuteDC,
+	"CA": logic.ExecuteCA,
+	"CW": logic.ExecuteCW,
+	"CY": logic.ExecuteCY,
+	"KQ": logic.ExecuteKQ,
+}
+
+// NewLogicExecutor returns an executor that runs the command logic in process with keys
+// encrypted under the variant LMK set of h, the way the plugins do through the host. It
+// replaces logic.LMKProviderInstance, so it must not run concurrently with other users of
+// the logic package. Responses are formatted as the server sends them with diagnostics
+// disabled.
+func NewLogicExecutor(h *hsm.HSM) Executor {
+	logic.LMKProviderInstance = logic.LMKProvider{
+		EncryptUnderLMK: func(key []byte, keyType string, scheme byte) ([]byte, error) {
+			return h.EncryptKeyWithVariantScheme(key, keyType, hostScheme(scheme))
+		},
+		DecryptUnderLMK: func(key []byte, keyType string, scheme byte) ([]byte, error) {
+			return h.DecryptKeyWithVariantScheme(key, keyType, hostScheme(scheme))
+		},
+		RandomKey:      h.GenerateRandomKey,
+		WrapKeyBlock:   logic.EncryptKeyBlock,
+		UnwrapKeyBlock: logic.UnwrapKeyBlock,
+		LMKCheckValue:  logic.LMKCheckValue,
+	}
+
+	return func(request []byte) ([]byte, error) {
+		if len(request) < 2 {
+			return nil, fmt.Errorf("request too short: %q", request)
+		}
+		cmd := string(request[:2])
+		execute, ok := commands[cmd]
+		if !ok {
+			return nil, fmt.Errorf("command %s not covered by the compatibility suite", cmd)
+		}
+
+		payload := request[2:]
+		if cmd == "NC" {
+			payload = logic.NCPayload(h.FirmwareVersion, payload)
+		}
+
+		resp, err := execute(payload)
+		if err != nil {
+			resp = hsmplugin.ErrorResponse(cmd, err)
+		}
+		resp, _, _ = errorcodes.SplitDetail(resp)
+
+		return resp, nil
+	}
+}
+
+// hostScheme maps the Z scheme to X, as the plugin LMK provider does.
+func hostScheme(scheme byte) byte {
+	if scheme == 'Z' {
+		return 'X'
+	}
+
+	return scheme
+}
@@ -4,8 +4,18 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/andrei-cloud/go_hsm/internal/authstate"
+	"github.com/andrei-cloud/go_hsm/internal/faults"
+	"github.com/andrei-cloud/go_hsm/internal/pcipolicy"
+	"github.com/andrei-cloud/go_hsm/internal/pintries"
+	"github.com/andrei-cloud/go_hsm/internal/plugins"
+	"github.com/andrei-cloud/go_hsm/internal/ratelimit"
+	"github.com/andrei-cloud/go_hsm/internal/secrets"
+	"github.com/andrei-cloud/go_hsm/internal/server"
 	"github.com/spf13/viper"
 )
 
@@ -20,28 +30,157 @@ type Config struct {
 	Server struct {
 		Host string
 		Port int
+		// Diagnostics appends internal error reasons to error responses.
+		Diagnostics bool
+		// KeepAlive is the TCP keepalive probe period; a negative value disables keepalive.
+		KeepAlive time.Duration
+		// IdleTimeout closes connections idle for this long; 0 keeps them open.
+		IdleTimeout time.Duration `mapstructure:"idle_timeout"`
+		// HealthCommand is the command code answered by the server core for health checks.
+		HealthCommand string `mapstructure:"health_command"`
+		// MaxMessageSize limits the size of a command in bytes; 0 allows up to the frame
+		// maximum of 65531 bytes.
+		MaxMessageSize int `mapstructure:"max_message_size"`
+		// HeaderLength is the length of the message header echoed in responses, including
+		// the 4-byte task ID of the framing.
+		HeaderLength int `mapstructure:"header_length"`
+		// Trailer echoes the message trailer that follows the delimiter 0x19 in a command.
+		Trailer bool
+		// Profile enables command profiling and names the report file: CSV for a .csv
+		// extension, a pprof profile otherwise.
+		Profile string
+		// Console is the listen address of the payShield console emulation; empty disables
+		// it.
+		Console string
+		// Listeners are additional host ports, each bound to an LMK and a command set.
+		Listeners []server.Listener
 	}
 	// Plugin configuration
 	Plugin struct {
 		Path string
+		// Pool sizes the instance pool of every plugin, and Pools those of single commands.
+		Pool  plugins.PoolConfig
+		Pools map[string]plugins.PoolConfig
+		// Runtime configures the WASM runtime and the limits of plugin execution.
+		Runtime plugins.RuntimeConfig
 	}
 	// Logging configuration
 	Log struct {
 		Level  string
 		Format string
 	}
+	// Key store configuration
+	Keystore struct {
+		Path string
+	}
+	// Fault injection configuration for resilience testing
+	Faults struct {
+		Enabled bool
+		// Seed makes injected faults reproducible; 0 selects a random seed.
+		Seed  uint64
+		Rules []faults.Rule
+	}
+	// PIN try limit simulation for issuer host testing
+	PINTries struct {
+		Enabled bool
+		// ErrorCode answers verifications of a blocked account; empty selects 39.
+		ErrorCode string `mapstructure:"error_code"`
+		// ResetCommand is the command code answered by the server core to reset counters.
+		ResetCommand string `mapstructure:"reset_command"`
+		Rules        []pintries.Rule
+	} `mapstructure:"pin_tries"`
+	// PCI-HSM key usage enforcement for the variant LMKs in PCI-HSM mode
+	PCIPolicy struct {
+		Enabled bool
+		// File is a YAML policy file whose rules replace those given inline.
+		File            string
+		pcipolicy.Rules `mapstructure:",squash"`
+	} `mapstructure:"pci_policy"`
+	// LMK configuration
+	LMK struct {
+		// PCI lists the variant LMK IDs using the PCI-HSM compliant key type table.
+		PCI []string
+		// Test lists the LMK IDs designated as test LMKs; their key blocks carry the test
+		// key status.
+		Test []string
+		// Secrets lists key block LMKs loaded from external secret managers at startup.
+		Secrets []secrets.LMKSecret
+		// Store is the file of LMKs managed with the lmk commands; its active LMKs are
+		// registered at startup.
+		Store string
+	}
+	// Decimalization profiles for PVV/CVV calculation, as selector=decimalizer entries
+	// (e.g. "DC=visa,issuer:476173=table2:0123456789012345").
+	Decimalization string
+	// Insecure test features that disclose clear keys and PINs
+	Insecure struct {
+		// TestFeaturesUntil enables the features until an RFC 3339 deadline.
+		TestFeaturesUntil string `mapstructure:"test_features_until"`
+	}
+	// Authorized state for privileged key management and host commands
+	Authorized struct {
+		// Enabled refuses sensitive host commands for LMKs outside the authorized state.
+		Enabled bool
+		// Until enters the authorized state until an RFC 3339 deadline.
+		Until string
+		// HostRules configures the authorized state of host commands.
+		authstate.HostRules `mapstructure:",squash"`
+	}
+	// Per-client rate limits of the server
+	RateLimit struct {
+		// Enabled refuses the commands of a client above its limits.
+		Enabled          bool
+		ratelimit.Limits `mapstructure:",squash"`
+	} `mapstructure:"rate_limit"`
+	// Tamper-evident audit log of security-relevant events
+	Audit struct {
+		// Path is the hash-chained audit log file; empty disables it.
+		Path string
+	}
+	// High-availability pair configuration
+	HA struct {
+		// Role is primary or standby; empty disables replication.
+		Role   string
+		Listen string
+		Peer   string
+		// Interval is the heartbeat and state synchronization period.
+		Interval        time.Duration
+		FailoverTimeout time.Duration `mapstructure:"failover_timeout"`
+	}
 }
 
-// Initialize sets up the configuration system.
-func Initialize() error {
+// EnvConfigFile names the environment variable selecting the configuration file when no
+// file is given on the command line.
+const EnvConfigFile = "GOHSM_CONFIG"
+
+// FileTypes lists the supported configuration file extensions.
+var FileTypes = []string{"yaml", "yml", "toml", "json"}
+
+// Initialize sets up the configuration system. The configuration is read from configFile,
+// or the file named by EnvConfigFile, whose extension selects YAML, TOML or JSON. Without
+// either, config.yaml, config.toml or config.json is searched for in the working
+// directory, $HOME/.go_hsm and /etc/go_hsm, and a default $HOME/.go_hsm/config.yaml is
+// created. Environment variables GOHSM_<SECTION>_<KEY> override the file.
+func Initialize(configFile string) error {
 	v = viper.New()
 
-	// Set config name and paths
-	v.SetConfigName("config")        // name of config file (without extension)
-	v.SetConfigType("yaml")          // config file type
-	v.AddConfigPath(".")             // optionally look for config in working directory
-	v.AddConfigPath("$HOME/.go_hsm") // look for config in .go_hsm directory in home
-	v.AddConfigPath("/etc/go_hsm/")  // path to look for the config file in
+	if configFile == "" {
+		configFile = os.Getenv(EnvConfigFile)
+	}
+	if configFile != "" {
+		ext := strings.TrimPrefix(filepath.Ext(configFile), ".")
+		if !slices.Contains(FileTypes, strings.ToLower(ext)) {
+			return fmt.Errorf("unsupported config file type %q of %s (use %s)",
+				ext, configFile, strings.Join(FileTypes, ", "))
+		}
+		v.SetConfigFile(configFile)
+	} else {
+		// Set config name and paths
+		v.SetConfigName("config")        // name of config file (without extension)
+		v.AddConfigPath(".")             // optionally look for config in working directory
+		v.AddConfigPath("$HOME/.go_hsm") // look for config in .go_hsm directory in home
+		v.AddConfigPath("/etc/go_hsm/")  // path to look for the config file in
+	}
 
 	// Set default values
 	setDefaults()
@@ -54,8 +193,10 @@ func Initialize() error {
 	)
 
 	// Create config file if it doesn't exist
-	if err := ensureConfig(); err != nil {
-		return fmt.Errorf("error creating config file: %w", err)
+	if configFile == "" {
+		if err := ensureConfig(); err != nil {
+			return fmt.Errorf("error creating config file: %w", err)
+		}
 	}
 
 	// Read in config file
@@ -67,6 +208,7 @@ func Initialize() error {
 	}
 
 	// Unmarshal config into struct
+	configData = Config{}
 	if err := v.Unmarshal(&configData); err != nil {
 		return fmt.Errorf("unable to decode into config struct: %w", err)
 	}
@@ -79,13 +221,82 @@ func setDefaults() {
 	// Server defaults
 	v.SetDefault("server.host", "localhost")
 	v.SetDefault("server.port", 1500)
+	v.SetDefault("server.diagnostics", false)
+	v.SetDefault("server.keepalive", 30*time.Second)
+	v.SetDefault("server.idle_timeout", time.Duration(0))
+	v.SetDefault("server.health_command", "")
+	v.SetDefault("server.max_message_size", 0)
+	v.SetDefault("server.console", "")
+	v.SetDefault("server.header_length", 4)
+	v.SetDefault("server.trailer", false)
+	v.SetDefault("server.profile", "")
 
 	// Plugin defaults
 	v.SetDefault("plugin.path", "plugins")
+	v.SetDefault("plugin.pool.min_size", plugins.DefaultPoolMinSize)
+	v.SetDefault("plugin.pool.max_size", plugins.DefaultPoolMaxSize)
+	v.SetDefault("plugin.pool.acquire_timeout", plugins.DefaultPoolAcquireTimeout)
+	v.SetDefault("plugin.pool.idle_timeout", plugins.DefaultPoolIdleTimeout)
+	v.SetDefault("plugin.runtime.engine", plugins.EngineAuto)
+	v.SetDefault("plugin.runtime.memory_limit_mb", 0)
+	v.SetDefault("plugin.runtime.exec_timeout", plugins.DefaultExecTimeout)
+	v.SetDefault("plugin.runtime.timeout_error_code", plugins.DefaultTimeoutErrorCode)
+	v.SetDefault("plugin.runtime.memory_error_code", plugins.DefaultMemoryErrorCode)
 
 	// Logging defaults
 	v.SetDefault("log.level", "info")
 	v.SetDefault("log.format", "human")
+
+	// Key store defaults
+	v.SetDefault("keystore.path", filepath.Join(os.Getenv("HOME"), ".go_hsm", "keystore.json"))
+
+	// Fault injection defaults
+	v.SetDefault("faults.enabled", false)
+	v.SetDefault("faults.seed", 0)
+
+	// PIN try limit defaults
+	v.SetDefault("pin_tries.enabled", false)
+	v.SetDefault("pin_tries.error_code", pintries.DefaultErrorCode)
+	v.SetDefault("pin_tries.reset_command", "")
+
+	// PCI-HSM enforcement defaults
+	v.SetDefault("pci_policy.enabled", false)
+	v.SetDefault("pci_policy.file", "")
+
+	// LMK defaults
+	v.SetDefault("lmk.pci", []string{})
+	v.SetDefault("lmk.test", []string{})
+	v.SetDefault("lmk.store", filepath.Join(os.Getenv("HOME"), ".go_hsm", "lmk.json"))
+
+	// Decimalization defaults
+	v.SetDefault("decimalization", "")
+
+	// Insecure test feature defaults
+	v.SetDefault("insecure.test_features_until", "")
+
+	// Authorized state defaults
+	v.SetDefault("authorized.enabled", false)
+	v.SetDefault("authorized.until", "")
+	v.SetDefault("authorized.window", authstate.DefaultWindow)
+	v.SetDefault("authorized.enter_command", "")
+	v.SetDefault("authorized.cancel_command", "")
+
+	// Rate limit defaults
+	v.SetDefault("rate_limit.enabled", false)
+	v.SetDefault("rate_limit.rate", 0)
+	v.SetDefault("rate_limit.burst", 0)
+	v.SetDefault("rate_limit.max_in_flight", 0)
+	v.SetDefault("rate_limit.error_code", ratelimit.DefaultErrorCode)
+
+	// Audit log defaults
+	v.SetDefault("audit.path", filepath.Join(os.Getenv("HOME"), ".go_hsm", "audit-chain.jsonl"))
+
+	// High-availability defaults
+	v.SetDefault("ha.role", "")
+	v.SetDefault("ha.listen", "")
+	v.SetDefault("ha.peer", "")
+	v.SetDefault("ha.interval", time.Second)
+	v.SetDefault("ha.failover_timeout", 3*time.Second)
 }
 
 // ensureConfig creates a default config file if none exists.
@@ -105,6 +316,7 @@ func ensureConfig() error {
 server:
   host: localhost
   port: 1500
+  diagnostics: false
 
 plugin:
   path: plugins
@@ -121,11 +333,52 @@ log:
 	return nil
 }
 
+// PCIMode reports whether the variant LMK with the given ID is configured for PCI-HSM
+// compliance mode.
+func (c *Config) PCIMode(lmkID string) bool {
+	return slices.Contains(c.LMK.PCI, lmkID)
+}
+
+// PCIPolicyRules returns the PCI-HSM enforcement rules, read from the policy file when one
+// is configured.
+func (c *Config) PCIPolicyRules() (pcipolicy.Rules, error) {
+	if c.PCIPolicy.File == "" {
+		return c.PCIPolicy.Rules, nil
+	}
+
+	fv := viper.New()
+	fv.SetConfigFile(c.PCIPolicy.File)
+	fv.SetConfigType("yaml")
+	if err := fv.ReadInConfig(); err != nil {
+		return pcipolicy.Rules{}, fmt.Errorf("failed to read PCI policy file: %w", err)
+	}
+	var rules pcipolicy.Rules
+	if err := fv.Unmarshal(&rules); err != nil {
+		return pcipolicy.Rules{}, fmt.Errorf("failed to decode PCI policy file: %w", err)
+	}
+
+	return rules, nil
+}
+
+// TestLMK reports whether the LMK with the given ID is designated as a test LMK.
+func (c *Config) TestLMK(lmkID string) bool {
+	return slices.Contains(c.LMK.Test, lmkID)
+}
+
 // Get returns the current configuration.
 func Get() *Config {
 	return &configData
 }
 
+// File returns the configuration file in use, empty when none was found.
+func File() string {
+	if v == nil {
+		return ""
+	}
+
+	return v.ConfigFileUsed()
+}
+
 // GetViper returns the viper instance.
 func GetViper() *viper.Viper {
 	return v
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeConfig writes a configuration file named name with content to a temporary directory
+// and returns its path.
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	return path
+}
+
+func TestInitializeFileTypes(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		content string
+	}{
+		{"config.yaml", "server:\n  port: 1600\n  idle_timeout: 1m\nlmk:\n  pci: [\"00\"]\n"},
+		{"config.toml", "[server]\nport = 1600\nidle_timeout = \"1m\"\n\n[lmk]\npci = [\"00\"]\n"},
+		{"config.json", `{"server": {"port": 1600, "idle_timeout": "1m"}, "lmk": {"pci": ["00"]}}`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := writeConfig(t, tc.name, tc.content)
+			require.NoError(t, Initialize(path))
+
+			assert.Equal(t, path, File())
+			cfg := Get()
+			assert.Equal(t, 1600, cfg.Server.Port)
+			assert.Equal(t, time.Minute, cfg.Server.IdleTimeout)
+			assert.Equal(t, "localhost", cfg.Server.Host, "default")
+			assert.True(t, cfg.PCIMode("00"))
+			assert.NoError(t, cfg.Validate())
+			assert.Empty(t, UnknownKeys())
+		})
+	}
+}
+
+func TestInitializeErrors(t *testing.T) {
+	assert.Error(t, Initialize(writeConfig(t, "config.ini", "[server]\n")), "unsupported type")
+	assert.Error(t, Initialize(filepath.Join(t.TempDir(), "missing.yaml")), "missing file")
+}
+
+func TestEnvironmentOverrides(t *testing.T) {
+	path := writeConfig(t, "hsm.yaml", "server:\n  port: 1600\nha:\n  role: primary\n")
+	t.Setenv("GOHSM_SERVER_PORT", "1700")
+	t.Setenv("GOHSM_HA_LISTEN", ":1800")
+
+	require.NoError(t, Initialize(path))
+	assert.Equal(t, 1700, Get().Server.Port)
+	assert.Equal(t, ":1800", Get().HA.Listen)
+	assert.NoError(t, Get().Validate())
+
+	t.Setenv(EnvConfigFile, path)
+	require.NoError(t, Initialize(""))
+	assert.Equal(t, path, File())
+}
+
+func TestValidate(t *testing.T) {
+	path := writeConfig(t, "config.yaml", `
+server:
+  port: 70000
+  header_length: 2
+  heder_length: 4
+  listeners:
+    - address: ":1501"
+      network: sctp
+log:
+  level: verbose
+plugin:
+  runtime:
+    engine: jit
+  pools:
+    A0:
+      min_size: 2
+lmk:
+  test: ["1"]
+ha:
+  role: standby
+authorized:
+  until: tomorrow
+`)
+	require.NoError(t, Initialize(path))
+
+	assert.Equal(t, []string{"server.heder_length"}, UnknownKeys())
+	err := Get().Validate()
+	require.Error(t, err)
+	for _, want := range []string{
+		"server port 70000",
+		"message header length 2",
+		`unsupported network "sctp"`,
+		`invalid log level "verbose"`,
+		`invalid plugin runtime engine "jit"`,
+		`lmk.test: invalid LMK ID "1"`,
+		"standby requires the primary replication address",
+		`authorized.until: "tomorrow"`,
+	} {
+		assert.Contains(t, err.Error(), want)
+	}
+}
@@ -0,0 +1,262 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/andrei-cloud/go_hsm/internal/faults"
+	"github.com/andrei-cloud/go_hsm/internal/hapair"
+	"github.com/andrei-cloud/go_hsm/internal/hsm/logic"
+	"github.com/andrei-cloud/go_hsm/internal/pcipolicy"
+	"github.com/andrei-cloud/go_hsm/internal/pintries"
+	"github.com/andrei-cloud/go_hsm/internal/ratelimit"
+	"github.com/andrei-cloud/go_hsm/internal/secrets"
+	"github.com/andrei-cloud/go_hsm/internal/server"
+)
+
+// minHeaderLength is the shortest message header, the 4-byte task ID of the framing.
+const minHeaderLength = 4
+
+// maxMessageSize is the largest command a frame can carry: the 2-byte frame length less the
+// 4-byte task ID.
+const maxMessageSize = 65535 - 4
+
+var (
+	logLevels  = []string{"debug", "info", "warn", "error"}
+	logFormats = []string{"human", "json"}
+)
+
+// UnknownKeys returns the keys of the configuration file that match no setting, typically
+// misspelled ones, sorted.
+func UnknownKeys() []string {
+	if v == nil {
+		return nil
+	}
+
+	settings := make(map[string]bool)
+	settingKeys(reflect.TypeFor[Config](), "", settings)
+	var unknown []string
+	for _, key := range v.AllKeys() {
+		if !knownKey(settings, key) {
+			unknown = append(unknown, key)
+		}
+	}
+	slices.Sort(unknown)
+
+	return unknown
+}
+
+// settingKeys adds the dotted keys of the settings of the struct type t to settings, named as
+// viper decodes them: by their mapstructure tag or lower case field name, with squashed
+// structs inline.
+func settingKeys(t reflect.Type, prefix string, settings map[string]bool) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+		if opts == "squash" {
+			settingKeys(f.Type, prefix, settings)
+
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		if f.Type.Kind() == reflect.Struct {
+			settingKeys(f.Type, prefix+name+".", settings)
+
+			continue
+		}
+		settings[prefix+name] = true
+	}
+}
+
+// knownKey reports whether key is a setting or lies within one, such as an entry of a map.
+func knownKey(settings map[string]bool, key string) bool {
+	for {
+		if settings[key] {
+			return true
+		}
+		i := strings.LastIndexByte(key, '.')
+		if i < 0 {
+			return false
+		}
+		key = key[:i]
+	}
+}
+
+// Validate checks the configuration the way the server does at startup and returns all
+// problems found, joined.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	check(c.validateServer())
+
+	check(c.Plugin.Pool.Validate())
+	for cmd, pool := range c.Plugin.Pools {
+		if err := pool.Validate(); err != nil {
+			check(fmt.Errorf("plugin pool of %s: %w", cmd, err))
+		}
+	}
+	check(c.Plugin.Runtime.Validate())
+
+	if !slices.Contains(logLevels, strings.ToLower(c.Log.Level)) {
+		check(fmt.Errorf("invalid log level %q (use %s)", c.Log.Level, strings.Join(logLevels, ", ")))
+	}
+	if c.Log.Format != "" && !slices.Contains(logFormats, strings.ToLower(c.Log.Format)) {
+		check(fmt.Errorf("invalid log format %q (use %s)", c.Log.Format, strings.Join(logFormats, ", ")))
+	}
+
+	check(c.validateLMK())
+	if err := logic.ConfigureDecimalization(c.Decimalization); err != nil {
+		check(fmt.Errorf("invalid decimalization configuration: %w", err))
+	}
+
+	if c.Faults.Enabled {
+		if _, err := faults.New(c.Faults.Rules, c.Faults.Seed); err != nil {
+			check(fmt.Errorf("invalid fault injection configuration: %w", err))
+		}
+	}
+	if c.PINTries.Enabled {
+		if _, err := pintries.New(c.PINTries.Rules, c.PINTries.ErrorCode, nil); err != nil {
+			check(fmt.Errorf("invalid PIN tries configuration: %w", err))
+		}
+		if cmd := c.PINTries.ResetCommand; cmd != "" && len(cmd) != 2 {
+			check(fmt.Errorf("PIN tries reset command %q must be a 2-character code", cmd))
+		}
+	}
+	if c.PCIPolicy.Enabled {
+		rules, err := c.PCIPolicyRules()
+		if err == nil {
+			_, err = pcipolicy.New(rules, c.PCIMode)
+		}
+		if err != nil {
+			check(fmt.Errorf("invalid PCI policy configuration: %w", err))
+		}
+	}
+	if c.RateLimit.Enabled {
+		if _, err := ratelimit.New(c.RateLimit.Limits); err != nil {
+			check(fmt.Errorf("invalid rate limit configuration: %w", err))
+		}
+	}
+
+	check(validDeadline("insecure.test_features_until", c.Insecure.TestFeaturesUntil))
+	check(validDeadline("authorized.until", c.Authorized.Until))
+
+	if c.HA.Role != "" {
+		haCfg := hapair.Config{
+			Role:            hapair.Role(strings.ToLower(c.HA.Role)),
+			Listen:          c.HA.Listen,
+			Peer:            c.HA.Peer,
+			Interval:        c.HA.Interval,
+			FailoverTimeout: c.HA.FailoverTimeout,
+		}
+		if _, err := hapair.NewNode(haCfg, nil); err != nil {
+			check(fmt.Errorf("invalid ha configuration: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateServer checks the server settings and listeners.
+func (c *Config) validateServer() error {
+	var errs []error
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		errs = append(errs, fmt.Errorf("server port %d must be between 1 and 65535", c.Server.Port))
+	}
+	if n := c.Server.HeaderLength; n < minHeaderLength || n > server.MaxHeaderLength {
+		errs = append(errs, fmt.Errorf("message header length %d must be between %d and %d",
+			n, minHeaderLength, server.MaxHeaderLength))
+	}
+	if n := c.Server.MaxMessageSize; n < 0 || n > maxMessageSize {
+		errs = append(errs, fmt.Errorf("max message size %d must be between 0 and %d bytes",
+			n, maxMessageSize))
+	}
+	if cmd := c.Server.HealthCommand; cmd != "" && len(cmd) != 2 {
+		errs = append(errs, fmt.Errorf("health check command %q must be a 2-character code", cmd))
+	}
+
+	for _, l := range c.Server.Listeners {
+		if l.Address == "" {
+			errs = append(errs, errors.New("listener without address"))
+		}
+		switch strings.ToLower(l.Network) {
+		case "", server.NetworkTCP, server.NetworkUDP:
+		default:
+			errs = append(errs, fmt.Errorf("listener %s: unsupported network %q", l.Address, l.Network))
+		}
+		if l.HeaderLength != 0 && (l.HeaderLength < minHeaderLength || l.HeaderLength > server.MaxHeaderLength) {
+			errs = append(errs, fmt.Errorf("listener %s: message header length %d must be between %d and %d",
+				l.Address, l.HeaderLength, minHeaderLength, server.MaxHeaderLength))
+		}
+		if l.LMKID != "" && !validLMKID(l.LMKID) {
+			errs = append(errs, fmt.Errorf("listener %s: invalid LMK ID %q", l.Address, l.LMKID))
+		}
+		for _, cmd := range l.Commands {
+			if len(cmd) != 2 {
+				errs = append(errs, fmt.Errorf("listener %s: invalid command %q", l.Address, cmd))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateLMK checks the LMK IDs of the LMK settings and the sources of LMK secrets.
+func (c *Config) validateLMK() error {
+	var errs []error
+	for _, id := range c.LMK.PCI {
+		if !validLMKID(id) {
+			errs = append(errs, fmt.Errorf("lmk.pci: invalid LMK ID %q", id))
+		}
+	}
+	for _, id := range c.LMK.Test {
+		if !validLMKID(id) {
+			errs = append(errs, fmt.Errorf("lmk.test: invalid LMK ID %q", id))
+		}
+	}
+	for _, s := range c.LMK.Secrets {
+		if !validLMKID(s.ID) {
+			errs = append(errs, fmt.Errorf("lmk.secrets: invalid LMK ID %q", s.ID))
+		}
+		if !slices.Contains(secrets.Sources(), s.Source) {
+			errs = append(errs, fmt.Errorf("lmk.secrets: LMK %s: %w: %s", s.ID, secrets.ErrUnknownSource, s.Source))
+		}
+		switch s.Format {
+		case "", secrets.FormatHex, secrets.FormatPassphrase, secrets.FormatRaw:
+		default:
+			errs = append(errs, fmt.Errorf("lmk.secrets: LMK %s: unsupported format %q", s.ID, s.Format))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validLMKID reports whether id is a two digit LMK identifier.
+func validLMKID(id string) bool {
+	return len(id) == 2 && strings.Trim(id, "0123456789") == ""
+}
+
+// validDeadline checks that value of the setting key is empty or an RFC 3339 time.
+func validDeadline(key, value string) error {
+	if value == "" {
+		return nil
+	}
+	if _, err := time.Parse(time.RFC3339, value); err != nil {
+		return fmt.Errorf("%s: %q is not an RFC 3339 time", key, value)
+	}
+
+	return nil
+}
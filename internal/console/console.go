@@ -0,0 +1,254 @@
+// Package console emulates the payShield console over TCP, so operators can use their
+// console tooling and scripts against the simulator. A session reads one command per line
+// and answers it with text followed by the prompt. The console views the firmware, date and
+// time and the LMK table, and views and changes the security settings the server exposes.
+package console
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/andrei-cloud/go_hsm/internal/hsm"
+	"github.com/andrei-cloud/go_hsm/internal/hsm/logic"
+	"github.com/rs/zerolog/log"
+)
+
+// Prompt ends every console response.
+const Prompt = "Online> "
+
+// Setting is a security setting viewed with QS and changed with CS.
+type Setting struct {
+	// Name identifies the setting in CS commands.
+	Name string
+	// Description is shown by QS.
+	Description string
+	// Get returns the current value.
+	Get func() string
+	// Set validates and applies a value; nil makes the setting read-only.
+	Set func(value string) error
+}
+
+// Console answers console sessions.
+type Console struct {
+	hsm      *hsm.HSM
+	settings []Setting
+	now      func() time.Time
+	mu       sync.Mutex
+}
+
+// New returns a console of h exposing settings.
+func New(h *hsm.HSM, settings []Setting) *Console {
+	return &Console{hsm: h, settings: settings, now: time.Now}
+}
+
+// Serve answers the sessions of the connections accepted on l until ctx is canceled.
+func (c *Console) Serve(ctx context.Context, l net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		_ = l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return fmt.Errorf("console accept failed: %w", err)
+		}
+		go func() {
+			defer conn.Close()
+			client := conn.RemoteAddr().String()
+			log.Info().Str("event", "console_session_start").Str("client_ip", client).Msg("console session opened")
+			if err := c.Session(conn, conn); err != nil {
+				log.Warn().Str("client_ip", client).Err(err).Msg("console session failed")
+			}
+			log.Info().Str("event", "console_session_end").Str("client_ip", client).Msg("console session closed")
+		}()
+	}
+}
+
+// Session answers the commands read from r on w until r is exhausted or the session is
+// closed with QUIT or EXIT.
+func (c *Console) Session(r io.Reader, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	_, _ = fmt.Fprintf(bw, "go_hsm console, firmware %s\r\n%s", c.hsm.FirmwareVersion, Prompt)
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			_, _ = bw.WriteString(Prompt)
+		} else {
+			cmd := strings.ToUpper(fields[0])
+			if cmd == "QUIT" || cmd == "EXIT" {
+				return nil
+			}
+			var out strings.Builder
+			c.execute(&out, cmd, fields[1:])
+			_, _ = bw.WriteString(strings.ReplaceAll(out.String(), "\n", "\r\n") + Prompt)
+		}
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// execute writes the response to a console command to out.
+func (c *Console) execute(out io.Writer, cmd string, args []string) {
+	switch cmd {
+	case "VR":
+		_, _ = fmt.Fprintf(out, "Firmware number: %s\n", c.hsm.FirmwareVersion)
+		_, _ = fmt.Fprintln(out, "Product: go_hsm payShield simulator")
+	case "DT":
+		now := c.now()
+		_, _ = fmt.Fprintf(out, "Date: %s\nTime: %s\n", now.Format("02/01/2006"), now.Format("15:04:05"))
+	case "QS":
+		c.querySecurity(out)
+	case "CS":
+		if err := c.configureSecurity(args); err != nil {
+			_, _ = fmt.Fprintf(out, "Error: %v\n", err)
+
+			return
+		}
+		_, _ = fmt.Fprintln(out, "Security settings updated")
+	case "VT":
+		c.viewLMKTable(out)
+	case "HELP", "?":
+		_, _ = fmt.Fprint(out, `VR  View firmware revision
+DT  View date and time
+QS  Query security settings
+CS  Configure security settings: CS <setting>=<value> ...
+VT  View LMK table
+QUIT
+`)
+	default:
+		_, _ = fmt.Fprintf(out, "Invalid command %s (HELP lists the commands)\n", cmd)
+	}
+}
+
+// querySecurity writes the security settings.
+func (c *Console) querySecurity(out io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, s := range c.settings {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", s.Name, s.Get(), s.Description)
+	}
+	_ = w.Flush()
+}
+
+// configureSecurity applies name=value arguments. Malformed arguments and unknown or
+// read-only settings are refused before any setting changes.
+func (c *Console) configureSecurity(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: CS <setting>=<value> ...")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	type change struct {
+		setting Setting
+		value   string
+	}
+	changes := make([]change, 0, len(args))
+	for _, arg := range args {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok || value == "" {
+			return fmt.Errorf("invalid setting %q, want <setting>=<value>", arg)
+		}
+		setting, ok := c.setting(name)
+		if !ok {
+			return fmt.Errorf("unknown setting %q", name)
+		}
+		if setting.Set == nil {
+			return fmt.Errorf("setting %s is read-only", setting.Name)
+		}
+		changes = append(changes, change{setting, value})
+	}
+	for _, ch := range changes {
+		if err := ch.setting.Set(ch.value); err != nil {
+			return fmt.Errorf("%s: %w", ch.setting.Name, err)
+		}
+		log.Warn().
+			Str("event", "console_security_setting").
+			Str("setting", ch.setting.Name).
+			Str("value", ch.setting.Get()).
+			Msg("security setting changed from the console")
+	}
+
+	return nil
+}
+
+func (c *Console) setting(name string) (Setting, bool) {
+	for _, s := range c.settings {
+		if strings.EqualFold(s.Name, name) {
+			return s, true
+		}
+	}
+
+	return Setting{}, false
+}
+
+// viewLMKTable writes the registered LMKs with their scheme, test or live status, PCI-HSM
+// mode, authorized state and old LMK in key change storage.
+func (c *Console) viewLMKTable(out io.Writer) {
+	now := c.now()
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ID\tScheme\tStatus\tPCI\tAuthorized\tOld LMK")
+	for _, id := range logic.RegisteredLMKIDs() {
+		engine := logic.LMKRegistry[id]
+		scheme, pci := "Key block", "-"
+		if variant, ok := engine.(logic.VariantLMKProvider); ok {
+			scheme, pci = "Variant", FormatYesNo(variant.PCIMode())
+		}
+		status := "Live"
+		if logic.IsTestLMK(id) {
+			status = "Test"
+		}
+		authorized := "N"
+		if until, ok := c.hsm.Authorization.Until(id, now); ok {
+			authorized = "Until " + until.Format("15:04:05")
+		}
+		_, old := logic.OldLMKRegistry[id]
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", id, scheme, status, pci, authorized, FormatYesNo(old))
+	}
+	_ = w.Flush()
+}
+
+// FormatYesNo formats a flag as the console does: Y or N.
+func FormatYesNo(b bool) string {
+	if b {
+		return "Y"
+	}
+
+	return "N"
+}
+
+// ParseYesNo parses a console flag value: Y, YES, N or NO in any case.
+func ParseYesNo(value string) (bool, error) {
+	switch strings.ToUpper(value) {
+	case "Y", "YES":
+		return true, nil
+	case "N", "NO":
+		return false, nil
+	default:
+		return false, fmt.Errorf("invalid value %q, want Y or N", value)
+	}
+}
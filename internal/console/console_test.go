@@ -0,0 +1,71 @@
+package console
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andrei-cloud/go_hsm/internal/hsm"
+)
+
+func TestSession(t *testing.T) {
+	t.Parallel()
+
+	h, err := hsm.NewHSM(hsm.FirmwareVersion, false)
+	if err != nil {
+		t.Fatalf("NewHSM: %v", err)
+	}
+	now := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	h.Authorization.Enter("00", now.Add(time.Hour))
+
+	diagnostics := false
+	c := New(h, []Setting{
+		{
+			Name:        "diagnostics",
+			Description: "Append error details",
+			Get:         func() string { return FormatYesNo(diagnostics) },
+			Set: func(value string) error {
+				enabled, err := ParseYesNo(value)
+				if err != nil {
+					return err
+				}
+				diagnostics = enabled
+
+				return nil
+			},
+		},
+		{Name: "fixed", Get: func() string { return "1" }},
+	})
+	c.now = func() time.Time { return now }
+
+	in := strings.Join([]string{
+		"VR", "dt", "", "CS diagnostics=Y", "CS fixed=2", "CS diagnostics=maybe", "QS", "VT", "XX", "QUIT", "VR",
+	}, "\r\n")
+	var out bytes.Buffer
+	if err := c.Session(strings.NewReader(in), &out); err != nil {
+		t.Fatalf("Session: %v", err)
+	}
+
+	got := out.String()
+	for _, want := range []string{
+		"Firmware number: " + hsm.FirmwareVersion + "\r\n",
+		"Date: 01/05/2024\r\nTime: 12:30:00\r\n",
+		"Security settings updated\r\n",
+		"Error: setting fixed is read-only\r\n",
+		"Error: diagnostics: invalid value \"maybe\", want Y or N\r\n",
+		"diagnostics  Y  Append error details",
+		"Until 13:30:00",
+		"Invalid command XX",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("session output lacks %q:\n%s", want, got)
+		}
+	}
+	if n := strings.Count(got, "Firmware number"); n != 1 {
+		t.Errorf("commands after QUIT were answered: %d VR responses", n)
+	}
+	if n := strings.Count(got, Prompt); n != 10 {
+		t.Errorf("prompt count = %d, want 10", n)
+	}
+}
@@ -2,6 +2,28 @@
 // HSMError holds the two-character code and human-readable description.
 package errorcodes
 
+// DetailSeparator separates an error response of a plugin from its diagnostic detail. The
+// server strips everything from the separator onwards unless diagnostic mode is enabled.
+const DetailSeparator byte = 0x1F
+
+// DiagnosticFieldTag prefixes the vendor field that carries diagnostic details in responses.
+const DiagnosticFieldTag = "~E"
+
+// errorResponseLength is the length of an error response: response code and error code.
+const errorResponseLength = 4
+
+// SplitDetail splits resp into the response and the diagnostic detail appended to it. Only
+// error responses carry a detail, directly after the error code, so success responses are
+// never split, even when their data contains DetailSeparator.
+func SplitDetail(resp []byte) (response, detail []byte, ok bool) {
+	if len(resp) <= errorResponseLength || resp[errorResponseLength] != DetailSeparator ||
+		string(resp[2:errorResponseLength]) == Err00.Code {
+		return resp, nil, false
+	}
+
+	return resp[:errorResponseLength], resp[errorResponseLength+1:], true
+}
+
 // Predefined HSM error instances.
 var (
 	Err00 = HSMError{"00", "No error"}
@@ -115,3 +137,26 @@ func (e HSMError) Error() string {
 func (e HSMError) CodeOnly() string {
 	return e.Code
 }
+
+// DetailedError is an HSMError carrying an internal diagnostic reason, such as the
+// offending field name and offset. The reason is only exposed to clients when the
+// server runs in diagnostic mode; otherwise the response is the standard error code.
+type DetailedError struct {
+	HSMError
+	Detail string // internal reason for the error
+}
+
+// WithDetail wraps an HSMError with a diagnostic reason.
+func WithDetail(code HSMError, detail string) error {
+	return DetailedError{HSMError: code, Detail: detail}
+}
+
+// Error implements the Go error interface: "<Code>: <Description> (<Detail>)".
+func (e DetailedError) Error() string {
+	return e.HSMError.Error() + " (" + e.Detail + ")"
+}
+
+// Unwrap returns the underlying HSMError so errors.Is and errors.As match the code.
+func (e DetailedError) Unwrap() error {
+	return e.HSMError
+}
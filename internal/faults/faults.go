@@ -0,0 +1,136 @@
+// Package faults injects delays and failures into HSM responses so that host applications'
+// timeout, retry and failover logic can be exercised against a misbehaving HSM.
+package faults
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AnyCommand is the rule command that matches every command without a dedicated rule.
+const AnyCommand = "*"
+
+// Rule describes the faults injected for a command.
+type Rule struct {
+	// Command is the two character command code or AnyCommand.
+	Command string `mapstructure:"command"`
+	// Delay is the fixed delay applied before the command is processed.
+	Delay time.Duration `mapstructure:"delay"`
+	// Jitter adds a random delay in [0, Jitter) on top of Delay.
+	Jitter time.Duration `mapstructure:"jitter"`
+	// ErrorRate is the probability of answering with ErrorCode instead of executing the command.
+	ErrorRate float64 `mapstructure:"error_rate"`
+	// ErrorCode is the two character error code returned when an error is injected.
+	ErrorCode string `mapstructure:"error_code"`
+	// DropRate is the probability of closing the connection without a response.
+	DropRate float64 `mapstructure:"drop_rate"`
+	// TruncateRate is the probability of cutting the response short.
+	TruncateRate float64 `mapstructure:"truncate_rate"`
+}
+
+// Action is the outcome of a fault decision for a single request.
+type Action struct {
+	Delay     time.Duration
+	ErrorCode string // non-empty when an error response must be returned
+	Drop      bool   // close the connection without answering
+	Truncate  bool   // cut the response short
+}
+
+// Injector decides which faults to apply to each request.
+type Injector struct {
+	rules map[string]Rule
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// New validates rules and returns an injector. A zero seed selects a random seed; a fixed
+// seed makes the sequence of injected faults reproducible.
+func New(rules []Rule, seed uint64) (*Injector, error) {
+	inj := &Injector{rules: make(map[string]Rule, len(rules))}
+	for _, r := range rules {
+		r.Command = strings.ToUpper(r.Command)
+		if err := r.validate(); err != nil {
+			return nil, err
+		}
+		if _, ok := inj.rules[r.Command]; ok {
+			return nil, fmt.Errorf("duplicate fault rule for command %s", r.Command)
+		}
+		inj.rules[r.Command] = r
+	}
+
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	inj.rnd = rand.New(rand.NewPCG(seed, seed^0x9E3779B97F4A7C15))
+
+	return inj, nil
+}
+
+// Decide returns the faults to apply to a request for cmd.
+func (i *Injector) Decide(cmd string) Action {
+	if i == nil {
+		return Action{}
+	}
+
+	r, ok := i.rules[cmd]
+	if !ok {
+		if r, ok = i.rules[AnyCommand]; !ok {
+			return Action{}
+		}
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	act := Action{Delay: r.Delay}
+	if r.Jitter > 0 {
+		act.Delay += time.Duration(i.rnd.Int64N(int64(r.Jitter)))
+	}
+	switch {
+	case i.hit(r.DropRate):
+		act.Drop = true
+	case i.hit(r.ErrorRate):
+		act.ErrorCode = r.ErrorCode
+	case i.hit(r.TruncateRate):
+		act.Truncate = true
+	}
+
+	return act
+}
+
+// Truncate returns a response cut to half its length, keeping at least one byte
+// so the client receives a frame that is too short to parse.
+func Truncate(resp []byte) []byte {
+	if len(resp) < 2 {
+		return resp
+	}
+
+	return resp[:len(resp)/2]
+}
+
+func (i *Injector) hit(rate float64) bool {
+	return rate > 0 && i.rnd.Float64() < rate
+}
+
+func (r Rule) validate() error {
+	if r.Command != AnyCommand && len(r.Command) != 2 {
+		return fmt.Errorf("invalid fault rule command %q", r.Command)
+	}
+	if r.Delay < 0 || r.Jitter < 0 {
+		return fmt.Errorf("fault rule %s: delay and jitter must not be negative", r.Command)
+	}
+	for _, rate := range []float64{r.ErrorRate, r.DropRate, r.TruncateRate} {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("fault rule %s: rates must be between 0 and 1", r.Command)
+		}
+	}
+	if r.ErrorRate > 0 && len(r.ErrorCode) != 2 {
+		return fmt.Errorf("fault rule %s: error_code must be two characters", r.Command)
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package faults
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewValidation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		rules   []Rule
+		wantErr bool
+	}{
+		{name: "empty", rules: nil},
+		{name: "valid", rules: []Rule{{Command: "dc", ErrorRate: 0.5, ErrorCode: "68"}}},
+		{name: "wildcard", rules: []Rule{{Command: AnyCommand, Delay: time.Millisecond}}},
+		{name: "bad command", rules: []Rule{{Command: "DCX"}}, wantErr: true},
+		{name: "negative delay", rules: []Rule{{Command: "DC", Delay: -1}}, wantErr: true},
+		{name: "rate above one", rules: []Rule{{Command: "DC", DropRate: 1.5}}, wantErr: true},
+		{name: "missing error code", rules: []Rule{{Command: "DC", ErrorRate: 0.1}}, wantErr: true},
+		{
+			name:    "duplicate",
+			rules:   []Rule{{Command: "DC"}, {Command: "dc"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := New(tc.rules, 1)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestDecide(t *testing.T) {
+	t.Parallel()
+
+	inj, err := New([]Rule{
+		{Command: "DC", ErrorRate: 1, ErrorCode: "17"},
+		{Command: "CA", DropRate: 1},
+		{Command: "KQ", TruncateRate: 1},
+		{Command: AnyCommand, Delay: 10 * time.Millisecond, Jitter: 5 * time.Millisecond},
+	}, 42)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if act := inj.Decide("DC"); act.ErrorCode != "17" || act.Drop || act.Truncate {
+		t.Errorf("Decide(DC) = %+v, want error code 17", act)
+	}
+	if act := inj.Decide("CA"); !act.Drop {
+		t.Errorf("Decide(CA) = %+v, want drop", act)
+	}
+	if act := inj.Decide("KQ"); !act.Truncate {
+		t.Errorf("Decide(KQ) = %+v, want truncate", act)
+	}
+	act := inj.Decide("A0")
+	if act.Delay < 10*time.Millisecond || act.Delay >= 15*time.Millisecond {
+		t.Errorf("Decide(A0) delay = %v, want within [10ms, 15ms)", act.Delay)
+	}
+	if act.Drop || act.Truncate || act.ErrorCode != "" {
+		t.Errorf("Decide(A0) = %+v, want delay only", act)
+	}
+
+	var disabled *Injector
+	if act := disabled.Decide("DC"); act != (Action{}) {
+		t.Errorf("nil injector Decide() = %+v, want no faults", act)
+	}
+}
+
+func TestDecideReproducible(t *testing.T) {
+	t.Parallel()
+
+	rules := []Rule{{Command: "DC", ErrorRate: 0.5, ErrorCode: "68", Jitter: time.Second}}
+	a, _ := New(rules, 7)
+	b, _ := New(rules, 7)
+	for range 50 {
+		if x, y := a.Decide("DC"), b.Decide("DC"); x != y {
+			t.Fatalf("same seed produced %+v and %+v", x, y)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	t.Parallel()
+
+	if got := string(Truncate([]byte("DD00123456"))); got != "DD001" {
+		t.Errorf("Truncate() = %q, want %q", got, "DD001")
+	}
+	if got := string(Truncate([]byte("D"))); got != "D" {
+		t.Errorf("Truncate() = %q, want %q", got, "D")
+	}
+}
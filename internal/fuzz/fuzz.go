@@ -0,0 +1,280 @@
+// Package fuzz implements a protocol fuzzer for the HSM TCP server. It replays a corpus of
+// negative test cases (malformed frames, wrong lengths, truncated commands, invalid hex)
+// and random mutations of it, and asserts that the server answers or closes the
+// connection cleanly for every case and stays available throughout.
+package fuzz
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"time"
+)
+
+// taskIDSize is the size of the task ID prefixed to every payload by the anet framing.
+const taskIDSize = 4
+
+// probe is the request used to check that the server is still available.
+var probe = []byte("NC")
+
+// Case is a single fuzz input.
+type Case struct {
+	Name string
+	// Data is written to the connection as is, including the length header.
+	Data []byte
+	// Framed reports whether Data is one well-formed frame, so a response carrying the
+	// same task ID is expected if the server answers.
+	Framed bool
+}
+
+// Outcome is the result of sending a case.
+type Outcome int
+
+// Case outcomes.
+const (
+	OutcomeResponse Outcome = iota // the server answered
+	OutcomeClosed                  // the server closed the connection
+	OutcomeTimeout                 // the server neither answered nor closed
+)
+
+// String returns the outcome name.
+func (o Outcome) String() string {
+	switch o {
+	case OutcomeResponse:
+		return "response"
+	case OutcomeClosed:
+		return "closed"
+	default:
+		return "timeout"
+	}
+}
+
+// Config controls a fuzzing run.
+type Config struct {
+	// Target is the server address.
+	Target string
+	// Iterations is the number of random mutations sent after the corpus.
+	Iterations int
+	// Seed makes the mutations reproducible; 0 selects a random seed.
+	Seed uint64
+	// Timeout bounds the wait for a response to each case.
+	Timeout time.Duration
+}
+
+// Failure describes a case the server did not handle cleanly.
+type Failure struct {
+	Case   string
+	Reason string
+}
+
+// Report summarizes a fuzzing run.
+type Report struct {
+	Seed      uint64
+	Cases     int
+	Responses int
+	Closed    int
+	Failures  []Failure
+}
+
+// ErrUnavailable is returned when the server stops accepting or answering requests.
+var ErrUnavailable = errors.New("server unavailable")
+
+// Frame builds a well-formed frame carrying payload with the given task ID.
+func Frame(taskID uint32, payload []byte) []byte {
+	buf := make([]byte, 2+taskIDSize+len(payload))
+	binary.BigEndian.PutUint16(buf, uint16(taskIDSize+len(payload)))
+	binary.BigEndian.PutUint32(buf[2:], taskID)
+	copy(buf[2+taskIDSize:], payload)
+
+	return buf
+}
+
+// Corpus returns the built-in negative test cases.
+func Corpus() []Case {
+	framed := func(name string, payload []byte) Case {
+		return Case{Name: name, Data: Frame(0x46555A5A, payload), Framed: true}
+	}
+	binary256 := make([]byte, 256)
+	for i := range binary256 {
+		binary256[i] = byte(i)
+	}
+	large := make([]byte, 0xFFFF-taskIDSize)
+	for i := range large {
+		large[i] = 'F'
+	}
+	copy(large, "DC")
+
+	return []Case{
+		framed("empty payload", nil),
+		framed("single byte command", []byte("N")),
+		framed("unknown command", []byte("ZZ0123")),
+		framed("lowercase command", []byte("nc")),
+		framed("non-ascii command", []byte{0xFF, 0xFE, 0x00}),
+		framed("binary payload", binary256),
+		framed("truncated A0", []byte("A00")),
+		framed("truncated DC", []byte("DCU0123")),
+		framed("truncated CA", []byte("CAU0123456789ABCDEF")),
+		framed("truncated MC", []byte("MC0031")),
+		framed("invalid hex key", []byte("MC00314GGGGGGGGGGGGGGGG0000000000040000")),
+		framed("invalid hex mac", []byte("MC003140123456789ABCDEFZZZZZZZZ0004TEST")),
+		framed("message length too long", []byte("MC003140123456789ABCDEF00000000FFFFAB")),
+		framed("message length not hex", []byte("MC003140123456789ABCDEF00000000XYZWAB")),
+		framed("invalid key scheme", []byte("A00001Q")),
+		framed("embedded delimiters", []byte("CA;;;;%%%%\x19\x19")),
+		framed("maximum frame", large),
+		{Name: "header only", Data: []byte{0x00}},
+		{Name: "zero length frame", Data: []byte{0x00, 0x00}},
+		{Name: "frame shorter than task id", Data: []byte{0x00, 0x02, 'N', 'C'}},
+		{Name: "length exceeds data", Data: append([]byte{0x01, 0x00}, Frame(1, probe)[2:]...)},
+		{Name: "length below data", Data: append([]byte{0x00, 0x05}, Frame(1, probe)[2:]...)},
+		{Name: "pipelined truncated frame", Data: append(Frame(2, probe), Frame(3, []byte("DC0123"))[:6]...)},
+	}
+}
+
+// Run sends the corpus and cfg.Iterations mutations to cfg.Target. It returns an error
+// wrapping ErrUnavailable if the server stops answering; failures of individual cases are
+// collected in the report.
+func Run(cfg Config) (Report, error) {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 2 * time.Second
+	}
+	if cfg.Seed == 0 {
+		cfg.Seed = rand.Uint64()
+	}
+	rng := rand.New(rand.NewPCG(cfg.Seed, cfg.Seed))
+	report := Report{Seed: cfg.Seed}
+
+	if err := checkAlive(cfg); err != nil {
+		return report, err
+	}
+
+	corpus := Corpus()
+	cases := append([]Case(nil), corpus...)
+	for i := range cfg.Iterations {
+		cases = append(cases, mutate(rng, corpus, i))
+	}
+
+	for _, c := range cases {
+		outcome, err := send(cfg, c)
+		report.Cases++
+		switch {
+		case err != nil:
+			report.Failures = append(report.Failures, Failure{Case: c.Name, Reason: err.Error()})
+		case outcome == OutcomeResponse:
+			report.Responses++
+		case outcome == OutcomeClosed:
+			report.Closed++
+		default:
+			report.Failures = append(report.Failures, Failure{Case: c.Name, Reason: "no response and connection left open"})
+		}
+
+		if err := checkAlive(cfg); err != nil {
+			return report, fmt.Errorf("after case %q: %w", c.Name, err)
+		}
+	}
+
+	return report, nil
+}
+
+// send writes a case on a new connection and classifies the server reaction.
+func send(cfg Config, c Case) (Outcome, error) {
+	conn, err := net.DialTimeout("tcp", cfg.Target, cfg.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(cfg.Timeout))
+	if _, err := conn.Write(c.Data); err != nil {
+		return OutcomeClosed, nil
+	}
+	// Unframed cases end with a half-close so the server sees the truncation.
+	if tcp, ok := conn.(*net.TCPConn); ok && !c.Framed {
+		_ = tcp.CloseWrite()
+	}
+
+	resp, err := readFrame(conn)
+	switch {
+	case err == nil:
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, net.ErrClosed):
+		return OutcomeClosed, nil
+	default:
+		var ne net.Error
+		if errors.As(err, &ne) && ne.Timeout() {
+			return OutcomeTimeout, nil
+		}
+
+		return OutcomeClosed, nil
+	}
+
+	if c.Framed {
+		if len(resp) < taskIDSize || string(resp[:taskIDSize]) != string(c.Data[2:2+taskIDSize]) {
+			return OutcomeResponse, errors.New("response task id does not match request")
+		}
+		if len(resp) == taskIDSize {
+			return OutcomeResponse, errors.New("empty response")
+		}
+	}
+
+	return OutcomeResponse, nil
+}
+
+// checkAlive verifies that the server still answers a well-formed request.
+func checkAlive(cfg Config) error {
+	outcome, err := send(cfg, Case{Name: "probe", Data: Frame(0x50524F42, probe), Framed: true})
+	if err != nil {
+		return err
+	}
+	if outcome != OutcomeResponse {
+		return fmt.Errorf("%w: probe got %s", ErrUnavailable, outcome)
+	}
+
+	return nil
+}
+
+func readFrame(r io.Reader) ([]byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(header[:]))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+// mutate derives a framed case from a random corpus entry.
+func mutate(rng *rand.Rand, corpus []Case, n int) Case {
+	var payload []byte
+	for payload == nil {
+		c := corpus[rng.IntN(len(corpus))]
+		if c.Framed && len(c.Data) > 2+taskIDSize {
+			payload = append([]byte(nil), c.Data[2+taskIDSize:]...)
+		}
+	}
+	if len(payload) > 512 {
+		payload = payload[:512]
+	}
+
+	const alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ;%\x00\xFF"
+	for range 1 + rng.IntN(4) {
+		switch op := rng.IntN(4); {
+		case op == 0 && len(payload) > 2:
+			payload = payload[:2+rng.IntN(len(payload)-2)]
+		case op == 1 && len(payload) > 0:
+			payload[rng.IntN(len(payload))] ^= byte(1 << rng.IntN(8))
+		case op == 2:
+			i := rng.IntN(len(payload) + 1)
+			payload = append(payload[:i], append([]byte{alphabet[rng.IntN(len(alphabet))]}, payload[i:]...)...)
+		default:
+			payload = append(payload, payload...)
+		}
+	}
+
+	return Case{Name: fmt.Sprintf("mutation %d", n+1), Data: Frame(uint32(n), payload), Framed: true}
+}
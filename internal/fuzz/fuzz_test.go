@@ -0,0 +1,107 @@
+package fuzz
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/andrei-cloud/go_hsm/internal/hsm"
+	"github.com/andrei-cloud/go_hsm/internal/plugins"
+	"github.com/andrei-cloud/go_hsm/internal/server"
+)
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	return addr
+}
+
+func startServer(t *testing.T) string {
+	t.Helper()
+
+	h, err := hsm.NewHSM(hsm.FirmwareVersion, false)
+	if err != nil {
+		t.Fatalf("failed to create hsm: %v", err)
+	}
+	addr := freeAddr(t)
+	srv, err := server.NewServer(addr, plugins.NewPluginManager(context.Background(), h))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	go func() { _ = srv.Start() }()
+	t.Cleanup(func() { _ = srv.Stop() })
+
+	for range 50 {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			_ = conn.Close()
+
+			return addr
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("server did not start")
+
+	return ""
+}
+
+func TestRunAgainstServer(t *testing.T) {
+	t.Parallel()
+
+	addr := startServer(t)
+	report, err := Run(Config{Target: addr, Iterations: 50, Seed: 1, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if len(report.Failures) > 0 {
+		t.Fatalf("unexpected failures: %+v", report.Failures)
+	}
+	if report.Cases != len(Corpus())+50 {
+		t.Errorf("expected %d cases, got %d", len(Corpus())+50, report.Cases)
+	}
+	if report.Responses == 0 || report.Closed == 0 {
+		t.Errorf("expected both responses and closed connections, got %+v", report)
+	}
+}
+
+func TestRunDetectsUnresponsiveServer(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { _ = conn.Close() })
+		}
+	}()
+
+	_, err = Run(Config{Target: ln.Addr().String(), Timeout: 100 * time.Millisecond})
+	if !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable, got %v", err)
+	}
+}
+
+func TestFrame(t *testing.T) {
+	t.Parallel()
+
+	got := Frame(0x01020304, []byte("NC"))
+	want := []byte{0x00, 0x06, 0x01, 0x02, 0x03, 0x04, 'N', 'C'}
+	if string(got) != string(want) {
+		t.Errorf("Frame() = %X, want %X", got, want)
+	}
+}
@@ -0,0 +1,264 @@
+package hapair
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andrei-cloud/go_hsm/internal/keystore"
+)
+
+func addKey(t *testing.T, path, id string) {
+	t.Helper()
+
+	s, err := keystore.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	if err := s.Put(keystore.Key{ID: id, LMKID: "00", KeyType: "000", Scheme: "U", Value: "AABB"}); err != nil {
+		t.Fatalf("failed to add key: %v", err)
+	}
+	if err := s.Save(); err != nil {
+		t.Fatalf("failed to save store: %v", err)
+	}
+}
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	return addr
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStateSnapshotApply(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	src := NewState(filepath.Join(dir, "primary.json"))
+	dst := NewState(filepath.Join(dir, "standby.json"))
+
+	addKey(t, filepath.Join(dir, "primary.json"), "zmk1")
+	addKey(t, filepath.Join(dir, "standby.json"), "stale")
+	src.Next("dukpt:terminal1")
+	src.Next("dukpt:terminal1")
+
+	snap, changed, err := src.Snapshot()
+	if err != nil || !changed || snap.Seq != 1 {
+		t.Fatalf("Snapshot() = seq %d, changed %v, err %v", snap.Seq, changed, err)
+	}
+	if _, changed, _ := src.Snapshot(); changed {
+		t.Error("Snapshot() reported a change for unchanged state")
+	}
+
+	if err := dst.Apply(snap); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if got := dst.Counter("dukpt:terminal1"); got != 2 {
+		t.Errorf("Counter() = %d, want 2", got)
+	}
+	store, _ := keystore.Open(filepath.Join(dir, "standby.json"))
+	if store.Len() != 1 {
+		t.Fatalf("standby store has %d keys, want 1", store.Len())
+	}
+	if _, err := store.Get("zmk1"); err != nil {
+		t.Errorf("replicated key missing: %v", err)
+	}
+
+	// The promoted standby continues the counter sequence.
+	if got := dst.Next("dukpt:terminal1"); got != 3 {
+		t.Errorf("Next() after apply = %d, want 3", got)
+	}
+}
+
+func TestStateCounters(t *testing.T) {
+	t.Parallel()
+	s := NewState(filepath.Join(t.TempDir(), "store.json"))
+
+	if !s.Advance("dukpt:a", 5) || s.Advance("dukpt:a", 3) || s.Counter("dukpt:a") != 5 {
+		t.Errorf("Advance() kept %d, want the highest value 5", s.Counter("dukpt:a"))
+	}
+	s.Next("pin_tries:1")
+	s.Next("pin_tries:2")
+	s.Delete("pin_tries:1")
+	if s.Counter("pin_tries:1") != 0 || s.Counter("pin_tries:2") != 1 {
+		t.Errorf("Delete() removed the wrong counters")
+	}
+	s.DeletePrefix("pin_tries:")
+	if s.Counter("pin_tries:2") != 0 || s.Counter("dukpt:a") != 5 {
+		t.Errorf("DeletePrefix() removed the wrong counters")
+	}
+}
+
+func TestNodeReplicationAndPromotion(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	primaryPath := filepath.Join(dir, "primary.json")
+	standbyPath := filepath.Join(dir, "standby.json")
+	replAddr := freeAddr(t)
+
+	primaryState := NewState(primaryPath)
+	primary, err := NewNode(Config{
+		Role:     RolePrimary,
+		Listen:   replAddr,
+		Interval: 20 * time.Millisecond,
+	}, primaryState)
+	if err != nil {
+		t.Fatalf("NewNode(primary) error = %v", err)
+	}
+	standbyState := NewState(standbyPath)
+	standby, err := NewNode(Config{
+		Role:            RoleStandby,
+		Peer:            replAddr,
+		Interval:        20 * time.Millisecond,
+		FailoverTimeout: 200 * time.Millisecond,
+	}, standbyState)
+	if err != nil {
+		t.Fatalf("NewNode(standby) error = %v", err)
+	}
+	promoted := make(chan struct{})
+	standby.OnPromote = func() { close(promoted) }
+
+	primaryCtx, stopPrimary := context.WithCancel(context.Background())
+	primaryDone := make(chan struct{})
+	go func() {
+		defer close(primaryDone)
+		_ = primary.Run(primaryCtx)
+	}()
+	standbyCtx, stopStandby := context.WithCancel(context.Background())
+	defer stopStandby()
+	go func() { _ = standby.Run(standbyCtx) }()
+
+	addKey(t, primaryPath, "zpk1")
+	primaryState.Next("counter")
+	waitFor(t, "replication", func() bool {
+		s, err := keystore.Open(standbyPath)
+
+		return err == nil && s.Len() == 1 && standbyState.Counter("counter") == 1
+	})
+	if standby.Role() != RoleStandby {
+		t.Fatalf("standby promoted while primary is alive")
+	}
+
+	stopPrimary()
+	<-primaryDone
+	select {
+	case <-promoted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("standby was not promoted after primary loss")
+	}
+	if standby.Role() != RolePrimary {
+		t.Errorf("Role() = %s, want %s", standby.Role(), RolePrimary)
+	}
+}
+
+func TestNewNodeValidation(t *testing.T) {
+	t.Parallel()
+
+	state := NewState(filepath.Join(t.TempDir(), "ks.json"))
+	for _, cfg := range []Config{
+		{Role: RolePrimary},
+		{Role: RoleStandby},
+		{Role: "arbiter", Listen: "x", Peer: "y"},
+	} {
+		if _, err := NewNode(cfg, state); err == nil {
+			t.Errorf("NewNode(%+v) expected error", cfg)
+		}
+	}
+}
+
+func echoServer(t *testing.T, reply string) net.Listener {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 1)
+				for {
+					if _, err := conn.Read(buf); err != nil {
+						return
+					}
+					_, _ = conn.Write([]byte(reply))
+				}
+			}()
+		}
+	}()
+
+	return ln
+}
+
+func TestVirtualAddressFailover(t *testing.T) {
+	t.Parallel()
+
+	a := echoServer(t, "A")
+	b := echoServer(t, "B")
+	defer b.Close()
+
+	vip := &VirtualAddress{
+		Backends:      []string{a.Addr().String(), b.Addr().String()},
+		CheckInterval: 20 * time.Millisecond,
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = vip.Serve(ctx, ln) }()
+
+	ask := func() (string, error) {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			return "", err
+		}
+		defer conn.Close()
+		_ = conn.SetDeadline(time.Now().Add(time.Second))
+		if _, err := conn.Write([]byte("?")); err != nil {
+			return "", err
+		}
+		buf := make([]byte, 1)
+		if _, err := conn.Read(buf); err != nil {
+			return "", err
+		}
+
+		return string(buf), nil
+	}
+
+	if got, err := ask(); err != nil || got != "A" {
+		t.Fatalf("ask() = %q, %v, want A", got, err)
+	}
+
+	// Losing the active backend moves the virtual address.
+	_ = a.Close()
+	waitFor(t, "failover", func() bool { return vip.Active() == b.Addr().String() })
+	if got, err := ask(); err != nil || got != "B" {
+		t.Fatalf("ask() after failover = %q, %v, want B", got, err)
+	}
+}
@@ -0,0 +1,282 @@
+package hapair
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/andrei-cloud/anet"
+	"github.com/rs/zerolog/log"
+)
+
+// Role is the role of an instance within the pair.
+type Role string
+
+// Pair roles.
+const (
+	RolePrimary Role = "primary"
+	RoleStandby Role = "standby"
+)
+
+// Replication message types.
+const (
+	msgSnapshot  = "snapshot"
+	msgHeartbeat = "heartbeat"
+)
+
+// Config holds the configuration of a pair member.
+type Config struct {
+	Role Role
+	// Listen is the replication address a primary accepts standby connections on. A
+	// standby listens on it after promotion.
+	Listen string
+	// Peer is the replication address of the primary, used by a standby.
+	Peer string
+	// Interval is the period between heartbeats and state synchronizations.
+	Interval time.Duration
+	// FailoverTimeout is how long a standby waits without heartbeats before promotion.
+	FailoverTimeout time.Duration
+}
+
+// message is a frame on the replication channel.
+type message struct {
+	Type     string    `json:"type"`
+	Snapshot *Snapshot `json:"snapshot,omitempty"`
+}
+
+// Node is a member of an HA pair.
+type Node struct {
+	cfg   Config
+	state *State
+	role  atomic.Value // stores Role
+
+	// OnPromote is called when a standby takes over as primary.
+	OnPromote func()
+
+	mu    sync.Mutex
+	peers map[net.Conn]struct{}
+}
+
+// NewNode validates cfg and creates a pair member replicating state.
+func NewNode(cfg Config, state *State) (*Node, error) {
+	switch cfg.Role {
+	case RolePrimary:
+		if cfg.Listen == "" {
+			return nil, errors.New("primary requires a replication listen address")
+		}
+	case RoleStandby:
+		if cfg.Peer == "" {
+			return nil, errors.New("standby requires the primary replication address")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported ha role %q", cfg.Role)
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+	if cfg.FailoverTimeout <= 0 {
+		cfg.FailoverTimeout = 3 * cfg.Interval
+	}
+
+	n := &Node{cfg: cfg, state: state, peers: make(map[net.Conn]struct{})}
+	n.role.Store(cfg.Role)
+
+	return n, nil
+}
+
+// Role returns the current role of the node.
+func (n *Node) Role() Role {
+	role, _ := n.role.Load().(Role)
+
+	return role
+}
+
+// Run replicates state until ctx is canceled. A standby follows the primary and serves as
+// primary after promotion.
+func (n *Node) Run(ctx context.Context) error {
+	if n.Role() == RoleStandby {
+		if err := n.follow(ctx); err != nil || ctx.Err() != nil {
+			return err
+		}
+		n.promote()
+		if n.cfg.Listen == "" {
+			<-ctx.Done()
+
+			return nil
+		}
+	}
+
+	return n.lead(ctx)
+}
+
+// follow receives snapshots from the primary and returns when the failover timeout
+// elapses without a heartbeat or ctx is canceled.
+func (n *Node) follow(ctx context.Context) error {
+	lastSeen := time.Now()
+	for ctx.Err() == nil {
+		if time.Since(lastSeen) >= n.cfg.FailoverTimeout {
+			log.Warn().Str("peer", n.cfg.Peer).Msg("ha primary heartbeat lost")
+
+			return nil
+		}
+
+		conn, err := net.DialTimeout("tcp", n.cfg.Peer, n.cfg.Interval)
+		if err != nil {
+			sleep(ctx, n.cfg.Interval)
+
+			continue
+		}
+		log.Info().Str("peer", n.cfg.Peer).Msg("ha standby connected to primary")
+		lastSeen = n.receive(ctx, conn, lastSeen)
+		_ = conn.Close()
+	}
+
+	return nil
+}
+
+// receive applies frames from conn and returns the time of the last frame received.
+func (n *Node) receive(ctx context.Context, conn net.Conn, lastSeen time.Time) time.Time {
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	for {
+		_ = conn.SetReadDeadline(lastSeen.Add(n.cfg.FailoverTimeout))
+		frame, err := anet.Read(conn)
+		if err != nil {
+			return lastSeen
+		}
+		lastSeen = time.Now()
+
+		var msg message
+		if err := json.Unmarshal(frame, &msg); err != nil {
+			log.Error().Err(err).Msg("ha invalid replication frame")
+
+			continue
+		}
+		if msg.Type == msgSnapshot && msg.Snapshot != nil {
+			if err := n.state.Apply(*msg.Snapshot); err != nil {
+				log.Error().Err(err).Msg("ha failed to apply snapshot")
+
+				continue
+			}
+			log.Debug().Uint64("seq", msg.Snapshot.Seq).Msg("ha snapshot applied")
+		}
+	}
+}
+
+func (n *Node) promote() {
+	n.role.Store(RolePrimary)
+	log.Warn().Msg("ha standby promoted to primary")
+	if n.OnPromote != nil {
+		n.OnPromote()
+	}
+}
+
+// lead accepts standby connections and streams state to them.
+func (n *Node) lead(ctx context.Context) error {
+	ln, err := net.Listen("tcp", n.cfg.Listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen for replication: %w", err)
+	}
+	stop := context.AfterFunc(ctx, func() { _ = ln.Close() })
+	defer stop()
+
+	go n.broadcast(ctx)
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				n.closePeers()
+
+				return nil
+			}
+
+			return fmt.Errorf("replication accept failed: %w", err)
+		}
+		log.Info().Str("peer", conn.RemoteAddr().String()).Msg("ha standby attached")
+
+		// A new standby starts from a full snapshot.
+		snap, _, err := n.state.Snapshot()
+		if err == nil {
+			err = send(conn, message{Type: msgSnapshot, Snapshot: &snap})
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("ha failed to send initial snapshot")
+			_ = conn.Close()
+
+			continue
+		}
+
+		n.mu.Lock()
+		n.peers[conn] = struct{}{}
+		n.mu.Unlock()
+	}
+}
+
+// broadcast sends a snapshot when the state changed, or a heartbeat otherwise, every interval.
+func (n *Node) broadcast(ctx context.Context) {
+	ticker := time.NewTicker(n.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		msg := message{Type: msgHeartbeat}
+		snap, changed, err := n.state.Snapshot()
+		if err != nil {
+			log.Error().Err(err).Msg("ha failed to read state")
+		} else if changed {
+			msg = message{Type: msgSnapshot, Snapshot: &snap}
+		}
+
+		n.mu.Lock()
+		for conn := range n.peers {
+			if err := send(conn, msg); err != nil {
+				log.Warn().Err(err).Str("peer", conn.RemoteAddr().String()).Msg("ha standby detached")
+				_ = conn.Close()
+				delete(n.peers, conn)
+			}
+		}
+		n.mu.Unlock()
+	}
+}
+
+func (n *Node) closePeers() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for conn := range n.peers {
+		_ = conn.Close()
+		delete(n.peers, conn)
+	}
+}
+
+func send(conn net.Conn, msg message) error {
+	frame, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_ = conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+
+	return anet.Write(conn, frame)
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
@@ -0,0 +1,156 @@
+// Package hapair simulates a high-availability HSM pair. A primary instance replicates its
+// key store and counter state (such as DUKPT transaction counters) to a standby over a
+// replication channel; the standby promotes itself when the primary stops sending
+// heartbeats. A virtual address proxy moves host connections between the two instances
+// so host-side failover logic can be exercised.
+package hapair
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+
+	"github.com/andrei-cloud/go_hsm/internal/keystore"
+)
+
+// Snapshot is the replicated state of an instance.
+type Snapshot struct {
+	Seq      uint64            `json:"seq"`
+	Keys     []keystore.Key    `json:"keys"`
+	Counters map[string]uint64 `json:"counters"`
+}
+
+// State holds the state shared by the instances of a pair: the key store file and a set of
+// named counters. The server keeps its counters, the PIN try counters and the last DUKPT
+// transaction counter of each device, in the state so a promoted standby continues them.
+type State struct {
+	storePath string
+
+	mu       sync.Mutex
+	counters map[string]uint64
+	seq      uint64
+	last     []byte // serialized content of the last snapshot
+}
+
+// NewState creates the state for the key store at storePath.
+func NewState(storePath string) *State {
+	return &State{storePath: storePath, counters: make(map[string]uint64)}
+}
+
+// Next increments the named counter and returns its new value.
+func (s *State) Next(name string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.counters[name]++
+
+	return s.counters[name]
+}
+
+// Counter returns the current value of the named counter.
+func (s *State) Counter(name string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.counters[name]
+}
+
+// Advance raises the named counter to value and reports whether it was below value.
+func (s *State) Advance(name string, value uint64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.counters[name] >= value {
+		return false
+	}
+	s.counters[name] = value
+
+	return true
+}
+
+// Delete removes the named counter.
+func (s *State) Delete(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.counters, name)
+}
+
+// DeletePrefix removes the counters whose names start with prefix.
+func (s *State) DeletePrefix(prefix string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	maps.DeleteFunc(s.counters, func(name string, _ uint64) bool {
+		return strings.HasPrefix(name, prefix)
+	})
+}
+
+// Snapshot returns the current state. The sequence number advances only when the key
+// store or the counters changed since the previous snapshot; changed reports whether
+// that happened.
+func (s *State) Snapshot() (Snapshot, bool, error) {
+	store, err := keystore.Open(s.storePath)
+	if err != nil {
+		return Snapshot{}, false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snap := Snapshot{Keys: store.List(), Counters: maps.Clone(s.counters)}
+	content, err := json.Marshal(snap)
+	if err != nil {
+		return Snapshot{}, false, fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+
+	changed := !bytes.Equal(content, s.last)
+	if changed {
+		s.seq++
+		s.last = content
+	}
+	snap.Seq = s.seq
+
+	return snap, changed, nil
+}
+
+// Apply replaces the local state with a snapshot received from the peer.
+func (s *State) Apply(snap Snapshot) error {
+	store, err := keystore.Open(s.storePath)
+	if err != nil {
+		return err
+	}
+
+	incoming := make(map[string]bool, len(snap.Keys))
+	for _, k := range snap.Keys {
+		incoming[k.ID] = true
+		if err := store.Put(k); err != nil {
+			return err
+		}
+	}
+	for _, k := range store.List() {
+		if !incoming[k.ID] {
+			if err := store.Delete(k.ID); err != nil {
+				return err
+			}
+		}
+	}
+	if err := store.Save(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.counters = maps.Clone(snap.Counters)
+	if s.counters == nil {
+		s.counters = make(map[string]uint64)
+	}
+	s.seq = snap.Seq
+	s.last, _ = json.Marshal(Snapshot{Keys: snap.Keys, Counters: s.counters})
+
+	return nil
+}
@@ -0,0 +1,156 @@
+package hapair
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// VirtualAddress is a TCP proxy standing in for the virtual address of an HA pair. Host
+// connections are forwarded to the active instance; on failover the active instance
+// changes and established connections are dropped, as they are when a real virtual
+// address moves between HSMs.
+type VirtualAddress struct {
+	// Backends are the HSM addresses of the pair, the first one initially active.
+	Backends []string
+	// CheckInterval is the period of the health check of the active backend.
+	CheckInterval time.Duration
+	// FlipEvery, when positive, forces a failover at this period (failover test mode).
+	FlipEvery time.Duration
+
+	active atomic.Int32
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+}
+
+// Active returns the address of the active backend.
+func (v *VirtualAddress) Active() string {
+	return v.Backends[int(v.active.Load())%len(v.Backends)]
+}
+
+// Failover moves the virtual address to the next backend and drops host connections.
+func (v *VirtualAddress) Failover() {
+	from := v.Active()
+	v.active.Add(1)
+	log.Warn().Str("from", from).Str("to", v.Active()).Msg("ha virtual address failover")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for conn := range v.conns {
+		_ = conn.Close()
+	}
+}
+
+// Serve accepts host connections on ln until ctx is canceled.
+func (v *VirtualAddress) Serve(ctx context.Context, ln net.Listener) error {
+	if len(v.Backends) == 0 {
+		return errors.New("virtual address requires at least one backend")
+	}
+	v.mu.Lock()
+	v.conns = make(map[net.Conn]struct{})
+	v.mu.Unlock()
+
+	stop := context.AfterFunc(ctx, func() { _ = ln.Close() })
+	defer stop()
+
+	go v.monitor(ctx)
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return fmt.Errorf("accept failed: %w", err)
+		}
+		go v.proxy(conn)
+	}
+}
+
+func (v *VirtualAddress) proxy(host net.Conn) {
+	backend, err := net.DialTimeout("tcp", v.Active(), v.checkInterval())
+	if err != nil {
+		log.Error().Err(err).Str("backend", v.Active()).Msg("ha active backend unreachable")
+		_ = host.Close()
+
+		return
+	}
+
+	v.track(host, backend, true)
+	defer v.track(host, backend, false)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	pipe := func(dst, src net.Conn) {
+		defer wg.Done()
+		_, _ = io.Copy(dst, src)
+		_ = dst.Close()
+		_ = src.Close()
+	}
+	go pipe(backend, host)
+	go pipe(host, backend)
+	wg.Wait()
+}
+
+func (v *VirtualAddress) track(host, backend net.Conn, add bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if add {
+		v.conns[host] = struct{}{}
+		v.conns[backend] = struct{}{}
+
+		return
+	}
+	delete(v.conns, host)
+	delete(v.conns, backend)
+}
+
+// monitor fails over when the active backend stops accepting connections, and at every
+// FlipEvery period in failover test mode.
+func (v *VirtualAddress) monitor(ctx context.Context) {
+	check := time.NewTicker(v.checkInterval())
+	defer check.Stop()
+
+	var flip <-chan time.Time
+	if v.FlipEvery > 0 {
+		t := time.NewTicker(v.FlipEvery)
+		defer t.Stop()
+		flip = t.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-flip:
+			v.Failover()
+		case <-check.C:
+			conn, err := net.DialTimeout("tcp", v.Active(), v.checkInterval())
+			if err != nil {
+				log.Warn().Err(err).Str("backend", v.Active()).Msg("ha health check failed")
+				v.Failover()
+
+				continue
+			}
+			_ = conn.Close()
+		}
+	}
+}
+
+func (v *VirtualAddress) checkInterval() time.Duration {
+	if v.CheckInterval <= 0 {
+		return time.Second
+	}
+
+	return v.CheckInterval
+}
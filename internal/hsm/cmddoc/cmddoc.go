@@ -0,0 +1,140 @@
+// Package cmddoc provides usage descriptors for HSM commands: field layouts and error codes
+// of each command, shipped with the server and overridable by plugin companion files.
+package cmddoc
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// descriptorExt is the file extension of command descriptor files.
+const descriptorExt = ".json"
+
+//go:embed descriptors/*.json
+var builtin embed.FS
+
+// ErrNotFound indicates that no descriptor exists for a command.
+var ErrNotFound = errors.New("command descriptor not found")
+
+// Field describes one field of a command request or response.
+type Field struct {
+	Name        string `json:"name"`
+	Length      string `json:"length"`
+	Description string `json:"description"`
+}
+
+// ErrorCode describes an error code a command may return.
+type ErrorCode struct {
+	Code    string `json:"code"`
+	Meaning string `json:"meaning"`
+}
+
+// Descriptor documents a single HSM command.
+type Descriptor struct {
+	Command  string      `json:"command"`
+	Response string      `json:"response"`
+	Title    string      `json:"title"`
+	Synopsis string      `json:"synopsis"`
+	Request  []Field     `json:"request"`
+	Reply    []Field     `json:"reply"`
+	Errors   []ErrorCode `json:"errors"`
+}
+
+// Parse decodes a descriptor and checks that it names a two character command.
+func Parse(r io.Reader) (*Descriptor, error) {
+	var d Descriptor
+	if err := json.NewDecoder(r).Decode(&d); err != nil {
+		return nil, fmt.Errorf("invalid command descriptor: %w", err)
+	}
+	if len(d.Command) != 2 {
+		return nil, fmt.Errorf("invalid command descriptor: command code %q", d.Command)
+	}
+
+	return &d, nil
+}
+
+// Lookup returns the descriptor of cmd. A companion file <cmd>.json in pluginDir takes
+// precedence over the built-in descriptor; pluginDir may be empty.
+func Lookup(cmd, pluginDir string) (*Descriptor, error) {
+	cmd = strings.ToUpper(cmd)
+	if pluginDir != "" {
+		f, err := os.Open(filepath.Join(pluginDir, cmd+descriptorExt))
+		if err == nil {
+			defer func() { _ = f.Close() }()
+
+			return Parse(f)
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("open descriptor for %s: %w", cmd, err)
+		}
+	}
+
+	f, err := builtin.Open("descriptors/" + cmd + descriptorExt)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, cmd)
+	}
+	defer func() { _ = f.Close() }()
+
+	return Parse(f)
+}
+
+// Commands returns the sorted codes of all documented commands, including companion files
+// in pluginDir.
+func Commands(pluginDir string) []string {
+	var cmds []string
+	entries, _ := builtin.ReadDir("descriptors")
+	if pluginDir != "" {
+		if extra, err := os.ReadDir(pluginDir); err == nil {
+			entries = append(entries, extra...)
+		}
+	}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), descriptorExt)
+		if ok && len(name) == 2 && !slices.Contains(cmds, name) {
+			cmds = append(cmds, name)
+		}
+	}
+	slices.Sort(cmds)
+
+	return cmds
+}
+
+// Write renders the descriptor as text.
+func (d *Descriptor) Write(out io.Writer) error {
+	if _, err := fmt.Fprintf(out, "%s - %s\n%s\n", d.Command, d.Title, d.Synopsis); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	writeFields(w, "Request ("+d.Command+")", d.Request)
+	writeFields(w, "Response ("+d.Response+")", d.Reply)
+	_, _ = fmt.Fprintln(w, "\nError Codes")
+	_, _ = fmt.Fprintln(w, "Code\tMeaning")
+	for _, e := range d.Errors {
+		_, _ = fmt.Fprintf(w, "%s\t%s\n", e.Code, e.Meaning)
+	}
+
+	return w.Flush()
+}
+
+// writeFields writes a titled field table.
+func writeFields(w io.Writer, title string, fields []Field) {
+	_, _ = fmt.Fprintf(w, "\n%s\n", title)
+	if len(fields) == 0 {
+		_, _ = fmt.Fprintln(w, "(no fields)")
+		return
+	}
+	_, _ = fmt.Fprintln(w, "Field\tLength\tDescription")
+	for _, f := range fields {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", f.Name, f.Length, f.Description)
+	}
+}
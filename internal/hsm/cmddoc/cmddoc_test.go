@@ -0,0 +1,83 @@
+package cmddoc
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestEveryPluginDocumented verifies that each command plugin has a built-in descriptor.
+func TestEveryPluginDocumented(t *testing.T) {
+	t.Parallel()
+
+	entries, err := os.ReadDir("../../commands/plugins")
+	if err != nil {
+		t.Fatalf("read plugins: %v", err)
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		d, err := Lookup(e.Name(), "")
+		if err != nil {
+			t.Errorf("Lookup(%s): %v", e.Name(), err)
+			continue
+		}
+		if d.Command != e.Name() || d.Response == "" || len(d.Errors) == 0 {
+			t.Errorf("incomplete descriptor for %s: %+v", e.Name(), d)
+		}
+	}
+}
+
+func TestLookupCompanionFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	companion := `{"command":"DC","response":"DD","title":"Custom DC","synopsis":"Site specific."}`
+	if err := os.WriteFile(filepath.Join(dir, "DC.json"), []byte(companion), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ZZ.json"), []byte(`{"command":"ZZ"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := Lookup("dc", dir)
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if d.Title != "Custom DC" {
+		t.Errorf("title = %q, want companion title", d.Title)
+	}
+	if d, err := Lookup("CW", dir); err != nil || d.Command != "CW" {
+		t.Errorf("expected built-in CW descriptor, got %+v, %v", d, err)
+	}
+	if _, err := Lookup("QQ", dir); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	cmds := Commands(dir)
+	if !strings.Contains(strings.Join(cmds, ","), "ZZ") || cmds[0] != "A0" {
+		t.Errorf("unexpected command list %v", cmds)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	t.Parallel()
+
+	d, err := Lookup("DC", "")
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := d.Write(&buf); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	for _, want := range []string{"DC - Verify a Terminal PIN", "Request (DC)", "Response (DD)", "PVKI", "Error Codes"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, buf.String())
+		}
+	}
+}
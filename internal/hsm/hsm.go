@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/andrei-cloud/go_hsm/internal/authstate"
 	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
 	"github.com/andrei-cloud/go_hsm/pkg/pinblock"
 	"github.com/andrei-cloud/go_hsm/pkg/variantlmk"
@@ -17,11 +18,12 @@ var errUnknownThalesPinBlockFormat = errors.New("unknown thales pin block format
 
 // HSM represents the hardware security module server.
 // It holds the Variant LMK set for scheme-based encryption,
-// firmware version, and PCI compliance mode.
+// firmware version, PCI compliance mode and the authorized state of the LMKs.
 type HSM struct {
 	VariantLmkSet   variantlmk.LMKSet
 	PciMode         bool
 	FirmwareVersion string
+	Authorization   *authstate.State
 }
 
 // NewHSM creates a new HSM instance.
@@ -37,6 +39,7 @@ func NewHSM(firmwareVersion string, pciMode bool) (*HSM, error) {
 		VariantLmkSet:   variantLmkSet,
 		PciMode:         pciMode,
 		FirmwareVersion: firmwareVersion,
+		Authorization:   authstate.NewState(),
 	}, nil
 }
 
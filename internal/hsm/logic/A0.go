@@ -7,10 +7,53 @@ import (
 
 	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
 	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+	"github.com/andrei-cloud/go_hsm/pkg/keyexport"
+	"github.com/andrei-cloud/go_hsm/pkg/keyschemes"
+	"github.com/andrei-cloud/go_hsm/pkg/msgspec"
 )
 
+// a0KeyBlockUsages maps key type codes to the key usage of keys exported in AES key blocks.
+var a0KeyBlockUsages = map[string]string{
+	"000": "K0", // ZMK
+	"001": "P0", // ZPK
+	"002": "P0", // TPK
+	"003": "M3", // TAK
+	"008": "M3", // ZAK
+	"009": "B0", // BDK
+	"00A": "D0", // ZEK
+	"109": "E0", // MK-AC
+	"209": "E2", // MK-SMI
+	"309": "E1", // MK-SMC
+	"402": "C0", // CVK
+}
+
+// a0KeyBlockAlgorithms maps the 2-character algorithm field of A0 key block attributes to the
+// key block algorithm and the key length in bytes.
+var a0KeyBlockAlgorithms = map[string]struct {
+	algorithm byte
+	length    int
+}{
+	"T2": {'T', 16}, // double length TDES
+	"T3": {'T', 24}, // triple length TDES
+	"A1": {'A', 16}, // AES-128
+	"A2": {'A', 24}, // AES-192
+	"A3": {'A', 32}, // AES-256
+}
+
 // ExecuteA0 processes the A0 payload and returns response bytes.
 // It always returns: "A1" + "00" + U|hex(newkey under lmk) [+ U|hex(neyKey under ZMK)] + 6-hex-digit KCV of new clear key.
+// In mode 1 an optional export scheme may follow the ZMK: X/Y (ANSI X9.17 ECB),
+// C (TDES CBC, zero IV), U/T (Thales variant) or R (AES key block, TR-31 version D, with
+// the ZMK used as AES key). The key under ZMK is then returned with that tag. An LMK
+// identifier may follow as '%' and two digits.
+//
+// Key scheme S generates a key under a key block LMK: the key type is FFF and the key block
+// attributes follow as '#' + key usage (2A) + algorithm (2A: T2, T3, A1, A2 or A3) + mode of
+// use (1A) + key version number (2N) + exportability (1A) + number of optional blocks (2N,
+// 00). The key is returned as an S key block under the LMK named by the LMK identifier,
+// followed by ';' when its header carries no block length, and in mode 1 as an R key block
+// under the ZMK unless another export scheme is given.
 func ExecuteA0(input []byte) ([]byte, error) {
 	// Validate minimum input length: mode(1) + keytype(3) + scheme(1)
 	if len(input) < 5 {
@@ -40,76 +83,85 @@ func ExecuteA0(input []byte) ([]byte, error) {
 
 	// Validate key scheme
 	if keyScheme != 'Z' && keyScheme != 'U' && keyScheme != 'T' && keyScheme != 'X' &&
-		keyScheme != 'Y' {
+		keyScheme != 'Y' && keyScheme != keyschemes.SchemeS {
 		logError("A0: Invalid key scheme")
 		return nil, errorcodes.Err26
 	}
 
-	keyLength := getKeyLength(keyScheme)
-	logInfo("A0: Generating random key.")
-	logDebug(fmt.Sprintf("A0: Random key length: %d", keyLength))
-
-	// Generate random key with proper length
-	clearKey, err := LMKProviderInstance.RandomKey(keyLength)
+	// The ZMK section may be introduced by ';', an LMK identifier by '%' and key block
+	// attributes by '#'.
+	trailer, err := parseTrailingFields("A0", remainder, ";%#")
 	if err != nil {
-		logError("A0: Failed to generate random key")
-		return nil, errors.Join(errors.New("generate random key"), err)
+		return nil, err
 	}
 
-	logDebug(fmt.Sprintf("A0: Generated clear key (hex): %s", cryptoutils.Raw2Str(clearKey)))
+	var (
+		key         generatedKey
+		cryptograms []keyCryptogram
+		kbHeader    *keyexport.KeyBlockHeader
+	)
+	if keyScheme == keyschemes.SchemeS {
+		var block []byte
+		key, block, kbHeader, err = generateA0KeyBlock(keyType, trailer)
+		if err != nil {
+			return nil, err
+		}
+		cryptograms = append(cryptograms, encodedCryptogram(block))
+	} else {
+		keyLength := keyschemes.Length(keyScheme)
+		logDebug(fmt.Sprintf("A0: Random key length: %d", keyLength))
 
-	// Calculate KCV using hex-encoded key
-	logInfo("A0: Calculating key check value.")
-	kcv, err := cryptoutils.KeyCV([]byte(cryptoutils.Raw2Str(clearKey)), 6)
-	if err != nil {
-		logError("A0: Failed to calculate KCV")
-		return nil, errors.Join(errors.New("failed calculate kcv"), err)
-	}
+		// Every cryptogram and the KCV are taken from this one key.
+		key, err = generateKey("A0", keyLength)
+		if err != nil {
+			return nil, err
+		}
 
-	logDebug(fmt.Sprintf("A0: Calculated KCV: %s", string(kcv)))
+		logDebug(fmt.Sprintf("A0: Generated clear key (hex): %s", cryptoutils.Raw2Str(key.clear)))
+		logDebug(fmt.Sprintf("A0: Calculated KCV: %s", string(key.kcv)))
 
-	// Encrypt key under LMK
-	logInfo("A0: Encrypting key under LMK.")
-	lmkEncryptedKey, err := LMKProviderInstance.EncryptUnderLMK(clearKey, keyType, keyScheme)
-	if err != nil {
-		logError("A0: Failed to encrypt key under LMK")
-		return nil, errors.Join(errors.New("encrypt under lmk"), err)
-	}
+		// Encrypt key under LMK
+		logInfo("A0: Encrypting key under LMK.")
+		lmkEncryptedKey, err := LMKProviderInstance.EncryptUnderLMK(key.clear, keyType, keyScheme)
+		if err != nil {
+			logError("A0: Failed to encrypt key under LMK")
+			return nil, errors.Join(errors.New("encrypt under lmk"), err)
+		}
 
-	logDebug(
-		fmt.Sprintf("A0: Key encrypted under LMK (hex): %s", cryptoutils.Raw2Str(lmkEncryptedKey)),
-	)
+		logDebug(
+			fmt.Sprintf("A0: Key encrypted under LMK (hex): %s", cryptoutils.Raw2Str(lmkEncryptedKey)),
+		)
 
-	// Build response
-	resp := []byte("A100")
-	resp = appendEncryptedKeyToResponse(resp, keyScheme, lmkEncryptedKey)
+		cryptograms = append(cryptograms, taggedCryptogram(keyScheme, lmkEncryptedKey))
+	}
+	clearKey := key.clear
 
 	// Handle mode 1 - encrypt under ZMK/TMK if provided
 	if mode == '1' {
 		logInfo("A0: Processing ZMK encryption mode.")
 		logDebug("A0: Parsing ZMK parameters.")
 
-		idx := 0
-		if idx < len(remainder) && remainder[idx] == ';' {
-			idx++
+		zmkSection, ok := trailer.Field(msgspec.DelimKeySchemes)
+		if !ok {
+			zmkSection = trailer.Positional
 		}
-		if idx >= len(remainder) {
+		if len(zmkSection) == 0 {
 			logError("A0: Input data too short for ZMK mode")
 			return nil, errorcodes.Err15
 		}
 
-		zmkScheme := remainder[idx]
+		zmkScheme := zmkSection[0]
 		if zmkScheme != 'U' && zmkScheme != 'T' {
 			return nil, errorcodes.Err05
 		}
-		idx++
+		idx := 1
 
-		hexLen := getKeyLength(zmkScheme) * 2 // Convert bytes to hex chars
-		if len(remainder) < idx+hexLen {
+		hexLen := keyschemes.Length(zmkScheme) * 2 // Convert bytes to hex chars
+		if len(zmkSection) < idx+hexLen {
 			return nil, errorcodes.Err15
 		}
 
-		hexZmk := remainder[idx : idx+hexLen]
+		hexZmk := zmkSection[idx : idx+hexLen]
 		logDebug(fmt.Sprintf("A0 processing ZMK (hex): %s", string(hexZmk)))
 
 		zmkBytes, err := hex.DecodeString(string(hexZmk))
@@ -117,26 +169,173 @@ func ExecuteA0(input []byte) ([]byte, error) {
 			return nil, errors.Join(errors.New("zmk to binary"), err)
 		}
 
-		zmkEncryptedKey, err := encryptKeyUnderZMK(clearKey, zmkBytes)
-		if err != nil {
-			return nil, err
+		idx += hexLen
+
+		// Optional export scheme selects how the key is wrapped under the ZMK. Keys under a
+		// key block LMK are exported in key blocks by default.
+		exportTag := byte(0)
+		if idx < len(zmkSection) {
+			exportTag = zmkSection[idx]
+		} else if kbHeader != nil {
+			exportTag = byte(keyexport.SchemeKeyBlock)
 		}
+		if exportTag != 0 {
+			exported, err := exportKeyUnderZMK(clearKey, zmkBytes, keyType, exportTag, kbHeader)
+			if err != nil {
+				return nil, err
+			}
+			cryptograms = append(cryptograms, encodedCryptogram(exported))
+		} else {
+			zmkEncryptedKey, err := encryptKeyUnderZMK(clearKey, zmkBytes)
+			if err != nil {
+				return nil, err
+			}
 
-		logDebug(
-			fmt.Sprintf(
-				"A0 key encrypted under ZMK (hex): %s",
-				cryptoutils.Raw2Str(zmkEncryptedKey),
-			),
-		)
+			logDebug(
+				fmt.Sprintf(
+					"A0 key encrypted under ZMK (hex): %s",
+					cryptoutils.Raw2Str(zmkEncryptedKey),
+				),
+			)
 
-		// append encrypted under ZMK using its scheme tag
-		resp = appendEncryptedKeyToResponse(resp, keyScheme, zmkEncryptedKey)
+			// the key under ZMK carries the scheme tag of the generated key.
+			cryptograms = append(cryptograms, taggedCryptogram(keyScheme, zmkEncryptedKey))
+		}
 	}
 
-	// Append KCV
-	resp = append(resp, kcv...)
+	resp := buildKeyResponse("A1", key.kcv, cryptograms...)
 
 	logDebug(fmt.Sprintf("A0 final response: %s", string(resp)))
 
 	return resp, nil
 }
+
+// exportKeyUnderZMK wraps clearKey under the ZMK with the export scheme selected by tag and
+// returns the tagged response field. Key blocks take the attributes of kbHeader, when set,
+// or those of keyType.
+func exportKeyUnderZMK(
+	clearKey, zmkBytes []byte,
+	keyType string,
+	tag byte,
+	kbHeader *keyexport.KeyBlockHeader,
+) ([]byte, error) {
+	scheme, err := keyexport.ParseScheme(tag)
+	if err != nil {
+		logError("A0: invalid export scheme")
+		return nil, errorcodes.Err26
+	}
+
+	rawZmk, err := decryptZMK(zmkBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts keyexport.Options
+	switch {
+	case scheme == keyexport.SchemeKeyBlock && kbHeader != nil:
+		if kbHeader.Exportability != 'E' && kbHeader.Exportability != 'S' {
+			logError("A0: key block is not exportable")
+			return nil, errorcodes.ErrAA
+		}
+		opts.Header = *kbHeader
+	case scheme == keyexport.SchemeKeyBlock:
+		usage, ok := a0KeyBlockUsages[keyType]
+		if !ok {
+			logError("A0: key type not supported in key blocks")
+			return nil, errorcodes.Err04
+		}
+		opts.Header = keyexport.KeyBlockHeader{
+			KeyUsage:      usage,
+			Algorithm:     'T',
+			ModeOfUse:     'N',
+			KeyVersion:    "00",
+			Exportability: 'E',
+		}
+	}
+
+	logInfo(fmt.Sprintf("A0: exporting key under ZMK with scheme %c", tag))
+	wrapped, err := keyexport.Wrap(scheme, rawZmk, clearKey, opts)
+	if err != nil {
+		logError("A0: failed to export key under ZMK")
+		return nil, errors.Join(errors.New("export key under zmk"), err)
+	}
+	if scheme == keyexport.SchemeKeyBlock {
+		return append([]byte{tag}, wrapped...), nil
+	}
+	logDebug(fmt.Sprintf("A0 key exported under ZMK (hex): %s", cryptoutils.Raw2Str(wrapped)))
+
+	return append([]byte{tag}, cryptoutils.Raw2B(wrapped)...), nil
+}
+
+// generateA0KeyBlock generates a key with the key block attributes introduced by '#' in
+// trailer and wraps it in an S key block under the key block LMK named by the LMK
+// identifier. It returns the key, the key block and the attributes for export.
+func generateA0KeyBlock(
+	keyType string,
+	trailer *msgspec.Tokens,
+) (generatedKey, []byte, *keyexport.KeyBlockHeader, error) {
+	if keyType != keyBlockKeyType {
+		logError("A0: key type must be FFF for key block keys")
+		return generatedKey{}, nil, nil, errorcodes.Err04
+	}
+	attrs, ok := trailer.Field(msgspec.DelimKeyBlockHeader)
+	if !ok || len(attrs) != 2+2+1+2+1+2 {
+		logError("A0: missing or invalid key block attributes")
+		return generatedKey{}, nil, nil, errorcodes.Err15
+	}
+	alg, ok := a0KeyBlockAlgorithms[string(attrs[2:4])]
+	if !ok {
+		logError(fmt.Sprintf("A0: unsupported key block algorithm %s", attrs[2:4]))
+		return generatedKey{}, nil, nil, errorcodes.Err15
+	}
+	if string(attrs[8:10]) != "00" {
+		logError("A0: optional blocks are not supported")
+		return generatedKey{}, nil, nil, errorcodes.Err15
+	}
+
+	lmkID := DefaultKeyBlockLMKID
+	if id, ok := trailer.Field(msgspec.DelimLMKID); ok {
+		lmkID = string(id)
+	}
+	if _, err := LookupKeyBlockLMK(lmkID); err != nil {
+		logError(fmt.Sprintf("A0: LMK %s is not a key block LMK", lmkID))
+		return generatedKey{}, nil, nil, errorcodes.Err13
+	}
+
+	header := keyexport.KeyBlockHeader{
+		KeyUsage:      string(attrs[0:2]),
+		Algorithm:     alg.algorithm,
+		ModeOfUse:     attrs[4],
+		KeyVersion:    string(attrs[5:7]),
+		Exportability: attrs[7],
+	}
+	// The header template names the LMK; the block length is set when the key is wrapped.
+	template := fmt.Appendf(nil, "S10000%s%c%c%s%c00%s", header.KeyUsage, header.Algorithm,
+		header.ModeOfUse, header.KeyVersion, header.Exportability, lmkID)
+	if _, err := keyblocklmk.ParseHeader(template); err != nil {
+		logError(fmt.Sprintf("A0: invalid key block attributes: %v", err))
+		return generatedKey{}, nil, nil, errorcodes.Err15
+	}
+
+	generate := generateKey
+	if alg.algorithm == 'A' {
+		generate = generateAESKey
+	}
+	key, err := generate("A0", alg.length)
+	if err != nil {
+		return generatedKey{}, nil, nil, err
+	}
+
+	logInfo("A0: Wrapping key in a key block under LMK.")
+	block, err := LMKProviderInstance.EncryptUnderLMK(key.clear, string(template), keyschemes.SchemeS)
+	if err != nil {
+		logError("A0: Failed to wrap key under LMK")
+		return generatedKey{}, nil, nil, errors.Join(errors.New("wrap under lmk"), err)
+	}
+	// Without a block length in the header the response marks the end of the block.
+	if len(block) > 5 && string(block[2:6]) == "0000" {
+		block = append(block, msgspec.DelimKeySchemes)
+	}
+
+	return key, block, &header, nil
+}
@@ -1,10 +1,15 @@
 package logic
 
 import (
+	"bytes"
 	"encoding/hex"
+	"errors"
 	"testing"
 
 	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+	"github.com/andrei-cloud/go_hsm/pkg/keyexport"
 )
 
 func TestExecuteA0(t *testing.T) {
@@ -124,3 +129,189 @@ func TestExecuteA0(t *testing.T) {
 		})
 	}
 }
+
+func TestExecuteA0ExportSchemes(t *testing.T) {
+	t.Parallel()
+
+	if err := SetupTestLMKProvider(); err != nil {
+		t.Fatalf("Failed to setup test LMK provider: %v", err)
+	}
+
+	// The test provider decrypts the ZMK to itself and generates a deterministic key.
+	const zmkHex = "1C1C1C1C1C1C1C1C1F1F1F1F1F1F1F1F"
+	zmk, _ := hex.DecodeString(zmkHex)
+	clearKey, _ := testRandomKey(16)
+
+	for _, tag := range []byte{'X', 'C', 'U', 'R'} {
+		t.Run(string(tag), func(t *testing.T) {
+			t.Parallel()
+
+			resp, err := ExecuteA0([]byte("1001U;U" + zmkHex + string(tag)))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			// A100 + U + 32H (under LMK), then the tagged key under ZMK, then 6H KCV.
+			exported := resp[37 : len(resp)-6]
+			if exported[0] != tag {
+				t.Fatalf("expected export tag %c, got %c", tag, exported[0])
+			}
+
+			scheme, _ := keyexport.ParseScheme(tag)
+			wrapped := exported[1:]
+			if scheme != keyexport.SchemeKeyBlock {
+				wrapped, _ = hex.DecodeString(string(wrapped))
+			}
+			got, _, err := keyexport.Unwrap(scheme, zmk, wrapped)
+			if err != nil {
+				t.Fatalf("unwrap failed: %v", err)
+			}
+			if !bytes.Equal(got, clearKey) {
+				t.Errorf("exported key = %X, want %X", got, clearKey)
+			}
+		})
+	}
+
+	if _, err := ExecuteA0([]byte("1001U;U" + zmkHex + "Q")); err != errorcodes.Err26 {
+		t.Errorf("expected Err26 for unknown export scheme, got %v", err)
+	}
+	if _, err := ExecuteA0([]byte("1FFFU;U" + zmkHex + "R")); err != errorcodes.Err04 {
+		t.Errorf("expected Err04 for key type without key block usage, got %v", err)
+	}
+}
+
+func TestExecuteA0TrailingFields(t *testing.T) {
+	t.Parallel()
+
+	if err := SetupTestLMKProvider(); err != nil {
+		t.Fatalf("Failed to setup test LMK provider: %v", err)
+	}
+
+	const zmkHex = "1C1C1C1C1C1C1C1C1F1F1F1F1F1F1F1F"
+	tests := []struct {
+		name    string
+		input   string
+		wantErr error
+	}{
+		{"mode 0 with LMK identifier", "0001U%00", nil},
+		{"ZMK without delimiter", "1001UU" + zmkHex + "%01", nil},
+		{"ZMK with delimiter", "1001U;U" + zmkHex + "X%00", nil},
+		{"non numeric LMK identifier", "0001U%A1", errorcodes.Err13},
+		{"unregistered LMK identifier", "1001U;U" + zmkHex + "%55", errorcodes.Err13},
+		{"short LMK identifier", "0001U%0", errorcodes.Err13},
+		{"repeated LMK identifier", "0001U%00%01", errorcodes.Err15},
+		{"missing ZMK", "1001U%00", errorcodes.Err15},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			resp, err := ExecuteA0([]byte(tc.input))
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("ExecuteA0(%q) error = %v, want %v", tc.input, err, tc.wantErr)
+			}
+			if tc.wantErr == nil && !bytes.HasPrefix(resp, []byte("A100")) {
+				t.Errorf("ExecuteA0(%q) = %q, want A100 response", tc.input, resp)
+			}
+		})
+	}
+}
+
+func TestExecuteA0KeyBlock(t *testing.T) {
+	t.Parallel()
+
+	if err := SetupTestLMKProvider(); err != nil {
+		t.Fatalf("Failed to setup test LMK provider: %v", err)
+	}
+
+	const zmkHex = "1C1C1C1C1C1C1C1C1F1F1F1F1F1F1F1F"
+	tests := []struct {
+		name      string
+		input     string
+		usage     string
+		algorithm byte
+		keyLen    int
+		exported  bool
+	}{
+		{"TDES under default LMK", "0FFFS#P0T2B00E00", "P0", 'T', 16, false},
+		{"AES-256 with LMK identifier", "0FFFS%01#K0A3B00N00", "K0", 'A', 32, false},
+		{"TDES exported under ZMK", "1FFFS;U" + zmkHex + "#P0T3E01E00", "P0", 'T', 24, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			resp, err := ExecuteA0([]byte(tc.input))
+			if err != nil {
+				t.Fatalf("ExecuteA0(%q) error = %v", tc.input, err)
+			}
+			if !bytes.HasPrefix(resp, []byte("A100S")) {
+				t.Fatalf("ExecuteA0(%q) = %q, want A100 and an S key block", tc.input, resp)
+			}
+			block, rest, err := keyblocklmk.SplitKeyBlock(resp[4:])
+			if err != nil {
+				t.Fatalf("SplitKeyBlock() error = %v", err)
+			}
+			header, clearKey, err := keyblocklmk.UnwrapKeyBlock(keyblocklmk.DefaultTestAESLMK, block)
+			if err != nil {
+				t.Fatalf("UnwrapKeyBlock() error = %v", err)
+			}
+			if header.KeyUsage != tc.usage || header.Algorithm != tc.algorithm || header.KeyContext != 1 ||
+				len(clearKey) != tc.keyLen {
+				t.Errorf("header = %+v, key length %d", header, len(clearKey))
+			}
+
+			if tc.exported {
+				if len(rest) == 0 || rest[0] != 'R' {
+					t.Fatalf("response tail = %q, want an R key block", rest)
+				}
+				_, rest, err = keyblocklmk.SplitKeyBlock(rest)
+				if err != nil {
+					t.Fatalf("SplitKeyBlock() of the exported key error = %v", err)
+				}
+			}
+
+			want, _ := cryptoutils.KeyCV(cryptoutils.Raw2B(clearKey), 6)
+			if tc.algorithm == 'A' {
+				cv, _ := keyblocklmk.CalculateCMACCheckValue(clearKey)
+				want = cryptoutils.Raw2B(cv)[:6]
+			}
+			if !bytes.Equal(rest, want) {
+				t.Errorf("KCV = %s, want %s", rest, want)
+			}
+		})
+	}
+}
+
+func TestExecuteA0KeyBlockErrors(t *testing.T) {
+	t.Parallel()
+
+	if err := SetupTestLMKProvider(); err != nil {
+		t.Fatalf("Failed to setup test LMK provider: %v", err)
+	}
+
+	const zmkHex = "1C1C1C1C1C1C1C1C1F1F1F1F1F1F1F1F"
+	tests := []struct {
+		name    string
+		input   string
+		wantErr error
+	}{
+		{"variant key type", "0001S#P0T2B00E00", errorcodes.Err04},
+		{"missing attributes", "0FFFS", errorcodes.Err15},
+		{"short attributes", "0FFFS#P0T2B00E", errorcodes.Err15},
+		{"unknown algorithm", "0FFFS#P0X1B00E00", errorcodes.Err15},
+		{"optional blocks", "0FFFS#P0T2B00E01", errorcodes.Err15},
+		{"variant LMK", "0FFFS%00#P0T2B00E00", errorcodes.Err13},
+		{"non-exportable key under ZMK", "1FFFS;U" + zmkHex + "#P0T2B00N00", errorcodes.ErrAA},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := ExecuteA0([]byte(tc.input))
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("ExecuteA0(%q) error = %v, want %v", tc.input, err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package logic
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/keyexport"
+	"github.com/andrei-cloud/go_hsm/pkg/keyschemes"
+)
+
+// exchangeSchemes lists the key scheme tags of keys imported or exported under a ZMK.
+const exchangeSchemes = "ZUTXY"
+
+// ExecuteA6 imports a key encrypted under a ZMK and returns it under the LMK.
+// Format: Key type (3H) + ZMK (32H or U/T+32H/48H) + Key under ZMK (32H or Z/U/T/X/Y+16H/
+// 32H/48H) + Key scheme LMK (1A). The key under ZMK is unwrapped with ANSI X9.17 ECB for
+// Z/X/Y and unprefixed keys, and with the Thales ZMK variants for U/T. An LMK identifier
+// may follow the request as '%' and two digits.
+// Response: "A7" + "00" + Key under LMK + KCV (6H).
+func ExecuteA6(input []byte) ([]byte, error) {
+	logInfo("A6: starting key import from ZMK to LMK")
+
+	keyType, data, err := parseExchangeKeyType("A6", input)
+	if err != nil {
+		return nil, err
+	}
+	clearZmk, data, err := parseExchangeZMK("A6", data)
+	if err != nil {
+		return nil, err
+	}
+
+	key, data, err := keyschemes.Parse(data, exchangeSchemes, 32)
+	if err != nil {
+		logError(fmt.Sprintf("A6: invalid key under ZMK: %v", err))
+		return nil, errorcodes.Err15
+	}
+	keyBytes, err := key.Bytes()
+	if err != nil {
+		logError("A6: invalid key hex format")
+		return nil, errorcodes.Err15
+	}
+
+	if len(data) < 1 {
+		logError("A6: missing LMK key scheme")
+		return nil, errorcodes.Err15
+	}
+	lmkScheme := data[0]
+	if keyschemes.Length(lmkScheme) == 0 {
+		logError(fmt.Sprintf("A6: invalid LMK key scheme %c", lmkScheme))
+		return nil, errorcodes.Err26
+	}
+	if _, err := parseTrailingFields("A6", data[1:], "%"); err != nil {
+		return nil, err
+	}
+
+	logInfo("A6: decrypting key under ZMK")
+	clearKey, _, err := keyexport.Unwrap(exchangeScheme(key.Scheme), clearZmk, keyBytes)
+	if err != nil {
+		logError(fmt.Sprintf("A6: key unwrap under ZMK failed: %v", err))
+		return nil, errorcodes.Err68
+	}
+	if err := checkExchangeKey("A6", clearKey); err != nil {
+		return nil, err
+	}
+	if len(clearKey) != keyschemes.Length(lmkScheme) {
+		logError(fmt.Sprintf("A6: %d byte key cannot use LMK key scheme %c",
+			len(clearKey), lmkScheme))
+		return nil, errorcodes.Err27
+	}
+
+	logInfo("A6: encrypting key under LMK")
+	lmkEncryptedKey, err := LMKProviderInstance.EncryptUnderLMK(clearKey, keyType, lmkScheme)
+	if err != nil {
+		logError("A6: key encryption under LMK failed")
+		return nil, errors.Join(errors.New("encrypt under lmk"), err)
+	}
+
+	kcv, err := cryptoutils.KeyCV(cryptoutils.Raw2B(clearKey), 6)
+	if err != nil {
+		logError("A6: KCV calculation failed")
+		return nil, errors.Join(errors.New("calculate kcv"), err)
+	}
+	logInfo("A6: key imported")
+
+	return buildKeyResponse("A7", kcv, taggedCryptogram(lmkScheme, lmkEncryptedKey)), nil
+}
+
+// parseExchangeKeyType reads the key type at the start of data and checks that keys of that
+// type may be exchanged under a ZMK.
+func parseExchangeKeyType(cmd string, data []byte) (string, []byte, error) {
+	if len(data) < 3 {
+		logError(cmd + ": missing key type")
+		return "", nil, errorcodes.Err15
+	}
+	keyType := string(data[:3])
+	if _, ok := a0KeyBlockUsages[keyType]; !ok {
+		logError(fmt.Sprintf("%s: key type %s cannot be exchanged under a ZMK", cmd, keyType))
+		return "", nil, errorcodes.Err04
+	}
+
+	return keyType, data[3:], nil
+}
+
+// parseExchangeZMK reads the ZMK under LMK at the start of data and returns it in the clear
+// with the bytes that follow. A ZMK without scheme is double-length.
+func parseExchangeZMK(cmd string, data []byte) ([]byte, []byte, error) {
+	zmk, rest, err := keyschemes.Parse(data, "UT", 32)
+	if err != nil {
+		logError(fmt.Sprintf("%s: invalid ZMK: %v", cmd, err))
+		return nil, nil, errorcodes.Err15
+	}
+	zmkBytes, err := zmk.Bytes()
+	if err != nil {
+		logError(cmd + ": invalid ZMK hex format")
+		return nil, nil, errorcodes.Err15
+	}
+
+	logInfo(fmt.Sprintf("%s: decrypting ZMK under LMK", cmd))
+	clearZmk, err := decryptZMK(zmkBytes)
+	if err != nil {
+		logError(fmt.Sprintf("%s: ZMK decryption failed", cmd))
+		return nil, nil, errorcodes.Err68
+	}
+	if isAllZero(clearZmk) || !cryptoutils.CheckKeyParity(clearZmk) {
+		logError(fmt.Sprintf("%s: ZMK is all zeros or fails the parity check", cmd))
+		return nil, nil, errorcodes.Err10
+	}
+
+	return clearZmk, rest, nil
+}
+
+// checkExchangeKey rejects exchanged clear keys that are all zeros, lack odd parity or have
+// a weak or semi-weak DES component.
+func checkExchangeKey(cmd string, clearKey []byte) error {
+	if isAllZero(clearKey) || !cryptoutils.CheckKeyParity(clearKey) {
+		logError(fmt.Sprintf("%s: key is all zeros or fails the parity check", cmd))
+		return errorcodes.Err11
+	}
+	if cryptoutils.IsWeakDESKey(clearKey) {
+		logError(fmt.Sprintf("%s: key is a weak or semi-weak DES key", cmd))
+		return errorcodes.WithDetail(errorcodes.Err21, "weak DES key")
+	}
+
+	return nil
+}
+
+// exchangeScheme returns the export scheme of a key scheme tag used under a ZMK: the Thales
+// variants for U/T and ANSI X9.17 for Z/X/Y and keys without a tag.
+func exchangeScheme(tag byte) keyexport.Scheme {
+	if tag == keyschemes.SchemeU || tag == keyschemes.SchemeT {
+		return keyexport.SchemeVariant
+	}
+
+	return keyexport.SchemeX917
+}
+
+// isAllZero reports whether every byte of b is zero.
+func isAllZero(b []byte) bool {
+	return len(bytes.Trim(b, "\x00")) == 0
+}
@@ -0,0 +1,110 @@
+package logic
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/keyexport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Clear test keys with odd parity. The test LMK provider decrypts variant keys to themselves,
+// so they also serve as keys under the LMK.
+const (
+	exchangeTestZMK = "0123456789ABCDEFFEDCBA9876543210"
+	exchangeTestKey = "FEDCBA98765432100123456789ABCDEF"
+)
+
+// wrapTestKeyUnderZMK returns the hex form of the clear key hexKey wrapped under the test ZMK.
+func wrapTestKeyUnderZMK(t *testing.T, scheme keyexport.Scheme, hexKey string) string {
+	t.Helper()
+
+	zmk, err := hex.DecodeString(exchangeTestZMK)
+	require.NoError(t, err)
+	key, err := hex.DecodeString(hexKey)
+	require.NoError(t, err)
+	wrapped, err := keyexport.Wrap(scheme, zmk, key, keyexport.Options{})
+	require.NoError(t, err)
+
+	return cryptoutils.Raw2Str(wrapped)
+}
+
+func TestExecuteA6(t *testing.T) {
+	t.Parallel()
+
+	kcv, err := cryptoutils.KeyCV([]byte(exchangeTestKey), 6)
+	require.NoError(t, err)
+	x917 := wrapTestKeyUnderZMK(t, keyexport.SchemeX917, exchangeTestKey)
+	variant := wrapTestKeyUnderZMK(t, keyexport.SchemeVariant, exchangeTestKey)
+
+	tests := []struct {
+		name    string
+		input   string
+		scheme  byte
+		wantErr error
+	}{
+		{name: "Unprefixed key", input: "001U" + exchangeTestZMK + x917 + "U", scheme: 'U'},
+		{name: "X9.17 key", input: "001U" + exchangeTestZMK + "X" + x917 + "U", scheme: 'U'},
+		{name: "Variant key", input: "000" + exchangeTestZMK + "U" + variant + "U%00", scheme: 'U'},
+		{
+			name:    "Unsupported key type",
+			input:   "FFFU" + exchangeTestZMK + x917 + "U",
+			wantErr: errorcodes.Err04,
+		},
+		{
+			name:    "ZMK parity error",
+			input:   "001U0123456789ABCDEFFEDCBA9876543211" + x917 + "U",
+			wantErr: errorcodes.Err10,
+		},
+		{
+			name: "Key parity error",
+			input: "001U" + exchangeTestZMK + "X" +
+				wrapTestKeyUnderZMK(t, keyexport.SchemeX917, "FEDCBA98765432100123456789ABCDEE") + "U",
+			wantErr: errorcodes.Err11,
+		},
+		{
+			name: "Weak key component",
+			input: "001U" + exchangeTestZMK + "X" +
+				wrapTestKeyUnderZMK(t, keyexport.SchemeX917, "0123456789ABCDEF1F1F1F1F0E0E0E0E") + "U",
+			wantErr: errorcodes.Err21,
+		},
+		{
+			name:    "Key length mismatch",
+			input:   "001U" + exchangeTestZMK + x917 + "T",
+			wantErr: errorcodes.Err27,
+		},
+		{
+			name:    "Invalid LMK scheme",
+			input:   "001U" + exchangeTestZMK + x917 + "Q",
+			wantErr: errorcodes.Err26,
+		},
+		{
+			name:    "Missing LMK scheme",
+			input:   "001U" + exchangeTestZMK + x917,
+			wantErr: errorcodes.Err15,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ExecuteA6([]byte(tc.input))
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+
+				return
+			}
+			require.NoError(t, err)
+			resp := string(got)
+			assert.True(t, strings.HasPrefix(resp, "A700"+string(tc.scheme)), resp)
+			assert.Len(t, resp, 4+1+32+6)
+			assert.Equal(t, string(kcv), resp[len(resp)-6:])
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package logic
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/keyexport"
+	"github.com/andrei-cloud/go_hsm/pkg/keyschemes"
+)
+
+// ExecuteA8 exports a key encrypted under the LMK for transmission under a ZMK.
+// Format: Key type (3H) + ZMK (32H or U/T+32H/48H) + Key under LMK (32H or Z/U/T/X/Y+16H/
+// 32H/48H) + Key scheme ZMK (1A: Z/U/T/X/Y). The key is wrapped with ANSI X9.17 ECB for
+// Z/X/Y and with the Thales ZMK variants for U/T. An LMK identifier may follow the request
+// as '%' and two digits.
+// Response: "A9" + "00" + Key under ZMK + KCV (6H).
+func ExecuteA8(input []byte) ([]byte, error) {
+	logInfo("A8: starting key export from LMK to ZMK")
+
+	keyType, data, err := parseExchangeKeyType("A8", input)
+	if err != nil {
+		return nil, err
+	}
+	clearZmk, data, err := parseExchangeZMK("A8", data)
+	if err != nil {
+		return nil, err
+	}
+
+	key, data, err := keyschemes.Parse(data, exchangeSchemes, 32)
+	if err != nil {
+		logError(fmt.Sprintf("A8: invalid key under LMK: %v", err))
+		return nil, errorcodes.Err15
+	}
+	keyBytes, err := key.Bytes()
+	if err != nil {
+		logError("A8: invalid key hex format")
+		return nil, errorcodes.Err15
+	}
+	keyScheme := key.Scheme
+	if keyScheme == 0 {
+		keyScheme = keyschemes.SchemeU
+	}
+
+	if len(data) < 1 {
+		logError("A8: missing ZMK key scheme")
+		return nil, errorcodes.Err15
+	}
+	zmkScheme := data[0]
+	if keyschemes.Length(zmkScheme) == 0 {
+		logError(fmt.Sprintf("A8: invalid ZMK key scheme %c", zmkScheme))
+		return nil, errorcodes.Err26
+	}
+	if _, err := parseTrailingFields("A8", data[1:], "%"); err != nil {
+		return nil, err
+	}
+
+	logInfo("A8: decrypting key under LMK")
+	clearKey, err := LMKProviderInstance.DecryptUnderLMK(keyBytes, keyType, keyScheme)
+	if err != nil {
+		logError("A8: key decryption under LMK failed")
+		return nil, errorcodes.Err68
+	}
+	if err := checkExchangeKey("A8", clearKey); err != nil {
+		return nil, err
+	}
+	if len(clearKey) != keyschemes.Length(zmkScheme) {
+		logError(fmt.Sprintf("A8: %d byte key cannot use ZMK key scheme %c",
+			len(clearKey), zmkScheme))
+		return nil, errorcodes.Err27
+	}
+
+	logInfo(fmt.Sprintf("A8: encrypting key under ZMK with scheme %c", zmkScheme))
+	wrapped, err := keyexport.Wrap(exchangeScheme(zmkScheme), clearZmk, clearKey, keyexport.Options{})
+	if err != nil {
+		logError("A8: key encryption under ZMK failed")
+		return nil, errors.Join(errors.New("export key under zmk"), err)
+	}
+
+	kcv, err := cryptoutils.KeyCV(cryptoutils.Raw2B(clearKey), 6)
+	if err != nil {
+		logError("A8: KCV calculation failed")
+		return nil, errors.Join(errors.New("calculate kcv"), err)
+	}
+	logInfo("A8: key exported")
+
+	return buildKeyResponse("A9", kcv, taggedCryptogram(zmkScheme, wrapped)), nil
+}
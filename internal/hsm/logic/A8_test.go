@@ -0,0 +1,98 @@
+package logic
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteA8(t *testing.T) {
+	t.Parallel()
+
+	kcv, err := cryptoutils.KeyCV([]byte(exchangeTestKey), 6)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr error
+	}{
+		{name: "X9.17 export", input: "001U" + exchangeTestZMK + "U" + exchangeTestKey + "X"},
+		{name: "Variant export", input: "000" + exchangeTestZMK + exchangeTestKey + "U%00"},
+		{
+			name:    "Unsupported key type",
+			input:   "FFFU" + exchangeTestZMK + "U" + exchangeTestKey + "X",
+			wantErr: errorcodes.Err04,
+		},
+		{
+			name:    "All zero ZMK",
+			input:   "001U" + strings.Repeat("0", 32) + "U" + exchangeTestKey + "X",
+			wantErr: errorcodes.Err10,
+		},
+		{
+			name:    "Key parity error",
+			input:   "001U" + exchangeTestZMK + "U" + exchangeTestKey[:31] + "E" + "X",
+			wantErr: errorcodes.Err11,
+		},
+		{
+			name:    "Key length mismatch",
+			input:   "001U" + exchangeTestZMK + "U" + exchangeTestKey + "Y",
+			wantErr: errorcodes.Err27,
+		},
+		{
+			name:    "Invalid ZMK scheme",
+			input:   "001U" + exchangeTestZMK + "U" + exchangeTestKey + "R",
+			wantErr: errorcodes.Err26,
+		},
+		{
+			name:    "Invalid LMK identifier",
+			input:   "001U" + exchangeTestZMK + "U" + exchangeTestKey + "X%9",
+			wantErr: errorcodes.Err13,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ExecuteA8([]byte(tc.input))
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+
+				return
+			}
+			require.NoError(t, err)
+			resp := string(got)
+			require.Len(t, resp, 4+1+32+6)
+			assert.Equal(t, "A900", resp[:4])
+			assert.Equal(t, string(kcv), resp[len(resp)-6:])
+		})
+	}
+}
+
+// TestA8A6RoundTrip exports a key under the ZMK with each scheme and imports it back.
+func TestA8A6RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	for _, scheme := range []string{"X", "U"} {
+		t.Run(scheme, func(t *testing.T) {
+			t.Parallel()
+
+			exported, err := ExecuteA8(
+				[]byte("001U" + exchangeTestZMK + "U" + exchangeTestKey + scheme),
+			)
+			require.NoError(t, err)
+			underZMK := string(exported[4 : len(exported)-6])
+			assert.Equal(t, scheme, underZMK[:1])
+
+			imported, err := ExecuteA6([]byte("001U" + exchangeTestZMK + underZMK + "U"))
+			require.NoError(t, err)
+			assert.Equal(t, string(exported[len(exported)-6:]), string(imported[len(imported)-6:]))
+		})
+	}
+}
@@ -39,6 +39,12 @@ func TestExecuteB2(t *testing.T) {
 			expectedResponse: nil,
 			expectedError:    errorcodes.Err15,
 		},
+		{
+			name:             "Data With Detail Separator",
+			input:            []byte("0005AB\x1fCD"),
+			expectedResponse: []byte("B300AB\x1fCD"),
+			expectedError:    nil,
+		},
 		// TODO: Add more test cases
 	}
 
@@ -9,11 +9,23 @@ import (
 
 	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
 	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+	"github.com/andrei-cloud/go_hsm/pkg/keyschemes"
+	"github.com/andrei-cloud/go_hsm/pkg/msgspec"
+)
+
+// Key check value types of the BU request.
+const (
+	buKCV16 = '0' // 16 hex digits.
+	buKCV6  = '1' // 6 hex digits.
 )
 
 // ExecuteBU processes the BU payload and returns response bytes.
 // BU command generates a Key Check Value for a provided key.
-// Format: KeyTypeCode(2) + KeyLengthFlag(1) + Key.
+// Format: KeyTypeCode(2) + KeyLengthFlag(1) + Key [+ ';' + KCV type (1N)] [+ '%' + LMK ID].
+// Variant keys use a key type code '00'-'9D' and the U or T scheme. Key blocks use key type
+// code FF and the S scheme, and end with ';' when their header carries no block length. KCV
+// type 0 (default) returns a 16 digit check value and 1 a 6 digit one.
 func ExecuteBU(input []byte) ([]byte, error) {
 	if len(input) < 3 {
 		return nil, errorcodes.Err15
@@ -31,6 +43,10 @@ func ExecuteBU(input []byte) ([]byte, error) {
 		),
 	)
 
+	if keyTypeCode == "FF" {
+		return executeBUKeyBlock(remainder)
+	}
+
 	// ketypecode - '00' – '9E': this field indicates a 2-digit Key Type Code
 	// (identical to the regular 3-digit Key Type Code but without the
 	// middle digit) need to be converted to a 3-digit Key Type Code
@@ -53,8 +69,17 @@ func ExecuteBU(input []byte) ([]byte, error) {
 	if keyScheme != 'U' && keyScheme != 'T' {
 		return nil, errorcodes.Err26
 	}
-	// Strip the key scheme flag
-	keyHex := remainder[1:]
+	// Strip the key scheme flag and read the key for its length
+	keyLen := 2 * keyschemes.Length(keyScheme)
+	if len(remainder) < 1+keyLen {
+		logError("BU: Input data too short")
+		return nil, errorcodes.Err15
+	}
+	keyHex := remainder[1 : 1+keyLen]
+	kcvLen, _, err := parseBUTrailer(remainder[1+keyLen:])
+	if err != nil {
+		return nil, err
+	}
 
 	logInfo("BU: Processing encrypted key.")
 	logDebug(fmt.Sprintf("BU: Encrypted key input (hex): %s", string(keyHex)))
@@ -85,9 +110,9 @@ func ExecuteBU(input []byte) ([]byte, error) {
 		return nil, errorcodes.Err01
 	}
 
-	// Calculate 16-byte KCV using clear key
+	// Calculate the KCV using clear key
 	logInfo("BU: Calculating key check value.")
-	kcv, err := cryptoutils.KeyCV(cryptoutils.Raw2B(clearKey), 16)
+	kcv, err := cryptoutils.KeyCV(cryptoutils.Raw2B(clearKey), kcvLen)
 	if err != nil {
 		logError("BU: Failed to calculate KCV")
 		return nil, errors.Join(errors.New("failed to calculate kcv"), err)
@@ -100,3 +125,89 @@ func ExecuteBU(input []byte) ([]byte, error) {
 
 	return resp, nil
 }
+
+// executeBUKeyBlock returns the BU response for a key block under a key block LMK. The check
+// value of an AES key is taken from its CMAC and that of a TDES key from the encryption of
+// a zero block.
+func executeBUKeyBlock(data []byte) ([]byte, error) {
+	if len(data) == 0 || data[0] != keyschemes.SchemeS {
+		logError("BU: key type FF requires an S key block")
+		return nil, errorcodes.Err26
+	}
+	block, rest, err := keyblocklmk.SplitKeyBlock(data)
+	if err != nil {
+		logError(fmt.Sprintf("BU: %v", err))
+		return nil, errorcodes.Err83
+	}
+	header, err := keyblocklmk.ParseHeader(block)
+	if err != nil {
+		logError(fmt.Sprintf("BU: %v", err))
+		return nil, errorcodes.Err83
+	}
+	kcvLen, trailer, err := parseBUTrailer(rest)
+	if err != nil {
+		return nil, err
+	}
+	if id, ok := trailer.Field(msgspec.DelimLMKID); ok {
+		blockID, err := KeyBlockLMKID(block)
+		if err != nil || blockID != string(id) {
+			logError(fmt.Sprintf("BU: key block is not wrapped under LMK %s", id))
+			return nil, errorcodes.Err13
+		}
+	}
+
+	logInfo("BU: Unwrapping key block under LMK.")
+	clearKey, err := LMKProviderInstance.DecryptUnderLMK(block, keyBlockKeyType, keyschemes.SchemeS)
+	if err != nil {
+		logError("BU: Failed to unwrap key block under LMK")
+		return nil, errorcodes.Err68
+	}
+
+	logInfo("BU: Calculating key check value.")
+	var kcv []byte
+	if header.Algorithm == 'A' {
+		cv, cvErr := keyblocklmk.CalculateCMACCheckValue(clearKey)
+		if cvErr == nil {
+			kcv = cryptoutils.Raw2B(cv)[:kcvLen]
+		}
+		err = cvErr
+	} else {
+		if !cryptoutils.CheckKeyParity(clearKey) {
+			logError("BU: Key parity check failed")
+			return nil, errorcodes.Err01
+		}
+		kcv, err = cryptoutils.KeyCV(cryptoutils.Raw2B(clearKey), kcvLen)
+	}
+	if err != nil {
+		logError("BU: Failed to calculate KCV")
+		return nil, errors.Join(errors.New("failed to calculate kcv"), err)
+	}
+
+	return slices.Concat([]byte("BV00"), kcv), nil
+}
+
+// parseBUTrailer reads the optional KCV type and LMK identifier that follow the key and
+// returns the KCV length in hex digits.
+func parseBUTrailer(data []byte) (int, *msgspec.Tokens, error) {
+	trailer, err := parseTrailingFields("BU", data, ";%")
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(trailer.Positional) > 0 {
+		logError("BU: unexpected data after key")
+		return 0, nil, errorcodes.Err15
+	}
+	kcvType, ok := trailer.Field(msgspec.DelimKeySchemes)
+	if !ok || len(kcvType) == 0 {
+		return 16, trailer, nil
+	}
+	switch {
+	case len(kcvType) == 1 && kcvType[0] == buKCV16:
+		return 16, trailer, nil
+	case len(kcvType) == 1 && kcvType[0] == buKCV6:
+		return 6, trailer, nil
+	default:
+		logError(fmt.Sprintf("BU: invalid KCV type %q", kcvType))
+		return 0, nil, errorcodes.Err15
+	}
+}
@@ -5,6 +5,10 @@ import (
 	"testing"
 
 	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestExecuteBU(t *testing.T) {
@@ -47,6 +51,11 @@ func TestExecuteBU(t *testing.T) {
 			expectedResponse: "",
 			expectedError:    errorcodes.Err01,
 		},
+		{
+			name:          "Invalid KCV Type",
+			input:         []byte(goodKeyHex + ";2"),
+			expectedError: errorcodes.Err15,
+		},
 		{
 			name:             "Successful with Actual HSM Decrypt",
 			input:            []byte(goodKeyHex),
@@ -90,3 +99,82 @@ func TestExecuteBU(t *testing.T) {
 		})
 	}
 }
+
+func TestExecuteBUOptions(t *testing.T) {
+	t.Parallel()
+
+	key := "0123456789ABCDEFFEDCBA9876543210"
+	kcv, err := cryptoutils.KeyCV([]byte(key), 16)
+	require.NoError(t, err)
+	tripleKey := key + "0123456789ABCDEF"
+	tripleKCV, err := cryptoutils.KeyCV([]byte(tripleKey), 16)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "6H KCV", input: "001U" + key + ";1", want: string(kcv[:6])},
+		{name: "16H KCV", input: "001U" + key + ";0%00", want: string(kcv)},
+		{name: "Triple length", input: "002T" + tripleKey, want: string(tripleKCV)},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ExecuteBU([]byte(tc.input))
+			require.NoError(t, err)
+			assert.Equal(t, "BV00"+tc.want, string(got))
+		})
+	}
+}
+
+func TestExecuteBUKeyBlock(t *testing.T) {
+	t.Parallel()
+
+	aesKey, _ := hex.DecodeString(cmacTestKey)
+	cv, err := keyblocklmk.CalculateCMACCheckValue(aesKey)
+	require.NoError(t, err)
+	aesKCV := cryptoutils.Raw2Str(cv)
+	aesBlock := wrapTestTAK(t, "M6", 'A', 'V', false)
+
+	tdesKey, _ := hex.DecodeString(exchangeTestKey)
+	tdesBlock, err := keyblocklmk.WrapKeyBlock(keyblocklmk.DefaultTestAESLMK, keyblocklmk.Header{
+		Version: '1', KeyUsage: "P0", Algorithm: 'T', ModeOfUse: 'B',
+		KeyVersionNum: "00", Exportability: 'N', KeyContext: 1,
+	}, nil, tdesKey)
+	require.NoError(t, err)
+	tdesKCV, err := cryptoutils.KeyCV([]byte(exchangeTestKey), 16)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{name: "AES key", input: "FFF" + aesBlock, want: aesKCV[:16]},
+		{name: "AES key 6H KCV", input: "FFF" + aesBlock + ";1%01", want: aesKCV[:6]},
+		{name: "TDES key", input: "FFF" + string(tdesBlock) + ";", want: string(tdesKCV)},
+		{name: "Variant key", input: "FFFU" + exchangeTestKey, wantErr: errorcodes.Err26},
+		{name: "Other LMK", input: "FFF" + aesBlock + "%00", wantErr: errorcodes.Err13},
+		{name: "Malformed block", input: "FFFS1", wantErr: errorcodes.Err83},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ExecuteBU([]byte(tc.input))
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "BV00"+tc.want, string(got))
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package logic
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+	"github.com/andrei-cloud/go_hsm/pkg/keyschemes"
+	"github.com/andrei-cloud/go_hsm/pkg/msgspec"
+)
+
+// bwKeyLengths maps the BW key length flags to key lengths in bytes.
+var bwKeyLengths = map[byte]int{'0': 8, '1': 16, '2': 24}
+
+// ExecuteBW translates a key from the old LMK held in key change storage to the current LMK.
+// Format: Key type code (2H) + Key length flag (1N: 0 single, 1 double, 2 triple length) +
+// Key under old LMK (16H/32H/48H or Z/X/U/T/Y+16H/32H/48H) [+ '%' + LMK ID]. Variant keys use
+// a key type code '00'-'9D', the 3-digit key type without its middle digit. Key blocks use key
+// type code FF, any key length flag and the S scheme, and end with ';' when their header
+// carries no block length.
+// Response: "BX" + "00" + Key under the current LMK, with the scheme tag of the request.
+func ExecuteBW(input []byte) ([]byte, error) {
+	logInfo("BW: starting key translation from old LMK")
+
+	if len(input) < 4 {
+		logError("BW: input data too short")
+		return nil, errorcodes.Err15
+	}
+	keyTypeCode, lengthFlag, data := string(input[:2]), input[2], input[3:]
+
+	if keyTypeCode == "FF" {
+		return executeBWKeyBlock(data)
+	}
+
+	if keyTypeCode[0] < '0' || keyTypeCode[0] > '9' || !isHexDigit(keyTypeCode[1]) {
+		logError(fmt.Sprintf("BW: invalid key type code %s", keyTypeCode))
+		return nil, errorcodes.Err04
+	}
+	keyType := fmt.Sprintf("%c0%c", keyTypeCode[0], keyTypeCode[1])
+	keyLen, ok := bwKeyLengths[lengthFlag]
+	if !ok {
+		logError(fmt.Sprintf("BW: invalid key length flag %c", lengthFlag))
+		return nil, errorcodes.Err05
+	}
+
+	key, rest, err := keyschemes.Parse(data, exchangeSchemes, 2*keyLen)
+	if err != nil {
+		logError(fmt.Sprintf("BW: invalid key under old LMK: %v", err))
+		return nil, errorcodes.Err15
+	}
+	if key.Length != keyLen {
+		logError(fmt.Sprintf("BW: key scheme %c does not match key length flag %c", key.Scheme, lengthFlag))
+		return nil, errorcodes.Err27
+	}
+	trailer, err := parseTrailingFields("BW", rest, "%")
+	if err != nil {
+		return nil, err
+	}
+	if len(trailer.Positional) > 0 {
+		logError("BW: unexpected data after key")
+		return nil, errorcodes.Err15
+	}
+	encryptedKey, err := key.Bytes()
+	if err != nil {
+		logError("BW: invalid key hex format")
+		return nil, errorcodes.Err15
+	}
+
+	scheme := key.Scheme
+	if scheme == 0 {
+		scheme = unprefixedScheme(keyLen)
+	}
+
+	logInfo("BW: translating key to the current LMK")
+	translated, err := LMKProviderInstance.TranslateFromOldLMK(encryptedKey, keyType, scheme)
+	if err != nil {
+		logError(fmt.Sprintf("BW: failed to translate key: %v", err))
+		return nil, errorcodes.Err33
+	}
+
+	resp := []byte("BX00")
+	if key.Scheme != 0 {
+		resp = append(resp, key.Scheme)
+	}
+
+	return append(resp, strings.ToUpper(hex.EncodeToString(translated))...), nil
+}
+
+// executeBWKeyBlock returns the BW response for a key block under the old key block LMK.
+func executeBWKeyBlock(data []byte) ([]byte, error) {
+	if len(data) == 0 || data[0] != keyschemes.SchemeS {
+		logError("BW: key type FF requires an S key block")
+		return nil, errorcodes.Err26
+	}
+	block, rest, err := keyblocklmk.SplitKeyBlock(data)
+	if err != nil {
+		logError(fmt.Sprintf("BW: %v", err))
+		return nil, errorcodes.Err83
+	}
+	trailer, err := parseTrailingFields("BW", rest, "%")
+	if err != nil {
+		return nil, err
+	}
+	if len(trailer.Positional) > 0 {
+		logError("BW: unexpected data after key block")
+		return nil, errorcodes.Err15
+	}
+	if id, ok := trailer.Field(msgspec.DelimLMKID); ok {
+		blockID, err := KeyBlockLMKID(block)
+		if err != nil || blockID != string(id) {
+			logError(fmt.Sprintf("BW: key block is not wrapped under LMK %s", id))
+			return nil, errorcodes.Err13
+		}
+	}
+
+	logInfo("BW: rewrapping key block under the current LMK")
+	translated, err := LMKProviderInstance.TranslateFromOldLMK(block, keyBlockKeyType, keyschemes.SchemeS)
+	if err != nil {
+		logError(fmt.Sprintf("BW: failed to translate key block: %v", err))
+		if errors.Is(err, ErrOldLMKNotConfigured) {
+			return nil, errorcodes.Err33
+		}
+
+		return nil, errorcodes.ErrA4
+	}
+
+	return slices.Concat([]byte("BX00"), translated), nil
+}
+
+// unprefixedScheme returns the scheme of a key without scheme tag of keyLen bytes: Z for
+// single length keys and X9.17 X or Y for double and triple length keys.
+func unprefixedScheme(keyLen int) byte {
+	switch keyLen {
+	case 8:
+		return keyschemes.SchemeZ
+	case 24:
+		return keyschemes.SchemeY
+	default:
+		return keyschemes.SchemeX
+	}
+}
+
+// isHexDigit reports whether c is an upper case hex digit.
+func isHexDigit(c byte) bool {
+	return ('0' <= c && c <= '9') || ('A' <= c && c <= 'F')
+}
@@ -0,0 +1,89 @@
+package logic
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteBW(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, SetupTestLMKProvider())
+
+	testKey, _ := hex.DecodeString(testLMKKeyHex)
+	clearKey, _ := hex.DecodeString(exchangeTestKey)
+	translated, err := testEncryptWithLMK(clearKey, testKey)
+	require.NoError(t, err)
+	want := strings.ToUpper(hex.EncodeToString(translated))
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{name: "U scheme", input: "001U" + exchangeTestKey, want: "BX00U" + want},
+		{name: "No scheme", input: "091" + exchangeTestKey + "%00", want: "BX00" + want},
+		{name: "Short input", input: "00", wantErr: errorcodes.Err15},
+		{name: "Invalid key type", input: "A01U" + exchangeTestKey, wantErr: errorcodes.Err04},
+		{name: "Invalid length flag", input: "003U" + exchangeTestKey, wantErr: errorcodes.Err05},
+		{name: "Length mismatch", input: "000U" + exchangeTestKey, wantErr: errorcodes.Err27},
+		{name: "Trailing data", input: "001U" + exchangeTestKey + "00", wantErr: errorcodes.Err15},
+		{name: "Variant key as FF", input: "FF1U" + exchangeTestKey, wantErr: errorcodes.Err26},
+		{name: "Malformed block", input: "FF1S1", wantErr: errorcodes.Err83},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ExecuteBW([]byte(tc.input))
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, string(got))
+		})
+	}
+}
+
+// TestExecuteBWKeyBlock modifies the old LMK registry, so it does not run in parallel with
+// the command tests.
+func TestExecuteBWKeyBlock(t *testing.T) {
+	require.NoError(t, SetupTestLMKProvider())
+
+	oldLMK := bytes.Repeat([]byte{0x3C}, 32)
+	key, _ := hex.DecodeString(exchangeTestKey)
+	block, err := keyblocklmk.WrapKeyBlock(oldLMK, keyblocklmk.Header{
+		Version: '1', KeyUsage: "P0", Algorithm: 'T', ModeOfUse: 'B',
+		KeyVersionNum: "00", Exportability: 'N', KeyContext: 1,
+	}, nil, key)
+	require.NoError(t, err)
+
+	block = append(block, keyblocklmk.KeyBlockDelimiter)
+
+	_, err = ExecuteBW(append([]byte("FF1"), block...))
+	assert.ErrorIs(t, err, errorcodes.Err33, "no old LMK")
+
+	require.NoError(t, RegisterOldKeyBlockLMK(DefaultKeyBlockLMKID, hex.EncodeToString(oldLMK)))
+	defer delete(OldLMKRegistry, DefaultKeyBlockLMKID)
+
+	_, err = ExecuteBW(append([]byte("FF1"), append(block, "%00"...)...))
+	assert.ErrorIs(t, err, errorcodes.Err13, "other LMK")
+
+	got, err := ExecuteBW(append([]byte("FF1"), append(block, "%01"...)...))
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(got, []byte("BX00S")))
+	_, clear, err := keyblocklmk.UnwrapKeyBlock(keyblocklmk.DefaultTestAESLMK, got[4:])
+	require.NoError(t, err)
+	assert.Equal(t, key, clear)
+}
@@ -2,18 +2,21 @@
 package logic
 
 import (
-	"crypto/des"
 	"encoding/hex"
 	"fmt"
 	"slices"
 
 	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
 	"github.com/andrei-cloud/go_hsm/internal/hsm"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
 	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/keyschemes"
+	"github.com/andrei-cloud/go_hsm/pkg/pan"
 	"github.com/andrei-cloud/go_hsm/pkg/pinblock"
 )
 
 // ExecuteCA translates a PIN block encrypted under a TPK to one encrypted under a ZPK or BDK under Variant LMK.
+// An LMK identifier may follow the request as '%' and two digits.
 func ExecuteCA(input []byte) ([]byte, error) {
 	data := input
 	logInfo("CA: Starting PIN block translation.")
@@ -28,22 +31,14 @@ func ExecuteCA(input []byte) ([]byte, error) {
 
 	// Parse source TPK
 	logInfo("CA: Processing source TPK.")
-	srcScheme := data[0]
-	logDebug(fmt.Sprintf("CA: Source key scheme: %c", srcScheme))
-	rawSrc := getKeyLength(srcScheme)
-	hexSrc := rawSrc * 2
-	if srcScheme != 'U' && srcScheme != 'T' && srcScheme != 'X' {
-		logError("CA: Invalid source key scheme")
-		return nil, errorcodes.Err15
-	}
-	if len(data) < 1+hexSrc {
-		logError("CA: Insufficient data for source key")
+	src, data, err := keyschemes.Parse(data, "UTX", 0)
+	if err != nil {
+		logError(fmt.Sprintf("CA: Invalid source key: %v", err))
 		return nil, errorcodes.Err15
 	}
-	srcHex := string(data[1 : 1+hexSrc])
-	logDebug(fmt.Sprintf("CA: Source key hex: %s", srcHex))
-	data = data[1+hexSrc:]
-	srcBytes, err := hex.DecodeString(srcHex)
+	srcScheme := src.Scheme
+	logDebug(fmt.Sprintf("CA: Source key scheme: %c, hex: %s", srcScheme, src.Text))
+	srcBytes, err := src.Bytes()
 	if err != nil {
 		logError("CA: Invalid source key format")
 		return nil, errorcodes.Err15
@@ -72,22 +67,14 @@ func ExecuteCA(input []byte) ([]byte, error) {
 	}
 
 	// Parse destination key
-	dstScheme := data[0]
-	logDebug(fmt.Sprintf("CA: Destination key scheme: %c", dstScheme))
-	rawDst := getKeyLength(dstScheme)
-	hexDst := rawDst * 2
-	if dstScheme != 'U' && dstScheme != 'T' && dstScheme != 'X' {
-		logError("CA: Invalid destination key scheme")
-		return nil, errorcodes.Err15
-	}
-	if len(data) < 1+hexDst {
-		logError("CA: Insufficient data for destination key")
+	dst, data, err := keyschemes.Parse(data, "UTX", 0)
+	if err != nil {
+		logError(fmt.Sprintf("CA: Invalid destination key: %v", err))
 		return nil, errorcodes.Err15
 	}
-	dstHex := string(data[1 : 1+hexDst])
-	logDebug(fmt.Sprintf("CA: Destination key hex: %s", dstHex))
-	data = data[1+hexDst:]
-	dstBytes, err := hex.DecodeString(dstHex)
+	dstScheme := dst.Scheme
+	logDebug(fmt.Sprintf("CA: Destination key scheme: %c, hex: %s", dstScheme, dst.Text))
+	dstBytes, err := dst.Bytes()
 	if err != nil {
 		logError("CA: Invalid destination key format")
 		return nil, errorcodes.Err15
@@ -150,8 +137,8 @@ func ExecuteCA(input []byte) ([]byte, error) {
 			return nil, errorcodes.Err15
 		}
 		panOrUdk = string(data[:12])
-		logDebug(fmt.Sprintf("CA: Using PAN: %s", panOrUdk))
-		_ = data[12:]
+		logDebug(fmt.Sprintf("CA: Using PAN: %s", pan.Mask(panOrUdk)))
+		data = data[12:]
 	case pinblock.VISANEWPINONLY:
 		if len(data) < 16 {
 			logError("CA: Missing UDK for VISA format 41")
@@ -159,7 +146,7 @@ func ExecuteCA(input []byte) ([]byte, error) {
 		}
 		panOrUdk = string(data[:16])
 		logDebug(fmt.Sprintf("CA: Using UDK: %s", panOrUdk))
-		_ = data[16:]
+		data = data[16:]
 	case pinblock.VISANEWOLDIN:
 		if len(data) < 20 { // Need both old PIN and UDK
 			logError("CA: Missing old PIN/UDK for VISA format 42")
@@ -169,7 +156,12 @@ func ExecuteCA(input []byte) ([]byte, error) {
 		udk := string(data[4:20])
 		panOrUdk = oldPin + "|" + udk
 		logDebug(fmt.Sprintf("CA: Using old PIN and UDK: %s", panOrUdk))
-		_ = data[20:]
+		data = data[20:]
+	}
+
+	// Only an LMK identifier may follow the format-specific parameters.
+	if _, err := parseTrailingFields("CA", data, "%"); err != nil {
+		return nil, err
 	}
 
 	// Decrypt PIN block under source TPK
@@ -179,7 +171,7 @@ func ExecuteCA(input []byte) ([]byte, error) {
 		logError("CA: Failed to decode PIN block hex")
 		return nil, errorcodes.Err15
 	}
-	srcCipher, err := des.NewTripleDESCipher(cryptoutils.PrepareTripleDESKey(srcClear))
+	srcCipher, err := cryptoprovider.NewTripleDESCipher(cryptoutils.PrepareTripleDESKey(srcClear))
 	if err != nil {
 		logError(fmt.Sprintf("CA: TPK cipher initialization error: %v", err))
 		return nil, fmt.Errorf("tpk cipher: %w", err)
@@ -212,7 +204,7 @@ func ExecuteCA(input []byte) ([]byte, error) {
 		logError("CA: Failed to decode new PIN block hex")
 		return nil, errorcodes.Err15
 	}
-	dstCipher, err := des.NewTripleDESCipher(cryptoutils.PrepareTripleDESKey(dstClear))
+	dstCipher, err := cryptoprovider.NewTripleDESCipher(cryptoutils.PrepareTripleDESKey(dstClear))
 	if err != nil {
 		logError(fmt.Sprintf("CA: ZPK cipher initialization error: %v", err))
 		return nil, fmt.Errorf("zpk cipher: %w", err)
@@ -0,0 +1,9 @@
+package logic
+
+// ExecuteCC translates a ZPK from encryption under a ZMK to encryption under the LMK and
+// returns response bytes. It shares its processing and error codes with FA.
+// Format: ZMK (32H or U/T+32H/48H) + ZPK under ZMK (32H or U/T+32H/48H).
+// Response: "CD" + "00" + ZPK under LMK + KCV (6H).
+func ExecuteCC(input []byte) ([]byte, error) {
+	return translateZPKFromZMK("CC", "CD", input)
+}
@@ -0,0 +1,94 @@
+package logic
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+)
+
+func TestExecuteCC(t *testing.T) {
+	t.Parallel()
+
+	// Initialize the test LMK provider.
+	if err := SetupTestLMKProvider(); err != nil {
+		t.Fatalf("Failed to setup test LMK provider: %v", err)
+	}
+
+	const (
+		validZMK = "U0123456789ABCDEFFEDCBA9876543210"
+		validZPK = "U1A4D672DCA6CB3351A4D672DCA6CB335"
+	)
+
+	tests := []struct {
+		name   string
+		input  []byte
+		expErr error
+	}{
+		{
+			name:   "EmptyInput",
+			input:  []byte{},
+			expErr: errorcodes.Err15,
+		},
+		{
+			name:   "ShortZMK",
+			input:  []byte("U1234"),
+			expErr: errorcodes.Err15,
+		},
+		{
+			name:   "MissingZPK",
+			input:  []byte(validZMK),
+			expErr: errorcodes.Err15,
+		},
+		{
+			name:   "InvalidZPKHex",
+			input:  []byte(validZMK + "U" + strings.Repeat("G", 32)),
+			expErr: errorcodes.Err15,
+		},
+		{
+			name:   "AllZeroZPK",
+			input:  []byte(validZMK + "U" + strings.Repeat("0", 32)),
+			expErr: errorcodes.Err11,
+		},
+		{
+			name:   "AllZeroZMK",
+			input:  []byte("U" + strings.Repeat("0", 32) + validZPK),
+			expErr: errorcodes.Err11,
+		},
+		{
+			name:   "ZMKParityError",
+			input:  []byte("U0123456789ABCDEFFEDCBA9876543211" + validZPK),
+			expErr: errorcodes.Err10,
+		},
+		{
+			name:   "Success",
+			input:  []byte(validZMK + validZPK),
+			expErr: nil,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			resp, err := ExecuteCC(tc.input)
+			if err != tc.expErr {
+				t.Fatalf("expected error %v, got %v", tc.expErr, err)
+			}
+			if tc.expErr != nil {
+				return
+			}
+			if len(resp) != 4+1+32+6 {
+				t.Fatalf("unexpected response length %d: %s", len(resp), resp)
+			}
+			if string(resp[:5]) != "CD00U" {
+				t.Errorf("expected CD00U prefix, got %s", resp[:5])
+			}
+			if _, err := hex.DecodeString(string(resp[len(resp)-6:])); err != nil {
+				t.Errorf("invalid KCV: %s", resp[len(resp)-6:])
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package logic
+
+import (
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/internal/hsm"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/dukpt"
+	"github.com/andrei-cloud/go_hsm/pkg/keyschemes"
+	"github.com/andrei-cloud/go_hsm/pkg/pinblock"
+)
+
+// ExecuteCI translates a PIN block from encryption under a DUKPT PIN key to encryption under
+// a ZPK, and returns response bytes. The PIN key is derived from the BDK for the KSN with
+// TDES DUKPT (ANSI X9.24-1), and the source PIN block is in ISO format 0.
+// Format: BDK (32H or U/T+32H) + ZPK (32H or U/T+32H/48H) + KSN descriptor (3H) + KSN (up to
+// 20H) + Source PIN block (16H) + Destination format (2N) + Account number (12N). The three
+// digits of the KSN descriptor are the lengths of the BDK ID, sub-key and device ID, so the
+// KSN is their sum plus 5 digits long; shorter KSNs are padded on the left with F. An LMK
+// identifier may follow the request as '%' and two digits.
+// Response: "CJ" + "00" + PIN length (2N) + Destination PIN block (16H) + Destination format
+// (2N).
+func ExecuteCI(input []byte) ([]byte, error) {
+	logInfo("CI: starting DUKPT PIN block translation")
+
+	bdk, data, err := parseCIKey("BDK", input)
+	if err != nil {
+		return nil, err
+	}
+	zpk, data, err := parseCIKey("ZPK", data)
+	if err != nil {
+		return nil, err
+	}
+	ksn, data, err := parseKSNDescriptor(data)
+	if err != nil {
+		return nil, err
+	}
+
+	const fieldsLen = 16 + 2 + 12
+	if len(data) < fieldsLen {
+		logError("CI: insufficient data for PIN block fields")
+		return nil, errorcodes.Err15
+	}
+	pinHex := string(data[:16])
+	fmtDst := string(data[16:18])
+	accountNum := string(data[18:30])
+	if _, err := parseTrailingFields("CI", data[fieldsLen:], "%"); err != nil {
+		return nil, err
+	}
+	dstFormat, err := hsm.GetPinBlockFormatFromThalesCode(fmtDst)
+	if err != nil {
+		logError(fmt.Sprintf("CI: invalid destination format code: %s", fmtDst))
+		return nil, errorcodes.Err23
+	}
+
+	logInfo("CI: decrypting BDK and ZPK under LMK")
+	clearBDK, err := LMKProviderInstance.DecryptUnderLMK(bdk.bytes, bdkKeyType, bdk.scheme)
+	if err != nil {
+		logError("CI: BDK decryption failed")
+		return nil, errorcodes.Err68
+	}
+	if !cryptoutils.CheckKeyParity(clearBDK) {
+		logError("CI: BDK parity check failed")
+		return nil, errorcodes.Err10
+	}
+	if len(clearBDK) != 16 {
+		logError(fmt.Sprintf("CI: TDES DUKPT requires a double-length BDK, got %d bytes",
+			len(clearBDK)))
+		return nil, errorcodes.Err27
+	}
+	clearZPK, err := LMKProviderInstance.DecryptUnderLMK(zpk.bytes, "001", zpk.scheme)
+	if err != nil {
+		logError("CI: ZPK decryption failed")
+		return nil, errorcodes.Err68
+	}
+	if !cryptoutils.CheckKeyParity(clearZPK) {
+		logError("CI: ZPK parity check failed")
+		return nil, errorcodes.Err11
+	}
+
+	logInfo("CI: deriving DUKPT PIN key")
+	ipek, err := dukpt.DeriveIPEK(clearBDK, ksn)
+	if err != nil {
+		logError(fmt.Sprintf("CI: IPEK derivation failed: %v", err))
+		return nil, errorcodes.Err15
+	}
+	txKey, err := dukpt.DeriveTransactionKey(ipek, ksn)
+	if err != nil {
+		logError(fmt.Sprintf("CI: transaction key derivation failed: %v", err))
+		return nil, errorcodes.Err15
+	}
+	pinKey, err := dukpt.VariantPIN.Apply(txKey)
+	if err != nil {
+		return nil, errorcodes.Err15
+	}
+
+	clearPIN, err := decryptPINBlock("CI", pinKey, pinHex, accountNum, pinblock.ISO0)
+	if err != nil {
+		return nil, err
+	}
+	out, err := encryptPINBlock("CI", clearZPK, clearPIN, accountNum, dstFormat)
+	if err != nil {
+		return nil, err
+	}
+	logInfo("CI: PIN block translated")
+
+	pinLen := fmt.Appendf(nil, "%02d", len(clearPIN))
+
+	return slices.Concat([]byte("CJ00"), pinLen, cryptoutils.Raw2B(out), []byte(fmtDst)), nil
+}
+
+// DUKPTTransaction returns the initial KSN of the PIN entry device of a CI request without the
+// command code, in hex, and the transaction counter of its KSN. It reports false for other
+// commands and for requests that cannot be parsed.
+func DUKPTTransaction(cmd string, payload []byte) (string, uint32, bool) {
+	if cmd != "CI" {
+		return "", 0, false
+	}
+	_, data, err := parseCIKey("BDK", payload)
+	if err != nil {
+		return "", 0, false
+	}
+	if _, data, err = parseCIKey("ZPK", data); err != nil {
+		return "", 0, false
+	}
+	ksn, _, err := parseKSNDescriptor(data)
+	if err != nil {
+		return "", 0, false
+	}
+	device, counter, err := dukpt.SplitKSN(ksn)
+	if err != nil {
+		return "", 0, false
+	}
+
+	return fmt.Sprintf("%X", device), counter, true
+}
+
+// ciKey is a key under the LMK read from a CI request.
+type ciKey struct {
+	scheme byte
+	bytes  []byte
+}
+
+// parseCIKey reads the key named name at the start of data. A key without scheme is
+// double-length.
+func parseCIKey(name string, data []byte) (ciKey, []byte, error) {
+	key, rest, err := keyschemes.Parse(data, "UT", 32)
+	if err != nil {
+		logError(fmt.Sprintf("CI: invalid %s: %v", name, err))
+		return ciKey{}, nil, errorcodes.Err15
+	}
+	raw, err := key.Bytes()
+	if err != nil {
+		logError(fmt.Sprintf("CI: invalid %s hex format", name))
+		return ciKey{}, nil, errorcodes.Err15
+	}
+	scheme := key.Scheme
+	if scheme == 0 {
+		scheme = keyschemes.SchemeU
+	}
+
+	return ciKey{scheme: scheme, bytes: raw}, rest, nil
+}
+
+// parseKSNDescriptor reads a KSN descriptor and the KSN it describes, and returns the KSN
+// padded on the left with F to 10 bytes.
+func parseKSNDescriptor(data []byte) ([]byte, []byte, error) {
+	if len(data) < 3 {
+		logError("CI: missing KSN descriptor")
+		return nil, nil, errorcodes.Err15
+	}
+	n := 5 // transaction counter digits.
+	for _, c := range data[:3] {
+		d, err := strconv.ParseUint(string(c), 16, 8)
+		if err != nil {
+			logError(fmt.Sprintf("CI: invalid KSN descriptor %q", data[:3]))
+			return nil, nil, errorcodes.Err15
+		}
+		n += int(d)
+	}
+	if n > 2*dukpt.KSNLength || len(data) < 3+n {
+		logError(fmt.Sprintf("CI: KSN of %d digits does not fit the request", n))
+		return nil, nil, errorcodes.Err15
+	}
+	padded := strings.Repeat("F", 2*dukpt.KSNLength-n) + string(data[3:3+n])
+	ksn, err := hex.DecodeString(padded)
+	if err != nil {
+		logError("CI: invalid KSN hex format")
+		return nil, nil, errorcodes.Err15
+	}
+
+	return ksn, data[3+n:], nil
+}
@@ -0,0 +1,112 @@
+package logic
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/pinblock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteCI(t *testing.T) {
+	t.Parallel()
+
+	const (
+		bdk    = "0123456789ABCDEFFEDCBA9876543210"
+		ksn    = "FFFF9876543210E00001"
+		pinKey = "042666B49184CF5C68DE9628D0397B36" // ANSI X9.24-1 PIN key for ksn.
+		zpk    = "0123456789ABCDEF89ABCDEF01234567"
+	)
+	key, err := hex.DecodeString(pinKey)
+	require.NoError(t, err)
+	encrypted, err := encryptPINBlock("CI", key, "1234", pinTestAccount, pinblock.ISO0)
+	require.NoError(t, err)
+	pinHex := hex.EncodeToString(encrypted)
+	fields := pinHex + "01" + pinTestAccount
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr error
+	}{
+		{name: "Full KSN", input: "U" + bdk + "U" + zpk + "906" + ksn + fields},
+		{name: "Short KSN", input: bdk + zpk + "605" + ksn[4:] + fields + "%00"},
+		{
+			name:    "BDK parity error",
+			input:   "U" + bdk[:31] + "1" + "U" + zpk + "906" + ksn + fields,
+			wantErr: errorcodes.Err10,
+		},
+		{
+			name:    "ZPK parity error",
+			input:   "U" + bdk + "U" + zpk[:31] + "6" + "906" + ksn + fields,
+			wantErr: errorcodes.Err11,
+		},
+		{
+			name:    "KSN too long",
+			input:   "U" + bdk + "U" + zpk + "A06" + "F" + ksn + fields,
+			wantErr: errorcodes.Err15,
+		},
+		{
+			name:    "Invalid destination format",
+			input:   "U" + bdk + "U" + zpk + "906" + ksn + pinHex + "99" + pinTestAccount,
+			wantErr: errorcodes.Err23,
+		},
+		{
+			name:    "Wrong account",
+			input:   "U" + bdk + "U" + zpk + "906" + ksn + pinHex + "01" + "999999999999",
+			wantErr: errorcodes.Err20,
+		},
+	}
+
+	dst, err := hex.DecodeString(zpk)
+	require.NoError(t, err)
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ExecuteCI([]byte(tc.input))
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, got, 4+2+16+2)
+			assert.Equal(t, "CJ0004", string(got[:6]))
+			assert.Equal(t, "01", string(got[22:]))
+			clearPIN, err := decryptPINBlock("CI", dst, string(got[6:22]), pinTestAccount,
+				pinblock.ISO0)
+			require.NoError(t, err)
+			assert.Equal(t, "1234", clearPIN)
+		})
+	}
+}
+
+func TestDUKPTTransaction(t *testing.T) {
+	t.Parallel()
+
+	const (
+		bdk    = "0123456789ABCDEFFEDCBA9876543210"
+		zpk    = "0123456789ABCDEF89ABCDEF01234567"
+		fields = "0123456789ABCDEF" + "01" + pinTestAccount
+	)
+
+	device, counter, ok := DUKPTTransaction("CI", []byte("U"+bdk+"U"+zpk+"906"+"FFFF9876543210E0000A"+fields))
+	require.True(t, ok)
+	assert.Equal(t, "FFFF9876543210E00000", device)
+	assert.Equal(t, uint32(10), counter)
+
+	// A short KSN is padded as CI pads it.
+	device, counter, ok = DUKPTTransaction("CI", []byte(bdk+zpk+"605"+"9876543210E00001"+fields))
+	require.True(t, ok)
+	assert.Equal(t, "FFFF9876543210E00000", device)
+	assert.Equal(t, uint32(1), counter)
+
+	_, _, ok = DUKPTTransaction("CI", []byte("U"+bdk+"U"+zpk+"A06"))
+	assert.False(t, ok)
+	_, _, ok = DUKPTTransaction("DC", []byte("U"+bdk+"U"+zpk+"906"+"FFFF9876543210E0000A"+fields))
+	assert.False(t, ok)
+}
@@ -10,15 +10,24 @@ import (
 	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
 	"github.com/andrei-cloud/go_hsm/pkg/common"
 	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/pan"
 )
 
 // ExecuteCW executes the CW command to generate a CVV.
+// Format: CVK (U+32H or 2x16H) + PAN + ';' + Expiry date (4N) + Service code (3N) + optional
+// '#' + mode (1N): 0 CVV, 1 CVV2, 2 iCVV or 3 dynamic CVC3. Mode 3 takes an MK-CVC3 in place
+// of the CVK, followed by PAN sequence number (2N) + Unpredictable number (8H) + ATC (4H).
 func ExecuteCW(input []byte) ([]byte, error) {
 	logInfo("CW: Starting CVV generation.")
 	logDebug(
 		fmt.Sprintf("CW: Input data: %s", common.FormatData(input)),
 	)
 
+	req, err := parseCVVMode("CW", input)
+	if err != nil {
+		return nil, err
+	}
+
 	var cvkHexStr string
 	var panStartIndex int
 	var clearCVK []byte // This will hold the CVK after potential decryption.
@@ -46,8 +55,8 @@ func ExecuteCW(input []byte) ([]byte, error) {
 		}
 
 		logInfo("CW: Decrypting CVK under LMK.")
-		// Key Type "402" for CVK, Scheme 'U' for double-length key.
-		decryptedCVK, err := LMKProviderInstance.DecryptUnderLMK(encryptedCVKBytes, "402", 'U')
+		// Key Type "402" for CVK ("709" for MK-CVC3), Scheme 'U' for double-length key.
+		decryptedCVK, err := LMKProviderInstance.DecryptUnderLMK(encryptedCVKBytes, req.keyType(), 'U')
 		if err != nil {
 			logError(fmt.Sprintf("CW: CVK decryption failed: %v", err))
 			if hsmErr, ok := err.(errorcodes.HSMError); ok {
@@ -56,6 +65,7 @@ func ExecuteCW(input []byte) ([]byte, error) {
 
 			return nil, errorcodes.Err10
 		}
+		defer cryptoutils.Zeroize(decryptedCVK)
 		clearCVK = decryptedCVK
 		logDebug(
 			fmt.Sprintf("CW: Decrypted CVK: %s", common.FormatData(clearCVK)),
@@ -90,8 +100,8 @@ func ExecuteCW(input []byte) ([]byte, error) {
 		}
 
 		logInfo("CW: Decrypting CVKA under LMK.")
-		// Key Type "402" for CVK, Scheme 'X' for single-length key.
-		decryptedCVKA, err := LMKProviderInstance.DecryptUnderLMK(encryptedCVKABytes, "402", 'X')
+		// Key Type "402" for CVK ("709" for MK-CVC3), Scheme 'X' for single-length key.
+		decryptedCVKA, err := LMKProviderInstance.DecryptUnderLMK(encryptedCVKABytes, req.keyType(), 'X')
 		if err != nil {
 			logError(fmt.Sprintf("CW: CVKA decryption failed: %v", err))
 			if hsmErr, ok := err.(errorcodes.HSMError); ok {
@@ -100,6 +110,7 @@ func ExecuteCW(input []byte) ([]byte, error) {
 
 			return nil, errorcodes.Err10
 		}
+		defer cryptoutils.Zeroize(decryptedCVKA)
 
 		logInfo("CW: Verifying CVKA parity.")
 		if !cryptoutils.CheckKeyParity(decryptedCVKA) {
@@ -115,7 +126,7 @@ func ExecuteCW(input []byte) ([]byte, error) {
 		}
 
 		logInfo("CW: Decrypting CVKB under LMK.")
-		decryptedCVKB, err := LMKProviderInstance.DecryptUnderLMK(encryptedCVKBBytes, "402", 'X')
+		decryptedCVKB, err := LMKProviderInstance.DecryptUnderLMK(encryptedCVKBBytes, req.keyType(), 'X')
 		if err != nil {
 			logError(fmt.Sprintf("CW: CVKB decryption failed: %v", err))
 			if hsmErr, ok := err.(errorcodes.HSMError); ok {
@@ -124,6 +135,8 @@ func ExecuteCW(input []byte) ([]byte, error) {
 
 			return nil, errorcodes.Err10
 		}
+		defer cryptoutils.Zeroize(decryptedCVKB)
+
 		logInfo("CW: Verifying CVKB parity.")
 		if !cryptoutils.CheckKeyParity(decryptedCVKB) {
 			logError("CW: CVKB parity check failed")
@@ -142,6 +155,8 @@ func ExecuteCW(input []byte) ([]byte, error) {
 		logDebug(fmt.Sprintf("CW: Combined CVK value: %s", common.FormatData(clearCVK)))
 	}
 
+	defer cryptoutils.Zeroize(clearCVK)
+
 	logInfo("CW: Validating final CVK.")
 	logDebug(fmt.Sprintf("CW: Final CVK value: %s", common.FormatData(clearCVK)))
 
@@ -175,7 +190,7 @@ func ExecuteCW(input []byte) ([]byte, error) {
 		logError(fmt.Sprintf("CW: Invalid PAN length: %d, must be between 13 and 19", panLength))
 		return nil, errorcodes.Err15
 	}
-	logDebug(fmt.Sprintf("CW: PAN value: %s, length: %d", panHexStr, panLength))
+	logDebug(fmt.Sprintf("CW: PAN value: %s, length: %d", pan.Mask(panHexStr), panLength))
 
 	// Expected data after PAN (hex) + ';': 4N (expDate) + 3N (servCode) = 7 bytes.
 	if len(remainingData) < panDelimiterIndex+1+4+3 {
@@ -191,12 +206,7 @@ func ExecuteCW(input []byte) ([]byte, error) {
 	logDebug("Calculating CVV...")
 	// Calculate CVV using the utility function.
 	// PAN is passed as a hex string, expDate and servCode as digit strings
-	cvvValueBytes, err := cryptoutils.GetVisaCVV(
-		panHexStr,
-		expDateStr,
-		servCodeStr,
-		clearCVK,
-	)
+	cvvValueBytes, err := req.calculate("CW", panHexStr, expDateStr, servCodeStr, clearCVK)
 	if err != nil {
 		logDebug(fmt.Sprintf("Error calculating CVV: %v", err))
 		// An error from GetVisaCVV could be due to various reasons (e.g., internal crypto error).
@@ -214,3 +224,96 @@ func ExecuteCW(input []byte) ([]byte, error) {
 
 	return response, nil
 }
+
+// Card verification value modes, selected by an optional '#' field after the service code.
+const (
+	cvvModeCVV  = '0' // CVV with the service code of the request.
+	cvvModeCVV2 = '1' // CVV2: service code 000.
+	cvvModeICVV = '2' // iCVV: service code 999.
+	cvvModeCVC3 = '3' // dynamic CVC3 under an MK-CVC3.
+)
+
+// cvvRequest holds the mode of a CW or CY request and the dynamic CVC3 inputs.
+type cvvRequest struct {
+	mode byte
+	psn  string // PAN sequence number (2N).
+	un   []byte // unpredictable number (4 bytes).
+	atc  []byte // application transaction counter (2 bytes).
+}
+
+// parseCVVMode reads the optional mode field that follows the service code of a CW or CY
+// request: '#' + mode (1N), and for dynamic CVC3 the PAN sequence number (2N),
+// unpredictable number (8H) and ATC (4H). Requests without the field, or too short to
+// hold card data, use CVV mode and are left to the card data checks.
+func parseCVVMode(cmd string, input []byte) (cvvRequest, error) {
+	req := cvvRequest{mode: cvvModeCVV}
+	idx := bytes.IndexByte(input, ';')
+	if idx < 0 || len(input) < idx+1+4+3+2 || input[idx+1+4+3] != '#' {
+		return req, nil
+	}
+	data := input[idx+1+4+3+1:]
+
+	req.mode = data[0]
+	switch req.mode {
+	case cvvModeCVV, cvvModeCVV2, cvvModeICVV:
+		return req, nil
+	case cvvModeCVC3:
+	default:
+		logError(fmt.Sprintf("%s: invalid CVV mode %c", cmd, req.mode))
+		return req, errorcodes.Err15
+	}
+
+	const cvc3FieldsLen = 1 + 2 + 8 + 4
+	if len(data) < cvc3FieldsLen {
+		logError(cmd + ": missing dynamic CVC3 fields")
+		return req, errorcodes.Err15
+	}
+	req.psn = string(data[1:3])
+	if req.psn[0] < '0' || req.psn[0] > '9' || req.psn[1] < '0' || req.psn[1] > '9' {
+		logError(cmd + ": invalid PAN sequence number")
+		return req, errorcodes.Err15
+	}
+	var err error
+	if req.un, err = hex.DecodeString(string(data[3:11])); err != nil {
+		logError(cmd + ": invalid unpredictable number")
+		return req, errorcodes.Err15
+	}
+	if req.atc, err = hex.DecodeString(string(data[11:15])); err != nil {
+		logError(cmd + ": invalid ATC")
+		return req, errorcodes.Err15
+	}
+
+	return req, nil
+}
+
+// keyType returns the LMK key type of the request key: MK-CVC3 for dynamic CVC3 and CVK
+// otherwise.
+func (r cvvRequest) keyType() string {
+	if r.mode == cvvModeCVC3 {
+		return "709"
+	}
+
+	return "402"
+}
+
+// calculate returns the card verification value of the mode. CVV2 and iCVV replace the
+// service code; dynamic CVC3 derives the ICC key from the MK-CVC3 with EMV option A and
+// uses PAN + 'D' + expiry date + service code as track data.
+func (r cvvRequest) calculate(cmd, panStr, expDate, servCode string, key []byte) ([]byte, error) {
+	switch r.mode {
+	case cvvModeCVV2:
+		servCode = "000"
+	case cvvModeICVV:
+		servCode = "999"
+	case cvvModeCVC3:
+		kd, err := cryptoutils.DeriveICCKeyOptionA(key, panStr, r.psn)
+		if err != nil {
+			return nil, err
+		}
+		defer cryptoutils.Zeroize(kd)
+
+		return cryptoutils.GetCVC3(kd, panStr+"D"+expDate+servCode, r.un, r.atc)
+	}
+
+	return cryptoutils.GetVisaCVVWith(decimalizerFor(cmd, panStr), panStr, expDate, servCode, key)
+}
@@ -1,12 +1,19 @@
 package logic
 
 import (
-	"bytes"
 	"testing"
 
 	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/msgspec"
+	"github.com/andrei-cloud/go_hsm/pkg/testutil"
 )
 
+// cxLayout describes a CX response.
+var cxLayout = msgspec.Spec{
+	Command: "CX",
+	Fields:  []msgspec.Field{msgspec.Fixed("cvv", 3, msgspec.EncodingNumeric)},
+}
+
 func TestExecuteCW(t *testing.T) {
 	t.Parallel()
 
@@ -131,6 +138,44 @@ func TestExecuteCW(t *testing.T) {
 			input: "0123456789ABCDEFFEDCBA98765432104111111111111111;2501999",
 			want:  "CX00790", // Different CVV expected due to different exp date and service code
 		},
+		{
+			name:  "CVV mode flag",
+			input: "U0123456789ABCDEFFEDCBA98765432104111111111111111;2412123#0",
+			want:  "CX00424",
+		},
+		{
+			name:  "CVV2 uses service code 000",
+			input: "U0123456789ABCDEFFEDCBA98765432104111111111111111;2412123#1",
+			want:  "CX00468",
+		},
+		{
+			name:  "iCVV uses service code 999",
+			input: "U0123456789ABCDEFFEDCBA98765432104111111111111111;2412123#2",
+			want:  "CX00738",
+		},
+		{
+			name:  "Dynamic CVC3 under MK-CVC3",
+			input: "U0123456789ABCDEFFEDCBA98765432104111111111111111;2412123#301123456780001",
+			want:  "CX00393",
+		},
+		{
+			name:     "Invalid CVV mode",
+			input:    "U0123456789ABCDEFFEDCBA98765432104111111111111111;2412123#9",
+			wantErr:  true,
+			wantCode: errorcodes.Err15,
+		},
+		{
+			name:     "Dynamic CVC3 fields missing",
+			input:    "U0123456789ABCDEFFEDCBA98765432104111111111111111;2412123#301",
+			wantErr:  true,
+			wantCode: errorcodes.Err15,
+		},
+		{
+			name:     "Dynamic CVC3 invalid ATC",
+			input:    "U0123456789ABCDEFFEDCBA98765432104111111111111111;2412123#30112345678000Z",
+			wantErr:  true,
+			wantCode: errorcodes.Err15,
+		},
 	}
 
 	for _, tt := range tests {
@@ -156,9 +201,7 @@ func TestExecuteCW(t *testing.T) {
 				return
 			}
 
-			if !bytes.Equal(got, []byte(tt.want)) {
-				t.Errorf("ExecuteCW() = %s, want %s", got, tt.want)
-			}
+			testutil.AssertResponse(t, cxLayout, got, []byte(tt.want))
 		})
 	}
 }
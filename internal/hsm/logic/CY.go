@@ -10,9 +10,12 @@ import (
 	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
 	"github.com/andrei-cloud/go_hsm/pkg/common"
 	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/pan"
 )
 
 // ExecuteCY executes the CY command to verify a CVV.
+// Format: CVK (U+32H or 2x16H) + CVV (3N) + PAN + ';' + Expiry date (4N) + Service code (3N)
+// + the optional mode field of CW, which selects CVV2, iCVV or dynamic CVC3 verification.
 func ExecuteCY(input []byte) ([]byte, error) {
 	logInfo("CY: Starting CVV verification.")
 	logDebug(fmt.Sprintf("CY: Input data: %s", common.FormatData(input)))
@@ -25,6 +28,11 @@ func ExecuteCY(input []byte) ([]byte, error) {
 		return nil, errorcodes.Err15
 	}
 
+	req, err := parseCVVMode("CY", input)
+	if err != nil {
+		return nil, err
+	}
+
 	var clearCVK []byte
 	var cvvStartIndex int
 
@@ -49,7 +57,7 @@ func ExecuteCY(input []byte) ([]byte, error) {
 		}
 
 		logInfo("CY: Decrypting CVK under LMK.")
-		decryptedCVK, err := LMKProviderInstance.DecryptUnderLMK(encryptedCVKBytes, "402", 'U')
+		decryptedCVK, err := LMKProviderInstance.DecryptUnderLMK(encryptedCVKBytes, req.keyType(), 'U')
 		if err != nil {
 			logError(fmt.Sprintf("CY: CVK decryption failed: %v", err))
 			if hsmErr, ok := err.(errorcodes.HSMError); ok {
@@ -58,6 +66,7 @@ func ExecuteCY(input []byte) ([]byte, error) {
 
 			return nil, errorcodes.Err10
 		}
+		defer cryptoutils.Zeroize(decryptedCVK)
 		clearCVK = decryptedCVK
 		// ensure DES odd parity on CVK for calculation
 		clearCVK = cryptoutils.FixKeyParity(clearCVK)
@@ -91,8 +100,8 @@ func ExecuteCY(input []byte) ([]byte, error) {
 		}
 
 		logInfo("CY: Decrypting CVKA under LMK.")
-		// Key Type "402" for CVK, Scheme 'X' for single-length key.
-		decryptedCVKA, err := LMKProviderInstance.DecryptUnderLMK(encryptedCVKABytes, "402", 'X')
+		// Key Type req.keyType() for CVK, Scheme 'X' for single-length key.
+		decryptedCVKA, err := LMKProviderInstance.DecryptUnderLMK(encryptedCVKABytes, req.keyType(), 'X')
 		if err != nil {
 			logError(fmt.Sprintf("CY: CVKA decryption failed: %v", err))
 			if hsmErr, ok := err.(errorcodes.HSMError); ok {
@@ -101,6 +110,7 @@ func ExecuteCY(input []byte) ([]byte, error) {
 
 			return nil, errorcodes.Err10
 		}
+		defer cryptoutils.Zeroize(decryptedCVKA)
 
 		logInfo("CY: Verifying CVKA parity.")
 		if !cryptoutils.CheckKeyParity(decryptedCVKA) {
@@ -116,7 +126,7 @@ func ExecuteCY(input []byte) ([]byte, error) {
 		}
 
 		logInfo("CY: Decrypting CVKB under LMK.")
-		decryptedCVKB, err := LMKProviderInstance.DecryptUnderLMK(encryptedCVKBBytes, "402", 'X')
+		decryptedCVKB, err := LMKProviderInstance.DecryptUnderLMK(encryptedCVKBBytes, req.keyType(), 'X')
 		if err != nil {
 			logError(fmt.Sprintf("CY: CVKB decryption failed: %v", err))
 			if hsmErr, ok := err.(errorcodes.HSMError); ok {
@@ -125,6 +135,8 @@ func ExecuteCY(input []byte) ([]byte, error) {
 
 			return nil, errorcodes.Err10
 		}
+		defer cryptoutils.Zeroize(decryptedCVKB)
+
 		logInfo("CY: Verifying CVKB parity.")
 		if !cryptoutils.CheckKeyParity(decryptedCVKB) {
 			logError("CY: CVKB parity check failed")
@@ -140,11 +152,14 @@ func ExecuteCY(input []byte) ([]byte, error) {
 
 		logInfo("CY: Combining key components.")
 		clearCVK = slices.Concat(decryptedCVKA, decryptedCVKB)
+		defer cryptoutils.Zeroize(clearCVK)
 		// ensure DES odd parity on combined CVK for calculation
 		clearCVK = cryptoutils.FixKeyParity(clearCVK)
 		logDebug(fmt.Sprintf("CY: Combined CVK value: %s", common.FormatData(clearCVK)))
 	}
 
+	defer cryptoutils.Zeroize(clearCVK)
+
 	logInfo("CY: Validating final CVK.")
 	logDebug(fmt.Sprintf("CY: Final CVK value: %s", common.FormatData(clearCVK)))
 
@@ -179,7 +194,7 @@ func ExecuteCY(input []byte) ([]byte, error) {
 
 	// cryptoutils.GetVisaCVV expects PAN as a hex string.
 	panHexStr := string(remainingData[:panDelimiterIndex])
-	logDebug(fmt.Sprintf("CY: PAN value: %s", panHexStr))
+	logDebug(fmt.Sprintf("CY: PAN value: %s", pan.Mask(panHexStr)))
 
 	// Expected data after PAN (hex) + ';': 4N (expDate) + 3N (servCode) = 7 bytes.
 	if len(remainingData) < panDelimiterIndex+1+4+3 {
@@ -194,12 +209,7 @@ func ExecuteCY(input []byte) ([]byte, error) {
 	logInfo("CY: Calculating CVV for verification.")
 	// Calculate CVV using the utility function.
 	// PAN is passed as a hex string, expDate and servCode as digit strings, cvk as raw bytes.
-	calculatedCVV, err := cryptoutils.GetVisaCVV(
-		panHexStr,
-		expDateStr,
-		servCodeStr,
-		clearCVK,
-	)
+	calculatedCVV, err := req.calculate("CY", panHexStr, expDateStr, servCodeStr, clearCVK)
 	if err != nil {
 		logError(fmt.Sprintf("CY: Error calculating CVV: %v", err))
 		// An error from GetVisaCVV could be due to various reasons (e.g., internal crypto error).
@@ -211,7 +221,7 @@ func ExecuteCY(input []byte) ([]byte, error) {
 	logDebug(fmt.Sprintf("CY: Calculated CVV: %s, Received CVV: %s", string(calculatedCVV), cvv))
 
 	// Compare calculated CVV with received CVV
-	if string(calculatedCVV) != cvv {
+	if !cryptoutils.ConstantTimeEqualString(string(calculatedCVV), cvv) {
 		logError("CY: CVV verification failed")
 
 		return nil, errorcodes.Err01
@@ -39,6 +39,33 @@ func TestExecuteCY(t *testing.T) {
 			want:    "",
 			wantErr: errorcodes.Err15,
 		},
+		{
+			name:  "Valid CVV2 verification",
+			input: "U0123456789ABCDEFFEDCBA9876543210" + "468" + "4111111111111111" + ";" + "2412" + "123" + "#1",
+			want:  "CZ00",
+		},
+		{
+			name:  "Valid iCVV verification",
+			input: "U0123456789ABCDEFFEDCBA9876543210" + "738" + "4111111111111111" + ";" + "2412" + "123" + "#2",
+			want:  "CZ00",
+		},
+		{
+			name: "Valid dynamic CVC3 verification",
+			input: "U0123456789ABCDEFFEDCBA9876543210" + "393" + "4111111111111111" + ";" + "2412" + "123" +
+				"#3" + "01" + "12345678" + "0001",
+			want: "CZ00",
+		},
+		{
+			name: "Dynamic CVC3 with another ATC",
+			input: "U0123456789ABCDEFFEDCBA9876543210" + "393" + "4111111111111111" + ";" + "2412" + "123" +
+				"#3" + "01" + "12345678" + "0002",
+			wantErr: errorcodes.Err01,
+		},
+		{
+			name:    "Invalid CVV mode",
+			input:   "U0123456789ABCDEFFEDCBA9876543210" + "468" + "4111111111111111" + ";" + "2412" + "123" + "#A",
+			wantErr: errorcodes.Err15,
+		},
 	}
 
 	for _, tt := range tests {
@@ -1,113 +1,85 @@
 package logic
 
 import (
-	"crypto/des"
 	"encoding/hex"
 	"fmt"
 	"slices"
 
 	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
 	"github.com/andrei-cloud/go_hsm/internal/hsm"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
 	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/msgspec"
 	"github.com/andrei-cloud/go_hsm/pkg/pinblock"
 )
 
-const (
-	tpkSize       = 33
-	pvkDoubleSize = 32
-	pvkSingleSize = 16
-	pinBlockSize  = 16
-	fmtCodeSize   = 2
-	accNumSize    = 12
-	pvkiSize      = 1
-	pvvSize       = 4
-)
+// dcSpec describes the DC (Verify PIN) request layout.
+var dcSpec = msgspec.Spec{
+	Command: "DC",
+	Fields: []msgspec.Field{
+		msgspec.Key("tpk", "U", 16),
+		msgspec.Key("pvk", "U", 32),
+		msgspec.Fixed("pin_block", 16, msgspec.EncodingHex),
+		msgspec.Fixed("format_code", 2, msgspec.EncodingNumeric),
+		msgspec.Fixed("account", 12, msgspec.EncodingNumeric),
+		msgspec.Fixed("pvki", 1, msgspec.EncodingNumeric),
+		msgspec.Fixed("pvv", 4, msgspec.EncodingNumeric),
+	},
+	AllowTrailing: true,
+}
 
 // ExecuteDC processes the DC (Verify PIN) command and returns response bytes.
-// Format: [TPK scheme + key](optional) + PIN block + source format code + account number + PVKI + PVV.
+// Format: TPK (U + 32H or 16H) + PVK (U + 32H or 2 x 16H) + PIN block + source format code +
+// account number + PVKI + PVV.
 func ExecuteDC(input []byte) ([]byte, error) {
 	logInfo("DC: starting PIN verification using Visa PVV")
-	data := input
-	// Minimum length calculation:
-	// TPK (48 for 24-byte key) + PIN Block (16) + Source PIN Block Format (2) +
-	// Account Number (12) + PVKI (2) + PVV (8) = 88 bytes.
-	if len(data) < 88 {
-		logError(fmt.Sprintf("DC: input data too short: %d bytes", len(data)))
-		return nil, errorcodes.Err15
+	msg, err := dcSpec.Parse(input)
+	if err != nil {
+		logError(fmt.Sprintf("DC: %v", err))
+		return nil, errorcodes.WithDetail(errorcodes.Err15, err.Error())
 	}
 
 	var clearPINString string
-	firstByte := data[0]
-	var decryptedTPK []byte
 
-	// Handle optional TPK
-	if firstByte == 'U' {
+	// Decrypt and validate TPK under LMK pair 14-15
+	tpk, _ := msg.Value("tpk")
+	tpkScheme := byte('X')
+	if tpk.Scheme == 'U' {
 		logInfo("DC: processing double-length TPK")
-		// Extract and decrypt TPK
-		tpkRaw, err := hex.DecodeString(string(data[1:tpkSize]))
-		if err != nil {
-			logError("DC: invalid TPK hex format")
-			return nil, errorcodes.Err15
-		}
-		data = data[tpkSize:]
-
-		// Decrypt and validate TPK under LMK pair 14-15
-		logInfo("DC: decrypting TPK under LMK")
-		decryptedTPK, err = LMKProviderInstance.DecryptUnderLMK(tpkRaw, "002", 'U')
-		if err != nil {
-			logError("DC: TPK decryption failed")
-			return nil, errorcodes.Err68
-		}
-
-		logInfo("DC: verifying TPK parity")
-		if !cryptoutils.CheckKeyParity(decryptedTPK) {
-			logError("DC: TPK parity check failed")
-			return nil, errorcodes.Err10
-		}
-
-		logDebug(fmt.Sprintf("DC: decrypted TPK value: %s", hex.EncodeToString(decryptedTPK)))
-	} else if len(data) >= 16 {
-		// Single length TPK without scheme
+		tpkScheme = 'U'
+	} else {
 		logInfo("DC: processing single-length TPK")
-		// Extract and decrypt TPK as single length
-		tpkRaw, err := hex.DecodeString(string(data[:16]))
-		if err != nil {
-			logError("DC: invalid TPK hex format")
-			return nil, errorcodes.Err15
-		}
-		data = data[16:]
+	}
 
-		// Decrypt and validate TPK under LMK pair 14-15
-		logInfo("DC: decrypting TPK under LMK")
-		decryptedTPK, err = LMKProviderInstance.DecryptUnderLMK(tpkRaw, "002", 'X')
-		if err != nil {
-			logError("DC: TPK decryption failed")
-			return nil, errorcodes.Err68
-		}
+	tpkRaw, err := hex.DecodeString(tpk.Data)
+	if err != nil {
+		logError("DC: invalid TPK hex format")
+		return nil, errorcodes.Err15
+	}
 
-		logInfo("DC: verifying TPK parity")
-		if !cryptoutils.CheckKeyParity(decryptedTPK) {
-			logError("DC: TPK parity check failed")
-			return nil, errorcodes.Err10
-		}
+	logInfo("DC: decrypting TPK under LMK")
+	decryptedTPK, err := LMKProviderInstance.DecryptUnderLMK(tpkRaw, "002", tpkScheme)
+	if err != nil {
+		logError("DC: TPK decryption failed")
+		return nil, errorcodes.Err68
 	}
+	defer cryptoutils.Zeroize(decryptedTPK)
 
-	// Handle PVK extraction and validation
-	if len(data) < pvkDoubleSize+1 { // Need 1 for scheme + 32 for hex key
-		logError("DC: insufficient data for PVK key")
-		return nil, errorcodes.Err15
+	logInfo("DC: verifying TPK parity")
+	if !cryptoutils.CheckKeyParity(decryptedTPK) {
+		logError("DC: TPK parity check failed")
+		return nil, errorcodes.Err10
 	}
 
+	logDebug(fmt.Sprintf("DC: decrypted TPK value: %s", hex.EncodeToString(decryptedTPK)))
+
 	// For PVK: Either 'U' + 32H or just 32H (two single keys)
-	pvkScheme := data[0]
+	pvk, _ := msg.Value("pvk")
 	var decryptedPVK []byte
-	var pvkBytesToSkip int // Track how many bytes to skip after PVK processing
 
-	if pvkScheme == 'U' {
+	if pvk.Scheme == 'U' {
 		logInfo("DC: processing double-length PVK with scheme")
-		// Double length key with 'U' scheme
-		pvkData := data[1 : 1+pvkDoubleSize] // Read 32 hex chars after scheme
-		rawPvk, err := hex.DecodeString(string(pvkData))
+		rawPvk, err := hex.DecodeString(pvk.Data)
 		if err != nil {
 			logError("DC: invalid PVK hex format")
 			return nil, errorcodes.Err15
@@ -120,6 +92,7 @@ func ExecuteDC(input []byte) ([]byte, error) {
 			logError("DC: PVK decryption failed")
 			return nil, errorcodes.Err68
 		}
+		defer cryptoutils.Zeroize(decryptedPVK)
 
 		// Check if double length key
 		if len(decryptedPVK) != 16 {
@@ -133,23 +106,15 @@ func ExecuteDC(input []byte) ([]byte, error) {
 			logError("DC: PVK parity check failed")
 			return nil, errorcodes.Err11
 		}
-		pvkBytesToSkip = 1 + pvkDoubleSize // Skip scheme + hex key
 	} else {
 		// Single length key pair format - process PVK A and PVK B
 		logInfo("DC: processing PVK as two single-length components")
-		// Ensure enough data for two single keys
-		if len(data) < pvkDoubleSize { // Need 16 + 16 hex chars
-			logError("DC: insufficient data for PVK components")
-			return nil, errorcodes.Err15
-		}
-
-		// Split into PVK A and B components
-		pvkAData := data[:pvkSingleSize]              // First 16 hex chars
-		pvkBData := data[pvkSingleSize:pvkDoubleSize] // Second 16 hex chars
+		pvkAData := pvk.Data[:16]
+		pvkBData := pvk.Data[16:]
 
 		// Decrypt PVK A
 		logInfo("DC: decrypting first PVK component")
-		encpvkA, err := hex.DecodeString(string(pvkAData))
+		encpvkA, err := hex.DecodeString(pvkAData)
 		if err != nil {
 			logError("DC: invalid first PVK component hex format")
 			return nil, errorcodes.Err15
@@ -159,6 +124,7 @@ func ExecuteDC(input []byte) ([]byte, error) {
 			logError("DC: first PVK component decryption failed")
 			return nil, errorcodes.Err68
 		}
+		defer cryptoutils.Zeroize(decryptedPVKA)
 
 		logInfo("DC: verifying first PVK component parity")
 		// Check PVK A parity after decryption
@@ -171,7 +137,7 @@ func ExecuteDC(input []byte) ([]byte, error) {
 
 		// Decrypt PVK B
 		logInfo("DC: decrypting second PVK component")
-		encpvkB, err := hex.DecodeString(string(pvkBData))
+		encpvkB, err := hex.DecodeString(pvkBData)
 		if err != nil {
 			logError("DC: invalid second PVK component hex format")
 			return nil, errorcodes.Err15
@@ -181,6 +147,7 @@ func ExecuteDC(input []byte) ([]byte, error) {
 			logError("DC: second PVK component decryption failed")
 			return nil, errorcodes.Err68
 		}
+		defer cryptoutils.Zeroize(decryptedPVKB)
 
 		logInfo("DC: verifying second PVK component parity")
 		// Check PVK B parity after decryption
@@ -193,39 +160,25 @@ func ExecuteDC(input []byte) ([]byte, error) {
 
 		// Combine PVK A and PVK B for final PVK (16 raw bytes)
 		logInfo("DC: combining PVK components")
-		decryptedPVK = slices.Concat(decryptedPVK, decryptedPVKB)
-
-		pvkBytesToSkip = pvkDoubleSize // Skip the two hex keys (16+16)
-	}
-
-	// Move to the next field after PVK
-	data = data[pvkBytesToSkip:]
-
-	// Extract and validate remaining fields
-	if len(data) < pinBlockSize+fmtCodeSize+accNumSize+pvkiSize+pvvSize {
-		logError("DC: insufficient data for remaining fields")
-		return nil, errorcodes.Err15
+		decryptedPVK = slices.Concat(decryptedPVKA, decryptedPVKB)
+		defer cryptoutils.Zeroize(decryptedPVK)
 	}
 
 	// Extract encrypted PIN block and remaining fields
 	logInfo("DC: extracting remaining input fields")
-	encryptedPinBlockHex := string(data[:pinBlockSize])
-	data = data[pinBlockSize:]
+	encryptedPinBlockHex := msg.Get("pin_block")
 	logDebug(fmt.Sprintf("DC: encrypted PIN block value: %s", encryptedPinBlockHex))
 
-	formatCode := string(data[:fmtCodeSize])
-	data = data[fmtCodeSize:]
+	formatCode := msg.Get("format_code")
 	logDebug(fmt.Sprintf("DC: format code: %s", formatCode))
 
-	accountNum := string(data[:accNumSize])
-	data = data[accNumSize:]
+	accountNum := msg.Get("account")
 	logDebug(fmt.Sprintf("DC: account number: %s", accountNum))
 
-	pvki := string(data[:pvkiSize])
-	data = data[pvkiSize:]
+	pvki := msg.Get("pvki")
 	logDebug(fmt.Sprintf("DC: PVKI: %s", pvki))
 
-	pvv := string(data[:pvvSize])
+	pvv := msg.Get("pvv")
 	logDebug(fmt.Sprintf("DC: received PVV: %s", pvv))
 
 	// If TPK was present, decrypt the PIN block using TPK
@@ -253,8 +206,10 @@ func ExecuteDC(input []byte) ([]byte, error) {
 			return nil, errorcodes.Err68
 		}
 
+		defer cryptoutils.Zeroize(fullTPK)
+
 		// Create TPK cipher
-		tpkCipher, err := des.NewTripleDESCipher(fullTPK)
+		tpkCipher, err := cryptoprovider.NewTripleDESCipher(fullTPK)
 		if err != nil {
 			logError("DC: failed to create TPK cipher")
 			return nil, errorcodes.Err68
@@ -272,6 +227,7 @@ func ExecuteDC(input []byte) ([]byte, error) {
 		logInfo("DC: decrypting PIN block with TPK")
 		decryptedPinBlock := make([]byte, len(pinBlockBin))
 		tpkCipher.Decrypt(decryptedPinBlock, pinBlockBin)
+		defer cryptoutils.Zeroize(decryptedPinBlock)
 		pinBlockForClearHex = hex.EncodeToString(decryptedPinBlock)
 		logDebug(fmt.Sprintf("DC: decrypted PIN block value: %s", pinBlockForClearHex))
 	} else {
@@ -298,7 +254,8 @@ func ExecuteDC(input []byte) ([]byte, error) {
 
 	// Calculate PVV using clear PIN
 	logInfo("DC: calculating PVV with extracted PIN")
-	calculatedPVV, err := cryptoutils.GetVisaPVV(
+	calculatedPVV, err := cryptoutils.GetVisaPVVWith(
+		decimalizerFor("DC", accountNum),
 		accountNum,
 		pvki,
 		clearPINString,
@@ -312,7 +269,7 @@ func ExecuteDC(input []byte) ([]byte, error) {
 
 	// Validate calculated PVV against received PVV
 	logInfo("DC: validating calculated PVV against input")
-	if string(calculatedPVV) != pvv {
+	if !cryptoutils.ConstantTimeEqualString(string(calculatedPVV), pvv) {
 		logError("DC: PVV verification failed")
 		return nil, errorcodes.Err01
 	}
@@ -64,6 +64,18 @@ func TestExecuteDC(t *testing.T) {
 			want:    "DD00",
 			wantErr: nil,
 		},
+		{
+			name:    "Valid PVK pair without scheme",
+			input:   validTPK + validPVK[1:] + "CB4EBC0180DFED6E01345513804937" + "1" + "2677",
+			want:    "DD00",
+			wantErr: nil,
+		},
+		{
+			name:    "Non numeric account number",
+			input:   validTPK + validPVK + "CB4EBC0180DFED6E0134551380493A" + "1" + "2677",
+			want:    "",
+			wantErr: errorcodes.Err15,
+		},
 	}
 
 	for _, tt := range tests {
@@ -73,7 +85,7 @@ func TestExecuteDC(t *testing.T) {
 
 			got, err := ExecuteDC([]byte(tt.input))
 			if tt.wantErr != nil {
-				assert.Equal(t, tt.wantErr, err)
+				assert.ErrorIs(t, err, tt.wantErr)
 				return
 			}
 
@@ -82,3 +94,22 @@ func TestExecuteDC(t *testing.T) {
 		})
 	}
 }
+
+func TestExecuteDCDiagnosticDetail(t *testing.T) {
+	t.Parallel()
+
+	if err := SetupTestLMKProvider(); err != nil {
+		t.Fatalf("Failed to setup test LMK provider: %v", err)
+	}
+
+	input := "U0123456789ABCDEFFEDCBA9876543210" + "U0123456789ABCDEF0123456789ABCDEF" +
+		"CB4EBC0180DFED6E0134551380493A" + "1" + "2677"
+
+	_, err := ExecuteDC([]byte(input))
+
+	var detailed errorcodes.DetailedError
+	if assert.ErrorAs(t, err, &detailed) {
+		assert.Equal(t, errorcodes.Err15, detailed.HSMError)
+		assert.Contains(t, detailed.Detail, "field account at offset 84")
+	}
+}
@@ -0,0 +1,138 @@
+package logic
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/internal/hsm"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+)
+
+// Field lengths of IBM 3624 PIN offset requests.
+const (
+	ibmOffsetLen         = 12 // offset, left-justified and padded with F.
+	ibmValidationDataLen = 12
+	ibmAccountDigits     = 5 // account digits replacing N in the validation data.
+)
+
+// ibmPINParams are the IBM 3624 fields of a request that follow the PIN block format.
+type ibmPINParams struct {
+	checkLen       int
+	account        string
+	decTable       string
+	validationData string // 16H, after account substitution and padding.
+}
+
+// ExecuteDE generates the IBM 3624 PIN offset of a customer selected PIN and returns
+// response bytes. The PIN arrives as a PIN block under a ZPK, the simulator holding no PINs
+// encrypted under the LMK.
+// Format: ZPK (U/T+32H/48H) + PVK (32H pair of single length keys, or U+32H) + PIN block
+// (16H) + Format (2N) + Check length (2N, 04-12) + Account number (12N) + Decimalization
+// table (16N) + PIN validation data (12A, hex digits with an optional N replaced by the last
+// 5 account digits, padded on the right with F).
+// Response: "DF" + "00" + Offset (12H, the offset digits padded on the right with F).
+func ExecuteDE(input []byte) ([]byte, error) {
+	logInfo("DE: starting IBM 3624 PIN offset generation")
+
+	zpk, data, err := parseVariantZPK("DE", input)
+	if err != nil {
+		return nil, err
+	}
+	pvk, data, err := parseVariantPVK("DE", data)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < 16+2 {
+		logError("DE: insufficient data for PIN block fields")
+		return nil, errorcodes.Err15
+	}
+	pinHex := string(data[:16])
+	formatCode := string(data[16:18])
+	params, err := parseIBMPINParams("DE", data[18:])
+	if err != nil {
+		return nil, err
+	}
+
+	clearPIN, err := decryptIBMPIN("DE", zpk, pinHex, formatCode, params)
+	if err != nil {
+		return nil, err
+	}
+
+	logInfo("DE: calculating PIN offset")
+	offset, err := cryptoutils.GetIBM3624Offset(pvk, params.validationData, params.decTable, clearPIN)
+	if err != nil {
+		logError(fmt.Sprintf("DE: failed to calculate PIN offset: %v", err))
+		return nil, errorcodes.Err68
+	}
+	logInfo("DE: PIN offset generated")
+
+	return []byte("DF00" + offset + strings.Repeat("F", ibmOffsetLen-len(offset))), nil
+}
+
+// parseIBMPINParams reads the check length, account number, decimalization table and PIN
+// validation data, which must end the request.
+func parseIBMPINParams(cmd string, data []byte) (ibmPINParams, error) {
+	const fieldsLen = 2 + 12 + 16 + ibmValidationDataLen
+	if len(data) != fieldsLen {
+		logError(fmt.Sprintf("%s: IBM PIN fields are %d characters, want %d", cmd, len(data), fieldsLen))
+		return ibmPINParams{}, errorcodes.Err15
+	}
+
+	checkLen, err := strconv.Atoi(string(data[:2]))
+	if err != nil || checkLen < cryptoutils.IBM3624MinPINLength ||
+		checkLen > cryptoutils.IBM3624MaxPINLength {
+		logError(fmt.Sprintf("%s: invalid check length %q", cmd, data[:2]))
+		return ibmPINParams{}, errorcodes.Err15
+	}
+	account := string(data[2:14])
+	decTable := string(data[14:30])
+	if _, err := cryptoutils.NewTableDecimalizer(decTable, false); err != nil {
+		logError(fmt.Sprintf("%s: %v", cmd, err))
+		return ibmPINParams{}, errorcodes.Err25
+	}
+
+	validationData := strings.Replace(string(data[30:]), "N",
+		account[len(account)-ibmAccountDigits:], 1)
+	validationData += strings.Repeat("F", 16-len(validationData))
+	if len(validationData) != 16 || strings.Trim(validationData, "0123456789ABCDEF") != "" {
+		logError(fmt.Sprintf("%s: invalid PIN validation data %q", cmd, data[30:]))
+		return ibmPINParams{}, errorcodes.Err15
+	}
+
+	return ibmPINParams{
+		checkLen:       checkLen,
+		account:        account,
+		decTable:       decTable,
+		validationData: validationData,
+	}, nil
+}
+
+// decryptIBMPIN decrypts the PIN block under the ZPK and checks that the PIN is long enough
+// for the check length.
+func decryptIBMPIN(
+	cmd string,
+	zpk []byte,
+	pinHex, formatCode string,
+	params ibmPINParams,
+) (string, error) {
+	format, err := hsm.GetPinBlockFormatFromThalesCode(formatCode)
+	if err != nil {
+		logError(fmt.Sprintf("%s: invalid PIN block format code: %s", cmd, formatCode))
+		return "", errorcodes.Err23
+	}
+	clearPIN, err := decryptPINBlock(cmd, zpk, pinHex, params.account, format)
+	if err != nil {
+		return "", err
+	}
+	if len(clearPIN) < cryptoutils.IBM3624MinPINLength ||
+		len(clearPIN) > cryptoutils.IBM3624MaxPINLength || len(clearPIN) < params.checkLen {
+		logError(fmt.Sprintf("%s: PIN of %d digits, check length %d", cmd, len(clearPIN),
+			params.checkLen))
+		return "", errorcodes.Err24
+	}
+
+	return clearPIN, nil
+}
@@ -0,0 +1,120 @@
+package logic
+
+import (
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/pinblock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// IBM 3624 test fields.
+const (
+	ibmTestPVK      = "0123456789ABCDEFFEDCBA9876543210"
+	ibmTestDecTable = "0123456789012345"
+)
+
+// ibmTestPINBlock returns pin for pinTestAccount in an ISO format 0 PIN block under
+// pinTestKey.
+func ibmTestPINBlock(t *testing.T, pin string) string {
+	t.Helper()
+
+	block, err := encryptPINBlock("DE", mustDecodeHex(pinTestKey), pin, pinTestAccount,
+		pinblock.ISO0)
+	require.NoError(t, err)
+
+	return cryptoutils.Raw2Str(block)
+}
+
+// ibmTestOffset calculates the offset of PIN digits with the IBM test fields.
+func ibmTestOffset(t *testing.T, validationData, pin string) string {
+	t.Helper()
+
+	offset, err := cryptoutils.GetIBM3624Offset(mustDecodeHex(ibmTestPVK), validationData,
+		ibmTestDecTable, pin)
+	require.NoError(t, err)
+
+	return offset
+}
+
+func TestExecuteDE(t *testing.T) {
+	t.Parallel()
+
+	keys := "U" + pinTestKey + "U" + ibmTestPVK
+	pinBlock := ibmTestPINBlock(t, "1234")
+	pinFields := pinBlock + "01"
+	singleOffset, err := cryptoutils.GetIBM3624Offset(mustDecodeHex("0123456789ABCDEF"),
+		"123456789012FFFF", ibmTestDecTable, "1234")
+	require.NoError(t, err)
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{
+			name:  "Validation data without account digits",
+			input: keys + pinFields + "04" + pinTestAccount + ibmTestDecTable + "123456789012",
+			want:  "DF00" + ibmTestOffset(t, "123456789012FFFF", "1234") + "FFFFFFFF",
+		},
+		{
+			name:  "Validation data with account digits",
+			input: keys + pinFields + "04" + pinTestAccount + ibmTestDecTable + "12345678901N",
+			want:  "DF00" + ibmTestOffset(t, "1234567890104937", "1234") + "FFFFFFFF",
+		},
+		{
+			name: "PVK as a pair of single length keys",
+			input: "U" + pinTestKey + "0123456789ABCDEF0123456789ABCDEF" + pinFields + "04" +
+				pinTestAccount + ibmTestDecTable + "123456789012",
+			want: "DF00" + singleOffset + "FFFFFFFF",
+		},
+		{
+			name:    "Check length longer than PIN",
+			input:   keys + pinFields + "06" + pinTestAccount + ibmTestDecTable + "123456789012",
+			wantErr: errorcodes.Err24,
+		},
+		{
+			name:    "Invalid check length",
+			input:   keys + pinFields + "03" + pinTestAccount + ibmTestDecTable + "123456789012",
+			wantErr: errorcodes.Err15,
+		},
+		{
+			name:    "Invalid decimalization table",
+			input:   keys + pinFields + "04" + pinTestAccount + "0123456789ABCDEF" + "123456789012",
+			wantErr: errorcodes.Err25,
+		},
+		{
+			name:    "Invalid validation data",
+			input:   keys + pinFields + "04" + pinTestAccount + ibmTestDecTable + "12345678901Z",
+			wantErr: errorcodes.Err15,
+		},
+		{
+			name:    "Invalid format code",
+			input:   keys + pinBlock + "99" + "04" + pinTestAccount + ibmTestDecTable + "123456789012",
+			wantErr: errorcodes.Err23,
+		},
+		{
+			name:    "ZPK parity error",
+			input:   "U" + pinTestKey[:31] + "1" + "U" + ibmTestPVK + pinFields + "04" + pinTestAccount + ibmTestDecTable + "123456789012",
+			wantErr: errorcodes.Err10,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ExecuteDE([]byte(tc.input))
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, string(got))
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package logic
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"strconv"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+)
+
+// ExecuteEA verifies an interchange PIN against an IBM 3624 PIN offset and returns response
+// bytes.
+// Format: ZPK (U/T+32H/48H) + PVK (32H pair of single length keys, or U+32H) + Maximum PIN
+// length (2N) + PIN block (16H) + Format (2N) + Check length (2N, 04-12) + Account number
+// (12N) + Decimalization table (16N) + PIN validation data (12A, as for DE) + Offset (12H,
+// left-justified and padded with F). The leftmost check length digits of the PIN are
+// verified.
+// Response: "EB" + "00".
+func ExecuteEA(input []byte) ([]byte, error) {
+	logInfo("EA: starting PIN verification using IBM 3624 offset")
+
+	zpk, data, err := parseVariantZPK("EA", input)
+	if err != nil {
+		return nil, err
+	}
+	pvk, data, err := parseVariantPVK("EA", data)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < 2+16+2+ibmOffsetLen {
+		logError("EA: insufficient data for PIN block fields")
+		return nil, errorcodes.Err15
+	}
+	maxLen, err := strconv.Atoi(string(data[:2]))
+	if err != nil {
+		logError("EA: invalid maximum PIN length")
+		return nil, errorcodes.Err15
+	}
+	pinHex := string(data[2:18])
+	formatCode := string(data[18:20])
+	offset := data[len(data)-ibmOffsetLen:]
+	params, err := parseIBMPINParams("EA", data[20:len(data)-ibmOffsetLen])
+	if err != nil {
+		return nil, err
+	}
+
+	clearPIN, err := decryptIBMPIN("EA", zpk, pinHex, formatCode, params)
+	if err != nil {
+		return nil, err
+	}
+	if len(clearPIN) > maxLen {
+		logError(fmt.Sprintf("EA: PIN of %d digits exceeds maximum %d", len(clearPIN), maxLen))
+		return nil, errorcodes.Err24
+	}
+
+	logInfo("EA: calculating PIN offset")
+	calculated, err := cryptoutils.GetIBM3624Offset(pvk, params.validationData, params.decTable,
+		clearPIN[:params.checkLen])
+	if err != nil {
+		logError(fmt.Sprintf("EA: failed to calculate PIN offset: %v", err))
+		return nil, errorcodes.Err68
+	}
+	if subtle.ConstantTimeCompare([]byte(calculated), offset[:params.checkLen]) != 1 {
+		logError("EA: PIN offset verification failed")
+		return nil, errorcodes.Err01
+	}
+	logInfo("EA: PIN verification completed successfully")
+
+	return []byte("EB" + errorcodes.Err00.CodeOnly()), nil
+}
@@ -0,0 +1,56 @@
+package logic
+
+import (
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteEA(t *testing.T) {
+	t.Parallel()
+
+	keys := "U" + pinTestKey + "U" + ibmTestPVK
+	pinBlock := ibmTestPINBlock(t, "12345")
+	offset := ibmTestOffset(t, "1234567890104937", "12345") + "FFFFFFF"
+	fields := func(maxLen, checkLen, offset string) string {
+		return keys + maxLen + pinBlock + "01" + checkLen + pinTestAccount + ibmTestDecTable +
+			"12345678901N" + offset
+	}
+	// An offset differing in its last digit still verifies the leftmost four PIN digits.
+	lastDigit := offset[:4] + string('0'+(offset[4]-'0'+1)%10) + offset[5:]
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr error
+	}{
+		{name: "Offset verified", input: fields("12", "05", offset)},
+		{name: "Shorter check length", input: fields("12", "04", lastDigit)},
+		{name: "Offset mismatch", input: fields("12", "05", lastDigit), wantErr: errorcodes.Err01},
+		{name: "PIN longer than maximum", input: fields("04", "04", offset), wantErr: errorcodes.Err24},
+		{name: "Missing offset", input: fields("12", "05", ""), wantErr: errorcodes.Err15},
+		{
+			name:    "Invalid PVK parity",
+			input:   "U" + pinTestKey + "U" + ibmTestPVK[:31] + "1" + fields("12", "05", offset)[66:],
+			wantErr: errorcodes.Err11,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ExecuteEA([]byte(tc.input))
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "EB00", string(got))
+		})
+	}
+}
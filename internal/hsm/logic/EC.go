@@ -1,14 +1,16 @@
 package logic
 
 import (
-	"crypto/des"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"slices"
 
 	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
 	"github.com/andrei-cloud/go_hsm/internal/hsm"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
 	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/keyschemes"
 	"github.com/andrei-cloud/go_hsm/pkg/pinblock"
 )
 
@@ -16,138 +18,16 @@ import (
 // Format: [ZPK scheme + key] + PVK scheme + key + PIN block + format code + account number + PVKI + PVV.
 func ExecuteEC(input []byte) ([]byte, error) {
 	logInfo("EC: starting PIN verification using ABA PVV")
-	data := input
-
-	// Parse ZPK under LMK variant
-	if len(data) < 1 {
-		logError("EC: missing ZPK scheme")
-		return nil, errorcodes.Err15
-	}
-
-	zpkScheme := data[0]
-	logDebug(fmt.Sprintf("EC: ZPK scheme: %c", zpkScheme))
-	if zpkScheme != 'U' && zpkScheme != 'T' {
-		logError("EC: invalid ZPK scheme value")
-		return nil, errorcodes.Err26
-	}
-
-	rawZpkLen := getKeyLength(zpkScheme)
-	hexZpkLen := rawZpkLen * 2
-	logDebug(fmt.Sprintf("EC: ZPK length: %d bytes (%d hex chars)", rawZpkLen, hexZpkLen))
-
-	if len(data) < 1+hexZpkLen {
-		logError("EC: insufficient data for ZPK key")
-		return nil, errorcodes.Err15
-	}
-
-	logInfo("EC: extracting and decrypting ZPK")
-	encryptedZpkHex := string(data[1 : 1+hexZpkLen])
-	data = data[1+hexZpkLen:]
-
-	encryptedZpk, err := hex.DecodeString(encryptedZpkHex)
+	decryptedZpk, data, err := parseVariantZPK("EC", input)
 	if err != nil {
-		logError("EC: invalid ZPK hex format")
-		return nil, errorcodes.Err15
+		return nil, err
 	}
-
-	decryptedZpk, err := LMKProviderInstance.DecryptUnderLMK(encryptedZpk, "001", zpkScheme)
+	defer cryptoutils.Zeroize(decryptedZpk)
+	decryptedPvk, data, err := parseVariantPVK("EC", data)
 	if err != nil {
-		logError("EC: ZPK decryption failed")
-		return nil, errorcodes.Err68
-	}
-
-	logInfo("EC: verifying ZPK parity")
-	if !cryptoutils.CheckKeyParity(decryptedZpk) {
-		logError("EC: ZPK parity check failed")
-		return nil, errorcodes.Err10
-	}
-
-	// Parse PVK under LMK variant
-	// PVK can be either:
-	// 1. 32 hex chars (no scheme) - a pair of single length keys, each encrypted separately
-	// 2. 'U' + 32 hex chars - a double length key with scheme
-	var encryptedPvkHex string
-	var pvkScheme byte = 'U' // default scheme for double length key
-	const singleKeySize = 16 // 8 bytes = 16 hex chars
-	var decryptedPvk []byte
-
-	if data[0] == 'U' {
-		logInfo("EC: processing double-length PVK with scheme")
-		if len(data) < 1+32 {
-			logError("EC: insufficient data for PVK with scheme")
-			return nil, errorcodes.Err15
-		}
-		encryptedPvkHex = string(data[1:33])
-		data = data[33:]
-
-		// Decrypt as one double-length key
-		encryptedPvk, err := hex.DecodeString(encryptedPvkHex)
-		if err != nil {
-			logError("EC: invalid PVK hex format")
-			return nil, errorcodes.Err15
-		}
-
-		logInfo("EC: decrypting PVK under LMK")
-		decryptedPvk, err = LMKProviderInstance.DecryptUnderLMK(encryptedPvk, "002", pvkScheme)
-		if err != nil {
-			logError("EC: PVK decryption failed")
-			return nil, errorcodes.Err68
-		}
-	} else {
-		logInfo("EC: processing PVK as two single-length components")
-		if len(data) < 32 {
-			logError("EC: insufficient data for PVK components")
-			return nil, errorcodes.Err15
-		}
-		encryptedPvkHex = string(data[:32])
-		data = data[32:]
-
-		// Split into two parts and decrypt each separately
-		encryptedPvkA := encryptedPvkHex[:singleKeySize]
-		encryptedPvkB := encryptedPvkHex[singleKeySize:]
-
-		// Decrypt part A
-		logInfo("EC: decrypting first PVK component")
-		encPvkBytesA, err := hex.DecodeString(encryptedPvkA)
-		if err != nil {
-			logError("EC: invalid first PVK component hex format")
-			return nil, errorcodes.Err15
-		}
-		decryptedPvkA, err := LMKProviderInstance.DecryptUnderLMK(encPvkBytesA, "002", 'X')
-		if err != nil {
-			logError("EC: first PVK component decryption failed")
-			return nil, errorcodes.Err68
-		}
-
-		// Decrypt part B
-		logInfo("EC: decrypting second PVK component")
-		encPvkBytesB, err := hex.DecodeString(encryptedPvkB)
-		if err != nil {
-			logError("EC: invalid second PVK component hex format")
-			return nil, errorcodes.Err15
-		}
-		decryptedPvkB, err := LMKProviderInstance.DecryptUnderLMK(encPvkBytesB, "002", 'X')
-		if err != nil {
-			logError("EC: second PVK component decryption failed")
-			return nil, errorcodes.Err68
-		}
-
-		// Concatenate the decrypted parts
-		decryptedPvk = slices.Concat(decryptedPvkA, decryptedPvkB)
-	}
-
-	logInfo("EC: verifying PVK components parity")
-	// Check parity for each half of the key separately
-	pvkA := decryptedPvk[:8]   // First 8 bytes
-	pvkB := decryptedPvk[8:16] // Second 8 bytes
-	if !cryptoutils.CheckKeyParity(pvkA) {
-		logError("EC: first PVK component parity check failed")
-		return nil, errorcodes.Err11
-	}
-	if !cryptoutils.CheckKeyParity(pvkB) {
-		logError("EC: second PVK component parity check failed")
-		return nil, errorcodes.Err11
+		return nil, err
 	}
+	defer cryptoutils.Zeroize(decryptedPvk)
 
 	// Parse remaining fields
 	const pinHexLen = 16
@@ -183,7 +63,9 @@ func ExecuteEC(input []byte) ([]byte, error) {
 
 	// Decrypt PIN block with ZPK
 	logInfo("EC: preparing to decrypt PIN block")
-	cipher, err := des.NewTripleDESCipher(cryptoutils.PrepareTripleDESKey(decryptedZpk))
+	zpkKey := cryptoutils.PrepareTripleDESKey(decryptedZpk)
+	defer cryptoutils.Zeroize(zpkKey)
+	cipher, err := cryptoprovider.NewTripleDESCipher(zpkKey)
 	if err != nil {
 		logError("EC: failed to create ZPK cipher")
 		return nil, fmt.Errorf("create zpk cipher: %w", err)
@@ -198,6 +80,7 @@ func ExecuteEC(input []byte) ([]byte, error) {
 	logInfo("EC: decrypting PIN block with ZPK")
 	clearBlock := make([]byte, len(encPin))
 	cipher.Decrypt(clearBlock, encPin)
+	defer cryptoutils.Zeroize(clearBlock)
 	logDebug(fmt.Sprintf("EC: decrypted PIN block value: %x", clearBlock))
 
 	logInfo("EC: validating PIN block format")
@@ -217,7 +100,13 @@ func ExecuteEC(input []byte) ([]byte, error) {
 
 	// Calculate and verify PVV
 	logInfo("EC: calculating PVV with extracted PIN")
-	calculated, err := cryptoutils.GetVisaPVV(accountNum, pvki, clearPIN, decryptedPvk)
+	calculated, err := cryptoutils.GetVisaPVVWith(
+		decimalizerFor("EC", accountNum),
+		accountNum,
+		pvki,
+		clearPIN,
+		decryptedPvk,
+	)
 	if err != nil {
 		logError("EC: failed to calculate PVV")
 		return nil, errorcodes.Err68
@@ -225,7 +114,7 @@ func ExecuteEC(input []byte) ([]byte, error) {
 	logDebug(fmt.Sprintf("EC: calculated PVV value: %s", calculated))
 
 	logInfo("EC: validating calculated PVV against input")
-	if string(calculated) != pvv {
+	if !cryptoutils.ConstantTimeEqualString(string(calculated), pvv) {
 		logError("EC: PVV verification failed")
 		return nil, errorcodes.Err01
 	}
@@ -234,3 +123,107 @@ func ExecuteEC(input []byte) ([]byte, error) {
 
 	return []byte("ED" + errorcodes.Err00.CodeOnly()), nil
 }
+
+// parseVariantZPK reads the ZPK (U/T scheme) under the variant LMK at the start of data and
+// returns it in the clear with the bytes that follow.
+func parseVariantZPK(cmd string, data []byte) ([]byte, []byte, error) {
+	if len(data) < 1 {
+		logError(cmd + ": missing ZPK scheme")
+		return nil, nil, errorcodes.Err15
+	}
+
+	logDebug(fmt.Sprintf("%s: ZPK scheme: %c", cmd, data[0]))
+	zpk, data, err := keyschemes.Parse(data, "UT", 0)
+	switch {
+	case errors.Is(err, keyschemes.ErrUnknownScheme):
+		logError(cmd + ": invalid ZPK scheme value")
+		return nil, nil, errorcodes.Err26
+	case err != nil:
+		logError(fmt.Sprintf("%s: invalid ZPK key: %v", cmd, err))
+		return nil, nil, errorcodes.Err15
+	}
+	logDebug(fmt.Sprintf("%s: ZPK length: %d bytes (%d hex chars)", cmd, zpk.Length, len(zpk.Text)))
+
+	logInfo(cmd + ": extracting and decrypting ZPK")
+	encryptedZpk, err := zpk.Bytes()
+	if err != nil {
+		logError(cmd + ": invalid ZPK hex format")
+		return nil, nil, errorcodes.Err15
+	}
+
+	decryptedZpk, err := LMKProviderInstance.DecryptUnderLMK(encryptedZpk, "001", zpk.Scheme)
+	if err != nil {
+		logError(cmd + ": ZPK decryption failed")
+		return nil, nil, errorcodes.Err68
+	}
+
+	logInfo(cmd + ": verifying ZPK parity")
+	if !cryptoutils.CheckKeyParity(decryptedZpk) {
+		cryptoutils.Zeroize(decryptedZpk)
+		logError(cmd + ": ZPK parity check failed")
+		return nil, nil, errorcodes.Err10
+	}
+
+	return decryptedZpk, data, nil
+}
+
+// parseVariantPVK reads the PVK under the variant LMK at the start of data and returns it in
+// the clear with the bytes that follow. The PVK is either 32 hex characters without scheme,
+// a pair of single length keys each encrypted separately, or 'U' and 32 hex characters, a
+// double length key.
+func parseVariantPVK(cmd string, data []byte) ([]byte, []byte, error) {
+	pvk, data, err := keyschemes.Parse(data, "U", 32)
+	if err != nil {
+		logError(fmt.Sprintf("%s: invalid PVK: %v", cmd, err))
+		return nil, nil, errorcodes.Err15
+	}
+	encryptedPvk, err := pvk.Bytes()
+	if err != nil {
+		logError(cmd + ": invalid PVK hex format")
+		return nil, nil, errorcodes.Err15
+	}
+
+	var decryptedPvk []byte
+	if pvk.Scheme == 'U' {
+		logInfo(cmd + ": decrypting double-length PVK under LMK")
+		decryptedPvk, err = LMKProviderInstance.DecryptUnderLMK(encryptedPvk, "002", pvk.Scheme)
+		if err != nil {
+			logError(cmd + ": PVK decryption failed")
+			return nil, nil, errorcodes.Err68
+		}
+	} else {
+		logInfo(cmd + ": decrypting first PVK component")
+		decryptedPvkA, err := LMKProviderInstance.DecryptUnderLMK(encryptedPvk[:8], "002", 'X')
+		if err != nil {
+			logError(cmd + ": first PVK component decryption failed")
+			return nil, nil, errorcodes.Err68
+		}
+
+		logInfo(cmd + ": decrypting second PVK component")
+		decryptedPvkB, err := LMKProviderInstance.DecryptUnderLMK(encryptedPvk[8:], "002", 'X')
+		if err != nil {
+			cryptoutils.Zeroize(decryptedPvkA)
+			logError(cmd + ": second PVK component decryption failed")
+			return nil, nil, errorcodes.Err68
+		}
+
+		// Concatenate the decrypted parts
+		decryptedPvk = slices.Concat(decryptedPvkA, decryptedPvkB)
+		cryptoutils.Zeroize(decryptedPvkA, decryptedPvkB)
+	}
+
+	logInfo(cmd + ": verifying PVK components parity")
+	// Check parity for each half of the key separately
+	if !cryptoutils.CheckKeyParity(decryptedPvk[:8]) {
+		cryptoutils.Zeroize(decryptedPvk)
+		logError(cmd + ": first PVK component parity check failed")
+		return nil, nil, errorcodes.Err11
+	}
+	if !cryptoutils.CheckKeyParity(decryptedPvk[8:16]) {
+		cryptoutils.Zeroize(decryptedPvk)
+		logError(cmd + ": second PVK component parity check failed")
+		return nil, nil, errorcodes.Err11
+	}
+
+	return decryptedPvk, data, nil
+}
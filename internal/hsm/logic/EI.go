@@ -0,0 +1,272 @@
+package logic
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/internal/hsm/rsakey"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+	"github.com/andrei-cloud/go_hsm/pkg/keyschemes"
+	"github.com/andrei-cloud/go_hsm/pkg/msgspec"
+	"github.com/andrei-cloud/go_hsm/pkg/rsapub"
+)
+
+// Attributes of RSA private keys.
+const (
+	rsaPrivateKeyType   = "00C"
+	rsaKeyUsage         = "03"
+	rsaKeyAlgorithm     = 'R'
+	rsaKeyBlockLength   = "FFFF" // private key length of keys held in key blocks.
+	rsaModesSign        = "SN"   // modes of use permitting signature generation.
+	rsaModesDecrypt     = "DN"   // modes of use permitting key decryption.
+	rsaKeyTypeSignature = '0'
+	rsaKeyTypeKeyMgmt   = '1'
+	rsaKeyTypeBoth      = '2'
+)
+
+// rsaKeyTypeModes maps the EI key type indicator to the mode of use of key block private
+// keys.
+var rsaKeyTypeModes = map[byte]byte{
+	rsaKeyTypeSignature: 'S',
+	rsaKeyTypeKeyMgmt:   'D',
+	rsaKeyTypeBoth:      'N',
+}
+
+// rsaPublicKeyEncodings maps the public key encoding rule to the rsapub encoding.
+var rsaPublicKeyEncodings = map[string]rsapub.Encoding{
+	"01": rsapub.EncodingThales,
+	"02": rsapub.EncodingDER,
+}
+
+// ExecuteEI generates an RSA key pair and returns response bytes.
+// Format: Key type indicator (1N: 0 signature only, 1 key management only, 2 both) +
+// Modulus length (4N, 1024 to 4096 bits) + Public key encoding (2N: 01 DER with unsigned
+// integers, 02 DER). The private key is encrypted under LMK pair 34-35 (key type 00C) unless
+// key block attributes follow as '#' + key version number (2N) + exportability (1A) + number
+// of optional blocks (2N, 00); it is then wrapped in an S key block with key usage 03,
+// algorithm R and the mode of use of the key type indicator (S, D or N) under the LMK named
+// by the LMK identifier. An LMK identifier may follow the request as '%' and two digits.
+// Response: "EJ" + "00" + Public key length (4N, bytes) + Public key (hex) + Private key
+// length (4N, bytes, or FFFF for a key block) + Private key (hex, or the key block followed
+// by ';' when its header carries no block length).
+func ExecuteEI(input []byte) ([]byte, error) {
+	logInfo("EI: starting RSA key pair generation")
+
+	const fieldsLen = 1 + 4 + 2
+	if len(input) < fieldsLen {
+		logError("EI: insufficient data for key type, modulus length and encoding")
+		return nil, errorcodes.Err15
+	}
+	mode, ok := rsaKeyTypeModes[input[0]]
+	if !ok {
+		logError(fmt.Sprintf("EI: invalid key type indicator %c", input[0]))
+		return nil, errorcodes.Err15
+	}
+	bits, err := strconv.Atoi(string(input[1:5]))
+	if err != nil {
+		logError("EI: invalid modulus length")
+		return nil, errorcodes.Err15
+	}
+	encoding, ok := rsaPublicKeyEncodings[string(input[5:7])]
+	if !ok {
+		logError(fmt.Sprintf("EI: invalid public key encoding %s", input[5:7]))
+		return nil, errorcodes.Err15
+	}
+	trailer, err := parseTrailingFields("EI", input[fieldsLen:], "#%")
+	if err != nil {
+		return nil, err
+	}
+	if len(trailer.Positional) != 0 {
+		logError("EI: unexpected data after public key encoding")
+		return nil, errorcodes.Err15
+	}
+
+	var template []byte
+	if attrs, ok := trailer.Field(msgspec.DelimKeyBlockHeader); ok {
+		if template, err = rsaKeyBlockTemplate(attrs, mode, trailer); err != nil {
+			return nil, err
+		}
+	}
+
+	key, err := rsakey.Generate(bits)
+	if err != nil {
+		logError(fmt.Sprintf("EI: key generation failed: %v", err))
+		if errors.Is(err, rsakey.ErrKeySize) {
+			return nil, errorcodes.Err76
+		}
+
+		return nil, errorcodes.Err43
+	}
+	logInfo(fmt.Sprintf("EI: generated %d bit RSA key pair", bits))
+
+	pub, err := rsapub.Export(&key.PublicKey, encoding)
+	if err != nil {
+		logError(fmt.Sprintf("EI: public key encoding failed: %v", err))
+		return nil, errorcodes.Err43
+	}
+	private, err := sealRSAPrivateKey("EI", key, template)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := fmt.Appendf(nil, "EJ00%04d", len(pub))
+
+	return slices.Concat(resp, cryptoutils.Raw2B(pub), private), nil
+}
+
+// rsaKeyBlockTemplate builds the header template of a key block private key from the EI key
+// block attributes and the LMK identifier in trailer.
+func rsaKeyBlockTemplate(attrs []byte, mode byte, trailer *msgspec.Tokens) ([]byte, error) {
+	if len(attrs) != 2+1+2 {
+		logError("EI: invalid key block attributes")
+		return nil, errorcodes.Err15
+	}
+	if string(attrs[3:5]) != "00" {
+		logError("EI: optional blocks are not supported")
+		return nil, errorcodes.Err15
+	}
+	lmkID := DefaultKeyBlockLMKID
+	if id, ok := trailer.Field(msgspec.DelimLMKID); ok {
+		lmkID = string(id)
+	}
+	if _, err := LookupKeyBlockLMK(lmkID); err != nil {
+		logError(fmt.Sprintf("EI: LMK %s is not a key block LMK", lmkID))
+		return nil, errorcodes.Err13
+	}
+
+	template := fmt.Appendf(nil, "S10000%s%c%c%s%c00%s", rsaKeyUsage, rsaKeyAlgorithm, mode,
+		attrs[0:2], attrs[2], lmkID)
+	if _, err := keyblocklmk.ParseHeader(template); err != nil {
+		logError(fmt.Sprintf("EI: invalid key block attributes: %v", err))
+		return nil, errorcodes.Err15
+	}
+
+	return template, nil
+}
+
+// sealRSAPrivateKey protects the private key for the response: wrapped in a key block with
+// the header template when one is given, else encrypted under LMK pair 34-35. It returns the
+// private key length field followed by the key.
+func sealRSAPrivateKey(cmd string, key *rsa.PrivateKey, template []byte) ([]byte, error) {
+	if template != nil {
+		logInfo(cmd + ": wrapping private key in a key block under LMK")
+		block, err := LMKProviderInstance.EncryptUnderLMK(x509.MarshalPKCS1PrivateKey(key),
+			string(template), keyschemes.SchemeS)
+		if err != nil {
+			logError(fmt.Sprintf("%s: private key wrap failed: %v", cmd, err))
+			return nil, errorcodes.Err49
+		}
+		// Without a block length in the header the response marks the end of the block.
+		if len(block) > 5 && string(block[2:6]) == "0000" {
+			block = append(block, msgspec.DelimKeySchemes)
+		}
+
+		return slices.Concat([]byte(rsaKeyBlockLength), block), nil
+	}
+
+	logInfo(cmd + ": encrypting private key under LMK")
+	sealed, err := rsakey.Seal(key, func(block []byte) ([]byte, error) {
+		return LMKProviderInstance.EncryptUnderLMK(block, rsaPrivateKeyType, keyschemes.SchemeZ)
+	})
+	if err != nil {
+		logError(fmt.Sprintf("%s: private key encryption failed: %v", cmd, err))
+		return nil, errorcodes.Err49
+	}
+
+	return slices.Concat(fmt.Appendf(nil, "%04d", len(sealed)), cryptoutils.Raw2B(sealed)), nil
+}
+
+// openRSAPrivateKey reads the private key length and private key at the start of data, as
+// sealRSAPrivateKey returns them, and decrypts the key. Key block private keys must permit
+// one of modes. It returns the key with the bytes that follow it.
+func openRSAPrivateKey(cmd string, data []byte, modes string) (*rsa.PrivateKey, []byte, error) {
+	if len(data) < 4 {
+		logError(cmd + ": missing private key length")
+		return nil, nil, errorcodes.Err15
+	}
+
+	if string(data[:4]) == rsaKeyBlockLength {
+		block, rest, err := unwrapRSAKeyBlock(cmd, data[4:], modes)
+		if err != nil {
+			return nil, nil, err
+		}
+		key, err := rsakey.ParsePrivateKey(block)
+		if err != nil {
+			logError(fmt.Sprintf("%s: %v", cmd, err))
+			return nil, nil, errorcodes.Err49
+		}
+
+		return key, rest, nil
+	}
+
+	keyLen, err := strconv.Atoi(string(data[:4]))
+	if err != nil || keyLen <= 0 {
+		logError(cmd + ": invalid private key length")
+		return nil, nil, errorcodes.Err78
+	}
+	data = data[4:]
+	if len(data) < 2*keyLen {
+		logError(cmd + ": private key shorter than its length")
+		return nil, nil, errorcodes.Err78
+	}
+	sealed, err := hex.DecodeString(string(data[:2*keyLen]))
+	if err != nil {
+		logError(cmd + ": invalid private key hex format")
+		return nil, nil, errorcodes.Err15
+	}
+
+	logInfo(cmd + ": decrypting private key under LMK")
+	key, err := rsakey.Open(sealed, func(block []byte) ([]byte, error) {
+		return LMKProviderInstance.DecryptUnderLMK(block, rsaPrivateKeyType, keyschemes.SchemeZ)
+	})
+	if err != nil {
+		logError(fmt.Sprintf("%s: private key decryption failed: %v", cmd, err))
+		return nil, nil, errorcodes.Err49
+	}
+
+	return key, data[2*keyLen:], nil
+}
+
+// unwrapRSAKeyBlock reads the private key block at the start of data, checks its key usage,
+// algorithm and mode of use, and returns the clear key with the bytes that follow the block.
+func unwrapRSAKeyBlock(cmd string, data []byte, modes string) ([]byte, []byte, error) {
+	if len(data) == 0 || !keyschemes.IsKeyBlock(data[0]) {
+		logError(cmd + ": private key must be a key block")
+		return nil, nil, errorcodes.Err26
+	}
+	block, rest, err := keyblocklmk.SplitKeyBlock(data)
+	if err != nil {
+		logError(fmt.Sprintf("%s: %v", cmd, err))
+		return nil, nil, errorcodes.Err83
+	}
+	header, err := keyblocklmk.ParseHeader(block)
+	if err != nil {
+		logError(fmt.Sprintf("%s: %v", cmd, err))
+		return nil, nil, errorcodes.Err83
+	}
+	if header.KeyUsage != rsaKeyUsage || header.Algorithm != rsaKeyAlgorithm {
+		logError(fmt.Sprintf("%s: key usage %s algorithm %c is not an RSA private key",
+			cmd, header.KeyUsage, header.Algorithm))
+		return nil, nil, errorcodes.Err29
+	}
+	if !slices.Contains([]byte(modes), header.ModeOfUse) {
+		logError(fmt.Sprintf("%s: mode of use %c not permitted", cmd, header.ModeOfUse))
+		return nil, nil, errorcodes.Err29
+	}
+
+	logInfo(cmd + ": unwrapping private key block under LMK")
+	key, err := LMKProviderInstance.DecryptUnderLMK(block, keyBlockKeyType, keyschemes.SchemeS)
+	if err != nil {
+		logError(cmd + ": private key block unwrap failed")
+		return nil, nil, errorcodes.Err68
+	}
+
+	return key, rest, nil
+}
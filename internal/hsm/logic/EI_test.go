@@ -0,0 +1,130 @@
+package logic
+
+import (
+	"crypto/rsa"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/internal/hsm/rsakey"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+	"github.com/andrei-cloud/go_hsm/pkg/rsapub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rsaTestKey is a 1024 bit key pair shared by the RSA command tests.
+var rsaTestKey = sync.OnceValues(func() (*rsa.PrivateKey, error) {
+	return rsakey.Generate(rsakey.MinBits)
+})
+
+// rsaTestPrivateKey returns the private key field of rsaTestKey as EW reads it. The test
+// LMK provider decrypts variant keys to themselves, so the key is sealed in the clear.
+func rsaTestPrivateKey(t *testing.T) (*rsa.PrivateKey, string) {
+	t.Helper()
+
+	key, err := rsaTestKey()
+	require.NoError(t, err)
+	sealed, err := rsakey.Seal(key, func(block []byte) ([]byte, error) { return block, nil })
+	require.NoError(t, err)
+
+	return key, fmt.Sprintf("%04d", len(sealed)) + cryptoutils.Raw2Str(sealed)
+}
+
+// splitEJ splits an EJ response into the public key and the private key field.
+func splitEJ(t *testing.T, resp []byte) ([]byte, string) {
+	t.Helper()
+
+	require.Equal(t, "EJ00", string(resp[:4]))
+	pubLen, err := strconv.Atoi(string(resp[4:8]))
+	require.NoError(t, err)
+	pub, err := hex.DecodeString(string(resp[8 : 8+2*pubLen]))
+	require.NoError(t, err)
+
+	return pub, string(resp[8+2*pubLen:])
+}
+
+func TestExecuteEI(t *testing.T) {
+	t.Parallel()
+
+	if err := SetupTestLMKProvider(); err != nil {
+		t.Fatalf("Failed to setup test LMK provider: %v", err)
+	}
+
+	t.Run("private key under variant LMK", func(t *testing.T) {
+		t.Parallel()
+
+		resp, err := ExecuteEI([]byte("0102402"))
+		require.NoError(t, err)
+		der, private := splitEJ(t, resp)
+		pub, err := rsapub.Import(der, rsapub.EncodingDER)
+		require.NoError(t, err)
+		assert.Equal(t, 1024, pub.N.BitLen())
+
+		// The test provider encrypts under the test LMK key in ECB mode.
+		keyLen, err := strconv.Atoi(private[:4])
+		require.NoError(t, err)
+		require.Len(t, private, 4+2*keyLen)
+		lmk, err := cryptoprovider.NewTripleDESCipher(
+			cryptoutils.PrepareTripleDESKey(mustDecodeHex(testLMKKeyHex)))
+		require.NoError(t, err)
+		key, err := rsakey.Open(mustDecodeHex(private[4:]), func(block []byte) ([]byte, error) {
+			out := make([]byte, len(block))
+			lmk.Decrypt(out, block)
+
+			return out, nil
+		})
+		require.NoError(t, err)
+		assert.True(t, key.PublicKey.Equal(pub))
+	})
+
+	t.Run("private key in key block", func(t *testing.T) {
+		t.Parallel()
+
+		resp, err := ExecuteEI([]byte("0102401#00N00%01"))
+		require.NoError(t, err)
+		der, private := splitEJ(t, resp)
+		pub, err := rsapub.Import(der, rsapub.EncodingThales)
+		require.NoError(t, err)
+
+		require.Equal(t, rsaKeyBlockLength, private[:4])
+		block, rest, err := keyblocklmk.SplitKeyBlock([]byte(private[4:]))
+		require.NoError(t, err)
+		assert.Empty(t, rest)
+		header, clear, err := keyblocklmk.UnwrapKeyBlock(keyblocklmk.DefaultTestAESLMK, block)
+		require.NoError(t, err)
+		assert.Equal(t, "03", header.KeyUsage)
+		assert.Equal(t, byte('R'), header.Algorithm)
+		assert.Equal(t, byte('S'), header.ModeOfUse)
+		key, err := rsakey.ParsePrivateKey(clear)
+		require.NoError(t, err)
+		assert.True(t, key.PublicKey.Equal(pub))
+	})
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr error
+	}{
+		{name: "invalid key type indicator", input: "9102402", wantErr: errorcodes.Err15},
+		{name: "modulus too short", input: "0051202", wantErr: errorcodes.Err76},
+		{name: "modulus not whole bytes", input: "0102502", wantErr: errorcodes.Err76},
+		{name: "invalid public key encoding", input: "0102403", wantErr: errorcodes.Err15},
+		{name: "optional blocks", input: "0102402#00N01", wantErr: errorcodes.Err15},
+		{name: "variant LMK for key block", input: "0102402#00N00%00", wantErr: errorcodes.Err13},
+		{name: "short input", input: "01024", wantErr: errorcodes.Err15},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := ExecuteEI([]byte(tt.input))
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package logic
+
+import (
+	"crypto"
+	"fmt"
+	"strconv"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/internal/hsm/rsakey"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+)
+
+// Signature and pad mode identifiers of the RSA signature commands.
+const (
+	rsaSignatureID     = "01" // RSA.
+	rsaPadModePKCS1    = "01" // PKCS#1 v1.5.
+	rsaPrivateKeyInMsg = "99" // private key flag of a private key carried in the request.
+)
+
+// ExecuteEW generates an RSA signature over a message and returns response bytes.
+// Format: Hash identifier (2N: 01 SHA-1, 05 SHA-224, 06 SHA-256, 07 SHA-384, 08 SHA-512) +
+// Signature identifier (2N, 01 RSA) + Pad mode identifier (2N, 01 PKCS#1 v1.5) + Message
+// length (4N) + Message + ';' + Private key flag (2N, 99) + Private key length (4N) +
+// Private key (hex, as returned by EI), or FFFF + key block with key usage 03, algorithm R
+// and mode of use S or N. An LMK identifier may follow the request as '%' and two digits.
+// Response: "EX" + "00" + Signature length (4N, bytes) + Signature (hex).
+func ExecuteEW(input []byte) ([]byte, error) {
+	logInfo("EW: starting RSA signature generation")
+
+	hash, data, err := parseRSASignatureHeader("EW", input)
+	if err != nil {
+		return nil, err
+	}
+	message, data, err := parseRSAMessage("EW", data)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 2 || string(data[:2]) != rsaPrivateKeyInMsg {
+		logError("EW: private key flag must be 99")
+		return nil, errorcodes.Err15
+	}
+	key, data, err := openRSAPrivateKey("EW", data[2:], rsaModesSign)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := parseTrailingFields("EW", data, "%"); err != nil {
+		return nil, err
+	}
+
+	sig, err := rsakey.Sign(key, hash, message)
+	if err != nil {
+		logError(fmt.Sprintf("EW: signature generation failed: %v", err))
+		return nil, errorcodes.Err49
+	}
+	logInfo("EW: signature generated")
+
+	resp := fmt.Appendf(nil, "EX00%04d", len(sig))
+
+	return append(resp, cryptoutils.Raw2B(sig)...), nil
+}
+
+// parseRSASignatureHeader reads the hash, signature and pad mode identifiers at the start of
+// data and returns the hash with the bytes that follow.
+func parseRSASignatureHeader(cmd string, data []byte) (crypto.Hash, []byte, error) {
+	if len(data) < 6 {
+		logError(cmd + ": input too short for hash, signature and pad mode identifiers")
+		return 0, nil, errorcodes.Err15
+	}
+	hash, ok := hmacHashes[string(data[:2])]
+	if !ok {
+		logError(fmt.Sprintf("%s: unsupported hash identifier %s", cmd, data[:2]))
+		return 0, nil, errorcodes.Err79
+	}
+	if string(data[2:4]) != rsaSignatureID {
+		logError(fmt.Sprintf("%s: unsupported signature identifier %s", cmd, data[2:4]))
+		return 0, nil, errorcodes.Err15
+	}
+	if string(data[4:6]) != rsaPadModePKCS1 {
+		logError(fmt.Sprintf("%s: unsupported pad mode identifier %s", cmd, data[4:6]))
+		return 0, nil, errorcodes.Err15
+	}
+
+	return hash, data[6:], nil
+}
+
+// parseRSAMessage reads the 4N message length, the message and the ';' that ends it, and
+// returns the message with the bytes that follow.
+func parseRSAMessage(cmd string, data []byte) ([]byte, []byte, error) {
+	if len(data) < 4 {
+		logError(cmd + ": missing message length")
+		return nil, nil, errorcodes.Err15
+	}
+	msgLen, err := strconv.Atoi(string(data[:4]))
+	if err != nil || msgLen <= 0 {
+		logError(cmd + ": invalid message length")
+		return nil, nil, errorcodes.Err80
+	}
+	data = data[4:]
+	if len(data) < msgLen+1 || data[msgLen] != ';' {
+		logError(cmd + ": message length mismatch or missing delimiter")
+		return nil, nil, errorcodes.Err80
+	}
+
+	return data[:msgLen], data[msgLen+1:], nil
+}
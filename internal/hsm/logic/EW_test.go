@@ -0,0 +1,127 @@
+package logic
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const rsaTestMessage = "Sign me"
+
+func TestExecuteEW(t *testing.T) {
+	t.Parallel()
+
+	if err := SetupTestLMKProvider(); err != nil {
+		t.Fatalf("Failed to setup test LMK provider: %v", err)
+	}
+
+	key, private := rsaTestPrivateKey(t)
+	digest := sha256.Sum256([]byte(rsaTestMessage))
+	// PKCS#1 v1.5 signatures are deterministic.
+	sig, err := rsa.SignPKCS1v15(nil, key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+
+	message := fmt.Sprintf("%04d", len(rsaTestMessage)) + rsaTestMessage + ";"
+	decryptOnly, err := ExecuteEI([]byte("1102402#00N00"))
+	require.NoError(t, err)
+	_, decryptOnlyKey := splitEJ(t, decryptOnly)
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{
+			name:  "SHA-256 variant private key",
+			input: "060101" + message + "99" + private,
+			want:  fmt.Sprintf("EX00%04d", len(sig)) + cryptoutils.Raw2Str(sig),
+		},
+		{
+			name:  "LMK identifier",
+			input: "060101" + message + "99" + private + "%00",
+			want:  fmt.Sprintf("EX00%04d", len(sig)) + cryptoutils.Raw2Str(sig),
+		},
+		{
+			name:    "key management only key block",
+			input:   "060101" + message + "99" + decryptOnlyKey,
+			wantErr: errorcodes.Err29,
+		},
+		{
+			name:    "unsupported hash",
+			input:   "020101" + message + "99" + private,
+			wantErr: errorcodes.Err79,
+		},
+		{
+			name:    "unsupported signature",
+			input:   "060201" + message + "99" + private,
+			wantErr: errorcodes.Err15,
+		},
+		{
+			name:    "unsupported pad mode",
+			input:   "060102" + message + "99" + private,
+			wantErr: errorcodes.Err15,
+		},
+		{
+			name:    "invalid private key flag",
+			input:   "060101" + message + "01" + private,
+			wantErr: errorcodes.Err15,
+		},
+		{
+			name:    "message length mismatch",
+			input:   "0601010008" + rsaTestMessage + ";99" + private,
+			wantErr: errorcodes.Err80,
+		},
+		{
+			name:    "truncated private key",
+			input:   "060101" + message + "99" + private[:len(private)-2],
+			wantErr: errorcodes.Err78,
+		},
+		{
+			name:    "corrupted private key",
+			input:   "060101" + message + "99" + private[:20] + "00" + private[22:],
+			wantErr: errorcodes.Err49,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ExecuteEW([]byte(tt.input))
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestRSASignVerifyKeyBlock(t *testing.T) {
+	t.Parallel()
+
+	if err := SetupTestLMKProvider(); err != nil {
+		t.Fatalf("Failed to setup test LMK provider: %v", err)
+	}
+
+	resp, err := ExecuteEI([]byte("2102402#00N00"))
+	require.NoError(t, err)
+	pub, private := splitEJ(t, resp)
+
+	message := fmt.Sprintf("%04d", len(rsaTestMessage)) + rsaTestMessage + ";"
+	sig, err := ExecuteEW([]byte("080101" + message + "99" + private))
+	require.NoError(t, err)
+	require.Equal(t, "EX000128", string(sig[:8]))
+
+	got, err := ExecuteEY([]byte("080101" + string(sig[4:]) + ";" + message + cryptoutils.Raw2Str(pub)))
+	require.NoError(t, err)
+	assert.Equal(t, "EZ00", string(got))
+}
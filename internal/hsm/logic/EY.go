@@ -0,0 +1,100 @@
+package logic
+
+import (
+	"crypto/rsa"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/internal/hsm/rsakey"
+	"github.com/andrei-cloud/go_hsm/pkg/rsapub"
+)
+
+// ExecuteEY verifies an RSA signature over a message and returns response bytes.
+// Format: Hash identifier (2N: 01 SHA-1, 05 SHA-224, 06 SHA-256, 07 SHA-384, 08 SHA-512) +
+// Signature identifier (2N, 01 RSA) + Pad mode identifier (2N, 01 PKCS#1 v1.5) + Signature
+// length (4N, bytes) + Signature (hex) + ';' + Message length (4N) + Message + ';' + Public
+// key (hex, DER with unsigned or two's complement integers, as returned by EI). An LMK
+// identifier may follow the request as '%' and two digits.
+// Response: "EZ" + "00", or error 01 when the signature does not verify.
+func ExecuteEY(input []byte) ([]byte, error) {
+	logInfo("EY: starting RSA signature verification")
+
+	hash, data, err := parseRSASignatureHeader("EY", input)
+	if err != nil {
+		return nil, err
+	}
+	sig, data, err := parseRSAHexField("EY", "signature", data)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 || data[0] != ';' {
+		logError("EY: missing delimiter after signature")
+		return nil, errorcodes.Err15
+	}
+	message, data, err := parseRSAMessage("EY", data[1:])
+	if err != nil {
+		return nil, err
+	}
+	trailer, err := parseTrailingFields("EY", data, "%")
+	if err != nil {
+		return nil, err
+	}
+	pub, err := parseRSAPublicKey("EY", trailer.Positional)
+	if err != nil {
+		return nil, err
+	}
+	if len(sig) != pub.Size() {
+		logError(fmt.Sprintf("EY: signature length %d does not match %d byte modulus",
+			len(sig), pub.Size()))
+		return nil, errorcodes.Err80
+	}
+
+	if err := rsakey.Verify(pub, hash, message, sig); err != nil {
+		logError(fmt.Sprintf("EY: signature verification failed: %v", err))
+		return nil, errorcodes.Err01
+	}
+	logInfo("EY: signature verified")
+
+	return []byte("EZ" + errorcodes.Err00.CodeOnly()), nil
+}
+
+// parseRSAHexField reads a 4N length in bytes followed by that many bytes in hex at the
+// start of data, and returns the bytes with the data that follows.
+func parseRSAHexField(cmd, name string, data []byte) ([]byte, []byte, error) {
+	if len(data) < 4 {
+		logError(fmt.Sprintf("%s: missing %s length", cmd, name))
+		return nil, nil, errorcodes.Err15
+	}
+	n, err := strconv.Atoi(string(data[:4]))
+	if err != nil || n <= 0 || len(data[4:]) < 2*n {
+		logError(fmt.Sprintf("%s: invalid %s length", cmd, name))
+		return nil, nil, errorcodes.Err80
+	}
+	field, err := hex.DecodeString(string(data[4 : 4+2*n]))
+	if err != nil {
+		logError(fmt.Sprintf("%s: invalid %s hex format", cmd, name))
+		return nil, nil, errorcodes.Err15
+	}
+
+	return field, data[4+2*n:], nil
+}
+
+// parseRSAPublicKey decodes a hex public key in either EI encoding.
+func parseRSAPublicKey(cmd string, data []byte) (*rsa.PublicKey, error) {
+	der, err := hex.DecodeString(string(data))
+	if err != nil || len(der) == 0 {
+		logError(cmd + ": invalid public key hex format")
+		return nil, errorcodes.Err15
+	}
+	pub, err := rsapub.Import(der, rsapub.EncodingDER)
+	if err != nil {
+		if pub, err = rsapub.Import(der, rsapub.EncodingThales); err != nil {
+			logError(fmt.Sprintf("%s: %v", cmd, err))
+			return nil, errorcodes.Err76
+		}
+	}
+
+	return pub, nil
+}
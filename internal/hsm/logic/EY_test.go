@@ -0,0 +1,80 @@
+package logic
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/internal/hsm/rsakey"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/rsapub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteEY(t *testing.T) {
+	t.Parallel()
+
+	if err := SetupTestLMKProvider(); err != nil {
+		t.Fatalf("Failed to setup test LMK provider: %v", err)
+	}
+
+	key, _ := rsaTestPrivateKey(t)
+	sig, err := rsakey.Sign(key, hmacHashes["01"], []byte(rsaTestMessage))
+	require.NoError(t, err)
+	der, err := rsapub.Export(&key.PublicKey, rsapub.EncodingDER)
+	require.NoError(t, err)
+	unsigned, err := rsapub.Export(&key.PublicKey, rsapub.EncodingThales)
+	require.NoError(t, err)
+
+	signature := fmt.Sprintf("%04d", len(sig)) + cryptoutils.Raw2Str(sig) + ";"
+	message := fmt.Sprintf("%04d", len(rsaTestMessage)) + rsaTestMessage + ";"
+	tampered := fmt.Sprintf("%04d", len(rsaTestMessage)) + "sign me;"
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr error
+	}{
+		{name: "DER public key", input: "010101" + signature + message + cryptoutils.Raw2Str(der)},
+		{
+			name:  "unsigned public key and LMK identifier",
+			input: "010101" + signature + message + cryptoutils.Raw2Str(unsigned) + "%00",
+		},
+		{
+			name:    "tampered message",
+			input:   "010101" + signature + tampered + cryptoutils.Raw2Str(der),
+			wantErr: errorcodes.Err01,
+		},
+		{
+			name:    "wrong hash",
+			input:   "060101" + signature + message + cryptoutils.Raw2Str(der),
+			wantErr: errorcodes.Err01,
+		},
+		{
+			name:    "signature length mismatch",
+			input:   "010101" + "0002ABCD;" + message + cryptoutils.Raw2Str(der),
+			wantErr: errorcodes.Err80,
+		},
+		{
+			name:    "missing delimiter after signature",
+			input:   "010101" + signature[:len(signature)-1] + message + cryptoutils.Raw2Str(der),
+			wantErr: errorcodes.Err15,
+		},
+		{name: "invalid public key", input: "010101" + signature + message + "3000", wantErr: errorcodes.Err76},
+		{name: "missing public key", input: "010101" + signature + message, wantErr: errorcodes.Err15},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ExecuteEY([]byte(tt.input))
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "EZ00", string(got))
+		})
+	}
+}
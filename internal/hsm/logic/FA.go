@@ -1,92 +1,71 @@
 package logic
 
 import (
-	"crypto/des"
-	"encoding/hex"
 	"fmt"
 
 	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
 	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/keyschemes"
 )
 
 // ExecuteFA translates a ZPK from ZMK to LMK (Variant LMK, not keyblock).
 func ExecuteFA(input []byte) ([]byte, error) {
-	logInfo("FA: starting ZPK translation from ZMK to LMK")
-	data := input
+	return translateZPKFromZMK("FA", "FB", input)
+}
 
-	// Parse ZMK (encrypted under LMK)
-	var zmkScheme byte = 'U'
-	var zmkHex string
-	var zmkLen int
+// translateZPKFromZMK imports a ZPK encrypted under a ZMK and returns it under the LMK with
+// its KCV, answering with respCode. cmd prefixes log messages.
+func translateZPKFromZMK(cmd, respCode string, input []byte) ([]byte, error) {
+	logInfo(cmd + ": starting ZPK translation from ZMK to LMK")
+	data := input
 
+	// Parse ZMK (encrypted under LMK); a key without scheme is double-length.
 	if len(data) < 1 {
-		logError("FA: missing ZMK data")
+		logError(cmd + ": missing ZMK data")
 		return nil, errorcodes.Err15
 	}
 
-	logInfo("FA: processing ZMK input")
-	if data[0] == 'U' || data[0] == 'T' {
-		zmkScheme = data[0]
-		zmkLen = getKeyLength(zmkScheme)
-		if len(data) < 1+zmkLen*2 {
-			logError("FA: insufficient data for ZMK with scheme")
-			return nil, errorcodes.Err15
-		}
-		zmkHex = string(data[1 : 1+zmkLen*2])
-		data = data[1+zmkLen*2:]
-	} else {
-		// assume double-length key hex without scheme
-		zmkLen = 16 // bytes
-		if len(data) < zmkLen*2 {
-			logError("FA: insufficient data for ZMK without scheme")
-			return nil, errorcodes.Err15
-		}
-		zmkHex = string(data[:zmkLen*2])
-		data = data[zmkLen*2:]
+	logInfo(cmd + ": processing ZMK input")
+	zmk, data, err := keyschemes.Parse(data, "UT", 32)
+	if err != nil {
+		logError(fmt.Sprintf("%s: invalid ZMK: %v", cmd, err))
+		return nil, errorcodes.Err15
+	}
+	zmkScheme := zmk.Scheme
+	if zmkScheme == 0 {
+		zmkScheme = 'U'
 	}
 
-	logInfo("FA: decoding ZMK")
-	zmkBytes, err := hex.DecodeString(zmkHex)
+	logInfo(cmd + ": decoding ZMK")
+	zmkBytes, err := zmk.Bytes()
 	if err != nil {
-		logError("FA: invalid ZMK hex format")
+		logError(cmd + ": invalid ZMK hex format")
 		return nil, errorcodes.Err15
 	}
-	logDebug(fmt.Sprintf("FA: encrypted ZMK value: %x", zmkBytes))
-
-	// Parse ZPK (encrypted under ZMK)
-	var zpkScheme byte = 'U'
-	var zpkHex string
-	var zpkLen int
+	logDebug(fmt.Sprintf("%s: encrypted ZMK value: %x", cmd, zmkBytes))
 
+	// Parse ZPK (encrypted under ZMK); a key without scheme is double-length.
 	if len(data) < 1 {
-		logError("FA: missing ZPK data")
+		logError(cmd + ": missing ZPK data")
 		return nil, errorcodes.Err15
 	}
 
-	logInfo("FA: processing ZPK input")
-	if data[0] == 'U' || data[0] == 'T' {
-		zpkScheme = data[0]
-		zpkLen = getKeyLength(zpkScheme)
-		if len(data) < 1+zpkLen*2 {
-			logError("FA: insufficient data for ZPK with scheme")
-			return nil, errorcodes.Err15
-		}
-		zpkHex = string(data[1 : 1+zpkLen*2])
-		_ = data[1+zpkLen*2:]
-	} else {
-		// assume double-length ZPK without scheme
-		zpkLen = 16
-		if len(data) < zpkLen*2 {
-			logError("FA: insufficient data for ZPK without scheme")
-			return nil, errorcodes.Err15
-		}
-		zpkHex = string(data[:zpkLen*2])
+	logInfo(cmd + ": processing ZPK input")
+	zpk, _, err := keyschemes.Parse(data, "UT", 32)
+	if err != nil {
+		logError(fmt.Sprintf("%s: invalid ZPK: %v", cmd, err))
+		return nil, errorcodes.Err15
+	}
+	zpkScheme := zpk.Scheme
+	if zpkScheme == 0 {
+		zpkScheme = 'U'
 	}
 
-	logInfo("FA: decoding ZPK")
-	zpkBytes, err := hex.DecodeString(zpkHex)
+	logInfo(cmd + ": decoding ZPK")
+	zpkBytes, err := zpk.Bytes()
 	if err != nil {
-		logError("FA: invalid ZPK hex format")
+		logError(cmd + ": invalid ZPK hex format")
 		return nil, errorcodes.Err15
 	}
 	// Check for all-zero ZPK input (before decryption)
@@ -98,16 +77,16 @@ func ExecuteFA(input []byte) ([]byte, error) {
 		}
 	}
 	if allZeroZpkInput {
-		logError("FA: all zero ZPK input detected")
+		logError(cmd + ": all zero ZPK input detected")
 		return nil, errorcodes.Err11
 	}
-	logDebug(fmt.Sprintf("FA: encrypted ZPK value: %x", zpkBytes))
+	logDebug(fmt.Sprintf("%s: encrypted ZPK value: %x", cmd, zpkBytes))
 
 	// Decrypt ZMK under LMK (pair 04-05, key type 000)
-	logInfo("FA: decrypting ZMK under LMK")
+	logInfo(cmd + ": decrypting ZMK under LMK")
 	clearZmk, err := LMKProviderInstance.DecryptUnderLMK(zmkBytes, "000", zmkScheme)
 	if err != nil {
-		logError("FA: ZMK decryption failed")
+		logError(cmd + ": ZMK decryption failed")
 		return nil, errorcodes.Err68
 	}
 
@@ -120,21 +99,21 @@ func ExecuteFA(input []byte) ([]byte, error) {
 		}
 	}
 	if allZeroZmk {
-		logError("FA: all zero ZMK detected")
+		logError(cmd + ": all zero ZMK detected")
 		return nil, errorcodes.Err11
 	}
 
-	logInfo("FA: verifying ZMK parity")
+	logInfo(cmd + ": verifying ZMK parity")
 	if !cryptoutils.CheckKeyParity(clearZmk) {
-		logError("FA: ZMK parity check failed")
+		logError(cmd + ": ZMK parity check failed")
 		return nil, errorcodes.Err10
 	}
 
 	// Decrypt ZPK under ZMK using triple DES
-	logInfo("FA: decrypting ZPK under ZMK")
-	block, err := des.NewTripleDESCipher(cryptoutils.PrepareTripleDESKey(clearZmk))
+	logInfo(cmd + ": decrypting ZPK under ZMK")
+	block, err := cryptoprovider.NewTripleDESCipher(cryptoutils.PrepareTripleDESKey(clearZmk))
 	if err != nil {
-		logError("FA: failed to create DES cipher for ZPK")
+		logError(cmd + ": failed to create DES cipher for ZPK")
 		return nil, errorcodes.Err15
 	}
 
@@ -142,7 +121,7 @@ func ExecuteFA(input []byte) ([]byte, error) {
 	for i := 0; i < len(zpkBytes); i += 8 {
 		block.Decrypt(clearZpk[i:i+8], zpkBytes[i:i+8])
 	}
-	logDebug(fmt.Sprintf("FA: decrypted ZPK value: %x", clearZpk))
+	logDebug(fmt.Sprintf("%s: decrypted ZPK value: %x", cmd, clearZpk))
 
 	// Check for all-zero ZPK
 	allZero := true
@@ -153,41 +132,38 @@ func ExecuteFA(input []byte) ([]byte, error) {
 		}
 	}
 	if allZero {
-		logError("FA: all zero ZPK detected")
+		logError(cmd + ": all zero ZPK detected")
 		return nil, errorcodes.Err11
 	}
 
 	// Check ZPK parity (advice only)
-	logInfo("FA: checking ZPK parity")
+	logInfo(cmd + ": checking ZPK parity")
 	if !cryptoutils.CheckKeyParity(clearZpk) {
-		logError("FA: ZPK parity check failed")
+		logError(cmd + ": ZPK parity check failed")
 		return nil, errorcodes.Err10
 	}
 
 	// Encrypt ZPK under LMK (pair 06-07, key type 001)
-	logInfo("FA: encrypting ZPK under LMK")
+	logInfo(cmd + ": encrypting ZPK under LMK")
 	lmkScheme := zpkScheme // Use same scheme as input unless overridden
 	lmkEncryptedZpk, err := LMKProviderInstance.EncryptUnderLMK(clearZpk, "001", lmkScheme)
 	if err != nil {
-		logError("FA: ZPK encryption under LMK failed")
+		logError(cmd + ": ZPK encryption under LMK failed")
 		return nil, errorcodes.Err68
 	}
 
 	// Calculate KCV (6 hex digits, as per spec default)
-	logInfo("FA: calculating key check value")
+	logInfo(cmd + ": calculating key check value")
 	kcv, err := cryptoutils.KeyCV(cryptoutils.Raw2B(clearZpk), 6)
 	if err != nil {
-		logError("FA: KCV calculation failed")
+		logError(cmd + ": KCV calculation failed")
 		return nil, errorcodes.Err20
 	}
 
-	logInfo("FA: formatting response")
-	resp := []byte("FB")
-	resp = append(resp, []byte("00")...)
-	resp = appendEncryptedKeyToResponse(resp, lmkScheme, lmkEncryptedZpk)
-	resp = append(resp, kcv...)
+	logInfo(cmd + ": formatting response")
+	resp := buildKeyResponse(respCode, kcv, taggedCryptogram(lmkScheme, lmkEncryptedZpk))
 
-	logDebug(fmt.Sprintf("FA: response value: %x", resp))
+	logDebug(fmt.Sprintf("%s: response value: %x", cmd, resp))
 
 	return resp, nil
 }
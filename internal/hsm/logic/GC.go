@@ -0,0 +1,70 @@
+package logic
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/crypto"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/keyschemes"
+)
+
+// ExecuteGC generates a random ZMK as clear components for a key ceremony and returns the
+// ZMK under the LMK with the components.
+// Format: Number of components (1N, 2-9) + Key scheme LMK (1A: U or T). An LMK identifier
+// may follow the request as '%' and two digits.
+// Response: "GD" + "00" + ZMK under LMK + KCV (6H) + for each component, the clear component
+// (32H or 48H) and its KCV (6H). Each component has odd parity, and forming the ZMK from
+// them with GY yields the returned ZMK.
+func ExecuteGC(input []byte) ([]byte, error) {
+	logInfo("GC: starting ZMK component generation")
+
+	count, scheme, data, err := parseZMKComponentHeader("GC", input)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := parseTrailingFields("GC", data, "%"); err != nil {
+		return nil, err
+	}
+
+	key, err := generateKey("GC", keyschemes.Length(scheme))
+	if err != nil {
+		return nil, err
+	}
+	components, _, err := crypto.SplitKey(cryptoutils.Raw2Str(key.clear), count)
+	if err != nil {
+		logError(fmt.Sprintf("GC: failed to split ZMK: %v", err))
+		return nil, errorcodes.Err15
+	}
+
+	// Components are set to odd parity, and the ZMK is the one they form.
+	fields := make([][]byte, 0, 2*count)
+	for i, component := range components {
+		raw, err := hex.DecodeString(component)
+		if err != nil {
+			return nil, errors.Join(errors.New("decode component"), err)
+		}
+		raw = cryptoutils.FixKeyParity(raw)
+		components[i] = cryptoutils.Raw2Str(raw)
+		kcv, err := cryptoutils.KeyCV(cryptoutils.Raw2B(raw), 6)
+		if err != nil {
+			logError("GC: component KCV calculation failed")
+			return nil, errorcodes.Err15
+		}
+		fields = append(fields, []byte(components[i]), kcv)
+	}
+	zmk, err := combineZMKComponents("GC", components)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := encryptFormedZMK("GC", "GD", zmk, scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.Concat(append([][]byte{resp}, fields...)...), nil
+}
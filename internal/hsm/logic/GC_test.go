@@ -0,0 +1,56 @@
+package logic
+
+import (
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteGC(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		input  string
+		count  int
+		keyLen int
+	}{
+		{input: "2U", count: 2, keyLen: 32},
+		{input: "3T%00", count: 3, keyLen: 48},
+		{input: "9U", count: 9, keyLen: 32},
+	} {
+		t.Run(tc.input, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ExecuteGC([]byte(tc.input))
+			require.NoError(t, err)
+			resp := string(got)
+			head := 4 + 1 + tc.keyLen + 6
+			require.Len(t, resp, head+tc.count*(tc.keyLen+6))
+			assert.Equal(t, "GD00"+tc.input[1:2], resp[:5])
+			kcv := resp[head-6 : head]
+
+			// Forming the ZMK from the returned components yields the same key.
+			form := tc.input[:2]
+			for i := range tc.count {
+				field := resp[head+i*(tc.keyLen+6):]
+				component := field[:tc.keyLen]
+				componentKCV, err := cryptoutils.KeyCV([]byte(component), 6)
+				require.NoError(t, err)
+				assert.Equal(t, string(componentKCV), field[tc.keyLen:tc.keyLen+6])
+				form += component
+			}
+			formed, err := ExecuteGY([]byte(form))
+			require.NoError(t, err)
+			assert.Equal(t, resp[:head], "GD"+string(formed[2:]))
+			assert.Equal(t, kcv, string(formed[len(formed)-6:]))
+		})
+	}
+
+	_, err := ExecuteGC([]byte("1U"))
+	assert.ErrorIs(t, err, errorcodes.Err15)
+	_, err = ExecuteGC([]byte("2U%9"))
+	assert.ErrorIs(t, err, errorcodes.Err13)
+}
@@ -0,0 +1,89 @@
+package logic
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/internal/hsm/rsakey"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/keyschemes"
+)
+
+// ExecuteGI imports a key encrypted under the public key of an HSM RSA key pair and returns
+// it under the LMK.
+// Format: Encryption identifier (2N, 01 RSA) + Pad mode identifier (2N: 01 PKCS#1 v1.5,
+// 02 OAEP) and, for OAEP, the MGF, MGF hash and encoding parameters as in GK. Then Key type
+// (3H) + Encrypted key length (4N, bytes) + Encrypted key (hex) + ';' + Private key flag
+// (2N, 99) + Private key length (4N) + Private key (hex, as returned by EI), or FFFF + key
+// block with key usage 03, algorithm R and mode of use D or N + Key scheme LMK (1A). An LMK
+// identifier may follow the request as '%' and two digits.
+// Response: "GJ" + "00" + Key under LMK + KCV (6H).
+func ExecuteGI(input []byte) ([]byte, error) {
+	logInfo("GI: starting key import under RSA private key")
+
+	transport, data, err := parseRSATransport("GI", input)
+	if err != nil {
+		return nil, err
+	}
+	keyType, data, err := parseExchangeKeyType("GI", data)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, data, err := parseRSAHexField("GI", "encrypted key", data)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 3 || data[0] != ';' || string(data[1:3]) != rsaPrivateKeyInMsg {
+		logError("GI: missing delimiter or private key flag 99")
+		return nil, errorcodes.Err15
+	}
+	priv, data, err := openRSAPrivateKey("GI", data[3:], rsaModesDecrypt)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < 1 {
+		logError("GI: missing LMK key scheme")
+		return nil, errorcodes.Err15
+	}
+	lmkScheme := data[0]
+	if keyschemes.Length(lmkScheme) == 0 {
+		logError(fmt.Sprintf("GI: invalid LMK key scheme %c", lmkScheme))
+		return nil, errorcodes.Err26
+	}
+	if _, err := parseTrailingFields("GI", data[1:], "%"); err != nil {
+		return nil, err
+	}
+
+	logInfo("GI: decrypting key under RSA private key")
+	clearKey, err := rsakey.DecryptKey(priv, transport, encrypted)
+	if err != nil {
+		logError(fmt.Sprintf("GI: key decryption under RSA private key failed: %v", err))
+		return nil, errorcodes.Err77
+	}
+	if err := checkExchangeKey("GI", clearKey); err != nil {
+		return nil, err
+	}
+	if len(clearKey) != keyschemes.Length(lmkScheme) {
+		logError(fmt.Sprintf("GI: %d byte key cannot use LMK key scheme %c",
+			len(clearKey), lmkScheme))
+		return nil, errorcodes.Err27
+	}
+
+	logInfo("GI: encrypting key under LMK")
+	lmkEncryptedKey, err := LMKProviderInstance.EncryptUnderLMK(clearKey, keyType, lmkScheme)
+	if err != nil {
+		logError("GI: key encryption under LMK failed")
+		return nil, errors.Join(errors.New("encrypt under lmk"), err)
+	}
+
+	kcv, err := cryptoutils.KeyCV(cryptoutils.Raw2B(clearKey), 6)
+	if err != nil {
+		logError("GI: KCV calculation failed")
+		return nil, errors.Join(errors.New("calculate kcv"), err)
+	}
+	logInfo("GI: key imported")
+
+	return buildKeyResponse("GJ", kcv, taggedCryptogram(lmkScheme, lmkEncryptedKey)), nil
+}
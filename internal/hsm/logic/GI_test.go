@@ -0,0 +1,122 @@
+package logic
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/internal/hsm/rsakey"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteGI(t *testing.T) {
+	t.Parallel()
+
+	if err := SetupTestLMKProvider(); err != nil {
+		t.Fatalf("Failed to setup test LMK provider: %v", err)
+	}
+
+	key, private := rsaTestPrivateKey(t)
+	clearKey := mustDecodeHex(exchangeTestKey)
+	encrypt := func(transport rsakey.Transport) string {
+		encrypted, err := rsakey.EncryptKey(&key.PublicKey, transport, clearKey)
+		require.NoError(t, err)
+
+		return fmt.Sprintf("%04d", len(encrypted)) + cryptoutils.Raw2Str(encrypted) + ";99"
+	}
+	pkcs1 := encrypt(rsakey.Transport{})
+	oaep := encrypt(rsaTestOAEP)
+
+	underLMK, err := testEncryptWithLMK(clearKey, mustDecodeHex(testLMKKeyHex))
+	require.NoError(t, err)
+	kcv, err := cryptoutils.KeyCV([]byte(exchangeTestKey), 6)
+	require.NoError(t, err)
+	want := "GJ00U" + cryptoutils.Raw2Str(underLMK) + string(kcv)
+
+	signOnly, err := ExecuteEI([]byte("0102402#00N00"))
+	require.NoError(t, err)
+	_, signOnlyKey := splitEJ(t, signOnly)
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{name: "PKCS#1 v1.5", input: "0101" + "001" + pkcs1 + private + "U", want: want},
+		{name: "OAEP with label", input: rsaTestOAEPParams + "001" + oaep + private + "U%00", want: want},
+		{
+			name:    "OAEP label mismatch",
+			input:   "0102010604TR35;" + "001" + oaep + private + "U",
+			wantErr: errorcodes.Err77,
+		},
+		{
+			name:    "PKCS#1 v1.5 block decrypted as OAEP",
+			input:   rsaTestOAEPParams + "001" + pkcs1 + private + "U",
+			wantErr: errorcodes.Err77,
+		},
+		{
+			name:    "signature only key block",
+			input:   "0101" + "001" + pkcs1 + signOnlyKey + "U",
+			wantErr: errorcodes.Err29,
+		},
+		{
+			name:    "LMK scheme length mismatch",
+			input:   "0101" + "001" + pkcs1 + private + "T",
+			wantErr: errorcodes.Err27,
+		},
+		{
+			name:    "invalid LMK scheme",
+			input:   "0101" + "001" + pkcs1 + private + "Q",
+			wantErr: errorcodes.Err26,
+		},
+		{
+			name:    "missing LMK scheme",
+			input:   "0101" + "001" + pkcs1 + private,
+			wantErr: errorcodes.Err15,
+		},
+		{
+			name:    "missing private key flag",
+			input:   "0101" + "001" + pkcs1[:len(pkcs1)-2] + private + "U",
+			wantErr: errorcodes.Err15,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ExecuteGI([]byte(tt.input))
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestRSAKeyTransportRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	if err := SetupTestLMKProvider(); err != nil {
+		t.Fatalf("Failed to setup test LMK provider: %v", err)
+	}
+
+	resp, err := ExecuteEI([]byte("1102402#00N00"))
+	require.NoError(t, err)
+	pub, private := splitEJ(t, resp)
+
+	exported, err := ExecuteGK(
+		[]byte(rsaTestOAEPParams + "002U" + exchangeTestKey + cryptoutils.Raw2Str(pub)))
+	require.NoError(t, err)
+	// Drop the response code and KCV.
+	encrypted := string(exported[4 : len(exported)-6])
+
+	got, err := ExecuteGI([]byte(rsaTestOAEPParams + "002" + encrypted + ";99" + private + "U"))
+	require.NoError(t, err)
+	assert.Equal(t, "GJ00U", string(got[:5]))
+	assert.Equal(t, string(exported[len(exported)-6:]), string(got[len(got)-6:]))
+}
@@ -0,0 +1,145 @@
+package logic
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/internal/hsm/rsakey"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/keyschemes"
+)
+
+// Identifiers of RSA key transport.
+const (
+	rsaEncryptionID = "01" // RSA.
+	rsaPadModeOAEP  = "02" // RSAES-OAEP.
+	rsaMGF1         = "01" // MGF1 mask generation function.
+)
+
+// ExecuteGK exports a key encrypted under the LMK for remote key loading under a terminal's
+// RSA public key and returns response bytes.
+// Format: Encryption identifier (2N, 01 RSA) + Pad mode identifier (2N: 01 PKCS#1 v1.5,
+// 02 OAEP), followed for OAEP by MGF (2N, 01 MGF1) + MGF hash (2N: 01 SHA-1, 05 SHA-224,
+// 06 SHA-256, 07 SHA-384, 08 SHA-512) + OAEP encoding parameters length (2N) + OAEP encoding
+// parameters + ';'. Then Key type (3H) + Key under LMK (32H or Z/U/T/X/Y+16H/32H/48H) +
+// Public key (hex, DER with unsigned or two's complement integers). An LMK identifier may
+// follow the request as '%' and two digits.
+// Response: "GL" + "00" + Encrypted key length (4N, bytes) + Encrypted key (hex) + KCV (6H).
+func ExecuteGK(input []byte) ([]byte, error) {
+	logInfo("GK: starting key export under RSA public key")
+
+	transport, data, err := parseRSATransport("GK", input)
+	if err != nil {
+		return nil, err
+	}
+	keyType, data, err := parseExchangeKeyType("GK", data)
+	if err != nil {
+		return nil, err
+	}
+	key, data, err := keyschemes.Parse(data, exchangeSchemes, 32)
+	if err != nil {
+		logError(fmt.Sprintf("GK: invalid key under LMK: %v", err))
+		return nil, errorcodes.Err15
+	}
+	keyBytes, err := key.Bytes()
+	if err != nil {
+		logError("GK: invalid key hex format")
+		return nil, errorcodes.Err15
+	}
+	keyScheme := key.Scheme
+	if keyScheme == 0 {
+		keyScheme = keyschemes.SchemeU
+	}
+	trailer, err := parseTrailingFields("GK", data, "%")
+	if err != nil {
+		return nil, err
+	}
+	pub, err := parseRSAPublicKey("GK", trailer.Positional)
+	if err != nil {
+		return nil, err
+	}
+
+	logInfo("GK: decrypting key under LMK")
+	clearKey, err := LMKProviderInstance.DecryptUnderLMK(keyBytes, keyType, keyScheme)
+	if err != nil {
+		logError("GK: key decryption under LMK failed")
+		return nil, errorcodes.Err68
+	}
+	if err := checkExchangeKey("GK", clearKey); err != nil {
+		return nil, err
+	}
+
+	logInfo("GK: encrypting key under RSA public key")
+	encrypted, err := rsakey.EncryptKey(pub, transport, clearKey)
+	if err != nil {
+		logError(fmt.Sprintf("GK: key encryption under RSA public key failed: %v", err))
+		return nil, errorcodes.Err76
+	}
+
+	kcv, err := cryptoutils.KeyCV(cryptoutils.Raw2B(clearKey), 6)
+	if err != nil {
+		logError("GK: KCV calculation failed")
+		return nil, errors.Join(errors.New("calculate kcv"), err)
+	}
+	logInfo("GK: key exported")
+
+	resp := fmt.Appendf(nil, "GL00%04d", len(encrypted))
+	resp = append(resp, cryptoutils.Raw2B(encrypted)...)
+
+	return append(resp, kcv...), nil
+}
+
+// parseRSATransport reads the encryption and pad mode identifiers and, for OAEP, the MGF,
+// MGF hash and encoding parameters at the start of data. It returns the key transport with
+// the bytes that follow.
+func parseRSATransport(cmd string, data []byte) (rsakey.Transport, []byte, error) {
+	if len(data) < 4 {
+		logError(cmd + ": input too short for encryption and pad mode identifiers")
+		return rsakey.Transport{}, nil, errorcodes.Err15
+	}
+	if string(data[:2]) != rsaEncryptionID {
+		logError(fmt.Sprintf("%s: unsupported encryption identifier %s", cmd, data[:2]))
+		return rsakey.Transport{}, nil, errorcodes.Err15
+	}
+	switch string(data[2:4]) {
+	case rsaPadModePKCS1:
+		return rsakey.Transport{}, data[4:], nil
+	case rsaPadModeOAEP:
+	default:
+		logError(fmt.Sprintf("%s: unsupported pad mode identifier %s", cmd, data[2:4]))
+		return rsakey.Transport{}, nil, errorcodes.Err15
+	}
+
+	data = data[4:]
+	if len(data) < 2+2+2 {
+		logError(cmd + ": missing OAEP parameters")
+		return rsakey.Transport{}, nil, errorcodes.Err15
+	}
+	if string(data[:2]) != rsaMGF1 {
+		logError(fmt.Sprintf("%s: unsupported mask generation function %s", cmd, data[:2]))
+		return rsakey.Transport{}, nil, errorcodes.Err85
+	}
+	hash, ok := hmacHashes[string(data[2:4])]
+	if !ok {
+		logError(fmt.Sprintf("%s: unsupported MGF hash %s", cmd, data[2:4]))
+		return rsakey.Transport{}, nil, errorcodes.Err86
+	}
+	labelLen, err := strconv.Atoi(string(data[4:6]))
+	if err != nil {
+		logError(cmd + ": invalid OAEP encoding parameters length")
+		return rsakey.Transport{}, nil, errorcodes.Err87
+	}
+	data = data[6:]
+	if len(data) < labelLen+1 || data[labelLen] != ';' {
+		logError(cmd + ": OAEP encoding parameters length mismatch or missing delimiter")
+		return rsakey.Transport{}, nil, errorcodes.Err87
+	}
+	t := rsakey.Transport{OAEP: true, Hash: hash}
+	if labelLen > 0 {
+		t.Label = data[:labelLen]
+	}
+
+	return t, data[labelLen+1:], nil
+}
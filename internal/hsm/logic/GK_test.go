@@ -0,0 +1,125 @@
+package logic
+
+import (
+	"crypto"
+	"strconv"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/internal/hsm/rsakey"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/rsapub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rsaTestOAEP is the OAEP transport of the RSA key transport tests: SHA-256 with the label
+// "TR34", as the GK and GI OAEP parameters rsaTestOAEPParams select.
+var rsaTestOAEP = rsakey.Transport{OAEP: true, Hash: crypto.SHA256, Label: []byte("TR34")}
+
+const rsaTestOAEPParams = "0102" + "01" + "06" + "04TR34;"
+
+// rsaTestPublicKey returns the public key of rsaTestKey in hex DER.
+func rsaTestPublicKey(t *testing.T) string {
+	t.Helper()
+
+	key, _ := rsaTestPrivateKey(t)
+	der, err := rsapub.Export(&key.PublicKey, rsapub.EncodingDER)
+	require.NoError(t, err)
+
+	return cryptoutils.Raw2Str(der)
+}
+
+func TestExecuteGK(t *testing.T) {
+	t.Parallel()
+
+	if err := SetupTestLMKProvider(); err != nil {
+		t.Fatalf("Failed to setup test LMK provider: %v", err)
+	}
+
+	key, _ := rsaTestPrivateKey(t)
+	pub := rsaTestPublicKey(t)
+	kcv, err := cryptoutils.KeyCV([]byte(exchangeTestKey), 6)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		input     string
+		transport rsakey.Transport
+		wantErr   error
+	}{
+		{name: "PKCS#1 v1.5", input: "0101" + "001U" + exchangeTestKey + pub},
+		{
+			name:      "OAEP with label and LMK identifier",
+			input:     rsaTestOAEPParams + "000" + exchangeTestKey + pub + "%00",
+			transport: rsaTestOAEP,
+		},
+		{
+			name:      "OAEP without label",
+			input:     "0102010100;" + "001U" + exchangeTestKey + pub,
+			transport: rsakey.Transport{OAEP: true, Hash: crypto.SHA1},
+		},
+		{
+			name:    "unsupported encryption",
+			input:   "0201001U" + exchangeTestKey + pub,
+			wantErr: errorcodes.Err15,
+		},
+		{
+			name:    "unsupported pad mode",
+			input:   "0103001U" + exchangeTestKey + pub,
+			wantErr: errorcodes.Err15,
+		},
+		{
+			name:    "unsupported MGF",
+			input:   "0102020604TR34;001U" + exchangeTestKey + pub,
+			wantErr: errorcodes.Err85,
+		},
+		{
+			name:    "unsupported MGF hash",
+			input:   "0102010204TR34;001U" + exchangeTestKey + pub,
+			wantErr: errorcodes.Err86,
+		},
+		{
+			name:    "OAEP parameters mismatch",
+			input:   "0102010605TR34;001U" + exchangeTestKey + pub,
+			wantErr: errorcodes.Err87,
+		},
+		{
+			name:    "unsupported key type",
+			input:   "0101FFFU" + exchangeTestKey + pub,
+			wantErr: errorcodes.Err04,
+		},
+		{
+			name:    "key parity error",
+			input:   "0101001U" + exchangeTestKey[:31] + "E" + pub,
+			wantErr: errorcodes.Err11,
+		},
+		{
+			name:    "invalid public key",
+			input:   "0101001U" + exchangeTestKey + "3000",
+			wantErr: errorcodes.Err76,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ExecuteGK([]byte(tt.input))
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "GL00", string(got[:4]))
+			n, err := strconv.Atoi(string(got[4:8]))
+			require.NoError(t, err)
+			assert.Equal(t, key.Size(), n)
+			require.Len(t, got, 8+2*n+6)
+			assert.Equal(t, string(kcv), string(got[8+2*n:]))
+
+			clear, err := rsakey.DecryptKey(key, tt.transport, mustDecodeHex(string(got[8:8+2*n])))
+			require.NoError(t, err)
+			assert.Equal(t, exchangeTestKey, cryptoutils.Raw2Str(clear))
+		})
+	}
+}
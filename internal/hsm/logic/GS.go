@@ -0,0 +1,207 @@
+package logic
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/dukpt"
+	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+	"github.com/andrei-cloud/go_hsm/pkg/keyschemes"
+	"github.com/andrei-cloud/go_hsm/pkg/msgspec"
+)
+
+// DUKPT key types under a variant LMK.
+const (
+	bdkKeyType  = "009" // BDK type-1.
+	ipekKeyType = "302" // IKEY/IPEK.
+)
+
+// ExecuteGS derives a DUKPT initial key (IPEK) from a BDK and a KSN and returns it under the
+// LMK with its check value.
+// Format: BDK (32H or U/T+32H/48H under a variant LMK, or S/R key block with key usage B0) +
+// KSN (20H, or 24H for an AES BDK). An LMK identifier may follow the request as '%' and two
+// digits. A variant BDK of key type 009 gives a TDES IPEK of key type 302 with scheme U. A
+// key block BDK gives an S key block with key usage B1 under the same LMK: a TDES IPEK
+// (ANSI X9.24-1) for a TDES BDK, or an AES DUKPT initial key (ANSI X9.24-3) of the BDK
+// length for an AES BDK, with the leftmost 16 digits of the KSN as initial key ID.
+// Response: "GT" + "00" + IPEK under LMK + KCV (6H).
+func ExecuteGS(input []byte) ([]byte, error) {
+	logInfo("GS: starting DUKPT initial key derivation")
+
+	if len(input) > 0 && keyschemes.IsKeyBlock(input[0]) {
+		return deriveIPEKKeyBlock(input)
+	}
+
+	bdk, data, err := keyschemes.Parse(input, "UT", 32)
+	if err != nil {
+		logError(fmt.Sprintf("GS: invalid BDK: %v", err))
+		return nil, errorcodes.Err15
+	}
+	bdkBytes, err := bdk.Bytes()
+	if err != nil {
+		logError("GS: invalid BDK hex format")
+		return nil, errorcodes.Err15
+	}
+	bdkScheme := bdk.Scheme
+	if bdkScheme == 0 {
+		bdkScheme = keyschemes.SchemeU
+	}
+	ksn, data, err := parseKSN("GS", data, dukpt.KSNLength)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := parseTrailingFields("GS", data, "%"); err != nil {
+		return nil, err
+	}
+
+	logInfo("GS: decrypting BDK under LMK")
+	clearBDK, err := LMKProviderInstance.DecryptUnderLMK(bdkBytes, bdkKeyType, bdkScheme)
+	if err != nil {
+		logError("GS: BDK decryption failed")
+		return nil, errorcodes.Err68
+	}
+	if !cryptoutils.CheckKeyParity(clearBDK) {
+		logError("GS: BDK parity check failed")
+		return nil, errorcodes.Err10
+	}
+	if len(clearBDK) != 16 {
+		logError(fmt.Sprintf("GS: TDES DUKPT requires a double-length BDK, got %d bytes",
+			len(clearBDK)))
+		return nil, errorcodes.Err27
+	}
+
+	ipek, err := dukpt.DeriveIPEK(clearBDK, ksn)
+	if err != nil {
+		logError(fmt.Sprintf("GS: IPEK derivation failed: %v", err))
+		return nil, errorcodes.Err15
+	}
+
+	logInfo("GS: encrypting IPEK under LMK")
+	encrypted, err := LMKProviderInstance.EncryptUnderLMK(ipek, ipekKeyType, keyschemes.SchemeU)
+	if err != nil {
+		logError("GS: IPEK encryption under LMK failed")
+		return nil, errors.Join(errors.New("encrypt under lmk"), err)
+	}
+	kcv, err := cryptoutils.KeyCV(cryptoutils.Raw2B(ipek), 6)
+	if err != nil {
+		logError("GS: KCV calculation failed")
+		return nil, errors.Join(errors.New("calculate kcv"), err)
+	}
+
+	return buildKeyResponse("GT", kcv, taggedCryptogram(keyschemes.SchemeU, encrypted)), nil
+}
+
+// deriveIPEKKeyBlock handles GS for a BDK held in a key block under a key block LMK.
+func deriveIPEKKeyBlock(input []byte) ([]byte, error) {
+	block, data, err := keyblocklmk.SplitKeyBlock(input)
+	if err != nil {
+		logError(fmt.Sprintf("GS: %v", err))
+		return nil, errorcodes.Err83
+	}
+	header, err := keyblocklmk.ParseHeader(block)
+	if err != nil {
+		logError(fmt.Sprintf("GS: %v", err))
+		return nil, errorcodes.Err83
+	}
+	if header.KeyUsage != keyblocklmk.KeyUsageBDK {
+		logError(fmt.Sprintf("GS: key usage %s is not a BDK", header.KeyUsage))
+		return nil, errorcodes.Err29
+	}
+
+	ksnLen := dukpt.KSNLength
+	if header.Algorithm == 'A' {
+		ksnLen = dukpt.AESKSNLength
+	}
+	ksn, data, err := parseKSN("GS", data, ksnLen)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := parseTrailingFields("GS", data, "%"); err != nil {
+		return nil, err
+	}
+	lmkID, err := KeyBlockLMKID(block)
+	if err != nil {
+		logError(fmt.Sprintf("GS: %v", err))
+		return nil, errorcodes.Err13
+	}
+
+	logInfo("GS: unwrapping BDK key block under LMK")
+	bdk, err := LMKProviderInstance.DecryptUnderLMK(block, keyBlockKeyType, keyschemes.SchemeS)
+	if err != nil {
+		logError("GS: BDK key block unwrap failed")
+		return nil, errorcodes.Err68
+	}
+
+	var (
+		ik  []byte
+		kcv []byte
+	)
+	switch header.Algorithm {
+	case 'A':
+		keyType, ok := dukpt.AESKeyType(len(bdk))
+		if !ok {
+			logError(fmt.Sprintf("GS: invalid AES BDK length %d", len(bdk)))
+			return nil, errorcodes.Err27
+		}
+		ik, err = dukpt.DeriveInitialKey(bdk, keyType, ksn[:dukpt.InitialKeyIDLength])
+		if err != nil {
+			logError(fmt.Sprintf("GS: initial key derivation failed: %v", err))
+			return nil, errorcodes.Err15
+		}
+		var cv []byte
+		cv, err = keyblocklmk.CalculateCMACCheckValue(ik)
+		kcv = cryptoutils.Raw2B(cv)
+	case keyBlockAlgorithm:
+		if len(bdk) != 16 {
+			logError(fmt.Sprintf("GS: TDES DUKPT requires a double-length BDK, got %d bytes",
+				len(bdk)))
+			return nil, errorcodes.Err27
+		}
+		ik, err = dukpt.DeriveIPEK(bdk, ksn)
+		if err != nil {
+			logError(fmt.Sprintf("GS: IPEK derivation failed: %v", err))
+			return nil, errorcodes.Err15
+		}
+		kcv, err = cryptoutils.KeyCV(cryptoutils.Raw2B(ik), 6)
+	default:
+		logError(fmt.Sprintf("GS: unsupported BDK algorithm %c", header.Algorithm))
+		return nil, errorcodes.Err29
+	}
+	if err != nil {
+		logError("GS: KCV calculation failed")
+		return nil, errors.Join(errors.New("calculate kcv"), err)
+	}
+
+	template := fmt.Appendf(nil, "S10000%s%cX00%c00%s", keyblocklmk.KeyUsageIPEK,
+		header.Algorithm, header.Exportability, lmkID)
+	logInfo("GS: wrapping initial key in a key block under LMK")
+	ikBlock, err := LMKProviderInstance.EncryptUnderLMK(ik, string(template), keyschemes.SchemeS)
+	if err != nil {
+		logError("GS: initial key wrap under LMK failed")
+		return nil, errors.Join(errors.New("wrap under lmk"), err)
+	}
+	// Without a block length in the header the response marks the end of the block.
+	if len(ikBlock) > 5 && string(ikBlock[2:6]) == "0000" {
+		ikBlock = append(ikBlock, msgspec.DelimKeySchemes)
+	}
+
+	return buildKeyResponse("GT", kcv[:6], encodedCryptogram(ikBlock)), nil
+}
+
+// parseKSN reads a KSN of n bytes, in 2n hex digits, at the start of data.
+func parseKSN(cmd string, data []byte, n int) ([]byte, []byte, error) {
+	if len(data) < 2*n {
+		logError(cmd + ": missing or short KSN")
+		return nil, nil, errorcodes.Err15
+	}
+	ksn, err := hex.DecodeString(string(data[:2*n]))
+	if err != nil {
+		logError(cmd + ": invalid KSN hex format")
+		return nil, nil, errorcodes.Err15
+	}
+
+	return ksn, data[2*n:], nil
+}
@@ -0,0 +1,121 @@
+package logic
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// wrapTestBDK wraps a BDK in a key block under the default test key block LMK.
+func wrapTestBDK(t *testing.T, usage string, algorithm byte, hexKey string) string {
+	t.Helper()
+
+	key, err := hex.DecodeString(hexKey)
+	require.NoError(t, err)
+	block, err := keyblocklmk.WrapKeyBlock(keyblocklmk.DefaultTestAESLMK, keyblocklmk.Header{
+		Version: '1', KeyUsage: usage, Algorithm: algorithm, ModeOfUse: 'X',
+		KeyVersionNum: "00", Exportability: 'E', KeyContext: 1,
+	}, nil, key)
+	require.NoError(t, err)
+
+	return string(block) + ";"
+}
+
+func TestExecuteGS(t *testing.T) {
+	t.Parallel()
+
+	const (
+		tdesBDK = "0123456789ABCDEFFEDCBA9876543210"
+		tdesKSN = "FFFF9876543210E00000"
+		ipek    = "6AC292FAA1315B4D858AB3A3D7D5933A"
+	)
+	kcv, err := cryptoutils.KeyCV([]byte(ipek), 6)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr error
+	}{
+		{name: "Variant BDK", input: "U" + tdesBDK + tdesKSN},
+		{name: "Unprefixed BDK", input: tdesBDK + tdesKSN + "%00"},
+		{name: "BDK parity error", input: "U" + tdesBDK[:31] + "1" + tdesKSN, wantErr: errorcodes.Err10},
+		{name: "Triple-length BDK", input: "T" + tdesBDK + tdesBDK[:16] + tdesKSN, wantErr: errorcodes.Err27},
+		{name: "Short KSN", input: "U" + tdesBDK + tdesKSN[:18], wantErr: errorcodes.Err15},
+		{name: "Invalid KSN", input: "U" + tdesBDK + "GGGG9876543210E00000", wantErr: errorcodes.Err15},
+		{
+			name:    "Not a BDK",
+			input:   wrapTestBDK(t, "P0", 'T', tdesBDK) + tdesKSN,
+			wantErr: errorcodes.Err29,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ExecuteGS([]byte(tc.input))
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, got, 4+1+32+6)
+			assert.Equal(t, "GT00U", string(got[:5]))
+			assert.Equal(t, string(kcv), string(got[len(got)-6:]))
+		})
+	}
+}
+
+func TestExecuteGSKeyBlock(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		algorithm byte
+		bdk       string
+		ksn       string
+		want      string
+	}{
+		{
+			name:      "TDES",
+			algorithm: 'T',
+			bdk:       "0123456789ABCDEFFEDCBA9876543210",
+			ksn:       "FFFF9876543210E00000",
+			want:      "6AC292FAA1315B4D858AB3A3D7D5933A",
+		},
+		{
+			name:      "AES",
+			algorithm: 'A',
+			bdk:       "FEDCBA9876543210F1F1F1F1F1F1F1F1",
+			ksn:       "123456789012345600000000",
+			want:      "1273671EA26AC29AFA4D1084127652A1",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ExecuteGS([]byte(wrapTestBDK(t, "B0", tc.algorithm, tc.bdk) + tc.ksn))
+			require.NoError(t, err)
+			assert.Equal(t, "GT00S", string(got[:5]))
+
+			block, _, err := keyblocklmk.SplitKeyBlock(got[4 : len(got)-6])
+			require.NoError(t, err)
+			header, ik, err := keyblocklmk.UnwrapKeyBlock(keyblocklmk.DefaultTestAESLMK, block)
+			require.NoError(t, err)
+			assert.Equal(t, keyblocklmk.KeyUsageIPEK, header.KeyUsage)
+			assert.Equal(t, tc.algorithm, header.Algorithm)
+			assert.Equal(t, tc.want, cryptoutils.Raw2Str(ik))
+		})
+	}
+}
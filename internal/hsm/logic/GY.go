@@ -0,0 +1,120 @@
+package logic
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/crypto"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/keyschemes"
+)
+
+// Limits on the number of clear ZMK components.
+const (
+	zmkMinComponents = 2
+	zmkMaxComponents = 9
+)
+
+// ExecuteGY forms a ZMK from clear components and returns it under the LMK.
+// Format: Number of components (1N, 2-9) + Key scheme LMK (1A: U or T) + Components (32H or
+// 48H each). Every component must have odd parity. The components are XOR-combined and the
+// ZMK is set to odd parity. An LMK identifier may follow the request as '%' and two digits.
+// Response: "GZ" + "00" + ZMK under LMK + KCV (6H).
+func ExecuteGY(input []byte) ([]byte, error) {
+	logInfo("GY: starting ZMK formation from components")
+
+	count, scheme, data, err := parseZMKComponentHeader("GY", input)
+	if err != nil {
+		return nil, err
+	}
+	hexLen := 2 * keyschemes.Length(scheme)
+	if len(data) < count*hexLen {
+		logError("GY: insufficient data for components")
+		return nil, errorcodes.Err15
+	}
+	components := make([]string, count)
+	for i := range components {
+		component := string(data[i*hexLen : (i+1)*hexLen])
+		raw, err := hex.DecodeString(component)
+		if err != nil {
+			logError(fmt.Sprintf("GY: component %d is not valid hex", i+1))
+			return nil, errorcodes.Err15
+		}
+		if !cryptoutils.CheckKeyParity(raw) {
+			logError(fmt.Sprintf("GY: component %d parity error", i+1))
+			return nil, errorcodes.Err10
+		}
+		components[i] = component
+	}
+	if _, err := parseTrailingFields("GY", data[count*hexLen:], "%"); err != nil {
+		return nil, err
+	}
+
+	zmk, err := combineZMKComponents("GY", components)
+	if err != nil {
+		return nil, err
+	}
+
+	return encryptFormedZMK("GY", "GZ", zmk, scheme)
+}
+
+// parseZMKComponentHeader reads the number of components and the LMK key scheme at the start
+// of data.
+func parseZMKComponentHeader(cmd string, data []byte) (int, byte, []byte, error) {
+	if len(data) < 2 {
+		logError(cmd + ": missing component count or key scheme")
+		return 0, 0, nil, errorcodes.Err15
+	}
+	count := int(data[0] - '0')
+	if data[0] < '0' || data[0] > '9' || count < zmkMinComponents || count > zmkMaxComponents {
+		logError(fmt.Sprintf("%s: invalid number of components %q", cmd, data[0]))
+		return 0, 0, nil, errorcodes.Err15
+	}
+	scheme := data[1]
+	if scheme != keyschemes.SchemeU && scheme != keyschemes.SchemeT {
+		logError(fmt.Sprintf("%s: invalid key scheme %c", cmd, scheme))
+		return 0, 0, nil, errorcodes.Err26
+	}
+
+	return count, scheme, data[2:], nil
+}
+
+// combineZMKComponents XOR-combines hex components into a ZMK with odd parity. A ZMK of
+// all zeros is rejected.
+func combineZMKComponents(cmd string, components []string) ([]byte, error) {
+	combined, err := crypto.CombineComponents(components)
+	if err != nil {
+		logError(fmt.Sprintf("%s: failed to combine components: %v", cmd, err))
+		return nil, errorcodes.Err15
+	}
+	raw, err := hex.DecodeString(combined)
+	if err != nil {
+		return nil, errors.Join(errors.New("decode combined key"), err)
+	}
+	if isAllZero(raw) {
+		logError(cmd + ": components combine to a ZMK of all zeros")
+		return nil, errorcodes.Err11
+	}
+
+	return cryptoutils.FixKeyParity(raw), nil
+}
+
+// encryptFormedZMK encrypts a formed ZMK under the LMK and returns the response with its KCV.
+func encryptFormedZMK(cmd, respCode string, zmk []byte, scheme byte) ([]byte, error) {
+	logInfo(cmd + ": encrypting ZMK under LMK")
+	encrypted, err := LMKProviderInstance.EncryptUnderLMK(zmk, "000", scheme)
+	if err != nil {
+		logError(cmd + ": ZMK encryption under LMK failed")
+		return nil, errors.Join(errors.New("encrypt under lmk"), err)
+	}
+	kcv, err := cryptoutils.KeyCV(cryptoutils.Raw2B(zmk), 6)
+	if err != nil {
+		logError(cmd + ": KCV calculation failed")
+		return nil, errors.Join(errors.New("calculate kcv"), err)
+	}
+	logInfo(fmt.Sprintf("%s: ZMK formed with KCV %s", cmd, kcv))
+
+	return buildKeyResponse(respCode, kcv, taggedCryptogram(scheme, encrypted)), nil
+}
@@ -0,0 +1,65 @@
+package logic
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteGY(t *testing.T) {
+	t.Parallel()
+
+	const (
+		comp1 = "0123456789ABCDEFFEDCBA9876543210"
+		comp2 = "FEDCBA98765432100123456789ABCDEF"
+	)
+	// comp1 XOR comp1 cancels, so three components form comp2.
+	kcv, err := cryptoutils.KeyCV([]byte(comp2), 6)
+	require.NoError(t, err)
+	// Two components form all F bytes, which is set to odd parity.
+	evenKCV, err := cryptoutils.KeyCV([]byte(strings.Repeat("FE", 16)), 6)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		input   string
+		wantKCV []byte
+		wantErr error
+	}{
+		{name: "Three components", input: "3U" + comp1 + comp2 + comp1, wantKCV: kcv},
+		{name: "Parity adjusted", input: "2U" + comp1 + comp2 + "%00", wantKCV: evenKCV},
+		{name: "One component", input: "1U" + comp1, wantErr: errorcodes.Err15},
+		{name: "Invalid count", input: "AU" + comp1 + comp2, wantErr: errorcodes.Err15},
+		{name: "Invalid scheme", input: "2X" + comp1 + comp2, wantErr: errorcodes.Err26},
+		{name: "Missing component", input: "3U" + comp1 + comp2, wantErr: errorcodes.Err15},
+		{
+			name:    "Component parity error",
+			input:   "2U" + comp1 + comp2[:31] + "E",
+			wantErr: errorcodes.Err10,
+		},
+		{name: "All zero ZMK", input: "2U" + comp1 + comp1, wantErr: errorcodes.Err11},
+		{name: "Invalid hex", input: "2U" + comp1 + strings.Repeat("G", 32), wantErr: errorcodes.Err15},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ExecuteGY([]byte(tc.input))
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, got, 4+1+32+6)
+			assert.Equal(t, "GZ00U", string(got[:5]))
+			assert.Equal(t, string(tc.wantKCV), string(got[len(got)-6:]))
+		})
+	}
+}
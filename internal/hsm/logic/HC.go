@@ -1,12 +1,12 @@
 package logic
 
 import (
-	"crypto/des"
-	"encoding/hex"
 	"fmt"
 
 	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
 	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/keyschemes"
 )
 
 // ExecuteHC generates a TMK, TPK or PVK Variant LMK key, ignoring PCI compliance enforcement.
@@ -19,38 +19,21 @@ func ExecuteHC(input []byte) ([]byte, error) {
 		return nil, errorcodes.Err15
 	}
 
-	inputKeyScheme := input[0]
-	var keyLen int
-	var keyHexLen int
-	var encKeyHex string
-
 	logInfo("HC: processing input key scheme")
-	logDebug(fmt.Sprintf("HC: input key scheme: %c", inputKeyScheme))
-
-	if inputKeyScheme == 'U' || inputKeyScheme == 'T' || inputKeyScheme == 'X' {
-		keyLen = getKeyLength(inputKeyScheme)
-		keyHexLen = keyLen * 2
-		logDebug(fmt.Sprintf("HC: key length: %d bytes (%d hex chars)", keyLen, keyHexLen))
+	logDebug(fmt.Sprintf("HC: input key scheme: %c", input[0]))
 
-		if len(input) < 1+keyHexLen {
-			logError("HC: insufficient data for key with scheme")
-			return nil, errorcodes.Err15
-		}
-		encKeyHex = string(input[1 : 1+keyHexLen])
-		input = input[1+keyHexLen:]
-	} else {
-		// No scheme provided, treat as paired single-length components
+	// Without a scheme the key is treated as paired single-length components.
+	key, input, err := keyschemes.Parse(input, "UTX", 16)
+	if err != nil || (key.Scheme == 0 && len(input) < 2) {
+		logError(fmt.Sprintf("HC: invalid input key: %v", err))
+		return nil, errorcodes.Err15
+	}
+	inputKeyScheme := key.Scheme
+	if inputKeyScheme == 0 {
 		logInfo("HC: processing key as paired single-length components")
 		inputKeyScheme = 'X'
-		keyHexLen = 16
-
-		if len(input) < keyHexLen+2 {
-			logError("HC: insufficient data for paired single-length key")
-			return nil, errorcodes.Err15
-		}
-		encKeyHex = string(input[:keyHexLen])
-		input = input[keyHexLen:]
 	}
+	logDebug(fmt.Sprintf("HC: key length: %d bytes (%d hex chars)", key.Length, len(key.Text)))
 
 	// Accept and skip optional fields after 'HC' (delimiter, key schemes, reserved, LMK id, etc.)
 	if len(input) > 0 && input[0] == ';' {
@@ -77,7 +60,7 @@ func ExecuteHC(input []byte) ([]byte, error) {
 	}
 
 	logInfo("HC: decoding input key")
-	encKeyBytes, err := hex.DecodeString(encKeyHex)
+	encKeyBytes, err := key.Bytes()
 	if err != nil {
 		logError("HC: invalid key hex format")
 		return nil, errorcodes.Err15
@@ -98,7 +81,7 @@ func ExecuteHC(input []byte) ([]byte, error) {
 		return nil, errorcodes.Err10
 	}
 
-	genKeyLen := getKeyLength(inputKeyScheme)
+	genKeyLen := keyschemes.Length(inputKeyScheme)
 	logInfo("HC: generating new random key")
 	newKey, err := LMKProviderInstance.RandomKey(genKeyLen)
 	if err != nil {
@@ -116,7 +99,7 @@ func ExecuteHC(input []byte) ([]byte, error) {
 	logInfo("HC: encrypting generated key under TMK")
 	tmkEncryptedKey := make([]byte, len(newKey))
 	block := cryptoutils.PrepareTripleDESKey(clearKey)
-	cipher, err := des.NewTripleDESCipher(block)
+	cipher, err := cryptoprovider.NewTripleDESCipher(block)
 	if err != nil {
 		logError("HC: failed to create TMK cipher")
 		return nil, errorcodes.Err20
@@ -127,9 +110,10 @@ func ExecuteHC(input []byte) ([]byte, error) {
 	}
 
 	logInfo("HC: formatting response")
-	resp := []byte("HD00")
-	resp = appendEncryptedKeyToResponse(resp, inputKeyScheme, tmkEncryptedKey)
-	resp = appendEncryptedKeyToResponse(resp, inputKeyScheme, lmkEncryptedKey)
+	resp := buildKeyResponse("HD", nil,
+		taggedCryptogram(inputKeyScheme, tmkEncryptedKey),
+		taggedCryptogram(inputKeyScheme, lmkEncryptedKey),
+	)
 
 	logDebug(fmt.Sprintf("HC: response value: %x", resp))
 
@@ -0,0 +1,186 @@
+package logic
+
+import (
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/internal/hsm"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+	"github.com/andrei-cloud/go_hsm/pkg/keyschemes"
+	"github.com/andrei-cloud/go_hsm/pkg/pinblock"
+)
+
+// Key block attributes of PIN keys.
+const (
+	pinKeyUsage       = "P0"
+	pinModesDecrypt   = "BDN" // modes of use permitting PIN block decryption.
+	pinModesEncrypt   = "BEN" // modes of use permitting PIN block encryption.
+	keyBlockKeyType   = "FFF"
+	keyBlockAlgorithm = 'T'
+)
+
+// ExecuteJA translates a PIN block from encryption under one PIN key to another, both held
+// in key blocks under a key block LMK, and returns response bytes.
+// Format: Source PIN key block (S or R + block) + Destination PIN key block + Maximum PIN
+// length (2N) + PIN block (16H) + Source format (2N) + Destination format (2N) + Account
+// number (12N). Key blocks without a block length in their header end with ';'. An LMK
+// identifier may follow the request as '%' and two digits.
+func ExecuteJA(input []byte) ([]byte, error) {
+	logInfo("JA: starting PIN block translation under key block LMK")
+
+	srcKey, data, err := unwrapPINKeyBlock("JA", input, pinKeyUsage, pinModesDecrypt)
+	if err != nil {
+		return nil, err
+	}
+	dstKey, data, err := unwrapPINKeyBlock("JA", data, pinKeyUsage, pinModesEncrypt)
+	if err != nil {
+		return nil, err
+	}
+
+	const fieldsLen = 2 + 16 + 2 + 2 + 12
+	if len(data) < fieldsLen {
+		logError("JA: insufficient data for PIN block fields")
+		return nil, errorcodes.Err15
+	}
+	pinHex := string(data[2:18])
+	fmtSrc := string(data[18:20])
+	fmtDst := string(data[20:22])
+	accountNum := string(data[22:34])
+	if _, err := parseTrailingFields("JA", data[fieldsLen:], "%"); err != nil {
+		return nil, err
+	}
+
+	srcFormat, err := hsm.GetPinBlockFormatFromThalesCode(fmtSrc)
+	if err != nil {
+		logError(fmt.Sprintf("JA: invalid source format code: %s", fmtSrc))
+		return nil, errorcodes.Err23
+	}
+	dstFormat, err := hsm.GetPinBlockFormatFromThalesCode(fmtDst)
+	if err != nil {
+		logError(fmt.Sprintf("JA: invalid destination format code: %s", fmtDst))
+		return nil, errorcodes.Err23
+	}
+
+	clearPIN, err := decryptPINBlock("JA", srcKey, pinHex, accountNum, srcFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := encryptPINBlock("JA", dstKey, clearPIN, accountNum, dstFormat)
+	if err != nil {
+		return nil, err
+	}
+	logInfo("JA: PIN block translated")
+
+	pinLen := fmt.Appendf(nil, "%02d", len(clearPIN))
+
+	return slices.Concat([]byte("JB00"), pinLen, cryptoutils.Raw2B(out), []byte(fmtDst)), nil
+}
+
+// unwrapPINKeyBlock reads the key block at the start of data, checks its key usage,
+// algorithm and mode of use against usage and the permitted modes, and returns the clear
+// key unwrapped under the key block LMK with the bytes that follow the block.
+func unwrapPINKeyBlock(cmd string, data []byte, usage, modes string) ([]byte, []byte, error) {
+	if len(data) == 0 || !keyschemes.IsKeyBlock(data[0]) {
+		logError(cmd + ": key must be a key block")
+		return nil, nil, errorcodes.Err26
+	}
+	block, rest, err := keyblocklmk.SplitKeyBlock(data)
+	if err != nil {
+		logError(fmt.Sprintf("%s: %v", cmd, err))
+		return nil, nil, errorcodes.Err83
+	}
+	header, err := keyblocklmk.ParseHeader(block)
+	if err != nil {
+		logError(fmt.Sprintf("%s: %v", cmd, err))
+		return nil, nil, errorcodes.Err83
+	}
+	if header.KeyUsage != usage || header.Algorithm != keyBlockAlgorithm {
+		logError(fmt.Sprintf("%s: key usage %s algorithm %c, want usage %s algorithm %c",
+			cmd, header.KeyUsage, header.Algorithm, usage, keyBlockAlgorithm))
+		return nil, nil, errorcodes.Err29
+	}
+	if strings.IndexByte(modes, header.ModeOfUse) < 0 {
+		logError(fmt.Sprintf("%s: mode of use %c not permitted", cmd, header.ModeOfUse))
+		return nil, nil, errorcodes.Err29
+	}
+
+	logInfo(fmt.Sprintf("%s: unwrapping %s key block under LMK", cmd, usage))
+	// S and R blocks are both wrapped under the key block LMK.
+	key, err := LMKProviderInstance.DecryptUnderLMK(block, keyBlockKeyType, keyschemes.SchemeS)
+	if err != nil {
+		logError(fmt.Sprintf("%s: %s key block unwrap failed", cmd, usage))
+		return nil, nil, errorcodes.Err68
+	}
+	if n := len(key); n != 16 && n != 24 {
+		logError(fmt.Sprintf("%s: invalid TDES key length %d", cmd, n))
+		return nil, nil, errorcodes.Err27
+	}
+
+	return key, rest, nil
+}
+
+// decryptPINBlock decrypts a hex PIN block under the clear TDES PIN key and returns the
+// clear PIN.
+func decryptPINBlock(
+	cmd string,
+	key []byte,
+	pinHex, accountNum string,
+	format pinblock.PinBlockFormat,
+) (string, error) {
+	encrypted, err := hex.DecodeString(pinHex)
+	if err != nil {
+		logError(cmd + ": invalid PIN block hex format")
+		return "", errorcodes.Err15
+	}
+	block, err := cryptoprovider.NewTripleDESCipher(cryptoutils.PrepareTripleDESKey(key))
+	if err != nil {
+		logError(fmt.Sprintf("%s: PIN key cipher initialization error: %v", cmd, err))
+		return "", fmt.Errorf("pin key cipher: %w", err)
+	}
+	plain := make([]byte, len(encrypted))
+	block.Decrypt(plain, encrypted)
+
+	clearPIN, err := pinblock.DecodePinBlock(hex.EncodeToString(plain), accountNum, format)
+	if err != nil {
+		logError(fmt.Sprintf("%s: failed to extract clear PIN: %v", cmd, err))
+		return "", errorcodes.Err20
+	}
+
+	return clearPIN, nil
+}
+
+// encryptPINBlock formats the clear PIN in format and encrypts the PIN block under the clear
+// TDES PIN key.
+func encryptPINBlock(
+	cmd string,
+	key []byte,
+	clearPIN, accountNum string,
+	format pinblock.PinBlockFormat,
+) ([]byte, error) {
+	logInfo(cmd + ": encoding PIN in destination format")
+	blockHex, err := pinblock.EncodePinBlock(clearPIN, accountNum, format)
+	if err != nil {
+		logError(fmt.Sprintf("%s: failed to encode PIN block: %v", cmd, err))
+		return nil, errorcodes.Err20
+	}
+	plain, err := hex.DecodeString(blockHex)
+	if err != nil {
+		logError(cmd + ": failed to decode new PIN block hex")
+		return nil, errorcodes.Err15
+	}
+	block, err := cryptoprovider.NewTripleDESCipher(cryptoutils.PrepareTripleDESKey(key))
+	if err != nil {
+		logError(fmt.Sprintf("%s: destination key cipher initialization error: %v", cmd, err))
+		return nil, fmt.Errorf("destination key cipher: %w", err)
+	}
+	out := make([]byte, len(plain))
+	block.Encrypt(out, plain)
+
+	return out, nil
+}
@@ -0,0 +1,91 @@
+package logic
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// PIN 1234 for account 345513804937 in ISO format 0 under pinTestKey, verified by PVV 2677
+// under pinTestPVK with PVKI 1.
+const (
+	pinTestKey     = "0123456789ABCDEFFEDCBA9876543210"
+	pinTestOther   = "89E88CF7931444F334BD7547FC3F380C"
+	pinTestPVK     = "0123456789ABCDEF0123456789ABCDEF"
+	pinTestBlock   = "CB4EBC0180DFED6E"
+	pinTestAccount = "345513804937"
+)
+
+// wrapTestKeyBlock wraps a TDES key in a key block under the test key block LMK.
+func wrapTestKeyBlock(t *testing.T, keyHex, usage string, modeOfUse byte) string {
+	t.Helper()
+
+	key, err := hex.DecodeString(keyHex)
+	require.NoError(t, err)
+	header := keyblocklmk.Header{
+		Version:       '1',
+		KeyUsage:      usage,
+		Algorithm:     'T',
+		ModeOfUse:     modeOfUse,
+		KeyVersionNum: "00",
+		Exportability: 'N',
+		KeyContext:    1,
+	}
+	block, err := keyblocklmk.WrapKeyBlockWithOptions(keyblocklmk.DefaultTestAESLMK, header, nil, key,
+		keyblocklmk.WrapOptions{StrictCompat: true})
+	require.NoError(t, err)
+
+	return string(block)
+}
+
+func TestExecuteJA(t *testing.T) {
+	t.Parallel()
+
+	if err := SetupTestLMKProvider(); err != nil {
+		t.Fatalf("Failed to setup test LMK provider: %v", err)
+	}
+
+	src := wrapTestKeyBlock(t, pinTestKey, "P0", 'B')
+	dst := wrapTestKeyBlock(t, pinTestOther, "P0", 'B')
+	encryptOnly := wrapTestKeyBlock(t, pinTestKey, "P0", 'E')
+	pvk := wrapTestKeyBlock(t, pinTestPVK, "V2", 'C')
+	fields := "12" + pinTestBlock + "0101" + pinTestAccount
+
+	resp, err := ExecuteJA([]byte(src + dst + fields))
+	require.NoError(t, err)
+	require.Len(t, resp, 4+2+16+2)
+	assert.Equal(t, "JB0004", string(resp[:6]))
+	assert.Equal(t, "01", string(resp[22:]))
+	translated := string(resp[6:22])
+	assert.NotEqual(t, pinTestBlock, translated)
+
+	// Translating back restores the deterministic ISO format 0 block.
+	resp, err = ExecuteJA([]byte(dst + src + "12" + translated + "0101" + pinTestAccount + "%01"))
+	require.NoError(t, err)
+	assert.Equal(t, "JB0004"+pinTestBlock+"01", string(resp))
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr error
+	}{
+		{"Variant source key", "U" + pinTestKey + dst + fields, errorcodes.Err26},
+		{"Source key not permitted to decrypt", encryptOnly + dst + fields, errorcodes.Err29},
+		{"Wrong key usage", pvk + dst + fields, errorcodes.Err29},
+		{"Short fields", src + dst + fields[:20], errorcodes.Err15},
+		{"Invalid format code", src + dst + "12" + pinTestBlock + "9901" + pinTestAccount, errorcodes.Err23},
+		{"Unknown LMK identifier", src + dst + fields + "%42", errorcodes.Err13},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := ExecuteJA([]byte(tc.input))
+			assert.ErrorIs(t, err, tc.wantErr)
+		})
+	}
+}
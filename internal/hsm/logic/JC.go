@@ -0,0 +1,97 @@
+package logic
+
+import (
+	"crypto/subtle"
+	"fmt"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/internal/hsm"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/msgspec"
+)
+
+// Key block attributes of Visa PVV keys.
+const (
+	pvvKeyUsage    = "V2"
+	pvvModesVerify = "CNV" // modes of use permitting PVV verification.
+)
+
+// jcSpec describes the JC (Verify PIN) request layout up to the account number, which is
+// all that is needed to attribute a verification to an account.
+var jcSpec = msgspec.Spec{
+	Command: "JC",
+	Fields: []msgspec.Field{
+		msgspec.Key("pin_key", "SR", 0),
+		msgspec.Key("pvk", "SR", 0),
+		msgspec.Fixed("pin_block", 16, msgspec.EncodingHex),
+		msgspec.Fixed("format_code", 2, msgspec.EncodingNumeric),
+		msgspec.Fixed("account", 12, msgspec.EncodingNumeric),
+	},
+	AllowTrailing: true,
+}
+
+// ExecuteJC verifies a PIN against a Visa PVV with the PIN key and PVK held in key blocks
+// under a key block LMK, and returns response bytes.
+// Format: PIN key block (S or R + block) + PVK key block + PIN block (16H) + Format (2N) +
+// Account number (12N) + PVKI (1N) + PVV (4N). Key blocks without a block length in their
+// header end with ';'. An LMK identifier may follow the request as '%' and two digits.
+func ExecuteJC(input []byte) ([]byte, error) {
+	logInfo("JC: starting PIN verification under key block LMK")
+
+	pinKey, data, err := unwrapPINKeyBlock("JC", input, pinKeyUsage, pinModesDecrypt)
+	if err != nil {
+		return nil, err
+	}
+	pvk, data, err := unwrapPINKeyBlock("JC", data, pvvKeyUsage, pvvModesVerify)
+	if err != nil {
+		return nil, err
+	}
+	if len(pvk) != 16 {
+		logError(fmt.Sprintf("JC: PVK must be double length, got %d bytes", len(pvk)))
+		return nil, errorcodes.Err27
+	}
+
+	const fieldsLen = 16 + 2 + 12 + 1 + 4
+	if len(data) < fieldsLen {
+		logError("JC: insufficient data for PIN block fields")
+		return nil, errorcodes.Err15
+	}
+	pinHex := string(data[:16])
+	formatCode := string(data[16:18])
+	accountNum := string(data[18:30])
+	pvki := string(data[30:31])
+	pvv := data[31:35]
+	if _, err := parseTrailingFields("JC", data[fieldsLen:], "%"); err != nil {
+		return nil, err
+	}
+
+	format, err := hsm.GetPinBlockFormatFromThalesCode(formatCode)
+	if err != nil {
+		logError(fmt.Sprintf("JC: invalid PIN block format code: %s", formatCode))
+		return nil, errorcodes.Err23
+	}
+	clearPIN, err := decryptPINBlock("JC", pinKey, pinHex, accountNum, format)
+	if err != nil {
+		return nil, err
+	}
+
+	logInfo("JC: calculating PVV with extracted PIN")
+	calculated, err := cryptoutils.GetVisaPVVWith(
+		decimalizerFor("JC", accountNum),
+		accountNum,
+		pvki,
+		clearPIN,
+		pvk,
+	)
+	if err != nil {
+		logError("JC: failed to calculate PVV")
+		return nil, errorcodes.Err68
+	}
+	if subtle.ConstantTimeCompare(calculated, pvv) != 1 {
+		logError("JC: PVV verification failed")
+		return nil, errorcodes.Err01
+	}
+	logInfo("JC: PIN verification completed successfully")
+
+	return []byte("JD" + errorcodes.Err00.CodeOnly()), nil
+}
@@ -0,0 +1,49 @@
+package logic
+
+import (
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecuteJC(t *testing.T) {
+	t.Parallel()
+
+	if err := SetupTestLMKProvider(); err != nil {
+		t.Fatalf("Failed to setup test LMK provider: %v", err)
+	}
+
+	zpk := wrapTestKeyBlock(t, pinTestKey, "P0", 'D')
+	pvk := wrapTestKeyBlock(t, pinTestPVK, "V2", 'V')
+	generateOnly := wrapTestKeyBlock(t, pinTestPVK, "V2", 'G')
+	fields := pinTestBlock + "01" + pinTestAccount + "1"
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{name: "Verified", input: zpk + pvk + fields + "2677", want: "JD00"},
+		{name: "Verified with LMK identifier", input: zpk + pvk + fields + "2677%01", want: "JD00"},
+		{name: "Wrong PVV", input: zpk + pvk + fields + "2678", wantErr: errorcodes.Err01},
+		{name: "PVK not permitted to verify", input: zpk + generateOnly + fields + "2677", wantErr: errorcodes.Err29},
+		{name: "PIN key as PVK", input: zpk + zpk + fields + "2677", wantErr: errorcodes.Err29},
+		{name: "Short fields", input: zpk + pvk + fields, wantErr: errorcodes.Err15},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			resp, err := ExecuteJC([]byte(tc.input))
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, string(resp))
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package logic
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/msgspec"
+)
+
+// KC modes.
+const (
+	kcModeGenerate = '0'
+	kcModeVerify   = '1'
+)
+
+// kcKCVLength is the length of each component check value in hex characters.
+const kcKCVLength = 6
+
+// kcSpec describes the KC (MAC on Component Check Values) request header.
+var kcSpec = msgspec.Spec{
+	Command: "KC",
+	Fields: []msgspec.Field{
+		msgspec.Fixed("mode", 1, msgspec.EncodingNumeric),
+		msgspec.Key("tak", "U", 32),
+		msgspec.Fixed("count", 1, msgspec.EncodingNumeric),
+	},
+	AllowTrailing: true,
+}
+
+// ExecuteKC processes the KC (MAC on Component Check Values) command and returns response bytes.
+// It computes or verifies a combined check value over the KCVs of key components entered
+// under dual control, so the component set can be confirmed without exposing any component.
+// Format: Mode (1: 0 generate, 1 verify) + TAK (U + 32H) + Component count (1N, 2-9) +
+// Component KCVs (count x 6H) + [MAC (8H), verify mode only].
+func ExecuteKC(input []byte) ([]byte, error) {
+	logInfo("KC: starting MAC on component check values")
+	msg, err := kcSpec.Parse(input)
+	if err != nil {
+		logError(fmt.Sprintf("KC: %v", err))
+		return nil, errorcodes.WithDetail(errorcodes.Err15, err.Error())
+	}
+
+	mode := msg.Get("mode")[0]
+	if mode != kcModeGenerate && mode != kcModeVerify {
+		logError("KC: invalid mode")
+		return nil, errorcodes.Err15
+	}
+
+	count := int(msg.Get("count")[0] - '0')
+	if count < 2 {
+		logError("KC: at least two components are required")
+		return nil, errorcodes.Err15
+	}
+
+	rest := msg.Rest()
+	expected := count * kcKCVLength
+	if mode == kcModeVerify {
+		expected += 8
+	}
+	if len(rest) != expected {
+		logError("KC: invalid component check value data length")
+		return nil, errorcodes.Err15
+	}
+
+	kcvs := make([][]byte, count)
+	for i := range kcvs {
+		kcv, err := hex.DecodeString(string(rest[i*kcKCVLength : (i+1)*kcKCVLength]))
+		if err != nil {
+			logError("KC: invalid component check value")
+			return nil, errorcodes.Err15
+		}
+		kcvs[i] = kcv
+	}
+	logDebug(fmt.Sprintf("KC: component check values: %X", kcvs))
+
+	tak, _ := msg.Value("tak")
+	takRaw, err := hex.DecodeString(tak.Data)
+	if err != nil {
+		logError("KC: invalid TAK hex format")
+		return nil, errorcodes.Err15
+	}
+
+	logInfo("KC: decrypting TAK under LMK")
+	clearTAK, err := LMKProviderInstance.DecryptUnderLMK(takRaw, "003", tak.Scheme)
+	if err != nil {
+		logError("KC: TAK decryption failed")
+		return nil, errorcodes.Err68
+	}
+	if !cryptoutils.CheckKeyParity(clearTAK) {
+		logError("KC: TAK parity check failed")
+		return nil, errorcodes.Err10
+	}
+
+	mac, err := cryptoutils.ComponentKCVMAC(kcvs, clearTAK)
+	if err != nil {
+		logError(fmt.Sprintf("KC: failed to calculate MAC: %v", err))
+		return nil, errorcodes.Err42
+	}
+	macHex := []byte(strings.ToUpper(hex.EncodeToString(mac)))
+
+	if mode == kcModeVerify {
+		got := bytes.ToUpper(rest[count*kcKCVLength:])
+		if !bytes.Equal(got, macHex) {
+			logError("KC: component check value MAC verification failed")
+			return nil, errorcodes.Err01
+		}
+		logInfo("KC: component check value MAC verified")
+
+		return []byte("KD00"), nil
+	}
+
+	logInfo("KC: component check value MAC generated")
+
+	return append([]byte("KD00"), macHex...), nil
+}
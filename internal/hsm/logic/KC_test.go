@@ -0,0 +1,105 @@
+package logic
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecuteKC(t *testing.T) {
+	t.Parallel()
+
+	// Initialize the test LMK provider.
+	if err := SetupTestLMKProvider(); err != nil {
+		t.Fatalf("Failed to setup test LMK provider: %v", err)
+	}
+
+	const (
+		validTAK     = "U0123456789ABCDEFFEDCBA9876543210"
+		badParityTAK = "U00000000000000000000000000000000"
+		kcvs         = "08D7B4" + "D2DB51" + "1FA24C"
+	)
+
+	tak, _ := hex.DecodeString(validTAK[1:])
+	kcvRaw, _ := hex.DecodeString(kcvs)
+	mac, err := cryptoutils.ComponentKCVMAC(
+		[][]byte{kcvRaw[0:3], kcvRaw[3:6], kcvRaw[6:9]}, tak,
+	)
+	if err != nil {
+		t.Fatalf("Failed to calculate expected MAC: %v", err)
+	}
+	macHex := strings.ToUpper(hex.EncodeToString(mac))
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{
+			name:    "Short input",
+			input:   "0U01",
+			wantErr: errorcodes.Err15,
+		},
+		{
+			name:    "Invalid mode",
+			input:   "2" + validTAK + "3" + kcvs,
+			wantErr: errorcodes.Err15,
+		},
+		{
+			name:    "Single component",
+			input:   "0" + validTAK + "1" + "08D7B4",
+			wantErr: errorcodes.Err15,
+		},
+		{
+			name:    "Component count mismatch",
+			input:   "0" + validTAK + "4" + kcvs,
+			wantErr: errorcodes.Err15,
+		},
+		{
+			name:    "Non hex component check value",
+			input:   "0" + validTAK + "3" + "08D7B4D2DB511FA24G",
+			wantErr: errorcodes.Err15,
+		},
+		{
+			name:    "TAK parity error",
+			input:   "0" + badParityTAK + "3" + kcvs,
+			wantErr: errorcodes.Err10,
+		},
+		{
+			name:  "Generate MAC",
+			input: "0" + validTAK + "3" + kcvs,
+			want:  "KD00" + macHex,
+		},
+		{
+			name:  "Verify MAC",
+			input: "1" + validTAK + "3" + kcvs + macHex,
+			want:  "KD00",
+		},
+		{
+			name:    "Verify MAC with reordered components",
+			input:   "1" + validTAK + "3" + "D2DB51" + "08D7B4" + "1FA24C" + macHex,
+			wantErr: errorcodes.Err01,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ExecuteKC([]byte(tc.input))
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, string(got))
+		})
+	}
+}
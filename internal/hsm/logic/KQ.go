@@ -1,17 +1,19 @@
 package logic
 
 import (
-	"bytes"
 	"encoding/hex"
 	"fmt"
 
 	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
 	"github.com/andrei-cloud/go_hsm/pkg/common"
 	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/emv"
+	"github.com/andrei-cloud/go_hsm/pkg/pan"
 )
 
 // ExecuteKQ implements the KQ HSM command for ARQC verification and/or ARPC generation.
-// Command supports Visa VIS CVN 10 (scheme 0) with modes 0, 1, 2.
+// Command supports Visa VIS CVN 10 (scheme 0) with modes 0, 1, 2. An LMK identifier may
+// follow as '%' and two digits.
 func ExecuteKQ(input []byte) ([]byte, error) {
 	logInfo("KQ: Starting ARQC/ARPC command execution")
 	logDebug(fmt.Sprintf("KQ: Input length: %d, hex: %x", len(input), input))
@@ -119,6 +121,7 @@ func ExecuteKQ(input []byte) ([]byte, error) {
 
 		return nil, errorcodes.Err10
 	}
+	defer cryptoutils.Zeroize(clearMKAC)
 
 	logInfo("KQ: Verifying MK-AC parity.")
 	if !cryptoutils.CheckKeyParity(clearMKAC) {
@@ -140,7 +143,7 @@ func ExecuteKQ(input []byte) ([]byte, error) {
 		return nil, errorcodes.Err15
 	}
 	panPsn := input[index : index+8]
-	logDebug(fmt.Sprintf("KQ: PAN/PSN: %x", panPsn))
+	logDebug(fmt.Sprintf("KQ: PAN/PSN: %s", pan.Mask(hex.EncodeToString(panPsn))))
 	index += 8
 
 	// Parse ATC (2 bytes).
@@ -217,13 +220,27 @@ func ExecuteKQ(input []byte) ([]byte, error) {
 
 		arc = input[index : index+2]
 		logDebug(fmt.Sprintf("KQ: ARC: %x", arc))
+		index += 2
+	}
+
+	// The binary fields are parsed; only an LMK identifier may follow.
+	if _, err := parseTrailingFields("KQ", input[index:], "%"); err != nil {
+		return nil, err
 	}
 
 	// Extract PAN and PSN from PAN/PSN field for key derivation.
-	pan := fmt.Sprintf("%x", panPsn[:7])  // First 7 bytes as PAN
-	psn := fmt.Sprintf("%02x", panPsn[7]) // Last byte as PSN
+	account := fmt.Sprintf("%x", panPsn[:7]) // First 7 bytes as PAN
+	psn := fmt.Sprintf("%02x", panPsn[7])    // Last byte as PSN
+
+	logDebug(fmt.Sprintf("KQ: PAN: %s, PSN: %s", pan.Mask(account), psn))
 
-	logDebug(fmt.Sprintf("KQ: PAN: %s, PSN: %s", pan, psn))
+	// Scheme 0 is Visa CVN 10.
+	profile, err := emv.Lookup(emv.ProfileVisaCVN10)
+	if err != nil {
+		logError(fmt.Sprintf("KQ: %v", err))
+		return nil, errorcodes.Err68
+	}
+	tx := emv.Transaction{PAN: account, PSN: psn, ATC: atc, UN: un}
 
 	logInfo("KQ: Processing based on mode.")
 
@@ -234,7 +251,7 @@ func ExecuteKQ(input []byte) ([]byte, error) {
 		// Mode 0: ARQC verification only.
 		logInfo("KQ: Mode 0 - ARQC verification only")
 
-		calculatedARQC, err := cryptoutils.GenerateARQC10(clearMKAC, transactionData, pan, psn)
+		calculatedARQC, err := profile.GenerateARQC(clearMKAC, tx, transactionData)
 		if err != nil {
 			logError(fmt.Sprintf("KQ: ARQC calculation failed: %v", err))
 			return nil, errorcodes.Err42
@@ -243,7 +260,7 @@ func ExecuteKQ(input []byte) ([]byte, error) {
 		logDebug(fmt.Sprintf("KQ: Calculated ARQC: %x", calculatedARQC))
 		logDebug(fmt.Sprintf("KQ: Received ARQC: %x", arqc))
 
-		if !bytes.Equal(calculatedARQC, arqc) {
+		if !cryptoutils.ConstantTimeEqual(calculatedARQC, arqc) {
 			logError("KQ: ARQC verification failed")
 			return nil, errorcodes.Err01
 		}
@@ -255,39 +272,39 @@ func ExecuteKQ(input []byte) ([]byte, error) {
 		// Mode 1: ARQC verification and ARPC generation.
 		logInfo("KQ: Mode 1 - ARQC verification and ARPC generation")
 
-		calculatedARQC, err := cryptoutils.GenerateARQC10(clearMKAC, transactionData, pan, psn)
+		calculatedARQC, err := profile.GenerateARQC(clearMKAC, tx, transactionData)
 		if err != nil {
 			logError(fmt.Sprintf("KQ: ARQC calculation failed: %v", err))
 			return nil, errorcodes.Err42
 		}
 
-		if !bytes.Equal(calculatedARQC, arqc) {
+		if !cryptoutils.ConstantTimeEqual(calculatedARQC, arqc) {
 			logError("KQ: ARQC verification failed")
 			return nil, errorcodes.Err01
 		}
 
 		// Generate ARPC.
-		arpc, err := cryptoutils.GenerateARPC10(clearMKAC, arqc, arc, pan, psn)
+		arpc, err := profile.GenerateARPC(clearMKAC, tx, arqc, arc, nil)
 		if err != nil {
 			logError(fmt.Sprintf("KQ: ARPC generation failed: %v", err))
 			return nil, errorcodes.Err42
 		}
 
 		logInfo("KQ: ARQC verification and ARPC generation successful")
-		response = append([]byte("KR00"), []byte(hex.EncodeToString(arpc))...)
+		response = append([]byte("KR00"), arpc...)
 
 	case 2:
 		// Mode 2: ARPC generation only.
 		logInfo("KQ: Mode 2 - ARPC generation only")
 
-		arpc, err := cryptoutils.GenerateARPC10(clearMKAC, arqc, arc, pan, psn)
+		arpc, err := profile.GenerateARPC(clearMKAC, tx, arqc, arc, nil)
 		if err != nil {
 			logError(fmt.Sprintf("KQ: ARPC generation failed: %v", err))
 			return nil, errorcodes.Err42
 		}
 
 		logInfo("KQ: ARPC generation successful")
-		response = append([]byte("KR00"), []byte(hex.EncodeToString(arpc))...)
+		response = append([]byte("KR00"), arpc...)
 	}
 
 	logDebug(fmt.Sprintf("KQ: Final response: %s", string(response)))
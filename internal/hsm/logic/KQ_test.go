@@ -335,6 +335,45 @@ func TestExecuteKQ(t *testing.T) {
 			expectKR00: true,
 			expectARPC: true,
 		},
+		{
+			name: "Mode 2 with LMK identifier",
+			inputFunc: func() []byte {
+				input := []byte("20")
+				input = append(input, []byte(validMKACHex)...)
+				input = append(input, validPANPSN...)
+				input = append(input, validATC...)
+				input = append(input, validUN...)
+				input = append(input, []byte(validTxnDataLen)...)
+				input = append(input, validTxnData...)
+				input = append(input, []byte(validDelimiter)...)
+				input = append(input, validARQC...)
+				input = append(input, validARC...)
+				input = append(input, []byte("%00")...)
+
+				return input
+			},
+			expectKR00: true,
+			expectARPC: true,
+		},
+		{
+			name: "Mode 2 with invalid LMK identifier",
+			inputFunc: func() []byte {
+				input := []byte("20")
+				input = append(input, []byte(validMKACHex)...)
+				input = append(input, validPANPSN...)
+				input = append(input, validATC...)
+				input = append(input, validUN...)
+				input = append(input, []byte(validTxnDataLen)...)
+				input = append(input, validTxnData...)
+				input = append(input, []byte(validDelimiter)...)
+				input = append(input, validARQC...)
+				input = append(input, validARC...)
+				input = append(input, []byte("%9")...)
+
+				return input
+			},
+			expectedErr: errorcodes.Err13,
+		},
 	}
 
 	for _, tt := range tests {
@@ -357,17 +396,13 @@ func TestExecuteKQ(t *testing.T) {
 				assert.Equal(t, "KR00", string(result[:4]))
 
 				if tt.expectARPC {
-					// Should have ARPC appended (16 hex characters).
+					// Should have the 8-byte binary ARPC appended.
 					assert.Equal(
 						t,
-						20,
+						12,
 						len(result),
-						"Expected KR00 + 16 hex chars for ARPC",
+						"Expected KR00 + 8 binary bytes for ARPC",
 					)
-					// Verify ARPC is valid hex.
-					arpcHex := string(result[4:])
-					_, err := hex.DecodeString(arpcHex)
-					assert.NoError(t, err, "ARPC should be valid hex")
 				} else {
 					// Mode 0 should only return KR00.
 					assert.Equal(t, 4, len(result), "Mode 0 should only return KR00")
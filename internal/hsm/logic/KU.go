@@ -0,0 +1,280 @@
+package logic
+
+import (
+	"encoding/hex"
+	"fmt"
+	"slices"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/internal/hsm"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/msgspec"
+	"github.com/andrei-cloud/go_hsm/pkg/pinblock"
+)
+
+// KU mode flags.
+const (
+	kuModeIntegrity    = '0' // script MAC only, e.g. application block or PIN unblock.
+	kuModePINChange    = '1' // new offline PIN enciphered under SK-SMC, then MAC.
+	kuModeConfidential = '2' // script data enciphered under SK-SMC, then MAC.
+)
+
+// KU session key derivation methods, selected by an optional '#' field after the mode flag.
+const (
+	kuDerivationAC  = '0' // EMV common session key with the application cryptogram.
+	kuDerivationATC = '1' // EMV common session key with ATC || 00...00.
+)
+
+// kuCardFields are the card fields common to all KU modes, after the mode specific keys.
+var kuCardFields = []msgspec.Field{
+	msgspec.Delimited("pan", ';', 12, 19, msgspec.EncodingNumeric),
+	msgspec.Fixed("psn", 2, msgspec.EncodingNumeric),
+	msgspec.Fixed("ac", 16, msgspec.EncodingHex),
+	msgspec.Remainder("script", 8, msgspec.EncodingHex),
+}
+
+// kuATCCardFields replace the application cryptogram of kuCardFields with the ATC when
+// session keys are derived from the ATC.
+var kuATCCardFields = []msgspec.Field{
+	msgspec.Delimited("pan", ';', 12, 19, msgspec.EncodingNumeric),
+	msgspec.Fixed("psn", 2, msgspec.EncodingNumeric),
+	msgspec.Fixed("atc", 4, msgspec.EncodingHex),
+	msgspec.Remainder("script", 8, msgspec.EncodingHex),
+}
+
+// kuModeFields are the mode specific fields that precede the card fields.
+var kuModeFields = map[byte][]msgspec.Field{
+	kuModeIntegrity: {
+		msgspec.Fixed("mode", 1, msgspec.EncodingNumeric),
+		msgspec.Key("mk_smi", "U", 32),
+	},
+	kuModePINChange: {
+		msgspec.Fixed("mode", 1, msgspec.EncodingNumeric),
+		msgspec.Key("mk_smi", "U", 32),
+		msgspec.Key("mk_smc", "U", 32),
+		msgspec.Key("tpk", "U", 16),
+		msgspec.Fixed("pin_block", 16, msgspec.EncodingHex),
+		msgspec.Fixed("format_code", 2, msgspec.EncodingNumeric),
+		msgspec.Fixed("account", 12, msgspec.EncodingNumeric),
+	},
+	kuModeConfidential: {
+		msgspec.Fixed("mode", 1, msgspec.EncodingNumeric),
+		msgspec.Key("mk_smi", "U", 32),
+		msgspec.Key("mk_smc", "U", 32),
+		msgspec.Delimited("data", ';', 2, 2048, msgspec.EncodingHex),
+	},
+}
+
+// ExecuteKU processes the KU (Generate Secure Message) command and returns response bytes.
+// It builds EMV issuer scripts: the ICC session keys are derived from the issuer MK-SMI and
+// MK-SMC (EMV option A/B ICC key derivation, then the common session key derivation with
+// the application cryptogram, or the ATC, as diversification data), and the script MAC is
+// computed over the script command data, followed by the enciphered data in modes 1 and 2.
+// Format: Mode (1N) + optional '#' + Session key derivation (1N: 0 application cryptogram,
+// 1 ATC) + MK-SMI (U + 32H or 32H) + [mode 1: MK-SMC (U + 32H or 32H) + TPK (U + 32H or
+// 16H) + PIN block (16H) + Format code (2N) + Account number (12N)] + [mode 2: MK-SMC +
+// Script plaintext data (hex) + ';'] + PAN (12-19N) + ';' + PSN (2N) + Application
+// cryptogram (16H), or ATC (4H) with derivation 1, + Script data (8H minimum).
+// Response: KV00 + [modes 1 and 2: enciphered data] + MAC (16H).
+func ExecuteKU(input []byte) ([]byte, error) {
+	logInfo("KU: starting secure message generation")
+	if len(input) < 1 {
+		logError("KU: input too short for mode flag")
+		return nil, errorcodes.Err15
+	}
+
+	mode := input[0]
+	fields, ok := kuModeFields[mode]
+	if !ok {
+		logError(fmt.Sprintf("KU: unsupported mode flag %q", mode))
+		return nil, errorcodes.Err15
+	}
+	derivation := byte(kuDerivationAC)
+	if len(input) >= 3 && input[1] == '#' {
+		derivation = input[2]
+		input = slices.Concat(input[:1], input[3:])
+	}
+	cardFields := kuCardFields
+	switch derivation {
+	case kuDerivationAC:
+	case kuDerivationATC:
+		cardFields = kuATCCardFields
+	default:
+		logError(fmt.Sprintf("KU: unsupported session key derivation %q", derivation))
+		return nil, errorcodes.Err15
+	}
+
+	spec := msgspec.Spec{Command: "KU", Fields: slices.Concat(fields, cardFields)}
+	msg, err := spec.Parse(input)
+	if err != nil {
+		logError(fmt.Sprintf("KU: %v", err))
+		return nil, errorcodes.WithDetail(errorcodes.Err15, err.Error())
+	}
+
+	pan, psn := msg.Get("pan"), msg.Get("psn")
+	// The diversification data is the application cryptogram or ATC || 00...00.
+	ac, _ := hex.DecodeString(msg.Get("ac"))
+	if derivation == kuDerivationATC {
+		atc, _ := hex.DecodeString(msg.Get("atc"))
+		ac = slices.Concat(atc, make([]byte, 6))
+	}
+	script, _ := hex.DecodeString(msg.Get("script"))
+
+	mkSMI, _ := msg.Value("mk_smi")
+	skSMI, err := kuSessionKey("MK-SMI", "209", mkSMI, pan, psn, ac)
+	if err != nil {
+		return nil, err
+	}
+
+	var enciphered []byte
+	if mode != kuModeIntegrity {
+		mkSMC, _ := msg.Value("mk_smc")
+		skSMC, err := kuSessionKey("MK-SMC", "309", mkSMC, pan, psn, ac)
+		if err != nil {
+			return nil, err
+		}
+		if mode == kuModePINChange {
+			enciphered, err = kuEncipherPIN(msg, skSMC)
+		} else {
+			enciphered, err = kuEncipherData(msg, skSMC)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	logInfo("KU: calculating script MAC")
+	mac, err := cryptoutils.SecureMessagingMAC(slices.Concat(script, enciphered), skSMI)
+	if err != nil {
+		logError(fmt.Sprintf("KU: MAC calculation failed: %v", err))
+		return nil, errorcodes.Err68
+	}
+
+	logInfo("KU: secure message generated successfully")
+
+	return slices.Concat(
+		[]byte("KV"),
+		[]byte(errorcodes.Err00.CodeOnly()),
+		cryptoutils.Raw2B(enciphered),
+		cryptoutils.Raw2B(mac),
+	), nil
+}
+
+// kuSessionKey decrypts an issuer secure messaging master key of the given key type and
+// derives the ICC session key for the card and application cryptogram.
+func kuSessionKey(name, keyType string, mk msgspec.Value, pan, psn string, ac []byte) ([]byte, error) {
+	raw, err := hex.DecodeString(mk.Data)
+	if err != nil {
+		logError(fmt.Sprintf("KU: invalid %s hex format", name))
+		return nil, errorcodes.Err15
+	}
+	scheme := byte('0')
+	if mk.Scheme == 'U' {
+		scheme = 'U'
+	}
+
+	logInfo(fmt.Sprintf("KU: decrypting %s under LMK", name))
+	clearMK, err := LMKProviderInstance.DecryptUnderLMK(raw, keyType, scheme)
+	if err != nil {
+		logError(fmt.Sprintf("KU: %s decryption failed", name))
+		return nil, errorcodes.Err10
+	}
+	if !cryptoutils.CheckKeyParity(clearMK) {
+		logError(fmt.Sprintf("KU: %s parity check failed", name))
+		return nil, errorcodes.Err10
+	}
+
+	logInfo(fmt.Sprintf("KU: deriving %s session key", name))
+	iccKey, err := cryptoutils.DeriveICCKeyForPAN(clearMK, pan, psn, false)
+	if err != nil {
+		logError(fmt.Sprintf("KU: %s ICC key derivation failed: %v", name, err))
+		return nil, errorcodes.Err68
+	}
+	sessionKey, err := cryptoutils.DeriveSessionKey(iccKey, ac)
+	if err != nil {
+		logError(fmt.Sprintf("KU: %s session key derivation failed: %v", name, err))
+		return nil, errorcodes.Err68
+	}
+
+	return sessionKey, nil
+}
+
+// kuEncipherPIN translates the new PIN from the TPK to an ICC PIN block and enciphers the PIN change data under the SK-SMC session key.
+func kuEncipherPIN(msg *msgspec.Message, skSMC []byte) ([]byte, error) {
+	tpk, _ := msg.Value("tpk")
+	tpkScheme := byte('X')
+	if tpk.Scheme == 'U' {
+		tpkScheme = 'U'
+	}
+	tpkRaw, err := hex.DecodeString(tpk.Data)
+	if err != nil {
+		logError("KU: invalid TPK hex format")
+		return nil, errorcodes.Err15
+	}
+	logInfo("KU: decrypting TPK under LMK")
+	clearTPK, err := LMKProviderInstance.DecryptUnderLMK(tpkRaw, "002", tpkScheme)
+	if err != nil {
+		logError("KU: TPK decryption failed")
+		return nil, errorcodes.Err68
+	}
+	if !cryptoutils.CheckKeyParity(clearTPK) {
+		logError("KU: TPK parity check failed")
+		return nil, errorcodes.Err10
+	}
+
+	logInfo("KU: decrypting PIN block with TPK")
+	tpkCipher, err := cryptoprovider.NewTripleDESCipher(cryptoutils.PrepareTripleDESKey(clearTPK))
+	if err != nil {
+		logError("KU: failed to create TPK cipher")
+		return nil, errorcodes.Err68
+	}
+	encPIN, _ := hex.DecodeString(msg.Get("pin_block"))
+	clearBlock := make([]byte, len(encPIN))
+	tpkCipher.Decrypt(clearBlock, encPIN)
+
+	formatCode := msg.Get("format_code")
+	pinFormat, err := hsm.GetPinBlockFormatFromThalesCode(formatCode)
+	if err != nil {
+		logError(fmt.Sprintf("KU: invalid PIN block format code: %s", formatCode))
+		return nil, errorcodes.Err23
+	}
+	clearPIN, err := pinblock.DecodePinBlock(hex.EncodeToString(clearBlock), msg.Get("account"), pinFormat)
+	if err != nil {
+		logError("KU: failed to extract clear PIN")
+		return nil, errorcodes.Err20
+	}
+
+	pinData, err := cryptoutils.OfflinePINChangeData(clearPIN)
+	if err != nil {
+		logError("KU: failed to build ICC PIN block")
+		return nil, errorcodes.Err24
+	}
+
+	logInfo("KU: enciphering PIN change data under SK-SMC")
+	enciphered, err := cryptoutils.EncipherSecureMessagingData(pinData, skSMC)
+	if err != nil {
+		logError(fmt.Sprintf("KU: PIN data encipherment failed: %v", err))
+		return nil, errorcodes.Err68
+	}
+
+	return enciphered, nil
+}
+
+// kuEncipherData enciphers the script plaintext data under the SK-SMC session key.
+func kuEncipherData(msg *msgspec.Message, skSMC []byte) ([]byte, error) {
+	data, err := hex.DecodeString(msg.Get("data"))
+	if err != nil {
+		logError("KU: script data must be an even number of hex digits")
+		return nil, errorcodes.Err15
+	}
+
+	logInfo("KU: enciphering script data under SK-SMC")
+	enciphered, err := cryptoutils.EncipherSecureMessagingData(data, skSMC)
+	if err != nil {
+		logError(fmt.Sprintf("KU: script data encipherment failed: %v", err))
+		return nil, errorcodes.Err68
+	}
+
+	return enciphered, nil
+}
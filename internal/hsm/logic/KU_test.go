@@ -0,0 +1,154 @@
+package logic
+
+import (
+	"crypto/cipher"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/pinblock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteKU(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, SetupTestLMKProvider())
+
+	const (
+		pan     = "4761739001010010"
+		psn     = "01"
+		ac      = "1122334455667788"
+		script  = "8424000210000100001122334455667788"
+		account = "173900101001"
+		pin     = "4321"
+	)
+	clearSMI, _ := hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+	clearSMC, _ := hex.DecodeString("FEDCBA98765432100123456789ABCDEF")
+	clearTPK, _ := hex.DecodeString("0123456789ABCDEF0123456789ABCDEF")
+	// The test LMK provider decrypts keys to themselves.
+	underLMK := func(key []byte) string {
+		return "U" + strings.ToUpper(hex.EncodeToString(key))
+	}
+	mkSMI, mkSMC, tpk := underLMK(clearSMI), underLMK(clearSMC), underLMK(clearTPK)
+
+	pinBlockHex, err := pinblock.EncodePinBlock(pin, account, pinblock.ISO0)
+	require.NoError(t, err)
+	pinBlock, _ := hex.DecodeString(pinBlockHex)
+	tpkCipher, err := cryptoprovider.NewTripleDESCipher(cryptoutils.PrepareTripleDESKey(clearTPK))
+	require.NoError(t, err)
+	tpkCipher.Encrypt(pinBlock, pinBlock)
+	encPINBlock := strings.ToUpper(hex.EncodeToString(pinBlock))
+
+	card := pan + ";" + psn + ac + script
+	sessionKey := func(mk []byte) []byte {
+		t.Helper()
+		icc, err := cryptoutils.DeriveICCKeyForPAN(mk, pan, psn, false)
+		require.NoError(t, err)
+		acRaw, _ := hex.DecodeString(ac)
+		sk, err := cryptoutils.DeriveSessionKey(icc, acRaw)
+		require.NoError(t, err)
+
+		return sk
+	}
+	scriptRaw, _ := hex.DecodeString(script)
+
+	t.Run("integrity", func(t *testing.T) {
+		t.Parallel()
+
+		got, err := ExecuteKU([]byte("0" + mkSMI + card))
+		require.NoError(t, err)
+		mac, err := cryptoutils.SecureMessagingMAC(scriptRaw, sessionKey(clearSMI))
+		require.NoError(t, err)
+		assert.Equal(t, "KV00"+strings.ToUpper(hex.EncodeToString(mac)), string(got))
+	})
+
+	t.Run("pin change", func(t *testing.T) {
+		t.Parallel()
+
+		got, err := ExecuteKU([]byte("1" + mkSMI + mkSMC + tpk + encPINBlock + "01" + account + card))
+		require.NoError(t, err)
+		require.Len(t, got, 4+32+16)
+		assert.Equal(t, "KV00", string(got[:4]))
+
+		// The enciphered data decrypts to the ISO format 2 block of the new PIN.
+		enciphered, _ := hex.DecodeString(string(got[4:36]))
+		block, err := cryptoprovider.NewTripleDESCipher(
+			cryptoutils.PrepareTripleDESKey(sessionKey(clearSMC)))
+		require.NoError(t, err)
+		plain := make([]byte, len(enciphered))
+		cipher.NewCBCDecrypter(block, make([]byte, 8)).CryptBlocks(plain, enciphered)
+		assert.Equal(t, "08244321FFFFFFFFFF80000000000000", strings.ToUpper(hex.EncodeToString(plain)))
+
+		mac, err := cryptoutils.SecureMessagingMAC(slices.Concat(scriptRaw, enciphered), sessionKey(clearSMI))
+		require.NoError(t, err)
+		assert.Equal(t, strings.ToUpper(hex.EncodeToString(mac)), string(got[36:]))
+	})
+
+	t.Run("confidential script data", func(t *testing.T) {
+		t.Parallel()
+
+		const data = "0102030405060708090A"
+		got, err := ExecuteKU([]byte("2" + mkSMI + mkSMC + data + ";" + card))
+		require.NoError(t, err)
+		require.Len(t, got, 4+32+16)
+
+		dataRaw, _ := hex.DecodeString(data)
+		enciphered, err := cryptoutils.EncipherSecureMessagingData(dataRaw, sessionKey(clearSMC))
+		require.NoError(t, err)
+		mac, err := cryptoutils.SecureMessagingMAC(slices.Concat(scriptRaw, enciphered), sessionKey(clearSMI))
+		require.NoError(t, err)
+		assert.Equal(t, "KV00"+cryptoutils.Raw2Str(enciphered)+cryptoutils.Raw2Str(mac), string(got))
+	})
+
+	t.Run("session keys derived from the ATC", func(t *testing.T) {
+		t.Parallel()
+
+		got, err := ExecuteKU([]byte("0#1" + mkSMI + pan + ";" + psn + "005E" + script))
+		require.NoError(t, err)
+		icc, err := cryptoutils.DeriveICCKeyForPAN(clearSMI, pan, psn, false)
+		require.NoError(t, err)
+		sk, err := cryptoutils.DeriveSessionKey(icc, []byte{0x00, 0x5E, 0, 0, 0, 0, 0, 0})
+		require.NoError(t, err)
+		mac, err := cryptoutils.SecureMessagingMAC(scriptRaw, sk)
+		require.NoError(t, err)
+		assert.Equal(t, "KV00"+cryptoutils.Raw2Str(mac), string(got))
+
+		// An explicit application cryptogram derivation matches the default.
+		explicit, err := ExecuteKU([]byte("0#0" + mkSMI + card))
+		require.NoError(t, err)
+		plain, err := ExecuteKU([]byte("0" + mkSMI + card))
+		require.NoError(t, err)
+		assert.Equal(t, plain, explicit)
+	})
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr error
+	}{
+		{"invalid session key derivation", "0#7" + mkSMI + card, errorcodes.Err15},
+		{"missing script data delimiter", "2" + mkSMI + mkSMC + "0102" + card, errorcodes.Err15},
+		{"odd length script data", "2" + mkSMI + mkSMC + "010;" + card, errorcodes.Err15},
+		{"empty", "", errorcodes.Err15},
+		{"invalid mode", "9" + mkSMI + card, errorcodes.Err15},
+		{"missing PAN delimiter", "0" + mkSMI + pan + psn + ac + script, errorcodes.Err15},
+		{"short script", "0" + mkSMI + pan + ";" + psn + ac + "8424", errorcodes.Err15},
+		{"MK-SMI parity", "0U" + strings.Repeat("0", 32) + card, errorcodes.Err10},
+		{"invalid format code", "1" + mkSMI + mkSMC + tpk + encPINBlock + "99" + account + card, errorcodes.Err23},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := ExecuteKU([]byte(tc.input))
+			assert.ErrorIs(t, err, tc.wantErr)
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package logic
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/emv"
+)
+
+// Key block attributes of EMV issuer master keys for application cryptograms.
+const (
+	emvKeyUsage = "E0"
+	emvModes    = "NX" // modes of use permitting ICC master key derivation.
+)
+
+// emvSchemes maps the KW and KY scheme ID to the EMV profile cryptograms are computed with.
+var emvSchemes = map[byte]string{
+	'0': emv.ProfileVisaCVN10,
+	'1': emv.ProfileVisaCVN14,
+	'2': emv.ProfileEMVCSK,
+	'3': emv.ProfileMastercardSKD,
+	'4': emv.ProfileVisaCVN18,
+}
+
+// emvRequest holds the fields common to the key block EMV cryptogram commands.
+type emvRequest struct {
+	profile emv.Profile
+	mkac    []byte
+	tx      emv.Transaction
+}
+
+// ExecuteKW verifies an ARQC and/or generates an ARPC with the MK-AC held in a key block
+// under a key block LMK, and returns response bytes.
+// Format: Mode flag (1N: 0 verify ARQC, 1 verify ARQC and generate ARPC, 2 generate ARPC) +
+// Scheme ID (1N) + MK-AC key block (S or R + block, usage E0) + PAN/PSN (8B) + ATC (2B) +
+// UN (4B) + Transaction data length (2H) + Transaction data + ';' + ARQC (8B), followed in
+// modes 1 and 2 by the ARPC data of the scheme. Key blocks without a block length in their
+// header end with ';'. An LMK identifier may follow the request as '%' and two digits.
+// Response: "KX" + "00" + ARPC (16H for ARPC method 1, 8H for method 2) in modes 1 and 2.
+func ExecuteKW(input []byte) ([]byte, error) {
+	logInfo("KW: starting ARQC/ARPC processing under key block LMK")
+
+	if len(input) < 2 {
+		logError("KW: missing mode flag or scheme ID")
+		return nil, errorcodes.Err15
+	}
+	mode := input[0]
+	if mode < '0' || mode > '2' {
+		logError(fmt.Sprintf("KW: unsupported mode %c", mode))
+		return nil, errorcodes.Err68
+	}
+
+	req, data, err := parseEMVRequest("KW", input[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < 2 {
+		logError("KW: missing transaction data length")
+		return nil, errorcodes.Err15
+	}
+	dataLen, err := strconv.ParseUint(string(data[:2]), 16, 8)
+	if err != nil {
+		logError("KW: invalid transaction data length")
+		return nil, errorcodes.Err15
+	}
+	if dataLen < 1 || dataLen > 252 {
+		logError(fmt.Sprintf("KW: transaction data length %d out of range", dataLen))
+		return nil, errorcodes.Err80
+	}
+	data = data[2:]
+	if len(data) < int(dataLen)+1+8 || data[dataLen] != ';' {
+		logError("KW: missing transaction data, delimiter or ARQC")
+		return nil, errorcodes.Err15
+	}
+	txData := data[:dataLen]
+	arqc := data[dataLen+1 : dataLen+1+8]
+	data = data[dataLen+1+8:]
+
+	var arpcData, propData []byte
+	if mode != '0' {
+		if arpcData, propData, data, err = parseARPCData("KW", req.profile, data); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := parseTrailingFields("KW", data, "%"); err != nil {
+		return nil, err
+	}
+
+	if mode != '2' {
+		ok, err := req.profile.VerifyARQC(req.mkac, req.tx, txData, arqc)
+		if err != nil {
+			logError(fmt.Sprintf("KW: ARQC calculation failed: %v", err))
+			return nil, errorcodes.Err42
+		}
+		if !ok {
+			logError("KW: ARQC verification failed")
+			return nil, errorcodes.Err01
+		}
+		logInfo("KW: ARQC verified")
+	}
+	if mode == '0' {
+		return []byte("KX" + errorcodes.Err00.CodeOnly()), nil
+	}
+
+	arpc, err := req.profile.GenerateARPC(req.mkac, req.tx, arqc, arpcData, propData)
+	if err != nil {
+		logError(fmt.Sprintf("KW: ARPC generation failed: %v", err))
+		return nil, errorcodes.Err42
+	}
+	logInfo("KW: ARPC generated")
+
+	return slices.Concat([]byte("KX00"), cryptoutils.Raw2B(arpc)), nil
+}
+
+// parseEMVRequest reads the scheme ID, the MK-AC key block and the PAN/PSN, ATC and UN
+// fields at the start of data, and returns them with the bytes that follow.
+func parseEMVRequest(cmd string, data []byte) (*emvRequest, []byte, error) {
+	if len(data) < 1 {
+		logError(cmd + ": missing scheme ID")
+		return nil, nil, errorcodes.Err15
+	}
+	name, ok := emvSchemes[data[0]]
+	if !ok {
+		logError(fmt.Sprintf("%s: unsupported scheme %c", cmd, data[0]))
+		return nil, nil, errorcodes.Err68
+	}
+	profile, err := emv.Lookup(name)
+	if err != nil {
+		logError(fmt.Sprintf("%s: %v", cmd, err))
+		return nil, nil, errorcodes.Err68
+	}
+
+	mkac, data, err := unwrapPINKeyBlock(cmd, data[1:], emvKeyUsage, emvModes)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(mkac) != 16 {
+		logError(fmt.Sprintf("%s: MK-AC must be double length, got %d bytes", cmd, len(mkac)))
+		return nil, nil, errorcodes.Err27
+	}
+
+	const fieldsLen = 8 + 2 + 4
+	if len(data) < fieldsLen {
+		logError(cmd + ": insufficient data for PAN/PSN, ATC and UN")
+		return nil, nil, errorcodes.Err15
+	}
+	panPSN := data[:8]
+	tx := emv.Transaction{
+		PAN: fmt.Sprintf("%x", panPSN[:7]),
+		PSN: fmt.Sprintf("%02x", panPSN[7]),
+		ATC: data[8:10],
+		UN:  data[10:14],
+	}
+	logInfo(fmt.Sprintf("%s: using EMV profile %s", cmd, profile.Name))
+
+	return &emvRequest{profile: profile, mkac: mkac, tx: tx}, data[fieldsLen:], nil
+}
+
+// parseARPCData reads the ARPC input of the profile at the start of data: the ARC (2B) for
+// ARPC method 1, or the CSU (4B) + proprietary authentication data length (1N) + data for
+// method 2. It returns the ARC or CSU, the proprietary data and the bytes that follow.
+func parseARPCData(cmd string, profile emv.Profile, data []byte) ([]byte, []byte, []byte, error) {
+	if profile.ARPC == emv.ARPCMethod1 {
+		if len(data) < 2 {
+			logError(cmd + ": missing ARC")
+			return nil, nil, nil, errorcodes.Err15
+		}
+
+		return data[:2], nil, data[2:], nil
+	}
+
+	if len(data) < 4+1 {
+		logError(cmd + ": missing CSU or proprietary authentication data length")
+		return nil, nil, nil, errorcodes.Err15
+	}
+	if data[4] < '0' || data[4] > '8' {
+		logError(fmt.Sprintf("%s: invalid proprietary authentication data length %c", cmd, data[4]))
+		return nil, nil, nil, errorcodes.Err15
+	}
+	propLen := int(data[4] - '0')
+	if len(data) < 5+propLen {
+		logError(cmd + ": missing proprietary authentication data")
+		return nil, nil, nil, errorcodes.Err15
+	}
+
+	return data[:4], data[5 : 5+propLen], data[5+propLen:], nil
+}
@@ -0,0 +1,170 @@
+package logic
+
+import (
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/emv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// EMV test values: the Visa CVN 10 ARQC 076C5766F738E9A6 of emvTestData under
+// emvTestMKAC for PAN 11111111111111, PSN 00.
+const (
+	emvTestMKAC   = "0123456789ABCDEFFEDCBA9876543210"
+	emvTestPANPSN = "1111111111111100"
+	emvTestATC    = "005E"
+	emvTestUN     = "52BF4585"
+	emvTestData   = "0000000123000000000000000784800004800008402505220052BF45851800005E06011203"
+	emvTestARQC   = "076C5766F738E9A6"
+)
+
+// emvTestFields returns the PAN/PSN, ATC and UN fields of the EMV test transaction.
+func emvTestFields(t *testing.T) string {
+	t.Helper()
+
+	return string(mustDecodeHex(emvTestPANPSN + emvTestATC + emvTestUN))
+}
+
+// emvTestARQCFor computes the ARQC of emvTestData under the EMV profile.
+func emvTestARQCFor(t *testing.T, profile string) []byte {
+	t.Helper()
+
+	p, err := emv.Lookup(profile)
+	require.NoError(t, err)
+	tx := emv.Transaction{
+		PAN: "11111111111111", PSN: "00",
+		ATC: mustDecodeHex(emvTestATC), UN: mustDecodeHex(emvTestUN),
+	}
+	arqc, err := p.GenerateARQC(mustDecodeHex(emvTestMKAC), tx, mustDecodeHex(emvTestData))
+	require.NoError(t, err)
+
+	return arqc
+}
+
+func TestExecuteKW(t *testing.T) {
+	t.Parallel()
+
+	if err := SetupTestLMKProvider(); err != nil {
+		t.Fatalf("Failed to setup test LMK provider: %v", err)
+	}
+
+	mkac := wrapTestKeyBlock(t, emvTestMKAC, "E0", 'X')
+	pinKey := wrapTestKeyBlock(t, emvTestMKAC, "P0", 'B')
+	txData := "25" + string(mustDecodeHex(emvTestData)) + ";"
+	arqc := string(mustDecodeHex(emvTestARQC))
+	arc := "00"
+
+	// The ARPC of the Visa CVN 10 ARQC with ARC "00".
+	arpc10, err := cryptoutils.GenerateARPC10(mustDecodeHex(emvTestMKAC),
+		mustDecodeHex(emvTestARQC), []byte(arc), "11111111111111", "00")
+	require.NoError(t, err)
+
+	arqc18 := emvTestARQCFor(t, emv.ProfileVisaCVN18)
+	arqcSKD := emvTestARQCFor(t, emv.ProfileMastercardSKD)
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{
+			name:  "verify Visa CVN 10 ARQC",
+			input: "00" + mkac + emvTestFields(t) + txData + arqc,
+			want:  "KX00",
+		},
+		{
+			name:  "verify ARQC and generate ARPC",
+			input: "10" + mkac + emvTestFields(t) + txData + arqc + arc,
+			want:  "KX00" + cryptoutils.Raw2Str(arpc10),
+		},
+		{
+			name:  "generate ARPC only",
+			input: "20" + mkac + emvTestFields(t) + txData + "AAAAAAAA" + arc,
+			want:  "KX00",
+		},
+		{
+			name:  "verify Mastercard SKD ARQC",
+			input: "03" + mkac + emvTestFields(t) + txData + string(arqcSKD),
+			want:  "KX00",
+		},
+		{
+			name:  "CVN 18 ARPC method 2 with proprietary data",
+			input: "14" + mkac + emvTestFields(t) + txData + string(arqc18) + "\x00\x00\x00\x00" + "2AB",
+			want:  "KX00",
+		},
+		{
+			name:    "ARQC mismatch",
+			input:   "00" + mkac + emvTestFields(t) + txData + "AAAAAAAA",
+			wantErr: errorcodes.Err01,
+		},
+		{
+			name:    "Visa CVN 10 ARQC under EMV CSK scheme",
+			input:   "02" + mkac + emvTestFields(t) + txData + arqc,
+			wantErr: errorcodes.Err01,
+		},
+		{
+			name:    "unsupported mode",
+			input:   "30" + mkac + emvTestFields(t) + txData + arqc,
+			wantErr: errorcodes.Err68,
+		},
+		{
+			name:    "unsupported scheme",
+			input:   "09" + mkac + emvTestFields(t) + txData + arqc,
+			wantErr: errorcodes.Err68,
+		},
+		{
+			name:    "key block with wrong usage",
+			input:   "00" + pinKey + emvTestFields(t) + txData + arqc,
+			wantErr: errorcodes.Err29,
+		},
+		{
+			name:    "variant key instead of key block",
+			input:   "00U" + emvTestMKAC + emvTestFields(t) + txData + arqc,
+			wantErr: errorcodes.Err26,
+		},
+		{
+			name:    "transaction data length zero",
+			input:   "00" + mkac + emvTestFields(t) + "00;" + arqc,
+			wantErr: errorcodes.Err80,
+		},
+		{
+			name:    "missing delimiter",
+			input:   "00" + mkac + emvTestFields(t) + "25" + string(mustDecodeHex(emvTestData)) + arqc,
+			wantErr: errorcodes.Err15,
+		},
+		{
+			name:    "missing ARC",
+			input:   "10" + mkac + emvTestFields(t) + txData + arqc,
+			wantErr: errorcodes.Err15,
+		},
+		{
+			name:    "invalid proprietary data length",
+			input:   "14" + mkac + emvTestFields(t) + txData + string(arqc18) + "\x00\x00\x00\x00" + "9",
+			wantErr: errorcodes.Err15,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			resp, err := ExecuteKW([]byte(tc.input))
+			if tc.wantErr != nil {
+				assert.Equal(t, tc.wantErr, err)
+
+				return
+			}
+			require.NoError(t, err)
+			if len(tc.want) > 4 {
+				assert.Equal(t, tc.want, string(resp))
+			} else {
+				assert.Equal(t, tc.want, string(resp[:4]))
+			}
+		})
+	}
+}
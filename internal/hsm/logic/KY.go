@@ -0,0 +1,46 @@
+package logic
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+)
+
+// ExecuteKY generates an ARPC for an ARQC without verifying it, with the MK-AC held in a key
+// block under a key block LMK, and returns response bytes.
+// Format: Scheme ID (1N) + MK-AC key block (S or R + block, usage E0) + PAN/PSN (8B) + ATC
+// (2B) + UN (4B) + ARQC (8B) + ARC (2B) for ARPC method 1, or CSU (4B) + Proprietary
+// authentication data length (1N) + data for method 2. Key blocks without a block length in
+// their header end with ';'. An LMK identifier may follow the request as '%' and two digits.
+// Response: "KZ" + "00" + ARPC (16H for ARPC method 1, 8H for method 2).
+func ExecuteKY(input []byte) ([]byte, error) {
+	logInfo("KY: starting ARPC generation under key block LMK")
+
+	req, data, err := parseEMVRequest("KY", input)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8 {
+		logError("KY: missing ARQC")
+		return nil, errorcodes.Err15
+	}
+	arqc := data[:8]
+	arpcData, propData, data, err := parseARPCData("KY", req.profile, data[8:])
+	if err != nil {
+		return nil, err
+	}
+	if _, err := parseTrailingFields("KY", data, "%"); err != nil {
+		return nil, err
+	}
+
+	arpc, err := req.profile.GenerateARPC(req.mkac, req.tx, arqc, arpcData, propData)
+	if err != nil {
+		logError(fmt.Sprintf("KY: ARPC generation failed: %v", err))
+		return nil, errorcodes.Err42
+	}
+	logInfo("KY: ARPC generated")
+
+	return slices.Concat([]byte("KZ00"), cryptoutils.Raw2B(arpc)), nil
+}
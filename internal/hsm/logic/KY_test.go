@@ -0,0 +1,94 @@
+package logic
+
+import (
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/emv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteKY(t *testing.T) {
+	t.Parallel()
+
+	if err := SetupTestLMKProvider(); err != nil {
+		t.Fatalf("Failed to setup test LMK provider: %v", err)
+	}
+
+	mkac := wrapTestKeyBlock(t, emvTestMKAC, "E0", 'N')
+	arqc := mustDecodeHex(emvTestARQC)
+	tx := emv.Transaction{
+		PAN: "11111111111111", PSN: "00",
+		ATC: mustDecodeHex(emvTestATC), UN: mustDecodeHex(emvTestUN),
+	}
+	arpc := func(profile string, resp, propData []byte) string {
+		p, err := emv.Lookup(profile)
+		require.NoError(t, err)
+		out, err := p.GenerateARPC(mustDecodeHex(emvTestMKAC), tx, arqc, resp, propData)
+		require.NoError(t, err)
+
+		return "KZ00" + cryptoutils.Raw2Str(out)
+	}
+	csu := "\x00\x10\x00\x00"
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{
+			name:  "Visa CVN 10 ARPC method 1",
+			input: "0" + mkac + emvTestFields(t) + string(arqc) + "00",
+			want:  arpc(emv.ProfileVisaCVN10, []byte("00"), nil),
+		},
+		{
+			name:  "EMV 2000 tree ARPC",
+			input: "1" + mkac + emvTestFields(t) + string(arqc) + "05",
+			want:  arpc(emv.ProfileVisaCVN14, []byte("05"), nil),
+		},
+		{
+			name:  "Visa CVN 18 ARPC method 2",
+			input: "4" + mkac + emvTestFields(t) + string(arqc) + csu + "0",
+			want:  arpc(emv.ProfileVisaCVN18, []byte(csu), nil),
+		},
+		{
+			name:  "ARPC method 2 with proprietary data and LMK identifier",
+			input: "4" + mkac + emvTestFields(t) + string(arqc) + csu + "3ABC%01",
+			want:  arpc(emv.ProfileVisaCVN18, []byte(csu), []byte("ABC")),
+		},
+		{
+			name:    "missing ARQC",
+			input:   "0" + mkac + emvTestFields(t) + "ABC",
+			wantErr: errorcodes.Err15,
+		},
+		{
+			name:    "missing PAN/PSN, ATC and UN",
+			input:   "0" + mkac + "1234",
+			wantErr: errorcodes.Err15,
+		},
+		{
+			name:    "missing scheme",
+			input:   "",
+			wantErr: errorcodes.Err15,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			resp, err := ExecuteKY([]byte(tc.input))
+			if tc.wantErr != nil {
+				assert.Equal(t, tc.wantErr, err)
+
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, string(resp))
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package logic
+
+import (
+	"crypto"
+	"fmt"
+	"strconv"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+	"github.com/andrei-cloud/go_hsm/pkg/keyschemes"
+)
+
+// Attributes of HMAC keys.
+const (
+	hmacKeyType      = "10C"
+	hmacKeyUsage     = "M6"
+	hmacKeyAlgorithm = 'H'
+)
+
+// hmacHashes maps hash identifiers to the hash functions HMACs are computed with.
+var hmacHashes = map[string]crypto.Hash{
+	"01": crypto.SHA1,
+	"05": crypto.SHA224,
+	"06": crypto.SHA256,
+	"07": crypto.SHA384,
+	"08": crypto.SHA512,
+}
+
+// hmacRequest is a parsed LQ or LS request up to the message.
+type hmacRequest struct {
+	hash     crypto.Hash
+	hmacSize int
+	key      []byte // clear HMAC key.
+	rest     []byte // bytes following the key.
+}
+
+// ExecuteLQ generates an HMAC over a message and returns response bytes.
+// Format: Hash identifier (2N: 01 SHA-1, 05 SHA-224, 06 SHA-256, 07 SHA-384, 08 SHA-512) +
+// HMAC length (4N, bytes) + HMAC key (U/T + 32H/48H of key type 10C under a variant LMK, or
+// S/R key block with key usage M6 and algorithm H, followed by ';' when the header carries
+// no block length) + Message length (5N) + Message.
+// Response: "LR" + "00" + HMAC length (4N) + HMAC (hex).
+func ExecuteLQ(input []byte) ([]byte, error) {
+	logInfo("LQ: starting HMAC generation")
+
+	req, err := parseHMACRequest("LQ", input, 'G')
+	if err != nil {
+		return nil, err
+	}
+	data, err := parseHMACMessage("LQ", req.rest)
+	if err != nil {
+		return nil, err
+	}
+
+	mac, err := cryptoutils.HMAC(req.hash, req.key, data)
+	if err != nil {
+		logError(fmt.Sprintf("LQ: failed to calculate HMAC: %v", err))
+		return nil, errorcodes.Err42
+	}
+	logInfo("LQ: HMAC generated")
+
+	resp := fmt.Appendf(nil, "LR00%04d", req.hmacSize)
+
+	return append(resp, cryptoutils.Raw2B(mac[:req.hmacSize])...), nil
+}
+
+// parseHMACRequest reads the hash identifier, HMAC length and HMAC key at the start of data.
+// A key block key must permit the operation in its mode of use (G generate, V verify).
+func parseHMACRequest(cmd string, data []byte, modeOfUse byte) (*hmacRequest, error) {
+	if len(data) < 6 {
+		logError(cmd + ": input too short for hash identifier and HMAC length")
+		return nil, errorcodes.Err15
+	}
+	h, ok := hmacHashes[string(data[:2])]
+	if !ok {
+		logError(fmt.Sprintf("%s: unsupported hash identifier %s", cmd, data[:2]))
+		return nil, errorcodes.Err15
+	}
+	size, err := strconv.Atoi(string(data[2:6]))
+	if err != nil || size <= 0 || size > h.Size() {
+		logError(fmt.Sprintf("%s: invalid HMAC length %q for %v", cmd, data[2:6], h))
+		return nil, errorcodes.Err15
+	}
+
+	req := &hmacRequest{hash: h, hmacSize: size}
+	data = data[6:]
+	if len(data) > 0 && keyschemes.IsKeyBlock(data[0]) {
+		req.key, req.rest, err = unwrapHMACKeyBlock(cmd, data, modeOfUse)
+		if err != nil {
+			return nil, err
+		}
+
+		return req, nil
+	}
+
+	key, rest, err := keyschemes.Parse(data, "UT", 32)
+	if err != nil {
+		logError(fmt.Sprintf("%s: invalid HMAC key: %v", cmd, err))
+		return nil, errorcodes.Err15
+	}
+	keyRaw, err := key.Bytes()
+	if err != nil {
+		logError(cmd + ": invalid HMAC key hex format")
+		return nil, errorcodes.Err15
+	}
+	scheme := key.Scheme
+	if scheme == 0 {
+		scheme = keyschemes.SchemeU
+	}
+	logInfo(cmd + ": decrypting HMAC key under LMK")
+	req.key, err = LMKProviderInstance.DecryptUnderLMK(keyRaw, hmacKeyType, scheme)
+	if err != nil {
+		logError(cmd + ": HMAC key decryption failed")
+		return nil, errorcodes.Err68
+	}
+	req.rest = rest
+
+	return req, nil
+}
+
+// unwrapHMACKeyBlock reads the HMAC key block at the start of data and returns the clear key
+// with the bytes that follow the block.
+func unwrapHMACKeyBlock(cmd string, data []byte, modeOfUse byte) ([]byte, []byte, error) {
+	block, rest, err := keyblocklmk.SplitKeyBlock(data)
+	if err != nil {
+		logError(fmt.Sprintf("%s: %v", cmd, err))
+		return nil, nil, errorcodes.Err83
+	}
+	header, err := keyblocklmk.ParseHeader(block)
+	if err != nil {
+		logError(fmt.Sprintf("%s: %v", cmd, err))
+		return nil, nil, errorcodes.Err83
+	}
+	if header.KeyUsage != hmacKeyUsage || header.Algorithm != hmacKeyAlgorithm {
+		logError(fmt.Sprintf("%s: key usage %s algorithm %c is not an HMAC key",
+			cmd, header.KeyUsage, header.Algorithm))
+		return nil, nil, errorcodes.Err29
+	}
+	if header.ModeOfUse != 'C' && header.ModeOfUse != modeOfUse {
+		logError(fmt.Sprintf("%s: mode of use %c not permitted", cmd, header.ModeOfUse))
+		return nil, nil, errorcodes.Err29
+	}
+
+	logInfo(cmd + ": unwrapping HMAC key block under LMK")
+	key, err := LMKProviderInstance.DecryptUnderLMK(block, keyBlockKeyType, keyschemes.SchemeS)
+	if err != nil {
+		logError(cmd + ": HMAC key block unwrap failed")
+		return nil, nil, errorcodes.Err68
+	}
+
+	return key, rest, nil
+}
+
+// parseHMACMessage reads the 5N message length and the message.
+func parseHMACMessage(cmd string, data []byte) ([]byte, error) {
+	if len(data) < 5 {
+		logError(cmd + ": input too short for message length")
+		return nil, errorcodes.Err15
+	}
+	msgLen, err := strconv.Atoi(string(data[:5]))
+	if err != nil {
+		logError(cmd + ": invalid message length")
+		return nil, errorcodes.Err80
+	}
+	if len(data[5:]) != msgLen {
+		logError(cmd + ": message length mismatch")
+		return nil, errorcodes.Err80
+	}
+
+	return data[5:], nil
+}
@@ -0,0 +1,104 @@
+package logic
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RFC 4231 test case 1: a 20-byte key of 0x0B bytes over "Hi There".
+const (
+	hmacTestMessage = "Hi There"
+	hmacTestSHA256  = "B0344C61D8DB38535CA8AFCEAF0BF12B881DC200C9833DA726E9376C2E32CFF7"
+)
+
+// wrapTestHMACKey wraps the RFC 4231 test key in a key block under the test key block LMK.
+func wrapTestHMACKey(t *testing.T, usage string, algorithm, modeOfUse byte) string {
+	t.Helper()
+
+	block, err := keyblocklmk.WrapKeyBlock(keyblocklmk.DefaultTestAESLMK, keyblocklmk.Header{
+		Version: '1', KeyUsage: usage, Algorithm: algorithm, ModeOfUse: modeOfUse,
+		KeyVersionNum: "00", Exportability: 'N', KeyContext: 1,
+	}, nil, bytes.Repeat([]byte{0x0B}, 20))
+	require.NoError(t, err)
+
+	return string(block) + ";"
+}
+
+func TestExecuteLQ(t *testing.T) {
+	t.Parallel()
+
+	const variantKey = "0123456789ABCDEFFEDCBA9876543210"
+	key, err := hex.DecodeString(variantKey)
+	require.NoError(t, err)
+	sha1MAC, err := cryptoutils.HMAC(crypto.SHA1, key, []byte(hmacTestMessage))
+	require.NoError(t, err)
+	sha512MAC, err := cryptoutils.HMAC(crypto.SHA512, key, []byte(hmacTestMessage))
+	require.NoError(t, err)
+
+	message := fmt.Sprintf("%05d", len(hmacTestMessage)) + hmacTestMessage
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{
+			name:  "SHA-1 variant key",
+			input: "010020U" + variantKey + message,
+			want:  "LR000020" + cryptoutils.Raw2Str(sha1MAC),
+		},
+		{
+			name:  "SHA-512 truncated, unprefixed key",
+			input: "080032" + variantKey + message,
+			want:  "LR000032" + cryptoutils.Raw2Str(sha512MAC[:32]),
+		},
+		{
+			name:  "SHA-256 key block",
+			input: "060032" + wrapTestHMACKey(t, "M6", 'H', 'G') + message,
+			want:  "LR000032" + hmacTestSHA256,
+		},
+		{
+			name:    "Verify-only key block",
+			input:   "060032" + wrapTestHMACKey(t, "M6", 'H', 'V') + message,
+			wantErr: errorcodes.Err29,
+		},
+		{
+			name:    "Not an HMAC key block",
+			input:   "060032" + wrapTestHMACKey(t, "M6", 'A', 'C') + message,
+			wantErr: errorcodes.Err29,
+		},
+		{name: "Unsupported hash", input: "020016U" + variantKey + message, wantErr: errorcodes.Err15},
+		{name: "HMAC too long", input: "010021U" + variantKey + message, wantErr: errorcodes.Err15},
+		{name: "Zero HMAC length", input: "010000U" + variantKey + message, wantErr: errorcodes.Err15},
+		{
+			name:    "Message length mismatch",
+			input:   "010020U" + variantKey + "00009" + hmacTestMessage,
+			wantErr: errorcodes.Err80,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ExecuteLQ([]byte(tc.input))
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, string(got))
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package logic
+
+import (
+	"fmt"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+)
+
+// ExecuteLS verifies an HMAC over a message and returns response bytes.
+// Format: the LQ request fields up to the HMAC key, followed by HMAC (hex, twice the HMAC
+// length) + Message length (5N) + Message. The HMAC is compared against the leftmost bytes
+// of the calculated HMAC.
+// Response: "LT" + "00".
+func ExecuteLS(input []byte) ([]byte, error) {
+	logInfo("LS: starting HMAC verification")
+
+	req, err := parseHMACRequest("LS", input, 'V')
+	if err != nil {
+		return nil, err
+	}
+	mac, rest, err := parseMAC("LS", req.hmacSize, req.rest)
+	if err != nil {
+		return nil, err
+	}
+	data, err := parseHMACMessage("LS", rest)
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := cryptoutils.VerifyHMAC(req.hash, req.key, data, mac)
+	if err != nil {
+		logError(fmt.Sprintf("LS: failed to calculate HMAC: %v", err))
+		return nil, errorcodes.Err42
+	}
+	if !ok {
+		logError("LS: HMAC verification failed")
+		return nil, errorcodes.Err01
+	}
+	logInfo("LS: HMAC verified")
+
+	return []byte("LT00"), nil
+}
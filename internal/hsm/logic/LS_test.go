@@ -0,0 +1,56 @@
+package logic
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteLS(t *testing.T) {
+	t.Parallel()
+
+	keyBlock := wrapTestHMACKey(t, "M6", 'H', 'V')
+	message := fmt.Sprintf("%05d", len(hmacTestMessage)) + hmacTestMessage
+	tests := []struct {
+		name    string
+		input   string
+		wantErr error
+	}{
+		{name: "Full HMAC", input: "060032" + keyBlock + hmacTestSHA256 + message},
+		{name: "Truncated HMAC", input: "060016" + keyBlock + hmacTestSHA256[:32] + message},
+		{
+			name:    "HMAC mismatch",
+			input:   "060016" + keyBlock + hmacTestSHA256[32:] + message,
+			wantErr: errorcodes.Err01,
+		},
+		{
+			name:    "Generate-only key block",
+			input:   "060032" + wrapTestHMACKey(t, "M6", 'H', 'G') + hmacTestSHA256 + message,
+			wantErr: errorcodes.Err29,
+		},
+		{
+			name:    "Invalid HMAC characters",
+			input:   "060004" + keyBlock + "ZZZZZZZZ" + message,
+			wantErr: errorcodes.Err15,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ExecuteLS([]byte(tc.input))
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "LT00", string(got))
+		})
+	}
+}
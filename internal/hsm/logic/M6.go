@@ -0,0 +1,376 @@
+package logic
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+	"github.com/andrei-cloud/go_hsm/pkg/keyschemes"
+	"github.com/andrei-cloud/go_hsm/pkg/msgspec"
+)
+
+// M6/M8 request flags.
+const (
+	macModeSingleBlock = '0' // the message is the only block.
+	macModeFirstBlock  = '1' // first block of a multi-block message.
+	macModeMiddleBlock = '2' // middle block, chained from an IV.
+	macModeLastBlock   = '3' // last block, chained from an IV.
+	macInputBinary     = '0'
+	macInputHex        = '1'
+	macSize4           = '0' // 8H MAC.
+	macSize8           = '1' // 16H MAC.
+	macAlgorithm1      = '1' // ISO 9797-1 MAC algorithm 1, single-length key.
+	macAlgorithm3      = '3' // ISO 9797-1 MAC algorithm 3 (retail MAC), double-length key.
+	macAlgorithmCMAC   = '5' // ISO 9797-1 MAC algorithm 5 (CMAC).
+	macPaddingNone     = '0' // CMAC pads internally.
+	macKeyTypeTAK      = "003"
+	macKeyTypeZAK      = "008"
+	macKeyTypeKeyBlock = "FFF"
+	macKeyUsageCMAC    = "M6"
+)
+
+// macHeaderFields is the request header shared by M6 and M8.
+var macHeaderFields = []msgspec.Field{
+	msgspec.Fixed("mode", 1, msgspec.EncodingNumeric),
+	msgspec.Fixed("input_format", 1, msgspec.EncodingNumeric),
+	msgspec.Fixed("mac_size", 1, msgspec.EncodingNumeric),
+	msgspec.Fixed("algorithm", 1, msgspec.EncodingNumeric),
+	msgspec.Fixed("padding", 1, msgspec.EncodingNumeric),
+	msgspec.Fixed("key_type", 3, msgspec.EncodingHex),
+}
+
+// m6Spec describes the M6 (Generate MAC) request header.
+var m6Spec = msgspec.Spec{Command: "M6", Fields: macHeaderFields, AllowTrailing: true}
+
+// cmacRequest is a parsed M6 or M8 request.
+type cmacRequest struct {
+	key     []byte // clear AES TAK.
+	macSize int
+	rest    []byte // bytes following the key block.
+}
+
+// isoMACRequest is a parsed ISO 9797-1 MAC algorithm 1 or 3 request with a TAK or ZAK
+// under a variant LMK.
+type isoMACRequest struct {
+	key       []byte // clear DES or TDES key.
+	algorithm int    // 1 or 3.
+	mode      byte   // mode flag.
+	padding   cryptoutils.PadMode
+	macSize   int
+	iv        []byte // chaining value of middle and last blocks.
+	rest      []byte // bytes following the IV.
+}
+
+// ExecuteM6 processes the M6 (Generate MAC) command and returns response bytes.
+// Format: Mode flag (1N) + Input format (1N: 0 binary, 1 hex) + MAC size (1N: 0 8H,
+// 1 16H) + MAC algorithm (1N) + Padding method (1N) + Key type (3H) + Key + Message length
+// (4H) + Message.
+// With MAC algorithm 5 (CMAC), the mode flag and padding method are 0 and the key is a TAK
+// key block of key type FFF (S + block, followed by ';' when the header carries no block
+// length).
+// With MAC algorithm 1 or 3 the key is a TAK (003) or ZAK (008) under the variant LMK (16H
+// single length for algorithm 1, U + 32H for algorithm 3) and the padding method is
+// 0 (none), 1 or 2 (ISO 9797-1). A long message is sent in pieces of whole 8-byte blocks
+// with mode flag 1 (first), 2 (middle) and 3 (last), each piece after the first with the
+// 16H IV returned for the previous one following the key. Mode flags 1 and 2 return the IV
+// in place of the MAC; mode flags 0 and 3 pad the data and return the MAC.
+func ExecuteM6(input []byte) ([]byte, error) {
+	logInfo("M6: starting MAC generation")
+	msg, err := m6Spec.Parse(input)
+	if err != nil {
+		logError(fmt.Sprintf("M6: %v", err))
+		return nil, errorcodes.WithDetail(errorcodes.Err15, err.Error())
+	}
+
+	if isISOMACRequest(msg) {
+		req, err := parseISOMACRequest("M6", msg)
+		if err != nil {
+			return nil, err
+		}
+		data, err := parseMACMessage("M6", msg.Get("input_format")[0], req.rest)
+		if err != nil {
+			return nil, err
+		}
+		mac, err := req.calculate("M6", data)
+		if err != nil {
+			return nil, err
+		}
+		logInfo("M6: MAC generated")
+
+		return append([]byte("M700"), cryptoutils.Raw2B(mac)...), nil
+	}
+
+	req, err := parseCMACRequest("M6", msg, 'G')
+	if err != nil {
+		return nil, err
+	}
+	data, err := parseMACMessage("M6", msg.Get("input_format")[0], req.rest)
+	if err != nil {
+		return nil, err
+	}
+
+	mac, err := cryptoutils.CMAC(data, req.key, req.macSize)
+	if err != nil {
+		logError(fmt.Sprintf("M6: failed to calculate MAC: %v", err))
+		return nil, errorcodes.Err42
+	}
+	logInfo("M6: MAC generated")
+
+	resp := []byte("M700")
+
+	return append(resp, cryptoutils.Raw2B(mac)...), nil
+}
+
+// parseCMACRequest validates the request header and unwraps the TAK key block, which must
+// be an AES CMAC key whose mode of use permits the operation (G generate, V verify).
+func parseCMACRequest(cmd string, msg *msgspec.Message, modeOfUse byte) (*cmacRequest, error) {
+	if msg.Get("mode")[0] != macModeSingleBlock {
+		logError(cmd + ": unsupported mode flag")
+		return nil, errorcodes.Err15
+	}
+	if f := msg.Get("input_format")[0]; f != macInputBinary && f != macInputHex {
+		logError(cmd + ": unsupported input format")
+		return nil, errorcodes.Err15
+	}
+	if msg.Get("algorithm")[0] != macAlgorithmCMAC {
+		logError(cmd + ": unsupported MAC algorithm")
+		return nil, errorcodes.Err15
+	}
+	if msg.Get("padding")[0] != macPaddingNone {
+		logError(cmd + ": unsupported padding method")
+		return nil, errorcodes.Err15
+	}
+
+	req := &cmacRequest{}
+	switch msg.Get("mac_size")[0] {
+	case macSize4:
+		req.macSize = 4
+	case macSize8:
+		req.macSize = 8
+	default:
+		logError(cmd + ": invalid MAC size")
+		return nil, errorcodes.Err15
+	}
+
+	if !strings.EqualFold(msg.Get("key_type"), macKeyTypeKeyBlock) {
+		logError(cmd + ": key type must be FFF for key block keys")
+		return nil, errorcodes.Err04
+	}
+
+	rest := msg.Rest()
+	if len(rest) == 0 || rest[0] != 'S' {
+		logError(cmd + ": TAK must be a key block")
+		return nil, errorcodes.Err26
+	}
+	block, rest, err := keyblocklmk.SplitKeyBlock(rest)
+	if err != nil {
+		logError(fmt.Sprintf("%s: %v", cmd, err))
+		return nil, errorcodes.Err83
+	}
+	header, err := keyblocklmk.ParseHeader(block)
+	if err != nil {
+		logError(fmt.Sprintf("%s: %v", cmd, err))
+		return nil, errorcodes.Err83
+	}
+	if header.KeyUsage != macKeyUsageCMAC || header.Algorithm != 'A' {
+		logError(fmt.Sprintf("%s: key usage %s algorithm %c is not an AES CMAC key",
+			cmd, header.KeyUsage, header.Algorithm))
+		return nil, errorcodes.Err29
+	}
+	if header.ModeOfUse != 'C' && header.ModeOfUse != modeOfUse {
+		logError(fmt.Sprintf("%s: mode of use %c not permitted", cmd, header.ModeOfUse))
+		return nil, errorcodes.Err29
+	}
+
+	logInfo(cmd + ": unwrapping TAK key block under LMK")
+	req.key, err = LMKProviderInstance.DecryptUnderLMK(block, macKeyTypeKeyBlock, 'S')
+	if err != nil {
+		logError(cmd + ": TAK key block unwrap failed")
+		return nil, errorcodes.Err68
+	}
+	if n := len(req.key); n != 16 && n != 24 && n != 32 {
+		logError(fmt.Sprintf("%s: invalid AES key length %d", cmd, n))
+		return nil, errorcodes.Err27
+	}
+	req.rest = rest
+
+	return req, nil
+}
+
+// parseMACMessage reads the message length and message, decoding hex input.
+func parseMACMessage(cmd string, inputFormat byte, rest []byte) ([]byte, error) {
+	if len(rest) < 4 {
+		logError(cmd + ": input too short for message length")
+		return nil, errorcodes.Err15
+	}
+	msgLen, err := strconv.ParseUint(string(rest[:4]), 16, 16)
+	if err != nil {
+		logError(cmd + ": invalid message length")
+		return nil, errorcodes.Err80
+	}
+	data := rest[4:]
+	if msgLen == 0 || len(data) != int(msgLen) {
+		logError(cmd + ": message length mismatch")
+		return nil, errorcodes.Err80
+	}
+
+	if inputFormat == macInputHex {
+		data, err = hex.DecodeString(string(data))
+		if err != nil {
+			logError(cmd + ": invalid hex message")
+			return nil, errorcodes.Err15
+		}
+	}
+
+	return data, nil
+}
+
+// isISOMACRequest reports whether an M6 or M8 request uses ISO 9797-1 MAC algorithm 1 or 3
+// with a variant TAK or ZAK. Other requests are CMAC requests.
+func isISOMACRequest(msg *msgspec.Message) bool {
+	algorithm := msg.Get("algorithm")[0]
+	keyType := msg.Get("key_type")
+
+	return (algorithm == macAlgorithm1 || algorithm == macAlgorithm3) &&
+		(keyType == macKeyTypeTAK || keyType == macKeyTypeZAK)
+}
+
+// parseISOMACRequest validates an ISO 9797-1 MAC algorithm 1 or 3 request header and
+// decrypts the key and reads the IV that follow it.
+func parseISOMACRequest(cmd string, msg *msgspec.Message) (*isoMACRequest, error) {
+	req := &isoMACRequest{
+		algorithm: int(msg.Get("algorithm")[0] - '0'),
+		mode:      msg.Get("mode")[0],
+	}
+	if req.mode < macModeSingleBlock || req.mode > macModeLastBlock {
+		logError(cmd + ": invalid mode flag")
+		return nil, errorcodes.Err15
+	}
+	if f := msg.Get("input_format")[0]; f != macInputBinary && f != macInputHex {
+		logError(cmd + ": unsupported input format")
+		return nil, errorcodes.Err15
+	}
+	switch p := cryptoutils.PadMode(msg.Get("padding")[0]); p {
+	case cryptoutils.PadModeNone, cryptoutils.PadModeISO9797Method1,
+		cryptoutils.PadModeISO9797Method2:
+		req.padding = p
+	default:
+		logError(cmd + ": unsupported padding method")
+		return nil, errorcodes.Err15
+	}
+	switch msg.Get("mac_size")[0] {
+	case macSize4:
+		req.macSize = 4
+	case macSize8:
+		req.macSize = 8
+	default:
+		logError(cmd + ": invalid MAC size")
+		return nil, errorcodes.Err15
+	}
+
+	key, rest, err := parseISOMACKey(cmd, msg.Get("key_type"), req.algorithm, msg.Rest())
+	if err != nil {
+		return nil, err
+	}
+	req.key = key
+	req.iv, req.rest, err = parseMACIV(cmd, req.mode, rest)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// parseISOMACKey reads the TAK or ZAK under the variant LMK at the start of data, decrypts
+// it and checks its length against the MAC algorithm: single length for algorithm 1 and
+// double length for algorithm 3.
+func parseISOMACKey(cmd, keyType string, algorithm int, data []byte) ([]byte, []byte, error) {
+	key, rest, err := keyschemes.Parse(data, "UT", 16)
+	if err != nil {
+		logError(fmt.Sprintf("%s: invalid MAC key: %v", cmd, err))
+		return nil, nil, errorcodes.Err15
+	}
+	keyRaw, err := key.Bytes()
+	if err != nil {
+		logError(cmd + ": invalid MAC key hex format")
+		return nil, nil, errorcodes.Err15
+	}
+	if (algorithm == 1 && len(keyRaw) != 8) || (algorithm == 3 && len(keyRaw) != 16) {
+		logError(fmt.Sprintf("%s: %d byte key incompatible with MAC algorithm %d",
+			cmd, len(keyRaw), algorithm))
+		return nil, nil, errorcodes.Err27
+	}
+
+	scheme := key.Scheme
+	if scheme == 0 {
+		scheme = keyschemes.SchemeX
+	}
+	logInfo(cmd + ": decrypting MAC key under LMK")
+	clearKey, err := LMKProviderInstance.DecryptUnderLMK(keyRaw, keyType, scheme)
+	if err != nil {
+		logError(cmd + ": MAC key decryption failed")
+		return nil, nil, errorcodes.Err68
+	}
+	if !cryptoutils.CheckKeyParity(clearKey) {
+		logError(cmd + ": MAC key parity check failed")
+		return nil, nil, errorcodes.Err10
+	}
+
+	return clearKey, rest, nil
+}
+
+// parseMACIV reads the 16H IV that precedes the middle and last blocks of a message.
+func parseMACIV(cmd string, mode byte, data []byte) ([]byte, []byte, error) {
+	if mode != macModeMiddleBlock && mode != macModeLastBlock {
+		return nil, data, nil
+	}
+	if len(data) < 16 {
+		logError(cmd + ": input too short for IV")
+		return nil, nil, errorcodes.Err15
+	}
+	iv, err := hex.DecodeString(string(data[:16]))
+	if err != nil {
+		logError(cmd + ": invalid IV format")
+		return nil, nil, errorcodes.Err15
+	}
+
+	return iv, data[16:], nil
+}
+
+// calculate MACs data, the whole message or the block given by the mode flag. The first and
+// middle blocks of a message return the 8-byte IV for the next block; the only and last
+// blocks are padded and return the MAC.
+func (r *isoMACRequest) calculate(cmd string, data []byte) ([]byte, error) {
+	final := r.mode == macModeSingleBlock || r.mode == macModeLastBlock
+	if final {
+		var err error
+		data, err = cryptoutils.Pad(data, 8, r.padding)
+		if err != nil {
+			logError(fmt.Sprintf("%s: %v", cmd, err))
+			return nil, errorcodes.Err80
+		}
+	} else if len(data)%8 != 0 {
+		logError(cmd + ": message block is not a multiple of 8 bytes")
+		return nil, errorcodes.Err80
+	}
+
+	h, err := cryptoutils.CBCMACChain(data, r.key[:8], r.iv)
+	if err != nil {
+		logError(fmt.Sprintf("%s: failed to calculate MAC: %v", cmd, err))
+		return nil, errorcodes.Err42
+	}
+	if !final {
+		return h, nil
+	}
+	mac, err := cryptoutils.CBCMACFinal(h, r.key, r.algorithm)
+	if err != nil {
+		logError(fmt.Sprintf("%s: failed to calculate MAC: %v", cmd, err))
+		return nil, errorcodes.Err42
+	}
+
+	return mac[:r.macSize], nil
+}
@@ -0,0 +1,204 @@
+package logic
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// NIST SP 800-38B AES-128 CMAC example 2.
+const (
+	cmacTestKey     = "2B7E151628AED2A6ABF7158809CF4F3C"
+	cmacTestMessage = "6BC1BEE22E409F96E93D7E117393172A"
+	cmacTestMAC     = "070A16B46B4D4144F79BDD9DD04A287C"
+)
+
+// wrapTestTAK wraps the CMAC test key in a key block under the test key block LMK.
+func wrapTestTAK(t *testing.T, usage string, algorithm, modeOfUse byte, strict bool) string {
+	t.Helper()
+
+	key, _ := hex.DecodeString(cmacTestKey)
+	header := keyblocklmk.Header{
+		Version:       '1',
+		KeyUsage:      usage,
+		Algorithm:     algorithm,
+		ModeOfUse:     modeOfUse,
+		KeyVersionNum: "00",
+		Exportability: 'N',
+		KeyContext:    1,
+	}
+	block, err := keyblocklmk.WrapKeyBlockWithOptions(keyblocklmk.DefaultTestAESLMK, header, nil, key,
+		keyblocklmk.WrapOptions{StrictCompat: strict})
+	require.NoError(t, err)
+	if !strict {
+		return string(block) + ";"
+	}
+
+	return string(block)
+}
+
+func TestExecuteM6(t *testing.T) {
+	t.Parallel()
+
+	// Initialize the test LMK provider.
+	if err := SetupTestLMKProvider(); err != nil {
+		t.Fatalf("Failed to setup test LMK provider: %v", err)
+	}
+
+	tak := wrapTestTAK(t, "M6", 'A', 'C', true)
+	delimited := wrapTestTAK(t, "M6", 'A', 'G', false)
+	hexMessage := "0020" + cmacTestMessage
+	binMessage := "0010" + string(mustDecodeHex(cmacTestMessage))
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{
+			name:  "Hex input, 16H MAC",
+			input: "01150FFF" + tak + hexMessage,
+			want:  "M700" + cmacTestMAC[:16],
+		},
+		{
+			name:  "Binary input, 8H MAC, delimited key block",
+			input: "00050FFF" + delimited + binMessage,
+			want:  "M700" + cmacTestMAC[:8],
+		},
+		{
+			name:    "Short input",
+			input:   "0115",
+			wantErr: errorcodes.Err15,
+		},
+		{
+			name:    "Unsupported algorithm",
+			input:   "01130FFF" + tak + hexMessage,
+			wantErr: errorcodes.Err15,
+		},
+		{
+			name:    "Invalid key type",
+			input:   "01150003" + tak + hexMessage,
+			wantErr: errorcodes.Err04,
+		},
+		{
+			name:    "Variant key",
+			input:   "01150FFFU" + cmacTestKey + hexMessage,
+			wantErr: errorcodes.Err26,
+		},
+		{
+			name:    "Key block without length or delimiter",
+			input:   "01150FFF" + delimited[:len(delimited)-1] + hexMessage,
+			wantErr: errorcodes.Err83,
+		},
+		{
+			name:    "Wrong key usage",
+			input:   "01150FFF" + wrapTestTAK(t, "K0", 'A', 'C', true) + hexMessage,
+			wantErr: errorcodes.Err29,
+		},
+		{
+			name:    "Verify-only key",
+			input:   "01150FFF" + wrapTestTAK(t, "M6", 'A', 'V', true) + hexMessage,
+			wantErr: errorcodes.Err29,
+		},
+		{
+			name:    "Message length mismatch",
+			input:   "01150FFF" + tak + "0021" + cmacTestMessage,
+			wantErr: errorcodes.Err80,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ExecuteM6([]byte(tc.input))
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, string(got))
+		})
+	}
+}
+
+func TestExecuteM6ISO9797(t *testing.T) {
+	t.Parallel()
+
+	const (
+		singleKey = "0123456789ABCDEF"
+		doubleKey = "U0123456789ABCDEFFEDCBA9876543210"
+		x99MAC    = "70A30640CC76DD8B"
+		x919MAC   = "A1C72E74EA3FA9B6"
+	)
+	data := "Now is the time for all "
+	message := fmt.Sprintf("%04X", len(data)) + data
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{name: "Algorithm 1 TAK", input: "00111003" + singleKey + message, want: "M700" + x99MAC},
+		{name: "Algorithm 3 ZAK", input: "00131008" + doubleKey + message, want: "M700" + x919MAC},
+		{name: "Algorithm 3, 8H MAC", input: "00030003" + doubleKey + message, want: "M700" + x919MAC[:8]},
+		{name: "Algorithm 3 with single length key", input: "00131003" + singleKey + message, wantErr: errorcodes.Err27},
+		{name: "Algorithm 1 with double length key", input: "00111003" + doubleKey + message, wantErr: errorcodes.Err27},
+		{name: "Key parity error", input: "00131003U" + strings.Repeat("0", 32) + message, wantErr: errorcodes.Err10},
+		{name: "Unsupported padding", input: "00133003" + doubleKey + message, wantErr: errorcodes.Err15},
+		{name: "Invalid mode flag", input: "40131003" + doubleKey + message, wantErr: errorcodes.Err15},
+		{name: "Unpadded partial block", input: "00130003" + doubleKey + "0005Now i", wantErr: errorcodes.Err80},
+		{name: "Partial middle block", input: "20131003" + doubleKey + x919MAC + "0005Now i", wantErr: errorcodes.Err80},
+		{name: "Missing IV", input: "30131003" + doubleKey, wantErr: errorcodes.Err15},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ExecuteM6([]byte(tc.input))
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, string(got))
+		})
+	}
+
+	t.Run("Chained blocks", func(t *testing.T) {
+		t.Parallel()
+
+		first, err := ExecuteM6([]byte("10131003" + doubleKey + "0008" + data[:8]))
+		require.NoError(t, err)
+		require.Len(t, first, 4+16)
+		iv := string(first[4:])
+		middle, err := ExecuteM6([]byte("20131003" + doubleKey + iv + "0008" + data[8:16]))
+		require.NoError(t, err)
+		iv = string(middle[4:])
+		last, err := ExecuteM6([]byte("30131003" + doubleKey + iv + "0008" + data[16:]))
+		require.NoError(t, err)
+		assert.Equal(t, "M700"+x919MAC, string(last))
+	})
+}
+
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return b
+}
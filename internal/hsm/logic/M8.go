@@ -0,0 +1,125 @@
+package logic
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/msgspec"
+)
+
+// m8Spec describes the M8 (Verify MAC) request header.
+var m8Spec = msgspec.Spec{Command: "M8", Fields: macHeaderFields, AllowTrailing: true}
+
+// ExecuteM8 processes the M8 (Verify MAC) command and returns response bytes.
+// Format: the M6 request fields up to the key (and the IV of middle and last blocks),
+// followed by MAC (8H or 16H, per MAC size) + Message length (4H) + Message.
+// The first and middle blocks of a message chained with MAC algorithm 1 or 3 carry no MAC
+// and return the 16H IV for the next block, as M6 does; the MAC of the last block is
+// verified.
+func ExecuteM8(input []byte) ([]byte, error) {
+	logInfo("M8: starting MAC verification")
+	msg, err := m8Spec.Parse(input)
+	if err != nil {
+		logError(fmt.Sprintf("M8: %v", err))
+		return nil, errorcodes.WithDetail(errorcodes.Err15, err.Error())
+	}
+
+	if isISOMACRequest(msg) {
+		return verifyISOMAC(msg)
+	}
+
+	req, err := parseCMACRequest("M8", msg, 'V')
+	if err != nil {
+		return nil, err
+	}
+
+	mac, rest, err := parseMAC("M8", req.macSize, req.rest)
+	if err != nil {
+		return nil, err
+	}
+	data, err := parseMACMessage("M8", msg.Get("input_format")[0], rest)
+	if err != nil {
+		return nil, err
+	}
+
+	calculated, err := cryptoutils.CMAC(data, req.key, req.macSize)
+	if err != nil {
+		logError(fmt.Sprintf("M8: failed to calculate MAC: %v", err))
+		return nil, errorcodes.Err42
+	}
+	if subtle.ConstantTimeCompare(mac, calculated) != 1 {
+		logError("M8: MAC verification failed")
+		return nil, errorcodes.Err01
+	}
+	logInfo("M8: MAC verified")
+
+	return []byte("M900"), nil
+}
+
+// verifyISOMAC handles M8 for ISO 9797-1 MAC algorithm 1 and 3 requests.
+func verifyISOMAC(msg *msgspec.Message) ([]byte, error) {
+	req, err := parseISOMACRequest("M8", msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return verifyChainedMAC("M8", "M9", req, msg.Get("input_format")[0])
+}
+
+// verifyChainedMAC reads the MAC and message block that follow the key and IV of req and
+// verifies the MAC, or returns the IV for the next block of a first or middle block, which
+// carries no MAC.
+func verifyChainedMAC(cmd, respCode string, req *isoMACRequest, inputFormat byte) ([]byte, error) {
+	var (
+		mac []byte
+		err error
+	)
+	rest := req.rest
+	chained := req.mode == macModeFirstBlock || req.mode == macModeMiddleBlock
+	if !chained {
+		mac, rest, err = parseMAC(cmd, req.macSize, rest)
+		if err != nil {
+			return nil, err
+		}
+	}
+	data, err := parseMACMessage(cmd, inputFormat, rest)
+	if err != nil {
+		return nil, err
+	}
+
+	calculated, err := req.calculate(cmd, data)
+	if err != nil {
+		return nil, err
+	}
+	resp := []byte(respCode + errorcodes.Err00.CodeOnly())
+	if chained {
+		logInfo(cmd + ": message block chained")
+
+		return append(resp, cryptoutils.Raw2B(calculated)...), nil
+	}
+	if subtle.ConstantTimeCompare(mac, calculated) != 1 {
+		logError(cmd + ": MAC verification failed")
+		return nil, errorcodes.Err01
+	}
+	logInfo(cmd + ": MAC verified")
+
+	return resp, nil
+}
+
+// parseMAC reads a MAC of macSize bytes in hex at the start of data.
+func parseMAC(cmd string, macSize int, data []byte) ([]byte, []byte, error) {
+	if len(data) < 2*macSize {
+		logError(cmd + ": input too short for MAC")
+		return nil, nil, errorcodes.Err15
+	}
+	mac, err := hex.DecodeString(string(data[:2*macSize]))
+	if err != nil {
+		logError(cmd + ": invalid MAC format")
+		return nil, nil, errorcodes.Err15
+	}
+
+	return mac, data[2*macSize:], nil
+}
@@ -0,0 +1,100 @@
+package logic
+
+import (
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteM8(t *testing.T) {
+	t.Parallel()
+
+	// Initialize the test LMK provider.
+	if err := SetupTestLMKProvider(); err != nil {
+		t.Fatalf("Failed to setup test LMK provider: %v", err)
+	}
+
+	tak := wrapTestTAK(t, "M6", 'A', 'V', true)
+	hexMessage := "0020" + cmacTestMessage
+
+	const (
+		doubleKey = "U0123456789ABCDEFFEDCBA9876543210"
+		x919MAC   = "A1C72E74EA3FA9B6"
+	)
+	data := "Now is the time for all "
+	iv, err := cryptoutils.CBCMACChain([]byte(data[:8]), mustDecodeHex(doubleKey[1:17]), nil)
+	require.NoError(t, err)
+	ivHex := cryptoutils.Raw2Str(iv)
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{
+			name:  "16H MAC",
+			input: "01150FFF" + tak + cmacTestMAC[:16] + hexMessage,
+			want:  "M900",
+		},
+		{
+			name:  "8H MAC",
+			input: "01050FFF" + tak + cmacTestMAC[:8] + hexMessage,
+			want:  "M900",
+		},
+		{
+			name:    "MAC mismatch",
+			input:   "01150FFF" + tak + cmacTestMAC[16:] + hexMessage,
+			wantErr: errorcodes.Err01,
+		},
+		{
+			name:    "Generate-only key",
+			input:   "01150FFF" + wrapTestTAK(t, "M6", 'A', 'G', true) + cmacTestMAC[:16] + hexMessage,
+			wantErr: errorcodes.Err29,
+		},
+		{
+			name:    "Invalid MAC characters",
+			input:   "01150FFF" + tak + "ZZZZZZZZZZZZZZZZ" + hexMessage,
+			wantErr: errorcodes.Err15,
+		},
+		{
+			name:  "Algorithm 3 ZAK",
+			input: "00131008" + doubleKey + x919MAC + "0018" + data,
+			want:  "M900",
+		},
+		{
+			name:    "Algorithm 3 MAC mismatch",
+			input:   "00131008" + doubleKey + x919MAC[8:] + x919MAC[:8] + "0018" + data,
+			wantErr: errorcodes.Err01,
+		},
+		{
+			name:  "First block returns IV",
+			input: "10131003" + doubleKey + "0008" + data[:8],
+			want:  "M900" + ivHex,
+		},
+		{
+			name:  "Last block",
+			input: "30131003" + doubleKey + ivHex + x919MAC + "0010" + data[8:],
+			want:  "M900",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ExecuteM8([]byte(tc.input))
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, string(got))
+		})
+	}
+}
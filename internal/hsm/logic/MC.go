@@ -0,0 +1,132 @@
+package logic
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/msgspec"
+)
+
+// MC MAC algorithms.
+const (
+	mcAlgorithmX99  = '1' // ANSI X9.9, single-length key.
+	mcAlgorithmX919 = '3' // ANSI X9.19 retail MAC, double-length key.
+)
+
+// mcSpec describes the MC (Verify MAC) request header.
+var mcSpec = msgspec.Spec{
+	Command: "MC",
+	Fields: []msgspec.Field{
+		msgspec.Fixed("key_type", 3, msgspec.EncodingNumeric),
+		msgspec.Fixed("algorithm", 1, msgspec.EncodingNumeric),
+		msgspec.Fixed("mac_size", 1, msgspec.EncodingNumeric),
+		msgspec.Key("key", "U", 16),
+	},
+	AllowTrailing: true,
+}
+
+// ExecuteMC processes the MC (Verify MAC) command and returns response bytes.
+// Format: Key type (3N: 003 TAK, 008 ZAK) + MAC algorithm (1N: 1 X9.9, 3 X9.19) +
+// MAC size (1N: 4 or 8 bytes) + Key (16H single length, or U + 32H) +
+// MAC (8H or 16H, per MAC size) + Message length (4H) + Message.
+// A MAC of 4 bytes is compared against the leftmost 4 bytes of the calculated MAC.
+func ExecuteMC(input []byte) ([]byte, error) {
+	logInfo("MC: starting MAC verification")
+	msg, err := mcSpec.Parse(input)
+	if err != nil {
+		logError(fmt.Sprintf("MC: %v", err))
+		return nil, errorcodes.WithDetail(errorcodes.Err15, err.Error())
+	}
+
+	keyType := msg.Get("key_type")
+	if keyType != "003" && keyType != "008" {
+		logError("MC: invalid key type")
+		return nil, errorcodes.Err04
+	}
+
+	algorithm := msg.Get("algorithm")[0]
+	if algorithm != mcAlgorithmX99 && algorithm != mcAlgorithmX919 {
+		logError("MC: unsupported MAC algorithm")
+		return nil, errorcodes.Err15
+	}
+
+	macSize := int(msg.Get("mac_size")[0] - '0')
+	if macSize != 4 && macSize != 8 {
+		logError("MC: invalid MAC size")
+		return nil, errorcodes.Err15
+	}
+
+	rest := msg.Rest()
+	if len(rest) < 2*macSize+4 {
+		logError("MC: input too short for MAC and message length")
+		return nil, errorcodes.Err15
+	}
+	mac, err := hex.DecodeString(string(rest[:2*macSize]))
+	if err != nil {
+		logError("MC: invalid MAC format")
+		return nil, errorcodes.Err15
+	}
+	rest = rest[2*macSize:]
+
+	msgLen, err := strconv.ParseUint(string(rest[:4]), 16, 16)
+	if err != nil {
+		logError("MC: invalid message length")
+		return nil, errorcodes.Err80
+	}
+	data := rest[4:]
+	if len(data) != int(msgLen) {
+		logError("MC: message length mismatch")
+		return nil, errorcodes.Err80
+	}
+
+	key, _ := msg.Value("key")
+	keyRaw, err := hex.DecodeString(key.Data)
+	if err != nil {
+		logError("MC: invalid key hex format")
+		return nil, errorcodes.Err15
+	}
+	if (algorithm == mcAlgorithmX99) != (len(keyRaw) == 8) {
+		logError("MC: key length incompatible with MAC algorithm")
+		return nil, errorcodes.Err27
+	}
+
+	scheme := key.Scheme
+	if scheme == 0 {
+		scheme = 'X'
+	}
+	logInfo("MC: decrypting MAC key under LMK")
+	clearKey, err := LMKProviderInstance.DecryptUnderLMK(keyRaw, keyType, scheme)
+	if err != nil {
+		logError("MC: MAC key decryption failed")
+		return nil, errorcodes.Err68
+	}
+	if !cryptoutils.CheckKeyParity(clearKey) {
+		logError("MC: MAC key parity check failed")
+		return nil, errorcodes.Err10
+	}
+
+	var calculated []byte
+	if algorithm == mcAlgorithmX99 {
+		calculated, err = cryptoutils.X99MAC(data, clearKey)
+	} else {
+		calculated, err = cryptoutils.X919MAC(data, clearKey)
+	}
+	if err != nil {
+		logError(fmt.Sprintf("MC: failed to calculate MAC: %v", err))
+		return nil, errorcodes.Err42
+	}
+	logDebug(fmt.Sprintf("MC: calculated MAC: %s", strings.ToUpper(hex.EncodeToString(calculated))))
+
+	if subtle.ConstantTimeCompare(mac, calculated[:macSize]) != 1 {
+		logError("MC: MAC verification failed")
+		return nil, errorcodes.Err01
+	}
+	logInfo("MC: MAC verified")
+
+	return []byte("MD00"), nil
+}
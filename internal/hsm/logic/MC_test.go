@@ -0,0 +1,117 @@
+package logic
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecuteMC(t *testing.T) {
+	t.Parallel()
+
+	// Initialize the test LMK provider.
+	if err := SetupTestLMKProvider(); err != nil {
+		t.Fatalf("Failed to setup test LMK provider: %v", err)
+	}
+
+	const (
+		singleKey    = "0123456789ABCDEF"
+		doubleKey    = "U0123456789ABCDEFFEDCBA9876543210"
+		badParityKey = "U00000000000000000000000000000000"
+		x99MAC       = "70A30640CC76DD8B"
+		x919MAC      = "A1C72E74EA3FA9B6"
+	)
+	data := "Now is the time for all "
+	message := fmt.Sprintf("%04X", len(data)) + data
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{
+			name:    "Short input",
+			input:   "0031",
+			wantErr: errorcodes.Err15,
+		},
+		{
+			name:  "X9.9 with TAK, 8 byte MAC",
+			input: "00318" + singleKey + x99MAC + message,
+			want:  "MD00",
+		},
+		{
+			name:  "X9.9 with ZAK, 4 byte MAC",
+			input: "00814" + singleKey + x99MAC[:8] + message,
+			want:  "MD00",
+		},
+		{
+			name:  "X9.19 with TAK, 8 byte MAC",
+			input: "00338" + doubleKey + x919MAC + message,
+			want:  "MD00",
+		},
+		{
+			name:  "X9.19 with ZAK, 4 byte MAC",
+			input: "00834" + doubleKey + x919MAC[:8] + message,
+			want:  "MD00",
+		},
+		{
+			name:    "MAC mismatch",
+			input:   "00338" + doubleKey + x99MAC + message,
+			wantErr: errorcodes.Err01,
+		},
+		{
+			name:    "Truncated MAC mismatch",
+			input:   "00334" + doubleKey + x919MAC[8:] + message,
+			wantErr: errorcodes.Err01,
+		},
+		{
+			name:    "Invalid key type",
+			input:   "00138" + doubleKey + x919MAC + message,
+			wantErr: errorcodes.Err04,
+		},
+		{
+			name:    "Unsupported algorithm",
+			input:   "00328" + doubleKey + x919MAC + message,
+			wantErr: errorcodes.Err15,
+		},
+		{
+			name:    "Invalid MAC size",
+			input:   "00336" + doubleKey + x919MAC + message,
+			wantErr: errorcodes.Err15,
+		},
+		{
+			name:    "X9.9 with double length key",
+			input:   "00318" + doubleKey + x99MAC + message,
+			wantErr: errorcodes.Err27,
+		},
+		{
+			name:    "Key parity error",
+			input:   "00338" + badParityKey + x919MAC + message,
+			wantErr: errorcodes.Err10,
+		},
+		{
+			name:    "Message length mismatch",
+			input:   "00338" + doubleKey + x919MAC + "0019" + data,
+			wantErr: errorcodes.Err80,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ExecuteMC([]byte(tc.input))
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, string(got))
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package logic
+
+import (
+	"fmt"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/msgspec"
+)
+
+// MS/MV request flags.
+const (
+	msKeyTypeTAK    = '0'
+	msKeyTypeZAK    = '1'
+	msKeyLengthDES  = '0' // single length, ANSI X9.9.
+	msKeyLengthTDES = '1' // double length, ANSI X9.19.
+)
+
+// largeMACFields is the request header shared by MS and MV.
+var largeMACFields = []msgspec.Field{
+	msgspec.Fixed("mode", 1, msgspec.EncodingNumeric),
+	msgspec.Fixed("key_type", 1, msgspec.EncodingNumeric),
+	msgspec.Fixed("key_length", 1, msgspec.EncodingNumeric),
+	msgspec.Fixed("input_format", 1, msgspec.EncodingNumeric),
+}
+
+// msSpec describes the MS (Generate MAC on a large message) request header.
+var msSpec = msgspec.Spec{Command: "MS", Fields: largeMACFields, AllowTrailing: true}
+
+// ExecuteMS processes the MS (Generate MAC on a large message) command and returns
+// response bytes. The MAC is an ANSI X9.9 MAC (ISO 9797-1 MAC algorithm 1) for a single
+// length key and an ANSI X9.19 retail MAC (MAC algorithm 3) for a double length key, with
+// zero padding (padding method 1).
+// Format: Message block number (1N: 0 only, 1 first, 2 middle, 3 last) + Key type (1N: 0 TAK,
+// 1 ZAK) + Key length (1N: 0 single, 1 double) + Message type (1N: 0 binary, 1 hex) + Key
+// (16H, or U + 32H) + IV (16H, middle and last blocks) + Message length (4H) + Message block.
+// Blocks other than the last are whole 8-byte blocks.
+// Response: "MT" + "00" + MAC (16H), or the IV for the next block for first and middle
+// blocks.
+func ExecuteMS(input []byte) ([]byte, error) {
+	logInfo("MS: starting MAC generation on a large message")
+	msg, err := msSpec.Parse(input)
+	if err != nil {
+		logError(fmt.Sprintf("MS: %v", err))
+		return nil, errorcodes.WithDetail(errorcodes.Err15, err.Error())
+	}
+
+	req, err := parseLargeMACRequest("MS", msg)
+	if err != nil {
+		return nil, err
+	}
+	data, err := parseMACMessage("MS", msg.Get("input_format")[0], req.rest)
+	if err != nil {
+		return nil, err
+	}
+	mac, err := req.calculate("MS", data)
+	if err != nil {
+		return nil, err
+	}
+	logInfo("MS: MAC generated")
+
+	return append([]byte("MT00"), cryptoutils.Raw2B(mac)...), nil
+}
+
+// parseLargeMACRequest validates an MS or MV request header and decrypts the key and reads
+// the IV that follow it.
+func parseLargeMACRequest(cmd string, msg *msgspec.Message) (*isoMACRequest, error) {
+	req := &isoMACRequest{
+		mode:    msg.Get("mode")[0],
+		padding: cryptoutils.PadModeISO9797Method1,
+		macSize: 8,
+	}
+	if req.mode < macModeSingleBlock || req.mode > macModeLastBlock {
+		logError(cmd + ": invalid message block number")
+		return nil, errorcodes.Err15
+	}
+	if f := msg.Get("input_format")[0]; f != macInputBinary && f != macInputHex {
+		logError(cmd + ": unsupported message type")
+		return nil, errorcodes.Err15
+	}
+
+	var keyType string
+	switch msg.Get("key_type")[0] {
+	case msKeyTypeTAK:
+		keyType = macKeyTypeTAK
+	case msKeyTypeZAK:
+		keyType = macKeyTypeZAK
+	default:
+		logError(cmd + ": invalid key type")
+		return nil, errorcodes.Err04
+	}
+	switch msg.Get("key_length")[0] {
+	case msKeyLengthDES:
+		req.algorithm = 1
+	case msKeyLengthTDES:
+		req.algorithm = 3
+	default:
+		logError(cmd + ": invalid key length flag")
+		return nil, errorcodes.Err15
+	}
+
+	key, rest, err := parseISOMACKey(cmd, keyType, req.algorithm, msg.Rest())
+	if err != nil {
+		return nil, err
+	}
+	req.key = key
+	req.iv, req.rest, err = parseMACIV(cmd, req.mode, rest)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
@@ -0,0 +1,69 @@
+package logic
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteMS(t *testing.T) {
+	t.Parallel()
+
+	const (
+		singleKey = "0123456789ABCDEF"
+		doubleKey = "U0123456789ABCDEFFEDCBA9876543210"
+		x99MAC    = "70A30640CC76DD8B"
+		x919MAC   = "A1C72E74EA3FA9B6"
+	)
+	data := "Now is the time for all "
+	message := fmt.Sprintf("%04X", len(data)) + data
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{name: "X9.9 with TAK", input: "0000" + singleKey + message, want: "MT00" + x99MAC},
+		{name: "X9.19 with ZAK", input: "0110" + doubleKey + message, want: "MT00" + x919MAC},
+		{
+			name:  "X9.19 hex message",
+			input: "0011" + doubleKey + "0030" + fmt.Sprintf("%X", data),
+			want:  "MT00" + x919MAC,
+		},
+		{name: "Invalid key type", input: "0210" + doubleKey + message, wantErr: errorcodes.Err04},
+		{name: "Key length mismatch", input: "0010" + singleKey + message, wantErr: errorcodes.Err27},
+		{name: "Invalid block number", input: "5010" + doubleKey + message, wantErr: errorcodes.Err15},
+		{name: "Message length mismatch", input: "0010" + doubleKey + "0019" + data, wantErr: errorcodes.Err80},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ExecuteMS([]byte(tc.input))
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, string(got))
+		})
+	}
+
+	t.Run("Chained blocks", func(t *testing.T) {
+		t.Parallel()
+
+		first, err := ExecuteMS([]byte("1010" + doubleKey + "0010" + data[:16]))
+		require.NoError(t, err)
+		require.Len(t, first, 4+16)
+		last, err := ExecuteMS([]byte("3010" + doubleKey + string(first[4:]) + "0008" + data[16:]))
+		require.NoError(t, err)
+		assert.Equal(t, "MT00"+x919MAC, string(last))
+	})
+}
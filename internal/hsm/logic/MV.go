@@ -0,0 +1,33 @@
+package logic
+
+import (
+	"fmt"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/msgspec"
+)
+
+// mvSpec describes the MV (Verify MAC on a large message) request header.
+var mvSpec = msgspec.Spec{Command: "MV", Fields: largeMACFields, AllowTrailing: true}
+
+// ExecuteMV processes the MV (Verify MAC on a large message) command and returns response
+// bytes.
+// Format: the MS request fields up to the key (and the IV of middle and last blocks),
+// followed by MAC (16H, only and last blocks) + Message length (4H) + Message block.
+// Response: "MW" + "00" for a verified MAC, or "MW" + "00" + IV (16H) for the next block for
+// first and middle blocks.
+func ExecuteMV(input []byte) ([]byte, error) {
+	logInfo("MV: starting MAC verification on a large message")
+	msg, err := mvSpec.Parse(input)
+	if err != nil {
+		logError(fmt.Sprintf("MV: %v", err))
+		return nil, errorcodes.WithDetail(errorcodes.Err15, err.Error())
+	}
+
+	req, err := parseLargeMACRequest("MV", msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return verifyChainedMAC("MV", "MW", req, msg.Get("input_format")[0])
+}
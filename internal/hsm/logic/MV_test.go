@@ -0,0 +1,68 @@
+package logic
+
+import (
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteMV(t *testing.T) {
+	t.Parallel()
+
+	const (
+		singleKey = "0123456789ABCDEF"
+		doubleKey = "U0123456789ABCDEFFEDCBA9876543210"
+		x99MAC    = "70A30640CC76DD8B"
+		x919MAC   = "A1C72E74EA3FA9B6"
+	)
+	data := "Now is the time for all "
+
+	first, err := ExecuteMV([]byte("1010" + doubleKey + "0010" + data[:16]))
+	require.NoError(t, err)
+	require.Len(t, first, 4+16)
+	assert.Equal(t, "MW00", string(first[:4]))
+	iv := string(first[4:])
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr error
+	}{
+		{name: "X9.9 with TAK", input: "0000" + singleKey + x99MAC + "0018" + data},
+		{name: "X9.19 with ZAK", input: "0110" + doubleKey + x919MAC + "0018" + data},
+		{name: "Last block", input: "3010" + doubleKey + iv + x919MAC + "0008" + data[16:]},
+		{
+			name:    "MAC mismatch",
+			input:   "0010" + doubleKey + x99MAC + "0018" + data,
+			wantErr: errorcodes.Err01,
+		},
+		{
+			name:    "Invalid MAC characters",
+			input:   "0010" + doubleKey + "ZZZZZZZZZZZZZZZZ" + "0018" + data,
+			wantErr: errorcodes.Err15,
+		},
+		{
+			name:    "Missing IV",
+			input:   "3010" + doubleKey,
+			wantErr: errorcodes.Err15,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ExecuteMV([]byte(tc.input))
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "MW00", string(got))
+		})
+	}
+}
@@ -8,44 +8,65 @@ import (
 
 	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
 	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/msgspec"
 )
 
 // ExecuteNC processes the NC payload and returns response bytes.
+// Input: Firmware version [+ '%' + LMK ID]. The server passes its firmware version and any LMK
+// identifier of the request.
+// Response: "ND" + "00" + LMK check value (16H) + Firmware version. The check value is that of
+// the LMK named by the identifier, LMK 00 by default.
 func ExecuteNC(input []byte) ([]byte, error) {
 	logInfo("NC: Starting command diagnostics.")
 	logDebug(fmt.Sprintf("NC: Input data hex: %x", input))
 
-	if len(input) < 9 {
-		logError("NC: Input data too short for command")
-		return nil, errorcodes.Err15
+	tokens, err := parseTrailingFields("NC", input, "%")
+	if err != nil {
+		return nil, err
 	}
 
 	// Extract and validate firmware version
-	version := string(input)
+	version := tokens.Positional
+	if len(version) < 9 {
+		logError("NC: Input data too short for command")
+		return nil, errorcodes.Err15
+	}
 	logInfo("NC: Processing firmware version.")
 	logDebug(fmt.Sprintf("NC: Firmware version: %s", version))
 
-	logInfo("NC: Calculating KCV value.")
-	// When LMK is available:
-	// zeros := make([]byte, 16)
-	// kcvRaw, err := LMKProviderInstance.EncryptUnderLMK(zeros)
-	// if err != nil {
-	//   logError("NC: Failed to calculate KCV")
-	//   return nil, errorcodes.Err68
-	// }
+	lmkID := DefaultLMKID
+	if id, ok := tokens.Field(msgspec.DelimLMKID); ok {
+		lmkID = string(id)
+	}
 
-	// For now use dummy KCV
-	kcvRaw := make([]byte, 16)
-	logDebug(fmt.Sprintf("NC: Calculated KCV hex: %x", kcvRaw[:8]))
+	logInfo("NC: Calculating LMK check value.")
+	kcvRaw, err := LMKProviderInstance.LMKCheckValue(lmkID)
+	if err != nil {
+		logError(fmt.Sprintf("NC: Failed to calculate check value of LMK %s: %v", lmkID, err))
+		return nil, err
+	}
+	logDebug(fmt.Sprintf("NC: Calculated KCV hex: %x", kcvRaw))
 
 	// Format response: ND00 + KCV (16 chars) + firmware version
 	logInfo("NC: Formatting diagnostic response.")
-	resp := make([]byte, 0, 4+16+len(input))
+	resp := make([]byte, 0, 4+2*len(kcvRaw)+len(version))
 	resp = append(resp, "ND00"...)
-	resp = append(resp, cryptoutils.Raw2B(kcvRaw[:8])...)
-	resp = append(resp, input...)
+	resp = append(resp, cryptoutils.Raw2B(kcvRaw)...)
+	resp = append(resp, version...)
 
 	logDebug(fmt.Sprintf("NC: Final response hex: %x", resp))
 
 	return resp, nil
 }
+
+// NCPayload returns the input of ExecuteNC for an NC request with payload: the firmware
+// version followed by the LMK identifier of the request, if any. Other request data is
+// ignored.
+func NCPayload(firmware string, payload []byte) []byte {
+	input := []byte(firmware)
+	if len(payload) > 0 && payload[0] == msgspec.DelimLMKID {
+		input = append(input, payload...)
+	}
+
+	return input
+}
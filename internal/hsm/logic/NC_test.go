@@ -1,12 +1,22 @@
 package logic
 
 import (
-	"encoding/hex"
 	"testing"
 
 	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/msgspec"
+	"github.com/andrei-cloud/go_hsm/pkg/testutil"
 )
 
+// ndLayout describes an ND response.
+var ndLayout = msgspec.Spec{
+	Command: "ND",
+	Fields: []msgspec.Field{
+		msgspec.Fixed("kcv", 16, msgspec.EncodingHex),
+		msgspec.Remainder("firmware", 1, msgspec.EncodingAny),
+	},
+}
+
 func TestExecuteNC(t *testing.T) {
 	t.Parallel()
 
@@ -15,6 +25,7 @@ func TestExecuteNC(t *testing.T) {
 		name             string
 		input            []byte
 		expectedResponse string
+		expectedKCV      string
 		expectedError    error
 	}{
 		{
@@ -28,9 +39,22 @@ func TestExecuteNC(t *testing.T) {
 			input: []byte(
 				"0007-E000",
 			), // 9 bytes long.
-			expectedResponse: "ND00" + "0102030405060708090a0b0c0d0e0f10" + "0007-E000", // Placeholder KCV.
+			expectedResponse: "ND00" + "7D22274C5745C5A1" + "0007-E000",
+			expectedKCV:      "7D22274C5745C5A1", // Check value of the variant test LMK 00.
+			expectedError:    nil,
+		},
+		{
+			name:             "Key block LMK",
+			input:            []byte("0007-E000%01"),
+			expectedResponse: "ND00" + "DB3FB663EE8D2B66" + "0007-E000",
+			expectedKCV:      "DB3FB663EE8D2B66",
 			expectedError:    nil,
 		},
+		{
+			name:          "Unknown LMK",
+			input:         []byte("0007-E000%99"),
+			expectedError: errorcodes.Err13,
+		},
 	}
 
 	// --- Run Tests. ---
@@ -48,23 +72,15 @@ func TestExecuteNC(t *testing.T) {
 			// Specific checks for successful case
 			if tc.expectedError == nil {
 				// Response format: ND00 + KCV(16 hex chars) + firmware version
-				expectedLen := 4 + 16 + len(tc.input)
-				if len(resp) != expectedLen {
-					t.Errorf("expected response length %d, got %d", expectedLen, len(resp))
-				}
-				if string(resp[:4]) != "ND00" {
-					t.Errorf("expected ND00 prefix, got %s", string(resp[:4]))
+				got, err := testutil.ParseResponse(ndLayout, resp)
+				if err != nil {
+					t.Fatalf("invalid ND response %q: %v", resp, err)
 				}
-				kcv := resp[4:20]
-				if _, hexErr := hex.DecodeString(string(kcv)); hexErr != nil {
-					t.Errorf("invalid KCV hex format: %v", hexErr)
+				if fw := got.Get("firmware"); fw != "0007-E000" {
+					t.Errorf("expected firmware version 0007-E000, got %s", fw)
 				}
-				if string(resp[20:]) != string(tc.input) {
-					t.Errorf(
-						"expected firmware version %s, got %s",
-						string(tc.input),
-						string(resp[20:]),
-					)
+				if kcv := got.Get("kcv"); kcv != tc.expectedKCV {
+					t.Errorf("expected LMK check value %s, got %s", tc.expectedKCV, kcv)
 				}
 			}
 		})
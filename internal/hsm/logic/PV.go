@@ -0,0 +1,163 @@
+package logic
+
+import (
+	"encoding/hex"
+	"fmt"
+	"slices"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/internal/hsm"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/msgspec"
+	"github.com/andrei-cloud/go_hsm/pkg/pinblock"
+)
+
+// pvSpec describes the PV (PVV Key Index Rollover) request layout.
+var pvSpec = msgspec.Spec{
+	Command: "PV",
+	Fields: []msgspec.Field{
+		msgspec.Key("tpk", "U", 16),
+		msgspec.Key("old_pvk", "U", 32),
+		msgspec.Key("new_pvk", "U", 32),
+		msgspec.Fixed("pin_block", 16, msgspec.EncodingHex),
+		msgspec.Fixed("format_code", 2, msgspec.EncodingNumeric),
+		msgspec.Fixed("account", 12, msgspec.EncodingNumeric),
+		msgspec.Fixed("old_pvki", 1, msgspec.EncodingNumeric),
+		msgspec.Fixed("old_pvv", 4, msgspec.EncodingNumeric),
+		msgspec.Fixed("new_pvki", 1, msgspec.EncodingNumeric),
+	},
+	AllowTrailing: true,
+}
+
+// ExecutePV processes the PV (PVV Key Index Rollover) command and returns response bytes.
+// It verifies a PIN against its PVV under the old PVK and index and, on success, generates
+// the PVV of the same PIN under the new PVK and index, so an issuer PVK rotation needs the
+// PIN block only once.
+// Format: TPK (U + 32H or 16H) + Old PVK (U + 32H or 2 x 16H) + New PVK (U + 32H or 2 x 16H) +
+// PIN block (16H) + Format code (2N) + Account number (12N) + Old PVKI (1N) + Old PVV (4N) +
+// New PVKI (1N).
+func ExecutePV(input []byte) ([]byte, error) {
+	logInfo("PV: starting PVV key index rollover")
+	msg, err := pvSpec.Parse(input)
+	if err != nil {
+		logError(fmt.Sprintf("PV: %v", err))
+		return nil, errorcodes.WithDetail(errorcodes.Err15, err.Error())
+	}
+
+	tpk, _ := msg.Value("tpk")
+	tpkScheme := byte('X')
+	if tpk.Scheme == 'U' {
+		tpkScheme = 'U'
+	}
+	tpkRaw, err := hex.DecodeString(tpk.Data)
+	if err != nil {
+		logError("PV: invalid TPK hex format")
+		return nil, errorcodes.Err15
+	}
+	logInfo("PV: decrypting TPK under LMK")
+	clearTPK, err := LMKProviderInstance.DecryptUnderLMK(tpkRaw, "002", tpkScheme)
+	if err != nil {
+		logError("PV: TPK decryption failed")
+		return nil, errorcodes.Err68
+	}
+	if !cryptoutils.CheckKeyParity(clearTPK) {
+		logError("PV: TPK parity check failed")
+		return nil, errorcodes.Err10
+	}
+
+	oldValue, _ := msg.Value("old_pvk")
+	oldPVK, err := pvDecryptPVK("old PVK", oldValue)
+	if err != nil {
+		return nil, err
+	}
+	newValue, _ := msg.Value("new_pvk")
+	newPVK, err := pvDecryptPVK("new PVK", newValue)
+	if err != nil {
+		return nil, err
+	}
+
+	logInfo("PV: decrypting PIN block with TPK")
+	tpkCipher, err := cryptoprovider.NewTripleDESCipher(cryptoutils.PrepareTripleDESKey(clearTPK))
+	if err != nil {
+		logError("PV: failed to create TPK cipher")
+		return nil, errorcodes.Err68
+	}
+	encPIN, _ := hex.DecodeString(msg.Get("pin_block"))
+	clearBlock := make([]byte, len(encPIN))
+	tpkCipher.Decrypt(clearBlock, encPIN)
+
+	formatCode := msg.Get("format_code")
+	pinFormat, err := hsm.GetPinBlockFormatFromThalesCode(formatCode)
+	if err != nil {
+		logError(fmt.Sprintf("PV: invalid PIN block format code: %s", formatCode))
+		return nil, errorcodes.Err23
+	}
+
+	accountNum := msg.Get("account")
+	clearPIN, err := pinblock.DecodePinBlock(hex.EncodeToString(clearBlock), accountNum, pinFormat)
+	if err != nil {
+		logError("PV: failed to extract clear PIN")
+		return nil, errorcodes.Err20
+	}
+
+	dec := decimalizerFor("PV", accountNum)
+
+	logInfo("PV: verifying PVV under the old PVK")
+	oldPVV, err := cryptoutils.GetVisaPVVWith(dec, accountNum, msg.Get("old_pvki"), clearPIN, oldPVK)
+	if err != nil {
+		logError("PV: failed to calculate old PVV")
+		return nil, errorcodes.Err68
+	}
+	if string(oldPVV) != msg.Get("old_pvv") {
+		logError("PV: PVV verification failed")
+		return nil, errorcodes.Err01
+	}
+
+	logInfo("PV: generating PVV under the new PVK")
+	newPVV, err := cryptoutils.GetVisaPVVWith(dec, accountNum, msg.Get("new_pvki"), clearPIN, newPVK)
+	if err != nil {
+		logError("PV: failed to calculate new PVV")
+		return nil, errorcodes.Err68
+	}
+
+	logInfo("PV: PVV key index rollover completed successfully")
+
+	return slices.Concat([]byte("PW"), []byte(errorcodes.Err00.CodeOnly()), newPVV), nil
+}
+
+// pvDecryptPVK decrypts a PVK given as U + 32H or as a pair of single-length keys and checks
+// its parity. name identifies the key in logs.
+func pvDecryptPVK(name string, pvk msgspec.Value) ([]byte, error) {
+	raw, err := hex.DecodeString(pvk.Data)
+	if err != nil {
+		logError(fmt.Sprintf("PV: invalid %s hex format", name))
+		return nil, errorcodes.Err15
+	}
+
+	logInfo(fmt.Sprintf("PV: decrypting %s under LMK", name))
+	var clear []byte
+	if pvk.Scheme == 'U' {
+		clear, err = LMKProviderInstance.DecryptUnderLMK(raw, "002", 'U')
+	} else {
+		var a, b []byte
+		if a, err = LMKProviderInstance.DecryptUnderLMK(raw[:8], "002", 'X'); err == nil {
+			b, err = LMKProviderInstance.DecryptUnderLMK(raw[8:], "002", 'X')
+		}
+		clear = slices.Concat(a, b)
+	}
+	if err != nil {
+		logError(fmt.Sprintf("PV: %s decryption failed", name))
+		return nil, errorcodes.Err68
+	}
+	if len(clear) != 16 {
+		logError(fmt.Sprintf("PV: %s must be double length", name))
+		return nil, errorcodes.Err27
+	}
+	if !cryptoutils.CheckKeyParity(clear) {
+		logError(fmt.Sprintf("PV: %s parity check failed", name))
+		return nil, errorcodes.Err11
+	}
+
+	return clear, nil
+}
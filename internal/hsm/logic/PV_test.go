@@ -0,0 +1,62 @@
+package logic
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecutePV(t *testing.T) {
+	t.Parallel()
+
+	if err := SetupTestLMKProvider(); err != nil {
+		t.Fatalf("Failed to setup test LMK provider: %v", err)
+	}
+
+	const (
+		validTPK = "U0123456789ABCDEFFEDCBA9876543210"
+		oldPVK   = "U0123456789ABCDEF0123456789ABCDEF"
+		newPVK   = "UFEDCBA98765432100123456789ABCDEF"
+		pinData  = "CB4EBC0180DFED6E01345513804937"
+	)
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr error
+	}{
+		{"short input", "123", errorcodes.Err15},
+		{"old PVV mismatch", validTPK + oldPVK + newPVK + pinData + "1" + "2678" + "2", errorcodes.Err01},
+		{"invalid format code", validTPK + oldPVK + newPVK + "CB4EBC0180DFED6E99345513804937" + "1" + "2677" + "2", errorcodes.Err23},
+		{"new PVK parity", validTPK + oldPVK + "U" + strings.Repeat("0", 32) + pinData + "1" + "2677" + "2", errorcodes.Err11},
+		{"missing new PVKI", validTPK + oldPVK + newPVK + pinData + "1" + "2677", errorcodes.Err15},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := ExecutePV([]byte(tc.input))
+			assert.ErrorIs(t, err, tc.wantErr)
+		})
+	}
+
+	t.Run("rollover", func(t *testing.T) {
+		t.Parallel()
+
+		for _, pvk := range []string{newPVK, newPVK[1:]} {
+			got, err := ExecutePV([]byte(validTPK + oldPVK + pvk + pinData + "1" + "2677" + "2"))
+			assert.NoError(t, err)
+			if assert.Len(t, got, 8) {
+				assert.Equal(t, "PW00", string(got[:4]))
+
+				// The new PVV verifies under the new PVK and index.
+				resp, err := ExecuteDC([]byte(validTPK + newPVK + pinData + "2" + string(got[4:])))
+				assert.NoError(t, err)
+				assert.Equal(t, "DD00", string(resp))
+			}
+		}
+	})
+}
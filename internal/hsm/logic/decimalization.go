@@ -0,0 +1,120 @@
+package logic
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+)
+
+// DecimalizationEnv is the environment variable carrying the decimalization profile
+// specification into plugins.
+const DecimalizationEnv = "GOHSM_DECIMALIZATION"
+
+// issuerSelector prefixes issuer (PAN prefix) entries in a decimalization specification.
+const issuerSelector = "issuer:"
+
+// decimalizationEnvOnce loads the profiles passed through DecimalizationEnv on first use.
+var decimalizationEnvOnce sync.Once
+
+var decimalization = struct {
+	sync.RWMutex
+	commands map[string]cryptoutils.Decimalizer
+	issuers  map[string]cryptoutils.Decimalizer
+}{
+	commands: make(map[string]cryptoutils.Decimalizer),
+	issuers:  make(map[string]cryptoutils.Decimalizer),
+}
+
+// SetCommandDecimalizer selects the decimalization used by a command such as DC or CW.
+func SetCommandDecimalizer(cmd string, dec cryptoutils.Decimalizer) {
+	decimalization.Lock()
+	defer decimalization.Unlock()
+
+	decimalization.commands[strings.ToUpper(cmd)] = dec
+}
+
+// SetIssuerDecimalizer selects the decimalization used for accounts starting with
+// panPrefix. Issuer profiles take precedence over command profiles.
+func SetIssuerDecimalizer(panPrefix string, dec cryptoutils.Decimalizer) {
+	decimalization.Lock()
+	defer decimalization.Unlock()
+
+	decimalization.issuers[panPrefix] = dec
+}
+
+// ResetDecimalizers removes all command and issuer decimalization profiles.
+func ResetDecimalizers() {
+	decimalization.Lock()
+	defer decimalization.Unlock()
+
+	clear(decimalization.commands)
+	clear(decimalization.issuers)
+}
+
+// ConfigureDecimalization installs decimalization profiles from a comma separated list of
+// selector=decimalizer entries. A selector is a command code or issuer:<PAN prefix>; a
+// decimalizer is any specification accepted by cryptoutils.ParseDecimalizer, e.g.
+// "DC=visa,issuer:476173=table2:0123456789012345".
+func ConfigureDecimalization(spec string) error {
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		selector, decSpec, ok := strings.Cut(entry, "=")
+		if !ok {
+			return fmt.Errorf("invalid decimalization entry %q", entry)
+		}
+		dec, err := cryptoutils.ParseDecimalizer(decSpec)
+		if err != nil {
+			return fmt.Errorf("decimalization entry %q: %w", entry, err)
+		}
+
+		if prefix, isIssuer := strings.CutPrefix(selector, issuerSelector); isIssuer {
+			if prefix == "" || strings.Trim(prefix, "0123456789") != "" {
+				return fmt.Errorf("invalid issuer PAN prefix %q", prefix)
+			}
+			SetIssuerDecimalizer(prefix, dec)
+
+			continue
+		}
+		if len(selector) != 2 {
+			return fmt.Errorf("invalid command code %q", selector)
+		}
+		SetCommandDecimalizer(selector, dec)
+	}
+
+	return nil
+}
+
+// decimalizerFor returns the decimalization for a command and account: the longest
+// matching issuer profile, then the command profile, then the default.
+func decimalizerFor(cmd, pan string) cryptoutils.Decimalizer {
+	decimalizationEnvOnce.Do(func() {
+		if err := ConfigureDecimalization(os.Getenv(DecimalizationEnv)); err != nil {
+			logError(fmt.Sprintf("invalid %s: %v", DecimalizationEnv, err))
+		}
+	})
+
+	decimalization.RLock()
+	defer decimalization.RUnlock()
+
+	var best cryptoutils.Decimalizer
+	bestLen := 0
+	for prefix, dec := range decimalization.issuers {
+		if len(prefix) > bestLen && strings.HasPrefix(pan, prefix) {
+			best, bestLen = dec, len(prefix)
+		}
+	}
+	if best != nil {
+		return best
+	}
+	if dec, ok := decimalization.commands[cmd]; ok {
+		return dec
+	}
+
+	return cryptoutils.DefaultDecimalizer
+}
@@ -0,0 +1,38 @@
+package logic
+
+import (
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestDecimalizationProfiles modifies the package-wide profiles, so it does not run in
+// parallel with the command tests.
+func TestDecimalizationProfiles(t *testing.T) {
+	defer ResetDecimalizers()
+
+	err := ConfigureDecimalization(
+		"ZZ=table:0000000000000000, issuer:99=table:1111111111111111, issuer:9988=table2:2222222222222222",
+	)
+	assert.NoError(t, err)
+
+	assert.Equal(t, cryptoutils.DefaultDecimalizer, decimalizerFor("DC", "4000001234562"))
+
+	dec := decimalizerFor("ZZ", "4000001234562")
+	digits, err := dec.Digits("ABCD", 4)
+	assert.NoError(t, err)
+	assert.Equal(t, "0000", digits, "command profile")
+
+	digits, err = decimalizerFor("ZZ", "9912345").Digits("ABCD", 4)
+	assert.NoError(t, err)
+	assert.Equal(t, "1111", digits, "issuer profile overrides command profile")
+
+	digits, err = decimalizerFor("DC", "9988123").Digits("1ABC", 4)
+	assert.NoError(t, err)
+	assert.Equal(t, "1222", digits, "longest issuer prefix wins")
+
+	for _, spec := range []string{"DC", "DCX=visa", "issuer:=visa", "issuer:4A=visa", "DC=ibm"} {
+		assert.Error(t, ConfigureDecimalization(spec), spec)
+	}
+}
@@ -1,22 +1,20 @@
 package logic
 
 import (
-	"crypto/des"
 	"errors"
 
 	"github.com/andrei-cloud/go_hsm/pkg/common"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
 	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
 	"github.com/andrei-cloud/go_hsm/pkg/hsmplugin"
+	"github.com/andrei-cloud/go_hsm/pkg/keyschemes"
 )
 
 func randomKey(length int) ([]byte, error) {
-	buf := wasmRandomKey(uint32(length))
-	if buf == 0 {
-		return nil, errors.New("failed to generate random key")
+	key, err := hsmplugin.RandomKey(length)
+	if err != nil {
+		return nil, err
 	}
-
-	// Convert the buffer to a byte slice
-	key := hsmplugin.Buffer(buf).ToBytes()
 	if len(key) != length {
 		return nil, errors.New("generated key length mismatch")
 	}
@@ -26,89 +24,86 @@ func randomKey(length int) ([]byte, error) {
 
 // encryptUnderLMK calls the host export to encrypt data under LMK.
 func encryptUnderLMK(plainKey []byte, keyType string, schemeTag byte) ([]byte, error) {
-	// map Z scheme to X9.17 for single-length DES under LMK
-	if schemeTag == 'Z' {
-		schemeTag = 'X'
-	}
-
-	plainKeyPtr, plainKeyLen := hsmplugin.ToBuffer(plainKey).AddressSize()
-	keyTypeStrPtr, keyTypeStrLen := hsmplugin.ToBuffer([]byte(keyType)).AddressSize()
-
-	r := wasmEncryptUnderLMK(
-		plainKeyPtr,
-		plainKeyLen,
-		keyTypeStrPtr,
-		keyTypeStrLen,
-		uint32(schemeTag),
-	)
-	if r == 0 {
-		return nil, errors.New("failed to encrypt key under LMK")
-	}
-
-	// read bytes from WASM memory and make a deep copy
-	buf := hsmplugin.Buffer(r).ToBytes()
-	copyBuf := append([]byte(nil), buf...)
-
-	return copyBuf, nil
+	return hsmplugin.EncryptUnderLMK(plainKey, keyType, hostScheme(schemeTag))
 }
 
 // decryptUnderLMK calls the host export to decrypt data under LMK.
 func decryptUnderLMK(encryptedKey []byte, keyType string, schemeTag byte) ([]byte, error) {
-	// map Z scheme to X9.17 for single-length DES under LMK
+	return hsmplugin.DecryptUnderLMK(encryptedKey, keyType, hostScheme(schemeTag))
+}
+
+// translateFromOldLMK calls the host export to translate a key from the old LMK.
+func translateFromOldLMK(encryptedKey []byte, keyType string, schemeTag byte) ([]byte, error) {
+	return hsmplugin.TranslateFromOldLMK(encryptedKey, keyType, hostScheme(schemeTag))
+}
+
+// hostScheme maps the Z scheme to X9.17 for single-length DES under LMK.
+func hostScheme(schemeTag byte) byte {
 	if schemeTag == 'Z' {
-		schemeTag = 'X'
+		return 'X'
 	}
 
-	encryptedKeyPtr, encryptedKeyLen := hsmplugin.ToBuffer(encryptedKey).AddressSize()
-	keyTypeStrPtr, keyTypeStrLen := hsmplugin.ToBuffer([]byte(keyType)).AddressSize()
-	r := wasmDecryptUnderLMK(
-		encryptedKeyPtr,
-		encryptedKeyLen,
-		keyTypeStrPtr,
-		keyTypeStrLen,
-		uint32(schemeTag),
-	)
-	if r == 0 {
-		return nil, errors.New("failed to decrypt key under LMK")
-	}
+	return schemeTag
+}
+
+// wrapKeyBlock calls the host export to wrap a clear key in a key block under the key block
+// LMK named in template.
+func wrapKeyBlock(template, clearKey []byte) ([]byte, error) {
+	return hsmplugin.WrapKeyBlock(template, clearKey)
+}
 
-	// read bytes from WASM memory and make a deep copy
-	buf := hsmplugin.Buffer(r).ToBytes()
-	copyBuf := append([]byte(nil), buf...)
+// unwrapKeyBlock calls the host export to unwrap a key block under the key block LMK named
+// in its header.
+func unwrapKeyBlock(block []byte) ([]byte, error) {
+	return hsmplugin.UnwrapKeyBlock(block)
+}
 
-	return copyBuf, nil
+// lmkCheckValue calls the host export to compute the check value of the LMK registered
+// under lmkID.
+func lmkCheckValue(lmkID string) ([]byte, error) {
+	return hsmplugin.LMKCheckValue(lmkID)
 }
 
 // logInfo invokes the host log_info export.
 func logInfo(msg string) {
-	wasmLogInfo(common.FormatData([]byte(msg)))
+	hsmplugin.LogInfo(common.FormatData([]byte(msg)))
 }
 
 // logError invokes the host log_error export.
 func logError(msg string) {
-	wasmLogError(common.FormatData([]byte(msg)))
+	hsmplugin.LogError(common.FormatData([]byte(msg)))
 }
 
 // logDebug invokes the host log_debug export.
 func logDebug(msg string) {
-	wasmLogDebug(common.FormatData([]byte(msg)))
-}
-
-// getKeyLength returns the key length in bytes based on the encryption scheme tag.
-func getKeyLength(scheme byte) int {
-	switch scheme {
-	case 'U', 'X':
-		return 16 // double-length DES
-	case 'T', 'Y':
-		return 24 // triple-length DES
-	default:
-		return 8 // single-length DES (Z or blank)
-	}
+	hsmplugin.LogDebug(common.FormatData([]byte(msg)))
 }
 
 // encryptKeyUnderZMK encrypts clearKey using the provided ZMK.
 // It assumes the ZMK key type is "000" and derives the scheme ('U' or 'T') from the length of zmkBytes.
 func encryptKeyUnderZMK(clearKey, zmkBytes []byte) ([]byte, error) {
+	rawZmk, err := decryptZMK(zmkBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	zmkBlock, err := cryptoprovider.NewTripleDESCipher(cryptoutils.PrepareTripleDESKey(rawZmk))
+	if err != nil {
+		return nil, errors.Join(errors.New("create zmk cipher"), err)
+	}
+
+	// Encrypt under ZMK
+	zmkEncryptedKey := make([]byte, len(clearKey))
+	for i := 0; i < len(clearKey); i += 8 {
+		zmkBlock.Encrypt(zmkEncryptedKey[i:i+8], clearKey[i:i+8])
+	}
+
+	return zmkEncryptedKey, nil
+}
+
+// decryptZMK decrypts a ZMK (key type 000) encrypted under the LMK, deriving the scheme
+// ('U' or 'T') from the length of zmkBytes.
+func decryptZMK(zmkBytes []byte) ([]byte, error) {
 	const zmkKeyType = "000" // Standard Thales key type for ZMK.
 	var zmkSchemeTag byte
 
@@ -126,23 +121,12 @@ func encryptKeyUnderZMK(clearKey, zmkBytes []byte) ([]byte, error) {
 		return nil, errors.Join(errors.New("decrypt zmk"), err)
 	}
 
-	zmkBlock, err := des.NewTripleDESCipher(cryptoutils.PrepareTripleDESKey(rawZmk))
-	if err != nil {
-		return nil, errors.Join(errors.New("create zmk cipher"), err)
-	}
-
-	// Encrypt under ZMK
-	zmkEncryptedKey := make([]byte, len(clearKey))
-	for i := 0; i < len(clearKey); i += 8 {
-		zmkBlock.Encrypt(zmkEncryptedKey[i:i+8], clearKey[i:i+8])
-	}
-
-	return zmkEncryptedKey, nil
+	return rawZmk, nil
 }
 
 // appendEncryptedKeyToResponse appends the encrypted key to response with proper formatting.
 func appendEncryptedKeyToResponse(resp []byte, keyScheme byte, encryptedKey []byte) []byte {
 	resp = append(resp, keyScheme)
-	keyLength := getKeyLength(keyScheme)
+	keyLength := keyschemes.Length(keyScheme)
 	return append(resp, cryptoutils.Raw2B(encryptedKey[:keyLength])...)
 }
@@ -0,0 +1,96 @@
+package logic
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+)
+
+// generatedKey is a random key and the check value of its clear value. Every cryptogram of
+// a key generation response is taken from the same generatedKey, so the LMK and transport
+// key forms and the KCV always describe one key.
+type generatedKey struct {
+	clear []byte
+	kcv   []byte
+}
+
+// generateKey creates a random key of length bytes and its 6-digit KCV. cmd prefixes log
+// messages.
+func generateKey(cmd string, length int) (generatedKey, error) {
+	return generateKeyWithCheck(cmd, length, func(clearKey []byte) ([]byte, error) {
+		return cryptoutils.KeyCV(cryptoutils.Raw2B(clearKey), 6)
+	})
+}
+
+// generateAESKey creates a random AES key of length bytes and its 6-digit check value, the
+// start of the AES CMAC of a zero block.
+func generateAESKey(cmd string, length int) (generatedKey, error) {
+	return generateKeyWithCheck(cmd, length, func(clearKey []byte) ([]byte, error) {
+		return cryptoutils.AESKeyCV(cryptoutils.Raw2B(clearKey), 6)
+	})
+}
+
+// generateKeyWithCheck creates a random key of length bytes and its check value computed by
+// checkValue.
+func generateKeyWithCheck(
+	cmd string,
+	length int,
+	checkValue func(clearKey []byte) ([]byte, error),
+) (generatedKey, error) {
+	logInfo(fmt.Sprintf("%s: generating random key", cmd))
+	clearKey, err := LMKProviderInstance.RandomKey(length)
+	if err != nil {
+		logError(fmt.Sprintf("%s: failed to generate random key", cmd))
+		return generatedKey{}, errors.Join(errors.New("generate random key"), err)
+	}
+
+	logInfo(fmt.Sprintf("%s: calculating key check value", cmd))
+	kcv, err := checkValue(clearKey)
+	if err != nil {
+		logError(fmt.Sprintf("%s: failed to calculate KCV", cmd))
+		return generatedKey{}, errors.Join(errors.New("calculate kcv"), err)
+	}
+
+	return generatedKey{clear: clearKey, kcv: kcv}, nil
+}
+
+// keyCryptogram is one encrypted form of a key in a key generation response.
+type keyCryptogram struct {
+	// scheme is the key scheme tag written before a binary key.
+	scheme byte
+	// key is the encrypted key. Unless encoded is set it is truncated to the length of
+	// scheme and hex encoded after the tag.
+	key []byte
+	// encoded marks a key that is already in its response form, such as a tagged key block.
+	encoded bool
+}
+
+// taggedCryptogram returns a cryptogram of an encrypted key written after its scheme tag.
+func taggedCryptogram(scheme byte, encrypted []byte) keyCryptogram {
+	return keyCryptogram{scheme: scheme, key: encrypted}
+}
+
+// encodedCryptogram returns a cryptogram that is copied to the response as is.
+func encodedCryptogram(field []byte) keyCryptogram {
+	return keyCryptogram{key: field, encoded: true}
+}
+
+// buildKeyResponse returns the response code and error code 00, followed by the cryptograms
+// in order and the KCV, which may be nil for commands that do not return one.
+func buildKeyResponse(respCode string, kcv []byte, cryptograms ...keyCryptogram) []byte {
+	resp := make([]byte, 0, 64)
+	resp = append(resp, respCode...)
+	resp = append(resp, errorcodes.Err00.CodeOnly()...)
+	for _, c := range cryptograms {
+		if c.encoded {
+			resp = append(resp, c.key...)
+
+			continue
+		}
+		resp = appendEncryptedKeyToResponse(resp, c.scheme, c.key)
+	}
+
+	return append(resp, kcv...)
+}
@@ -0,0 +1,55 @@
+package logic
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildKeyResponse(t *testing.T) {
+	t.Parallel()
+
+	lmk := []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xAB, 0xCD, 0xEF, 0xFE, 0xDC, 0xBA, 0x98, 0x76, 0x54, 0x32, 0x10, 0xFF}
+	tests := []struct {
+		name        string
+		kcv         []byte
+		cryptograms []keyCryptogram
+		want        string
+	}{
+		{"no cryptograms", nil, nil, "A100"},
+		{
+			"lmk and kcv",
+			[]byte("ABCDEF"),
+			[]keyCryptogram{taggedCryptogram('U', lmk)},
+			"A100U0123456789ABCDEFFEDCBA9876543210ABCDEF",
+		},
+		{
+			"lmk, transport key block and kcv",
+			[]byte("ABCDEF"),
+			[]keyCryptogram{taggedCryptogram('Z', lmk), encodedCryptogram([]byte("RD0000..."))},
+			"A100Z0123456789ABCDEFRD0000...ABCDEF",
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := buildKeyResponse("A1", tc.kcv, tc.cryptograms...)
+			assert.Equal(t, tc.want, string(got))
+		})
+	}
+}
+
+func TestGenerateKeyKCV(t *testing.T) {
+	t.Parallel()
+
+	if err := SetupTestLMKProvider(); err != nil {
+		t.Fatalf("Failed to setup test LMK provider: %v", err)
+	}
+
+	key, err := generateKey("A0", 16)
+	assert.NoError(t, err)
+	assert.Len(t, key.clear, 16)
+	assert.Len(t, key.kcv, 6)
+}
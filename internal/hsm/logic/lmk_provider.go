@@ -2,10 +2,15 @@ package logic
 
 import (
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
+	"slices"
+	"strconv"
 
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
 	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+	"github.com/andrei-cloud/go_hsm/pkg/keyschemes"
 	"github.com/andrei-cloud/go_hsm/pkg/variantlmk"
 )
 
@@ -14,9 +19,24 @@ const (
 	LMKTypeKeyBlock
 )
 
+// DefaultKeyBlockLMKID is the key block LMK of key blocks whose header names no LMK, that is
+// whose LMK identifier (header bytes 14-15) is 00.
+const DefaultKeyBlockLMKID = "01"
+
+// ErrKeyBlockLMKNotConfigured indicates a key block whose header names an LMK ID under which
+// no key block LMK is registered.
+var ErrKeyBlockLMKNotConfigured = errors.New("key block LMK not configured")
+
+// ErrOldLMKNotConfigured indicates an LMK ID under which no old LMK is registered.
+var ErrOldLMKNotConfigured = errors.New("old LMK not configured")
+
 // LMKRegistry holds registered LMK engines by string ID.
 var LMKRegistry = make(map[string]LMKEngine)
 
+// OldLMKRegistry holds the old LMKs of an LMK rollover, the key change storage of payShield,
+// by the ID of the LMK replacing them.
+var OldLMKRegistry = make(map[string]LMKEngine)
+
 // load default variant LMK set once.
 var defaultVariantSet = func() variantlmk.LMKSet {
 	set, err := variantlmk.LoadDefaultLMKSet()
@@ -38,13 +58,27 @@ type LMKEngine interface {
 }
 
 // VariantLMKProvider implements LMKEngine using the existing variant LMK functions.
-type VariantLMKProvider struct{}
+type VariantLMKProvider struct {
+	// set is the variant LMK set; nil selects the default test LMK set.
+	set *variantlmk.LMKSet
+	// pciMode selects the PCI-HSM compliant key type table.
+	pciMode bool
+	// test designates a test LMK.
+	test bool
+}
 
-// KeyBlockLMKProvider implements LMKEngine for key block LMK operations (wrap/unwrap).
-// It will use the keyblocklmk package under the hood.
+// KeyBlockLMKProvider implements LMKEngine for key block LMK operations (wrap/unwrap), and
+// keyblocklmk.LMKProvider with the wrapping keys of its LMK, so each registered LMK ID
+// derives its own wrapping keys for every key block version.
 type KeyBlockLMKProvider struct {
+	// id is the registry ID, written to the LMK identifier of wrapped key block headers.
+	id string
 	// lmk holds the AES-256 LMK for key block derivation and protection.
 	lmk []byte
+	// strictCompat produces payShield byte-compatible key blocks.
+	strictCompat bool
+	// test designates a test LMK whose key blocks carry the test key status.
+	test bool
 }
 
 // init registers default LMKs: variant under "00" and key block under "01".
@@ -58,6 +92,24 @@ func init() {
 	}
 }
 
+// PCIMode reports whether the provider uses the PCI-HSM compliant key type table.
+func (p VariantLMKProvider) PCIMode() bool {
+	return p.pciMode
+}
+
+// WithPCIMode returns a copy of the provider using the given compliance mode, for a single
+// request overriding the configured mode.
+func (p VariantLMKProvider) WithPCIMode(enabled bool) VariantLMKProvider {
+	p.pciMode = enabled
+
+	return p
+}
+
+// Test reports whether the LMK is designated as a test LMK.
+func (p VariantLMKProvider) Test() bool {
+	return p.test
+}
+
 // EncryptUnderLMK encrypts key under variant LMK, ignoring lmkID.
 func (p VariantLMKProvider) EncryptUnderLMK(
 	key []byte,
@@ -69,8 +121,9 @@ func (p VariantLMKProvider) EncryptUnderLMK(
 		keyType,
 		schemeTag,
 		key,
-		defaultVariantSet,
+		p.lmkSet(),
 		false,
+		p.pciMode,
 	)
 }
 
@@ -85,11 +138,21 @@ func (p VariantLMKProvider) DecryptUnderLMK(
 		keyType,
 		schemeTag,
 		data,
-		defaultVariantSet,
+		p.lmkSet(),
 		false,
+		p.pciMode,
 	)
 }
 
+// lmkSet returns the variant LMK set of the provider.
+func (p VariantLMKProvider) lmkSet() variantlmk.LMKSet {
+	if p.set == nil {
+		return defaultVariantSet
+	}
+
+	return *p.set
+}
+
 // GetLMKType for VariantLMKProvider.
 func (p VariantLMKProvider) GetLMKType() LMKType {
 	return LMKTypeVariant
@@ -111,30 +174,109 @@ func (p KeyBlockLMKProvider) EncryptUnderLMK(
 		KeyVersionNum:  "00",
 		Exportability:  'N',
 		OptionalBlocks: 0,
-		KeyContext:     '1',
 	}
 
-	return keyblocklmk.WrapKeyBlock(p.lmk, header, nil, key)
+	return p.wrap(header, key)
 }
 
-// DecryptUnderLMK unwraps a key block under the LMK and returns the clear key.
+// DecryptUnderLMK unwraps a key block under the LMK and returns the clear key. Blocks whose
+// TR-31 key context allows only exchange are not used as stored keys.
 func (p KeyBlockLMKProvider) DecryptUnderLMK(
 	data []byte,
 	_ string,
 	_ byte,
 	_ string,
 ) ([]byte, error) {
-	_, clearKey, err := keyblocklmk.UnwrapKeyBlock(p.lmk, data)
+	header, _, clearKey, err := keyblocklmk.UnwrapKeyBlockWithProvider(p, data)
 	if err != nil {
 		return nil, err
 	}
+	if err := header.CheckStorage(); err != nil {
+		cryptoutils.Zeroize(clearKey)
+
+		return nil, err
+	}
 
 	return clearKey, nil
 }
 
 // WrapWithHeader encrypts clear key into a key block using the provided header.
 func (p KeyBlockLMKProvider) WrapWithHeader(header keyblocklmk.Header, key []byte) ([]byte, error) {
-	return keyblocklmk.WrapKeyBlock(p.lmk, header, nil, key)
+	return p.wrap(header, key)
+}
+
+// Unwrap unwraps a key block under the LMK and returns its header, authenticated optional
+// blocks and clear key.
+func (p KeyBlockLMKProvider) Unwrap(
+	data []byte,
+) (*keyblocklmk.Header, []keyblocklmk.OptionalBlock, []byte, error) {
+	return keyblocklmk.UnwrapKeyBlockWithProvider(p, data)
+}
+
+// CombineComponents XOR-combines component key blocks into a single key block and returns
+// it with the clear key. See keyblocklmk.CombineComponents.
+func (p KeyBlockLMKProvider) CombineComponents(blocks [][]byte) ([]byte, []byte, error) {
+	return keyblocklmk.CombineComponents(p.lmk, blocks, p.wrapOptions())
+}
+
+// ChangeAttributes rewraps a key block with a new mode of use and exportability. See
+// keyblocklmk.ChangeAttributes.
+func (p KeyBlockLMKProvider) ChangeAttributes(
+	block []byte,
+	modeOfUse, exportability byte,
+	relax bool,
+) ([]byte, *keyblocklmk.Header, error) {
+	return keyblocklmk.ChangeAttributes(p.lmk, block, modeOfUse, exportability, relax, p.wrapOptions())
+}
+
+// TranslateTo rewraps a key block held under this LMK under the LMK to, with the LMK
+// identifier of to, without exposing the clear key. See keyblocklmk.TranslateKeyBlock.
+func (p KeyBlockLMKProvider) TranslateTo(block []byte, to KeyBlockLMKProvider) ([]byte, error) {
+	opts := keyblocklmk.TranslateOptions{Wrap: to.wrapOptions()}
+	if n, err := strconv.Atoi(to.id); err == nil && len(to.id) == 2 && n >= 0 {
+		opts.LMKID = byte(n)
+	}
+
+	return keyblocklmk.TranslateKeyBlock(p.lmk, block, to.lmk, opts)
+}
+
+// Test reports whether the LMK is designated as a test LMK.
+func (p KeyBlockLMKProvider) Test() bool {
+	return p.test
+}
+
+// wrap wraps key under the LMK with the LMK identifier of the header set to the registry ID,
+// so the key block can be routed back to this LMK when it is unwrapped.
+func (p KeyBlockLMKProvider) wrap(header keyblocklmk.Header, key []byte) ([]byte, error) {
+	if n, err := strconv.Atoi(p.id); err == nil && len(p.id) == 2 && n >= 0 {
+		header.KeyContext = byte(n)
+	}
+	return keyblocklmk.WrapKeyBlockWithProvider(p, header, nil, key, p.wrapOptions())
+}
+
+// wrapOptions returns the wrapping options of the LMK. Key blocks of a test LMK carry the
+// test key status, so test key material can be told from production keys downstream.
+func (p KeyBlockLMKProvider) wrapOptions() keyblocklmk.WrapOptions {
+	opts := keyblocklmk.WrapOptions{StrictCompat: p.strictCompat}
+	if p.test {
+		opts.KeyStatus = keyblocklmk.KeyStatusTest
+	}
+
+	return opts
+}
+
+// WrappingKeys implements keyblocklmk.LMKProvider: the wrapping keys of key blocks of the
+// given version, derived from the LMK.
+func (p KeyBlockLMKProvider) WrappingKeys(version byte) ([]byte, []byte, error) {
+	return keyblocklmk.DeriveWrappingKeys(version, p.lmk)
+}
+
+// WithStrictCompat returns a copy of the provider producing payShield byte-compatible key
+// blocks when strict is set, for a single operation overriding the configured mode.
+func (p KeyBlockLMKProvider) WithStrictCompat(strict bool) KeyBlockLMKProvider {
+	p.strictCompat = strict
+
+	return p
 }
 
 // GetLMKType for KeyBlockLMKProvider.
@@ -142,11 +284,28 @@ func (p KeyBlockLMKProvider) GetLMKType() LMKType {
 	return LMKTypeKeyBlock
 }
 
+// RegisteredLMKIDs returns the sorted IDs of the registered LMKs.
+func RegisteredLMKIDs() []string {
+	ids := make([]string, 0, len(LMKRegistry))
+	for id := range LMKRegistry {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	return ids
+}
+
 // RegisterVariantLMK registers a variant LMK provider under the given ID.
 func RegisterVariantLMK(id string) {
 	LMKRegistry[id] = VariantLMKProvider{}
 }
 
+// RegisterVariantLMKSet registers a variant LMK provider using the given LMK set under the
+// given ID.
+func RegisterVariantLMKSet(id string, set variantlmk.LMKSet) {
+	LMKRegistry[id] = VariantLMKProvider{set: &set}
+}
+
 // RegisterKeyBlockLMK registers a key block LMK provider under the given ID
 // using the provided LMK hex string.
 func RegisterKeyBlockLMK(id, lmkHex string) error {
@@ -159,7 +318,181 @@ func RegisterKeyBlockLMK(id, lmkHex string) error {
 		return fmt.Errorf("key block LMK must be 32 bytes, got %d", len(lmk))
 	}
 
-	LMKRegistry[id] = KeyBlockLMKProvider{lmk: lmk}
+	LMKRegistry[id] = KeyBlockLMKProvider{id: id, lmk: lmk}
 
 	return nil
 }
+
+// RegisterOldVariantLMKSet registers the variant LMK set as the old LMK of the given ID.
+func RegisterOldVariantLMKSet(id string, set variantlmk.LMKSet) {
+	OldLMKRegistry[id] = VariantLMKProvider{set: &set}
+}
+
+// RegisterOldKeyBlockLMK registers the key block LMK given in hex as the old LMK of the
+// given ID.
+func RegisterOldKeyBlockLMK(id, lmkHex string) error {
+	lmk, err := hex.DecodeString(lmkHex)
+	if err != nil {
+		return fmt.Errorf("invalid old key block LMK hex for id %s: %w", id, err)
+	}
+	if len(lmk) != 32 {
+		return fmt.Errorf("key block LMK must be 32 bytes, got %d", len(lmk))
+	}
+	OldLMKRegistry[id] = KeyBlockLMKProvider{id: id, lmk: lmk}
+
+	return nil
+}
+
+// TranslateFromOldLMK translates a key encrypted under the old LMK of lmkID to the LMK of
+// lmkID. A variant key is decrypted under the old LMK set and encrypted under the current
+// one with the same key type and scheme; a key block is rewrapped, keeping its header. An
+// empty lmkID selects the LMK named in the header of a key block.
+func TranslateFromOldLMK(data []byte, keyType string, schemeTag byte, lmkID string) ([]byte, error) {
+	if keyschemes.IsKeyBlock(schemeTag) {
+		if lmkID == "" {
+			id, err := KeyBlockLMKID(data)
+			if err != nil {
+				return nil, err
+			}
+			lmkID = id
+		}
+		old, ok := OldLMKRegistry[lmkID].(KeyBlockLMKProvider)
+		if !ok {
+			return nil, fmt.Errorf("%w: key block LMK ID %s", ErrOldLMKNotConfigured, lmkID)
+		}
+		current, err := LookupKeyBlockLMK(lmkID)
+		if err != nil {
+			return nil, err
+		}
+
+		return old.TranslateTo(data, current)
+	}
+
+	old, ok := OldLMKRegistry[lmkID].(VariantLMKProvider)
+	if !ok {
+		return nil, fmt.Errorf("%w: variant LMK ID %s", ErrOldLMKNotConfigured, lmkID)
+	}
+	current, ok := LMKRegistry[lmkID].(VariantLMKProvider)
+	if !ok {
+		return nil, fmt.Errorf("no variant LMK registered under id %s", lmkID)
+	}
+	clearKey, err := old.WithPCIMode(current.PCIMode()).DecryptUnderLMK(data, keyType, schemeTag, lmkID)
+	if err != nil {
+		return nil, err
+	}
+
+	return current.EncryptUnderLMK(clearKey, keyType, schemeTag, lmkID)
+}
+
+// SetKeyBlockStrictCompat enables or disables payShield byte-compatible key block wrapping
+// for the key block LMK registered under the given ID.
+func SetKeyBlockStrictCompat(id string, strict bool) error {
+	p, ok := LMKRegistry[id].(KeyBlockLMKProvider)
+	if !ok {
+		return fmt.Errorf("no key block LMK registered under id %s", id)
+	}
+	p.strictCompat = strict
+	LMKRegistry[id] = p
+
+	return nil
+}
+
+// SetVariantPCIMode selects the PCI-HSM compliant key type table for the variant LMK
+// registered under the given ID.
+func SetVariantPCIMode(id string, enabled bool) error {
+	p, ok := LMKRegistry[id].(VariantLMKProvider)
+	if !ok {
+		return fmt.Errorf("no variant LMK registered under id %s", id)
+	}
+	LMKRegistry[id] = p.WithPCIMode(enabled)
+
+	return nil
+}
+
+// SetLMKTest designates the LMK registered under the given ID as a test or a live LMK.
+func SetLMKTest(id string, test bool) error {
+	switch p := LMKRegistry[id].(type) {
+	case VariantLMKProvider:
+		p.test = test
+		LMKRegistry[id] = p
+	case KeyBlockLMKProvider:
+		p.test = test
+		LMKRegistry[id] = p
+	default:
+		return fmt.Errorf("no LMK registered under id %s", id)
+	}
+
+	return nil
+}
+
+// IsTestLMK reports whether the LMK registered under the given ID is a test LMK.
+func IsTestLMK(id string) bool {
+	t, ok := LMKRegistry[id].(interface{ Test() bool })
+
+	return ok && t.Test()
+}
+
+// LookupKeyBlockLMK returns the key block LMK registered under the given ID.
+func LookupKeyBlockLMK(id string) (KeyBlockLMKProvider, error) {
+	p, ok := LMKRegistry[id].(KeyBlockLMKProvider)
+	if !ok {
+		return KeyBlockLMKProvider{}, fmt.Errorf("%w: LMK ID %s", ErrKeyBlockLMKNotConfigured, id)
+	}
+
+	return p, nil
+}
+
+// KeyBlockLMKID returns the ID of the LMK a key block, starting with its scheme tag, is
+// wrapped under, taken from the LMK identifier in header bytes 14-15. An identifier of 00
+// names no LMK and selects DefaultKeyBlockLMKID.
+func KeyBlockLMKID(block []byte) (string, error) {
+	header, err := keyblocklmk.ParseHeader(block)
+	if err != nil {
+		return "", err
+	}
+	if header.KeyContext == 0 {
+		return DefaultKeyBlockLMKID, nil
+	}
+
+	return fmt.Sprintf("%02d", header.KeyContext), nil
+}
+
+// EncryptKeyBlock wraps key in a key block with the attributes of template, the scheme tag
+// and 16 character header of a key block, under the key block LMK named by its LMK
+// identifier. Key blocks carry no key type code, so hosts pass the template in its place.
+func EncryptKeyBlock(key, template []byte) ([]byte, error) {
+	header, err := keyblocklmk.ParseHeader(template)
+	if err != nil {
+		return nil, err
+	}
+	p, _, err := KeyBlockLMKFor(template)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.WrapWithHeader(*header, key)
+}
+
+// UnwrapKeyBlock unwraps block, starting with its scheme tag, under the key block LMK named
+// by its LMK identifier and returns the clear key. Like DecryptUnderLMK it rejects key
+// blocks in the exchange context.
+func UnwrapKeyBlock(block []byte) ([]byte, error) {
+	p, id, err := KeyBlockLMKFor(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.DecryptUnderLMK(block, "", 'S', id)
+}
+
+// KeyBlockLMKFor returns the key block LMK named in the header of block and its ID. It fails
+// with ErrKeyBlockLMKNotConfigured when no key block LMK is registered under that ID.
+func KeyBlockLMKFor(block []byte) (KeyBlockLMKProvider, string, error) {
+	id, err := KeyBlockLMKID(block)
+	if err != nil {
+		return KeyBlockLMKProvider{}, "", err
+	}
+	p, err := LookupKeyBlockLMK(id)
+
+	return p, id, err
+}
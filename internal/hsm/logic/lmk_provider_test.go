@@ -0,0 +1,334 @@
+package logic
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/crypto"
+	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+	"github.com/andrei-cloud/go_hsm/pkg/variantlmk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestVariantPCIMode modifies the LMK registry, so it does not run in parallel with the
+// command tests.
+func TestVariantPCIMode(t *testing.T) {
+	const id = "99"
+	RegisterVariantLMK(id)
+	defer delete(LMKRegistry, id)
+
+	key := []byte("0123456789ABCDEF")
+
+	// Key type 70D only exists in the PCI-HSM compliant table.
+	_, err := LMKRegistry[id].EncryptUnderLMK(key, "70D", 'U', id)
+	assert.Error(t, err, "standard table")
+
+	require.NoError(t, SetVariantPCIMode(id, true))
+	encrypted, err := LMKRegistry[id].EncryptUnderLMK(key, "70D", 'U', id)
+	require.NoError(t, err, "PCI table")
+
+	// A per-request override leaves the configured mode untouched.
+	provider := LMKRegistry[id].(VariantLMKProvider)
+	_, err = provider.WithPCIMode(false).DecryptUnderLMK(encrypted, "70D", 'U', id)
+	assert.Error(t, err, "override to standard table")
+	assert.True(t, LMKRegistry[id].(VariantLMKProvider).PCIMode())
+
+	decrypted, err := LMKRegistry[id].DecryptUnderLMK(encrypted, "70D", 'U', id)
+	require.NoError(t, err)
+	assert.Equal(t, key, decrypted)
+
+	assert.Error(t, SetVariantPCIMode("01", true), "key block LMK")
+}
+
+// TestVariantAESKeys verifies AES keys under the variant LMK with the A, B and C schemes.
+func TestVariantAESKeys(t *testing.T) {
+	t.Parallel()
+
+	provider := VariantLMKProvider{}
+	for scheme, length := range map[byte]int{'A': 16, 'B': 24, 'C': 32} {
+		key := []byte(strings.Repeat("K", length))
+		encrypted, err := provider.EncryptUnderLMK(key, "000", scheme, "00")
+		require.NoError(t, err, "scheme %c", scheme)
+		assert.Len(t, encrypted, length)
+
+		decrypted, err := provider.DecryptUnderLMK(encrypted, "000", scheme, "00")
+		require.NoError(t, err, "scheme %c", scheme)
+		assert.Equal(t, key, decrypted)
+
+		_, err = provider.EncryptUnderLMK(key[:8], "000", scheme, "00")
+		assert.Error(t, err, "scheme %c with a DES key", scheme)
+	}
+
+	// An AES-128 key is not readable as a double-length TDES key.
+	key := []byte(strings.Repeat("K", 16))
+	encrypted, err := provider.EncryptUnderLMK(key, "000", 'A', "00")
+	require.NoError(t, err)
+	decrypted, err := provider.DecryptUnderLMK(encrypted, "000", 'U', "00")
+	require.NoError(t, err)
+	assert.NotEqual(t, key, decrypted)
+}
+
+// TestLMKTestDesignation modifies the LMK registry, so it does not run in parallel with
+// the command tests.
+func TestLMKTestDesignation(t *testing.T) {
+	const id = "98"
+	require.NoError(t, RegisterKeyBlockLMK(id, hex.EncodeToString(keyblocklmk.DefaultTestAESLMK)))
+	defer delete(LMKRegistry, id)
+
+	assert.False(t, IsTestLMK(id))
+	require.NoError(t, SetLMKTest(id, true))
+	assert.True(t, IsTestLMK(id))
+
+	provider := LMKRegistry[id].(KeyBlockLMKProvider)
+	block, err := provider.EncryptUnderLMK([]byte("0123456789ABCDEF"), "K0", 'S', id)
+	require.NoError(t, err)
+	_, blocks, _, err := provider.Unwrap(block)
+	require.NoError(t, err)
+	assert.Equal(t, keyblocklmk.KeyStatusTest, keyblocklmk.KeyStatus(blocks))
+
+	require.NoError(t, SetLMKTest(id, false))
+	block, err = LMKRegistry[id].EncryptUnderLMK([]byte("0123456789ABCDEF"), "K0", 'S', id)
+	require.NoError(t, err)
+	_, blocks, _, err = provider.Unwrap(block)
+	require.NoError(t, err)
+	assert.Empty(t, blocks)
+
+	assert.Error(t, SetLMKTest("unknown", true))
+	assert.False(t, IsTestLMK("unknown"))
+}
+
+// TestKeyBlockLMKRouting modifies the LMK registry, so it does not run in parallel with the
+// command tests.
+func TestKeyBlockLMKRouting(t *testing.T) {
+	const id = "97"
+	lmk := make([]byte, 32)
+	for i := range lmk {
+		lmk[i] = byte(i)
+	}
+	require.NoError(t, RegisterKeyBlockLMK(id, hex.EncodeToString(lmk)))
+	defer delete(LMKRegistry, id)
+
+	key := []byte("0123456789ABCDEF")
+	block, err := LMKRegistry[id].EncryptUnderLMK(key, "K0", 'S', id)
+	require.NoError(t, err)
+	assert.Equal(t, id, string(block[15:17]), "LMK identifier in header")
+
+	engine, routed, err := KeyBlockLMKFor(block)
+	require.NoError(t, err)
+	assert.Equal(t, id, routed)
+	decrypted, err := engine.DecryptUnderLMK(block, "", 'S', routed)
+	require.NoError(t, err)
+	assert.Equal(t, key, decrypted)
+
+	// The default LMK cannot unwrap a block wrapped under another LMK.
+	_, err = LMKRegistry[DefaultKeyBlockLMKID].DecryptUnderLMK(block, "", 'S', DefaultKeyBlockLMKID)
+	assert.Error(t, err)
+
+	// Identifier 00 names no LMK and selects the default.
+	unnamed := append([]byte(nil), block...)
+	copy(unnamed[15:17], "00")
+	routed, err = KeyBlockLMKID(unnamed)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultKeyBlockLMKID, routed)
+
+	unknown := append([]byte(nil), block...)
+	copy(unknown[15:17], "42")
+	_, _, err = KeyBlockLMKFor(unknown)
+	assert.ErrorIs(t, err, ErrKeyBlockLMKNotConfigured)
+}
+
+// TestWrapUnwrapKeyBlock modifies the LMK registry, so it does not run in parallel with the
+// command tests.
+func TestWrapUnwrapKeyBlock(t *testing.T) {
+	const id = "96"
+	require.NoError(t, RegisterKeyBlockLMK(id, strings.Repeat("5A", 32)))
+	defer delete(LMKRegistry, id)
+
+	header, err := keyblocklmk.Header{
+		Version:       '1',
+		KeyUsage:      "P0",
+		Algorithm:     'A',
+		ModeOfUse:     'B',
+		KeyVersionNum: "00",
+		Exportability: 'N',
+		KeyContext:    96,
+	}.MarshalBinary()
+	require.NoError(t, err)
+	template := append([]byte{'S'}, header...)
+
+	key := []byte("0123456789ABCDEF")
+	block, err := EncryptKeyBlock(key, template)
+	require.NoError(t, err)
+	assert.Equal(t, "P0", string(block[6:8]), "key usage of the template")
+	assert.Equal(t, id, string(block[15:17]), "LMK identifier in header")
+
+	clear, err := UnwrapKeyBlock(block)
+	require.NoError(t, err)
+	assert.Equal(t, key, clear)
+
+	tampered := append([]byte(nil), block...)
+	tampered[len(tampered)-1] ^= 1
+	_, err = UnwrapKeyBlock(tampered)
+	assert.Error(t, err)
+
+	copy(template[15:17], "42")
+	_, err = EncryptKeyBlock(key, template)
+	assert.ErrorIs(t, err, ErrKeyBlockLMKNotConfigured)
+}
+
+// TestKeyBlockKeyContext verifies that key blocks whose TR-31 key context allows only
+// exchange are not used as stored keys.
+func TestKeyBlockKeyContext(t *testing.T) {
+	const id = "99"
+	require.NoError(t, RegisterKeyBlockLMK(id, hex.EncodeToString(keyblocklmk.DefaultTestAESLMK)))
+	defer delete(LMKRegistry, id)
+
+	provider := LMKRegistry[id].(KeyBlockLMKProvider)
+	key := []byte("0123456789ABCDEF")
+	header := keyblocklmk.Header{
+		Version:       keyblocklmk.ISO20038VersionE,
+		KeyUsage:      "K0",
+		Algorithm:     'A',
+		ModeOfUse:     'B',
+		KeyVersionNum: "00",
+		Exportability: 'E',
+	}
+
+	for _, tc := range []struct {
+		ctx  byte
+		want error
+	}{
+		{keyblocklmk.KeyContextAny, nil},
+		{keyblocklmk.KeyContextStorage, nil},
+		{keyblocklmk.KeyContextExchange, keyblocklmk.ErrKeyContext},
+	} {
+		header.KeyContext = tc.ctx
+		block, err := keyblocklmk.WrapKeyBlock(provider.lmk, header, nil, key)
+		require.NoError(t, err)
+
+		clear, err := provider.DecryptUnderLMK(block, "", 'R', id)
+		if tc.want != nil {
+			assert.ErrorIs(t, err, tc.want, "context %d", tc.ctx)
+			continue
+		}
+		require.NoError(t, err, "context %d", tc.ctx)
+		assert.Equal(t, key, clear)
+	}
+}
+
+func TestKeyBlockTranslateTo(t *testing.T) {
+	const from, to = "98", "99"
+	require.NoError(t, RegisterKeyBlockLMK(from, hex.EncodeToString(keyblocklmk.DefaultTestAESLMK)))
+	defer delete(LMKRegistry, from)
+	require.NoError(t, RegisterKeyBlockLMK(to, strings.Repeat("3C", 32)))
+	defer delete(LMKRegistry, to)
+
+	src := LMKRegistry[from].(KeyBlockLMKProvider)
+	dst := LMKRegistry[to].(KeyBlockLMKProvider)
+	key := []byte("0123456789ABCDEF")
+	block, err := src.wrap(keyblocklmk.Header{
+		Version:       '1',
+		KeyUsage:      "K0",
+		Algorithm:     'A',
+		ModeOfUse:     'B',
+		KeyVersionNum: "00",
+		Exportability: 'N',
+	}, key)
+	require.NoError(t, err)
+
+	out, err := src.TranslateTo(block, dst)
+	require.NoError(t, err)
+
+	id, err := KeyBlockLMKID(out)
+	require.NoError(t, err)
+	assert.Equal(t, to, id)
+	clear, err := dst.DecryptUnderLMK(out, "", 'S', to)
+	require.NoError(t, err)
+	assert.Equal(t, key, clear)
+}
+
+func TestTranslateFromOldLMK(t *testing.T) {
+	const variantID, keyBlockID = "97", "98"
+	key := []byte("0123456789ABCDEF")
+
+	oldSet, err := variantlmk.ParseLMKSet(bytes.Repeat([]byte{0x1F}, variantlmk.LMKSetSize))
+	require.NoError(t, err)
+	RegisterVariantLMK(variantID)
+	defer delete(LMKRegistry, variantID)
+
+	_, err = TranslateFromOldLMK(key, "001", 'U', variantID)
+	require.ErrorIs(t, err, ErrOldLMKNotConfigured)
+
+	RegisterOldVariantLMKSet(variantID, oldSet)
+	defer delete(OldLMKRegistry, variantID)
+
+	underOld, err := OldLMKRegistry[variantID].EncryptUnderLMK(key, "001", 'U', variantID)
+	require.NoError(t, err)
+	translated, err := TranslateFromOldLMK(underOld, "001", 'U', variantID)
+	require.NoError(t, err)
+	assert.NotEqual(t, underOld, translated)
+	clear, err := LMKRegistry[variantID].DecryptUnderLMK(translated, "001", 'U', variantID)
+	require.NoError(t, err)
+	assert.Equal(t, key, clear)
+
+	require.NoError(t, RegisterKeyBlockLMK(keyBlockID, strings.Repeat("3C", 32)))
+	defer delete(LMKRegistry, keyBlockID)
+	require.NoError(t, RegisterOldKeyBlockLMK(keyBlockID, hex.EncodeToString(keyblocklmk.DefaultTestAESLMK)))
+	defer delete(OldLMKRegistry, keyBlockID)
+
+	block, err := OldLMKRegistry[keyBlockID].(KeyBlockLMKProvider).wrap(keyblocklmk.Header{
+		Version:       '1',
+		KeyUsage:      "K0",
+		Algorithm:     'A',
+		ModeOfUse:     'B',
+		KeyVersionNum: "00",
+		Exportability: 'N',
+	}, key)
+	require.NoError(t, err)
+	translated, err = TranslateFromOldLMK(block, "", 'S', "")
+	require.NoError(t, err)
+	clear, err = LMKRegistry[keyBlockID].DecryptUnderLMK(translated, "", 'S', keyBlockID)
+	require.NoError(t, err)
+	assert.Equal(t, key, clear)
+}
+
+// TestLMKStatus modifies the LMK registry, so it does not run in parallel with the command
+// tests.
+func TestLMKStatus(t *testing.T) {
+	const id = "95"
+	lmk := make([]byte, 32)
+	for i := range lmk {
+		lmk[i] = byte(i)
+	}
+	require.NoError(t, RegisterKeyBlockLMK(id, hex.EncodeToString(lmk)))
+	defer delete(LMKRegistry, id)
+	require.NoError(t, SetLMKTest(id, true))
+
+	infos, err := LMKStatus()
+	require.NoError(t, err)
+	byID := make(map[string]LMKInfo, len(infos))
+	for _, info := range infos {
+		byID[info.ID] = info
+	}
+
+	assert.Equal(t, LMKInfo{
+		ID: "00", Scheme: "variant", Algorithm: "3DES (double length)", CheckValue: "7D22274C5745C5A1",
+	}, byID["00"])
+	assert.Equal(t, LMKInfo{
+		ID: "01", Scheme: "key block", Algorithm: "AES-256", CheckValue: "DB3FB663EE8D2B66",
+	}, byID["01"])
+
+	// The check value starts with the KCV of the LMK.
+	kcv, err := crypto.CalculateKCVType(lmk, crypto.KCVCMAC)
+	require.NoError(t, err)
+	got := byID[id]
+	assert.True(t, got.Test)
+	assert.Equal(t, strings.ToUpper(hex.EncodeToString(kcv)), got.CheckValue[:6])
+
+	_, err = LMKCheckValue("42")
+	assert.ErrorIs(t, err, errorcodes.Err13)
+}
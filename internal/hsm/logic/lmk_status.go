@@ -0,0 +1,115 @@
+package logic
+
+import (
+	"fmt"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+)
+
+// DefaultLMKID is the LMK of commands that carry no LMK identifier.
+const DefaultLMKID = "00"
+
+// LMKCheckValueLength is the length in bytes of the LMK check value reported by NC.
+const LMKCheckValueLength = 8
+
+// LMKInfo describes a registered LMK.
+type LMKInfo struct {
+	ID         string `json:"id"`
+	Scheme     string `json:"scheme"`
+	Algorithm  string `json:"algorithm"`
+	CheckValue string `json:"check_value"`
+	Test       bool   `json:"test"`
+}
+
+// String returns the name of the LMK type.
+func (t LMKType) String() string {
+	switch t {
+	case LMKTypeVariant:
+		return "variant"
+	case LMKTypeKeyBlock:
+		return "key block"
+	default:
+		return fmt.Sprintf("LMKType(%d)", int(t))
+	}
+}
+
+// Algorithm returns the algorithm of the variant LMK.
+func (p VariantLMKProvider) Algorithm() string {
+	return "3DES (double length)"
+}
+
+// CheckValue returns the check value of the variant LMK, a zero block encrypted under LMK
+// pair 00-01. Its first 3 bytes are the KCV of the LMK.
+func (p VariantLMKProvider) CheckValue() ([]byte, error) {
+	pair := p.lmkSet()[0]
+	key := append(append(make([]byte, 0, 16), pair.Left...), pair.Right...)
+	defer cryptoutils.Zeroize(key)
+
+	block, err := cryptoprovider.NewTripleDESCipher(cryptoutils.PrepareTripleDESKey(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	kcv := make([]byte, LMKCheckValueLength)
+	block.Encrypt(kcv, kcv)
+
+	return kcv, nil
+}
+
+// Algorithm returns the algorithm of the key block LMK.
+func (p KeyBlockLMKProvider) Algorithm() string {
+	return fmt.Sprintf("AES-%d", len(p.lmk)*8)
+}
+
+// CheckValue returns the check value of the key block LMK, the AES-CMAC of a zero block
+// truncated to LMKCheckValueLength bytes. Its first 3 bytes are the KCV of the LMK.
+func (p KeyBlockLMKProvider) CheckValue() ([]byte, error) {
+	mac, err := cryptoprovider.AESCMAC(p.lmk, make([]byte, 16))
+	if err != nil {
+		return nil, err
+	}
+
+	return mac[:LMKCheckValueLength], nil
+}
+
+// LMKCheckValue returns the check value of the LMK registered under id. It fails with error
+// 13 if no LMK is registered under id.
+func LMKCheckValue(id string) ([]byte, error) {
+	engine, ok := LMKRegistry[id]
+	if !ok {
+		return nil, errorcodes.WithDetail(errorcodes.Err13, "LMK "+id+" not configured")
+	}
+	lmk, ok := engine.(interface{ CheckValue() ([]byte, error) })
+	if !ok {
+		return nil, errorcodes.WithDetail(errorcodes.Err13, "LMK "+id+" has no check value")
+	}
+
+	return lmk.CheckValue()
+}
+
+// LMKStatus returns the registered LMKs sorted by ID with their scheme, algorithm and check
+// value.
+func LMKStatus() ([]LMKInfo, error) {
+	ids := RegisteredLMKIDs()
+	infos := make([]LMKInfo, 0, len(ids))
+	for _, id := range ids {
+		engine := LMKRegistry[id]
+		kcv, err := LMKCheckValue(id)
+		if err != nil {
+			return nil, err
+		}
+		info := LMKInfo{
+			ID:         id,
+			Scheme:     engine.GetLMKType().String(),
+			CheckValue: fmt.Sprintf("%X", kcv),
+			Test:       IsTestLMK(id),
+		}
+		if lmk, ok := engine.(interface{ Algorithm() string }); ok {
+			info.Algorithm = lmk.Algorithm()
+		}
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
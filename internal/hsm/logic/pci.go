@@ -0,0 +1,123 @@
+package logic
+
+import (
+	"bytes"
+	"slices"
+
+	"github.com/andrei-cloud/go_hsm/pkg/keyschemes"
+	"github.com/andrei-cloud/go_hsm/pkg/msgspec"
+)
+
+// DefaultVariantLMKID is the LMK of host commands without an LMK identifier.
+const DefaultVariantLMKID = "00"
+
+// KeyExport describes a request exporting a key under a ZMK.
+type KeyExport struct {
+	// KeyType is the 3-digit key type code of the exported key.
+	KeyType string
+	// KeyLength and ZMKLength are the lengths in bytes of the exported key and the ZMK.
+	KeyLength int
+	ZMKLength int
+}
+
+// KeyExportRequest returns the key exported by an A0 request in mode 1 or an A8 request,
+// without the command code. It reports false for other commands, for A0 requests that
+// generate key blocks and for requests that cannot be parsed.
+func KeyExportRequest(cmd string, payload []byte) (KeyExport, bool) {
+	switch cmd {
+	case "A0":
+		return a0KeyExport(payload)
+	case "A8":
+		return a8KeyExport(payload)
+	default:
+		return KeyExport{}, false
+	}
+}
+
+// a0KeyExport returns the key export of an A0 request in mode 1.
+func a0KeyExport(payload []byte) (KeyExport, bool) {
+	if len(payload) < 5 || payload[0] != '1' || payload[4] == keyschemes.SchemeS {
+		return KeyExport{}, false
+	}
+	trailer, err := msgspec.Tokenize(payload[5:], ";%#")
+	if err != nil {
+		return KeyExport{}, false
+	}
+	zmk, ok := trailer.Field(msgspec.DelimKeySchemes)
+	if !ok {
+		zmk = trailer.Positional
+	}
+	if len(zmk) == 0 || keyschemes.Length(zmk[0]) == 0 {
+		return KeyExport{}, false
+	}
+
+	return KeyExport{
+		KeyType:   string(payload[1:4]),
+		KeyLength: keyschemes.Length(payload[4]),
+		ZMKLength: keyschemes.Length(zmk[0]),
+	}, true
+}
+
+// a8KeyExport returns the key export of an A8 request. The exported key has the length of
+// the ZMK key scheme that ends the request.
+func a8KeyExport(payload []byte) (KeyExport, bool) {
+	if len(payload) < 3 {
+		return KeyExport{}, false
+	}
+	zmk, rest, err := keyschemes.Parse(payload[3:], "UT", 32)
+	if err != nil {
+		return KeyExport{}, false
+	}
+	if _, rest, err = keyschemes.Parse(rest, exchangeSchemes, 32); err != nil || len(rest) == 0 {
+		return KeyExport{}, false
+	}
+	keyLength := keyschemes.Length(rest[0])
+	if keyLength == 0 {
+		return KeyExport{}, false
+	}
+
+	return KeyExport{KeyType: string(payload[:3]), KeyLength: keyLength, ZMKLength: zmk.Length}, true
+}
+
+// LMKIDCommands are the host commands accepting an LMK identifier, '%' and two digits, after
+// their fields.
+var LMKIDCommands = []string{
+	"A0", "A6", "A8", "BU", "BW", "CA", "CI", "EI", "EW", "EY",
+	"GC", "GI", "GK", "GS", "GY", "JA", "JC", "KQ", "KW", "KY",
+}
+
+// RequestLMKID returns the LMK identifier that ends a request as '%' and two digits, or
+// DefaultVariantLMKID when the request names no LMK.
+func RequestLMKID(payload []byte) string {
+	if id, ok := requestLMKID(payload); ok {
+		return id
+	}
+
+	return DefaultVariantLMKID
+}
+
+// WithDefaultLMKID returns the payload of a request for cmd naming the LMK lmkID when cmd
+// accepts an LMK identifier and the request names none. Other requests are returned
+// unchanged.
+func WithDefaultLMKID(cmd string, payload []byte, lmkID string) []byte {
+	if _, ok := requestLMKID(payload); ok || !slices.Contains(LMKIDCommands, cmd) {
+		return payload
+	}
+
+	return slices.Concat(payload, []byte{msgspec.DelimLMKID}, []byte(lmkID))
+}
+
+// requestLMKID returns the LMK identifier that ends a request and whether there is one.
+func requestLMKID(payload []byte) (string, bool) {
+	i := bytes.LastIndexByte(payload, msgspec.DelimLMKID)
+	if i < 0 || len(payload)-i < 3 || !validLMKDigits(payload[i+1:i+3]) {
+		return "", false
+	}
+
+	return string(payload[i+1 : i+3]), true
+}
+
+// validLMKDigits reports whether id is two decimal digits.
+func validLMKDigits(id []byte) bool {
+	return len(id) == 2 && id[0] >= '0' && id[0] <= '9' && id[1] >= '0' && id[1] <= '9'
+}
@@ -6,12 +6,26 @@ type LMKProvider struct {
 	EncryptUnderLMK func(plainKey []byte, keyType string, schemeTag byte) ([]byte, error)
 	DecryptUnderLMK func(encryptedKey []byte, keyType string, schemeTag byte) ([]byte, error)
 	RandomKey       func(length int) ([]byte, error)
+	// TranslateFromOldLMK translates a key from the old LMK to the current one, see
+	// TranslateFromOldLMK.
+	TranslateFromOldLMK func(encryptedKey []byte, keyType string, schemeTag byte) ([]byte, error)
+	// WrapKeyBlock wraps a clear key in a key block with the attributes of a header
+	// template, see EncryptKeyBlock.
+	WrapKeyBlock func(template, clearKey []byte) ([]byte, error)
+	// UnwrapKeyBlock unwraps a key block and returns the clear key, see UnwrapKeyBlock.
+	UnwrapKeyBlock func(block []byte) ([]byte, error)
+	// LMKCheckValue returns the check value of a registered LMK, see LMKCheckValue.
+	LMKCheckValue func(lmkID string) ([]byte, error)
 }
 
 func SetDefaultLMKProvider() {
 	LMKProviderInstance = LMKProvider{
-		EncryptUnderLMK: encryptUnderLMK,
-		DecryptUnderLMK: decryptUnderLMK,
-		RandomKey:       randomKey,
+		EncryptUnderLMK:     encryptUnderLMK,
+		DecryptUnderLMK:     decryptUnderLMK,
+		RandomKey:           randomKey,
+		TranslateFromOldLMK: translateFromOldLMK,
+		WrapKeyBlock:        wrapKeyBlock,
+		UnwrapKeyBlock:      unwrapKeyBlock,
+		LMKCheckValue:       lmkCheckValue,
 	}
 }
@@ -1,11 +1,11 @@
 package logic
 
 import (
-	"crypto/des"
 	"encoding/hex"
 	"errors"
 	"fmt"
 
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
 	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
 )
 
@@ -24,13 +24,41 @@ func SetupTestLMKProvider() error {
 	}
 
 	LMKProviderInstance = LMKProvider{
-		EncryptUnderLMK: func(plainKey []byte, _ string, _ byte) ([]byte, error) {
+		EncryptUnderLMK: func(plainKey []byte, keyType string, schemeTag byte) ([]byte, error) {
+			// Key blocks are wrapped under the registered key block LMKs.
+			if schemeTag == 'S' {
+				return EncryptKeyBlock(plainKey, []byte(keyType))
+			}
+
 			return testEncryptWithLMK(plainKey, testKey)
 		},
-		DecryptUnderLMK: func(encryptedKey []byte, _ string, _ byte) ([]byte, error) {
+		DecryptUnderLMK: func(encryptedKey []byte, _ string, schemeTag byte) ([]byte, error) {
+			// Key blocks are unwrapped under the key block LMK named in their header.
+			if schemeTag == 'S' {
+				p, _, err := KeyBlockLMKFor(encryptedKey)
+				if err != nil {
+					return nil, err
+				}
+				_, _, clearKey, err := p.Unwrap(encryptedKey)
+
+				return clearKey, err
+			}
+
 			return encryptedKey, nil
 		},
 		RandomKey: testRandomKey,
+		// The old test LMK leaves variant keys in the clear; key blocks are translated
+		// between the registered key block LMKs.
+		TranslateFromOldLMK: func(encryptedKey []byte, keyType string, schemeTag byte) ([]byte, error) {
+			if schemeTag == 'S' {
+				return TranslateFromOldLMK(encryptedKey, keyType, schemeTag, "")
+			}
+
+			return testEncryptWithLMK(encryptedKey, testKey)
+		},
+		WrapKeyBlock:   EncryptKeyBlock,
+		UnwrapKeyBlock: UnwrapKeyBlock,
+		LMKCheckValue:  LMKCheckValue,
 	}
 
 	return nil
@@ -42,7 +70,7 @@ func testEncryptWithLMK(plainKey, testKey []byte) ([]byte, error) {
 		return nil, errors.New("invalid plaintext key length")
 	}
 
-	block, err := des.NewTripleDESCipher(cryptoutils.PrepareTripleDESKey(testKey))
+	block, err := cryptoprovider.NewTripleDESCipher(cryptoutils.PrepareTripleDESKey(testKey))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create cipher: %w", err)
 	}
@@ -57,7 +85,7 @@ func testEncryptWithLMK(plainKey, testKey []byte) ([]byte, error) {
 
 // testRandomKey generates deterministic pseudo-random keys for testing.
 func testRandomKey(length int) ([]byte, error) {
-	if length != 8 && length != 16 && length != 24 {
+	if length != 8 && length != 16 && length != 24 && length != 32 {
 		return nil, errors.New("invalid key length")
 	}
 
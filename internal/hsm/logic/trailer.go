@@ -0,0 +1,39 @@
+package logic
+
+import (
+	"fmt"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/msgspec"
+)
+
+// parseTrailingFields splits the optional tail of a host command at delims. An LMK
+// identifier introduced by '%' must be two digits naming a registered LMK. cmd prefixes log
+// messages.
+func parseTrailingFields(cmd string, data []byte, delims string) (*msgspec.Tokens, error) {
+	tokens, err := msgspec.Tokenize(data, delims)
+	if err != nil {
+		logError(fmt.Sprintf("%s: invalid trailing fields: %v", cmd, err))
+		return nil, errorcodes.Err15
+	}
+
+	if id, ok := tokens.Field(msgspec.DelimLMKID); ok {
+		if !validLMKID(id) {
+			logError(fmt.Sprintf("%s: invalid LMK identifier %q", cmd, id))
+			return nil, errorcodes.Err13
+		}
+		logDebug(fmt.Sprintf("%s: LMK identifier: %s", cmd, id))
+	}
+
+	return tokens, nil
+}
+
+// validLMKID reports whether id is a two digit identifier of a registered LMK.
+func validLMKID(id []byte) bool {
+	if !validLMKDigits(id) {
+		return false
+	}
+	_, ok := LMKRegistry[string(id)]
+
+	return ok
+}
@@ -0,0 +1,41 @@
+package logic
+
+import "github.com/andrei-cloud/go_hsm/pkg/msgspec"
+
+// ecSpec describes the EC (Verify PIN) request layout up to the account number, which is
+// all that is needed to attribute a verification to an account.
+var ecSpec = msgspec.Spec{
+	Command: "EC",
+	Fields: []msgspec.Field{
+		msgspec.Key("zpk", "UT", 16),
+		msgspec.Key("pvk", "U", 32),
+		msgspec.Fixed("pin_block", 16, msgspec.EncodingHex),
+		msgspec.Fixed("format_code", 2, msgspec.EncodingNumeric),
+		msgspec.Fixed("account", 12, msgspec.EncodingNumeric),
+	},
+	AllowTrailing: true,
+}
+
+// pinVerificationSpecs maps the commands that verify a PIN to their request layouts.
+var pinVerificationSpecs = map[string]msgspec.Spec{
+	"DC": dcSpec,
+	"EC": ecSpec,
+	"JC": jcSpec,
+	"PV": pvSpec,
+}
+
+// PINVerificationAccount returns the 12 digit account number of a PIN verification request
+// (DC, EC, JC or PV) without the command code. It reports false for other commands and for
+// requests that cannot be parsed.
+func PINVerificationAccount(cmd string, payload []byte) (string, bool) {
+	spec, ok := pinVerificationSpecs[cmd]
+	if !ok {
+		return "", false
+	}
+	msg, err := spec.Parse(payload)
+	if err != nil {
+		return "", false
+	}
+
+	return msg.Get("account"), true
+}
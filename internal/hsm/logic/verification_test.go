@@ -0,0 +1,37 @@
+package logic
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPINVerificationAccount(t *testing.T) {
+	t.Parallel()
+
+	key := strings.Repeat("0", 32)
+	// A key block with a 0080 byte block length: header, 48 hex key data and 16 hex MAC.
+	blockBody := "10080P0TB00N0000" + strings.Repeat("0", 64)
+	tail := strings.Repeat("A", 16) + "01" + "000123456789" + "1" + "1234"
+	tests := []struct {
+		name    string
+		cmd     string
+		payload string
+		want    string
+		ok      bool
+	}{
+		{"DC", "DC", "U" + key + "U" + key + tail, "000123456789", true},
+		{"DC pvk pair", "DC", "U" + key + key + tail, "000123456789", true},
+		{"EC single ZPK", "EC", key[:16] + "U" + key + tail, "000123456789", true},
+		{"PV", "PV", "U" + key + "U" + key + "U" + key + tail + "2", "000123456789", true},
+		{"JC key blocks", "JC", "S" + blockBody + "S" + blockBody + tail, "000123456789", true},
+		{"truncated", "DC", "U" + key, "", false},
+		{"other command", "CA", "U" + key + tail, "", false},
+	}
+	for _, tc := range tests {
+		account, ok := PINVerificationAccount(tc.cmd, []byte(tc.payload))
+		assert.Equal(t, tc.ok, ok, tc.name)
+		assert.Equal(t, tc.want, account, tc.name)
+	}
+}
@@ -0,0 +1,143 @@
+// Package rsakey holds the RSA key pairs of the asymmetric host commands: it generates key
+// pairs of the sizes the simulator supports and protects private keys outside of key blocks
+// by encrypting their PKCS#1 DER encoding in CBC mode under an LMK-held block cipher.
+package rsakey
+
+import (
+	"crypto"
+	"crypto/des"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+)
+
+// Modulus sizes in bits accepted by Generate.
+const (
+	MinBits = 1024
+	MaxBits = 4096
+)
+
+var (
+	// ErrKeySize indicates a modulus size outside MinBits..MaxBits or not a multiple of 8.
+	ErrKeySize = errors.New("unsupported rsa modulus size")
+	// ErrMalformedKey indicates data that does not hold a protected RSA private key.
+	ErrMalformedKey = errors.New("malformed rsa private key")
+)
+
+// BlockFunc encrypts or decrypts one 8-byte block under the LMK.
+type BlockFunc func(block []byte) ([]byte, error)
+
+// Generate creates an RSA key pair with a modulus of bits bits and public exponent 65537.
+func Generate(bits int) (*rsa.PrivateKey, error) {
+	if bits < MinBits || bits > MaxBits || bits%8 != 0 {
+		return nil, fmt.Errorf("%w: %d bits", ErrKeySize, bits)
+	}
+
+	return cryptoprovider.Default().GenerateRSAKey(bits)
+}
+
+// Seal encrypts the PKCS#1 DER encoding of key, padded with ISO/IEC 9797-1 method 2, in CBC
+// mode with a zero IV, calling encrypt for every block.
+func Seal(key *rsa.PrivateKey, encrypt BlockFunc) ([]byte, error) {
+	plain, err := cryptoutils.Pad(x509.MarshalPKCS1PrivateKey(key), des.BlockSize,
+		cryptoutils.PadModeISO9797Method2)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(plain))
+	chain := make([]byte, des.BlockSize)
+	for i := 0; i < len(plain); i += des.BlockSize {
+		in, err := cryptoutils.XORBytes(plain[i:i+des.BlockSize], chain)
+		if err != nil {
+			return nil, err
+		}
+		if chain, err = encrypt(in); err != nil {
+			return nil, err
+		}
+		if len(chain) != des.BlockSize {
+			return nil, fmt.Errorf("block cipher returned %d bytes", len(chain))
+		}
+		out = append(out, chain...)
+	}
+
+	return out, nil
+}
+
+// Open decrypts a private key protected by Seal, calling decrypt for every block.
+func Open(data []byte, decrypt BlockFunc) (*rsa.PrivateKey, error) {
+	if len(data) == 0 || len(data)%des.BlockSize != 0 {
+		return nil, fmt.Errorf("%w: length %d", ErrMalformedKey, len(data))
+	}
+
+	plain := make([]byte, 0, len(data))
+	chain := make([]byte, des.BlockSize)
+	for i := 0; i < len(data); i += des.BlockSize {
+		block := data[i : i+des.BlockSize]
+		out, err := decrypt(slices.Clone(block))
+		if err != nil {
+			return nil, err
+		}
+		if out, err = cryptoutils.XORBytes(out, chain); err != nil {
+			return nil, err
+		}
+		plain = append(plain, out...)
+		chain = block
+	}
+
+	return ParsePrivateKey(plain)
+}
+
+// ParsePrivateKey decodes a PKCS#1 DER private key, optionally followed by ISO/IEC 9797-1
+// method 2 padding as Seal stores it.
+func ParsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(data); err == nil {
+		return key, nil
+	}
+	der, err := cryptoutils.Unpad(data, des.BlockSize, cryptoutils.PadModeISO9797Method2)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedKey, err)
+	}
+	key, err := x509.ParsePKCS1PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedKey, err)
+	}
+
+	return key, nil
+}
+
+// Sign signs data with RSASSA-PKCS1-v1_5 over its hash under key.
+func Sign(key *rsa.PrivateKey, hash crypto.Hash, data []byte) ([]byte, error) {
+	digest, err := digestOf(data, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return cryptoprovider.Default().SignRSA(key, hash, digest)
+}
+
+// Verify checks an RSASSA-PKCS1-v1_5 signature of data under pub.
+func Verify(pub *rsa.PublicKey, hash crypto.Hash, data, sig []byte) error {
+	digest, err := digestOf(data, hash)
+	if err != nil {
+		return err
+	}
+
+	return cryptoprovider.Default().VerifyRSA(pub, hash, digest, sig)
+}
+
+// digestOf hashes data with hash.
+func digestOf(data []byte, hash crypto.Hash) ([]byte, error) {
+	if !hash.Available() {
+		return nil, fmt.Errorf("hash %v is not available", hash)
+	}
+	h := hash.New()
+	h.Write(data)
+
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,111 @@
+package rsakey
+
+import (
+	"crypto"
+	"crypto/des"
+	"crypto/x509"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	t.Parallel()
+
+	key, err := Generate(MinBits)
+	require.NoError(t, err)
+	assert.Equal(t, MinBits, key.N.BitLen())
+	assert.Equal(t, 65537, key.E)
+
+	for _, bits := range []int{512, MinBits + 1, MaxBits + 8} {
+		_, err := Generate(bits)
+		assert.ErrorIs(t, err, ErrKeySize, "bits %d", bits)
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	t.Parallel()
+
+	key, err := Generate(MinBits)
+	require.NoError(t, err)
+	lmk, err := des.NewTripleDESCipher([]byte("0123456789ABCDEFFEDCBA98"))
+	require.NoError(t, err)
+	encrypt := func(block []byte) ([]byte, error) {
+		out := make([]byte, len(block))
+		lmk.Encrypt(out, block)
+
+		return out, nil
+	}
+	decrypt := func(block []byte) ([]byte, error) {
+		out := make([]byte, len(block))
+		lmk.Decrypt(out, block)
+
+		return out, nil
+	}
+
+	sealed, err := Seal(key, encrypt)
+	require.NoError(t, err)
+	der := x509.MarshalPKCS1PrivateKey(key)
+	assert.Equal(t, (len(der)/des.BlockSize+1)*des.BlockSize, len(sealed))
+	assert.NotContains(t, string(sealed), string(der[:16]))
+
+	opened, err := Open(sealed, decrypt)
+	require.NoError(t, err)
+	assert.True(t, key.Equal(opened))
+
+	_, err = Open(sealed[:len(sealed)-1], decrypt)
+	assert.ErrorIs(t, err, ErrMalformedKey)
+	_, err = Open(sealed, encrypt)
+	assert.ErrorIs(t, err, ErrMalformedKey)
+
+	failing := errors.New("lmk unavailable")
+	_, err = Seal(key, func([]byte) ([]byte, error) { return nil, failing })
+	assert.ErrorIs(t, err, failing)
+}
+
+func TestSignVerify(t *testing.T) {
+	t.Parallel()
+
+	key, err := Generate(MinBits)
+	require.NoError(t, err)
+	data := []byte("message")
+
+	sig, err := Sign(key, crypto.SHA256, data)
+	require.NoError(t, err)
+	require.NoError(t, Verify(&key.PublicKey, crypto.SHA256, data, sig))
+	assert.Error(t, Verify(&key.PublicKey, crypto.SHA256, []byte("other"), sig))
+	assert.Error(t, Verify(&key.PublicKey, crypto.SHA1, data, sig))
+
+	parsed, err := ParsePrivateKey(x509.MarshalPKCS1PrivateKey(key))
+	require.NoError(t, err)
+	assert.True(t, key.Equal(parsed))
+}
+
+func TestEncryptDecryptKey(t *testing.T) {
+	t.Parallel()
+
+	key, err := Generate(MinBits)
+	require.NoError(t, err)
+	clear := []byte("0123456789ABCDEF")
+
+	for _, tr := range []Transport{
+		{},
+		{OAEP: true, Hash: crypto.SHA1},
+		{OAEP: true, Hash: crypto.SHA256, Label: []byte("TR34")},
+	} {
+		encrypted, err := EncryptKey(&key.PublicKey, tr, clear)
+		require.NoError(t, err)
+		assert.Len(t, encrypted, key.Size())
+
+		got, err := DecryptKey(key, tr, encrypted)
+		require.NoError(t, err)
+		assert.Equal(t, clear, got)
+	}
+
+	encrypted, err := EncryptKey(&key.PublicKey, Transport{OAEP: true, Hash: crypto.SHA256}, clear)
+	require.NoError(t, err)
+	_, err = DecryptKey(key, Transport{OAEP: true, Hash: crypto.SHA256, Label: []byte("x")}, encrypted)
+	assert.Error(t, err)
+}
@@ -0,0 +1,43 @@
+package rsakey
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"fmt"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
+)
+
+// Transport selects how keys are encrypted under an RSA key for remote key loading.
+type Transport struct {
+	// OAEP selects RSAES-OAEP; RSAES-PKCS1-v1_5 is used otherwise.
+	OAEP bool
+	// Hash is the OAEP hash, also used by the MGF1 mask generation function.
+	Hash crypto.Hash
+	// Label is the OAEP encoding parameter; empty when nil.
+	Label []byte
+}
+
+// EncryptKey encrypts a clear key under pub.
+func EncryptKey(pub *rsa.PublicKey, t Transport, key []byte) ([]byte, error) {
+	if !t.OAEP {
+		return rsa.EncryptPKCS1v15(cryptoprovider.Reader(), pub, key)
+	}
+	if !t.Hash.Available() {
+		return nil, fmt.Errorf("hash %v is not available", t.Hash)
+	}
+
+	return rsa.EncryptOAEP(t.Hash.New(), cryptoprovider.Reader(), pub, key, t.Label)
+}
+
+// DecryptKey decrypts a key encrypted under the public key of priv.
+func DecryptKey(priv *rsa.PrivateKey, t Transport, encrypted []byte) ([]byte, error) {
+	if !t.OAEP {
+		return rsa.DecryptPKCS1v15(nil, priv, encrypted)
+	}
+	if !t.Hash.Available() {
+		return nil, fmt.Errorf("hash %v is not available", t.Hash)
+	}
+
+	return rsa.DecryptOAEP(t.Hash.New(), nil, priv, encrypted, t.Label)
+}
@@ -0,0 +1,67 @@
+// Package insecure gates test features that disclose clear key material. The features are
+// refused unless they are enabled for a single invocation with --insecure-test-features or
+// until a configured deadline, and every use is recorded in the audit log.
+package insecure
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/andrei-cloud/go_hsm/internal/privileged"
+	"github.com/rs/zerolog"
+)
+
+// MaxWindow bounds how far ahead a configured deadline may lie, so test features cannot be
+// left enabled indefinitely.
+const MaxWindow = 24 * time.Hour
+
+var (
+	// ErrDisabled is returned when test features have not been enabled.
+	ErrDisabled = errors.New(
+		"insecure test features are disabled (use --insecure-test-features or insecure.test_features_until)",
+	)
+	// ErrExpired is returned when the configured deadline has passed.
+	ErrExpired = errors.New("insecure test features expired")
+	// ErrWindowTooLong is returned when the configured deadline exceeds MaxWindow.
+	ErrWindowTooLong = errors.New("insecure test features window exceeds 24h")
+)
+
+// deadline gates the test features.
+var deadline = privileged.Deadline{
+	Setting:          "insecure.test_features_until",
+	Max:              MaxWindow,
+	ErrDisabled:      ErrDisabled,
+	ErrExpired:       ErrExpired,
+	ErrWindowTooLong: ErrWindowTooLong,
+}
+
+// Gate decides whether test features may run.
+type Gate struct {
+	// Flag enables the features for the current invocation only.
+	Flag bool
+	// Until is an RFC 3339 deadline after which configured enablement lapses.
+	Until string
+}
+
+// Check returns nil when test features are enabled at now.
+func (g Gate) Check(now time.Time) error {
+	return deadline.Check(g.Flag, g.Until, now)
+}
+
+// Auditor records every use of a test feature in the audit log. Clear values are never
+// logged; callers pass identifying data such as key check values only.
+type Auditor struct {
+	w *privileged.AuditWriter
+}
+
+// NewAuditor echoes audit records to stderr and appends them to the audit log at path.
+func NewAuditor(stderr io.Writer, path string) *Auditor {
+	return &Auditor{w: privileged.NewAuditWriter(stderr, path)}
+}
+
+// Record records event, the use of a test feature, with the given fields. The record is
+// echoed at warning level.
+func (a *Auditor) Record(event string, fields map[string]string) error {
+	return a.w.Write(zerolog.WarnLevel, event, fields, "INSECURE TEST FEATURE USED: clear value disclosed")
+}
@@ -0,0 +1,70 @@
+package insecure
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andrei-cloud/go_hsm/internal/audit"
+)
+
+func TestGateCheck(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		gate Gate
+		want error
+	}{
+		{"disabled", Gate{}, ErrDisabled},
+		{"flag", Gate{Flag: true, Until: "2020-01-01T00:00:00Z"}, nil},
+		{"within window", Gate{Until: "2024-05-01T18:00:00Z"}, nil},
+		{"expired", Gate{Until: "2024-05-01T11:59:59Z"}, ErrExpired},
+		{"window too long", Gate{Until: "2024-05-03T12:00:00Z"}, ErrWindowTooLong},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			if err := tc.gate.Check(now); !errors.Is(err, tc.want) {
+				t.Errorf("Check() = %v, want %v", err, tc.want)
+			}
+		})
+	}
+
+	if err := (Gate{Until: "tomorrow"}).Check(now); err == nil {
+		t.Error("expected error for invalid deadline")
+	}
+}
+
+func TestAuditorRecord(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "audit", "audit.jsonl")
+	var stderr bytes.Buffer
+	auditor := NewAuditor(&stderr, path)
+	if err := auditor.Record("clear_key_displayed", map[string]string{"kcv": "9A1D1C"}); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+
+	logged, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read audit log: %v", err)
+	}
+	if n, err := audit.Verify(bytes.NewReader(logged)); err != nil || n != 1 {
+		t.Errorf("audit.Verify() = %d, %v, want 1 record", n, err)
+	}
+	if !strings.Contains(string(logged), `"event":"clear_key_displayed"`) ||
+		!strings.Contains(string(logged), `"kcv":"9A1D1C"`) {
+		t.Errorf("audit record = %s", logged)
+	}
+	if out := stderr.String(); !strings.Contains(out, `"event":"clear_key_displayed"`) ||
+		!strings.Contains(out, `"level":"warn"`) {
+		t.Errorf("echoed audit record = %s", out)
+	}
+}
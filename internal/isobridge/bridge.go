@@ -0,0 +1,260 @@
+package isobridge
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/andrei-cloud/anet"
+	"github.com/andrei-cloud/go_hsm/pkg/iso8583"
+	"github.com/rs/zerolog/log"
+)
+
+// Bridge modes.
+const (
+	ModeVerify    = "verify"    // verify the PIN with DC and answer with DE39
+	ModeTranslate = "translate" // translate the PIN with CA and replace DE52
+)
+
+// ISO 8583 response codes set in DE39.
+const (
+	respApproved     = "00"
+	respIncorrectPIN = "55"
+	respSystemError  = "96"
+)
+
+// taskIDSize is the size of the request identifier that precedes each HSM message.
+const taskIDSize = 4
+
+// Exchanger sends a host command to an HSM and returns the response.
+type Exchanger interface {
+	Exchange(cmd []byte) ([]byte, error)
+}
+
+// Config holds the bridge configuration.
+type Config struct {
+	Mode      string // ModeVerify or ModeTranslate
+	TPK       string // terminal PIN key under LMK, with scheme tag
+	ZPK       string // destination zone PIN key under LMK, translate mode
+	PVK       string // PIN verification key under LMK, verify mode
+	DstFormat string // destination PIN block format code, translate mode
+	PVKI      string // PIN verification key index, verify mode
+	PVV       string // expected PIN verification value, verify mode
+}
+
+// Bridge translates ISO 8583 PIN messages into HSM host commands.
+type Bridge struct {
+	cfg Config
+	hsm Exchanger
+}
+
+// TCPExchanger talks to the HSM using the length-prefixed framing of the HSM server.
+type TCPExchanger struct {
+	Addr    string
+	Timeout time.Duration
+
+	mu     sync.Mutex
+	conn   net.Conn
+	taskID atomic.Uint32
+}
+
+// New creates a bridge that forwards commands to hsm.
+func New(cfg Config, hsm Exchanger) (*Bridge, error) {
+	switch cfg.Mode {
+	case ModeVerify:
+		if cfg.TPK == "" || cfg.PVK == "" || cfg.PVKI == "" || cfg.PVV == "" {
+			return nil, errors.New("verify mode requires tpk, pvk, pvki and pvv")
+		}
+	case ModeTranslate:
+		if cfg.TPK == "" || cfg.ZPK == "" {
+			return nil, errors.New("translate mode requires tpk and zpk")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported bridge mode %q", cfg.Mode)
+	}
+
+	return &Bridge{cfg: cfg, hsm: hsm}, nil
+}
+
+// Handle processes a single ISO 8583 request and returns the ISO 8583 response.
+func (b *Bridge) Handle(req []byte) ([]byte, error) {
+	msg, err := iso8583.Unpack(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack request: %w", err)
+	}
+
+	resp := iso8583.NewMessage(iso8583.ResponseMTI(msg.MTI))
+	for n, v := range msg.Fields {
+		resp.Set(n, v)
+	}
+
+	code, err := b.process(msg, resp)
+	if err != nil {
+		log.Error().Err(err).Str("mti", msg.MTI).Msg("iso8583 bridge operation failed")
+	}
+	resp.Set(iso8583.FieldResponseCode, []byte(code))
+
+	return resp.Pack()
+}
+
+// process runs the configured HSM operation and returns the DE39 response code.
+func (b *Bridge) process(msg, resp *iso8583.Message) (string, error) {
+	pin, err := ExtractPINData(msg)
+	if err != nil {
+		return respSystemError, err
+	}
+
+	var cmd []byte
+	if b.cfg.Mode == ModeVerify {
+		cmd = BuildDC(b.cfg.TPK, b.cfg.PVK, pin, b.cfg.PVKI, b.cfg.PVV)
+	} else {
+		cmd = BuildCA(b.cfg.TPK, b.cfg.ZPK, pin, b.cfg.DstFormat)
+	}
+
+	out, err := b.hsm.Exchange(cmd)
+	if err != nil {
+		return respSystemError, err
+	}
+	if len(out) < 4 {
+		return respSystemError, fmt.Errorf("short hsm response %q", out)
+	}
+
+	switch hsmCode := string(out[2:4]); hsmCode {
+	case "00":
+	case "01":
+		return respIncorrectPIN, nil
+	default:
+		return respSystemError, fmt.Errorf("hsm returned error code %s", hsmCode)
+	}
+
+	if b.cfg.Mode == ModeTranslate {
+		// CB response: CB + 00 + PIN length (2) + PIN block (16) + format (2).
+		if len(out) < 4+2+16 {
+			return respSystemError, fmt.Errorf("short hsm response %q", out)
+		}
+		if err := iso8583.SetPINBlock(resp, string(out[6:22])); err != nil {
+			return respSystemError, err
+		}
+	}
+
+	return respApproved, nil
+}
+
+// Serve accepts ISO 8583 connections on ln until ctx is canceled.
+// Messages are framed with a two byte big-endian length header.
+func (b *Bridge) Serve(ctx context.Context, ln net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		_ = ln.Close()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return fmt.Errorf("accept failed: %w", err)
+		}
+		go b.serveConn(conn)
+	}
+}
+
+func (b *Bridge) serveConn(conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	for {
+		req, err := anet.Read(conn)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Error().Err(err).Msg("iso8583 bridge read failed")
+			}
+
+			return
+		}
+
+		resp, err := b.Handle(req)
+		if err != nil {
+			log.Error().Err(err).Msg("iso8583 bridge request rejected")
+
+			return
+		}
+		if err := anet.Write(conn, resp); err != nil {
+			log.Error().Err(err).Msg("iso8583 bridge write failed")
+
+			return
+		}
+	}
+}
+
+// Exchange sends cmd to the HSM and returns the response without the request identifier.
+func (e *TCPExchanger) Exchange(cmd []byte) ([]byte, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.conn == nil {
+		conn, err := net.DialTimeout("tcp", e.Addr, e.timeout())
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to hsm: %w", err)
+		}
+		e.conn = conn
+	}
+
+	req := make([]byte, taskIDSize, taskIDSize+len(cmd))
+	binary.BigEndian.PutUint32(req, e.taskID.Add(1))
+	req = append(req, cmd...)
+
+	_ = e.conn.SetDeadline(time.Now().Add(e.timeout()))
+	if err := anet.Write(e.conn, req); err != nil {
+		e.reset()
+
+		return nil, fmt.Errorf("failed to send to hsm: %w", err)
+	}
+	resp, err := anet.Read(e.conn)
+	if err != nil {
+		e.reset()
+
+		return nil, fmt.Errorf("failed to read from hsm: %w", err)
+	}
+	if len(resp) < taskIDSize {
+		return nil, errors.New("hsm response missing request identifier")
+	}
+
+	return resp[taskIDSize:], nil
+}
+
+// Close closes the HSM connection.
+func (e *TCPExchanger) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.conn == nil {
+		return nil
+	}
+	err := e.conn.Close()
+	e.conn = nil
+
+	return err
+}
+
+func (e *TCPExchanger) reset() {
+	_ = e.conn.Close()
+	e.conn = nil
+}
+
+func (e *TCPExchanger) timeout() time.Duration {
+	if e.Timeout <= 0 {
+		return 5 * time.Second
+	}
+
+	return e.Timeout
+}
@@ -0,0 +1,153 @@
+package isobridge
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/internal/hsm/logic"
+	"github.com/andrei-cloud/go_hsm/pkg/iso8583"
+)
+
+const (
+	testTPK = "U0123456789ABCDEFFEDCBA9876543210"
+	testPVK = "U0123456789ABCDEF0123456789ABCDEF"
+)
+
+// logicExchanger executes host commands with the in-process command logic.
+type logicExchanger struct{}
+
+func (logicExchanger) Exchange(cmd []byte) ([]byte, error) {
+	var (
+		out []byte
+		err error
+	)
+	switch string(cmd[:2]) {
+	case "DC":
+		out, err = logic.ExecuteDC(cmd[2:])
+	case "CA":
+		out, err = logic.ExecuteCA(cmd[2:])
+	default:
+		return nil, errors.New("unexpected command")
+	}
+	if err != nil {
+		var hsmErr errorcodes.HSMError
+		if !errors.As(err, &hsmErr) {
+			hsmErr = errorcodes.Err68
+		}
+		respCode := string([]byte{cmd[0], cmd[1] + 1})
+
+		return []byte(respCode + hsmErr.CodeOnly()), nil
+	}
+
+	return out, nil
+}
+
+func testRequest(t *testing.T) []byte {
+	t.Helper()
+
+	msg := iso8583.NewMessage("0200")
+	msg.Set(iso8583.FieldPAN, []byte("40003455138049375"))
+	msg.Set(11, []byte("000001"))
+	msg.Set(iso8583.FieldSecurityControl, []byte("2001010100000000"))
+	if err := iso8583.SetPINBlock(msg, "CB4EBC0180DFED6E"); err != nil {
+		t.Fatalf("failed to set pin block: %v", err)
+	}
+
+	data, err := msg.Pack()
+	if err != nil {
+		t.Fatalf("failed to pack request: %v", err)
+	}
+
+	return data
+}
+
+func TestBuildCommands(t *testing.T) {
+	t.Parallel()
+
+	pin := PINData{PINBlock: "CB4EBC0180DFED6E", FormatCode: "01", Account: "345513804937"}
+
+	if got := string(BuildDC(testTPK, testPVK, pin, "1", "2677")); got != "DC"+testTPK+testPVK+
+		"CB4EBC0180DFED6E01345513804937"+"1"+"2677" {
+		t.Errorf("unexpected DC command %s", got)
+	}
+	if got := string(BuildCA(testTPK, testPVK, pin, "")); got != "CA"+testTPK+testPVK+
+		"12CB4EBC0180DFED6E0101345513804937" {
+		t.Errorf("unexpected CA command %s", got)
+	}
+}
+
+func TestBridgeHandle(t *testing.T) {
+	t.Parallel()
+
+	if err := logic.SetupTestLMKProvider(); err != nil {
+		t.Fatalf("failed to setup test LMK provider: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		cfg          Config
+		wantCode     string
+		wantPINBlock string
+	}{
+		{
+			name:     "verify approved",
+			cfg:      Config{Mode: ModeVerify, TPK: testTPK, PVK: testPVK, PVKI: "1", PVV: "2677"},
+			wantCode: "00",
+		},
+		{
+			name:     "verify incorrect pin",
+			cfg:      Config{Mode: ModeVerify, TPK: testTPK, PVK: testPVK, PVKI: "1", PVV: "2678"},
+			wantCode: "55",
+		},
+		{
+			name:         "translate",
+			cfg:          Config{Mode: ModeTranslate, TPK: testTPK, ZPK: testTPK},
+			wantCode:     "00",
+			wantPINBlock: "CB4EBC0180DFED6E",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			b, err := New(tc.cfg, logicExchanger{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			out, err := b.Handle(testRequest(t))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			resp, err := iso8583.Unpack(out)
+			if err != nil {
+				t.Fatalf("failed to unpack response: %v", err)
+			}
+			if resp.MTI != "0210" {
+				t.Errorf("unexpected mti %s", resp.MTI)
+			}
+			if code := string(resp.Fields[iso8583.FieldResponseCode]); code != tc.wantCode {
+				t.Errorf("response code = %s, want %s", code, tc.wantCode)
+			}
+			if tc.wantPINBlock != "" {
+				if pb, _ := iso8583.PINBlock(resp); pb != tc.wantPINBlock {
+					t.Errorf("pin block = %s, want %s", pb, tc.wantPINBlock)
+				}
+			}
+		})
+	}
+}
+
+func TestNewRejectsIncompleteConfig(t *testing.T) {
+	t.Parallel()
+
+	if _, err := New(Config{Mode: ModeVerify, TPK: testTPK}, logicExchanger{}); err == nil {
+		t.Error("expected error for incomplete verify config")
+	}
+	if _, err := New(Config{Mode: "other"}, logicExchanger{}); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
@@ -0,0 +1,75 @@
+// Package isobridge connects ISO 8583 traffic to the HSM host command interface.
+// It builds DC and CA host commands from the PIN data of ISO 8583 messages (DE2/DE35,
+// DE52 and DE53) and provides a bridge that listens for ISO 8583 messages and forwards
+// the crypto operation to an HSM.
+package isobridge
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/andrei-cloud/go_hsm/pkg/iso8583"
+)
+
+// defaultMaxPINLength is the maximum PIN length sent in CA commands.
+const defaultMaxPINLength = 12
+
+var errUnsupportedPINFormat = errors.New("unsupported de53 pin block format")
+
+// PINData is the PIN related content of an ISO 8583 message.
+type PINData struct {
+	PINBlock   string // DE52 as hex
+	FormatCode string // Thales PIN block format code derived from DE53
+	Account    string // 12 rightmost PAN digits excluding the check digit
+	Security   iso8583.SecurityControlInfo
+}
+
+// ExtractPINData extracts the PIN block, PIN block format and account number from msg.
+func ExtractPINData(msg *iso8583.Message) (PINData, error) {
+	pinBlock, err := iso8583.PINBlock(msg)
+	if err != nil {
+		return PINData{}, err
+	}
+
+	sec, err := iso8583.SecurityControl(msg)
+	if err != nil {
+		return PINData{}, err
+	}
+	if !sec.ThalesFormatCodeOK {
+		return PINData{}, fmt.Errorf("%w: %s", errUnsupportedPINFormat, sec.PINBlockFormat)
+	}
+
+	pan, err := iso8583.PAN(msg)
+	if err != nil {
+		return PINData{}, err
+	}
+	account, err := iso8583.AccountNumber(pan)
+	if err != nil {
+		return PINData{}, err
+	}
+
+	return PINData{
+		PINBlock:   pinBlock,
+		FormatCode: sec.ThalesFormatCode,
+		Account:    account,
+		Security:   sec,
+	}, nil
+}
+
+// BuildCA builds a CA (Translate PIN from TPK to ZPK) host command.
+// tpk and zpk are keys encrypted under LMK including their scheme tag.
+func BuildCA(tpk, zpk string, pin PINData, dstFormat string) []byte {
+	if dstFormat == "" {
+		dstFormat = pin.FormatCode
+	}
+
+	return fmt.Appendf(nil, "CA%s%s%02d%s%s%s%s",
+		tpk, zpk, defaultMaxPINLength, pin.PINBlock, pin.FormatCode, dstFormat, pin.Account)
+}
+
+// BuildDC builds a DC (Verify terminal PIN using Visa PVV) host command.
+// tpk and pvk are keys encrypted under LMK including their scheme tag.
+func BuildDC(tpk, pvk string, pin PINData, pvki, pvv string) []byte {
+	return fmt.Appendf(nil, "DC%s%s%s%s%s%s%s",
+		tpk, pvk, pin.PINBlock, pin.FormatCode, pin.Account, pvki, pvv)
+}
@@ -0,0 +1,147 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
+)
+
+// Archive layout: magic || iterations (4 bytes, big endian) || salt || nonce || AES-256-GCM
+// ciphertext of the serialized store. The header is authenticated as additional data.
+const (
+	archiveMagic      = "GOHSMKS1"
+	archiveSaltSize   = 16
+	archiveNonceSize  = 12
+	archiveHeaderSize = len(archiveMagic) + 4 + archiveSaltSize + archiveNonceSize
+	archiveKeySize    = 32
+
+	// DefaultIterations is the PBKDF2-HMAC-SHA256 iteration count used for new archives.
+	DefaultIterations = 210000
+)
+
+var (
+	// ErrInvalidArchive is returned when the archive header is malformed.
+	ErrInvalidArchive = errors.New("invalid key store archive")
+	// ErrArchiveAuth is returned when the passphrase is wrong or the archive was modified.
+	ErrArchiveAuth = errors.New("archive authentication failed")
+)
+
+// Backup writes an encrypted, integrity-protected archive of the store to w.
+// The keys remain wrapped under their LMKs inside the archive.
+func (s *Store) Backup(w io.Writer, passphrase string) error {
+	return s.backup(w, passphrase, DefaultIterations)
+}
+
+// Restore loads keys from an archive produced by Backup into the store.
+// Existing keys with the same ID are kept unless overwrite is true, in which case
+// they are replaced. It returns the number of keys restored.
+func (s *Store) Restore(r io.Reader, passphrase string, overwrite bool) (int, error) {
+	keys, err := readArchive(r, passphrase)
+	if err != nil {
+		return 0, err
+	}
+
+	restored := 0
+	for _, k := range keys {
+		if overwrite {
+			if err := s.Put(k); err != nil {
+				return restored, err
+			}
+		} else if err := s.Add(k); err != nil {
+			if errors.Is(err, ErrKeyExists) {
+				continue
+			}
+
+			return restored, err
+		}
+		restored++
+	}
+
+	return restored, nil
+}
+
+func (s *Store) backup(w io.Writer, passphrase string, iterations int) error {
+	if passphrase == "" {
+		return errors.New("passphrase is required")
+	}
+
+	plain, err := encodeKeys(s.List())
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, archiveHeaderSize)
+	copy(header, archiveMagic)
+	binary.BigEndian.PutUint32(header[len(archiveMagic):], uint32(iterations))
+	salt := header[len(archiveMagic)+4 : len(archiveMagic)+4+archiveSaltSize]
+	nonce := header[len(archiveMagic)+4+archiveSaltSize:]
+	if _, err := cryptoprovider.Read(salt); err != nil {
+		return fmt.Errorf("failed to generate salt: %w", err)
+	}
+	if _, err := cryptoprovider.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	aead, err := archiveCipher(passphrase, salt, iterations)
+	if err != nil {
+		return err
+	}
+
+	out := aead.Seal(bytes.Clone(header), nonce, plain, header)
+	if _, err := w.Write(out); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	return nil
+}
+
+func readArchive(r io.Reader, passphrase string) ([]Key, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	if len(data) < archiveHeaderSize || string(data[:len(archiveMagic)]) != archiveMagic {
+		return nil, ErrInvalidArchive
+	}
+
+	header := data[:archiveHeaderSize]
+	iterations := int(binary.BigEndian.Uint32(header[len(archiveMagic):]))
+	if iterations <= 0 {
+		return nil, ErrInvalidArchive
+	}
+	salt := header[len(archiveMagic)+4 : len(archiveMagic)+4+archiveSaltSize]
+	nonce := header[len(archiveMagic)+4+archiveSaltSize:]
+
+	aead, err := archiveCipher(passphrase, salt, iterations)
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := aead.Open(nil, nonce, data[archiveHeaderSize:], header)
+	if err != nil {
+		return nil, ErrArchiveAuth
+	}
+
+	return decodeKeys(plain)
+}
+
+func archiveCipher(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iterations, archiveKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive archive key: %w", err)
+	}
+
+	block, err := cryptoprovider.NewAESCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive cipher: %w", err)
+	}
+
+	return cipher.NewGCM(block)
+}
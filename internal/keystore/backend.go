@@ -0,0 +1,177 @@
+package keystore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Backend persists the serialized key store. The store keeps its keys in memory and
+// hands the backend the whole document on every save, so a backend only needs to hold
+// one value.
+type Backend interface {
+	// Load returns the saved document, or nil when nothing has been saved yet.
+	Load() ([]byte, error)
+	// Save replaces the saved document.
+	Save(data []byte) error
+	// String describes where the document is kept.
+	String() string
+}
+
+// BackendFactory opens a backend from the location part of a store URL.
+type BackendFactory func(location string) (Backend, error)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = map[string]BackendFactory{
+		"file": func(location string) (Backend, error) { return FileBackend(location), nil },
+		"sql":  openSQLBackend,
+	}
+)
+
+// RegisterBackend makes a backend available to OpenURL under scheme, for example a BoltDB
+// backend built into a custom binary.
+func RegisterBackend(scheme string, factory BackendFactory) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	backends[scheme] = factory
+}
+
+// OpenURL opens the key store at url, written as scheme:location with a registered
+// backend scheme: file:/path/keystore.json or sql:driver:dsn. A url without a registered
+// scheme is a file path.
+func OpenURL(url string) (*Store, error) {
+	if scheme, location, ok := strings.Cut(url, ":"); ok {
+		backendsMu.RLock()
+		factory, found := backends[scheme]
+		backendsMu.RUnlock()
+		if found {
+			backend, err := factory(location)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open %s key store backend: %w", scheme, err)
+			}
+
+			return OpenBackend(backend)
+		}
+	}
+
+	return Open(url)
+}
+
+// FileBackend keeps the store in a JSON file, replaced atomically on save.
+type FileBackend string
+
+// Load reads the file; a missing file yields nil.
+func (f FileBackend) Load() ([]byte, error) {
+	data, err := os.ReadFile(string(f))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key store: %w", err)
+	}
+
+	return data, nil
+}
+
+// Save writes the file through a temporary file and a rename.
+func (f FileBackend) Save(data []byte) error {
+	path := string(f)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create key store directory: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write key store: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace key store: %w", err)
+	}
+
+	return nil
+}
+
+// String returns the file path.
+func (f FileBackend) String() string {
+	return string(f)
+}
+
+// sqlTable is the table of SQLBackend documents.
+const sqlTable = "gohsm_keystore"
+
+// SQLBackend keeps the store as a row of a gohsm_keystore table in a database/sql database.
+// Statements use ? placeholders, as SQLite and MySQL drivers accept.
+type SQLBackend struct {
+	db   *sql.DB
+	name string
+}
+
+// NewSQLBackend returns a backend keeping the store named name in db, creating the table
+// when it does not exist.
+func NewSQLBackend(db *sql.DB, name string) (*SQLBackend, error) {
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS " + sqlTable +
+		" (name VARCHAR(64) PRIMARY KEY, data BLOB NOT NULL)"); err != nil {
+		return nil, fmt.Errorf("failed to create key store table: %w", err)
+	}
+
+	return &SQLBackend{db: db, name: name}, nil
+}
+
+// openSQLBackend opens the driver:dsn location with a driver registered in the binary.
+func openSQLBackend(location string) (Backend, error) {
+	driver, dsn, ok := strings.Cut(location, ":")
+	if !ok || driver == "" {
+		return nil, fmt.Errorf("sql location %q must be driver:dsn", location)
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSQLBackend(db, "default")
+}
+
+// Load reads the row of the store; a missing row yields nil.
+func (b *SQLBackend) Load() ([]byte, error) {
+	var data []byte
+	err := b.db.QueryRow("SELECT data FROM "+sqlTable+" WHERE name = ?", b.name).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key store: %w", err)
+	}
+
+	return data, nil
+}
+
+// Save replaces the row of the store in one transaction.
+func (b *SQLBackend) Save(data []byte) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to write key store: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.Exec("DELETE FROM "+sqlTable+" WHERE name = ?", b.name); err != nil {
+		return fmt.Errorf("failed to write key store: %w", err)
+	}
+	if _, err := tx.Exec("INSERT INTO "+sqlTable+" (name, data) VALUES (?, ?)", b.name, data); err != nil {
+		return fmt.Errorf("failed to write key store: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to write key store: %w", err)
+	}
+
+	return nil
+}
+
+// String names the table row.
+func (b *SQLBackend) String() string {
+	return fmt.Sprintf("sql %s/%s", sqlTable, b.name)
+}
@@ -0,0 +1,308 @@
+// Package keystore provides a persistent store for keys kept under LMK.
+// Keys are never stored in the clear; each entry holds the LMK-encrypted key
+// value together with the metadata needed to use it again. The store is kept
+// in a JSON file by default, or in any Backend.
+package keystore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// storeVersion is the on-disk format version of the key store file.
+const storeVersion = 1
+
+var (
+	// ErrKeyExists is returned when adding a key whose ID is already in use.
+	ErrKeyExists = errors.New("key already exists")
+	// ErrKeyNotFound is returned when a key ID is not present in the store.
+	ErrKeyNotFound = errors.New("key not found")
+	// ErrInvalidKey is returned when a key entry is missing mandatory fields.
+	ErrInvalidKey = errors.New("invalid key entry")
+)
+
+// Key is a single key held in the store, encrypted under an LMK.
+type Key struct {
+	ID      string `json:"id"`
+	LMKID   string `json:"lmk_id"`
+	KeyType string `json:"key_type"`
+	Scheme  string `json:"scheme"`
+	Value   string `json:"value"`
+	KCV     string `json:"kcv,omitempty"`
+	// Usage is the key usage of a key block, such as K0 or P0.
+	Usage     string    `json:"usage,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	// Tags holds free-form labels such as environment, partner or expiry.
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// Filter selects keys by tag, key type, key usage and check value. Empty fields match
+// every key.
+type Filter struct {
+	// Tags must all be present on a key; an empty value matches any value of the tag.
+	Tags map[string]string
+	// KeyTypes lists key type codes, any of which matches.
+	KeyTypes []string
+	// Usages lists key block key usages, any of which matches.
+	Usages []string
+	// KCV is a check value, matched against the start of the stored one.
+	KCV string
+}
+
+// Match reports whether k satisfies the filter.
+func (f Filter) Match(k Key) bool {
+	for name, want := range f.Tags {
+		got, ok := k.Tags[name]
+		if !ok || (want != "" && !strings.EqualFold(got, want)) {
+			return false
+		}
+	}
+	if f.KCV != "" && (k.KCV == "" || !strings.HasPrefix(strings.ToUpper(k.KCV), strings.ToUpper(f.KCV))) {
+		return false
+	}
+
+	return matchAny(f.KeyTypes, k.KeyType) && matchAny(f.Usages, k.Usage)
+}
+
+// matchAny reports whether value equals one of values, ignoring case, or values is empty.
+func matchAny(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if strings.EqualFold(value, v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseTags parses name=value pairs into a tag map. A pair without "=" yields an empty
+// value, which as a filter matches any value of the tag.
+func ParseTags(pairs []string) (map[string]string, error) {
+	tags := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		name, value, _ := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fmt.Errorf("%w: empty tag name in %q", ErrInvalidKey, pair)
+		}
+		tags[name] = strings.TrimSpace(value)
+	}
+
+	return tags, nil
+}
+
+// Store is a collection of keys persisted by a Backend.
+type Store struct {
+	backend Backend
+	mu      sync.RWMutex
+	keys    map[string]Key
+}
+
+// storeFile is the serialized representation of a Store.
+type storeFile struct {
+	Version int   `json:"version"`
+	Keys    []Key `json:"keys"`
+}
+
+// Open loads the key store in the file at path. A missing file yields an empty store.
+func Open(path string) (*Store, error) {
+	return OpenBackend(FileBackend(path))
+}
+
+// OpenBackend loads the key store kept by backend. A backend that has nothing saved yields
+// an empty store.
+func OpenBackend(backend Backend) (*Store, error) {
+	s := &Store{backend: backend, keys: make(map[string]Key)}
+
+	data, err := backend.Load()
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return s, nil
+	}
+
+	keys, err := decodeKeys(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		s.keys[k.ID] = k
+	}
+
+	return s, nil
+}
+
+// Path describes where the store is kept: the file path for file-backed stores.
+func (s *Store) Path() string {
+	return s.backend.String()
+}
+
+// Add inserts a new key. The ID must not already exist.
+func (s *Store) Add(k Key) error {
+	if err := validateKey(k); err != nil {
+		return err
+	}
+	if k.CreatedAt.IsZero() {
+		k.CreatedAt = time.Now().UTC()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.keys[k.ID]; ok {
+		return fmt.Errorf("%w: %s", ErrKeyExists, k.ID)
+	}
+	s.keys[k.ID] = k
+
+	return nil
+}
+
+// Put inserts or replaces a key.
+func (s *Store) Put(k Key) error {
+	if err := validateKey(k); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[k.ID] = k
+
+	return nil
+}
+
+// Get returns the key with the given ID.
+func (s *Store) Get(id string) (Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	k, ok := s.keys[id]
+	if !ok {
+		return Key{}, fmt.Errorf("%w: %s", ErrKeyNotFound, id)
+	}
+
+	return k, nil
+}
+
+// Delete removes the key with the given ID.
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.keys[id]; !ok {
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, id)
+	}
+	delete(s.keys, id)
+
+	return nil
+}
+
+// List returns all keys sorted by ID.
+func (s *Store) List() []Key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]Key, 0, len(s.keys))
+	for _, k := range s.keys {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+
+	return keys
+}
+
+// Find returns the keys matching f sorted by ID.
+func (s *Store) Find(f Filter) []Key {
+	var keys []Key
+	for _, k := range s.List() {
+		if f.Match(k) {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys
+}
+
+// Tag sets the given tags on a key and removes the tags named in remove.
+func (s *Store) Tag(id string, set map[string]string, remove []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.keys[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, id)
+	}
+
+	tags := make(map[string]string, len(k.Tags)+len(set))
+	for name, value := range k.Tags {
+		tags[name] = value
+	}
+	for name, value := range set {
+		tags[name] = value
+	}
+	for _, name := range remove {
+		delete(tags, name)
+	}
+	if len(tags) == 0 {
+		tags = nil
+	}
+	k.Tags = tags
+	s.keys[id] = k
+
+	return nil
+}
+
+// Len returns the number of keys in the store.
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.keys)
+}
+
+// Save writes the store to its backend.
+func (s *Store) Save() error {
+	data, err := encodeKeys(s.List())
+	if err != nil {
+		return err
+	}
+
+	return s.backend.Save(data)
+}
+
+func validateKey(k Key) error {
+	if k.ID == "" || k.Value == "" {
+		return fmt.Errorf("%w: id and value are required", ErrInvalidKey)
+	}
+
+	return nil
+}
+
+func encodeKeys(keys []Key) ([]byte, error) {
+	data, err := json.MarshalIndent(storeFile{Version: storeVersion, Keys: keys}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode key store: %w", err)
+	}
+
+	return data, nil
+}
+
+func decodeKeys(data []byte) ([]Key, error) {
+	var f storeFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to decode key store: %w", err)
+	}
+	if f.Version != storeVersion {
+		return nil, fmt.Errorf("unsupported key store version %d", f.Version)
+	}
+
+	return f.Keys, nil
+}
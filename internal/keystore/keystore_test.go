@@ -0,0 +1,338 @@
+package keystore
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+
+	s, err := Open(filepath.Join(t.TempDir(), "keystore.json"))
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+
+	return s
+}
+
+func TestStoreAddGetDelete(t *testing.T) {
+	t.Parallel()
+	s := newTestStore(t)
+
+	k := Key{ID: "zmk1", LMKID: "00", KeyType: "000", Scheme: "U", Value: "AABB", KCV: "123456"}
+	if err := s.Add(k); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.Add(k); !errors.Is(err, ErrKeyExists) {
+		t.Errorf("expected ErrKeyExists, got %v", err)
+	}
+	if err := s.Add(Key{ID: "empty"}); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("expected ErrInvalidKey, got %v", err)
+	}
+
+	got, err := s.Get("zmk1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Value != "AABB" || got.CreatedAt.IsZero() {
+		t.Errorf("unexpected key: %+v", got)
+	}
+
+	if err := s.Delete("zmk1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := s.Get("zmk1"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestStoreSaveAndReopen(t *testing.T) {
+	t.Parallel()
+	s := newTestStore(t)
+
+	for _, id := range []string{"b", "a"} {
+		if err := s.Add(Key{ID: id, LMKID: "00", Value: "00" + id}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := s.Save(); err != nil {
+		t.Fatalf("failed to save store: %v", err)
+	}
+
+	reopened, err := Open(s.Path())
+	if err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+	keys := reopened.List()
+	if len(keys) != 2 || keys[0].ID != "a" || keys[1].ID != "b" {
+		t.Errorf("unexpected keys after reopen: %+v", keys)
+	}
+}
+
+func TestStoreBackupRestore(t *testing.T) {
+	t.Parallel()
+	src := newTestStore(t)
+	if err := src.Add(Key{ID: "tpk", LMKID: "00", KeyType: "002", Scheme: "U", Value: "CAFE"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var archive bytes.Buffer
+	if err := src.backup(&archive, "secret", 1000); err != nil {
+		t.Fatalf("backup failed: %v", err)
+	}
+	if bytes.Contains(archive.Bytes(), []byte("CAFE")) {
+		t.Error("archive must not contain plaintext store content")
+	}
+
+	tests := []struct {
+		name       string
+		passphrase string
+		mutate     func([]byte) []byte
+		wantErr    error
+		wantCount  int
+	}{
+		{
+			name:       "valid passphrase",
+			passphrase: "secret",
+			wantCount:  1,
+		},
+		{
+			name:       "wrong passphrase",
+			passphrase: "wrong",
+			wantErr:    ErrArchiveAuth,
+		},
+		{
+			name:       "tampered ciphertext",
+			passphrase: "secret",
+			mutate: func(b []byte) []byte {
+				b[len(b)-1] ^= 0x01
+
+				return b
+			},
+			wantErr: ErrArchiveAuth,
+		},
+		{
+			name:       "truncated archive",
+			passphrase: "secret",
+			mutate:     func(b []byte) []byte { return b[:10] },
+			wantErr:    ErrInvalidArchive,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			data := bytes.Clone(archive.Bytes())
+			if tc.mutate != nil {
+				data = tc.mutate(data)
+			}
+
+			dst := newTestStore(t)
+			n, err := dst.Restore(bytes.NewReader(data), tc.passphrase, false)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("expected %v, got %v", tc.wantErr, err)
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if n != tc.wantCount {
+				t.Errorf("expected %d restored keys, got %d", tc.wantCount, n)
+			}
+			k, err := dst.Get("tpk")
+			if err != nil || k.Value != "CAFE" {
+				t.Errorf("unexpected restored key %+v, err %v", k, err)
+			}
+		})
+	}
+}
+
+func TestStoreRestoreOverwrite(t *testing.T) {
+	t.Parallel()
+	src := newTestStore(t)
+	_ = src.Add(Key{ID: "k", Value: "NEW"})
+
+	var archive bytes.Buffer
+	if err := src.backup(&archive, "pw", 1000); err != nil {
+		t.Fatalf("backup failed: %v", err)
+	}
+
+	dst := newTestStore(t)
+	_ = dst.Add(Key{ID: "k", Value: "OLD"})
+
+	n, err := dst.Restore(bytes.NewReader(archive.Bytes()), "pw", false)
+	if err != nil || n != 0 {
+		t.Fatalf("expected existing key to be kept, got n=%d err=%v", n, err)
+	}
+	if k, _ := dst.Get("k"); k.Value != "OLD" {
+		t.Errorf("expected OLD value, got %s", k.Value)
+	}
+
+	n, err = dst.Restore(bytes.NewReader(archive.Bytes()), "pw", true)
+	if err != nil || n != 1 {
+		t.Fatalf("expected overwrite, got n=%d err=%v", n, err)
+	}
+	if k, _ := dst.Get("k"); k.Value != "NEW" {
+		t.Errorf("expected NEW value, got %s", k.Value)
+	}
+}
+
+func TestStoreTagsAndFind(t *testing.T) {
+	t.Parallel()
+	s := newTestStore(t)
+
+	tags, err := ParseTags([]string{"partner=acme", "env=uat"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = s.Add(Key{ID: "zpk1", KeyType: "001", Value: "AA", Tags: tags})
+	_ = s.Add(Key{ID: "zpk2", KeyType: "001", Value: "BB", Tags: map[string]string{"partner": "other"}})
+	_ = s.Add(Key{ID: "tpk1", KeyType: "002", Value: "CC", Tags: map[string]string{"partner": "acme"}})
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{"all", Filter{}, []string{"tpk1", "zpk1", "zpk2"}},
+		{"tag", Filter{Tags: map[string]string{"partner": "ACME"}}, []string{"tpk1", "zpk1"}},
+		{"tag present", Filter{Tags: map[string]string{"env": ""}}, []string{"zpk1"}},
+		{
+			"tag and type",
+			Filter{Tags: map[string]string{"partner": "acme"}, KeyTypes: []string{"001"}},
+			[]string{"zpk1"},
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var got []string
+			for _, k := range s.Find(tc.filter) {
+				got = append(got, k.ID)
+			}
+			if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("Find() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	if _, err := ParseTags([]string{"=x"}); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("expected ErrInvalidKey, got %v", err)
+	}
+}
+
+func TestStoreTag(t *testing.T) {
+	t.Parallel()
+	s := newTestStore(t)
+	_ = s.Add(Key{ID: "k", Value: "AA", Tags: map[string]string{"env": "dev", "expiry": "2025-01"}})
+
+	if err := s.Tag("k", map[string]string{"env": "uat", "partner": "acme"}, []string{"expiry"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	k, _ := s.Get("k")
+	if len(k.Tags) != 2 || k.Tags["env"] != "uat" || k.Tags["partner"] != "acme" {
+		t.Errorf("unexpected tags: %v", k.Tags)
+	}
+	if err := s.Tag("missing", nil, nil); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestStoreFindUsageAndKCV(t *testing.T) {
+	t.Parallel()
+	s := newTestStore(t)
+	_ = s.Add(Key{ID: "kbpk", Scheme: "S", Usage: "K0", Value: "AA", KCV: "0A1B2C"})
+	_ = s.Add(Key{ID: "pek", Scheme: "S", Usage: "P0", Value: "BB", KCV: "D4E5F6"})
+	_ = s.Add(Key{ID: "zmk", Scheme: "U", KeyType: "000", Value: "CC"})
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{"usage", Filter{Usages: []string{"k0"}}, []string{"kbpk"}},
+		{"usages", Filter{Usages: []string{"K0", "P0"}}, []string{"kbpk", "pek"}},
+		{"kcv", Filter{KCV: "d4e5f6"}, []string{"pek"}},
+		{"kcv prefix", Filter{KCV: "0A1B"}, []string{"kbpk"}},
+		{"kcv and usage", Filter{KCV: "0A1B2C", Usages: []string{"P0"}}, nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var got []string
+			for _, k := range s.Find(tc.filter) {
+				got = append(got, k.ID)
+			}
+			if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("Find() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// memoryBackend keeps the store in memory.
+type memoryBackend struct{ data []byte }
+
+func (m *memoryBackend) Load() ([]byte, error)  { return m.data, nil }
+func (m *memoryBackend) Save(data []byte) error { m.data = bytes.Clone(data); return nil }
+func (m *memoryBackend) String() string         { return "memory" }
+
+func TestOpenURL(t *testing.T) {
+	t.Parallel()
+
+	mem := &memoryBackend{}
+	RegisterBackend("memtest", func(location string) (Backend, error) {
+		if location != "store" {
+			return nil, errors.New("unknown memory store")
+		}
+
+		return mem, nil
+	})
+
+	s, err := OpenURL("memtest:store")
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	if err := s.Add(Key{ID: "k", Value: "AA"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.Save(); err != nil {
+		t.Fatalf("failed to save store: %v", err)
+	}
+	reopened, err := OpenURL("memtest:store")
+	if err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+	if _, err := reopened.Get("k"); err != nil || reopened.Path() != "memory" {
+		t.Errorf("unexpected reopened store %s: %v", reopened.Path(), err)
+	}
+	if _, err := OpenURL("memtest:other"); err == nil {
+		t.Error("expected backend error")
+	}
+
+	path := filepath.Join(t.TempDir(), "keystore.json")
+	for _, url := range []string{"file:" + path, path} {
+		s, err := OpenURL(url)
+		if err != nil {
+			t.Fatalf("failed to open %s: %v", url, err)
+		}
+		if s.Path() != path {
+			t.Errorf("Path() = %s, want %s", s.Path(), path)
+		}
+	}
+	if _, err := OpenURL("sql:nodriver"); err == nil {
+		t.Error("expected error for sql location without dsn")
+	}
+}
@@ -0,0 +1,488 @@
+// Package lmkstore keeps the LMKs installed in the simulator. Each LMK is sealed with
+// AES-256-GCM under a key encryption key, given directly or derived from a master passphrase,
+// while its ID, type, status and check value stay readable so LMKs can be listed and
+// activated without unsealing them.
+package lmkstore
+
+import (
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/andrei-cloud/go_hsm/pkg/crypto"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
+	"github.com/andrei-cloud/go_hsm/pkg/variantlmk"
+)
+
+// Type is the kind of an LMK.
+type Type string
+
+// LMK types.
+const (
+	TypeVariant  Type = "variant"
+	TypeKeyBlock Type = "keyblock"
+)
+
+// Status is the life cycle state of an installed LMK.
+type Status string
+
+// LMK statuses. An installed LMK is registered for use once it is activated; a retired LMK
+// is kept but no longer registered. An old LMK is held in key change storage to translate
+// keys to the LMK with the same ID.
+const (
+	StatusInstalled Status = "installed"
+	StatusActive    Status = "active"
+	StatusRetired   Status = "retired"
+	StatusOld       Status = "old"
+)
+
+// Environment variables holding the master passphrase or the hex key encryption key.
+const (
+	PassphraseEnv = "GOHSM_LMK_PASSPHRASE"
+	KEKEnv        = "GOHSM_LMK_KEK"
+)
+
+const (
+	// KEKSize is the size in bytes of a key encryption key.
+	KEKSize = 32
+	// KeyBlockLMKSize is the size in bytes of a key block LMK.
+	KeyBlockLMKSize = 32
+	// DefaultIterations is the PBKDF2-HMAC-SHA256 iteration count of new stores.
+	DefaultIterations = 210000
+
+	saltSize  = 16
+	nonceSize = 12
+)
+
+var (
+	// ErrInvalidLMK is returned for an LMK ID, type or value that is not accepted.
+	ErrInvalidLMK = errors.New("invalid LMK")
+	// ErrLMKExists is returned when installing an LMK under an ID that is in use.
+	ErrLMKExists = errors.New("LMK already installed")
+	// ErrLMKNotFound is returned when no LMK is installed under an ID.
+	ErrLMKNotFound = errors.New("LMK not found")
+	// ErrLocked is returned when sealing or unsealing an LMK before Unlock.
+	ErrLocked = errors.New("LMK store is locked")
+	// ErrAuth is returned when the passphrase or KEK does not open the store.
+	ErrAuth = errors.New("LMK store authentication failed")
+)
+
+// LMK is an installed LMK with its sealed value.
+type LMK struct {
+	ID          string     `json:"id"`
+	Type        Type       `json:"type"`
+	Status      Status     `json:"status"`
+	KCV         string     `json:"kcv"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ActivatedAt *time.Time `json:"activated_at,omitempty"`
+	RetiredAt   *time.Time `json:"retired_at,omitempty"`
+	// Nonce and Sealed hold the AES-256-GCM encryption of the LMK, in hex.
+	Nonce  string `json:"nonce"`
+	Sealed string `json:"sealed"`
+}
+
+// document is the JSON layout of the store file.
+type document struct {
+	Salt       string `json:"salt"`
+	Iterations int    `json:"iterations"`
+	LMKs       []LMK  `json:"lmks"`
+	OldLMKs    []LMK  `json:"old_lmks,omitempty"`
+}
+
+// Store is the set of installed LMKs persisted to a JSON file.
+type Store struct {
+	path       string
+	salt       []byte
+	iterations int
+
+	mu   sync.RWMutex
+	lmks map[string]LMK
+	old  map[string]LMK
+	aead cipher.AEAD
+}
+
+// Open loads the LMK store at path. A missing file yields an empty store. The store is
+// locked: LMKs can be listed and change status, but installing or reading an LMK needs
+// Unlock or UnlockKEK first.
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path:       path,
+		iterations: DefaultIterations,
+		lmks:       make(map[string]LMK),
+		old:        make(map[string]LMK),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		s.salt = make([]byte, saltSize)
+		if _, err := cryptoprovider.Read(s.salt); err != nil {
+			return nil, fmt.Errorf("failed to generate salt: %w", err)
+		}
+
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read LMK store: %w", err)
+	}
+
+	var doc document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to decode LMK store: %w", err)
+	}
+	if s.salt, err = hex.DecodeString(doc.Salt); err != nil || len(s.salt) != saltSize || doc.Iterations <= 0 {
+		return nil, errors.New("failed to decode LMK store: invalid salt or iteration count")
+	}
+	s.iterations = doc.Iterations
+	for _, lmk := range doc.LMKs {
+		s.lmks[lmk.ID] = lmk
+	}
+	for _, lmk := range doc.OldLMKs {
+		s.old[lmk.ID] = lmk
+	}
+
+	return s, nil
+}
+
+// Path returns the file backing the store.
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Unlock derives the key encryption key from passphrase.
+func (s *Store) Unlock(passphrase string) error {
+	if passphrase == "" {
+		return errors.New("passphrase is required")
+	}
+	kek, err := pbkdf2.Key(sha256.New, passphrase, s.salt, s.iterations, KEKSize)
+	if err != nil {
+		return fmt.Errorf("failed to derive key encryption key: %w", err)
+	}
+
+	return s.UnlockKEK(kek)
+}
+
+// UnlockKEK sets the key encryption key. It fails with ErrAuth when the key does not open
+// the LMKs already installed, old LMKs included.
+func (s *Store) UnlockKEK(kek []byte) error {
+	if len(kek) != KEKSize {
+		return fmt.Errorf("key encryption key must be %d bytes, got %d", KEKSize, len(kek))
+	}
+	block, err := cryptoprovider.NewAESCipher(kek)
+	if err != nil {
+		return fmt.Errorf("failed to create LMK store cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return fmt.Errorf("failed to create LMK store cipher: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, lmks := range []map[string]LMK{s.lmks, s.old} {
+		for _, lmk := range lmks {
+			if _, err := unseal(aead, lmk); err != nil {
+				return err
+			}
+		}
+	}
+	s.aead = aead
+
+	return nil
+}
+
+// UnlockWith unlocks the store with kekHex, a hex key encryption key, when it is given and
+// with passphrase otherwise.
+func (s *Store) UnlockWith(passphrase, kekHex string) error {
+	if kekHex == "" {
+		return s.Unlock(passphrase)
+	}
+	kek, err := hex.DecodeString(kekHex)
+	if err != nil {
+		return fmt.Errorf("invalid key encryption key: %w", err)
+	}
+
+	return s.UnlockKEK(kek)
+}
+
+// Install seals value and adds it to the store under id with the installed status. id is a
+// two digit LMK identifier 00-19; value is a variant LMK set of variantlmk.LMKSetSize bytes
+// or a key block LMK of KeyBlockLMKSize bytes.
+func (s *Store) Install(id string, t Type, value []byte) (LMK, error) {
+	return s.install(s.lmks, id, t, StatusInstalled, value)
+}
+
+// InstallOld seals value and adds it to key change storage as the old LMK of id, replacing
+// the old LMK held for id. Keys encrypted under the old LMK are translated to the LMK
+// installed under id with the BW host command or 'keys migrate'.
+func (s *Store) InstallOld(id string, t Type, value []byte) (LMK, error) {
+	return s.install(s.old, id, t, StatusOld, value)
+}
+
+// install seals value and adds it to lmks under id with the given status.
+func (s *Store) install(lmks map[string]LMK, id string, t Type, status Status, value []byte) (LMK, error) {
+	if err := ValidateID(id); err != nil {
+		return LMK{}, err
+	}
+	kcv, err := CheckValue(t, value)
+	if err != nil {
+		return LMK{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.aead == nil {
+		return LMK{}, ErrLocked
+	}
+	if _, ok := lmks[id]; ok && status != StatusOld {
+		return LMK{}, fmt.Errorf("%w: %s", ErrLMKExists, id)
+	}
+
+	nonce := make([]byte, nonceSize)
+	if _, err := cryptoprovider.Read(nonce); err != nil {
+		return LMK{}, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	lmk := LMK{
+		ID:        id,
+		Type:      t,
+		Status:    status,
+		KCV:       kcv,
+		CreatedAt: time.Now().UTC(),
+		Nonce:     hex.EncodeToString(nonce),
+	}
+	lmk.Sealed = hex.EncodeToString(s.aead.Seal(nil, nonce, value, additionalData(lmk)))
+	lmks[id] = lmk
+
+	return lmk, nil
+}
+
+// Get returns the LMK installed under id without its value.
+func (s *Store) Get(id string) (LMK, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	lmk, ok := s.lmks[id]
+	if !ok {
+		return LMK{}, fmt.Errorf("%w: %s", ErrLMKNotFound, id)
+	}
+
+	return lmk, nil
+}
+
+// Value unseals the LMK installed under id.
+func (s *Store) Value(id string) ([]byte, error) {
+	return s.value(s.lmks, id)
+}
+
+// OldValue unseals the old LMK of id held in key change storage.
+func (s *Store) OldValue(id string) ([]byte, error) {
+	return s.value(s.old, id)
+}
+
+func (s *Store) value(lmks map[string]LMK, id string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	lmk, ok := lmks[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrLMKNotFound, id)
+	}
+	if s.aead == nil {
+		return nil, ErrLocked
+	}
+
+	return unseal(s.aead, lmk)
+}
+
+// List returns the installed LMKs sorted by ID.
+func (s *Store) List() []LMK {
+	return s.list(s.lmks)
+}
+
+// ListOld returns the old LMKs held in key change storage sorted by ID.
+func (s *Store) ListOld() []LMK {
+	return s.list(s.old)
+}
+
+func (s *Store) list(from map[string]LMK) []LMK {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	lmks := make([]LMK, 0, len(from))
+	for _, lmk := range from {
+		lmks = append(lmks, lmk)
+	}
+	sort.Slice(lmks, func(i, j int) bool { return lmks[i].ID < lmks[j].ID })
+
+	return lmks
+}
+
+// Activate marks the LMK installed under id as active, including a retired one.
+func (s *Store) Activate(id string) error {
+	return s.setStatus(id, StatusActive)
+}
+
+// Retire marks the LMK installed under id as retired.
+func (s *Store) Retire(id string) error {
+	return s.setStatus(id, StatusRetired)
+}
+
+// Delete removes the LMK installed under id. Active LMKs must be retired first.
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lmk, ok := s.lmks[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrLMKNotFound, id)
+	}
+	if lmk.Status == StatusActive {
+		return fmt.Errorf("%w: LMK %s is active; retire it first", ErrInvalidLMK, id)
+	}
+	delete(s.lmks, id)
+
+	return nil
+}
+
+// DeleteOld removes the old LMK of id from key change storage.
+func (s *Store) DeleteOld(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.old[id]; !ok {
+		return fmt.Errorf("%w: old LMK %s", ErrLMKNotFound, id)
+	}
+	delete(s.old, id)
+
+	return nil
+}
+
+func (s *Store) setStatus(id string, status Status) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lmk, ok := s.lmks[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrLMKNotFound, id)
+	}
+	now := time.Now().UTC()
+	switch status {
+	case StatusActive:
+		lmk.ActivatedAt, lmk.RetiredAt = &now, nil
+	case StatusRetired:
+		lmk.RetiredAt = &now
+	}
+	lmk.Status = status
+	s.lmks[id] = lmk
+
+	return nil
+}
+
+// Save writes the store to its file atomically.
+func (s *Store) Save() error {
+	data, err := json.MarshalIndent(document{
+		Salt:       hex.EncodeToString(s.salt),
+		Iterations: s.iterations,
+		LMKs:       s.List(),
+		OldLMKs:    s.ListOld(),
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode LMK store: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return fmt.Errorf("failed to create LMK store directory: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write LMK store: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to replace LMK store: %w", err)
+	}
+
+	return nil
+}
+
+// ValidateID checks that id is a two digit LMK identifier 00-19.
+func ValidateID(id string) error {
+	if len(id) != 2 || id[0] < '0' || id[0] > '1' || id[1] < '0' || id[1] > '9' {
+		return fmt.Errorf("%w: LMK ID %q must be 00-19", ErrInvalidLMK, id)
+	}
+
+	return nil
+}
+
+// ParseType returns the LMK type named name.
+func ParseType(name string) (Type, error) {
+	switch t := Type(name); t {
+	case TypeVariant, TypeKeyBlock:
+		return t, nil
+	default:
+		return "", fmt.Errorf("%w: type %q must be variant or keyblock", ErrInvalidLMK, name)
+	}
+}
+
+// Size returns the size in bytes of an LMK of type t.
+func Size(t Type) int {
+	switch t {
+	case TypeVariant:
+		return variantlmk.LMKSetSize
+	case TypeKeyBlock:
+		return KeyBlockLMKSize
+	default:
+		return 0
+	}
+}
+
+// CheckValue returns the check value of an LMK of type t in hex: the DES check value of LMK
+// pair 00-01 for a variant LMK, and the AES-CMAC check value for a key block LMK.
+func CheckValue(t Type, value []byte) (string, error) {
+	if len(value) != Size(t) {
+		return "", fmt.Errorf("%w: %s LMK must be %d bytes, got %d", ErrInvalidLMK, t, Size(t), len(value))
+	}
+	if t == TypeVariant {
+		return fmt.Sprintf("%X", crypto.CalculateKCV(value[:16])), nil
+	}
+	kcv, err := crypto.CalculateKCVType(value, crypto.KCVCMAC)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%X", kcv), nil
+}
+
+// additionalData binds a sealed LMK to its ID and type, and an old LMK to key change
+// storage.
+func additionalData(lmk LMK) []byte {
+	if lmk.Status == StatusOld {
+		return []byte(lmk.ID + ":" + string(lmk.Type) + ":" + string(StatusOld))
+	}
+
+	return []byte(lmk.ID + ":" + string(lmk.Type))
+}
+
+func unseal(aead cipher.AEAD, lmk LMK) ([]byte, error) {
+	nonce, err := hex.DecodeString(lmk.Nonce)
+	if err != nil || len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("%w: LMK %s has an invalid nonce", ErrInvalidLMK, lmk.ID)
+	}
+	sealed, err := hex.DecodeString(lmk.Sealed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: LMK %s has an invalid sealed value", ErrInvalidLMK, lmk.ID)
+	}
+	value, err := aead.Open(nil, nonce, sealed, additionalData(lmk))
+	if err != nil {
+		return nil, ErrAuth
+	}
+
+	return value, nil
+}
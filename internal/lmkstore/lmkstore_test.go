@@ -0,0 +1,283 @@
+package lmkstore
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/hsm/logic"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/variantlmk"
+)
+
+var testKEK = bytes.Repeat([]byte{0x5A}, KEKSize)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+
+	s, err := Open(filepath.Join(t.TempDir(), "lmk.json"))
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+
+	return s
+}
+
+func TestInstallAndReopen(t *testing.T) {
+	t.Parallel()
+	s := newTestStore(t)
+
+	kbLMK := bytes.Repeat([]byte{0x11}, KeyBlockLMKSize)
+	if _, err := s.Install("02", TypeKeyBlock, kbLMK); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+	if err := s.Unlock("master secret"); err != nil {
+		t.Fatalf("unlock failed: %v", err)
+	}
+	lmk, err := s.Install("02", TypeKeyBlock, kbLMK)
+	if err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	if lmk.Status != StatusInstalled || len(lmk.KCV) != 6 {
+		t.Errorf("unexpected LMK: %+v", lmk)
+	}
+	if _, err := s.Install("02", TypeKeyBlock, kbLMK); !errors.Is(err, ErrLMKExists) {
+		t.Errorf("expected ErrLMKExists, got %v", err)
+	}
+	if err := s.Activate("02"); err != nil {
+		t.Fatalf("activate failed: %v", err)
+	}
+	if err := s.Save(); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	reopened, err := Open(s.Path())
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	if got, _ := reopened.Get("02"); got.Status != StatusActive || got.KCV != lmk.KCV {
+		t.Errorf("unexpected reopened LMK: %+v", got)
+	}
+	if _, err := reopened.Value("02"); !errors.Is(err, ErrLocked) {
+		t.Errorf("expected ErrLocked, got %v", err)
+	}
+	if err := reopened.Unlock("wrong secret"); !errors.Is(err, ErrAuth) {
+		t.Errorf("expected ErrAuth, got %v", err)
+	}
+	if err := reopened.Unlock("master secret"); err != nil {
+		t.Fatalf("unlock failed: %v", err)
+	}
+	if value, err := reopened.Value("02"); err != nil || !bytes.Equal(value, kbLMK) {
+		t.Errorf("Value() = %X, %v", value, err)
+	}
+}
+
+func TestInstallRejects(t *testing.T) {
+	t.Parallel()
+	s := newTestStore(t)
+	if err := s.UnlockKEK(testKEK); err != nil {
+		t.Fatalf("unlock failed: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		id    string
+		t     Type
+		value []byte
+	}{
+		{"id out of range", "20", TypeKeyBlock, make([]byte, KeyBlockLMKSize)},
+		{"id not numeric", "A1", TypeKeyBlock, make([]byte, KeyBlockLMKSize)},
+		{"short key block LMK", "03", TypeKeyBlock, make([]byte, 16)},
+		{"short variant LMK", "03", TypeVariant, make([]byte, KeyBlockLMKSize)},
+		{"unknown type", "03", Type("aes"), make([]byte, KeyBlockLMKSize)},
+	}
+	for _, tc := range tests {
+		if _, err := s.Install(tc.id, tc.t, tc.value); !errors.Is(err, ErrInvalidLMK) {
+			t.Errorf("%s: expected ErrInvalidLMK, got %v", tc.name, err)
+		}
+	}
+}
+
+func TestStatusLifecycle(t *testing.T) {
+	t.Parallel()
+	s := newTestStore(t)
+	if err := s.UnlockKEK(testKEK); err != nil {
+		t.Fatalf("unlock failed: %v", err)
+	}
+	if _, err := s.Install("05", TypeKeyBlock, make([]byte, KeyBlockLMKSize)); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+
+	if err := s.Activate("05"); err != nil {
+		t.Fatalf("activate failed: %v", err)
+	}
+	if err := s.Delete("05"); !errors.Is(err, ErrInvalidLMK) {
+		t.Errorf("expected active LMK delete to fail, got %v", err)
+	}
+	if err := s.Retire("05"); err != nil {
+		t.Fatalf("retire failed: %v", err)
+	}
+	if lmk, _ := s.Get("05"); lmk.Status != StatusRetired || lmk.RetiredAt == nil || lmk.ActivatedAt == nil {
+		t.Errorf("unexpected retired LMK: %+v", lmk)
+	}
+	if err := s.Delete("05"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if err := s.Activate("05"); !errors.Is(err, ErrLMKNotFound) {
+		t.Errorf("expected ErrLMKNotFound, got %v", err)
+	}
+}
+
+func TestComponents(t *testing.T) {
+	t.Parallel()
+
+	components, err := GenerateComponents(TypeVariant, 3)
+	if err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	for i, c := range components {
+		if len(c) != variantlmk.LMKSetSize || !cryptoutils.CheckKeyParity(c) {
+			t.Errorf("component %d has length %d or bad parity", i, len(c))
+		}
+	}
+	lmk, err := CombineComponents(TypeVariant, components)
+	if err != nil {
+		t.Fatalf("combine failed: %v", err)
+	}
+	if !cryptoutils.CheckKeyParity(lmk) {
+		t.Error("combined variant LMK has bad parity")
+	}
+
+	if _, err := CombineComponents(TypeKeyBlock, components); !errors.Is(err, ErrInvalidLMK) {
+		t.Errorf("expected ErrInvalidLMK for mismatched components, got %v", err)
+	}
+	if _, err := GenerateComponents(TypeKeyBlock, 0); !errors.Is(err, ErrInvalidLMK) {
+		t.Errorf("expected ErrInvalidLMK for zero components, got %v", err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	t.Parallel()
+	s := newTestStore(t)
+	if err := s.UnlockKEK(testKEK); err != nil {
+		t.Fatalf("unlock failed: %v", err)
+	}
+
+	components, err := GenerateComponents(TypeVariant, 2)
+	if err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	variant, err := CombineComponents(TypeVariant, components)
+	if err != nil {
+		t.Fatalf("combine failed: %v", err)
+	}
+	for _, tc := range []struct {
+		id    string
+		t     Type
+		value []byte
+	}{
+		{"17", TypeVariant, variant},
+		{"18", TypeKeyBlock, bytes.Repeat([]byte{0x42}, KeyBlockLMKSize)},
+		{"19", TypeKeyBlock, bytes.Repeat([]byte{0x24}, KeyBlockLMKSize)},
+	} {
+		if _, err := s.Install(tc.id, tc.t, tc.value); err != nil {
+			t.Fatalf("install %s failed: %v", tc.id, err)
+		}
+	}
+	_ = s.Activate("17")
+	_ = s.Activate("18")
+
+	ids, err := Register(s)
+	if err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	if len(ids) != 2 || ids[0] != "17" || ids[1] != "18" {
+		t.Fatalf("registered %v, want [17 18]", ids)
+	}
+	if _, ok := logic.LMKRegistry["19"]; ok {
+		t.Error("installed LMK 19 registered before activation")
+	}
+
+	// A key encrypted under the registered variant LMK decrypts under the same LMK only.
+	clearKey := cryptoutils.FixKeyParity(bytes.Repeat([]byte{0x3C, 0xA5}, 8))
+	engine := logic.LMKRegistry["17"]
+	encrypted, err := engine.EncryptUnderLMK(clearKey, "000", 'U', "17")
+	if err != nil {
+		t.Fatalf("encrypt failed: %v", err)
+	}
+	if decrypted, err := engine.DecryptUnderLMK(encrypted, "000", 'U', "17"); err != nil ||
+		!bytes.Equal(decrypted, clearKey) {
+		t.Errorf("decrypt = %X, %v", decrypted, err)
+	}
+	defaultEncrypted, err := logic.LMKRegistry["00"].EncryptUnderLMK(clearKey, "000", 'U', "00")
+	if err != nil {
+		t.Fatalf("encrypt failed: %v", err)
+	}
+	if bytes.Equal(encrypted, defaultEncrypted) {
+		t.Error("managed variant LMK encrypts like the default LMK")
+	}
+}
+
+func TestOldLMK(t *testing.T) {
+	t.Parallel()
+	s := newTestStore(t)
+	if err := s.UnlockKEK(testKEK); err != nil {
+		t.Fatalf("unlock failed: %v", err)
+	}
+
+	current := bytes.Repeat([]byte{0x11}, KeyBlockLMKSize)
+	old := bytes.Repeat([]byte{0x22}, KeyBlockLMKSize)
+	if _, err := s.Install("16", TypeKeyBlock, current); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	if _, err := s.InstallOld("16", TypeKeyBlock, bytes.Repeat([]byte{0x33}, KeyBlockLMKSize)); err != nil {
+		t.Fatalf("install old failed: %v", err)
+	}
+	lmk, err := s.InstallOld("16", TypeKeyBlock, old)
+	if err != nil {
+		t.Fatalf("replacing old LMK failed: %v", err)
+	}
+	if lmk.Status != StatusOld {
+		t.Errorf("old LMK status = %s, want %s", lmk.Status, StatusOld)
+	}
+	if err := s.Save(); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	reopened, err := Open(s.Path())
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	if err := reopened.UnlockKEK(testKEK); err != nil {
+		t.Fatalf("unlock failed: %v", err)
+	}
+	if olds := reopened.ListOld(); len(olds) != 1 || olds[0].KCV != lmk.KCV {
+		t.Fatalf("ListOld() = %+v", olds)
+	}
+	if value, err := reopened.OldValue("16"); err != nil || !bytes.Equal(value, old) {
+		t.Errorf("OldValue() = %X, %v", value, err)
+	}
+	if value, err := reopened.Value("16"); err != nil || !bytes.Equal(value, current) {
+		t.Errorf("Value() = %X, %v", value, err)
+	}
+
+	ids, err := RegisterOld(reopened)
+	if err != nil || len(ids) != 1 || ids[0] != "16" {
+		t.Fatalf("RegisterOld() = %v, %v", ids, err)
+	}
+	if _, ok := logic.OldLMKRegistry["16"].(logic.KeyBlockLMKProvider); !ok {
+		t.Error("old LMK 16 is not registered")
+	}
+	delete(logic.OldLMKRegistry, "16")
+
+	if err := reopened.DeleteOld("16"); err != nil {
+		t.Fatalf("delete old failed: %v", err)
+	}
+	if err := reopened.DeleteOld("16"); !errors.Is(err, ErrLMKNotFound) {
+		t.Errorf("expected ErrLMKNotFound, got %v", err)
+	}
+	if _, err := reopened.Get("16"); err != nil {
+		t.Errorf("deleting the old LMK removed the current one: %v", err)
+	}
+}
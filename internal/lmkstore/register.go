@@ -0,0 +1,140 @@
+package lmkstore
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/andrei-cloud/go_hsm/internal/hsm/logic"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/variantlmk"
+)
+
+// GenerateComponents returns n random components of an LMK of type t. Components of a
+// variant LMK have odd parity on every DES key.
+func GenerateComponents(t Type, n int) ([][]byte, error) {
+	if Size(t) == 0 {
+		return nil, fmt.Errorf("%w: type %q must be variant or keyblock", ErrInvalidLMK, t)
+	}
+	if n < 1 || n > 9 {
+		return nil, fmt.Errorf("%w: component count %d must be 1-9", ErrInvalidLMK, n)
+	}
+
+	components := make([][]byte, n)
+	for i := range components {
+		component := make([]byte, Size(t))
+		if _, err := cryptoprovider.Read(component); err != nil {
+			return nil, fmt.Errorf("failed to generate LMK component: %w", err)
+		}
+		if t == TypeVariant {
+			component = cryptoutils.FixKeyParity(component)
+		}
+		components[i] = component
+	}
+
+	return components, nil
+}
+
+// CombineComponents XORs the components of an LMK of type t. The DES keys of a combined
+// variant LMK are adjusted to odd parity.
+func CombineComponents(t Type, components [][]byte) ([]byte, error) {
+	if len(components) == 0 {
+		return nil, fmt.Errorf("%w: no LMK components", ErrInvalidLMK)
+	}
+
+	lmk := make([]byte, Size(t))
+	for i, component := range components {
+		if len(component) != len(lmk) {
+			return nil, fmt.Errorf("%w: component %d of a %s LMK must be %d bytes, got %d",
+				ErrInvalidLMK, i+1, t, len(lmk), len(component))
+		}
+		for j := range lmk {
+			lmk[j] ^= component[j]
+		}
+	}
+	if t == TypeVariant {
+		lmk = cryptoutils.FixKeyParity(lmk)
+	}
+
+	return lmk, nil
+}
+
+// VariantSet unseals the variant LMK installed under id.
+func (s *Store) VariantSet(id string) (variantlmk.LMKSet, error) {
+	lmk, err := s.Get(id)
+	if err != nil {
+		return variantlmk.LMKSet{}, err
+	}
+	if lmk.Type != TypeVariant {
+		return variantlmk.LMKSet{}, fmt.Errorf("%w: LMK %s is a %s LMK", ErrInvalidLMK, id, lmk.Type)
+	}
+	value, err := s.Value(id)
+	if err != nil {
+		return variantlmk.LMKSet{}, err
+	}
+
+	return variantlmk.ParseLMKSet(value)
+}
+
+// registerLMK registers the LMK value of lmk with the variant or key block register
+// function.
+func registerLMK(
+	lmk LMK,
+	value []byte,
+	variant func(string, variantlmk.LMKSet),
+	keyBlock func(string, string) error,
+) error {
+	switch lmk.Type {
+	case TypeVariant:
+		set, err := variantlmk.ParseLMKSet(value)
+		if err != nil {
+			return err
+		}
+		variant(lmk.ID, set)
+
+		return nil
+	case TypeKeyBlock:
+		return keyBlock(lmk.ID, hex.EncodeToString(value))
+	default:
+		return fmt.Errorf("%w: LMK %s has type %q", ErrInvalidLMK, lmk.ID, lmk.Type)
+	}
+}
+
+// Register registers the active LMKs of the store in logic.LMKRegistry, replacing the
+// LMKs registered under their IDs, and returns their IDs.
+func Register(s *Store) ([]string, error) {
+	var ids []string
+	for _, lmk := range s.List() {
+		if lmk.Status != StatusActive {
+			continue
+		}
+		value, err := s.Value(lmk.ID)
+		if err != nil {
+			return ids, err
+		}
+		if err := registerLMK(lmk, value, logic.RegisterVariantLMKSet, logic.RegisterKeyBlockLMK); err != nil {
+			return ids, err
+		}
+		ids = append(ids, lmk.ID)
+	}
+
+	return ids, nil
+}
+
+// RegisterOld registers the old LMKs held in key change storage in logic.OldLMKRegistry and
+// returns their IDs.
+func RegisterOld(s *Store) ([]string, error) {
+	var ids []string
+	for _, lmk := range s.ListOld() {
+		value, err := s.OldValue(lmk.ID)
+		if err != nil {
+			return ids, err
+		}
+		if err := registerLMK(lmk, value, logic.RegisterOldVariantLMKSet, logic.RegisterOldKeyBlockLMK); err != nil {
+			return ids, err
+		}
+		ids = append(ids, lmk.ID)
+	}
+
+	return ids, nil
+}
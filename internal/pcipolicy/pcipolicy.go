@@ -0,0 +1,166 @@
+// Package pcipolicy enforces the key usage rules of PCI-HSM compliance mode on host
+// commands. The PCI-HSM key type table only separates keys by their LMK variants; the policy
+// also refuses the operations a PCI-HSM certified HSM blocks, such as exporting PIN keys
+// under weaker keys or using key type 002 as a TPK, before the command is executed.
+package pcipolicy
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/internal/hsm/logic"
+)
+
+// Names of the checks of a policy.
+const (
+	// CheckKeyType002 refuses the commands that use a key of type 002 as a TPK or TMK: in
+	// PCI-HSM mode key type 002 is reserved for PVKs.
+	CheckKeyType002 = "key_type_002_separation"
+	// CheckPINKeyExport refuses exporting a PIN key in single length or under a ZMK shorter
+	// than the key.
+	CheckPINKeyExport = "pin_key_export"
+	// CheckDisabledCommands refuses the commands listed as disabled.
+	CheckDisabledCommands = "disabled_commands"
+)
+
+// Default settings of a policy.
+var (
+	// DefaultTPKCommands are the commands decrypting a TPK or TMK as key type 002.
+	DefaultTPKCommands = []string{"CA", "DC", "KU", "PV"}
+	// DefaultPINKeyTypes are the key types of ZPKs, TPKs and PVKs.
+	DefaultPINKeyTypes = []string{"001", "002", "70D"}
+)
+
+// defaultErrorCodes maps the checks to the error codes answering their violations.
+var defaultErrorCodes = map[string]string{
+	CheckKeyType002:       errorcodes.Err28.CodeOnly(),
+	CheckPINKeyExport:     errorcodes.Err27.CodeOnly(),
+	CheckDisabledCommands: errorcodes.Err68.CodeOnly(),
+}
+
+// Rules tunes the enforcement of a deployment.
+type Rules struct {
+	// Checks enables or disables checks by name; checks not listed are enabled.
+	Checks map[string]bool `mapstructure:"checks"`
+	// ErrorCodes overrides the error code answered by a check.
+	ErrorCodes map[string]string `mapstructure:"error_codes"`
+	// TPKCommands lists the commands checked by CheckKeyType002; nil selects
+	// DefaultTPKCommands.
+	TPKCommands []string `mapstructure:"tpk_commands"`
+	// PINKeyTypes lists the key types checked by CheckPINKeyExport; nil selects
+	// DefaultPINKeyTypes.
+	PINKeyTypes []string `mapstructure:"pin_key_types"`
+	// DisabledCommands lists the commands refused by CheckDisabledCommands.
+	DisabledCommands []string `mapstructure:"disabled_commands"`
+}
+
+// Violation is a request refused by a policy.
+type Violation struct {
+	// Check is the name of the check refusing the request.
+	Check string
+	// Code is the two character error code of the response.
+	Code string
+}
+
+// Policy checks host commands against the rules for the LMKs in PCI-HSM mode.
+type Policy struct {
+	enabled     map[string]bool
+	codes       map[string]string
+	tpkCommands []string
+	pinKeyTypes []string
+	disabled    []string
+	pciMode     func(lmkID string) bool
+}
+
+// New validates rules and returns a policy enforcing them on requests for the LMKs for
+// which pciMode reports true.
+func New(rules Rules, pciMode func(lmkID string) bool) (*Policy, error) {
+	p := &Policy{
+		enabled:     make(map[string]bool, len(defaultErrorCodes)),
+		codes:       make(map[string]string, len(defaultErrorCodes)),
+		tpkCommands: DefaultTPKCommands,
+		pinKeyTypes: DefaultPINKeyTypes,
+		pciMode:     pciMode,
+	}
+	for check, code := range defaultErrorCodes {
+		p.enabled[check], p.codes[check] = true, code
+	}
+	for check, enabled := range rules.Checks {
+		if _, ok := defaultErrorCodes[check]; !ok {
+			return nil, fmt.Errorf("unknown PCI policy check %q", check)
+		}
+		p.enabled[check] = enabled
+	}
+	for check, code := range rules.ErrorCodes {
+		if _, ok := defaultErrorCodes[check]; !ok {
+			return nil, fmt.Errorf("unknown PCI policy check %q", check)
+		}
+		if len(code) != 2 {
+			return nil, fmt.Errorf("PCI policy check %s: error code %q must be two characters", check, code)
+		}
+		p.codes[check] = strings.ToUpper(code)
+	}
+
+	var err error
+	if rules.TPKCommands != nil {
+		if p.tpkCommands, err = commandList(rules.TPKCommands); err != nil {
+			return nil, err
+		}
+	}
+	if p.disabled, err = commandList(rules.DisabledCommands); err != nil {
+		return nil, err
+	}
+	if rules.PINKeyTypes != nil {
+		p.pinKeyTypes = make([]string, len(rules.PINKeyTypes))
+		for i, keyType := range rules.PINKeyTypes {
+			if len(keyType) != 3 {
+				return nil, fmt.Errorf("invalid PCI policy PIN key type %q", keyType)
+			}
+			p.pinKeyTypes[i] = strings.ToUpper(keyType)
+		}
+	}
+
+	return p, nil
+}
+
+// Check returns the violation of a request for cmd with payload, the request without the
+// command code. Requests for LMKs that are not in PCI-HSM mode are not checked.
+func (p *Policy) Check(cmd string, payload []byte) (Violation, bool) {
+	if p == nil || !p.pciMode(logic.RequestLMKID(payload)) {
+		return Violation{}, false
+	}
+
+	switch {
+	case p.enabled[CheckDisabledCommands] && slices.Contains(p.disabled, cmd):
+		return p.violation(CheckDisabledCommands), true
+	case p.enabled[CheckKeyType002] && slices.Contains(p.tpkCommands, cmd):
+		return p.violation(CheckKeyType002), true
+	case p.enabled[CheckPINKeyExport]:
+		export, ok := logic.KeyExportRequest(cmd, payload)
+		if ok && slices.Contains(p.pinKeyTypes, export.KeyType) &&
+			(export.KeyLength <= 8 || export.ZMKLength < export.KeyLength) {
+			return p.violation(CheckPINKeyExport), true
+		}
+	}
+
+	return Violation{}, false
+}
+
+func (p *Policy) violation(check string) Violation {
+	return Violation{Check: check, Code: p.codes[check]}
+}
+
+// commandList validates and upper cases a list of command codes.
+func commandList(commands []string) ([]string, error) {
+	list := make([]string, len(commands))
+	for i, cmd := range commands {
+		if len(cmd) != 2 {
+			return nil, fmt.Errorf("invalid PCI policy command %q", cmd)
+		}
+		list[i] = strings.ToUpper(cmd)
+	}
+
+	return list, nil
+}
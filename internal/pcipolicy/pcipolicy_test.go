@@ -0,0 +1,96 @@
+package pcipolicy
+
+import (
+	"strings"
+	"testing"
+)
+
+var (
+	double = strings.Repeat("0123456789ABCDEF", 2)
+	triple = strings.Repeat("0123456789ABCDEF", 3)
+)
+
+// pciLMK00 puts LMK 00 only in PCI-HSM mode.
+func pciLMK00(id string) bool {
+	return id == "00"
+}
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	policy, err := New(Rules{DisabledCommands: []string{"hc"}}, pciLMK00)
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		cmd     string
+		payload string
+		check   string
+		code    string
+	}{
+		{name: "TPK command", cmd: "CA", payload: "U" + double, check: CheckKeyType002, code: "28"},
+		{name: "TPK command on other LMK", cmd: "CA", payload: "U" + double + "%01"},
+		{name: "Disabled command", cmd: "HC", payload: "", check: CheckDisabledCommands, code: "68"},
+		{name: "Single length PIN key", cmd: "A0", payload: "1001Z;U" + double, check: CheckPINKeyExport, code: "27"},
+		{name: "Double length PIN key", cmd: "A0", payload: "1001U;U" + double},
+		{name: "Single length TAK", cmd: "A0", payload: "1003Z;U" + double},
+		{name: "A0 mode 0", cmd: "A0", payload: "0001Z"},
+		{
+			name: "PIN key under weaker ZMK", cmd: "A8", payload: "002U" + double + "T" + triple + "T",
+			check: CheckPINKeyExport, code: "27",
+		},
+		{name: "PIN key under ZMK", cmd: "A8", payload: "001T" + triple + "U" + double + "U"},
+		{name: "Other command", cmd: "BU", payload: "001U" + double},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			v, refused := policy.Check(tc.cmd, []byte(tc.payload))
+			if refused != (tc.check != "") || v.Check != tc.check || v.Code != tc.code {
+				t.Errorf("Check() = %+v, %t, want %s %s", v, refused, tc.check, tc.code)
+			}
+		})
+	}
+}
+
+func TestRules(t *testing.T) {
+	t.Parallel()
+
+	policy, err := New(Rules{
+		Checks:      map[string]bool{CheckPINKeyExport: false},
+		ErrorCodes:  map[string]string{CheckKeyType002: "17"},
+		TPKCommands: []string{"dc"},
+	}, pciLMK00)
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	if v, _ := policy.Check("DC", nil); v.Code != "17" {
+		t.Errorf("DC violation = %+v, want code 17", v)
+	}
+	if _, refused := policy.Check("CA", nil); refused {
+		t.Error("CA refused although not listed as a TPK command")
+	}
+	if _, refused := policy.Check("A0", []byte("1001Z;U"+double)); refused {
+		t.Error("disabled check refused a single length PIN key export")
+	}
+
+	for name, rules := range map[string]Rules{
+		"unknown check":      {Checks: map[string]bool{"unknown": true}},
+		"invalid error code": {ErrorCodes: map[string]string{CheckKeyType002: "1"}},
+		"invalid command":    {DisabledCommands: []string{"ABC"}},
+		"invalid key type":   {PINKeyTypes: []string{"01"}},
+	} {
+		if _, err := New(rules, pciLMK00); err == nil {
+			t.Errorf("%s: New() accepted %+v", name, rules)
+		}
+	}
+
+	var nilPolicy *Policy
+	if _, refused := nilPolicy.Check("CA", nil); refused {
+		t.Error("nil policy refused a request")
+	}
+}
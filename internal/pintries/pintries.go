@@ -0,0 +1,181 @@
+// Package pintries simulates the PIN try limits of an issuer: failed PIN verifications are
+// counted per account and, once a command's limit is reached, further verifications are
+// refused until the counter is reset, so host applications can exercise their handling of
+// blocked PINs.
+package pintries
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+)
+
+// DefaultErrorCode is returned for verifications of a blocked account when no error code is
+// configured. Thales HSMs keep no try counters, so the simulator reuses 39 (fraud detection).
+const DefaultErrorCode = "39"
+
+// CounterPrefix prefixes the account number in the names of the counters kept in a Store.
+const CounterPrefix = "pin_tries:"
+
+// Verification outcomes recorded from the error code of a response.
+const (
+	codeVerified = "00"
+	codeFailed   = "01"
+)
+
+// Rule sets the PIN try limit of a command.
+type Rule struct {
+	// Command is the two character code of a PIN verification command such as DC.
+	Command string `mapstructure:"command"`
+	// MaxTries is the number of failed verifications after which the account is blocked.
+	MaxTries int `mapstructure:"max_tries"`
+}
+
+// Store holds named counters. *hapair.State implements it, so the counters of an instance of
+// an HA pair are replicated to the standby.
+type Store interface {
+	// Next increments the named counter and returns its new value.
+	Next(name string) uint64
+	// Counter returns the current value of the named counter.
+	Counter(name string) uint64
+	// Delete removes the named counter.
+	Delete(name string)
+	// DeletePrefix removes the counters whose names start with prefix.
+	DeletePrefix(prefix string)
+}
+
+// Tracker counts failed PIN verifications per account.
+type Tracker struct {
+	limits    map[string]int
+	errorCode string
+	failures  Store
+}
+
+// New validates rules and returns a tracker answering blocked verifications with errorCode,
+// or DefaultErrorCode when it is empty. The failures are counted in store, or in memory when
+// store is nil.
+func New(rules []Rule, errorCode string, store Store) (*Tracker, error) {
+	if errorCode == "" {
+		errorCode = DefaultErrorCode
+	}
+	if len(errorCode) != 2 {
+		return nil, fmt.Errorf("PIN tries error code %q must be two characters", errorCode)
+	}
+	if store == nil {
+		store = &memoryStore{counters: make(map[string]uint64)}
+	}
+
+	t := &Tracker{
+		limits:    make(map[string]int, len(rules)),
+		errorCode: errorCode,
+		failures:  store,
+	}
+	for _, r := range rules {
+		r.Command = strings.ToUpper(r.Command)
+		if len(r.Command) != 2 {
+			return nil, fmt.Errorf("invalid PIN tries rule command %q", r.Command)
+		}
+		if r.MaxTries < 1 {
+			return nil, fmt.Errorf("PIN tries rule %s: max_tries must be at least 1", r.Command)
+		}
+		if _, ok := t.limits[r.Command]; ok {
+			return nil, fmt.Errorf("duplicate PIN tries rule for command %s", r.Command)
+		}
+		t.limits[r.Command] = r.MaxTries
+	}
+
+	return t, nil
+}
+
+// Tracks reports whether cmd has a PIN try limit.
+func (t *Tracker) Tracks(cmd string) bool {
+	if t == nil {
+		return false
+	}
+	_, ok := t.limits[cmd]
+
+	return ok
+}
+
+// Blocked returns the error code to answer a verification by cmd for account with, or an
+// empty string when the account has tries left.
+func (t *Tracker) Blocked(cmd, account string) string {
+	if !t.Tracks(cmd) {
+		return ""
+	}
+	if t.failures.Counter(CounterPrefix+account) >= uint64(t.limits[cmd]) {
+		return t.errorCode
+	}
+
+	return ""
+}
+
+// Record updates the counter of account from the error code of a verification by cmd: a
+// verification failure (01) counts as a try and a successful verification (00) clears the
+// counter. Other codes, such as format errors, leave it unchanged.
+func (t *Tracker) Record(cmd, account, code string) {
+	if !t.Tracks(cmd) {
+		return
+	}
+
+	switch code {
+	case codeFailed:
+		t.failures.Next(CounterPrefix + account)
+	case codeVerified:
+		t.failures.Delete(CounterPrefix + account)
+	}
+}
+
+// Failures returns the number of failed verifications counted for account.
+func (t *Tracker) Failures(account string) int {
+	return int(t.failures.Counter(CounterPrefix + account))
+}
+
+// Reset clears the counter of account, or of every account when account is empty.
+func (t *Tracker) Reset(account string) {
+	if account == "" {
+		t.failures.DeletePrefix(CounterPrefix)
+
+		return
+	}
+	t.failures.Delete(CounterPrefix + account)
+}
+
+// memoryStore is the Store of a tracker that shares its counters with no other instance.
+type memoryStore struct {
+	mu       sync.Mutex
+	counters map[string]uint64
+}
+
+func (s *memoryStore) Next(name string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.counters[name]++
+
+	return s.counters[name]
+}
+
+func (s *memoryStore) Counter(name string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.counters[name]
+}
+
+func (s *memoryStore) Delete(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.counters, name)
+}
+
+func (s *memoryStore) DeletePrefix(prefix string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	maps.DeleteFunc(s.counters, func(name string, _ uint64) bool {
+		return strings.HasPrefix(name, prefix)
+	})
+}
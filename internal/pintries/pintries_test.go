@@ -0,0 +1,91 @@
+package pintries
+
+import "testing"
+
+func TestNewValidation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		rules     []Rule
+		errorCode string
+		wantErr   bool
+	}{
+		{name: "empty", rules: nil},
+		{name: "valid", rules: []Rule{{Command: "dc", MaxTries: 3}}, errorCode: "17"},
+		{name: "bad command", rules: []Rule{{Command: "DCX", MaxTries: 3}}, wantErr: true},
+		{name: "no tries", rules: []Rule{{Command: "DC"}}, wantErr: true},
+		{name: "bad error code", errorCode: "1", wantErr: true},
+		{
+			name:    "duplicate",
+			rules:   []Rule{{Command: "DC", MaxTries: 1}, {Command: "dc", MaxTries: 2}},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := New(tc.rules, tc.errorCode, nil)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestTracker(t *testing.T) {
+	t.Parallel()
+
+	tr, err := New([]Rule{{Command: "DC", MaxTries: 2}, {Command: "EC", MaxTries: 3}}, "", nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	const account = "000123456789"
+	tr.Record("DC", account, "01")
+	if code := tr.Blocked("DC", account); code != "" {
+		t.Fatalf("Blocked() after one failure = %q", code)
+	}
+	tr.Record("DC", account, "15") // format errors are not tries
+	tr.Record("DC", account, "01")
+	if code := tr.Blocked("DC", account); code != DefaultErrorCode {
+		t.Errorf("Blocked(DC) = %q, want %s", code, DefaultErrorCode)
+	}
+	// The counter is shared; each command applies its own limit.
+	if code := tr.Blocked("EC", account); code != "" {
+		t.Errorf("Blocked(EC) = %q, want tries left", code)
+	}
+	if code := tr.Blocked("CA", account); code != "" || tr.Tracks("CA") {
+		t.Errorf("untracked command blocked with %q", code)
+	}
+	if code := tr.Blocked("DC", "000000000001"); code != "" {
+		t.Errorf("other account blocked with %q", code)
+	}
+
+	tr.Reset(account)
+	if tr.Failures(account) != 0 || tr.Blocked("DC", account) != "" {
+		t.Error("Reset() left the account blocked")
+	}
+
+	// A successful verification clears the counter.
+	tr.Record("EC", account, "01")
+	tr.Record("EC", account, "00")
+	if n := tr.Failures(account); n != 0 {
+		t.Errorf("Failures() after success = %d", n)
+	}
+
+	tr.Record("DC", account, "01")
+	tr.Record("DC", "000000000001", "01")
+	tr.Reset("")
+	if tr.Failures(account) != 0 || tr.Failures("000000000001") != 0 {
+		t.Error("Reset(\"\") left counters")
+	}
+
+	var disabled *Tracker
+	if disabled.Tracks("DC") || disabled.Blocked("DC", account) != "" {
+		t.Error("a nil tracker must not block")
+	}
+}
@@ -0,0 +1,234 @@
+// Package plugingen generates the WASM wrappers of command plugins and checks built plugin
+// modules. It is shared by the plugingen generator and the "plugin build" command.
+package plugingen
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/andrei-cloud/go_hsm/pkg/hsmplugin"
+	"github.com/tetratelabs/wazero"
+)
+
+// WrapperFile is the name of the generated wrapper in a plugin directory.
+const WrapperFile = "main.go"
+
+// RequiredExports are the functions the plugin manager calls on every plugin module.
+var RequiredExports = []string{"Alloc", "Execute", "version", "description", "author"}
+
+// ErrNoDirective indicates a plugin stub without a plugingen go:generate directive.
+var ErrNoDirective = errors.New("no plugingen directive")
+
+const wrapperTemplate = `// DO NOT EDIT THIS FILE.
+// Generated by "plugingen"; DO NOT EDIT.
+
+//go:build tinygo.wasm
+
+package main
+
+import (
+    "github.com/andrei-cloud/go_hsm/pkg/hsmplugin"
+    "{{.LogicImport}}"
+)
+
+// The wrapper implements plugin ABI v2: results are returned as multiple values.
+
+//export version
+func version() (uint32, uint32) {
+    return hsmplugin.ToBuffer([]byte({{printf "%q" .Version}})).AddressSize()
+}
+
+//export description
+func description() (uint32, uint32) {
+    return hsmplugin.ToBuffer([]byte({{printf "%q" .Description}})).AddressSize()
+}
+
+//export author
+func author() (uint32, uint32) {
+    return hsmplugin.ToBuffer([]byte({{printf "%q" .Author}})).AddressSize()
+}
+
+//export Alloc
+func Alloc(size uint32) uint32 {
+    ptr, _ := hsmplugin.Alloc(size).AddressSize()
+    return ptr
+}
+
+//export Execute
+func Execute(ptr, size uint32) (uint32, uint32, uint32) {
+	logic.SetDefaultLMKProvider()
+    in, err := hsmplugin.ReadExecuteInput(hsmplugin.Buffer(hsmplugin.PackResult(ptr, size)))
+    if err != nil {
+        hsmplugin.ResetArena()
+        return hsmplugin.ErrorResult(err)
+    }
+    // Release memory from the previous call; the input has been copied out.
+    hsmplugin.ResetArena()
+
+    out, err := logic.Execute{{.Cmd}}(in)
+    if err != nil {
+        return hsmplugin.ErrorResult(err)
+    }
+
+    return hsmplugin.Result(out)
+}
+
+func main() {}
+`
+
+var wrapper = template.Must(template.New("wrapper").Parse(wrapperTemplate))
+
+// PluginData is the metadata embedded in a plugin wrapper.
+type PluginData struct {
+	Cmd         string
+	LogicImport string
+	Version     string
+	Description string
+	Author      string
+}
+
+// Generate writes the wrapper source of a plugin to w.
+func Generate(w io.Writer, data *PluginData) error {
+	return wrapper.Execute(w, data)
+}
+
+// WriteWrapper writes the wrapper of a plugin to WrapperFile in dir and returns its path.
+func WriteWrapper(dir string, data *PluginData) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	path := filepath.Join(dir, WrapperFile)
+	f, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create file: %w", err)
+	}
+	err = Generate(f, data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	return path, err
+}
+
+// ParseFlags parses plugingen command line arguments into plugin data and the output
+// directory, applying the generator defaults.
+func ParseFlags(args []string, errOut io.Writer) (*PluginData, string, error) {
+	fs := flag.NewFlagSet("plugingen", flag.ContinueOnError)
+	fs.SetOutput(errOut)
+	data := &PluginData{}
+	fs.StringVar(&data.Cmd, "cmd", "", "command name")
+	fs.StringVar(&data.LogicImport, "logic", "", "logic import path")
+	out := fs.String("out", ".", "output directory")
+	fs.StringVar(&data.Version, "version", "1.0.0", "plugin version")
+	fs.StringVar(&data.Description, "desc", "", "plugin description")
+	fs.StringVar(&data.Author, "author", "HSM Plugin Generator", "plugin author")
+	if err := fs.Parse(args); err != nil {
+		return nil, "", err
+	}
+
+	if data.Cmd == "" || data.LogicImport == "" {
+		return nil, "", errors.New("cmd and logic flags must be provided")
+	}
+	if data.Description == "" {
+		data.Description = fmt.Sprintf("HSM command %s implementation", data.Cmd)
+	}
+
+	return data, *out, nil
+}
+
+// ParseDirective reads the plugin data from the "//go:generate plugingen" directive of a
+// plugin stub (gen.go).
+func ParseDirective(src []byte) (*PluginData, error) {
+	for _, line := range strings.Split(string(src), "\n") {
+		rest, ok := strings.CutPrefix(strings.TrimSpace(line), "//go:generate ")
+		if !ok {
+			continue
+		}
+		words, err := splitWords(rest)
+		if err != nil {
+			return nil, err
+		}
+		if len(words) == 0 || words[0] != "plugingen" {
+			continue
+		}
+		data, _, err := ParseFlags(words[1:], io.Discard)
+
+		return data, err
+	}
+
+	return nil, ErrNoDirective
+}
+
+// splitWords splits a go:generate command line into words, honouring double quotes as the
+// go tool does.
+func splitWords(line string) ([]string, error) {
+	var (
+		words   []string
+		word    strings.Builder
+		inWord  bool
+		inQuote bool
+	)
+	for _, r := range line {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+			inWord = true
+		case !inQuote && (r == ' ' || r == '\t'):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inQuote {
+		return nil, errors.New("unterminated quoted string in go:generate directive")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	return words, nil
+}
+
+// VerifyExports compiles a plugin module and checks that it exports RequiredExports with the
+// signatures of a supported plugin ABI, so a module the plugin manager would skip at load
+// time is rejected at build time.
+func VerifyExports(ctx context.Context, wasm []byte) error {
+	rt := wazero.NewRuntime(ctx)
+	defer func() {
+		_ = rt.Close(ctx)
+	}()
+
+	compiled, err := rt.CompileModule(ctx, wasm)
+	if err != nil {
+		return fmt.Errorf("invalid WASM module: %w", err)
+	}
+	exports := compiled.ExportedFunctions()
+
+	var missing []string
+	for _, name := range RequiredExports {
+		if _, ok := exports[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("plugin missing required exports: %s", strings.Join(missing, ", "))
+	}
+	if _, err := hsmplugin.DetectABI(exports); err != nil {
+		return err
+	}
+
+	return nil
+}
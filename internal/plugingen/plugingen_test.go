@@ -0,0 +1,186 @@
+package plugingen
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/pkg/hsmplugin"
+)
+
+func TestParseDirective(t *testing.T) {
+	t.Parallel()
+
+	stub, err := os.ReadFile(filepath.Join("..", "commands", "plugins", "A0", "gen.go"))
+	if err != nil {
+		t.Fatalf("read A0 stub: %v", err)
+	}
+	data, err := ParseDirective(stub)
+	if err != nil {
+		t.Fatalf("ParseDirective failed: %v", err)
+	}
+	want := PluginData{
+		Cmd:         "A0",
+		LogicImport: "github.com/andrei-cloud/go_hsm/internal/hsm/logic",
+		Version:     "1.0.0",
+		Description: "Generate a random key",
+		Author:      "Andrey Babikov",
+	}
+	if *data != want {
+		t.Errorf("ParseDirective() = %+v, want %+v", *data, want)
+	}
+
+	data, err = ParseDirective([]byte("//go:generate plugingen -cmd=ZZ -logic=example.com/logic\npackage main\n"))
+	if err != nil {
+		t.Fatalf("ParseDirective without metadata failed: %v", err)
+	}
+	if data.Version != "1.0.0" || data.Description != "HSM command ZZ implementation" {
+		t.Errorf("defaults = %+v", *data)
+	}
+
+	for name, src := range map[string]string{
+		"no directive":   "package main\n",
+		"other tool":     "//go:generate stringer -type=Kind\npackage main\n",
+		"missing logic":  "//go:generate plugingen -cmd=ZZ\npackage main\n",
+		"unknown flag":   "//go:generate plugingen -cmd=ZZ -logic=x -bogus\npackage main\n",
+		"unterminated":   "//go:generate plugingen -cmd=ZZ -logic=x -desc \"open\npackage main\n",
+		"empty template": "",
+	} {
+		if _, err := ParseDirective([]byte(src)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	if _, err := ParseDirective([]byte("package main\n")); !errors.Is(err, ErrNoDirective) {
+		t.Errorf("error = %v, want ErrNoDirective", err)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	err := Generate(&buf, &PluginData{
+		Cmd:         "A0",
+		LogicImport: "github.com/andrei-cloud/go_hsm/internal/hsm/logic",
+		Version:     "1.0.0+v0.4.0-3-gbd7a979",
+		Description: `Generate a "random" key`,
+		Author:      "HSM Team",
+	})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	src := buf.String()
+	for _, s := range []string{
+		"//go:build tinygo.wasm",
+		`[]byte("1.0.0+v0.4.0-3-gbd7a979")`,
+		`[]byte("Generate a \"random\" key")`,
+		`[]byte("HSM Team")`,
+		"logic.ExecuteA0(in)",
+		"func Execute(ptr, size uint32) (uint32, uint32, uint32)",
+		"hsmplugin.ErrorResult(err)",
+	} {
+		if !strings.Contains(src, s) {
+			t.Errorf("wrapper does not contain %q", s)
+		}
+	}
+}
+
+func TestVerifyExports(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	for abi, sigs := range map[string]map[string]signature{"v1": abiV1, "v2": abiV2} {
+		if err := VerifyExports(ctx, wasmModule(sigs, RequiredExports...)); err != nil {
+			t.Errorf("VerifyExports() of %s module = %v, want nil", abi, err)
+		}
+	}
+
+	err := VerifyExports(ctx, wasmModule(abiV2, "Alloc", "Execute", "version"))
+	if err == nil || !strings.Contains(err.Error(), "description, author") {
+		t.Errorf("VerifyExports() = %v, want missing description and author", err)
+	}
+
+	mixed := map[string]signature{"Execute": abiV2["Execute"], "Alloc": abiV1["Alloc"]}
+	if err := VerifyExports(ctx, wasmModule(mixed, RequiredExports...)); !errors.Is(err, hsmplugin.ErrABI) {
+		t.Errorf("VerifyExports() of mixed ABI module = %v, want ErrABI", err)
+	}
+
+	if err := VerifyExports(ctx, []byte("not wasm")); err == nil {
+		t.Error("expected error for an invalid module")
+	}
+}
+
+// signature holds the param and result value types of a function.
+type signature struct{ params, results []byte }
+
+const (
+	i32 = 0x7f
+	i64 = 0x7e
+)
+
+// abiV1 and abiV2 are the export signatures of the plugin ABIs.
+var (
+	abiV1 = map[string]signature{
+		"Alloc":       {[]byte{i32}, []byte{i64}},
+		"Execute":     {[]byte{i64}, []byte{i64}},
+		"version":     {nil, []byte{i64}},
+		"description": {nil, []byte{i64}},
+		"author":      {nil, []byte{i64}},
+	}
+	abiV2 = map[string]signature{
+		"Alloc":       {[]byte{i32}, []byte{i32}},
+		"Execute":     {[]byte{i32, i32}, []byte{i32, i32, i32}},
+		"version":     {nil, []byte{i32, i32}},
+		"description": {nil, []byte{i32, i32}},
+		"author":      {nil, []byte{i32, i32}},
+	}
+)
+
+// wasmModule encodes a module exporting a function under each name, with its signature in
+// sigs (no params and results when absent), returning constant zeros.
+func wasmModule(sigs map[string]signature, names ...string) []byte {
+	n := byte(len(names))
+	section := func(id byte, body []byte) []byte {
+		return append([]byte{id, byte(len(body))}, body...)
+	}
+
+	types := []byte{n}
+	funcs := []byte{n}
+	code := []byte{n}
+	exports := []byte{n}
+	for i, name := range names {
+		sig := sigs[name]
+		types = append(types, 0x60, byte(len(sig.params)))
+		types = append(types, sig.params...)
+		types = append(types, byte(len(sig.results)))
+		types = append(types, sig.results...)
+		funcs = append(funcs, byte(i))
+
+		body := []byte{0}
+		for _, t := range sig.results {
+			if t == i64 {
+				body = append(body, 0x42, 0)
+			} else {
+				body = append(body, 0x41, 0)
+			}
+		}
+		body = append(body, 0x0b)
+		code = append(code, byte(len(body)))
+		code = append(code, body...)
+
+		exports = append(exports, byte(len(name)))
+		exports = append(exports, name...)
+		exports = append(exports, 0, byte(i))
+	}
+
+	m := []byte{0x00, 'a', 's', 'm', 1, 0, 0, 0}
+	m = append(m, section(1, types)...)
+	m = append(m, section(3, funcs)...)
+	m = append(m, section(7, exports)...)
+
+	return append(m, section(10, code)...)
+}
@@ -31,8 +31,7 @@ func AllocBuffer(
 		return 0, errors.New("alloc returned no results")
 	}
 
-	// The wasm Alloc returns a packed u64 ptr<<32|len, so high 32 bits is ptr.
-	ptr := api.DecodeU32(results[0] >> 32)
+	ptr := allocPointer(alloc, results[0])
 
 	if !mod.Memory().Write(ptr, data) {
 		return 0, errors.New("memory write failed: bounds exceeded")
@@ -41,6 +40,39 @@ func AllocBuffer(
 	return ptr, nil
 }
 
+// allocPointer returns the pointer allocated by an Alloc call from its result: ABI v1 returns
+// a packed u64 ptr<<32|len, ABI v2 the pointer alone.
+func allocPointer(alloc api.Function, result uint64) uint32 {
+	if types := alloc.Definition().ResultTypes(); len(types) == 1 && types[0] == api.ValueTypeI64 {
+		return api.DecodeU32(result >> 32)
+	}
+
+	return api.DecodeU32(result)
+}
+
+// writeGuest allocates guest memory through the Alloc export of mod, writes data to it and
+// returns its pointer.
+func writeGuest(ctx context.Context, mod api.Module, data []byte) (uint32, error) {
+	alloc := mod.ExportedFunction("Alloc")
+	if alloc == nil {
+		return 0, errors.New("plugin does not export Alloc")
+	}
+	results, err := alloc.Call(ctx, uint64(len(data)))
+	if err != nil {
+		return 0, fmt.Errorf("alloc failed: %w", err)
+	}
+	if len(results) == 0 {
+		return 0, errors.New("alloc returned no results")
+	}
+
+	ptr := allocPointer(alloc, results[0])
+	if err := writeMemory(mod, ptr, data); err != nil {
+		return 0, err
+	}
+
+	return ptr, nil
+}
+
 // CallExecute invokes the plugin's Execute function with pointer and length and returns the packed uint64 result.
 func CallExecute(ctx context.Context, exec api.Function, ptr, length uint32) (uint64, error) {
 	results, err := exec.Call(ctx, uint64(ptr)<<32|uint64(length))
@@ -54,6 +86,20 @@ func CallExecute(ctx context.Context, exec api.Function, ptr, length uint32) (ui
 	return results[0], nil
 }
 
+// CallExecuteV2 invokes the Execute function of an ABI v2 plugin with pointer and length and
+// returns the pointer and length of its response and its error code.
+func CallExecuteV2(ctx context.Context, exec api.Function, ptr, length uint32) (uint32, uint32, uint32, error) {
+	results, err := exec.Call(ctx, uint64(ptr), uint64(length))
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("execution failed: %w", err)
+	}
+	if len(results) != 3 {
+		return 0, 0, 0, errors.New("invalid execution result")
+	}
+
+	return api.DecodeU32(results[0]), api.DecodeU32(results[1]), api.DecodeU32(results[2]), nil
+}
+
 // ReadBuffer reads bytes from guest memory at the address represented by buf and returns them as a byte slice.
 func ReadBuffer(mod api.Module, buf hsmplugin.Buffer) ([]byte, error) {
 	ptr, size := buf.AddressSize()
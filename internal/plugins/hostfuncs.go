@@ -7,6 +7,9 @@ import (
 	"fmt"
 
 	"github.com/andrei-cloud/go_hsm/internal/hsm"
+	"github.com/andrei-cloud/go_hsm/internal/hsm/logic"
+	"github.com/andrei-cloud/go_hsm/internal/profiling"
+	"github.com/andrei-cloud/go_hsm/pkg/hsmplugin"
 	"github.com/rs/zerolog/log"
 	"github.com/tetratelabs/wazero"
 	"github.com/tetratelabs/wazero/api"
@@ -61,19 +64,173 @@ func (h *HostFunctions) Register(ctx context.Context) error {
 		WithFunc(h.decryptUnderLMK).
 		Export("DecryptUnderLMK")
 
+	h.builder.NewFunctionBuilder().
+		WithFunc(h.translateFromOldLMK).
+		Export("TranslateFromOldLMK")
+
 	h.builder.NewFunctionBuilder().
 		WithFunc(h.generateRandomKey).
 		Export("RandomKey")
 
+	h.builder.NewFunctionBuilder().
+		WithFunc(h.wrapKeyBlock).
+		Export("WrapKeyBlock")
+
+	h.builder.NewFunctionBuilder().
+		WithFunc(h.unwrapKeyBlock).
+		Export("UnwrapKeyBlock")
+
+	// Streamed command input
+	h.builder.NewFunctionBuilder().
+		WithFunc(h.inputRead).
+		Export(inputReadFunc)
+
+	// Language-agnostic JSON envelope interface
+	h.builder.NewFunctionBuilder().
+		WithFunc(h.hsmCall).
+		Export("hsm_call")
+
 	// Instantiate the module
 	_, err := h.builder.Instantiate(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to instantiate host functions module: %w", err)
 	}
 
+	return h.registerV2(ctx)
+}
+
+// registerV2 adds the key host functions of plugin ABI v2, which return the pointer and
+// length of their result and an error code, to the WASM runtime.
+func (h *HostFunctions) registerV2(ctx context.Context) error {
+	builder := h.runtime.NewHostModuleBuilder(hsmplugin.HostModuleV2)
+
+	keyOps := map[string]func(data []byte, keyType string, scheme byte) ([]byte, error){
+		"encrypt_under_lmk":      h.encryptKey,
+		"decrypt_under_lmk":      h.decryptKey,
+		"translate_from_old_lmk": translateKeyFromOldLMK,
+	}
+	for name, op := range keyOps {
+		builder.NewFunctionBuilder().
+			WithFunc(func(
+				ctx context.Context,
+				mod api.Module,
+				dataPtr, dataLen, typePtr, typeLen, schemeTagRaw uint32,
+			) (uint32, uint32, uint32) {
+				return h.result(ctx, mod, name, func() ([]byte, error) {
+					return h.keyOperation(mod, op, dataPtr, dataLen, typePtr, typeLen, schemeTagRaw)
+				})
+			}).
+			Export(name)
+	}
+
+	builder.NewFunctionBuilder().
+		WithFunc(func(
+			ctx context.Context,
+			mod api.Module,
+			templatePtr, templateLen, keyPtr, keyLen uint32,
+		) (uint32, uint32, uint32) {
+			return h.result(ctx, mod, "wrap_key_block", func() ([]byte, error) {
+				return wrapKeyBlock(mod, templatePtr, templateLen, keyPtr, keyLen)
+			})
+		}).
+		Export("wrap_key_block")
+
+	builder.NewFunctionBuilder().
+		WithFunc(func(ctx context.Context, mod api.Module, blockPtr, blockLen uint32) (uint32, uint32, uint32) {
+			return h.result(ctx, mod, "unwrap_key_block", func() ([]byte, error) {
+				return unwrapKeyBlock(mod, blockPtr, blockLen)
+			})
+		}).
+		Export("unwrap_key_block")
+
+	builder.NewFunctionBuilder().
+		WithFunc(func(ctx context.Context, mod api.Module, idPtr, idLen uint32) (uint32, uint32, uint32) {
+			return h.result(ctx, mod, "lmk_check_value", func() ([]byte, error) {
+				return lmkCheckValue(mod, idPtr, idLen)
+			})
+		}).
+		Export("lmk_check_value")
+
+	builder.NewFunctionBuilder().
+		WithFunc(func(ctx context.Context, mod api.Module, length uint32) (uint32, uint32, uint32) {
+			return h.result(ctx, mod, "random_key", func() ([]byte, error) {
+				return h.hsm.GenerateRandomKey(int(length))
+			})
+		}).
+		Export("random_key")
+
+	h.registerFieldFunctions(builder)
+
+	if _, err := builder.Instantiate(ctx); err != nil {
+		return fmt.Errorf("failed to instantiate %s host functions module: %w", hsmplugin.HostModuleV2, err)
+	}
+
 	return nil
 }
 
+// result runs a host operation for an ABI v2 plugin and returns the pointer and length of its
+// result, allocated through the guest's Alloc export, and the error code of its failure.
+func (h *HostFunctions) result(
+	ctx context.Context,
+	mod api.Module,
+	name string,
+	op func() ([]byte, error),
+) (uint32, uint32, uint32) {
+	defer profiling.HostCall(ctx)()
+
+	data, err := op()
+	if err == nil {
+		var ptr uint32
+		if ptr, err = writeGuest(ctx, mod, data); err == nil {
+			return ptr, uint32(len(data)), 0
+		}
+	}
+	code, _ := hsmplugin.ErrorCode(err)
+	log.Error().Err(err).Str("function", name).Str("code", code).Msg("host function failed")
+
+	return 0, 0, hsmplugin.EncodeErrorCode(code)
+}
+
+// inputReadFunc is the host function plugins call to pull streamed command input.
+const inputReadFunc = "input_read"
+
+// inputKey is the context key of the command input streamed to a plugin.
+type inputKey struct{}
+
+// withStreamedInput returns a context carrying input for inputRead.
+func withStreamedInput(ctx context.Context, input []byte) context.Context {
+	return context.WithValue(ctx, inputKey{}, input)
+}
+
+// inputRead copies up to size bytes of the streamed command input, starting at offset, to
+// guest memory at ptr and returns the number of bytes copied; 0 marks an error or the end
+// of the input.
+func (h *HostFunctions) inputRead(
+	ctx context.Context,
+	mod api.Module,
+	offset, ptr, size uint32,
+) uint32 {
+	defer profiling.HostCall(ctx)()
+
+	input, _ := ctx.Value(inputKey{}).([]byte)
+	if uint64(offset) >= uint64(len(input)) {
+		log.Error().Uint32("offset", offset).Msg("streamed input read past the end")
+
+		return 0
+	}
+	chunk := input[offset:]
+	if uint32(len(chunk)) > size {
+		chunk = chunk[:size]
+	}
+	if err := writeMemory(mod, ptr, chunk); err != nil {
+		log.Error().Err(err).Msg("failed to write streamed input to memory")
+
+		return 0
+	}
+
+	return uint32(len(chunk))
+}
+
 // readMemory safely reads bytes from WASM module memory.
 func readMemory(mod api.Module, ptr, size uint32) ([]byte, error) {
 	if mod == nil {
@@ -112,6 +269,8 @@ func writeMemory(mod api.Module, ptr uint32, data []byte) error {
 }
 
 func (h *HostFunctions) logDebug(ctx context.Context, mod api.Module, ptr, size uint32) {
+	defer profiling.HostCall(ctx)()
+
 	data, err := readMemory(mod, ptr, size)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to read debug log message")
@@ -131,6 +290,8 @@ func (h *HostFunctions) logDebug(ctx context.Context, mod api.Module, ptr, size
 }
 
 func (h *HostFunctions) logInfo(ctx context.Context, mod api.Module, ptr, size uint32) {
+	defer profiling.HostCall(ctx)()
+
 	data, err := readMemory(mod, ptr, size)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to read info log message")
@@ -150,6 +311,8 @@ func (h *HostFunctions) logInfo(ctx context.Context, mod api.Module, ptr, size u
 }
 
 func (h *HostFunctions) logError(ctx context.Context, mod api.Module, ptr, size uint32) {
+	defer profiling.HostCall(ctx)()
+
 	data, err := readMemory(mod, ptr, size)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to read error log message")
@@ -169,10 +332,12 @@ func (h *HostFunctions) logError(ctx context.Context, mod api.Module, ptr, size
 }
 
 func (h *HostFunctions) jsonParse(
-	_ context.Context,
+	ctx context.Context,
 	mod api.Module,
 	jsonPtr, jsonLen uint32,
 ) uint64 {
+	defer profiling.HostCall(ctx)()
+
 	jsonData, err := readMemory(mod, jsonPtr, jsonLen)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to read JSON data")
@@ -191,7 +356,9 @@ func (h *HostFunctions) jsonParse(
 	return 1
 }
 
-func (h *HostFunctions) jsonStringify(_ context.Context, mod api.Module, ptr, size uint32) uint64 {
+func (h *HostFunctions) jsonStringify(ctx context.Context, mod api.Module, ptr, size uint32) uint64 {
+	defer profiling.HostCall(ctx)()
+
 	data, err := readMemory(mod, ptr, size)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to read data for JSON stringify")
@@ -210,20 +377,13 @@ func (h *HostFunctions) jsonStringify(_ context.Context, mod api.Module, ptr, si
 		return 0
 	}
 
-	allocFn := mod.ExportedFunction("Alloc")
-	results, err := allocFn.Call(context.Background(), uint64(len(jsonData)))
-	if err != nil || len(results) == 0 {
-		log.Error().Err(err).Msg("failed to allocate memory for JSON string")
-		return 0
-	}
-
-	resultPtr := uint32(results[0])
-	if err := writeMemory(mod, resultPtr, jsonData); err != nil {
+	resultPtr, err := writeGuest(ctx, mod, jsonData)
+	if err != nil {
 		log.Error().Err(err).Msg("failed to write JSON string to memory")
 		return 0
 	}
 
-	return uint64(resultPtr)<<32 | uint64(len(jsonData))
+	return hsmplugin.PackResult(resultPtr, uint32(len(jsonData)))
 }
 
 func (h *HostFunctions) encryptUnderLMK(
@@ -231,102 +391,164 @@ func (h *HostFunctions) encryptUnderLMK(
 	mod api.Module,
 	dataPtr, dataLen, typePtr, typeLen, schemeTagRaw uint32,
 ) uint64 {
-	plaintext, err := readMemory(mod, dataPtr, dataLen)
+	return h.packed(ctx, mod, "encrypt under LMK", func() ([]byte, error) {
+		return h.keyOperation(mod, h.encryptKey, dataPtr, dataLen, typePtr, typeLen, schemeTagRaw)
+	})
+}
+
+func (h *HostFunctions) decryptUnderLMK(
+	ctx context.Context,
+	mod api.Module,
+	dataPtr, dataLen, typePtr, typeLen, schemeTagRaw uint32,
+) uint64 {
+	return h.packed(ctx, mod, "decrypt under LMK", func() ([]byte, error) {
+		return h.keyOperation(mod, h.decryptKey, dataPtr, dataLen, typePtr, typeLen, schemeTagRaw)
+	})
+}
+
+func (h *HostFunctions) translateFromOldLMK(
+	ctx context.Context,
+	mod api.Module,
+	dataPtr, dataLen, typePtr, typeLen, schemeTagRaw uint32,
+) uint64 {
+	return h.packed(ctx, mod, "translate from old LMK", func() ([]byte, error) {
+		return h.keyOperation(mod, translateKeyFromOldLMK, dataPtr, dataLen, typePtr, typeLen, schemeTagRaw)
+	})
+}
+
+func (h *HostFunctions) generateRandomKey(ctx context.Context, mod api.Module, length uint32) uint64 {
+	return h.packed(ctx, mod, "generate random key", func() ([]byte, error) {
+		return h.hsm.GenerateRandomKey(int(length))
+	})
+}
+
+func (h *HostFunctions) wrapKeyBlock(
+	ctx context.Context,
+	mod api.Module,
+	templatePtr, templateLen, keyPtr, keyLen uint32,
+) uint64 {
+	return h.packed(ctx, mod, "wrap key block", func() ([]byte, error) {
+		return wrapKeyBlock(mod, templatePtr, templateLen, keyPtr, keyLen)
+	})
+}
+
+func (h *HostFunctions) unwrapKeyBlock(ctx context.Context, mod api.Module, blockPtr, blockLen uint32) uint64 {
+	return h.packed(ctx, mod, "unwrap key block", func() ([]byte, error) {
+		return unwrapKeyBlock(mod, blockPtr, blockLen)
+	})
+}
+
+// wrapKeyBlock reads a key block header template and a clear key from guest memory and
+// wraps the key under the key block LMK named in the template, see logic.EncryptKeyBlock.
+func wrapKeyBlock(mod api.Module, templatePtr, templateLen, keyPtr, keyLen uint32) ([]byte, error) {
+	template, err := readMemory(mod, templatePtr, templateLen)
 	if err != nil {
-		log.Error().Err(err).Msg("failed to read plaintext for encryption")
-		return 0
+		return nil, fmt.Errorf("failed to read key block template: %w", err)
 	}
 
-	keyType, err := readMemory(mod, typePtr, typeLen)
+	key, err := readMemory(mod, keyPtr, keyLen)
 	if err != nil {
-		log.Error().Err(err).Msg("failed to read key type")
-		return 0
+		return nil, fmt.Errorf("failed to read key data: %w", err)
 	}
 
-	schemeTag := byte(schemeTagRaw)
+	return logic.EncryptKeyBlock(key, template)
+}
 
-	encrypted, err := h.hsm.EncryptKeyWithVariantScheme(plaintext, string(keyType), schemeTag)
+// unwrapKeyBlock reads a key block from guest memory and unwraps it under the key block LMK
+// named in its header, see logic.UnwrapKeyBlock.
+func unwrapKeyBlock(mod api.Module, blockPtr, blockLen uint32) ([]byte, error) {
+	block, err := readMemory(mod, blockPtr, blockLen)
 	if err != nil {
-		log.Error().Err(err).Msg("failed to encrypt under LMK")
-		return 0
+		return nil, fmt.Errorf("failed to read key block: %w", err)
 	}
 
-	allocFn := mod.ExportedFunction("Alloc")
-	results, err := allocFn.Call(ctx, uint64(len(encrypted)))
-	if err != nil || len(results) == 0 {
-		log.Error().Err(err).Msg("failed to allocate memory for encrypted data")
-		return 0
-	}
+	return logic.UnwrapKeyBlock(block)
+}
 
-	resultPtr := uint32(results[0])
-	if err := writeMemory(mod, resultPtr, encrypted); err != nil {
-		log.Error().Err(err).Msg("failed to write encrypted data to memory")
-		return 0
+// lmkCheckValue reads an LMK identifier from guest memory and returns the check value of
+// the LMK registered under it, see logic.LMKCheckValue.
+func lmkCheckValue(mod api.Module, idPtr, idLen uint32) ([]byte, error) {
+	id, err := readMemory(mod, idPtr, idLen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read LMK identifier: %w", err)
 	}
 
-	return uint64(resultPtr)<<32 | uint64(len(encrypted))
+	return logic.LMKCheckValue(string(id))
 }
 
-func (h *HostFunctions) decryptUnderLMK(
-	ctx context.Context,
+// keyOperation reads a key and its key type from guest memory and applies op to them.
+func (h *HostFunctions) keyOperation(
 	mod api.Module,
+	op func(data []byte, keyType string, scheme byte) ([]byte, error),
 	dataPtr, dataLen, typePtr, typeLen, schemeTagRaw uint32,
-) uint64 {
-	encrypted, err := readMemory(mod, dataPtr, dataLen)
+) ([]byte, error) {
+	data, err := readMemory(mod, dataPtr, dataLen)
 	if err != nil {
-		log.Error().Err(err).Msg("failed to read encrypted data")
-		return 0
+		return nil, fmt.Errorf("failed to read key data: %w", err)
 	}
 
 	keyType, err := readMemory(mod, typePtr, typeLen)
 	if err != nil {
-		log.Error().Err(err).Msg("failed to read key type")
-		return 0
+		return nil, fmt.Errorf("failed to read key type: %w", err)
 	}
 
-	schemeTag := byte(schemeTagRaw)
+	return op(data, string(keyType), byte(schemeTagRaw))
+}
+
+// packed runs a host operation for an ABI v1 plugin and returns the packed pointer/length of
+// its result, allocated through the guest's Alloc export, or 0 on failure.
+func (h *HostFunctions) packed(ctx context.Context, mod api.Module, name string, op func() ([]byte, error)) uint64 {
+	defer profiling.HostCall(ctx)()
 
-	decrypted, err := h.hsm.DecryptKeyWithVariantScheme(encrypted, string(keyType), schemeTag)
+	result, err := op()
 	if err != nil {
-		log.Error().Err(err).Msg("failed to decrypt under LMK")
+		log.Error().Err(err).Msg("failed to " + name)
 		return 0
 	}
 
-	allocFn := mod.ExportedFunction("Alloc")
-	results, err := allocFn.Call(ctx, uint64(len(decrypted)))
-	if err != nil || len(results) == 0 {
-		log.Error().Err(err).Msg("failed to allocate memory for decrypted data")
+	ptr, err := writeGuest(ctx, mod, result)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to write result to " + name + " to memory")
 		return 0
 	}
 
-	resultPtr := uint32(results[0])
-	if err := writeMemory(mod, resultPtr, decrypted); err != nil {
-		log.Error().Err(err).Msg("failed to write decrypted data to memory")
-		return 0
+	return hsmplugin.PackResult(ptr, uint32(len(result)))
+}
+
+// keyBlockScheme is the scheme tag of key blocks.
+const keyBlockScheme = 'S'
+
+// defaultVariantLMKID is the ID of the variant LMK whose set the HSM instance holds.
+const defaultVariantLMKID = "00"
+
+// encryptKey encrypts a key under the LMK. For key blocks (scheme S) keyType is the header
+// template of the block, see logic.EncryptKeyBlock; other schemes use the variant LMK.
+func (h *HostFunctions) encryptKey(clear []byte, keyType string, scheme byte) ([]byte, error) {
+	if scheme != keyBlockScheme {
+		return h.hsm.EncryptKeyWithVariantScheme(clear, keyType, scheme)
 	}
 
-	return uint64(resultPtr)<<32 | uint64(len(decrypted))
+	return logic.EncryptKeyBlock(clear, []byte(keyType))
 }
 
-func (h *HostFunctions) generateRandomKey(_ context.Context, mod api.Module, length uint32) uint64 {
-	key, err := h.hsm.GenerateRandomKey(int(length))
-	if err != nil {
-		log.Error().Err(err).Msg("failed to generate random key")
-		return 0
+// translateKeyFromOldLMK translates a key from the old LMK to the current one. Key blocks
+// (scheme S) are rewrapped under the key block LMK named in their header; other schemes use
+// the variant LMK of the host functions.
+func translateKeyFromOldLMK(encrypted []byte, keyType string, scheme byte) ([]byte, error) {
+	lmkID := defaultVariantLMKID
+	if scheme == keyBlockScheme {
+		lmkID = ""
 	}
 
-	allocFn := mod.ExportedFunction("Alloc")
-	results, err := allocFn.Call(context.Background(), uint64(len(key)))
-	if err != nil || len(results) == 0 {
-		log.Error().Err(err).Msg("failed to allocate memory for random key")
-		return 0
-	}
+	return logic.TranslateFromOldLMK(encrypted, keyType, scheme, lmkID)
+}
 
-	resultPtr := uint32(results[0])
-	if err := writeMemory(mod, resultPtr, key); err != nil {
-		log.Error().Err(err).Msg("failed to write random key to memory")
-		return 0
+// decryptKey decrypts a key under the LMK. Key blocks (scheme S) are unwrapped under the
+// key block LMK named in their header; other schemes use the variant LMK.
+func (h *HostFunctions) decryptKey(encrypted []byte, keyType string, scheme byte) ([]byte, error) {
+	if scheme != keyBlockScheme {
+		return h.hsm.DecryptKeyWithVariantScheme(encrypted, keyType, scheme)
 	}
 
-	return uint64(resultPtr)<<32 | uint64(len(key))
+	return logic.UnwrapKeyBlock(encrypted)
 }
@@ -0,0 +1,81 @@
+package plugins
+
+import (
+	"context"
+	"encoding/hex"
+	"strings"
+
+	"github.com/andrei-cloud/go_hsm/internal/profiling"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/hsmplugin"
+	"github.com/andrei-cloud/go_hsm/pkg/keyschemes"
+	"github.com/rs/zerolog/log"
+	"github.com/tetratelabs/wazero/api"
+)
+
+// hsmCall is the language-agnostic host function. It reads a JSON request envelope from
+// guest memory and returns a packed pointer/length of the JSON response envelope, which is
+// allocated through the guest's Alloc export. Failures are reported inside the response
+// envelope; 0 is returned only when guest memory cannot be accessed.
+func (h *HostFunctions) hsmCall(ctx context.Context, mod api.Module, ptr, size uint32) uint64 {
+	defer profiling.HostCall(ctx)()
+
+	req, err := readMemory(mod, ptr, size)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to read hsm_call envelope")
+		return 0
+	}
+
+	resp := h.handleEnvelope(req)
+
+	resultPtr, err := writeGuest(ctx, mod, resp)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to write hsm_call response to memory")
+		return 0
+	}
+
+	return hsmplugin.PackResult(resultPtr, uint32(len(resp)))
+}
+
+// handleEnvelope executes a JSON request envelope and returns the JSON response envelope.
+func (h *HostFunctions) handleEnvelope(data []byte) []byte {
+	req, err := hsmplugin.ParseRequest(data)
+	if err != nil {
+		return hsmplugin.MarshalResponse(nil, err)
+	}
+
+	var result []byte
+	switch req.Op {
+	case hsmplugin.OpEncryptUnderLMK:
+		clear, _ := hex.DecodeString(req.Data)
+		result, err = h.hsm.EncryptKeyWithVariantScheme(clear, req.Key.Type, req.Key.Scheme[0])
+	case hsmplugin.OpDecryptUnderLMK:
+		result, err = h.decryptKeyRef(req.Key)
+	case hsmplugin.OpRandomKey:
+		result, err = h.hsm.GenerateRandomKey(req.Length)
+	case hsmplugin.OpKCV:
+		var clear []byte
+		if clear, err = h.decryptKeyRef(req.Key); err == nil {
+			keyCV := cryptoutils.KeyCV
+			if req.Key.Scheme != "" && keyschemes.IsAES(req.Key.Scheme[0]) {
+				keyCV = cryptoutils.AESKeyCV
+			}
+			var kcv []byte
+			kcv, err = keyCV([]byte(strings.ToUpper(hex.EncodeToString(clear))), 6)
+			if err == nil {
+				result, err = hex.DecodeString(string(kcv))
+			}
+		}
+	}
+	if err != nil {
+		log.Debug().Err(err).Str("op", req.Op).Msg("hsm_call operation failed")
+	}
+
+	return hsmplugin.MarshalResponse(result, err)
+}
+
+func (h *HostFunctions) decryptKeyRef(key *hsmplugin.KeyRef) ([]byte, error) {
+	encrypted, _ := hex.DecodeString(key.Value)
+
+	return h.decryptKey(encrypted, key.Type, key.Scheme[0])
+}
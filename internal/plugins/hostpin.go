@@ -0,0 +1,126 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/internal/hsm"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/hsmplugin"
+	"github.com/andrei-cloud/go_hsm/pkg/pinblock"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+)
+
+// fieldFunction is an ABI v2 host function taking its arguments as fields marshalled by
+// hsmplugin.MarshalFields.
+type fieldFunction struct {
+	fields int
+	call   func(fields [][]byte) ([]byte, error)
+}
+
+// fieldFunctions are the PIN and card verification host functions, so PIN and CVV commands
+// can be written as plugins without their own copy of the crypto.
+var fieldFunctions = map[string]fieldFunction{
+	hsmplugin.FuncPinBlockEncode: {fields: 3, call: pinBlockEncode},
+	hsmplugin.FuncPinBlockDecode: {fields: 3, call: pinBlockDecode},
+	hsmplugin.FuncVisaPVV:        {fields: 4, call: visaPVV},
+	hsmplugin.FuncVisaCVV:        {fields: 4, call: visaCVV},
+}
+
+// registerFieldFunctions adds fieldFunctions to builder.
+func (h *HostFunctions) registerFieldFunctions(builder wazero.HostModuleBuilder) {
+	for name, fn := range fieldFunctions {
+		builder.NewFunctionBuilder().
+			WithFunc(func(ctx context.Context, mod api.Module, ptr, size uint32) (uint32, uint32, uint32) {
+				return h.result(ctx, mod, name, func() ([]byte, error) {
+					data, err := readMemory(mod, ptr, size)
+					if err != nil {
+						return nil, err
+					}
+					fields, err := hsmplugin.UnmarshalFields(data, fn.fields)
+					if err != nil {
+						return nil, errorcodes.WithDetail(errorcodes.Err15, err.Error())
+					}
+
+					return fn.call(fields)
+				})
+			}).
+			Export(name)
+	}
+}
+
+// pinBlockFormat returns the PIN block format of a Thales format code.
+func pinBlockFormat(code []byte) (pinblock.PinBlockFormat, error) {
+	format, err := hsm.GetPinBlockFormatFromThalesCode(string(code))
+	if err != nil {
+		return 0, errorcodes.WithDetail(errorcodes.Err23, err.Error())
+	}
+
+	return format, nil
+}
+
+func pinBlockEncode(fields [][]byte) ([]byte, error) {
+	format, err := pinBlockFormat(fields[2])
+	if err != nil {
+		return nil, err
+	}
+	block, err := pinblock.EncodePinBlock(string(fields[0]), string(fields[1]), format)
+	if err != nil {
+		return nil, errorcodes.WithDetail(errorcodes.Err15, err.Error())
+	}
+
+	return []byte(block), nil
+}
+
+func pinBlockDecode(fields [][]byte) ([]byte, error) {
+	format, err := pinBlockFormat(fields[2])
+	if err != nil {
+		return nil, err
+	}
+	pin, err := pinblock.DecodePinBlock(string(fields[0]), string(fields[1]), format)
+	if err != nil {
+		return nil, errorcodes.WithDetail(errorcodes.Err20, err.Error())
+	}
+
+	return []byte(pin), nil
+}
+
+// visaPVV checks the lengths cryptoutils.GetVisaPVV relies on before calling it, so guest
+// input cannot make it slice out of range.
+func visaPVV(fields [][]byte) ([]byte, error) {
+	pan, pvki, pin, pvk := fields[0], fields[1], fields[2], fields[3]
+	switch {
+	case len(pan) < 11 || !isDigits(pan):
+		return nil, errorcodes.WithDetail(errorcodes.Err15, "account number must be at least 11 digits")
+	case len(pvki) != 1 || !isDigits(pvki):
+		return nil, errorcodes.WithDetail(errorcodes.Err15, "PVK index must be 1 digit")
+	case len(pin) < 4 || len(pin) > 12 || !isDigits(pin):
+		return nil, errorcodes.Err24
+	case len(pvk) != 16 && len(pvk) != 24:
+		return nil, errorcodes.WithDetail(errorcodes.Err27, fmt.Sprintf("PVK of %d bytes", len(pvk)))
+	}
+
+	// GetVisaPVV extends a double length PVK in place, so it gets a copy.
+	return cryptoutils.GetVisaPVV(string(pan), string(pvki), string(pin), append([]byte(nil), pvk...))
+}
+
+func isDigits(b []byte) bool {
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func visaCVV(fields [][]byte) ([]byte, error) {
+	cvv, err := cryptoutils.GetVisaCVV(string(fields[0]), string(fields[1]), string(fields[2]), fields[3])
+	if err != nil {
+		return nil, errorcodes.WithDetail(errorcodes.Err15, err.Error())
+	}
+
+	return cvv, nil
+}
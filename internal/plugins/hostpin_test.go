@@ -0,0 +1,83 @@
+package plugins
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/hsmplugin"
+)
+
+// callField calls the field function name with args as the guest marshals them.
+func callField(t *testing.T, name string, args ...[]byte) ([]byte, error) {
+	t.Helper()
+
+	fn := fieldFunctions[name]
+	fields, err := hsmplugin.UnmarshalFields(hsmplugin.MarshalFields(args...), fn.fields)
+	if err != nil {
+		t.Fatalf("UnmarshalFields() error = %v", err)
+	}
+
+	return fn.call(fields)
+}
+
+func TestPinBlockFunctions(t *testing.T) {
+	t.Parallel()
+
+	const pin, pan = "1234", "4000001234562"
+	block, err := callField(t, hsmplugin.FuncPinBlockEncode, []byte(pin), []byte(pan), []byte("01"))
+	if err != nil {
+		t.Fatalf("%s error = %v", hsmplugin.FuncPinBlockEncode, err)
+	}
+	if len(block) != 16 {
+		t.Fatalf("PIN block %q, want 16 hex characters", block)
+	}
+
+	got, err := callField(t, hsmplugin.FuncPinBlockDecode, block, []byte(pan), []byte("01"))
+	if err != nil || string(got) != pin {
+		t.Errorf("%s = %q, %v, want %s", hsmplugin.FuncPinBlockDecode, got, err, pin)
+	}
+
+	_, err = callField(t, hsmplugin.FuncPinBlockEncode, []byte(pin), []byte(pan), []byte("99"))
+	if !errors.Is(err, errorcodes.Err23) {
+		t.Errorf("unknown format error = %v, want Err23", err)
+	}
+}
+
+func TestVisaFunctions(t *testing.T) {
+	t.Parallel()
+
+	key, _ := hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+	const account = "400000123456"
+
+	want, err := cryptoutils.GetVisaPVV(account, "1", "1234", append([]byte(nil), key...))
+	if err != nil {
+		t.Fatalf("GetVisaPVV() error = %v", err)
+	}
+	pvv, err := callField(t, hsmplugin.FuncVisaPVV, []byte(account), []byte("1"), []byte("1234"), key)
+	if err != nil || string(pvv) != string(want) {
+		t.Errorf("%s = %q, %v, want %s", hsmplugin.FuncVisaPVV, pvv, err, want)
+	}
+
+	// Input GetVisaPVV would slice out of range is rejected.
+	for _, args := range [][][]byte{
+		{[]byte("1234"), []byte("1"), []byte("1234"), key},
+		{[]byte(account), []byte("1"), []byte("12"), key},
+		{[]byte(account), []byte("1"), []byte("1234"), key[:8]},
+	} {
+		if _, err := callField(t, hsmplugin.FuncVisaPVV, args...); err == nil {
+			t.Errorf("%s(%q) succeeded", hsmplugin.FuncVisaPVV, args[:3])
+		}
+	}
+
+	want, err = cryptoutils.GetVisaCVV("4000001234562", "2512", "101", key)
+	if err != nil {
+		t.Fatalf("GetVisaCVV() error = %v", err)
+	}
+	cvv, err := callField(t, hsmplugin.FuncVisaCVV, []byte("4000001234562"), []byte("2512"), []byte("101"), key)
+	if err != nil || string(cvv) != string(want) {
+		t.Errorf("%s = %q, %v, want %s", hsmplugin.FuncVisaCVV, cvv, err, want)
+	}
+}
@@ -11,4 +11,9 @@ type PluginInstance struct {
 	VersionFn     api.Function
 	DescriptionFn api.Function
 	AuthorFn      api.Function
+	// ABI is the plugin ABI version of the module, see hsmplugin.ABIv1 and hsmplugin.ABIv2.
+	ABI int
+	// StreamsInput reports that the plugin imports input_read, so large command input is
+	// streamed to it instead of written through Alloc.
+	StreamsInput bool
 }
@@ -1,33 +1,302 @@
 // Package plugins provides the PluginInstancePool type for managing WASM plugin instance pools.
 package plugins
 
-// PluginInstancePool manages a pool of WASM module instances for a plugin.
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Pool sizing defaults.
+const (
+	DefaultPoolMinSize        = 1
+	DefaultPoolMaxSize        = 10
+	DefaultPoolAcquireTimeout = 5 * time.Second
+	DefaultPoolIdleTimeout    = time.Minute
+)
+
+// ErrPoolExhausted is returned when no plugin instance becomes available within the acquire
+// timeout of the pool.
+var ErrPoolExhausted = errors.New("plugin instance pool exhausted")
+
+// PoolConfig sizes the instance pool of a plugin. Zero fields select the defaults.
+type PoolConfig struct {
+	// MinSize is the number of instances kept when the plugin is idle.
+	MinSize int `mapstructure:"min_size"`
+	// MaxSize is the number of instances the pool grows to under load.
+	MaxSize int `mapstructure:"max_size"`
+	// AcquireTimeout is how long a command waits for an instance when the pool is at its
+	// maximum size; a negative value waits without limit.
+	AcquireTimeout time.Duration `mapstructure:"acquire_timeout"`
+	// IdleTimeout is how long an instance above MinSize stays idle before it is closed.
+	IdleTimeout time.Duration `mapstructure:"idle_timeout"`
+}
+
+// withDefaults returns c with its zero fields set to the defaults, or an error when the
+// sizes are inconsistent.
+func (c PoolConfig) withDefaults() (PoolConfig, error) {
+	if c.MinSize == 0 {
+		c.MinSize = DefaultPoolMinSize
+	}
+	if c.MaxSize == 0 {
+		c.MaxSize = max(DefaultPoolMaxSize, c.MinSize)
+	}
+	if c.AcquireTimeout == 0 {
+		c.AcquireTimeout = DefaultPoolAcquireTimeout
+	}
+	if c.IdleTimeout == 0 {
+		c.IdleTimeout = DefaultPoolIdleTimeout
+	}
+	if c.MinSize < 1 || c.MaxSize < c.MinSize {
+		return c, fmt.Errorf("invalid plugin pool size: min %d, max %d", c.MinSize, c.MaxSize)
+	}
+	if c.IdleTimeout < 0 {
+		return c, fmt.Errorf("invalid plugin pool idle timeout %s", c.IdleTimeout)
+	}
+
+	return c, nil
+}
+
+// Validate returns an error when the sizes or timeouts of c are invalid.
+func (c PoolConfig) Validate() error {
+	_, err := c.withDefaults()
+
+	return err
+}
+
+// PluginInstancePool manages a pool of WASM module instances for a plugin. The pool grows on
+// demand up to its maximum size, makes commands wait for an instance when it is exhausted,
+// and closes the instances above its minimum size once they have been idle for its idle
+// timeout.
 type PluginInstancePool struct {
-	pool    chan *PluginInstance
-	maxSize int
+	config  PoolConfig
+	idle    chan *PluginInstance
+	slots   chan struct{}
 	factory func() (*PluginInstance, error)
+
+	// mu guards the accounting reported by Stats.
+	mu       sync.Mutex
+	memory   map[*PluginInstance]uint32
+	lastUsed map[*PluginInstance]time.Time
+	created  uint64
+	dropped  uint64
+	waited   uint64
+	timedOut uint64
+}
+
+// PoolStats is a snapshot of a plugin instance pool.
+type PoolStats struct {
+	// Instances is the number of live instances, idle or in use.
+	Instances int
+	// Idle is the number of instances waiting in the pool.
+	Idle int
+	// MaxSize is the number of instances the pool may grow to.
+	MaxSize int
+	// Created and Dropped count the instances instantiated and discarded over the pool's life.
+	Created uint64
+	Dropped uint64
+	// Waited counts the commands that waited for an instance of an exhausted pool, and
+	// TimedOut those that gave up after the acquire timeout.
+	Waited   uint64
+	TimedOut uint64
+	// MemoryBytes is the WASM linear memory of the live instances, each measured when it was
+	// created or last returned to the pool.
+	MemoryBytes uint64
+}
+
+// newPluginInstancePool returns an empty pool creating its instances with factory.
+func newPluginInstancePool(config PoolConfig, factory func() (*PluginInstance, error)) (*PluginInstancePool, error) {
+	config, err := config.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	return &PluginInstancePool{
+		config:   config,
+		idle:     make(chan *PluginInstance, config.MaxSize),
+		slots:    make(chan struct{}, config.MaxSize),
+		factory:  factory,
+		memory:   make(map[*PluginInstance]uint32),
+		lastUsed: make(map[*PluginInstance]time.Time),
+	}, nil
 }
 
-// Get returns an instance from the pool, creating a new one if needed.
+// Get returns an idle instance, creating a new one while the pool is below its maximum size.
+// An exhausted pool waits for an instance to be returned and fails with ErrPoolExhausted after
+// the acquire timeout.
 func (p *PluginInstancePool) Get() (*PluginInstance, error) {
 	select {
-	case inst := <-p.pool:
+	case inst := <-p.idle:
 		return inst, nil
 	default:
-		if len(p.pool) < p.maxSize {
-			return p.factory()
-		}
-		// Wait for an instance to become available.
-		return <-p.pool, nil
+	}
+	select {
+	case p.slots <- struct{}{}:
+		return p.create()
+	default:
+	}
+
+	p.mu.Lock()
+	p.waited++
+	p.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if p.config.AcquireTimeout > 0 {
+		timer := time.NewTimer(p.config.AcquireTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case inst := <-p.idle:
+		return inst, nil
+	case p.slots <- struct{}{}:
+		return p.create()
+	case <-timeout:
+		p.mu.Lock()
+		p.timedOut++
+		p.mu.Unlock()
+
+		return nil, fmt.Errorf("%w after %s", ErrPoolExhausted, p.config.AcquireTimeout)
 	}
 }
 
-// Put returns an instance to the pool.
+// Put returns an instance to the pool. Closed instances, such as those interrupted by the
+// execution timeout, are discarded.
 func (p *PluginInstancePool) Put(inst *PluginInstance) {
+	if inst.Module != nil && inst.Module.IsClosed() {
+		p.drop(inst)
+
+		return
+	}
+
+	// inst is not executing, so its memory can be measured.
+	size := memorySize(inst)
+
+	p.mu.Lock()
+	if _, ok := p.memory[inst]; ok {
+		p.memory[inst] = size
+		p.lastUsed[inst] = time.Now()
+	}
+	p.mu.Unlock()
+
 	select {
-	case p.pool <- inst:
+	case p.idle <- inst:
 		// returned to pool
 	default:
 		// pool full, drop instance
+		p.drop(inst)
+	}
+}
+
+// Shrink closes the instances above the minimum size of the pool that have been idle since
+// before now minus the idle timeout, and returns how many it closed.
+func (p *PluginInstancePool) Shrink(now time.Time) int {
+	closed := 0
+	for range len(p.idle) {
+		var inst *PluginInstance
+		select {
+		case inst = <-p.idle:
+		default:
+			return closed
+		}
+
+		p.mu.Lock()
+		expired := len(p.memory) > p.config.MinSize && now.Sub(p.lastUsed[inst]) >= p.config.IdleTimeout
+		p.mu.Unlock()
+		if expired {
+			p.drop(inst)
+			closed++
+
+			continue
+		}
+		select {
+		case p.idle <- inst:
+		default:
+			p.drop(inst)
+		}
+	}
+
+	return closed
+}
+
+// Stats returns a snapshot of the pool.
+func (p *PluginInstancePool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := PoolStats{
+		Instances: len(p.memory),
+		Idle:      len(p.idle),
+		MaxSize:   p.config.MaxSize,
+		Created:   p.created,
+		Dropped:   p.dropped,
+		Waited:    p.waited,
+		TimedOut:  p.timedOut,
+	}
+	for _, size := range p.memory {
+		stats.MemoryBytes += uint64(size)
+	}
+
+	return stats
+}
+
+// fill creates instances up to the minimum size of the pool.
+func (p *PluginInstancePool) fill() error {
+	for range p.config.MinSize {
+		p.slots <- struct{}{}
+		inst, err := p.create()
+		if err != nil {
+			return err
+		}
+		p.idle <- inst
+	}
+
+	return nil
+}
+
+// create instantiates a new instance in a slot already taken and starts accounting for it.
+// The slot is released when the instance cannot be created.
+func (p *PluginInstancePool) create() (*PluginInstance, error) {
+	inst, err := p.factory()
+	if err != nil {
+		<-p.slots
+
+		return nil, err
 	}
+
+	p.mu.Lock()
+	p.memory[inst] = memorySize(inst)
+	p.lastUsed[inst] = time.Now()
+	p.created++
+	p.mu.Unlock()
+
+	return inst, nil
+}
+
+// drop closes inst and releases its slot.
+func (p *PluginInstancePool) drop(inst *PluginInstance) {
+	p.mu.Lock()
+	_, live := p.memory[inst]
+	delete(p.memory, inst)
+	delete(p.lastUsed, inst)
+	p.dropped++
+	p.mu.Unlock()
+
+	if inst != nil && inst.Module != nil {
+		_ = inst.Module.Close(context.Background())
+	}
+	if live {
+		<-p.slots
+	}
+}
+
+// memorySize returns the size of the linear memory of inst in bytes.
+func memorySize(inst *PluginInstance) uint32 {
+	if inst == nil || inst.Module == nil || inst.Module.Memory() == nil {
+		return 0
+	}
+
+	return inst.Module.Memory().Size()
 }
@@ -0,0 +1,92 @@
+package plugins
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestInstancePoolSizing(t *testing.T) {
+	t.Parallel()
+
+	pool, err := newPluginInstancePool(PoolConfig{
+		MinSize:        1,
+		MaxSize:        2,
+		AcquireTimeout: 10 * time.Millisecond,
+		IdleTimeout:    time.Minute,
+	}, func() (*PluginInstance, error) { return &PluginInstance{}, nil })
+	if err != nil {
+		t.Fatalf("newPluginInstancePool() error = %v", err)
+	}
+	if err := pool.fill(); err != nil {
+		t.Fatalf("fill() error = %v", err)
+	}
+
+	first, err := pool.Get()
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	second, err := pool.Get()
+	if err != nil {
+		t.Fatalf("Get() growing the pool error = %v", err)
+	}
+	if _, err := pool.Get(); !errors.Is(err, ErrPoolExhausted) {
+		t.Fatalf("Get() from an exhausted pool error = %v, want ErrPoolExhausted", err)
+	}
+
+	// A waiting command gets the instance returned to the pool.
+	go func() {
+		time.Sleep(time.Millisecond)
+		pool.Put(first)
+	}()
+	pool.config.AcquireTimeout = time.Second
+	third, err := pool.Get()
+	if err != nil {
+		t.Fatalf("Get() waiting for an instance error = %v", err)
+	}
+	pool.Put(second)
+	pool.Put(third)
+
+	stats := pool.Stats()
+	if stats.Instances != 2 || stats.Idle != 2 || stats.Waited != 2 || stats.TimedOut != 1 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+
+	if n := pool.Shrink(time.Now()); n != 0 {
+		t.Errorf("Shrink() before the idle timeout closed %d instances", n)
+	}
+	if n := pool.Shrink(time.Now().Add(time.Hour)); n != 1 {
+		t.Errorf("Shrink() after the idle timeout closed %d instances, want 1", n)
+	}
+	if stats := pool.Stats(); stats.Instances != 1 || stats.Dropped != 1 {
+		t.Errorf("Stats() after Shrink() = %+v", stats)
+	}
+}
+
+func TestPoolConfigValidation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		config  PoolConfig
+		wantErr bool
+	}{
+		{name: "defaults", config: PoolConfig{}},
+		{name: "large minimum", config: PoolConfig{MinSize: 20}},
+		{name: "max below min", config: PoolConfig{MinSize: 4, MaxSize: 2}, wantErr: true},
+		{name: "negative min", config: PoolConfig{MinSize: -1}, wantErr: true},
+		{name: "negative idle timeout", config: PoolConfig{IdleTimeout: -time.Second}, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := tc.config.withDefaults()
+			if (err != nil) != tc.wantErr {
+				t.Errorf("withDefaults() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -12,9 +12,11 @@ import (
 	"time"
 
 	"github.com/andrei-cloud/go_hsm/internal/hsm"
+	"github.com/andrei-cloud/go_hsm/internal/profiling"
 	"github.com/andrei-cloud/go_hsm/pkg/hsmplugin"
 	"github.com/rs/zerolog/log"
 	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
 	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
 )
 
@@ -26,28 +28,106 @@ type PluginManager struct {
 	hsm        *hsm.HSM
 	hostFuncs  *HostFunctions
 	bufferPool *hsmplugin.BufferPool
+	env        map[string]string
+	poolConfig PoolConfig
+	poolByCmd  map[string]PoolConfig
+	runtimeCfg RuntimeConfig
+	reapOnce   sync.Once
+	closeOnce  sync.Once
+	done       chan struct{}
 	mu         sync.RWMutex
 }
 
+// shrinkInterval is how often the idle plugin instances are reaped.
+const shrinkInterval = 10 * time.Second
+
 // NewPluginManager returns a PluginManager ready to load plugins.
 func NewPluginManager(
 	ctx context.Context,
 	hsmInstance *hsm.HSM,
 ) *PluginManager {
+	runtimeCfg, _ := RuntimeConfig{}.withDefaults()
 	pm := &PluginManager{
 		ctx:        ctx,
 		plugins:    make(map[string]*PluginInstancePool),
 		hsm:        hsmInstance,
 		bufferPool: hsmplugin.NewBufferPool(),
+		runtimeCfg: runtimeCfg,
+		done:       make(chan struct{}),
 	}
 
 	return pm
 }
 
+// SetPoolConfig sizes the instance pools of plugins loaded afterwards: config applies to
+// every plugin except the commands given their own configuration in byCommand.
+func (pm *PluginManager) SetPoolConfig(config PoolConfig, byCommand map[string]PoolConfig) error {
+	if _, err := config.withDefaults(); err != nil {
+		return err
+	}
+	normalized := make(map[string]PoolConfig, len(byCommand))
+	for cmd, c := range byCommand {
+		if _, err := c.withDefaults(); err != nil {
+			return fmt.Errorf("command %s: %w", cmd, err)
+		}
+		normalized[strings.ToUpper(cmd)] = c
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	pm.poolConfig, pm.poolByCmd = config, normalized
+
+	return nil
+}
+
+// SetRuntimeConfig configures the WASM runtime of plugins loaded afterwards and the limits of
+// the commands they execute.
+func (pm *PluginManager) SetRuntimeConfig(config RuntimeConfig) error {
+	config, err := config.withDefaults()
+	if err != nil {
+		return err
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	pm.runtimeCfg = config
+
+	return nil
+}
+
+// LimitErrorCode returns the error code answering a command that failed with err when err
+// reports an exceeded plugin limit, see ErrExecTimeout and ErrMemoryLimit.
+func (pm *PluginManager) LimitErrorCode(err error) (string, bool) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	switch {
+	case errors.Is(err, ErrExecTimeout):
+		return pm.runtimeCfg.TimeoutErrorCode, true
+	case errors.Is(err, ErrMemoryLimit):
+		return pm.runtimeCfg.MemoryErrorCode, true
+	default:
+		return "", false
+	}
+}
+
+// SetEnv sets an environment variable visible to plugins loaded afterwards.
+func (pm *PluginManager) SetEnv(key, value string) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if pm.env == nil {
+		pm.env = make(map[string]string)
+	}
+	pm.env[key] = value
+}
+
 // LoadAll loads all WASM plugins from the specified directory.
-// It uses wazero's AOT compilation with a shared compilation cache
-// for optimal performance and memory use. This approach ensures
-// high-throughput plugin execution while controlling memory growth.
+// It uses wazero's AOT compilation, unless the runtime configuration selects the
+// interpreter, with a shared compilation cache for optimal performance and memory use.
+// This approach ensures high-throughput plugin execution while controlling memory growth.
 func (pm *PluginManager) LoadAll(dir string) error {
 	files, err := os.ReadDir(dir)
 	if err != nil {
@@ -55,7 +135,7 @@ func (pm *PluginManager) LoadAll(dir string) error {
 	}
 
 	// Create new runtime with compilation cache for better performance
-	runtimeConfig := wazero.NewRuntimeConfig().
+	runtimeConfig := pm.runtimeCfg.wazeroConfig().
 		WithCompilationCache(wazero.NewCompilationCache())
 	newRt := wazero.NewRuntimeWithConfig(pm.ctx, runtimeConfig)
 
@@ -85,7 +165,16 @@ func (pm *PluginManager) LoadAll(dir string) error {
 			log.Debug().Err(err).Str("file", f.Name()).Msg("failed to compile plugin module")
 			continue
 		}
+		abi, err := hsmplugin.DetectABI(compiled.ExportedFunctions())
+		if err != nil {
+			log.Debug().Err(err).Str("file", f.Name()).Msg("unsupported plugin module")
+			continue
+		}
+		streamsInput := importsInputRead(compiled)
 		cfg := wazero.NewModuleConfig().WithName(cmdCode).WithStartFunctions()
+		for key, value := range pm.env {
+			cfg = cfg.WithEnv(key, value)
+		}
 		factory := func() (*PluginInstance, error) {
 			instance, err := newRt.InstantiateModule(pm.ctx, compiled, cfg)
 			if err != nil {
@@ -108,22 +197,30 @@ func (pm *PluginManager) LoadAll(dir string) error {
 				VersionFn:     versionFn,
 				DescriptionFn: descriptionFn,
 				AuthorFn:      authorFn,
+				ABI:           abi,
+				StreamsInput:  streamsInput,
 			}, nil
 		}
-		pool := &PluginInstancePool{
-			pool:    make(chan *PluginInstance, 10),
-			maxSize: 10,
-			factory: factory,
+		poolConfig, ok := pm.poolByCmd[cmdCode]
+		if !ok {
+			poolConfig = pm.poolConfig
 		}
-		// Pre-fill pool with one instance
-		inst, err := factory()
+		pool, err := newPluginInstancePool(poolConfig, factory)
 		if err != nil {
+			return fmt.Errorf("plugin %s: %w", cmdCode, err)
+		}
+		// Pre-fill pool up to its minimum size
+		if err := pool.fill(); err != nil {
 			log.Debug().Err(err).Str("file", f.Name()).Msg("failed to instantiate plugin module")
 			continue
 		}
-		pool.pool <- inst
+		inst, err := pool.Get()
+		if err != nil {
+			continue
+		}
 		// Validate plugin metadata
 		version, description, author := pm.getPluginMetadataFromInstance(inst)
+		pool.Put(inst)
 		if version == "N/A" || description == "N/A" || author == "N/A" {
 			log.Warn().
 				Str("file", f.Name()).
@@ -148,9 +245,35 @@ func (pm *PluginManager) LoadAll(dir string) error {
 	pm.plugins = newPlugins
 	pm.mu.Unlock()
 
+	pm.reapOnce.Do(func() { go pm.reapIdle() })
+
 	return nil
 }
 
+// reapIdle shrinks the instance pools of idle plugins until the manager is closed or its
+// context is done.
+func (pm *PluginManager) reapIdle() {
+	ticker := time.NewTicker(shrinkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-pm.done:
+			return
+		case <-pm.ctx.Done():
+			return
+		case now := <-ticker.C:
+			pm.mu.RLock()
+			for cmd, pool := range pm.plugins {
+				if n := pool.Shrink(now); n > 0 {
+					log.Debug().Str("command", cmd).Int("closed", n).Msg("closed idle plugin instances")
+				}
+			}
+			pm.mu.RUnlock()
+		}
+	}
+}
+
 // GetPluginMetadata returns the metadata for a given plugin command.
 func (pm *PluginManager) GetPluginMetadata(cmd string) (string, string, string) {
 	pm.mu.RLock()
@@ -173,49 +296,129 @@ func (pm *PluginManager) GetPluginMetadata(cmd string) (string, string, string)
 func (pm *PluginManager) getPluginMetadataFromInstance(
 	inst *PluginInstance,
 ) (string, string, string) {
-	var version, description, author string
-	ctx := pm.ctx
-	if inst.VersionFn != nil {
-		if results, err := inst.VersionFn.Call(ctx); err == nil && len(results) > 0 {
-			ptr, size := hsmplugin.UnpackResult(results[0])
-			if size > 0 {
-				if bytes, ok := inst.Module.Memory().Read(ptr, size); ok {
-					version = string(bytes)
-				}
-			}
+	version := pm.readMetadata(inst, inst.VersionFn)
+	description := pm.readMetadata(inst, inst.DescriptionFn)
+	author := pm.readMetadata(inst, inst.AuthorFn)
+
+	return version, description, author
+}
+
+// readMetadata calls a metadata export of inst and returns the string it points to, or
+// "N/A" when it cannot be read. ABI v1 exports return a packed pointer and length, ABI v2
+// exports return them as two values.
+func (pm *PluginManager) readMetadata(inst *PluginInstance, fn api.Function) string {
+	if fn == nil {
+		return "N/A"
+	}
+	results, err := fn.Call(pm.ctx)
+	if err != nil || len(results) == 0 {
+		return "N/A"
+	}
+	ptr, size := hsmplugin.UnpackResult(results[0])
+	if inst.ABI == hsmplugin.ABIv2 && len(results) == 2 {
+		ptr, size = api.DecodeU32(results[0]), api.DecodeU32(results[1])
+	}
+	if size == 0 {
+		return "N/A"
+	}
+	data, ok := inst.Module.Memory().Read(ptr, size)
+	if !ok {
+		return "N/A"
+	}
+
+	return string(data)
+}
+
+// passInput makes input available to inst and returns the context and input pointer to
+// call Execute with. Input larger than hsmplugin.InputChunkSize is streamed to plugins that
+// import input_read: the pointer is 0 and the plugin pulls the bytes in chunks. Other input
+// is written to guest memory allocated with Alloc.
+func (pm *PluginManager) passInput(
+	ctx context.Context,
+	inst *PluginInstance,
+	input []byte,
+) (context.Context, uint32, error) {
+	if inst.StreamsInput && len(input) > hsmplugin.InputChunkSize {
+		return withStreamedInput(ctx, input), 0, nil
+	}
+
+	ptr, err := AllocBuffer(pm.ctx, inst.Module, inst.AllocFn, input)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to allocate memory: %w", err)
+	}
+
+	return ctx, ptr, nil
+}
+
+// importsInputRead reports whether a plugin module imports the input_read host function.
+func importsInputRead(compiled wazero.CompiledModule) bool {
+	for _, fn := range compiled.ImportedFunctions() {
+		if module, name, ok := fn.Import(); ok && module == "env" && name == inputReadFunc {
+			return true
 		}
 	}
-	if inst.DescriptionFn != nil {
-		if results, err := inst.DescriptionFn.Call(ctx); err == nil && len(results) > 0 {
-			ptr, size := hsmplugin.UnpackResult(results[0])
-			if size > 0 {
-				if bytes, ok := inst.Module.Memory().Read(ptr, size); ok {
-					description = string(bytes)
-				}
-			}
+
+	return false
+}
+
+// run executes cmd on inst within the execution timeout. An instance that exceeded a limit
+// of the runtime configuration is closed, so it is discarded when returned to its pool.
+func (pm *PluginManager) run(
+	ctx context.Context,
+	inst *PluginInstance,
+	cmd string,
+	ptr, length uint32,
+) ([]byte, error) {
+	pm.mu.RLock()
+	config := pm.runtimeCfg
+	pm.mu.RUnlock()
+
+	// Add context timeout to avoid hung plugins
+	ctx, cancel := context.WithTimeout(ctx, config.ExecTimeout)
+	defer cancel()
+
+	result, err := execute(ctx, inst, cmd, ptr, length)
+	if err != nil {
+		if limitErr := config.limitError(ctx, inst, err); limitErr != nil {
+			_ = inst.Module.Close(pm.ctx)
+
+			return nil, limitErr
 		}
 	}
-	if inst.AuthorFn != nil {
-		if results, err := inst.AuthorFn.Call(ctx); err == nil && len(results) > 0 {
-			ptr, size := hsmplugin.UnpackResult(results[0])
-			if size > 0 {
-				if bytes, ok := inst.Module.Memory().Read(ptr, size); ok {
-					author = string(bytes)
-				}
-			}
+
+	return result, err
+}
+
+// execute calls the Execute export of inst with the input at ptr and returns the response to
+// cmd. The error code returned by an ABI v2 plugin is formatted into the error response, with
+// its diagnostic detail, as ABI v1 plugins format it themselves.
+func execute(ctx context.Context, inst *PluginInstance, cmd string, ptr, length uint32) ([]byte, error) {
+	if inst.ABI != hsmplugin.ABIv2 {
+		res, err := CallExecute(ctx, inst.ExecuteFn, ptr, length)
+		if err != nil {
+			return nil, fmt.Errorf("plugin execution failed: %w", err)
+		}
+		result, err := ReadBuffer(inst.Module, hsmplugin.Buffer(res))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
 		}
+
+		return result, nil
 	}
-	if version == "" {
-		version = "N/A"
+
+	resPtr, resLen, code, err := CallExecuteV2(ctx, inst.ExecuteFn, ptr, length)
+	if err != nil {
+		return nil, fmt.Errorf("plugin execution failed: %w", err)
 	}
-	if description == "" {
-		description = "N/A"
+	result, err := ReadBuffer(inst.Module, hsmplugin.Buffer(hsmplugin.PackResult(resPtr, resLen)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
-	if author == "" {
-		author = "N/A"
+	if code != 0 {
+		return hsmplugin.FormatErrorResponse(cmd, hsmplugin.DecodeErrorCode(code), string(result)), nil
 	}
 
-	return version, description, author
+	return result, nil
 }
 
 // ExecuteCommand executes a command via its WASM plugin.
@@ -233,10 +436,10 @@ func (pm *PluginManager) ExecuteCommand(cmd string, input []byte) ([]byte, error
 	}
 	defer pool.Put(inst)
 
-	// Allocate guest memory for input
-	ptr, err := AllocBuffer(pm.ctx, inst.Module, inst.AllocFn, input)
+	// Allocate guest memory for input, or stream it when it is large
+	inputCtx, ptr, err := pm.passInput(pm.ctx, inst, input)
 	if err != nil {
-		return nil, fmt.Errorf("failed to allocate memory: %w", err)
+		return nil, err
 	}
 
 	log.Debug().
@@ -246,20 +449,9 @@ func (pm *PluginManager) ExecuteCommand(cmd string, input []byte) ([]byte, error
 		Hex("input", input).
 		Msg("executing plugin")
 
-	// Add context timeout to avoid hung plugins
-	ctx, cancel := context.WithTimeout(pm.ctx, 2*time.Second) // TODO: make timeout configurable
-	defer cancel()
-
-	// TODO: Update CallExecute and plugin ABI to use WASM multi-value returns for pointer/length
-	res, err := CallExecute(ctx, inst.ExecuteFn, ptr, uint32(len(input)))
-	if err != nil {
-		return nil, fmt.Errorf("plugin execution failed: %w", err)
-	}
-
-	// Read result from plugin memory
-	result, err := ReadBuffer(inst.Module, hsmplugin.Buffer(res))
+	result, err := pm.run(inputCtx, inst, cmd, ptr, uint32(len(input)))
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, err
 	}
 
 	log.Debug().
@@ -291,9 +483,9 @@ func (pm *PluginManager) ExecuteCommandWithContext(
 	}
 	defer pool.Put(inst)
 
-	ptr, err := AllocBuffer(pm.ctx, inst.Module, inst.AllocFn, input)
+	ctx, ptr, err := pm.passInput(ctx, inst, input)
 	if err != nil {
-		return nil, fmt.Errorf("failed to allocate memory: %w", err)
+		return nil, err
 	}
 
 	requestID := ""
@@ -310,17 +502,11 @@ func (pm *PluginManager) ExecuteCommandWithContext(
 		Hex("input", input).
 		Msg("executing plugin")
 
-	execCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
-	defer cancel()
-
-	res, err := CallExecute(execCtx, inst.ExecuteFn, ptr, uint32(len(input)))
+	start := time.Now()
+	result, err := pm.run(ctx, inst, cmd, ptr, uint32(len(input)))
+	profiling.FromContext(ctx).Executed(time.Since(start))
 	if err != nil {
-		return nil, fmt.Errorf("plugin execution failed: %w", err)
-	}
-
-	result, err := ReadBuffer(inst.Module, hsmplugin.Buffer(res))
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, err
 	}
 
 	log.Debug().
@@ -336,6 +522,8 @@ func (pm *PluginManager) ExecuteCommandWithContext(
 
 // Close releases all resources.
 func (pm *PluginManager) Close() error {
+	pm.closeOnce.Do(func() { close(pm.done) })
+
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
 
@@ -367,6 +555,40 @@ func (pm *PluginManager) ListPlugins() []string {
 	return result
 }
 
+// RuntimeStats is a snapshot of the memory held by the plugin runtime.
+type RuntimeStats struct {
+	// Pools holds the instance pool of each loaded plugin by command code.
+	Pools map[string]PoolStats
+	// Buffers reports the host buffer pool.
+	Buffers hsmplugin.BufferPoolStats
+}
+
+// WASMMemoryBytes returns the linear memory of all live plugin instances.
+func (s RuntimeStats) WASMMemoryBytes() uint64 {
+	var total uint64
+	for _, pool := range s.Pools {
+		total += pool.MemoryBytes
+	}
+
+	return total
+}
+
+// Stats returns the instance pool and buffer pool usage of the loaded plugins.
+func (pm *PluginManager) Stats() RuntimeStats {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	stats := RuntimeStats{Pools: make(map[string]PoolStats, len(pm.plugins))}
+	for cmd, pool := range pm.plugins {
+		stats.Pools[cmd] = pool.Stats()
+	}
+	if pm.bufferPool != nil {
+		stats.Buffers = pm.bufferPool.Stats()
+	}
+
+	return stats
+}
+
 // HSM returns the HSM instance.
 func (pm *PluginManager) HSM() *hsm.HSM {
 	return pm.hsm
@@ -0,0 +1,135 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+)
+
+// WASM runtime engines. EngineAuto compiles plugins where wazero supports a compiler for the
+// platform and falls back to the interpreter elsewhere.
+const (
+	EngineAuto        = "auto"
+	EngineCompiler    = "compiler"
+	EngineInterpreter = "interpreter"
+)
+
+// Runtime defaults.
+const (
+	DefaultExecTimeout      = 2 * time.Second
+	DefaultTimeoutErrorCode = "41"
+	DefaultMemoryErrorCode  = "12"
+)
+
+// wasmPageSize is the size of a page of WASM linear memory.
+const wasmPageSize = 64 << 10
+
+// maxMemoryLimitMB is the 4 GiB addressable by 32-bit WASM memory.
+const maxMemoryLimitMB = 4 << 10
+
+var (
+	// ErrExecTimeout is returned when a plugin does not complete a command within the
+	// execution timeout. The plugin instance is discarded.
+	ErrExecTimeout = errors.New("plugin execution time limit exceeded")
+
+	// ErrMemoryLimit is returned when a plugin fails after its linear memory reached the
+	// memory limit. The plugin instance is discarded.
+	ErrMemoryLimit = errors.New("plugin memory limit exceeded")
+)
+
+// RuntimeConfig configures the WASM runtime plugins run in. Zero fields select the defaults.
+// wazero has no fuel metering, so the CPU time of a command is bounded by ExecTimeout, which
+// interrupts running plugin code.
+type RuntimeConfig struct {
+	// Engine is EngineAuto, EngineCompiler or EngineInterpreter.
+	Engine string `mapstructure:"engine"`
+	// MemoryLimitMB caps the linear memory of each plugin instance; 0 leaves the 4 GiB WASM
+	// limit.
+	MemoryLimitMB int `mapstructure:"memory_limit_mb"`
+	// ExecTimeout bounds the execution of one command.
+	ExecTimeout time.Duration `mapstructure:"exec_timeout"`
+	// TimeoutErrorCode answers commands whose plugin exceeded ExecTimeout, and
+	// MemoryErrorCode those whose plugin exceeded MemoryLimitMB.
+	TimeoutErrorCode string `mapstructure:"timeout_error_code"`
+	MemoryErrorCode  string `mapstructure:"memory_error_code"`
+}
+
+// withDefaults returns c with its zero fields set to the defaults, or an error when a field
+// is invalid.
+func (c RuntimeConfig) withDefaults() (RuntimeConfig, error) {
+	if c.Engine == "" {
+		c.Engine = EngineAuto
+	}
+	if c.ExecTimeout == 0 {
+		c.ExecTimeout = DefaultExecTimeout
+	}
+	if c.TimeoutErrorCode == "" {
+		c.TimeoutErrorCode = DefaultTimeoutErrorCode
+	}
+	if c.MemoryErrorCode == "" {
+		c.MemoryErrorCode = DefaultMemoryErrorCode
+	}
+
+	switch {
+	case c.Engine != EngineAuto && c.Engine != EngineCompiler && c.Engine != EngineInterpreter:
+		return c, fmt.Errorf("invalid plugin runtime engine %q", c.Engine)
+	case c.MemoryLimitMB < 0 || c.MemoryLimitMB > maxMemoryLimitMB:
+		return c, fmt.Errorf("invalid plugin memory limit %d MB", c.MemoryLimitMB)
+	case c.ExecTimeout < 0:
+		return c, fmt.Errorf("invalid plugin execution timeout %s", c.ExecTimeout)
+	case len(c.TimeoutErrorCode) != 2 || len(c.MemoryErrorCode) != 2:
+		return c, errors.New("plugin limit error codes must be 2 characters")
+	}
+
+	return c, nil
+}
+
+// Validate returns an error when a field of c is invalid.
+func (c RuntimeConfig) Validate() error {
+	_, err := c.withDefaults()
+
+	return err
+}
+
+// wazeroConfig returns the wazero runtime configuration of c. Execution is interrupted when
+// the context of a call is done, so ExecTimeout stops plugins stuck in a loop.
+func (c RuntimeConfig) wazeroConfig() wazero.RuntimeConfig {
+	var config wazero.RuntimeConfig
+	switch c.Engine {
+	case EngineCompiler:
+		config = wazero.NewRuntimeConfigCompiler()
+	case EngineInterpreter:
+		config = wazero.NewRuntimeConfigInterpreter()
+	default:
+		config = wazero.NewRuntimeConfig()
+	}
+	config = config.WithCloseOnContextDone(true)
+	if pages := c.memoryLimitPages(); pages > 0 {
+		config = config.WithMemoryLimitPages(pages)
+	}
+
+	return config
+}
+
+// memoryLimitPages returns the memory limit in WASM pages, or 0 without a limit.
+func (c RuntimeConfig) memoryLimitPages() uint32 {
+	return uint32(c.MemoryLimitMB) * (1 << 20 / wasmPageSize)
+}
+
+// limitError returns ErrExecTimeout or ErrMemoryLimit when the failed execution of inst
+// exceeded a limit of c, wrapping err, or nil otherwise.
+func (c RuntimeConfig) limitError(ctx context.Context, inst *PluginInstance, err error) error {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w after %s: %w", ErrExecTimeout, c.ExecTimeout, err)
+	}
+	// A plugin failing to grow its memory aborts, so a failure at the limit is blamed on it.
+	if limit := uint64(c.memoryLimitPages()) * wasmPageSize; limit > 0 && inst.Module != nil &&
+		inst.Module.Memory() != nil && uint64(inst.Module.Memory().Size())+wasmPageSize > limit {
+		return fmt.Errorf("%w of %d MB: %w", ErrMemoryLimit, c.MemoryLimitMB, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,170 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Execute bodies of the test plugin modules.
+var (
+	// execLoop spins forever.
+	execLoop = []byte{0x03, 0x40, 0x0c, 0x00, 0x0b, 0x00}
+	// execGrow grows memory by a page until it fails, then traps as an out of memory guest
+	// aborts.
+	execGrow = []byte{0x03, 0x40, 0x41, 0x01, 0x40, 0x00, 0x41, 0x7f, 0x47, 0x0d, 0x00, 0x0b, 0x00}
+	// execOK returns an empty response.
+	execOK = []byte{0x41, 0x00, 0x41, 0x00, 0x41, 0x00}
+)
+
+// pluginModule returns an ABI v2 plugin module whose Execute runs body, with one page of
+// memory and no memory maximum.
+func pluginModule(body []byte) []byte {
+	leb := func(n int) []byte {
+		var out []byte
+		for {
+			b := byte(n & 0x7f)
+			n >>= 7
+			if n == 0 {
+				return append(out, b)
+			}
+			out = append(out, b|0x80)
+		}
+	}
+	section := func(id byte, items ...[]byte) []byte {
+		content := leb(len(items))
+		for _, item := range items {
+			content = append(content, item...)
+		}
+
+		return append(append([]byte{id}, leb(len(content))...), content...)
+	}
+	export := func(name string, kind, idx byte) []byte {
+		return append(append(leb(len(name)), name...), kind, idx)
+	}
+	code := func(instrs []byte) []byte {
+		fn := append([]byte{0x00}, instrs...)
+		fn = append(fn, 0x0b)
+
+		return append(leb(len(fn)), fn...)
+	}
+	const i32 = 0x7f
+
+	m := []byte{0x00, 'a', 's', 'm', 1, 0, 0, 0}
+	m = append(m, section(1,
+		[]byte{0x60, 1, i32, 1, i32},
+		[]byte{0x60, 2, i32, i32, 3, i32, i32, i32},
+		[]byte{0x60, 0, 2, i32, i32},
+	)...)
+	m = append(m, section(3, []byte{0}, []byte{1}, []byte{2}, []byte{2}, []byte{2})...)
+	m = append(m, section(5, []byte{0x00, 0x01})...)
+	m = append(m, section(7,
+		export("Alloc", 0, 0),
+		export("Execute", 0, 1),
+		export("version", 0, 2),
+		export("description", 0, 3),
+		export("author", 0, 4),
+		export("memory", 2, 0),
+	)...)
+	metadata := []byte{0x41, 0x00, 0x41, 0x00}
+
+	return append(m, section(10,
+		code([]byte{0x41, 0x10}),
+		code(body),
+		code(metadata), code(metadata), code(metadata),
+	)...)
+}
+
+// loadPlugin returns a plugin manager running the module with Execute body as command ZZ.
+func loadPlugin(t *testing.T, config RuntimeConfig, body []byte) *PluginManager {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "ZZ.wasm"), pluginModule(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	pm := NewPluginManager(context.Background(), nil)
+	t.Cleanup(func() { _ = pm.Close() })
+	if err := pm.SetRuntimeConfig(config); err != nil {
+		t.Fatalf("SetRuntimeConfig() error = %v", err)
+	}
+	if err := pm.LoadAll(dir); err != nil {
+		t.Fatalf("LoadAll() error = %v", err)
+	}
+	if len(pm.ListPlugins()) != 1 {
+		t.Fatalf("ListPlugins() = %v, want the test plugin", pm.ListPlugins())
+	}
+
+	return pm
+}
+
+func TestRuntimeLimits(t *testing.T) {
+	t.Parallel()
+
+	for _, engine := range []string{EngineCompiler, EngineInterpreter} {
+		t.Run(engine, func(t *testing.T) {
+			t.Parallel()
+
+			pm := loadPlugin(t, RuntimeConfig{Engine: engine, ExecTimeout: 50 * time.Millisecond}, execLoop)
+			start := time.Now()
+			_, err := pm.ExecuteCommand("ZZ", []byte("1"))
+			if !errors.Is(err, ErrExecTimeout) {
+				t.Fatalf("ExecuteCommand() of a looping plugin error = %v, want ErrExecTimeout", err)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("looping plugin interrupted after %s", elapsed)
+			}
+			if code, ok := pm.LimitErrorCode(err); !ok || code != DefaultTimeoutErrorCode {
+				t.Errorf("LimitErrorCode() = %q, %v", code, ok)
+			}
+			if stats := pm.plugins["ZZ"].Stats(); stats.Dropped != 1 {
+				t.Errorf("interrupted instance not discarded: %+v", stats)
+			}
+
+			pm = loadPlugin(t, RuntimeConfig{Engine: engine, MemoryLimitMB: 1, MemoryErrorCode: "AB"}, execGrow)
+			_, err = pm.ExecuteCommand("ZZ", []byte("1"))
+			if !errors.Is(err, ErrMemoryLimit) {
+				t.Fatalf("ExecuteCommand() of a growing plugin error = %v, want ErrMemoryLimit", err)
+			}
+			if code, ok := pm.LimitErrorCode(err); !ok || code != "AB" {
+				t.Errorf("LimitErrorCode() = %q, %v", code, ok)
+			}
+
+			pm = loadPlugin(t, RuntimeConfig{Engine: engine, MemoryLimitMB: 1}, execOK)
+			if _, err := pm.ExecuteCommand("ZZ", []byte("1")); err != nil {
+				t.Errorf("ExecuteCommand() within the limits error = %v", err)
+			}
+		})
+	}
+}
+
+func TestRuntimeConfigValidation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		config  RuntimeConfig
+		wantErr bool
+	}{
+		{name: "defaults", config: RuntimeConfig{}},
+		{name: "interpreter", config: RuntimeConfig{Engine: EngineInterpreter, MemoryLimitMB: 64}},
+		{name: "unknown engine", config: RuntimeConfig{Engine: "jit"}, wantErr: true},
+		{name: "memory limit above 4 GiB", config: RuntimeConfig{MemoryLimitMB: 8 << 10}, wantErr: true},
+		{name: "negative timeout", config: RuntimeConfig{ExecTimeout: -time.Second}, wantErr: true},
+		{name: "bad error code", config: RuntimeConfig{TimeoutErrorCode: "4"}, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := tc.config.withDefaults()
+			if (err != nil) != tc.wantErr {
+				t.Errorf("withDefaults() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
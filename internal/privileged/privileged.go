@@ -0,0 +1,97 @@
+// Package privileged provides what the insecure test features and the authorized state have
+// in common: a gate that enables a feature for a single invocation or until a configured
+// deadline, and an audit writer recording every use in the audit log.
+package privileged
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/andrei-cloud/go_hsm/internal/audit"
+	"github.com/rs/zerolog"
+)
+
+// Deadline gates a feature enabled by flag for the current invocation, or until an RFC 3339
+// deadline lying at most Max ahead, so the feature cannot be left enabled indefinitely.
+type Deadline struct {
+	// Setting names the deadline setting in errors.
+	Setting string
+	// Max bounds how far ahead the deadline may lie.
+	Max time.Duration
+	// ErrDisabled, ErrExpired and ErrWindowTooLong are returned when the feature is not
+	// enabled, when the deadline has passed and when it lies beyond Max.
+	ErrDisabled      error
+	ErrExpired       error
+	ErrWindowTooLong error
+}
+
+// Check returns nil when the feature is enabled at now by flag or by the deadline until.
+func (d Deadline) Check(flag bool, until string, now time.Time) error {
+	if flag {
+		return nil
+	}
+	if until == "" {
+		return d.ErrDisabled
+	}
+
+	deadline, err := time.Parse(time.RFC3339, until)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", d.Setting, err)
+	}
+	if !now.Before(deadline) {
+		return fmt.Errorf("%w at %s", d.ErrExpired, deadline.Format(time.RFC3339))
+	}
+	if deadline.Sub(now) > d.Max {
+		return fmt.Errorf("%w: deadline %s", d.ErrWindowTooLong, deadline.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// AuditWriter records every use of a privileged feature in the hash-chained audit log and
+// echoes the record to stderr for the operator. Clear values are never recorded; callers
+// pass identifying data such as key check values only.
+type AuditWriter struct {
+	logger zerolog.Logger
+	path   string
+}
+
+// NewAuditWriter echoes audit records to stderr and appends them to the audit log at path.
+// An empty path disables the audit log.
+func NewAuditWriter(stderr io.Writer, path string) *AuditWriter {
+	return &AuditWriter{
+		logger: zerolog.New(stderr).With().Timestamp().Logger(),
+		path:   path,
+	}
+}
+
+// Write appends event with fields to the audit log and then echoes it to stderr with msg at
+// level, along with the user and process recording it.
+func (w *AuditWriter) Write(level zerolog.Level, event string, fields map[string]string, msg string) error {
+	if err := audit.Append(w.path, event, fields); err != nil {
+		return err
+	}
+
+	echo := w.logger.WithLevel(level).
+		Bool("audit", true).
+		Str("event", event).
+		Str("user", currentUser()).
+		Int("pid", os.Getpid())
+	for k, v := range fields {
+		echo = echo.Str(k, v)
+	}
+	echo.Msg(msg)
+
+	return nil
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+
+	return "unknown"
+}
@@ -0,0 +1,77 @@
+package privileged
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestDeadlineCheck(t *testing.T) {
+	t.Parallel()
+
+	errDisabled := errors.New("disabled")
+	d := Deadline{
+		Setting:          "feature.until",
+		Max:              time.Hour,
+		ErrDisabled:      errDisabled,
+		ErrExpired:       errors.New("expired"),
+		ErrWindowTooLong: errors.New("too long"),
+	}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	if err := d.Check(false, "", now); !errors.Is(err, errDisabled) {
+		t.Errorf("Check() = %v, want %v", err, errDisabled)
+	}
+	if err := d.Check(true, "", now); err != nil {
+		t.Errorf("Check() with flag = %v", err)
+	}
+	if err := d.Check(false, "2024-05-01T12:30:00Z", now); err != nil {
+		t.Errorf("Check() within window = %v", err)
+	}
+	if err := d.Check(false, "2024-05-01T14:00:00Z", now); !errors.Is(err, d.ErrWindowTooLong) {
+		t.Errorf("Check() = %v, want %v", err, d.ErrWindowTooLong)
+	}
+	if err := d.Check(false, "noon", now); err == nil || !strings.Contains(err.Error(), "feature.until") {
+		t.Errorf("Check() = %v, want an error naming the setting", err)
+	}
+}
+
+func TestAuditWriter(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	var stderr bytes.Buffer
+	w := NewAuditWriter(&stderr, path)
+	if err := w.Write(zerolog.InfoLevel, "rotate", map[string]string{"kcv": "9A1D1C"}, "rotated"); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	out := stderr.String()
+	for _, want := range []string{`"audit":true`, `"event":"rotate"`, `"kcv":"9A1D1C"`, `"user":`, `"pid":`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("echoed audit record %s lacks %s", out, want)
+		}
+	}
+	logged, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read audit log: %v", err)
+	}
+	if !strings.Contains(string(logged), `"event":"rotate"`) {
+		t.Errorf("audit log = %s", logged)
+	}
+
+	// A record that cannot be appended to the audit log is not echoed either.
+	stderr.Reset()
+	if err := NewAuditWriter(&stderr, t.TempDir()).Write(zerolog.InfoLevel, "rotate", nil, "rotated"); err == nil {
+		t.Error("Write() to a directory succeeded")
+	}
+	if stderr.Len() != 0 {
+		t.Errorf("failed record echoed: %s", stderr.String())
+	}
+}
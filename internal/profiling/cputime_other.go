@@ -0,0 +1,11 @@
+//go:build !unix
+
+package profiling
+
+import "time"
+
+// cpuTime returns 0: the CPU time of the process is only measured on Unix, so profiles
+// report no CPU time elsewhere.
+func cpuTime() time.Duration {
+	return 0
+}
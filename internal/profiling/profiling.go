@@ -0,0 +1,176 @@
+// Package profiling records per-command execution profiles of the server: wall time split
+// into WASM execution, host function calls and host-side overhead, with CPU time and heap
+// allocations, so latency can be attributed between plugin code and host crypto. Reports
+// are written as CSV or as a pprof profile.
+package profiling
+
+import (
+	"cmp"
+	"context"
+	"runtime/metrics"
+	"slices"
+	"sync"
+	"time"
+)
+
+// allocsMetric counts the heap objects allocated by the process.
+const allocsMetric = "/gc/heap/allocs:objects"
+
+// Stats aggregates the profile of one command code.
+type Stats struct {
+	// Command is the two-character command code.
+	Command string
+	// Count is the number of profiled requests.
+	Count int64
+	// Total is the wall time from the start of processing to the response.
+	Total time.Duration
+	// WASM is the time spent executing plugin code, excluding host function calls.
+	WASM time.Duration
+	// HostCalls is the time spent in host functions called by plugins, such as LMK
+	// encryption and random key generation.
+	HostCalls time.Duration
+	// Overhead is the host-side remainder: framing, buffer copies, logging and scheduling.
+	Overhead time.Duration
+	// CPU is the user and system CPU time of the process while requests were processed.
+	CPU time.Duration
+	// Allocs is the number of heap objects allocated while requests were processed.
+	Allocs uint64
+}
+
+// Profiler aggregates samples by command code. CPU time and allocations are process-wide
+// counters, so they are exact only while requests are processed one at a time; under
+// concurrent load they include the work of overlapping requests.
+type Profiler struct {
+	mu    sync.Mutex
+	stats map[string]*Stats
+	start time.Time
+}
+
+// New returns an empty profiler.
+func New() *Profiler {
+	return &Profiler{stats: make(map[string]*Stats), start: time.Now()}
+}
+
+// Sample is the profile of a single request in progress.
+type Sample struct {
+	p       *Profiler
+	command string
+	start   time.Time
+	cpu     time.Duration
+	allocs  uint64
+
+	mu        sync.Mutex
+	execute   time.Duration
+	hostCalls time.Duration
+}
+
+// Start begins a sample for command. A nil profiler returns a nil sample, whose methods do
+// nothing, so callers need no checks when profiling is disabled.
+func (p *Profiler) Start(command string) *Sample {
+	if p == nil {
+		return nil
+	}
+
+	return &Sample{p: p, command: command, start: time.Now(), cpu: cpuTime(), allocs: heapAllocs()}
+}
+
+// Executed records the wall time of a plugin Execute call, host function calls included.
+func (s *Sample) Executed(d time.Duration) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.execute += d
+	s.mu.Unlock()
+}
+
+// Finish ends the sample and adds it to the profile of its command.
+func (s *Sample) Finish() {
+	if s == nil {
+		return
+	}
+	total := time.Since(s.start)
+	cpu := cpuTime() - s.cpu
+	allocs := heapAllocs() - s.allocs
+
+	s.mu.Lock()
+	execute, hostCalls := s.execute, s.hostCalls
+	s.mu.Unlock()
+
+	s.p.mu.Lock()
+	defer s.p.mu.Unlock()
+
+	st, ok := s.p.stats[s.command]
+	if !ok {
+		st = &Stats{Command: s.command}
+		s.p.stats[s.command] = st
+	}
+	st.Count++
+	st.Total += total
+	st.WASM += max(execute-hostCalls, 0)
+	st.HostCalls += hostCalls
+	st.Overhead += max(total-execute, 0)
+	st.CPU += cpu
+	st.Allocs += allocs
+}
+
+// Snapshot returns the aggregated profiles sorted by command code.
+func (p *Profiler) Snapshot() []Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	out := make([]Stats, 0, len(p.stats))
+	for _, st := range p.stats {
+		out = append(out, *st)
+	}
+	slices.SortFunc(out, func(a, b Stats) int { return cmp.Compare(a.Command, b.Command) })
+
+	return out
+}
+
+// sampleKey is the context key of the sample of the request being processed.
+type sampleKey struct{}
+
+// WithSample returns a context carrying s for the plugin manager and host functions.
+func WithSample(ctx context.Context, s *Sample) context.Context {
+	if s == nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, sampleKey{}, s)
+}
+
+// FromContext returns the sample carried by ctx, or nil.
+func FromContext(ctx context.Context) *Sample {
+	s, _ := ctx.Value(sampleKey{}).(*Sample)
+
+	return s
+}
+
+// HostCall starts timing a host function call for the sample carried by ctx and returns
+// the function that ends it: defer profiling.HostCall(ctx)().
+func HostCall(ctx context.Context) func() {
+	s := FromContext(ctx)
+	if s == nil {
+		return func() {}
+	}
+	start := time.Now()
+
+	return func() {
+		d := time.Since(start)
+		s.mu.Lock()
+		s.hostCalls += d
+		s.mu.Unlock()
+	}
+}
+
+// heapAllocs returns the cumulative number of heap objects allocated by the process.
+func heapAllocs() uint64 {
+	sample := []metrics.Sample{{Name: allocsMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+
+	return sample[0].Value.Uint64()
+}
@@ -0,0 +1,107 @@
+package profiling
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestProfiler(t *testing.T) {
+	t.Parallel()
+
+	p := New()
+	for range 2 {
+		s := p.Start("DC")
+		ctx := WithSample(context.Background(), s)
+		end := HostCall(ctx)
+		time.Sleep(2 * time.Millisecond)
+		end()
+		s.Executed(5 * time.Millisecond)
+		s.Finish()
+	}
+	p.Start("CA").Finish()
+
+	stats := p.Snapshot()
+	if len(stats) != 2 || stats[0].Command != "CA" || stats[1].Command != "DC" {
+		t.Fatalf("Snapshot() = %+v", stats)
+	}
+	dc := stats[1]
+	if dc.Count != 2 || dc.HostCalls < 4*time.Millisecond {
+		t.Errorf("DC stats = %+v", dc)
+	}
+	if dc.WASM+dc.HostCalls != 10*time.Millisecond {
+		t.Errorf("WASM %v + host calls %v, want the 10ms of Execute", dc.WASM, dc.HostCalls)
+	}
+
+	// Disabled profiling is a no-op.
+	var disabled *Profiler
+	s := disabled.Start("DC")
+	s.Executed(time.Second)
+	s.Finish()
+	if FromContext(WithSample(context.Background(), s)) != nil {
+		t.Error("nil sample stored in context")
+	}
+	HostCall(context.Background())()
+}
+
+func TestWriteCSV(t *testing.T) {
+	t.Parallel()
+
+	p := New()
+	s := p.Start("NC")
+	s.Executed(time.Millisecond)
+	s.Finish()
+
+	var buf bytes.Buffer
+	if err := p.WriteCSV(&buf); err != nil {
+		t.Fatalf("WriteCSV failed: %v", err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil || len(rows) != 2 {
+		t.Fatalf("CSV = %q, %v", rows, err)
+	}
+	if rows[0][0] != "command" || rows[1][0] != "NC" || rows[1][1] != "1" || rows[1][3] != "1000" {
+		t.Errorf("CSV rows = %q", rows)
+	}
+}
+
+func TestWritePprof(t *testing.T) {
+	t.Parallel()
+
+	p := New()
+	s := p.Start("KQ")
+	s.Executed(time.Millisecond)
+	s.Finish()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "profile.pb.gz")
+	if FormatForPath(path) != FormatPprof || FormatForPath("a.CSV") != FormatCSV {
+		t.Fatal("FormatForPath selected the wrong format")
+	}
+	if err := p.WriteFile(path); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("profile is not gzipped: %v", err)
+	}
+	raw, _ := io.ReadAll(zr)
+	for _, want := range []string{"go_hsm", "KQ wasm", "KQ host overhead", "wall", "nanoseconds"} {
+		if !bytes.Contains(raw, []byte(want)) {
+			t.Errorf("profile does not contain %q", want)
+		}
+	}
+
+}
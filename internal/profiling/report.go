@@ -0,0 +1,237 @@
+package profiling
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Report formats.
+const (
+	FormatCSV   = "csv"
+	FormatPprof = "pprof"
+)
+
+// FormatForPath selects the report format from a file name: CSV for a .csv extension and
+// pprof otherwise.
+func FormatForPath(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return FormatCSV
+	}
+
+	return FormatPprof
+}
+
+// WriteFile writes the report to path in the format selected by its extension.
+func (p *Profiler) WriteFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create profile report: %w", err)
+	}
+	if FormatForPath(path) == FormatCSV {
+		err = p.WriteCSV(f)
+	} else {
+		err = p.WritePprof(f)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// WriteCSV writes one row per command with durations in microseconds.
+func (p *Profiler) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{
+		"command", "count", "total_us", "wasm_us", "host_calls_us", "overhead_us",
+		"cpu_us", "allocs", "avg_total_us",
+	})
+	us := func(d time.Duration) string { return strconv.FormatInt(d.Microseconds(), 10) }
+	for _, st := range p.Snapshot() {
+		_ = cw.Write([]string{
+			st.Command,
+			strconv.FormatInt(st.Count, 10),
+			us(st.Total),
+			us(st.WASM),
+			us(st.HostCalls),
+			us(st.Overhead),
+			us(st.CPU),
+			strconv.FormatUint(st.Allocs, 10),
+			us(st.Total / time.Duration(max(st.Count, 1))),
+		})
+	}
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// WritePprof writes a gzipped pprof profile. Each command is a frame under "go_hsm" with
+// child frames for WASM execution, host function calls and host overhead, so `go tool
+// pprof -sample_index=wall` attributes latency between plugin code and the host. The command
+// frame itself carries the request count, CPU time and allocations.
+func (p *Profiler) WritePprof(w io.Writer) error {
+	b := newProfileBuilder()
+	b.sampleType("requests", "count")
+	b.sampleType("wall", "nanoseconds")
+	b.sampleType("cpu", "nanoseconds")
+	b.sampleType("alloc_objects", "count")
+
+	root := b.location("go_hsm")
+	for _, st := range p.Snapshot() {
+		cmd := b.location(st.Command)
+		b.sample([]uint64{cmd, root}, st.Count, 0, int64(st.CPU), int64(st.Allocs))
+		for _, part := range []struct {
+			name string
+			d    time.Duration
+		}{
+			{"wasm", st.WASM},
+			{"host calls", st.HostCalls},
+			{"host overhead", st.Overhead},
+		} {
+			leaf := b.location(st.Command + " " + part.name)
+			b.sample([]uint64{leaf, cmd, root}, 0, int64(part.d), 0, 0)
+		}
+	}
+	b.field(fieldDurationNanos, uint64(time.Since(p.start)))
+	b.field(fieldTimeNanos, uint64(p.start.UnixNano()))
+
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(b.bytes()); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// Field numbers of the pprof profile.proto messages used by profileBuilder.
+const (
+	fieldSampleType    = 1
+	fieldSample        = 2
+	fieldLocation      = 4
+	fieldFunction      = 5
+	fieldStringTable   = 6
+	fieldTimeNanos     = 9
+	fieldDurationNanos = 10
+)
+
+// profileBuilder encodes a minimal pprof profile: sample types, samples, and one location
+// and function per frame name.
+type profileBuilder struct {
+	buf       []byte
+	strings   []string
+	stringIDs map[string]int64
+	locations map[string]uint64
+}
+
+func newProfileBuilder() *profileBuilder {
+	return &profileBuilder{
+		strings:   []string{""},
+		stringIDs: map[string]int64{"": 0},
+		locations: make(map[string]uint64),
+	}
+}
+
+// str returns the string table index of s.
+func (b *profileBuilder) str(s string) int64 {
+	if id, ok := b.stringIDs[s]; ok {
+		return id
+	}
+	id := int64(len(b.strings))
+	b.strings = append(b.strings, s)
+	b.stringIDs[s] = id
+
+	return id
+}
+
+// sampleType adds a ValueType to the sample types.
+func (b *profileBuilder) sampleType(typ, unit string) {
+	var m []byte
+	m = appendField(m, 1, uint64(b.str(typ)))
+	m = appendField(m, 2, uint64(b.str(unit)))
+	b.buf = appendBytes(b.buf, fieldSampleType, m)
+}
+
+// location returns the ID of the location of a frame, adding it and its function first.
+func (b *profileBuilder) location(name string) uint64 {
+	if id, ok := b.locations[name]; ok {
+		return id
+	}
+	id := uint64(len(b.locations) + 1)
+	b.locations[name] = id
+
+	var fn []byte
+	fn = appendField(fn, 1, id)
+	fn = appendField(fn, 2, uint64(b.str(name)))
+	fn = appendField(fn, 3, uint64(b.str(name)))
+	b.buf = appendBytes(b.buf, fieldFunction, fn)
+
+	var line []byte
+	line = appendField(line, 1, id)
+	var loc []byte
+	loc = appendField(loc, 1, id)
+	loc = appendBytes(loc, 4, line)
+	b.buf = appendBytes(b.buf, fieldLocation, loc)
+
+	return id
+}
+
+// sample adds a sample with the stack given leaf first.
+func (b *profileBuilder) sample(stack []uint64, values ...int64) {
+	var ids, vals, m []byte
+	for _, id := range stack {
+		ids = appendVarint(ids, id)
+	}
+	for _, v := range values {
+		vals = appendVarint(vals, uint64(v))
+	}
+	m = appendBytes(m, 1, ids)
+	m = appendBytes(m, 2, vals)
+	b.buf = appendBytes(b.buf, fieldSample, m)
+}
+
+// field adds a varint field to the profile.
+func (b *profileBuilder) field(num int, v uint64) {
+	b.buf = appendField(b.buf, num, v)
+}
+
+// bytes returns the encoded profile, string table included.
+func (b *profileBuilder) bytes() []byte {
+	out := b.buf
+	for _, s := range b.strings {
+		out = appendBytes(out, fieldStringTable, []byte(s))
+	}
+
+	return out
+}
+
+// appendField appends a varint field.
+func appendField(dst []byte, num int, v uint64) []byte {
+	dst = appendVarint(dst, uint64(num)<<3)
+
+	return appendVarint(dst, v)
+}
+
+// appendBytes appends a length-delimited field.
+func appendBytes(dst []byte, num int, data []byte) []byte {
+	dst = appendVarint(dst, uint64(num)<<3|2)
+	dst = appendVarint(dst, uint64(len(data)))
+
+	return append(dst, data...)
+}
+
+// appendVarint appends a protobuf base 128 varint.
+func appendVarint(dst []byte, v uint64) []byte {
+	for v >= 0x80 {
+		dst = append(dst, byte(v)|0x80)
+		v >>= 7
+	}
+
+	return append(dst, byte(v))
+}
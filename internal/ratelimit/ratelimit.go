@@ -0,0 +1,204 @@
+// Package ratelimit limits the commands of each client of the server, so a runaway test
+// client cannot starve the other users of a shared simulator. A client, identified by its IP
+// address, is refused commands above its command rate and beyond its number of commands in
+// flight, and the refusals are counted for monitoring.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultErrorCode answers refused commands when no error code is configured. Thales HSMs
+// have no rate limits, so the simulator reuses 16 (console or printer not ready), which host
+// applications treat as a transient condition.
+const DefaultErrorCode = "16"
+
+// Refusal reasons returned by Acquire.
+const (
+	ReasonRate     = "rate"
+	ReasonInFlight = "in_flight"
+)
+
+// sweepInterval is how often idle clients are forgotten.
+const sweepInterval = time.Minute
+
+// Limits configures the limits applied to every client.
+type Limits struct {
+	// Rate is the sustained number of commands per second of a client; 0 disables it.
+	Rate float64 `mapstructure:"rate"`
+	// Burst is the number of commands a client may send at once above Rate; 0 selects the
+	// rate rounded up.
+	Burst int `mapstructure:"burst"`
+	// MaxInFlight is the number of commands of a client processed at the same time; 0
+	// disables it.
+	MaxInFlight int `mapstructure:"max_in_flight"`
+	// ErrorCode answers refused commands; empty selects DefaultErrorCode.
+	ErrorCode string `mapstructure:"error_code"`
+}
+
+// Stats counts the commands seen by a limiter.
+type Stats struct {
+	// Allowed is the number of commands accepted.
+	Allowed uint64
+	// RateLimited is the number of commands refused above the rate of their client.
+	RateLimited uint64
+	// InFlightLimited is the number of commands refused beyond the commands in flight of
+	// their client.
+	InFlightLimited uint64
+	// Clients is the number of clients currently tracked.
+	Clients int
+}
+
+// client is the state of one client: a token bucket and the commands in flight.
+type client struct {
+	tokens   float64
+	last     time.Time
+	inFlight int
+}
+
+// Limiter applies limits per client.
+type Limiter struct {
+	limits Limits
+	now    func() time.Time
+
+	mu        sync.Mutex
+	clients   map[string]*client
+	lastSweep time.Time
+
+	allowed         atomic.Uint64
+	rateLimited     atomic.Uint64
+	inFlightLimited atomic.Uint64
+}
+
+// New validates limits and returns a limiter applying them.
+func New(limits Limits) (*Limiter, error) {
+	if limits.ErrorCode == "" {
+		limits.ErrorCode = DefaultErrorCode
+	}
+	if len(limits.ErrorCode) != 2 {
+		return nil, fmt.Errorf("rate limit error code %q must be two characters", limits.ErrorCode)
+	}
+	if limits.Rate < 0 || limits.Burst < 0 || limits.MaxInFlight < 0 {
+		return nil, fmt.Errorf("rate limits must not be negative")
+	}
+	if limits.Rate == 0 && limits.MaxInFlight == 0 {
+		return nil, fmt.Errorf("rate limits need a rate or a maximum of commands in flight")
+	}
+	if limits.Burst == 0 {
+		limits.Burst = int(math.Ceil(limits.Rate))
+	}
+
+	return &Limiter{limits: limits, now: time.Now, clients: make(map[string]*client)}, nil
+}
+
+// ErrorCode returns the error code answering refused commands.
+func (l *Limiter) ErrorCode() string {
+	return l.limits.ErrorCode
+}
+
+// Acquire admits a command from the client address addr. It returns the function releasing
+// the command once processed, or the reason the command is refused. A nil limiter admits
+// every command.
+func (l *Limiter) Acquire(addr string) (release func(), reason string) {
+	if l == nil {
+		return func() {}, ""
+	}
+	key := clientKey(addr)
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+	c, ok := l.clients[key]
+	if !ok {
+		c = &client{tokens: float64(l.limits.Burst), last: now}
+		l.clients[key] = c
+	}
+	if l.limits.MaxInFlight > 0 && c.inFlight >= l.limits.MaxInFlight {
+		l.inFlightLimited.Add(1)
+
+		return nil, ReasonInFlight
+	}
+	if l.limits.Rate > 0 {
+		c.refill(now, l.limits)
+		if c.tokens < 1 {
+			l.rateLimited.Add(1)
+
+			return nil, ReasonRate
+		}
+		c.tokens--
+	}
+	c.inFlight++
+	l.allowed.Add(1)
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			c.inFlight--
+		})
+	}, ""
+}
+
+// Stats returns the counters of the limiter.
+func (l *Limiter) Stats() Stats {
+	if l == nil {
+		return Stats{}
+	}
+	l.mu.Lock()
+	clients := len(l.clients)
+	l.mu.Unlock()
+
+	return Stats{
+		Allowed:         l.allowed.Load(),
+		RateLimited:     l.rateLimited.Load(),
+		InFlightLimited: l.inFlightLimited.Load(),
+		Clients:         clients,
+	}
+}
+
+// refill adds the tokens earned by c since its last command.
+func (c *client) refill(now time.Time, limits Limits) {
+	if elapsed := now.Sub(c.last).Seconds(); elapsed > 0 {
+		c.tokens = math.Min(float64(limits.Burst), c.tokens+elapsed*limits.Rate)
+	}
+	c.last = now
+}
+
+// sweep forgets the clients with no command in flight and a full bucket, which are the same
+// as new clients. It must be called with l.mu held.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, c := range l.clients {
+		if c.inFlight > 0 {
+			continue
+		}
+		if l.limits.Rate > 0 {
+			c.refill(now, l.limits)
+			if c.tokens < float64(l.limits.Burst) {
+				continue
+			}
+		}
+		delete(l.clients, key)
+	}
+}
+
+// clientKey returns the IP address of addr, or addr when it has no port.
+func clientKey(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+
+	return addr
+}
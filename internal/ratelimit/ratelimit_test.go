@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewValidation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		limits  Limits
+		wantErr bool
+	}{
+		{name: "rate", limits: Limits{Rate: 10}},
+		{name: "in flight", limits: Limits{MaxInFlight: 2, ErrorCode: "17"}},
+		{name: "no limits", limits: Limits{}, wantErr: true},
+		{name: "negative rate", limits: Limits{Rate: -1, MaxInFlight: 1}, wantErr: true},
+		{name: "bad error code", limits: Limits{Rate: 1, ErrorCode: "1"}, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := New(tc.limits)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestRate(t *testing.T) {
+	t.Parallel()
+
+	l, err := New(Limits{Rate: 2, Burst: 2})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+
+	for i := range 2 {
+		release, reason := l.Acquire("10.0.0.1:4000")
+		if reason != "" {
+			t.Fatalf("command %d refused: %s", i, reason)
+		}
+		release()
+	}
+	if _, reason := l.Acquire("10.0.0.1:4001"); reason != ReasonRate {
+		t.Errorf("command above the burst reason = %q, want %q", reason, ReasonRate)
+	}
+	if _, reason := l.Acquire("10.0.0.2:4000"); reason != "" {
+		t.Errorf("command of another client refused: %s", reason)
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if _, reason := l.Acquire("10.0.0.1:4000"); reason != "" {
+		t.Errorf("command after the refill refused: %s", reason)
+	}
+
+	if got := l.Stats(); got.Allowed != 4 || got.RateLimited != 1 || got.Clients != 2 {
+		t.Errorf("Stats() = %+v", got)
+	}
+}
+
+func TestInFlight(t *testing.T) {
+	t.Parallel()
+
+	l, err := New(Limits{MaxInFlight: 1})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	release, reason := l.Acquire("10.0.0.1:4000")
+	if reason != "" {
+		t.Fatalf("first command refused: %s", reason)
+	}
+	if _, reason := l.Acquire("10.0.0.1:4001"); reason != ReasonInFlight {
+		t.Errorf("second command reason = %q, want %q", reason, ReasonInFlight)
+	}
+	release()
+	release()
+	if _, reason := l.Acquire("10.0.0.1:4001"); reason != "" {
+		t.Errorf("command after release refused: %s", reason)
+	}
+	if got := l.Stats(); got.InFlightLimited != 1 {
+		t.Errorf("Stats().InFlightLimited = %d, want 1", got.InFlightLimited)
+	}
+
+	var nilLimiter *Limiter
+	if _, reason := nilLimiter.Acquire("10.0.0.1:4000"); reason != "" {
+		t.Errorf("nil limiter refused a command: %s", reason)
+	}
+}
@@ -0,0 +1,129 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Runner runs an external command and returns its standard output. Hardware sources use it
+// to drive the vendor tools; tests replace it.
+type Runner func(ctx context.Context, name string, args ...string) ([]byte, error)
+
+// execRunner runs the command with os/exec and reports its standard error on failure.
+func execRunner(ctx context.Context, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %w: %s", name, err, msg)
+		}
+
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return out, nil
+}
+
+// runnerOr returns r, or execRunner when r is nil.
+func runnerOr(r Runner) Runner {
+	if r != nil {
+		return r
+	}
+
+	return execRunner
+}
+
+// TPMSource unseals secrets from a TPM 2.0 with tpm2_unseal from tpm2-tools, so the LMK is
+// bound to the machine and only exists unsealed in memory. A reference is the sealed object:
+// a persistent handle such as "0x81010001" or a context file. The TPM is selected by the
+// TPM2TOOLS_TCTI variable of tpm2-tools.
+type TPMSource struct {
+	// Auth is the authorization of the sealed object in tpm2-tools syntax, e.g.
+	// "pcr:sha256:0,7" for a PCR policy; empty when the object has no authorization.
+	Auth string
+	Run  Runner
+}
+
+// NewTPMSourceFromEnv configures a TPMSource from GO_HSM_TPM_AUTH.
+func NewTPMSourceFromEnv() (*TPMSource, error) {
+	return &TPMSource{Auth: os.Getenv("GO_HSM_TPM_AUTH")}, nil
+}
+
+// Fetch implements SecretSource.
+func (s *TPMSource) Fetch(ctx context.Context, ref string) ([]byte, error) {
+	if ref == "" {
+		return nil, errors.New("tpm: reference must name the sealed object")
+	}
+
+	args := []string{"--object-context", ref}
+	if s.Auth != "" {
+		args = append(args, "--auth", s.Auth)
+	}
+	out, err := runnerOr(s.Run)(ctx, "tpm2_unseal", args...)
+	if err != nil {
+		return nil, fmt.Errorf("tpm: %w", err)
+	}
+
+	return out, nil
+}
+
+// PKCS11Source reads secrets stored as private data objects in a PKCS#11 token with
+// pkcs11-tool from OpenSC. A reference is the object label. The token user PIN is passed to
+// pkcs11-tool through the environment, never on the command line.
+type PKCS11Source struct {
+	// Module is the path of the PKCS#11 library of the token.
+	Module string
+	// Token is the token label; empty selects the first token with a slot.
+	Token string
+	// PINEnv names the environment variable holding the user PIN.
+	PINEnv string
+	Run    Runner
+}
+
+// pkcs11PINEnv holds the token user PIN of a PKCS11Source created from the environment.
+const pkcs11PINEnv = "GO_HSM_PKCS11_PIN"
+
+// NewPKCS11SourceFromEnv configures a PKCS11Source from GO_HSM_PKCS11_MODULE,
+// GO_HSM_PKCS11_TOKEN and GO_HSM_PKCS11_PIN.
+func NewPKCS11SourceFromEnv() (*PKCS11Source, error) {
+	src := &PKCS11Source{
+		Module: os.Getenv("GO_HSM_PKCS11_MODULE"),
+		Token:  os.Getenv("GO_HSM_PKCS11_TOKEN"),
+		PINEnv: pkcs11PINEnv,
+	}
+	if src.Module == "" || os.Getenv(pkcs11PINEnv) == "" {
+		return nil, errors.New("pkcs11: GO_HSM_PKCS11_MODULE and GO_HSM_PKCS11_PIN must be set")
+	}
+
+	return src, nil
+}
+
+// Fetch implements SecretSource.
+func (s *PKCS11Source) Fetch(ctx context.Context, ref string) ([]byte, error) {
+	if ref == "" {
+		return nil, errors.New("pkcs11: reference must be the object label")
+	}
+
+	args := []string{"--module", s.Module}
+	if s.Token != "" {
+		args = append(args, "--token-label", s.Token)
+	}
+	args = append(args, "--login", "--pin", "env:"+s.PINEnv,
+		"--read-object", "--type", "data", "--label", ref)
+	out, err := runnerOr(s.Run)(ctx, "pkcs11-tool", args...)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs11: %w", err)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("pkcs11: %w: object %s", ErrNotFound, ref)
+	}
+
+	return out, nil
+}
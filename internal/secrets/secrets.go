@@ -0,0 +1,219 @@
+// Package secrets loads LMK material from external secret managers at startup, so the
+// simulator can run without LMKs stored on disk.
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LMK secret formats.
+const (
+	FormatHex        = "hex"        // the secret is the LMK in hex.
+	FormatPassphrase = "passphrase" // the LMK is derived from the secret with PBKDF2.
+	FormatRaw        = "raw"        // the secret is the LMK itself, e.g. sealed binary data.
+)
+
+// Passphrase derivation parameters: PBKDF2-HMAC-SHA256 with a salt bound to the LMK ID.
+const (
+	passphraseIterations = 210000
+	passphraseSaltPrefix = "go_hsm-lmk-"
+	lmkSize              = 32
+)
+
+// defaultTimeout bounds a single secret manager request.
+const defaultTimeout = 10 * time.Second
+
+var (
+	// ErrUnknownSource is returned for a secret source name without a registered factory.
+	ErrUnknownSource = errors.New("unknown secret source")
+	// ErrNotFound is returned when a secret or a field within it does not exist.
+	ErrNotFound = errors.New("secret not found")
+)
+
+// SecretSource fetches secrets from a secret manager.
+type SecretSource interface {
+	// Fetch returns the secret identified by ref. The reference format is specific to the
+	// source; a "#field" suffix selects a field of a JSON secret.
+	Fetch(ctx context.Context, ref string) ([]byte, error)
+}
+
+// Factory creates a secret source configured from the environment.
+type Factory func() (SecretSource, error)
+
+var registry = struct {
+	sync.RWMutex
+	factories map[string]Factory
+}{
+	factories: map[string]Factory{
+		"env":    func() (SecretSource, error) { return EnvSource{}, nil },
+		"vault":  func() (SecretSource, error) { return NewVaultSourceFromEnv() },
+		"aws":    func() (SecretSource, error) { return NewAWSSourceFromEnv() },
+		"gcp":    func() (SecretSource, error) { return NewGCPSourceFromEnv() },
+		"tpm":    func() (SecretSource, error) { return NewTPMSourceFromEnv() },
+		"pkcs11": func() (SecretSource, error) { return NewPKCS11SourceFromEnv() },
+		"shamir": func() (SecretSource, error) { return NewShamirSourceFromEnv() },
+	},
+}
+
+// Register makes a secret source available under name, replacing any existing one.
+func Register(name string, factory Factory) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	registry.factories[name] = factory
+}
+
+// Sources returns the names of the registered secret sources.
+func Sources() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	names := make([]string, 0, len(registry.factories))
+	for name := range registry.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// New creates the secret source registered under name.
+func New(name string) (SecretSource, error) {
+	registry.RLock()
+	factory, ok := registry.factories[name]
+	registry.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownSource, name)
+	}
+
+	return factory()
+}
+
+// LMKSecret describes where the LMK with a given ID is stored.
+type LMKSecret struct {
+	ID     string
+	Source string
+	Ref    string
+	// Format is hex (default), passphrase or raw.
+	Format string
+}
+
+// Resolve fetches the secret and returns the LMK it describes.
+func (s LMKSecret) Resolve(ctx context.Context) ([]byte, error) {
+	src, err := New(s.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	secret, err := src.Fetch(ctx, s.Ref)
+	if err != nil {
+		return nil, fmt.Errorf("fetch LMK %s from %s: %w", s.ID, s.Source, err)
+	}
+
+	return DeriveLMK(s.ID, s.Format, secret)
+}
+
+// DeriveLMK converts a fetched secret into a 32-byte LMK according to format.
+func DeriveLMK(id, format string, secret []byte) ([]byte, error) {
+	value := strings.TrimSpace(string(secret))
+	switch format {
+	case "", FormatHex:
+		lmk, err := hex.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("LMK %s: secret is not hex", id)
+		}
+		if len(lmk) != lmkSize {
+			return nil, fmt.Errorf("LMK %s: must be %d bytes, got %d", id, lmkSize, len(lmk))
+		}
+
+		return lmk, nil
+	case FormatPassphrase:
+		if value == "" {
+			return nil, fmt.Errorf("LMK %s: empty passphrase", id)
+		}
+
+		return pbkdf2.Key(sha256.New, value, []byte(passphraseSaltPrefix+id),
+			passphraseIterations, lmkSize)
+	case FormatRaw:
+		if len(secret) != lmkSize {
+			return nil, fmt.Errorf("LMK %s: must be %d bytes, got %d", id, lmkSize, len(secret))
+		}
+
+		return bytes.Clone(secret), nil
+	default:
+		return nil, fmt.Errorf("LMK %s: unknown secret format %q", id, format)
+	}
+}
+
+// splitRef separates a "#field" selector from a secret reference.
+func splitRef(ref string) (string, string) {
+	path, field, _ := strings.Cut(ref, "#")
+
+	return path, field
+}
+
+// selectField returns field from a JSON object secret, or the secret itself when field is
+// empty.
+func selectField(secret []byte, field string) ([]byte, error) {
+	if field == "" {
+		return secret, nil
+	}
+
+	var values map[string]any
+	if err := json.Unmarshal(secret, &values); err != nil {
+		return nil, fmt.Errorf("secret is not a JSON object: %w", err)
+	}
+
+	return fieldValue(values, field)
+}
+
+// fieldValue returns a string field of a decoded JSON object.
+func fieldValue(values map[string]any, field string) ([]byte, error) {
+	v, ok := values[field]
+	if !ok {
+		return nil, fmt.Errorf("%w: field %s", ErrNotFound, field)
+	}
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("field %s is not a string", field)
+	}
+
+	return []byte(s), nil
+}
+
+// doJSON sends req and decodes a JSON response into out.
+func doJSON(client *http.Client, req *http.Request, out any) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode/100 != 2:
+		return fmt.Errorf("%s %s: %s", req.Method, req.URL.Path, resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
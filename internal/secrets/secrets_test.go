@@ -0,0 +1,255 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testLMKHex = "000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F"
+
+// TestSignV4Vanilla checks the signer against the get-vanilla case of the AWS Signature
+// Version 4 test suite.
+func TestSignV4Vanilla(t *testing.T) {
+	t.Parallel()
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	signV4(req, nil, awsCredentials{
+		accessKeyID:     "AKIDEXAMPLE",
+		secretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		region:          "us-east-1",
+		service:         "service",
+	}, time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, " +
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestVaultSource(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.token" || r.URL.Path != "/v1/secret/data/go_hsm" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = io.WriteString(w, `{"data":{"data":{"lmk":"`+testLMKHex+`"},"metadata":{"version":3}}}`)
+	}))
+	defer srv.Close()
+
+	src := &VaultSource{Addr: srv.URL, Token: "s.token", Client: srv.Client()}
+	got, err := src.Fetch(context.Background(), "secret/data/go_hsm#lmk")
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if string(got) != testLMKHex {
+		t.Errorf("secret = %s", got)
+	}
+
+	if _, err := src.Fetch(context.Background(), "secret/data/other#lmk"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := src.Fetch(context.Background(), "secret/data/go_hsm#missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for missing field, got %v", err)
+	}
+}
+
+func TestAWSSource(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" ||
+			!strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/20240102/eu-west-1/secretsmanager/") ||
+			!strings.Contains(auth, "x-amz-security-token") ||
+			string(body) != `{"SecretId":"ci/go_hsm"}` {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = io.WriteString(w, `{"Name":"ci/go_hsm","SecretString":"{\"lmk\":\"`+testLMKHex+`\"}"}`)
+	}))
+	defer srv.Close()
+
+	src := &AWSSource{
+		Region:          "eu-west-1",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+		SessionToken:    "session",
+		Endpoint:        srv.URL,
+		Client:          srv.Client(),
+		Now:             func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) },
+	}
+	got, err := src.Fetch(context.Background(), "ci/go_hsm#lmk")
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if string(got) != testLMKHex {
+		t.Errorf("secret = %s", got)
+	}
+}
+
+func TestGCPSource(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = io.WriteString(w, `{"access_token":"ya29.token","expires_in":3599}`)
+	})
+	mux.HandleFunc("/v1/projects/p/secrets/lmk/versions/latest:access", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer ya29.token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// Payload "correct horse battery staple".
+		_, _ = io.WriteString(w, `{"payload":{"data":"Y29ycmVjdCBob3JzZSBiYXR0ZXJ5IHN0YXBsZQ=="}}`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	src := &GCPSource{Endpoint: srv.URL, MetadataURL: srv.URL + "/token", Client: srv.Client()}
+	got, err := src.Fetch(context.Background(), "projects/p/secrets/lmk/versions/latest")
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if string(got) != "correct horse battery staple" {
+		t.Errorf("secret = %q", got)
+	}
+	if _, err := src.Fetch(context.Background(), "lmk"); err == nil {
+		t.Error("expected error for invalid resource name")
+	}
+}
+
+func TestDeriveLMK(t *testing.T) {
+	t.Parallel()
+
+	lmk, err := DeriveLMK("01", FormatHex, []byte(testLMKHex+"\n"))
+	if err != nil || hex.EncodeToString(lmk) != strings.ToLower(testLMKHex) {
+		t.Errorf("hex LMK = %X, %v", lmk, err)
+	}
+	if _, err := DeriveLMK("01", FormatHex, []byte("0011")); err == nil {
+		t.Error("expected error for short LMK")
+	}
+
+	a, err := DeriveLMK("01", FormatPassphrase, []byte("correct horse"))
+	if err != nil || len(a) != 32 {
+		t.Fatalf("passphrase LMK = %X, %v", a, err)
+	}
+	b, _ := DeriveLMK("02", FormatPassphrase, []byte("correct horse"))
+	if hex.EncodeToString(a) == hex.EncodeToString(b) {
+		t.Error("expected LMK IDs to salt the derivation")
+	}
+	raw := []byte(strings.Repeat("\x0a", 32))
+	if lmk, err := DeriveLMK("01", FormatRaw, raw); err != nil || !bytes.Equal(lmk, raw) {
+		t.Errorf("raw LMK = %X, %v", lmk, err)
+	}
+	if _, err := DeriveLMK("01", FormatRaw, raw[:31]); err == nil {
+		t.Error("expected error for short raw LMK")
+	}
+	if _, err := DeriveLMK("01", "pem", []byte("x")); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+// recordRunner returns a Runner that records the command line and answers with out.
+func recordRunner(cmdline *string, out string, err error) Runner {
+	return func(_ context.Context, name string, args ...string) ([]byte, error) {
+		*cmdline = name + " " + strings.Join(args, " ")
+
+		return []byte(out), err
+	}
+}
+
+func TestTPMSource(t *testing.T) {
+	t.Parallel()
+
+	var cmdline string
+	src := &TPMSource{Auth: "pcr:sha256:0,7", Run: recordRunner(&cmdline, "sealed", nil)}
+	got, err := src.Fetch(context.Background(), "0x81010001")
+	if err != nil || string(got) != "sealed" {
+		t.Fatalf("Fetch() = %q, %v", got, err)
+	}
+	if want := "tpm2_unseal --object-context 0x81010001 --auth pcr:sha256:0,7"; cmdline != want {
+		t.Errorf("command = %q, want %q", cmdline, want)
+	}
+
+	src.Run = recordRunner(&cmdline, "", errors.New("exit status 1"))
+	if _, err := src.Fetch(context.Background(), "0x81010001"); err == nil {
+		t.Error("expected error when tpm2_unseal fails")
+	}
+	if _, err := src.Fetch(context.Background(), ""); err == nil {
+		t.Error("expected error for empty reference")
+	}
+}
+
+func TestPKCS11Source(t *testing.T) {
+	t.Parallel()
+
+	var cmdline string
+	src := &PKCS11Source{
+		Module: "/usr/lib/softhsm/libsofthsm2.so",
+		Token:  "go_hsm",
+		PINEnv: "PIN",
+		Run:    recordRunner(&cmdline, "lmk", nil),
+	}
+	got, err := src.Fetch(context.Background(), "lmk-01")
+	if err != nil || string(got) != "lmk" {
+		t.Fatalf("Fetch() = %q, %v", got, err)
+	}
+	want := "pkcs11-tool --module /usr/lib/softhsm/libsofthsm2.so --token-label go_hsm " +
+		"--login --pin env:PIN --read-object --type data --label lmk-01"
+	if cmdline != want {
+		t.Errorf("command = %q, want %q", cmdline, want)
+	}
+
+	src.Run = recordRunner(&cmdline, "", nil)
+	if _, err := src.Fetch(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+type staticSource map[string]string
+
+func (s staticSource) Fetch(_ context.Context, ref string) ([]byte, error) {
+	v, ok := s[ref]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return []byte(v), nil
+}
+
+func TestResolveRegisteredSource(t *testing.T) {
+	t.Setenv("GOHSM_TEST_LMK", testLMKHex)
+	Register("static", func() (SecretSource, error) {
+		return staticSource{"lmk": "passphrase"}, nil
+	})
+
+	lmk, err := LMKSecret{ID: "01", Source: "env", Ref: "GOHSM_TEST_LMK"}.Resolve(context.Background())
+	if err != nil || len(lmk) != 32 {
+		t.Errorf("env LMK = %X, %v", lmk, err)
+	}
+	lmk, err = LMKSecret{ID: "01", Source: "static", Ref: "lmk", Format: FormatPassphrase}.
+		Resolve(context.Background())
+	if err != nil || len(lmk) != 32 {
+		t.Errorf("static LMK = %X, %v", lmk, err)
+	}
+	if _, err := (LMKSecret{ID: "01", Source: "nope"}).Resolve(context.Background()); !errors.Is(err, ErrUnknownSource) {
+		t.Errorf("expected ErrUnknownSource, got %v", err)
+	}
+}
@@ -0,0 +1,275 @@
+package secrets
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
+)
+
+// ShamirConsole is the reference element that reads shares from the console.
+const ShamirConsole = "console"
+
+// shamirChecksumSize is the length of the SHA-256 prefix appended to a secret before it is
+// split, so a wrong or short set of shares is detected when combining.
+const shamirChecksumSize = 4
+
+// ErrShares indicates shares that are malformed, inconsistent or too few to unlock a secret.
+var ErrShares = errors.New("invalid secret shares")
+
+// SplitSecret splits secret into n shares with Shamir secret sharing over GF(256), any k of
+// which recover it. A share is written as "<k>-<index>-<hex>".
+func SplitSecret(secret []byte, n, k int) ([]string, error) {
+	switch {
+	case len(secret) == 0:
+		return nil, errors.New("secret is empty")
+	case k < 2 || k > n:
+		return nil, fmt.Errorf("threshold %d must be between 2 and the share count %d", k, n)
+	case n > 255:
+		return nil, fmt.Errorf("share count %d exceeds 255", n)
+	}
+
+	sum := sha256.Sum256(secret)
+	data := append(bytes.Clone(secret), sum[:shamirChecksumSize]...)
+
+	// Each byte of data is the constant term of a random polynomial of degree k-1.
+	coeffs := make([]byte, len(data)*(k-1))
+	if _, err := cryptoprovider.Read(coeffs); err != nil {
+		return nil, fmt.Errorf("generate share coefficients: %w", err)
+	}
+
+	shares := make([]string, n)
+	for i := range shares {
+		x := byte(i + 1)
+		y := make([]byte, len(data))
+		for j, b := range data {
+			poly := coeffs[j*(k-1) : (j+1)*(k-1)]
+			// Horner's rule from the highest coefficient down to the secret byte.
+			var acc byte
+			for c := len(poly) - 1; c >= 0; c-- {
+				acc = gfMul(acc, x) ^ poly[c]
+			}
+			y[j] = gfMul(acc, x) ^ b
+		}
+		shares[i] = fmt.Sprintf("%d-%d-%X", k, x, y)
+	}
+
+	return shares, nil
+}
+
+// CombineShares recovers a secret from at least threshold shares created by SplitSecret.
+func CombineShares(shares []string) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, fmt.Errorf("%w: no shares", ErrShares)
+	}
+
+	var threshold int
+	xs := make([]byte, 0, len(shares))
+	ys := make([][]byte, 0, len(shares))
+	for _, s := range shares {
+		k, x, y, err := parseShare(s)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case threshold == 0:
+			threshold = k
+		case k != threshold:
+			return nil, fmt.Errorf("%w: shares have different thresholds", ErrShares)
+		}
+		if bytes.IndexByte(xs, x) >= 0 {
+			return nil, fmt.Errorf("%w: duplicate share %d", ErrShares, x)
+		}
+		if len(ys) > 0 && len(y) != len(ys[0]) {
+			return nil, fmt.Errorf("%w: shares have different lengths", ErrShares)
+		}
+		xs = append(xs, x)
+		ys = append(ys, y)
+	}
+	if len(xs) < threshold {
+		return nil, fmt.Errorf("%w: %d of %d shares", ErrShares, len(xs), threshold)
+	}
+	if len(ys[0]) <= shamirChecksumSize {
+		return nil, fmt.Errorf("%w: share too short", ErrShares)
+	}
+
+	// Lagrange interpolation at x = 0; in GF(256) subtraction is XOR.
+	data := make([]byte, len(ys[0]))
+	for i, xi := range xs {
+		basis := byte(1)
+		for j, xj := range xs {
+			if i != j {
+				basis = gfMul(basis, gfDiv(xj, xi^xj))
+			}
+		}
+		for b := range data {
+			data[b] ^= gfMul(ys[i][b], basis)
+		}
+	}
+
+	secret := data[:len(data)-shamirChecksumSize]
+	sum := sha256.Sum256(secret)
+	if !bytes.Equal(sum[:shamirChecksumSize], data[len(secret):]) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrShares)
+	}
+
+	return secret, nil
+}
+
+// parseShare decodes a "<k>-<index>-<hex>" share.
+func parseShare(s string) (int, byte, []byte, error) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) != 3 {
+		return 0, 0, nil, fmt.Errorf("%w: share must be <threshold>-<index>-<hex>", ErrShares)
+	}
+	k, err := strconv.Atoi(parts[0])
+	if err != nil || k < 2 || k > 255 {
+		return 0, 0, nil, fmt.Errorf("%w: threshold %q", ErrShares, parts[0])
+	}
+	x, err := strconv.Atoi(parts[1])
+	if err != nil || x < 1 || x > 255 {
+		return 0, 0, nil, fmt.Errorf("%w: index %q", ErrShares, parts[1])
+	}
+	y, err := hex.DecodeString(parts[2])
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("%w: share %d is not hex", ErrShares, x)
+	}
+
+	return k, byte(x), y, nil
+}
+
+// gfMul multiplies in GF(256) with the AES polynomial x^8 + x^4 + x^3 + x + 1.
+func gfMul(a, b byte) byte {
+	var p byte
+	for b != 0 {
+		if b&1 != 0 {
+			p ^= a
+		}
+		carry := a & 0x80
+		a <<= 1
+		if carry != 0 {
+			a ^= 0x1B
+		}
+		b >>= 1
+	}
+
+	return p
+}
+
+// gfDiv divides a by a non-zero b in GF(256), using b^254 as the inverse of b.
+func gfDiv(a, b byte) byte {
+	inv := byte(1)
+	for range 254 {
+		inv = gfMul(inv, b)
+	}
+
+	return gfMul(a, inv)
+}
+
+// ShamirSource unlocks a secret split with SplitSecret from k-of-n shares, so no single
+// custodian holds the LMK passphrase. A reference is a comma-separated list of share files;
+// the element "console" prompts for the remaining shares on the console, e.g.
+// "/media/card1/share.txt,console".
+type ShamirSource struct {
+	// In is the console the shares are typed on.
+	In io.Reader
+	// Prompt receives the console prompts.
+	Prompt io.Writer
+}
+
+// NewShamirSourceFromEnv configures a ShamirSource reading shares from standard input and
+// prompting on standard error, which stays free of protocol traffic in stdio mode.
+func NewShamirSourceFromEnv() (*ShamirSource, error) {
+	return &ShamirSource{In: os.Stdin, Prompt: os.Stderr}, nil
+}
+
+// Fetch implements SecretSource.
+func (s *ShamirSource) Fetch(ctx context.Context, ref string) ([]byte, error) {
+	if strings.TrimSpace(ref) == "" {
+		return nil, errors.New("shamir: reference must list share files or console")
+	}
+
+	var shares []string
+	console := false
+	for _, elem := range strings.Split(ref, ",") {
+		elem = strings.TrimSpace(elem)
+		if elem == ShamirConsole {
+			console = true
+
+			continue
+		}
+		data, err := os.ReadFile(elem)
+		if err != nil {
+			return nil, fmt.Errorf("shamir: read share: %w", err)
+		}
+		shares = append(shares, strings.TrimSpace(string(data)))
+	}
+
+	if console {
+		var err error
+		if shares, err = s.readConsole(ctx, shares); err != nil {
+			return nil, fmt.Errorf("shamir: %w", err)
+		}
+	}
+
+	secret, err := CombineShares(shares)
+	if err != nil {
+		return nil, fmt.Errorf("shamir: %w", err)
+	}
+
+	return secret, nil
+}
+
+// readConsole prompts for shares until the threshold of the first share is reached.
+func (s *ShamirSource) readConsole(ctx context.Context, shares []string) ([]string, error) {
+	if s.In == nil {
+		return nil, errors.New("no console for share entry")
+	}
+	prompt := s.Prompt
+	if prompt == nil {
+		prompt = io.Discard
+	}
+
+	scanner := bufio.NewScanner(s.In)
+	for {
+		threshold := 0
+		if len(shares) > 0 {
+			k, _, _, err := parseShare(shares[0])
+			if err != nil {
+				return nil, err
+			}
+			if len(shares) >= k {
+				return shares, nil
+			}
+			threshold = k
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if threshold == 0 {
+			_, _ = fmt.Fprint(prompt, "Enter share 1: ")
+		} else {
+			_, _ = fmt.Fprintf(prompt, "Enter share %d of %d: ", len(shares)+1, threshold)
+		}
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return nil, err
+			}
+
+			return nil, fmt.Errorf("%w: console closed after %d shares", ErrShares, len(shares))
+		}
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			shares = append(shares, line)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestShamirSplitCombine(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("correct horse battery staple")
+	shares, err := SplitSecret(secret, 5, 3)
+	if err != nil {
+		t.Fatalf("SplitSecret failed: %v", err)
+	}
+	if len(shares) != 5 || !strings.HasPrefix(shares[0], "3-1-") {
+		t.Fatalf("shares = %q", shares)
+	}
+
+	for _, set := range [][]string{
+		{shares[0], shares[1], shares[2]},
+		{shares[4], shares[2], shares[0]},
+		shares,
+	} {
+		got, err := CombineShares(set)
+		if err != nil || string(got) != string(secret) {
+			t.Errorf("CombineShares(%d shares) = %q, %v", len(set), got, err)
+		}
+	}
+
+	other, _ := SplitSecret(secret, 3, 2)
+	tampered := shares[1][:len(shares[1])-1] + "0"
+	if tampered == shares[1] {
+		tampered = shares[1][:len(shares[1])-1] + "1"
+	}
+	for name, set := range map[string][]string{
+		"too few":         shares[:2],
+		"duplicate":       {shares[0], shares[0], shares[1]},
+		"mixed threshold": {shares[0], other[1], shares[2]},
+		"tampered":        {shares[0], tampered, shares[2]},
+		"malformed":       {shares[0], "3-x-00", shares[2]},
+	} {
+		if _, err := CombineShares(set); !errors.Is(err, ErrShares) {
+			t.Errorf("%s: expected ErrShares, got %v", name, err)
+		}
+	}
+
+	for _, nk := range [][2]int{{3, 1}, {2, 3}, {256, 2}} {
+		if _, err := SplitSecret(secret, nk[0], nk[1]); err == nil {
+			t.Errorf("SplitSecret(n=%d, k=%d) expected error", nk[0], nk[1])
+		}
+	}
+}
+
+func TestShamirSource(t *testing.T) {
+	t.Parallel()
+
+	shares, err := SplitSecret([]byte(testLMKHex), 3, 2)
+	if err != nil {
+		t.Fatalf("SplitSecret failed: %v", err)
+	}
+	dir := t.TempDir()
+	file := filepath.Join(dir, "share1.txt")
+	if err := os.WriteFile(file, []byte(shares[0]+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var prompts strings.Builder
+	src := &ShamirSource{In: strings.NewReader("\n" + shares[2] + "\n"), Prompt: &prompts}
+	got, err := src.Fetch(context.Background(), file+",console")
+	if err != nil || string(got) != testLMKHex {
+		t.Fatalf("Fetch() = %q, %v", got, err)
+	}
+	if !strings.Contains(prompts.String(), "Enter share 2 of 2") {
+		t.Errorf("prompts = %q", prompts.String())
+	}
+
+	src = &ShamirSource{In: strings.NewReader(shares[1] + "\n")}
+	if _, err := src.Fetch(context.Background(), "console"); !errors.Is(err, ErrShares) {
+		t.Errorf("closed console: expected ErrShares, got %v", err)
+	}
+	if _, err := src.Fetch(context.Background(), file); !errors.Is(err, ErrShares) {
+		t.Errorf("single file: expected ErrShares, got %v", err)
+	}
+	if _, err := src.Fetch(context.Background(), ""); err == nil {
+		t.Error("expected error for an empty reference")
+	}
+
+	// The recovered secret is the LMK secret in its configured format.
+	lmk, err := DeriveLMK("01", FormatHex, got)
+	if err != nil || len(lmk) != lmkSize {
+		t.Errorf("DeriveLMK() = %X, %v", lmk, err)
+	}
+}
@@ -0,0 +1,267 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// EnvSource reads secrets from environment variables; ref is the variable name. It is
+// meant for CI systems that inject secrets into the environment.
+type EnvSource struct{}
+
+// Fetch implements SecretSource.
+func (EnvSource) Fetch(_ context.Context, ref string) ([]byte, error) {
+	name, field := splitRef(ref)
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: environment variable %s", ErrNotFound, name)
+	}
+
+	return selectField([]byte(value), field)
+}
+
+// VaultSource reads secrets from HashiCorp Vault. A reference is the API path of the secret
+// followed by "#field", e.g. "secret/data/go_hsm#lmk" for the KV version 2 engine.
+type VaultSource struct {
+	Addr      string
+	Token     string
+	Namespace string
+	Client    *http.Client
+}
+
+// NewVaultSourceFromEnv configures a VaultSource from VAULT_ADDR, VAULT_TOKEN and
+// VAULT_NAMESPACE.
+func NewVaultSourceFromEnv() (*VaultSource, error) {
+	src := &VaultSource{
+		Addr:      os.Getenv("VAULT_ADDR"),
+		Token:     os.Getenv("VAULT_TOKEN"),
+		Namespace: os.Getenv("VAULT_NAMESPACE"),
+	}
+	if src.Addr == "" || src.Token == "" {
+		return nil, errors.New("vault: VAULT_ADDR and VAULT_TOKEN must be set")
+	}
+
+	return src, nil
+}
+
+// Fetch implements SecretSource.
+func (v *VaultSource) Fetch(ctx context.Context, ref string) ([]byte, error) {
+	path, field := splitRef(ref)
+	if field == "" {
+		return nil, errors.New("vault: reference must select a field (path#field)")
+	}
+
+	endpoint := strings.TrimRight(v.Addr, "/") + "/v1/" + strings.TrimLeft(path, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+	if v.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+
+	var resp struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := doJSON(v.Client, req, &resp); err != nil {
+		return nil, fmt.Errorf("vault: %w", err)
+	}
+
+	// KV version 2 nests the secret under data.data.
+	values := resp.Data
+	if nested, ok := values["data"].(map[string]any); ok {
+		if _, isMeta := values["metadata"]; isMeta {
+			values = nested
+		}
+	}
+
+	return fieldValue(values, field)
+}
+
+// AWSSource reads secrets from AWS Secrets Manager. A reference is the secret name or ARN,
+// optionally followed by "#field" for JSON secrets.
+type AWSSource struct {
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Endpoint overrides the regional Secrets Manager endpoint.
+	Endpoint string
+	Client   *http.Client
+	// Now returns the signing time; time.Now is used when nil.
+	Now func() time.Time
+}
+
+// NewAWSSourceFromEnv configures an AWSSource from AWS_REGION (or AWS_DEFAULT_REGION),
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN and AWS_ENDPOINT_URL.
+func NewAWSSourceFromEnv() (*AWSSource, error) {
+	src := &AWSSource{
+		Region:          os.Getenv("AWS_REGION"),
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		Endpoint:        os.Getenv("AWS_ENDPOINT_URL"),
+	}
+	if src.Region == "" {
+		src.Region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if src.Region == "" || src.AccessKeyID == "" || src.SecretAccessKey == "" {
+		return nil, errors.New(
+			"aws: AWS_REGION, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set",
+		)
+	}
+
+	return src, nil
+}
+
+// Fetch implements SecretSource.
+func (a *AWSSource) Fetch(ctx context.Context, ref string) ([]byte, error) {
+	secretID, field := splitRef(ref)
+	body, err := json.Marshal(map[string]string{"SecretId": secretID})
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := a.Endpoint
+	if endpoint == "" {
+		endpoint = "https://secretsmanager." + a.Region + ".amazonaws.com/"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	if a.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", a.SessionToken)
+	}
+
+	now := time.Now
+	if a.Now != nil {
+		now = a.Now
+	}
+	signV4(req, body, awsCredentials{
+		accessKeyID:     a.AccessKeyID,
+		secretAccessKey: a.SecretAccessKey,
+		region:          a.Region,
+		service:         "secretsmanager",
+	}, now())
+
+	var resp struct {
+		SecretString string `json:"SecretString"`
+		SecretBinary []byte `json:"SecretBinary"`
+	}
+	if err := doJSON(a.Client, req, &resp); err != nil {
+		return nil, fmt.Errorf("aws: %w", err)
+	}
+
+	secret := resp.SecretBinary
+	if resp.SecretString != "" {
+		secret = []byte(resp.SecretString)
+	}
+
+	return selectField(secret, field)
+}
+
+// GCPSource reads secrets from Google Cloud Secret Manager. A reference is the secret
+// version resource name, e.g. "projects/p/secrets/lmk/versions/latest", optionally followed
+// by "#field" for JSON secrets.
+type GCPSource struct {
+	// Token is an OAuth2 access token; when empty a token is requested from the metadata
+	// server of the instance.
+	Token string
+	// Endpoint overrides https://secretmanager.googleapis.com.
+	Endpoint string
+	// MetadataURL overrides the metadata server token endpoint.
+	MetadataURL string
+	Client      *http.Client
+}
+
+const (
+	gcpEndpoint    = "https://secretmanager.googleapis.com"
+	gcpMetadataURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+// NewGCPSourceFromEnv configures a GCPSource from GOOGLE_OAUTH_ACCESS_TOKEN; without it the
+// metadata server provides the token.
+func NewGCPSourceFromEnv() (*GCPSource, error) {
+	return &GCPSource{Token: os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN")}, nil
+}
+
+// Fetch implements SecretSource.
+func (g *GCPSource) Fetch(ctx context.Context, ref string) ([]byte, error) {
+	name, field := splitRef(ref)
+	if !strings.HasPrefix(name, "projects/") {
+		return nil, fmt.Errorf("gcp: invalid secret version name %q", name)
+	}
+
+	token, err := g.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := g.Endpoint
+	if endpoint == "" {
+		endpoint = gcpEndpoint
+	}
+	u := strings.TrimRight(endpoint, "/") + "/v1/" + name + ":access"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	var resp struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := doJSON(g.Client, req, &resp); err != nil {
+		return nil, fmt.Errorf("gcp: %w", err)
+	}
+
+	secret, err := base64.StdEncoding.DecodeString(resp.Payload.Data)
+	if err != nil {
+		return nil, fmt.Errorf("gcp: invalid payload: %w", err)
+	}
+
+	return selectField(secret, field)
+}
+
+// accessToken returns the configured token or one issued by the metadata server.
+func (g *GCPSource) accessToken(ctx context.Context) (string, error) {
+	if g.Token != "" {
+		return g.Token, nil
+	}
+
+	metadataURL := g.MetadataURL
+	if metadataURL == "" {
+		metadataURL = gcpMetadataURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	var resp struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := doJSON(g.Client, req, &resp); err != nil {
+		return "", fmt.Errorf("gcp: metadata token: %w", err)
+	}
+	if resp.AccessToken == "" {
+		return "", errors.New("gcp: metadata server returned no access token")
+	}
+
+	return resp.AccessToken, nil
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+)
+
+// TestApplyDiagnostics verifies that the diagnostic detail is only split from error
+// responses, so success responses echoing DetailSeparator, such as B2, are left intact.
+func TestApplyDiagnostics(t *testing.T) {
+	t.Parallel()
+
+	sep := string(errorcodes.DetailSeparator)
+	tests := []struct {
+		name        string
+		resp        string
+		diagnostics bool
+		want        string
+	}{
+		{"B2 echo", "B300AB" + sep + "CD", false, "B300AB" + sep + "CD"},
+		{"B2 echo with diagnostics", "B300AB" + sep + "CD", true, "B300AB" + sep + "CD"},
+		{"B2 echo of separator only", "B300" + sep, true, "B300" + sep},
+		{"error detail stripped", "B315" + sep + "length field", false, "B315"},
+		{"error detail exposed", "B315" + sep + "length field", true, "B315~Elength field"},
+		{"error without detail", "B315", true, "B315"},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := &Server{}
+			s.diagnostics.Store(tc.diagnostics)
+			if got := string(s.applyDiagnostics([]byte(tc.resp))); got != tc.want {
+				t.Errorf("applyDiagnostics(%q) = %q, want %q", tc.resp, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Limits of the payShield message header and trailer.
+const (
+	// MaxHeaderLength is the longest message header a payShield can be configured with.
+	MaxHeaderLength = 255
+	// trailerDelimiter separates the optional message trailer from the command.
+	trailerDelimiter = 0x19
+	// maxTrailerLength is the longest message trailer.
+	maxTrailerLength = 32
+)
+
+// SetHeaderLength sets the length of the message header that prefixes every command and is
+// echoed in front of its response. The first 4 header bytes are the task ID of the framing;
+// clients configured for a longer header, as payShield allows, send the remaining bytes
+// before the command. The default is 4.
+func (s *Server) SetHeaderLength(n int) error {
+	if n < taskIDSize || n > MaxHeaderLength {
+		return fmt.Errorf("message header length %d must be between %d and %d",
+			n, taskIDSize, MaxHeaderLength)
+	}
+	s.extraHeader.Store(int32(n - taskIDSize))
+
+	return nil
+}
+
+// SetTrailer enables the payShield message trailer: a command may end with the delimiter
+// 0x19 followed by up to 32 bytes, which are echoed after its response. Commands must then
+// not contain the delimiter byte.
+func (s *Server) SetTrailer(enabled bool) {
+	s.trailer.Store(enabled)
+}
+
+// serve processes a command received on p and framed with the header and trailer configured
+// for p or the server, and returns the response framed the same way. Data is the request
+// after the task ID.
+func (s *Server) serve(p *port, client string, data []byte) ([]byte, bool, error) {
+	extra := int(s.extraHeader.Load())
+	if p != nil && p.HeaderLength != 0 {
+		extra = p.HeaderLength - taskIDSize
+	}
+	if len(data) < extra {
+		return nil, true, errors.New("request shorter than the message header")
+	}
+	header, cmd := data[:extra], data[extra:]
+
+	var trailer []byte
+	if s.trailer.Load() || (p != nil && p.Trailer) {
+		if idx := bytes.IndexByte(cmd, trailerDelimiter); idx >= 0 {
+			cmd, trailer = cmd[:idx], cmd[idx:]
+			if len(trailer)-1 > maxTrailerLength {
+				return nil, true, fmt.Errorf("message trailer longer than %d bytes", maxTrailerLength)
+			}
+		}
+	}
+
+	resp, closeConn, err := s.process(p, client, cmd)
+	if resp == nil || (len(header) == 0 && len(trailer) == 0) {
+		return resp, closeConn, err
+	}
+
+	out := make([]byte, 0, len(header)+len(resp)+len(trailer))
+	out = append(append(append(out, header...), resp...), trailer...)
+
+	return out, closeConn, err
+}
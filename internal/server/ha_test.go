@@ -0,0 +1,109 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andrei-cloud/anet"
+	"github.com/andrei-cloud/go_hsm/internal/hapair"
+	"github.com/andrei-cloud/go_hsm/internal/pintries"
+	"github.com/andrei-cloud/go_hsm/internal/server"
+)
+
+// serveOne answers a single request with srv and returns the response after the task ID.
+func serveOne(t *testing.T, srv *server.Server, cmd string) string {
+	t.Helper()
+
+	var in, out bytes.Buffer
+	frame(t, &in, "0001", cmd)
+	if err := srv.ServeStream(&in, &out); err != nil {
+		t.Fatalf("ServeStream() error = %v", err)
+	}
+	resp, err := anet.Read(&out)
+	if err != nil {
+		t.Fatalf("failed to read response to %s: %v", cmd, err)
+	}
+
+	return string(resp[4:])
+}
+
+// TestHAPINTries verifies that the PIN try counters of a primary are replicated to its
+// standby: a counter reset by host command on the primary unblocks the account on the
+// standby.
+func TestHAPINTries(t *testing.T) {
+	t.Parallel()
+
+	const account = "000123456789"
+	dir := t.TempDir()
+	replAddr := freeAddr(t)
+	rules := []pintries.Rule{{Command: "DC", MaxTries: 1}}
+
+	newMember := func(cfg hapair.Config, name string) (*hapair.Node, *pintries.Tracker, *server.Server) {
+		state := hapair.NewState(filepath.Join(dir, name+".json"))
+		node, err := hapair.NewNode(cfg, state)
+		if err != nil {
+			t.Fatalf("NewNode(%s) error = %v", name, err)
+		}
+		tracker, err := pintries.New(rules, "", state)
+		if err != nil {
+			t.Fatalf("pintries.New() error = %v", err)
+		}
+		srv := newStreamServer(t)
+		srv.SetPINTries(tracker)
+		srv.SetPINTriesResetCommand("PZ")
+
+		return node, tracker, srv
+	}
+	primary, primaryTries, primarySrv := newMember(hapair.Config{
+		Role:     hapair.RolePrimary,
+		Listen:   replAddr,
+		Interval: 20 * time.Millisecond,
+	}, "primary")
+	standby, standbyTries, standbySrv := newMember(hapair.Config{
+		Role:            hapair.RoleStandby,
+		Peer:            replAddr,
+		Interval:        20 * time.Millisecond,
+		FailoverTimeout: 5 * time.Second,
+	}, "standby")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = primary.Run(ctx) }()
+	go func() { _ = standby.Run(ctx) }()
+
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	dc := "DC" + "U" + strings.Repeat("0", 32) + "U" + strings.Repeat("1", 32) +
+		strings.Repeat("A", 16) + "01" + account + "1" + "1234"
+	primaryTries.Record("DC", account, "01")
+	waitFor("failed try on the standby", func() bool { return standbyTries.Failures(account) == 1 })
+	if got := serveOne(t, standbySrv, dc); got != "DD39" {
+		t.Errorf("standby response before reset = %q, want DD39", got)
+	}
+
+	if got := serveOne(t, primarySrv, "PZ"+account); got != "PA00" {
+		t.Fatalf("primary reset response = %q, want PA00", got)
+	}
+	waitFor("reset on the standby", func() bool { return standbyTries.Failures(account) == 0 })
+	// Without plugins the unblocked command is unknown.
+	if got := serveOne(t, standbySrv, dc); got != "DD68" {
+		t.Errorf("standby response after reset = %q, want DD68", got)
+	}
+	if standby.Role() != hapair.RoleStandby {
+		t.Errorf("standby promoted while primary is alive")
+	}
+}
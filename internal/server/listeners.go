@@ -0,0 +1,212 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	anetserver "github.com/andrei-cloud/anet/server"
+	"github.com/andrei-cloud/go_hsm/internal/hsm/logic"
+	"github.com/rs/zerolog/log"
+)
+
+// Networks of a Listener.
+const (
+	// NetworkTCP frames each message with a 2-byte big-endian length, as on the main address.
+	NetworkTCP = "tcp"
+	// NetworkUDP carries one message per datagram, without length prefix.
+	NetworkUDP = "udp"
+)
+
+// maxDatagramSize is the largest UDP datagram.
+const maxDatagramSize = 65535
+
+// Listener is an additional host port of a Server, bound to an LMK and a command set as
+// payShield host ports can be.
+type Listener struct {
+	// Address is the listen address.
+	Address string `mapstructure:"address"`
+	// Network is NetworkTCP, the default, or NetworkUDP.
+	Network string `mapstructure:"network"`
+	// HeaderLength is the length of the message header echoed in responses, including the
+	// 4-byte task ID; 0 selects the header length of the server.
+	HeaderLength int `mapstructure:"header_length"`
+	// Trailer accepts the message trailer on this listener, as the server trailer setting
+	// does on every listener.
+	Trailer bool `mapstructure:"trailer"`
+	// LMKID is the LMK of the requests that name none, for the commands accepting an LMK
+	// identifier; empty keeps the default LMKs.
+	LMKID string `mapstructure:"lmk_id"`
+	// Commands lists the commands served on the port; empty serves every command. Other
+	// commands are answered with error code 68.
+	Commands []string `mapstructure:"commands"`
+}
+
+// port is a listener of the server. A nil port is the main address, which has no binding.
+type port struct {
+	Listener
+	srv *anetserver.Server
+	udp net.PacketConn
+	// inFlight holds a slot per datagram being processed on a UDP port.
+	inFlight chan struct{}
+}
+
+// AddListener adds a host port served with the same plugins and settings as the main
+// address. Listeners must be added before Start.
+func (s *Server) AddListener(l Listener) error {
+	if s.srvConfig == nil {
+		return fmt.Errorf("listener %s: server has no TCP listener", l.Address)
+	}
+	if l.LMKID != "" && !slices.Contains(logic.RegisteredLMKIDs(), l.LMKID) {
+		return fmt.Errorf("listener %s: LMK %q is not installed", l.Address, l.LMKID)
+	}
+	commands := make([]string, len(l.Commands))
+	for i, cmd := range l.Commands {
+		if len(cmd) != 2 {
+			return fmt.Errorf("listener %s: invalid command %q", l.Address, cmd)
+		}
+		commands[i] = strings.ToUpper(cmd)
+	}
+	l.Commands = commands
+	if l.HeaderLength != 0 && (l.HeaderLength < taskIDSize || l.HeaderLength > MaxHeaderLength) {
+		return fmt.Errorf("listener %s: message header length %d must be between %d and %d",
+			l.Address, l.HeaderLength, taskIDSize, MaxHeaderLength)
+	}
+
+	p := &port{Listener: l}
+	switch strings.ToLower(l.Network) {
+	case "", NetworkTCP:
+		p.Network = NetworkTCP
+	case NetworkUDP:
+		p.Network = NetworkUDP
+		s.ports = append(s.ports, p)
+
+		return nil
+	default:
+		return fmt.Errorf("listener %s: unsupported network %q", l.Address, l.Network)
+	}
+	handler := anetserver.HandlerFunc(func(conn *anetserver.ServerConn, data []byte) ([]byte, error) {
+		return s.handle(p, conn, data)
+	})
+	srv, err := anetserver.NewServer(l.Address, handler, s.srvConfig)
+	if err != nil {
+		return fmt.Errorf("listener %s: %w", l.Address, err)
+	}
+	p.srv = srv
+	s.ports = append(s.ports, p)
+
+	return nil
+}
+
+// start starts serving requests on p.
+func (p *port) start(s *Server) error {
+	if p.Network == NetworkTCP {
+		return p.srv.Start()
+	}
+
+	conn, err := net.ListenPacket("udp", p.Address)
+	if err != nil {
+		return err
+	}
+	p.udp = conn
+	p.inFlight = make(chan struct{}, max(s.srvConfig.MaxConns, 1))
+	go p.serveUDP(s)
+
+	return nil
+}
+
+// stop stops serving requests on p.
+func (p *port) stop() error {
+	if p.Network == NetworkTCP {
+		return p.srv.Stop()
+	}
+	if p.udp == nil {
+		return nil
+	}
+
+	return p.udp.Close()
+}
+
+// serveUDP answers the datagrams received on p until it is stopped. Each datagram holds the
+// message header, starting with the 4-byte task ID, and the command, and is answered with a
+// datagram holding the header and the response. Requests that would close a TCP connection
+// are dropped. As many datagrams are processed at a time as the server accepts TCP
+// connections; datagrams arriving beyond that are dropped, leaving the client to retry as
+// it does for lost datagrams.
+func (p *port) serveUDP(s *Server) {
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, addr, err := p.udp.ReadFrom(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			log.Error().Err(err).Str("listener", p.Address).Msg("failed to read datagram")
+
+			continue
+		}
+		if n < taskIDSize {
+			log.Error().Str("client_ip", addr.String()).Msg("datagram shorter than the task ID")
+
+			continue
+		}
+
+		select {
+		case p.inFlight <- struct{}{}:
+		default:
+			log.Warn().
+				Str("event", "udp_busy").
+				Str("client_ip", addr.String()).
+				Str("listener", p.Address).
+				Int("in_flight", cap(p.inFlight)).
+				Msg("dropping datagram: too many requests in flight")
+
+			continue
+		}
+
+		req := slices.Clone(buf[:n])
+		go func() {
+			defer func() { <-p.inFlight }()
+
+			resp, _, _ := s.serve(p, addr.String(), req[taskIDSize:])
+			if resp == nil {
+				return
+			}
+			if _, err := p.udp.WriteTo(slices.Concat(req[:taskIDSize], resp), addr); err != nil {
+				log.Error().Err(err).Str("client_ip", addr.String()).Msg("failed to send datagram")
+			}
+		}()
+	}
+}
+
+// refusedResponse returns the response refusing data when its command is not served on p,
+// or nil otherwise.
+func (p *port) refusedResponse(s *Server, client string, data []byte) []byte {
+	if p == nil || len(p.Commands) == 0 || len(data) < 2 {
+		return nil
+	}
+	cmd := string(data[:2])
+	if slices.Contains(p.Commands, cmd) {
+		return nil
+	}
+	log.Warn().
+		Str("event", "command_not_allowed").
+		Str("client_ip", client).
+		Str("command", cmd).
+		Str("listener", p.Address).
+		Msg("refusing command not served on this listener")
+
+	return s.errorResponse(cmd)
+}
+
+// bind returns the payload of a request for cmd received on p, naming the LMK of p when
+// the request names none.
+func (p *port) bind(cmd string, payload []byte) []byte {
+	if p == nil || p.LMKID == "" {
+		return payload
+	}
+
+	return logic.WithDefaultLMKID(cmd, payload, p.LMKID)
+}
@@ -0,0 +1,174 @@
+package server_test
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andrei-cloud/anet"
+	"github.com/andrei-cloud/go_hsm/internal/authstate"
+	"github.com/andrei-cloud/go_hsm/internal/hsm"
+	"github.com/andrei-cloud/go_hsm/internal/plugins"
+	"github.com/andrei-cloud/go_hsm/internal/server"
+)
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	return addr
+}
+
+// exchange sends cmd to addr and returns the response after the task ID.
+func exchange(t *testing.T, addr, cmd string) string {
+	t.Helper()
+
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		t.Fatalf("failed to connect to %s: %v", addr, err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if err := anet.Write(conn, []byte("0001"+cmd)); err != nil {
+		t.Fatalf("failed to send %s: %v", cmd, err)
+	}
+	resp, err := anet.Read(conn)
+	if err != nil {
+		t.Fatalf("failed to read response to %s: %v", cmd, err)
+	}
+
+	return string(resp[4:])
+}
+
+// TestListeners verifies that an additional listener serves only its commands and names its
+// LMK in requests that name none.
+func TestListeners(t *testing.T) {
+	t.Parallel()
+
+	h, err := hsm.NewHSM(hsm.FirmwareVersion, false)
+	if err != nil {
+		t.Fatalf("failed to create hsm: %v", err)
+	}
+	main, tenant := freeAddr(t), freeAddr(t)
+	srv, err := server.NewServer(main, plugins.NewPluginManager(context.Background(), h))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	gate, err := authstate.NewHost(authstate.HostRules{Password: "secret", EnterCommand: "RA"},
+		h.Authorization)
+	if err != nil {
+		t.Fatalf("authstate.NewHost() error = %v", err)
+	}
+	srv.SetAuthorization(gate)
+
+	for _, invalid := range []server.Listener{
+		{Address: freeAddr(t), LMKID: "42"},
+		{Address: freeAddr(t), Commands: []string{"A8X"}},
+		{Address: freeAddr(t), Network: "sctp"},
+		{Address: freeAddr(t), HeaderLength: 2},
+	} {
+		if err := srv.AddListener(invalid); err == nil {
+			t.Errorf("AddListener(%+v) succeeded", invalid)
+		}
+	}
+	if err := srv.AddListener(server.Listener{Address: tenant, LMKID: "01", Commands: []string{"a8"}}); err != nil {
+		t.Fatalf("AddListener() error = %v", err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer func() {
+		if err := srv.Stop(); err != nil {
+			t.Errorf("Stop() error = %v", err)
+		}
+	}()
+
+	a8 := "A8" + "000" + "U" + strings.Repeat("0", 32) + "U" + strings.Repeat("1", 32) + "U"
+	steps := []struct{ addr, cmd, want string }{
+		// Commands outside the command set of the listener are refused.
+		{tenant, "RA01secret", "RB68"},
+		{main, "RA01secret", "RB00"},
+		// Only LMK 01 is authorized: the main address uses LMK 00 and the listener LMK 01.
+		// Without plugins an authorized command is unknown.
+		{main, a8, "A917"},
+		{tenant, a8, "A968"},
+		{tenant, a8 + "%00", "A917"},
+	}
+	for _, step := range steps {
+		got := exchange(t, step.addr, step.cmd)
+		if !strings.HasPrefix(got, step.want) {
+			t.Errorf("%s on %s = %q, want %q", step.cmd[:2], step.addr, got, step.want)
+		}
+	}
+}
+
+// TestUDPListener verifies that a UDP listener answers one message per datagram with its own
+// message header and trailer settings.
+func TestUDPListener(t *testing.T) {
+	t.Parallel()
+
+	h, err := hsm.NewHSM(hsm.FirmwareVersion, false)
+	if err != nil {
+		t.Fatalf("failed to create hsm: %v", err)
+	}
+	srv, err := server.NewServer(freeAddr(t), plugins.NewPluginManager(context.Background(), h))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	srv.SetHealthCommand("HZ")
+
+	ln, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	addr := ln.LocalAddr().String()
+	_ = ln.Close()
+	udp := server.Listener{Address: addr, Network: "UDP", HeaderLength: 6, Trailer: true}
+	if err := srv.AddListener(udp); err != nil {
+		t.Fatalf("AddListener() error = %v", err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer func() {
+		if err := srv.Stop(); err != nil {
+			t.Errorf("Stop() error = %v", err)
+		}
+	}()
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// A datagram shorter than the task ID is dropped.
+	for _, datagram := range []string{"00", "0001XYHZ\x19TRAILER", "0002ABNC"} {
+		if _, err := conn.Write([]byte(datagram)); err != nil {
+			t.Fatalf("failed to send datagram: %v", err)
+		}
+	}
+	got := map[string]bool{}
+	buf := make([]byte, 1024)
+	for range 2 {
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("failed to read datagram: %v", err)
+		}
+		got[string(buf[:n])] = true
+	}
+	for _, want := range []string{"0001XYHA00\x19TRAILER", "0002ABND68"} {
+		if !got[want] {
+			t.Errorf("responses %v lack %q", got, want)
+		}
+	}
+}
@@ -5,20 +5,35 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"sync/atomic"
 	"time"
 
 	anetserver "github.com/andrei-cloud/anet/server"
+	"github.com/andrei-cloud/go_hsm/internal/audit"
+	"github.com/andrei-cloud/go_hsm/internal/authstate"
 	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/internal/faults"
+	"github.com/andrei-cloud/go_hsm/internal/hapair"
 	"github.com/andrei-cloud/go_hsm/internal/hsm"
+	"github.com/andrei-cloud/go_hsm/internal/hsm/logic"
+	"github.com/andrei-cloud/go_hsm/internal/pcipolicy"
+	"github.com/andrei-cloud/go_hsm/internal/pintries"
 	"github.com/andrei-cloud/go_hsm/internal/plugins"
+	"github.com/andrei-cloud/go_hsm/internal/profiling"
+	"github.com/andrei-cloud/go_hsm/internal/ratelimit"
 	"github.com/andrei-cloud/go_hsm/pkg/common"
+	"github.com/andrei-cloud/go_hsm/pkg/pan"
 	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 )
 
 const requestIDKey contextKey = "request_id"
 
+// DUKPTCounterPrefix prefixes the initial KSN in the names of the DUKPT transaction counters.
+const DUKPTCounterPrefix = "dukpt:"
+
 // contextKey is a custom type for context keys to avoid collisions.
 type contextKey string
 
@@ -29,10 +44,35 @@ type logAdapter struct{}
 type Server struct {
 	address             string
 	srv                 *anetserver.Server
+	srvConfig           *anetserver.ServerConfig
+	ports               []*port
 	pluginManager       *plugins.PluginManager
 	pluginManagerHolder atomic.Value // stores *plugins.PluginManager
 	hsmSvc              *hsm.HSM
 	activeConns         int32
+	diagnostics         atomic.Bool
+	faults              atomic.Pointer[faults.Injector]
+	healthCommand       atomic.Pointer[string]
+	extraHeader         atomic.Int32
+	trailer             atomic.Bool
+	pinTries            atomic.Pointer[pintries.Tracker]
+	pinTriesReset       atomic.Pointer[string]
+	dukptCounters       atomic.Pointer[hapair.State]
+	pciPolicy           atomic.Pointer[pcipolicy.Policy]
+	authorization       atomic.Pointer[authstate.Host]
+	auditLog            atomic.Pointer[audit.Log]
+	rateLimits          atomic.Pointer[ratelimit.Limiter]
+	maxMessageSize      atomic.Int64
+	profiler            atomic.Pointer[profiling.Profiler]
+}
+
+// Options tunes the TCP connections of a Server.
+type Options struct {
+	// KeepAlive is the TCP keepalive probe period; 0 selects 30s and a negative value
+	// disables keepalive.
+	KeepAlive time.Duration
+	// IdleTimeout closes connections that send no request for this long; 0 disables it.
+	IdleTimeout time.Duration
 }
 
 func (l logAdapter) Print(v ...any) {
@@ -57,13 +97,19 @@ func (l logAdapter) Errorf(format string, v ...any) {
 
 // NewServer configures and returns a new Server listening on the given address using the provided PluginManager.
 func NewServer(address string, pm *plugins.PluginManager) (*Server, error) {
+	return NewServerWithOptions(address, pm, Options{})
+}
+
+// NewServerWithOptions is like NewServer but applies the given connection options.
+func NewServerWithOptions(address string, pm *plugins.PluginManager, opts Options) (*Server, error) {
 	cfg := &anetserver.ServerConfig{
-		MaxConns:        100,
-		ReadTimeout:     30 * time.Second,
-		WriteTimeout:    30 * time.Second,
-		IdleTimeout:     0 * time.Second, // disable idle connection closure.
-		ShutdownTimeout: 5 * time.Second,
-		Logger:          logAdapter{},
+		MaxConns:          100,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       opts.IdleTimeout,
+		KeepAliveInterval: opts.KeepAlive,
+		ShutdownTimeout:   5 * time.Second,
+		Logger:            logAdapter{},
 	}
 
 	s := &Server{
@@ -72,26 +118,54 @@ func NewServer(address string, pm *plugins.PluginManager) (*Server, error) {
 		hsmSvc:        pm.HSM(), // Get HSM from plugin manager
 	}
 	s.pluginManagerHolder.Store(pm)
-	handler := anetserver.HandlerFunc(s.handle)
+	handler := anetserver.HandlerFunc(func(conn *anetserver.ServerConn, data []byte) ([]byte, error) {
+		return s.handle(nil, conn, data)
+	})
 	srv, err := anetserver.NewServer(address, handler, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("server setup failed: %w", err)
 	}
-	s.srv = srv
+	s.srv, s.srvConfig = srv, cfg
 
 	return s, nil
 }
 
-// Start begins listening for connections and processing requests.
+// Start begins listening for connections and processing requests on the main address and
+// the additional listeners.
 func (s *Server) Start() error {
+	if err := s.srv.Start(); err != nil {
+		return err
+	}
 	log.Info().Str("address", s.address).Msg("server started")
 
-	return s.srv.Start()
+	for i, p := range s.ports {
+		if err := p.start(s); err != nil {
+			for _, started := range s.ports[:i] {
+				_ = started.stop()
+			}
+			_ = s.srv.Stop()
+
+			return fmt.Errorf("listener %s: %w", p.Address, err)
+		}
+		log.Info().
+			Str("address", p.Address).
+			Str("network", p.Network).
+			Str("lmk_id", p.LMKID).
+			Strs("commands", p.Commands).
+			Msg("listener started")
+	}
+
+	return nil
 }
 
-// Stop gracefully shuts down the server.
+// Stop gracefully shuts down the server and its additional listeners.
 func (s *Server) Stop() error {
-	return s.srv.Stop()
+	errs := []error{s.srv.Stop()}
+	for _, p := range s.ports {
+		errs = append(errs, p.stop())
+	}
+
+	return errors.Join(errs...)
 }
 
 // SetPluginManager atomically replaces the PluginManager and closes the old one.
@@ -110,6 +184,238 @@ func (s *Server) SetPluginManager(newPM *plugins.PluginManager) {
 	}
 }
 
+// SetDiagnostics enables or disables the 'propagate error details' mode. When enabled, error
+// responses carry a vendor field with the internal reason after the standard error code.
+func (s *Server) SetDiagnostics(enabled bool) {
+	s.diagnostics.Store(enabled)
+}
+
+// Diagnostics reports whether the 'propagate error details' mode is enabled.
+func (s *Server) Diagnostics() bool {
+	return s.diagnostics.Load()
+}
+
+// SetFaults installs a fault injector used for resilience testing. A nil injector disables
+// fault injection.
+func (s *Server) SetFaults(inj *faults.Injector) {
+	s.faults.Store(inj)
+}
+
+// SetPINTries installs a tracker that limits failed PIN verifications per account. A nil
+// tracker disables the limits.
+func (s *Server) SetPINTries(t *pintries.Tracker) {
+	s.pinTries.Store(t)
+}
+
+// SetDUKPTCounters records the highest transaction counter of each DUKPT PIN entry device
+// translated from in st, under the name DUKPTCounterPrefix + the initial KSN in hex, so the
+// standby of an HA pair continues from them. A nil st disables the counters.
+func (s *Server) SetDUKPTCounters(st *hapair.State) {
+	s.dukptCounters.Store(st)
+}
+
+// SetPCIPolicy installs a policy refusing the operations disallowed in PCI-HSM mode. A nil
+// policy disables the enforcement.
+func (s *Server) SetPCIPolicy(p *pcipolicy.Policy) {
+	s.pciPolicy.Store(p)
+}
+
+// PCIPolicy returns the installed PCI-HSM policy, or nil when the enforcement is disabled.
+func (s *Server) PCIPolicy() *pcipolicy.Policy {
+	return s.pciPolicy.Load()
+}
+
+// SetAuthorization installs a gate refusing sensitive host commands with error code 17 for
+// LMKs outside the authorized state held in the HSM, and answering the commands entering and
+// cancelling it. A nil gate disables the authorized state of host commands.
+func (s *Server) SetAuthorization(h *authstate.Host) {
+	s.authorization.Store(h)
+}
+
+// SetAuditLog installs the audit log recording the successful key generation, key export and
+// clear key commands, the changes of the authorized state and the commands executed in it. A
+// nil log disables the recording.
+func (s *Server) SetAuditLog(l *audit.Log) {
+	s.auditLog.Store(l)
+}
+
+// SetRateLimits installs a limiter refusing the commands of a client above its command rate
+// or beyond its commands in flight. A nil limiter disables the limits.
+func (s *Server) SetRateLimits(l *ratelimit.Limiter) {
+	s.rateLimits.Store(l)
+}
+
+// RateLimits returns the installed limiter, or nil when the limits are disabled.
+func (s *Server) RateLimits() *ratelimit.Limiter {
+	return s.rateLimits.Load()
+}
+
+// SetPINTriesResetCommand sets the command code answered by the server core to reset PIN try
+// counters. The request carries a 12 digit account number, or nothing to reset every
+// account, and is answered with the incremented code and error code 00. An empty code
+// disables it.
+func (s *Server) SetPINTriesResetCommand(code string) {
+	if code == "" {
+		s.pinTriesReset.Store(nil)
+
+		return
+	}
+	s.pinTriesReset.Store(&code)
+}
+
+// SetHealthCommand sets the command code answered by the server core for load balancer
+// health checks. The request is answered with the incremented code and error code 00
+// without plugin execution, fault injection or request logging. An empty code disables it.
+func (s *Server) SetHealthCommand(code string) {
+	if code == "" {
+		s.healthCommand.Store(nil)
+
+		return
+	}
+	s.healthCommand.Store(&code)
+}
+
+// SetMaxMessageSize limits the size of a command, including its code, to n bytes. Larger
+// commands are answered with error code 80 without plugin execution. 0 removes the limit,
+// leaving the maximum a frame can carry (65531 bytes after the task ID).
+func (s *Server) SetMaxMessageSize(n int) {
+	s.maxMessageSize.Store(int64(n))
+}
+
+// MaxMessageSize returns the command size limit, 0 when there is none.
+func (s *Server) MaxMessageSize() int {
+	return int(s.maxMessageSize.Load())
+}
+
+// SetProfiler installs a profiler that records the execution profile of every command. A
+// nil profiler disables profiling.
+func (s *Server) SetProfiler(p *profiling.Profiler) {
+	s.profiler.Store(p)
+}
+
+// healthResponse returns the response to a health check, or nil when data is not one.
+func (s *Server) healthResponse(data []byte) []byte {
+	code := s.healthCommand.Load()
+	if code == nil || len(data) < 2 || string(data[:2]) != *code {
+		return nil
+	}
+
+	return []byte(s.incrementCode(*code) + errorcodes.Err00.CodeOnly())
+}
+
+// pinTriesResetResponse resets PIN try counters and returns the response when data is a
+// reset request, or nil otherwise.
+func (s *Server) pinTriesResetResponse(client string, data []byte) []byte {
+	code := s.pinTriesReset.Load()
+	tracker := s.pinTries.Load()
+	if code == nil || tracker == nil || len(data) < 2 || string(data[:2]) != *code {
+		return nil
+	}
+
+	account := string(data[2:])
+	if account != "" && (len(account) != 12 || strings.Trim(account, "0123456789") != "") {
+		return []byte(s.incrementCode(*code) + errorcodes.Err15.CodeOnly())
+	}
+	tracker.Reset(account)
+	log.Info().
+		Str("event", "pin_tries_reset").
+		Str("client_ip", client).
+		Str("account", pan.Mask(account)).
+		Msg("PIN try counters reset")
+
+	return []byte(s.incrementCode(*code) + errorcodes.Err00.CodeOnly())
+}
+
+// authorizationResponse enters or cancels the authorized state of an LMK and returns the
+// response when data is such a request, or nil otherwise. Both requests carry the LMK ID
+// (2N); a request entering the authorized state follows it with the password and is answered
+// with the deadline of the state (YYYYMMDDhhmmss, UTC) after the error code.
+func (s *Server) authorizationResponse(client string, data []byte) []byte {
+	gate := s.authorization.Load()
+	enter, cancel := gate.Commands()
+	if len(data) < 2 {
+		return nil
+	}
+	cmd := string(data[:2])
+	if cmd != enter && cmd != cancel {
+		return nil
+	}
+
+	respCode := s.incrementCode(cmd)
+	if len(data) < 4 {
+		return []byte(respCode + errorcodes.Err15.CodeOnly())
+	}
+	lmkID := string(data[2:4])
+	if !slices.Contains(logic.RegisteredLMKIDs(), lmkID) {
+		return []byte(respCode + errorcodes.Err13.CodeOnly())
+	}
+
+	if cmd == cancel {
+		gate.Cancel(lmkID)
+		s.recordAudit(audit.EventAuthorizationState, map[string]string{
+			"operation": "cancel",
+			"client_ip": client,
+			"lmk_id":    lmkID,
+		})
+		log.Info().
+			Str("event", "authorized_state_cancelled").
+			Str("client_ip", client).
+			Str("lmk_id", lmkID).
+			Msg("authorized state cancelled")
+
+		return []byte(respCode + errorcodes.Err00.CodeOnly())
+	}
+
+	until, err := gate.Enter(lmkID, data[4:], time.Now())
+	if err != nil {
+		log.Warn().
+			Str("event", "authorized_state_refused").
+			Str("client_ip", client).
+			Str("lmk_id", lmkID).
+			Err(err).
+			Msg("refusing to enter authorized state")
+
+		return []byte(respCode + errorcodes.Err17.CodeOnly())
+	}
+	s.recordAudit(audit.EventAuthorizationState, map[string]string{
+		"operation": "enter",
+		"client_ip": client,
+		"lmk_id":    lmkID,
+		"until":     until.UTC().Format(time.RFC3339),
+	})
+	log.Info().
+		Str("event", "authorized_state_entered").
+		Str("client_ip", client).
+		Str("lmk_id", lmkID).
+		Time("until", until).
+		Msg("authorized state entered")
+
+	return []byte(respCode + errorcodes.Err00.CodeOnly() + until.UTC().Format("20060102150405"))
+}
+
+// recordAudit records event in the audit log. The response is already decided, so a failure
+// to record is logged rather than returned.
+func (s *Server) recordAudit(event string, fields map[string]string) {
+	if err := s.auditLog.Load().Record(event, fields); err != nil {
+		log.Error().Str("event", "audit_log_error").Str("audit_event", event).Err(err).Msg("failed to record audit event")
+	}
+}
+
+// applyDiagnostics strips or exposes the diagnostic detail appended by plugins to error
+// responses. Success responses are returned as they are.
+func (s *Server) applyDiagnostics(resp []byte) []byte {
+	resp, detail, ok := errorcodes.SplitDetail(resp)
+	if !ok || !s.diagnostics.Load() {
+		return resp
+	}
+
+	out := make([]byte, 0, len(resp)+len(errorcodes.DiagnosticFieldTag)+len(detail))
+	out = append(out, resp...)
+	out = append(out, errorcodes.DiagnosticFieldTag...)
+
+	return append(out, detail...)
+}
+
 // incrementCode returns the next command code by incrementing the second character.
 func (s *Server) incrementCode(cmd string) string {
 	b := []byte(cmd)
@@ -130,9 +436,54 @@ func (s *Server) errorResponse(cmd string) []byte {
 	return []byte(s.incrementCode(cmd) + errorcodes.Err68.CodeOnly())
 }
 
-// Enhanced error handling and logging for unknown commands and errors.
-func (s *Server) handle(conn *anetserver.ServerConn, data []byte) ([]byte, error) {
-	client := conn.Conn.RemoteAddr().String()
+// handle serves a request received over TCP on p, or on the main address when p is nil,
+// closing the connection when process asks to.
+func (s *Server) handle(p *port, conn *anetserver.ServerConn, data []byte) ([]byte, error) {
+	resp, closeConn, err := s.serve(p, conn.Conn.RemoteAddr().String(), data)
+	if closeConn {
+		_ = conn.Conn.Close()
+	}
+
+	return resp, err
+}
+
+// process executes a request from client received on p, or on the main address when p is
+// nil, and returns the response. closeConn reports that the connection must be closed without
+// a response. Unknown commands and plugin errors are answered with error code 68, and health
+// checks are answered before any other processing.
+func (s *Server) process(p *port, client string, data []byte) (resp []byte, closeConn bool, err error) {
+	if health := s.healthResponse(data); health != nil {
+		return health, false, nil
+	}
+
+	limiter := s.rateLimits.Load()
+	release, reason := limiter.Acquire(client)
+	if reason != "" && len(data) >= 2 {
+		log.Warn().
+			Str("event", "rate_limited").
+			Str("client_ip", client).
+			Str("command", string(data[:2])).
+			Str("reason", reason).
+			Msg("refusing command above the client limits")
+
+		return []byte(s.incrementCode(string(data[:2])) + limiter.ErrorCode()), false, nil
+	}
+	if release != nil {
+		defer release()
+	}
+
+	if refused := p.refusedResponse(s, client, data); refused != nil {
+		return refused, false, nil
+	}
+
+	if reset := s.pinTriesResetResponse(client, data); reset != nil {
+		return reset, false, nil
+	}
+
+	if auth := s.authorizationResponse(client, data); auth != nil {
+		return auth, false, nil
+	}
+
 	atomic.AddInt32(&s.activeConns, 1)
 	defer atomic.AddInt32(&s.activeConns, -1)
 
@@ -148,15 +499,104 @@ func (s *Server) handle(conn *anetserver.ServerConn, data []byte) ([]byte, error
 	if len(data) < 2 {
 		log.Error().Str("client_ip", client).Str("request_id", requestID).Msg("malformed request")
 
-		return nil, errors.New("malformed request")
+		// there is no command code to answer with, so close the connection.
+		return nil, true, errors.New("malformed request")
 	}
 
 	cmd := string(data[:2])
-	origPayload := data[2:]
+	origPayload := p.bind(cmd, data[2:])
+
+	sample := s.profiler.Load().Start(cmd)
+	defer sample.Finish()
+
+	if limit := s.maxMessageSize.Load(); limit > 0 && int64(len(data)) > limit {
+		log.Warn().
+			Str("event", "message_too_large").
+			Str("client_ip", client).
+			Str("command", cmd).
+			Str("request_id", requestID).
+			Int("size", len(data)).
+			Int64("limit", limit).
+			Msg("rejecting command above the maximum message size")
+
+		return []byte(s.incrementCode(cmd) + errorcodes.Err80.CodeOnly()), false, nil
+	}
+
+	fault := s.faults.Load().Decide(cmd)
+	if fault.Delay > 0 {
+		time.Sleep(fault.Delay)
+	}
+	if fault.Drop {
+		log.Warn().
+			Str("event", "fault_injected").
+			Str("client_ip", client).
+			Str("command", cmd).
+			Str("request_id", requestID).
+			Msg("dropping connection")
+
+		return nil, true, nil
+	}
+	if fault.ErrorCode != "" {
+		log.Warn().
+			Str("event", "fault_injected").
+			Str("client_ip", client).
+			Str("command", cmd).
+			Str("request_id", requestID).
+			Str("error_code", fault.ErrorCode).
+			Msg("injecting error response")
+
+		return []byte(s.incrementCode(cmd) + fault.ErrorCode), false, nil
+	}
+	authorization := s.authorization.Load()
+	if lmkID := logic.RequestLMKID(origPayload); authorization.Refuses(cmd, lmkID, time.Now()) {
+		log.Warn().
+			Str("event", "not_authorized").
+			Str("client_ip", client).
+			Str("command", cmd).
+			Str("request_id", requestID).
+			Str("lmk_id", lmkID).
+			Msg("refusing command for an LMK outside the authorized state")
+
+		return []byte(s.incrementCode(cmd) + errorcodes.Err17.CodeOnly()), false, nil
+	} else if authorization.Gates(cmd) {
+		s.recordAudit(audit.EventAuthorizedCommand, map[string]string{
+			"command":    cmd,
+			"client_ip":  client,
+			"request_id": requestID,
+			"lmk_id":     lmkID,
+		})
+	}
+	if violation, refused := s.pciPolicy.Load().Check(cmd, origPayload); refused {
+		log.Warn().
+			Str("event", "pci_policy_violation").
+			Str("client_ip", client).
+			Str("command", cmd).
+			Str("request_id", requestID).
+			Str("check", violation.Check).
+			Str("error_code", violation.Code).
+			Msg("refusing operation disallowed in PCI-HSM mode")
+
+		return []byte(s.incrementCode(cmd) + violation.Code), false, nil
+	}
+	tracker := s.pinTries.Load()
+	account, verifiesPIN := "", false
+	if tracker.Tracks(cmd) {
+		account, verifiesPIN = logic.PINVerificationAccount(cmd, origPayload)
+	}
+	if verifiesPIN {
+		if code := tracker.Blocked(cmd, account); code != "" {
+			log.Warn().
+				Str("event", "pin_tries_exceeded").
+				Str("client_ip", client).
+				Str("command", cmd).
+				Str("request_id", requestID).
+				Msg("refusing PIN verification of a blocked account")
+
+			return []byte(s.incrementCode(cmd) + code), false, nil
+		}
+	}
 	// skip separate request log in non-debug mode, will log processed result later.
 
-	// handle built-in A0 encryption under LMK.
-	var resp []byte
 	var execErr error
 
 	pm, ok := s.pluginManagerHolder.Load().(*plugins.PluginManager)
@@ -166,16 +606,18 @@ func (s *Server) handle(conn *anetserver.ServerConn, data []byte) ([]byte, error
 			Str("request_id", requestID).
 			Msg("failed to load plugin manager")
 
-		return nil, errors.New("plugin manager load failed")
+		return nil, false, errors.New("plugin manager load failed")
 	}
 
 	execPayload := origPayload
 	if cmd == "NC" {
-		execPayload = []byte(s.hsmSvc.FirmwareVersion)
+		// NC reports the firmware version and the check value of the LMK of the request.
+		execPayload = logic.NCPayload(s.hsmSvc.FirmwareVersion, origPayload)
 	}
 
 	// Pass requestID via context for plugin and plugin logs
 	ctx := context.WithValue(srvContextOrDefault(s), requestIDKey, requestID)
+	ctx = profiling.WithSample(ctx, sample)
 	resp, execErr = pm.ExecuteCommandWithContext(ctx, cmd, execPayload)
 	if execErr != nil {
 		log.Error().
@@ -187,7 +629,25 @@ func (s *Server) handle(conn *anetserver.ServerConn, data []byte) ([]byte, error
 	}
 
 	if execErr != nil {
-		if execErr.Error() == "unknown command" {
+		if errors.Is(execErr, plugins.ErrPoolExhausted) {
+			// a busy plugin is a transient condition, answered as rate limited commands are.
+			resp = []byte(s.incrementCode(cmd) + ratelimit.DefaultErrorCode)
+			log.Warn().
+				Str("event", "plugin_pool_exhausted").
+				Str("client_ip", client).
+				Str("command", cmd).
+				Str("request_id", requestID).
+				Msg("no plugin instance available, responding with error code")
+		} else if code, ok := pm.LimitErrorCode(execErr); ok {
+			resp = []byte(s.incrementCode(cmd) + code)
+			log.Warn().
+				Str("event", "plugin_limit_exceeded").
+				Str("client_ip", client).
+				Str("command", cmd).
+				Str("request_id", requestID).
+				Err(execErr).
+				Msg("plugin exceeded a resource limit, responding with error code")
+		} else if execErr.Error() == "unknown command" {
 			resp = s.errorResponse(cmd)
 			log.Warn().
 				Str("event", "unknown_command").
@@ -205,6 +665,36 @@ func (s *Server) handle(conn *anetserver.ServerConn, data []byte) ([]byte, error
 		}
 	}
 
+	if verifiesPIN && execErr == nil && len(resp) >= 4 {
+		tracker.Record(cmd, account, string(resp[2:4]))
+	}
+	if counters := s.dukptCounters.Load(); counters != nil && execErr == nil && len(resp) >= 4 &&
+		string(resp[2:4]) == errorcodes.Err00.CodeOnly() {
+		if device, counter, ok := logic.DUKPTTransaction(cmd, origPayload); ok {
+			counters.Advance(DUKPTCounterPrefix+device, uint64(counter))
+		}
+	}
+	if event, ok := audit.HostCommandEvents[cmd]; ok && execErr == nil && len(resp) >= 4 &&
+		string(resp[2:4]) == errorcodes.Err00.CodeOnly() {
+		s.recordAudit(event, map[string]string{
+			"command":    cmd,
+			"client_ip":  client,
+			"request_id": requestID,
+			"lmk_id":     logic.RequestLMKID(origPayload),
+		})
+	}
+
+	resp = s.applyDiagnostics(resp)
+	if fault.Truncate {
+		log.Warn().
+			Str("event", "fault_injected").
+			Str("client_ip", client).
+			Str("command", cmd).
+			Str("request_id", requestID).
+			Msg("truncating response")
+		resp = faults.Truncate(resp)
+	}
+
 	// unified processed log with duration and error status
 	duration := time.Since(start)
 	reqStr := common.FormatData(data)
@@ -232,7 +722,7 @@ func (s *Server) handle(conn *anetserver.ServerConn, data []byte) ([]byte, error
 			Msg("command processed")
 	}
 
-	return resp, nil
+	return resp, false, nil
 }
 
 func srvContextOrDefault(_ *Server) context.Context {
@@ -0,0 +1,340 @@
+package server_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andrei-cloud/anet"
+	"github.com/andrei-cloud/go_hsm/internal/audit"
+	"github.com/andrei-cloud/go_hsm/internal/authstate"
+	"github.com/andrei-cloud/go_hsm/internal/pcipolicy"
+	"github.com/andrei-cloud/go_hsm/internal/pintries"
+	"github.com/andrei-cloud/go_hsm/internal/profiling"
+	"github.com/andrei-cloud/go_hsm/internal/ratelimit"
+)
+
+// TestHealthCommand verifies that the health check is answered by the server core and that
+// clearing it routes the code back to plugin lookup.
+func TestHealthCommand(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		health string
+		want   string
+	}{
+		{"enabled", "HZ", "0001HA00"},
+		{"other code", "HC", "0001HA68"},
+		{"disabled", "", "0001HA68"},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			srv := newStreamServer(t)
+			srv.SetHealthCommand("HZ")
+			srv.SetHealthCommand(tc.health)
+
+			var in, out bytes.Buffer
+			frame(t, &in, "0001", "HZ")
+			if err := srv.ServeStream(&in, &out); err != nil {
+				t.Fatalf("ServeStream() error = %v", err)
+			}
+			got, err := anet.Read(&out)
+			if err != nil {
+				t.Fatalf("failed to read response: %v", err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("response = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestMaxMessageSize verifies that commands above the limit are rejected with error 80.
+func TestMaxMessageSize(t *testing.T) {
+	t.Parallel()
+
+	srv := newStreamServer(t)
+	srv.SetMaxMessageSize(8)
+
+	var in, out bytes.Buffer
+	frame(t, &in, "0001", "NC")
+	frame(t, &in, "0002", "M6"+strings.Repeat("0", 7))
+	if err := srv.ServeStream(&in, &out); err != nil {
+		t.Fatalf("ServeStream() error = %v", err)
+	}
+	for _, want := range []string{"0001ND68", "0002M780"} {
+		got, err := anet.Read(&out)
+		if err != nil {
+			t.Fatalf("failed to read response: %v", err)
+		}
+		if string(got) != want {
+			t.Errorf("response = %q, want %q", got, want)
+		}
+	}
+}
+
+// TestProfiler verifies that processed commands are recorded by an installed profiler.
+func TestProfiler(t *testing.T) {
+	t.Parallel()
+
+	srv := newStreamServer(t)
+	profiler := profiling.New()
+	srv.SetProfiler(profiler)
+	srv.SetHealthCommand("HZ")
+
+	var in, out bytes.Buffer
+	frame(t, &in, "0001", "NC")
+	frame(t, &in, "0002", "NC")
+	frame(t, &in, "0003", "HZ")
+	if err := srv.ServeStream(&in, &out); err != nil {
+		t.Fatalf("ServeStream() error = %v", err)
+	}
+
+	stats := profiler.Snapshot()
+	if len(stats) != 1 || stats[0].Command != "NC" || stats[0].Count != 2 {
+		t.Fatalf("profile = %+v, want two NC requests", stats)
+	}
+	if stats[0].Total <= 0 || stats[0].Overhead <= 0 {
+		t.Errorf("profile durations = %+v", stats[0])
+	}
+}
+
+// TestPINTries verifies that verifications of a blocked account are refused until the
+// counter is reset with the reset command.
+func TestPINTries(t *testing.T) {
+	t.Parallel()
+
+	const account = "000123456789"
+	tracker, err := pintries.New([]pintries.Rule{{Command: "DC", MaxTries: 1}}, "", nil)
+	if err != nil {
+		t.Fatalf("pintries.New() error = %v", err)
+	}
+	tracker.Record("DC", account, "01")
+
+	srv := newStreamServer(t)
+	srv.SetPINTries(tracker)
+	srv.SetPINTriesResetCommand("PZ")
+
+	dc := "DC" + "U" + strings.Repeat("0", 32) + "U" + strings.Repeat("1", 32) +
+		strings.Repeat("A", 16) + "01" + account + "1" + "1234"
+	var in, out bytes.Buffer
+	frame(t, &in, "0001", dc)
+	frame(t, &in, "0002", "PZ1234")
+	frame(t, &in, "0003", "PZ"+account)
+	// Without plugins the unblocked command is unknown.
+	frame(t, &in, "0004", dc)
+	if err := srv.ServeStream(&in, &out); err != nil {
+		t.Fatalf("ServeStream() error = %v", err)
+	}
+	for _, want := range []string{"0001DD39", "0002PA15", "0003PA00", "0004DD68"} {
+		got, err := anet.Read(&out)
+		if err != nil {
+			t.Fatalf("failed to read response: %v", err)
+		}
+		if string(got) != want {
+			t.Errorf("response = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestPCIPolicy(t *testing.T) {
+	t.Parallel()
+
+	policy, err := pcipolicy.New(pcipolicy.Rules{}, func(id string) bool { return id == "00" })
+	if err != nil {
+		t.Fatalf("pcipolicy.New() error = %v", err)
+	}
+	srv := newStreamServer(t)
+	srv.SetPCIPolicy(policy)
+
+	ca := "CA" + "U" + strings.Repeat("0", 32) + "U" + strings.Repeat("1", 32)
+	var in, out bytes.Buffer
+	frame(t, &in, "0001", ca)
+	// Requests for an LMK outside PCI-HSM mode are executed; without plugins the command
+	// is unknown.
+	frame(t, &in, "0002", ca+"%01")
+	if err := srv.ServeStream(&in, &out); err != nil {
+		t.Fatalf("ServeStream() error = %v", err)
+	}
+	for _, want := range []string{"0001CB28", "0002CB68"} {
+		got, err := anet.Read(&out)
+		if err != nil {
+			t.Fatalf("failed to read response: %v", err)
+		}
+		if string(got) != want {
+			t.Errorf("response = %q, want %q", got, want)
+		}
+	}
+}
+
+// TestAuthorization verifies that gated commands are refused with error 17 for LMKs outside
+// the authorized state, and that the state is entered and cancelled per LMK by host command.
+func TestAuthorization(t *testing.T) {
+	t.Parallel()
+
+	gate, err := authstate.NewHost(authstate.HostRules{
+		Password:      "secret",
+		EnterCommand:  "RA",
+		CancelCommand: "RC",
+	}, authstate.NewState())
+	if err != nil {
+		t.Fatalf("authstate.NewHost() error = %v", err)
+	}
+	srv := newStreamServer(t)
+	srv.SetAuthorization(gate)
+
+	a8 := "A8" + "000" + "U" + strings.Repeat("0", 32) + "U" + strings.Repeat("1", 32) + "U"
+	var in, out bytes.Buffer
+	frame(t, &in, "0001", a8)
+	frame(t, &in, "0002", "RA00wrong")
+	frame(t, &in, "0003", "RA99secret")
+	frame(t, &in, "0004", "RA00secret")
+	// Without plugins the command is unknown once authorized.
+	frame(t, &in, "0005", a8)
+	frame(t, &in, "0006", a8+"%01")
+	frame(t, &in, "0007", "RC00")
+	frame(t, &in, "0008", a8)
+	if err := srv.ServeStream(&in, &out); err != nil {
+		t.Fatalf("ServeStream() error = %v", err)
+	}
+	for _, want := range []string{
+		"0001A917", "0002RB17", "0003RB13", "0004RB00", "0005A968", "0006A917", "0007RD00", "0008A917",
+	} {
+		got, err := anet.Read(&out)
+		if err != nil {
+			t.Fatalf("failed to read response: %v", err)
+		}
+		if want == "0004RB00" {
+			if len(got) != len(want)+14 {
+				t.Errorf("response = %q, want %q and the deadline", got, want)
+			}
+			got = got[:len(want)]
+		}
+		if string(got) != want {
+			t.Errorf("response = %q, want %q", got, want)
+		}
+	}
+}
+
+// TestAuditLog verifies that authorized state changes and the commands executed in the
+// authorized state are chained in the audit log.
+func TestAuditLog(t *testing.T) {
+	t.Parallel()
+
+	gate, err := authstate.NewHost(authstate.HostRules{
+		Password:      "secret",
+		EnterCommand:  "RA",
+		CancelCommand: "RC",
+	}, authstate.NewState())
+	if err != nil {
+		t.Fatalf("authstate.NewHost() error = %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLog, err := audit.Open(path)
+	if err != nil {
+		t.Fatalf("audit.Open() error = %v", err)
+	}
+	t.Cleanup(func() { _ = auditLog.Close() })
+	srv := newStreamServer(t)
+	srv.SetAuthorization(gate)
+	srv.SetAuditLog(auditLog)
+
+	var in, out bytes.Buffer
+	frame(t, &in, "0001", "RA00wrong")
+	frame(t, &in, "0002", "RA00secret")
+	frame(t, &in, "0003", "A8"+"000"+"U"+strings.Repeat("0", 32)+"U"+strings.Repeat("1", 32)+"U")
+	frame(t, &in, "0004", "RC00")
+	if err := srv.ServeStream(&in, &out); err != nil {
+		t.Fatalf("ServeStream() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if n, err := audit.Verify(bytes.NewReader(data)); err != nil || n != 3 {
+		t.Fatalf("audit.Verify() = %d, %v, want 3 records", n, err)
+	}
+	if got := strings.Count(string(data), audit.EventAuthorizationState); got != 2 {
+		t.Errorf("audit log has %d authorization records, want 2", got)
+	}
+	if !strings.Contains(string(data), `"event":"`+audit.EventAuthorizedCommand+`","user"`) {
+		t.Errorf("audit log lacks the A8 command executed in authorized state:\n%s", data)
+	}
+}
+
+// TestRateLimits verifies that the commands of a client above its rate are refused, and
+// that health checks are not limited.
+func TestRateLimits(t *testing.T) {
+	t.Parallel()
+
+	limiter, err := ratelimit.New(ratelimit.Limits{Rate: 0.001, Burst: 1})
+	if err != nil {
+		t.Fatalf("ratelimit.New() error = %v", err)
+	}
+	srv := newStreamServer(t)
+	srv.SetHealthCommand("HZ")
+	srv.SetRateLimits(limiter)
+
+	var in, out bytes.Buffer
+	frame(t, &in, "0001", "NC")
+	frame(t, &in, "0002", "NC")
+	frame(t, &in, "0003", "HZ")
+	if err := srv.ServeStream(&in, &out); err != nil {
+		t.Fatalf("ServeStream() error = %v", err)
+	}
+	for _, want := range []string{"0001ND68", "0002ND16", "0003HA00"} {
+		got, err := anet.Read(&out)
+		if err != nil {
+			t.Fatalf("failed to read response: %v", err)
+		}
+		if string(got) != want {
+			t.Errorf("response = %q, want %q", got, want)
+		}
+	}
+	if stats := limiter.Stats(); stats.Allowed != 1 || stats.RateLimited != 1 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+}
+
+// TestHeaderAndTrailer verifies that a longer message header and a message trailer are
+// echoed around the response, as in the payShield message format.
+func TestHeaderAndTrailer(t *testing.T) {
+	t.Parallel()
+
+	srv := newStreamServer(t)
+	srv.SetHealthCommand("HZ")
+	if err := srv.SetHeaderLength(6); err != nil {
+		t.Fatalf("SetHeaderLength() error = %v", err)
+	}
+	srv.SetTrailer(true)
+
+	var in, out bytes.Buffer
+	frame(t, &in, "0001", "ABHZ")
+	frame(t, &in, "0002", "CDHZ\x19TRAILER")
+	frame(t, &in, "0003", "EFNC")
+	if err := srv.ServeStream(&in, &out); err != nil {
+		t.Fatalf("ServeStream() error = %v", err)
+	}
+	for _, want := range []string{"0001ABHA00", "0002CDHA00\x19TRAILER", "0003EFND68"} {
+		got, err := anet.Read(&out)
+		if err != nil {
+			t.Fatalf("failed to read response: %v", err)
+		}
+		if string(got) != want {
+			t.Errorf("response = %q, want %q", got, want)
+		}
+	}
+
+	for _, n := range []int{3, 256} {
+		if err := srv.SetHeaderLength(n); err == nil {
+			t.Errorf("SetHeaderLength(%d) accepted", n)
+		}
+	}
+}
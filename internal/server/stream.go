@@ -0,0 +1,65 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/andrei-cloud/anet"
+	"github.com/andrei-cloud/go_hsm/internal/plugins"
+	"github.com/rs/zerolog/log"
+)
+
+// streamClient identifies the peer of a stream in logs.
+const streamClient = "stdio"
+
+// taskIDSize is the length of the task ID that prefixes every framed request and response.
+const taskIDSize = 4
+
+// NewStreamServer returns a Server that processes requests read from a stream with
+// ServeStream instead of listening on TCP.
+func NewStreamServer(pm *plugins.PluginManager) *Server {
+	s := &Server{
+		address:       streamClient,
+		pluginManager: pm,
+		hsmSvc:        pm.HSM(),
+	}
+	s.pluginManagerHolder.Store(pm)
+
+	return s
+}
+
+// ServeStream reads length-framed requests from r and writes the responses to w, one at a
+// time, using the same framing as the TCP server: a 2-byte big-endian length followed by
+// a 4-byte task ID and the command. It returns nil when r reaches EOF between frames, and
+// an error for truncated or malformed frames or when a response cannot be written.
+func (s *Server) ServeStream(r io.Reader, w io.Writer) error {
+	log.Info().Msg("serving requests on stdin/stdout")
+	for {
+		frame, err := anet.Read(r)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read request: %w", err)
+		}
+		if len(frame) < taskIDSize {
+			return fmt.Errorf("frame of %d bytes is shorter than the task ID", len(frame))
+		}
+
+		resp, closeConn, err := s.serve(nil, streamClient, frame[taskIDSize:])
+		if err != nil {
+			return err
+		}
+		if closeConn {
+			// a dropped connection ends the stream without a response.
+			return nil
+		}
+
+		out := make([]byte, 0, taskIDSize+len(resp))
+		out = append(append(out, frame[:taskIDSize]...), resp...)
+		if err := anet.Write(w, out); err != nil {
+			return fmt.Errorf("write response: %w", err)
+		}
+	}
+}
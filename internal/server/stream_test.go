@@ -0,0 +1,86 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/andrei-cloud/anet"
+	"github.com/andrei-cloud/go_hsm/internal/hsm"
+	"github.com/andrei-cloud/go_hsm/internal/plugins"
+	"github.com/andrei-cloud/go_hsm/internal/server"
+)
+
+func newStreamServer(t *testing.T) *server.Server {
+	t.Helper()
+
+	h, err := hsm.NewHSM(hsm.FirmwareVersion, false)
+	if err != nil {
+		t.Fatalf("failed to create hsm: %v", err)
+	}
+
+	return server.NewStreamServer(plugins.NewPluginManager(context.Background(), h))
+}
+
+func frame(t *testing.T, buf *bytes.Buffer, taskID, payload string) {
+	t.Helper()
+
+	if err := anet.Write(buf, []byte(taskID+payload)); err != nil {
+		t.Fatalf("failed to frame request: %v", err)
+	}
+}
+
+// TestServeStream verifies that framed requests are answered in order with their task IDs.
+func TestServeStream(t *testing.T) {
+	t.Parallel()
+
+	var in, out bytes.Buffer
+	frame(t, &in, "0001", "ZZ")
+	frame(t, &in, "0002", "NC")
+
+	if err := newStreamServer(t).ServeStream(&in, &out); err != nil {
+		t.Fatalf("ServeStream() error = %v", err)
+	}
+
+	for _, want := range []string{"0001ZA68", "0002ND68"} {
+		got, err := anet.Read(&out)
+		if err != nil {
+			t.Fatalf("failed to read response: %v", err)
+		}
+		if string(got) != want {
+			t.Errorf("response = %q, want %q", got, want)
+		}
+	}
+	if out.Len() != 0 {
+		t.Errorf("unexpected trailing output %X", out.Bytes())
+	}
+}
+
+// TestServeStreamMalformed verifies that truncated and malformed frames end the stream.
+func TestServeStreamMalformed(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		in   []byte
+	}{
+		{"truncated length", []byte{0x00}},
+		{"truncated payload", []byte{0x00, 0x08, '0', '0'}},
+		{"missing task ID", []byte{0x00, 0x02, 'N', 'C'}},
+		{"missing command", []byte{0x00, 0x05, '0', '0', '0', '1', 'N'}},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var out bytes.Buffer
+			if err := newStreamServer(t).ServeStream(bytes.NewReader(tc.in), &out); err == nil {
+				t.Error("ServeStream() error = nil, want error")
+			}
+			if out.Len() != 0 {
+				t.Errorf("unexpected output %X", out.Bytes())
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	anetserver "github.com/andrei-cloud/anet/server"
+	"github.com/andrei-cloud/go_hsm/internal/hsm"
+	"github.com/andrei-cloud/go_hsm/internal/plugins"
+)
+
+// TestUDPInFlightLimit verifies that datagrams arriving while MaxConns requests are in
+// flight are dropped, and that datagrams are answered again once a request completes.
+func TestUDPInFlightLimit(t *testing.T) {
+	t.Parallel()
+
+	h, err := hsm.NewHSM(hsm.FirmwareVersion, false)
+	if err != nil {
+		t.Fatalf("failed to create hsm: %v", err)
+	}
+	s := NewStreamServer(plugins.NewPluginManager(context.Background(), h))
+	s.srvConfig = &anetserver.ServerConfig{MaxConns: 1}
+
+	p := &port{Listener: Listener{Address: "127.0.0.1:0", Network: NetworkUDP}}
+	if err := p.start(s); err != nil {
+		t.Fatalf("start() error = %v", err)
+	}
+	defer p.stop()
+
+	conn, err := net.Dial("udp", p.udp.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	// Hold the only slot, as a request in flight would.
+	p.inFlight <- struct{}{}
+	if _, err := conn.Write([]byte("0001NC")); err != nil {
+		t.Fatalf("failed to send datagram: %v", err)
+	}
+	buf := make([]byte, 1024)
+	_ = conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if n, err := conn.Read(buf); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Read() = %q, %v, want the datagram dropped", buf[:n], err)
+	}
+
+	<-p.inFlight
+	if _, err := conn.Write([]byte("0002NC")); err != nil {
+		t.Fatalf("failed to send datagram: %v", err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("failed to read datagram: %v", err)
+	}
+	if got := string(buf[:n]); got != "0002ND68" {
+		t.Errorf("response = %q, want %q", got, "0002ND68")
+	}
+}
@@ -0,0 +1,280 @@
+// Package soak runs a command mix against the plugin runtime for a long period and tracks
+// its memory use. Every interval it logs the WASM linear memory of each plugin instance
+// pool, the host buffer pool and the Go heap and GC metrics, and it fails when memory grows
+// beyond a threshold over the baseline taken after warm-up, to expose slow leaks in
+// instance pooling.
+package soak
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/andrei-cloud/go_hsm/internal/plugins"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Errors returned by Run and ParseOp.
+var (
+	ErrMemoryGrowth   = errors.New("memory grew beyond threshold")
+	ErrUnknownCommand = errors.New("command not loaded")
+	ErrInvalidOp      = errors.New("invalid command mix entry")
+)
+
+// Target executes commands and reports the memory held by its plugin runtime.
+// *plugins.PluginManager implements it.
+type Target interface {
+	ExecuteCommand(cmd string, input []byte) ([]byte, error)
+	Stats() plugins.RuntimeStats
+}
+
+// Op is a command of the mix with its payload and relative weight.
+type Op struct {
+	Command string
+	Payload []byte
+	Weight  int
+}
+
+// DefaultMix exercises key generation and the status command, which need no keys.
+func DefaultMix() []Op {
+	return []Op{
+		{Command: "NC", Weight: 1},
+		{Command: "A0", Payload: []byte("0002U"), Weight: 2},
+		{Command: "A0", Payload: []byte("0001T"), Weight: 1},
+	}
+}
+
+// ParseOp parses a mix entry of the form [weight*]CODE[:payload], for example "3*NC" or
+// "A0:0002U". The payload is sent as is.
+func ParseOp(s string) (Op, error) {
+	op := Op{Weight: 1}
+	if w, rest, ok := strings.Cut(s, "*"); ok {
+		if n, err := strconv.Atoi(w); err == nil {
+			if n < 1 {
+				return Op{}, fmt.Errorf("%w %q: weight must be positive", ErrInvalidOp, s)
+			}
+			op.Weight = n
+			s = rest
+		}
+	}
+
+	code, payload, _ := strings.Cut(s, ":")
+	if len(code) != 2 {
+		return Op{}, fmt.Errorf("%w %q: command code must be 2 characters", ErrInvalidOp, s)
+	}
+	op.Command = code
+	op.Payload = []byte(payload)
+
+	return op, nil
+}
+
+// Config controls a soak run.
+type Config struct {
+	// Mix is the command mix; DefaultMix is used when it is empty.
+	Mix []Op
+	// Duration is the length of the run.
+	Duration time.Duration
+	// Interval is the time between memory samples.
+	Interval time.Duration
+	// Warmup is the time before the baseline sample, letting pools reach their working size.
+	Warmup time.Duration
+	// Workers is the number of concurrent clients.
+	Workers int
+	// MaxGrowth is the allowed growth in bytes of WASM plus Go heap memory over the
+	// baseline; 0 disables the check.
+	MaxGrowth uint64
+}
+
+// Sample is a memory measurement taken during a run.
+type Sample struct {
+	Elapsed  time.Duration
+	Requests uint64
+	Errors   uint64
+	Runtime  plugins.RuntimeStats
+
+	HeapAlloc    uint64
+	HeapInuse    uint64
+	Sys          uint64
+	NumGC        uint32
+	GCPauseTotal time.Duration
+	Goroutines   int
+}
+
+// Memory returns the memory the growth threshold applies to: the WASM linear memory of all
+// plugin instances plus the Go heap in use.
+func (s Sample) Memory() uint64 {
+	return s.Runtime.WASMMemoryBytes() + s.HeapInuse
+}
+
+// Report summarizes a soak run.
+type Report struct {
+	Baseline Sample
+	Samples  []Sample
+	// Peak is the highest Memory of any sample.
+	Peak uint64
+}
+
+// Growth returns the memory growth of the last sample over the baseline.
+func (r Report) Growth() int64 {
+	if len(r.Samples) == 0 {
+		return 0
+	}
+
+	return int64(r.Samples[len(r.Samples)-1].Memory()) - int64(r.Baseline.Memory())
+}
+
+// counters are shared by the workers.
+type counters struct {
+	requests atomic.Uint64
+	errors   atomic.Uint64
+}
+
+// Run executes cfg.Mix against target with cfg.Workers clients until cfg.Duration elapses
+// or ctx is done, sampling memory every cfg.Interval. It returns an error wrapping
+// ErrMemoryGrowth as soon as a sample exceeds the baseline by more than cfg.MaxGrowth.
+func Run(ctx context.Context, target Target, cfg Config) (Report, error) {
+	var report Report
+
+	if len(cfg.Mix) == 0 {
+		cfg.Mix = DefaultMix()
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Minute
+	}
+
+	loaded := target.Stats().Pools
+	var schedule []Op
+	for _, op := range cfg.Mix {
+		if _, ok := loaded[op.Command]; !ok {
+			return report, fmt.Errorf("%w: %s", ErrUnknownCommand, op.Command)
+		}
+		for range max(op.Weight, 1) {
+			schedule = append(schedule, op)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.Duration)
+	var c counters
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	var next atomic.Uint64
+	for range cfg.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				op := schedule[(next.Add(1)-1)%uint64(len(schedule))]
+				if _, err := target.ExecuteCommand(op.Command, op.Payload); err != nil {
+					c.errors.Add(1)
+				}
+				c.requests.Add(1)
+			}
+		}()
+	}
+
+	start := time.Now()
+	warmup := time.NewTimer(cfg.Warmup)
+	defer warmup.Stop()
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	baselined := false
+	for {
+		select {
+		case <-warmup.C:
+			report.Baseline = sample(target, &c, start)
+			baselined = true
+			logSample("soak baseline", report.Baseline)
+
+			continue
+		case <-ticker.C:
+		case <-ctx.Done():
+		}
+
+		s := sample(target, &c, start)
+		report.Samples = append(report.Samples, s)
+		report.Peak = max(report.Peak, s.Memory())
+		logSample("soak sample", s)
+
+		if baselined && cfg.MaxGrowth > 0 && s.Memory() > report.Baseline.Memory()+cfg.MaxGrowth {
+			return report, fmt.Errorf("%w: %d bytes over baseline after %s (threshold %d)",
+				ErrMemoryGrowth, s.Memory()-report.Baseline.Memory(),
+				s.Elapsed.Round(time.Second), cfg.MaxGrowth)
+		}
+		if ctx.Err() != nil {
+			return report, nil
+		}
+	}
+}
+
+// sample collects the runtime stats after a garbage collection, so the heap figures
+// reflect live memory rather than garbage awaiting collection.
+func sample(target Target, c *counters, start time.Time) Sample {
+	runtime.GC()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	return Sample{
+		Elapsed:      time.Since(start),
+		Requests:     c.requests.Load(),
+		Errors:       c.errors.Load(),
+		Runtime:      target.Stats(),
+		HeapAlloc:    ms.HeapAlloc,
+		HeapInuse:    ms.HeapInuse,
+		Sys:          ms.Sys,
+		NumGC:        ms.NumGC,
+		GCPauseTotal: time.Duration(ms.PauseTotalNs),
+		Goroutines:   runtime.NumGoroutine(),
+	}
+}
+
+// logSample logs a sample with the memory of each plugin pool.
+func logSample(msg string, s Sample) {
+	pools := zerolog.Dict()
+	for cmd, p := range s.Runtime.Pools {
+		pools.Dict(cmd, zerolog.Dict().
+			Int("instances", p.Instances).
+			Int("idle", p.Idle).
+			Uint64("created", p.Created).
+			Uint64("dropped", p.Dropped).
+			Uint64("waited", p.Waited).
+			Uint64("timed_out", p.TimedOut).
+			Uint64("memory_bytes", p.MemoryBytes))
+	}
+	b := s.Runtime.Buffers
+
+	log.Info().
+		Str("event", "soak_sample").
+		Dur("elapsed", s.Elapsed).
+		Uint64("requests", s.Requests).
+		Uint64("errors", s.Errors).
+		Uint64("wasm_bytes", s.Runtime.WASMMemoryBytes()).
+		Dict("pools", pools).
+		Dict("buffers", zerolog.Dict().
+			Uint64("gets", b.Gets).
+			Uint64("puts", b.Puts).
+			Uint64("allocs", b.Allocs).
+			Uint64("oversized", b.Oversized).
+			Uint64("ringed_bytes", b.RingedBytes)).
+		Uint64("heap_alloc", s.HeapAlloc).
+		Uint64("heap_inuse", s.HeapInuse).
+		Uint64("sys", s.Sys).
+		Uint32("num_gc", s.NumGC).
+		Dur("gc_pause_total", s.GCPauseTotal).
+		Int("goroutines", s.Goroutines).
+		Msg(msg)
+}
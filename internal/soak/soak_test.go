@@ -0,0 +1,133 @@
+package soak
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andrei-cloud/go_hsm/internal/plugins"
+)
+
+// fakeTarget serves every command of its pool list and grows the memory of the A0 pool by
+// leak bytes per request.
+type fakeTarget struct {
+	mu       sync.Mutex
+	leak     uint64
+	memory   uint64
+	commands map[string]int
+}
+
+func newFakeTarget(leak uint64) *fakeTarget {
+	return &fakeTarget{leak: leak, memory: 1 << 20, commands: make(map[string]int)}
+}
+
+func (f *fakeTarget) ExecuteCommand(cmd string, _ []byte) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.commands[cmd]++
+	f.memory += f.leak
+
+	return []byte("00"), nil
+}
+
+func (f *fakeTarget) Stats() plugins.RuntimeStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return plugins.RuntimeStats{Pools: map[string]plugins.PoolStats{
+		"A0": {Instances: 1, Created: 1, MemoryBytes: f.memory},
+		"NC": {Instances: 1, Created: 1, MemoryBytes: 1 << 20},
+	}}
+}
+
+func TestParseOp(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in   string
+		want Op
+	}{
+		{"NC", Op{Command: "NC", Payload: []byte{}, Weight: 1}},
+		{"3*A0:0002U", Op{Command: "A0", Payload: []byte("0002U"), Weight: 3}},
+		{"CA:U0123*U4567", Op{Command: "CA", Payload: []byte("U0123*U4567"), Weight: 1}},
+	}
+	for _, tc := range tests {
+		got, err := ParseOp(tc.in)
+		if err != nil {
+			t.Fatalf("ParseOp(%q) error = %v", tc.in, err)
+		}
+		if got.Command != tc.want.Command || string(got.Payload) != string(tc.want.Payload) ||
+			got.Weight != tc.want.Weight {
+			t.Errorf("ParseOp(%q) = %+v, want %+v", tc.in, got, tc.want)
+		}
+	}
+
+	for _, in := range []string{"", "A", "0*NC", "NCX:00"} {
+		if _, err := ParseOp(in); !errors.Is(err, ErrInvalidOp) {
+			t.Errorf("ParseOp(%q) error = %v, want ErrInvalidOp", in, err)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	target := newFakeTarget(0)
+	report, err := Run(context.Background(), target, Config{
+		Mix:      []Op{{Command: "NC", Weight: 1}, {Command: "A0", Weight: 2}},
+		Duration: 100 * time.Millisecond,
+		Interval: 20 * time.Millisecond,
+		Workers:  2,
+		// The fake pools do not grow; the allowance covers Go heap noise.
+		MaxGrowth: 64 << 20,
+	})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(report.Samples) == 0 || report.Samples[len(report.Samples)-1].Requests == 0 {
+		t.Fatalf("Run() took no samples or sent no requests: %+v", report.Samples)
+	}
+	if report.Baseline.Runtime.WASMMemoryBytes() != 2<<20 {
+		t.Errorf("baseline WASM memory = %d, want %d", report.Baseline.Runtime.WASMMemoryBytes(), 2<<20)
+	}
+
+	target.mu.Lock()
+	nc, a0 := target.commands["NC"], target.commands["A0"]
+	target.mu.Unlock()
+	if nc == 0 || a0 < nc {
+		t.Errorf("command counts NC=%d A0=%d do not follow the mix weights", nc, a0)
+	}
+}
+
+func TestRunDetectsGrowth(t *testing.T) {
+	t.Parallel()
+
+	report, err := Run(context.Background(), newFakeTarget(1<<20), Config{
+		Mix:       []Op{{Command: "A0", Weight: 1}},
+		Duration:  5 * time.Second,
+		Interval:  10 * time.Millisecond,
+		Warmup:    5 * time.Millisecond,
+		MaxGrowth: 64 << 20,
+	})
+	if !errors.Is(err, ErrMemoryGrowth) {
+		t.Fatalf("Run() error = %v, want ErrMemoryGrowth", err)
+	}
+	if report.Growth() <= 64<<20 {
+		t.Errorf("Growth() = %d, want more than the threshold", report.Growth())
+	}
+}
+
+func TestRunUnknownCommand(t *testing.T) {
+	t.Parallel()
+
+	_, err := Run(context.Background(), newFakeTarget(0), Config{
+		Mix:      []Op{{Command: "ZZ", Weight: 1}},
+		Duration: time.Second,
+	})
+	if !errors.Is(err, ErrUnknownCommand) {
+		t.Errorf("Run() error = %v, want ErrUnknownCommand", err)
+	}
+}
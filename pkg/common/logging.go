@@ -3,6 +3,7 @@ package common
 import (
 	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
 	"time"
 
@@ -12,12 +13,17 @@ import (
 
 // InitLogger initializes the zerolog logger with the specified debug mode and output format.
 func InitLogger(debug, human bool) {
-	zerolog.TimeFieldFormat = time.RFC3339Nano                 // always initialize base logger with timestamp.
-	base := zerolog.New(os.Stdout).With().Timestamp().Logger() // initialize base logger.
+	InitLoggerTo(os.Stdout, debug, human)
+}
+
+// InitLoggerTo initializes the zerolog logger like InitLogger, writing to out.
+func InitLoggerTo(out io.Writer, debug, human bool) {
+	zerolog.TimeFieldFormat = time.RFC3339Nano           // always initialize base logger with timestamp.
+	base := zerolog.New(out).With().Timestamp().Logger() // initialize base logger.
 	if human {
 		// use console writer for human-friendly output.
 		cw := zerolog.ConsoleWriter{
-			Out:        os.Stdout,
+			Out:        out,
 			TimeFormat: time.RFC3339Nano,
 			NoColor:    false,
 		}
@@ -0,0 +1,101 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Component mailer layout.
+const (
+	// ComponentGroupSize is the number of hex characters per group on a component form.
+	ComponentGroupSize = 4
+	// ComponentGroupsPerLine is the number of groups per line (one 8-byte DES block).
+	ComponentGroupsPerLine = 4
+)
+
+const hexDigits = "0123456789ABCDEF"
+
+// LineCheckDigit calculates the check digit of a line of hex characters using the Luhn
+// mod 16 algorithm. Custodians use it to detect transcription errors line by line when
+// entering a component. Spaces are ignored.
+func LineCheckDigit(line string) (byte, error) {
+	line = strings.ToUpper(strings.ReplaceAll(line, " ", ""))
+
+	sum := 0
+	factor := 2
+	for i := len(line) - 1; i >= 0; i-- {
+		digit := strings.IndexByte(hexDigits, line[i])
+		if digit < 0 {
+			return 0, ErrInvalidHexString
+		}
+		addend := factor * digit
+		sum += addend/16 + addend%16
+		if factor == 2 {
+			factor = 1
+		} else {
+			factor = 2
+		}
+	}
+
+	return hexDigits[(16-sum%16)%16], nil
+}
+
+// FormatComponentLines splits a clear component into lines of space separated groups of
+// 4 hex characters, each followed by its line check digit.
+func FormatComponentLines(componentHex string) ([]string, error) {
+	if err := validateHexString(componentHex, 0); err != nil {
+		return nil, err
+	}
+	componentHex = strings.ToUpper(componentHex)
+
+	lineLen := ComponentGroupSize * ComponentGroupsPerLine
+	lines := make([]string, 0, (len(componentHex)+lineLen-1)/lineLen)
+	for start := 0; start < len(componentHex); start += lineLen {
+		line := componentHex[start:min(start+lineLen, len(componentHex))]
+
+		groups := make([]string, 0, ComponentGroupsPerLine)
+		for g := 0; g < len(line); g += ComponentGroupSize {
+			groups = append(groups, line[g:min(g+ComponentGroupSize, len(line))])
+		}
+
+		check, err := LineCheckDigit(line)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, fmt.Sprintf("%s  %c", strings.Join(groups, " "), check))
+	}
+
+	return lines, nil
+}
+
+// FormatComponentMailer renders a clear component in the standard mailer format used on
+// component forms: a header naming the component, numbered lines of grouped hex with
+// per-line check digits, and the component KCV.
+func FormatComponentMailer(componentHex string, number, total int) (string, error) {
+	if total < 1 || number < 1 || number > total {
+		return "", ErrInvalidComponentCount
+	}
+
+	lines, err := FormatComponentLines(componentHex)
+	if err != nil {
+		return "", err
+	}
+
+	raw, err := hex.DecodeString(componentHex)
+	if err != nil {
+		return "", ErrInvalidHexString
+	}
+	defer cleanBytes(raw)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "KEY COMPONENT %d OF %d\n", number, total)
+	b.WriteString(strings.Repeat("-", 32) + "\n")
+	for i, line := range lines {
+		fmt.Fprintf(&b, "Line %d:  %s\n", i+1, line)
+	}
+	b.WriteString(strings.Repeat("-", 32) + "\n")
+	fmt.Fprintf(&b, "Component KCV: %X\n", CalculateKCV(raw))
+
+	return b.String(), nil
+}
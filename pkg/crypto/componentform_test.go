@@ -0,0 +1,62 @@
+package crypto
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLineCheckDigit(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		line string
+		want byte
+	}{
+		{line: "0", want: '0'},
+		{line: "1", want: 'E'},
+		{line: "F", want: '1'},
+	}
+	for _, tc := range tests {
+		got, err := LineCheckDigit(tc.line)
+		if err != nil {
+			t.Fatalf("LineCheckDigit(%q) error: %v", tc.line, err)
+		}
+		if got != tc.want {
+			t.Errorf("LineCheckDigit(%q) = %c, want %c", tc.line, got, tc.want)
+		}
+	}
+
+	// A single transcription error must change the check digit.
+	a, _ := LineCheckDigit("0123456789ABCDEF")
+	b, _ := LineCheckDigit("0123456789ABCDFF")
+	if a == b {
+		t.Error("expected check digit to detect a changed character")
+	}
+
+	if _, err := LineCheckDigit("0123G"); err == nil {
+		t.Error("expected error for non-hex character")
+	}
+}
+
+func TestFormatComponentMailer(t *testing.T) {
+	t.Parallel()
+
+	form, err := FormatComponentMailer("0123456789ABCDEFFEDCBA9876543210", 2, 3)
+	if err != nil {
+		t.Fatalf("FormatComponentMailer error: %v", err)
+	}
+	for _, want := range []string{
+		"KEY COMPONENT 2 OF 3",
+		"Line 1:  0123 4567 89AB CDEF  ",
+		"Line 2:  FEDC BA98 7654 3210  ",
+		"Component KCV: 08D7B4",
+	} {
+		if !strings.Contains(form, want) {
+			t.Errorf("form missing %q:\n%s", want, form)
+		}
+	}
+
+	if _, err := FormatComponentMailer("0123456789ABCDEF", 4, 3); err == nil {
+		t.Error("expected error for component number above total")
+	}
+}
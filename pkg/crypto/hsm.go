@@ -2,11 +2,12 @@ package crypto
 
 import (
 	"crypto/cipher"
-	"crypto/des"
-	"crypto/rand"
 	"encoding/hex"
 	"errors"
 	"fmt"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
 )
 
 // Constants for key handling.
@@ -30,7 +31,8 @@ var (
 
 // GenerateKey generates a random cryptographic key of the specified length in bits.
 // Returns the key as a hex string and its KCV, or an error if the length is invalid.
-// If enforceOddParity is true, each byte in the key will have odd parity.
+// If enforceOddParity is true, each byte in the key will have odd parity. Keys with a weak
+// or semi-weak DES key component are discarded and generated again.
 func GenerateKey(lengthBits int, enforceOddParity bool) (string, string, error) {
 	// Validate key length
 	if lengthBits != KeyLength64 &&
@@ -43,14 +45,19 @@ func GenerateKey(lengthBits int, enforceOddParity bool) (string, string, error)
 	lengthBytes := lengthBits / 8
 	keyBytes := make([]byte, lengthBytes)
 
-	// Generate random key material
-	if _, err := rand.Read(keyBytes); err != nil {
-		return "", "", fmt.Errorf("failed to generate random key: %w", err)
-	}
+	// Generate random key material until it holds no weak DES key
+	for {
+		if err := cryptoutils.DefaultKeyGenerator().Generate(keyBytes); err != nil {
+			return "", "", fmt.Errorf("failed to generate random key: %w", err)
+		}
 
-	// Adjust parity if requested
-	if enforceOddParity {
-		adjustParity(keyBytes)
+		// Adjust parity if requested
+		if enforceOddParity {
+			adjustParity(keyBytes)
+		}
+		if !cryptoutils.IsWeakDESKey(keyBytes) {
+			break
+		}
 	}
 
 	// Calculate KCV
@@ -95,7 +102,7 @@ func SplitKey(keyHex string, numComponents int) ([]string, string, error) {
 
 	// Generate random components
 	for i := 0; i < numComponents-1; i++ {
-		if _, err := rand.Read(componentLists[i]); err != nil {
+		if _, err := cryptoprovider.Read(componentLists[i]); err != nil {
 			cleanComponentLists(componentLists)
 			return nil, "", fmt.Errorf("failed to generate component: %w", err)
 		}
@@ -189,16 +196,16 @@ func CalculateKCV(keyBytes []byte) []byte {
 	// Create appropriate cipher based on key length
 	switch len(keyBytes) {
 	case 8: // Single DES
-		block, err = des.NewCipher(keyBytes)
+		block, err = cryptoprovider.NewDESCipher(keyBytes)
 	case 16: // Double DES (use as Triple DES with K1,K2,K1)
 		// For double length key, use K1,K2,K1 mode
 		tripleKey := make([]byte, 24)
 		copy(tripleKey[:16], keyBytes)     // Copy K1,K2
 		copy(tripleKey[16:], keyBytes[:8]) // Copy K1 again
-		block, err = des.NewTripleDESCipher(tripleKey)
+		block, err = cryptoprovider.NewTripleDESCipher(tripleKey)
 		defer cleanBytes(tripleKey)
 	case 24: // Triple DES
-		block, err = des.NewTripleDESCipher(keyBytes)
+		block, err = cryptoprovider.NewTripleDESCipher(keyBytes)
 	default:
 		// Invalid key length - fall back to first 3 bytes
 		kcv := make([]byte, KCVLength)
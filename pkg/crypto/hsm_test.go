@@ -0,0 +1,35 @@
+package crypto
+
+import (
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+)
+
+// TestGenerateKeyRejectsWeakKeys replaces the key generator, so it does not run in parallel.
+func TestGenerateKeyRejectsWeakKeys(t *testing.T) {
+	// The first generated key holds a weak DES key, so the key is generated again.
+	cryptoutils.SetKeyGenerator(&sequenceGenerator{
+		[]byte("\x01\x23\x45\x67\x89\xAB\xCD\xEF\x1F\x1F\x1F\x1F\x0E\x0E\x0E\x0E"),
+		[]byte("\x01\x23\x45\x67\x89\xAB\xCD\xEF\xFE\xDC\xBA\x98\x76\x54\x32\x10"),
+	})
+	defer cryptoutils.SetKeyGenerator(nil)
+
+	key, _, err := GenerateKey(KeyLength128, true)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	if key != "0123456789abcdeffedcba9876543210" {
+		t.Errorf("GenerateKey() = %s, want the second generated key", key)
+	}
+}
+
+// sequenceGenerator returns its keys in turn.
+type sequenceGenerator [][]byte
+
+func (g *sequenceGenerator) Generate(b []byte) error {
+	copy(b, (*g)[0])
+	*g = (*g)[1:]
+
+	return nil
+}
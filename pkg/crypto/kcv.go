@@ -0,0 +1,106 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
+)
+
+// KCVType selects the algorithm of a key check value.
+type KCVType int
+
+// Key check value algorithms.
+const (
+	// KCVLegacy encrypts a zero block with the DES or TDES key, as CalculateKCV does.
+	KCVLegacy KCVType = iota
+	// KCVCMAC takes the AES-CMAC of a zero block under the AES key, as ANSI X9.24-1
+	// requires for AES keys and payShield 10K reports them by default.
+	KCVCMAC
+	// KCVAESZero encrypts a zero block with the AES key.
+	KCVAESZero
+)
+
+// ErrInvalidKCVType is returned for an unknown key check value algorithm.
+var ErrInvalidKCVType = errors.New("invalid kcv type")
+
+// kcvTypeNames maps the key check value algorithms to their names.
+var kcvTypeNames = map[KCVType]string{
+	KCVLegacy:  "legacy",
+	KCVCMAC:    "cmac",
+	KCVAESZero: "aes-zero",
+}
+
+// String returns the name of the algorithm.
+func (t KCVType) String() string {
+	if name, ok := kcvTypeNames[t]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("KCVType(%d)", int(t))
+}
+
+// ParseKCVType returns the algorithm of a name returned by KCVType.String, in any case.
+func ParseKCVType(name string) (KCVType, error) {
+	for t, n := range kcvTypeNames {
+		if strings.EqualFold(name, n) {
+			return t, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: %q (must be legacy, cmac or aes-zero)", ErrInvalidKCVType, name)
+}
+
+// KeyCheckValue is a check value of a key and the algorithm that computed it.
+type KeyCheckValue struct {
+	Type  KCVType
+	Value []byte
+}
+
+// CalculateKCVType calculates the 3-byte key check value of keyBytes with the algorithm t.
+// Unlike CalculateKCV it fails for keys of a length the algorithm does not accept: 8, 16 or
+// 24 bytes for KCVLegacy, and 16, 24 or 32 bytes for the AES algorithms.
+func CalculateKCVType(keyBytes []byte, t KCVType) ([]byte, error) {
+	switch t {
+	case KCVLegacy:
+		if len(keyBytes) != 8 && len(keyBytes) != 16 && len(keyBytes) != 24 {
+			return nil, fmt.Errorf("%w: %d bytes for a DES key", ErrInvalidKeyLength, len(keyBytes))
+		}
+
+		return CalculateKCV(keyBytes), nil
+	case KCVCMAC:
+		mac, err := cryptoprovider.AESCMAC(keyBytes, make([]byte, aes.BlockSize))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidKeyLength, err)
+		}
+
+		return mac[:KCVLength], nil
+	case KCVAESZero:
+		block, err := cryptoprovider.NewAESCipher(keyBytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidKeyLength, err)
+		}
+		output := make([]byte, aes.BlockSize)
+		block.Encrypt(output, make([]byte, aes.BlockSize))
+
+		return output[:KCVLength], nil
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrInvalidKCVType, int(t))
+	}
+}
+
+// KeyCheckValues returns the check values of keyBytes under every algorithm its length
+// allows, with the legacy value first. A 16 or 24 byte key may be a TDES or an AES key, so
+// it gets the legacy value alongside the AES ones.
+func KeyCheckValues(keyBytes []byte) []KeyCheckValue {
+	var kcvs []KeyCheckValue
+	for _, t := range []KCVType{KCVLegacy, KCVCMAC, KCVAESZero} {
+		if kcv, err := CalculateKCVType(keyBytes, t); err == nil {
+			kcvs = append(kcvs, KeyCheckValue{Type: t, Value: kcv})
+		}
+	}
+
+	return kcvs
+}
@@ -0,0 +1,79 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestCalculateKCVType(t *testing.T) {
+	t.Parallel()
+
+	aesKey, _ := hex.DecodeString("2B7E151628AED2A6ABF7158809CF4F3C")
+	tests := []struct {
+		name    string
+		key     []byte
+		kcvType KCVType
+		want    string
+		wantErr error
+	}{
+		{"legacy", aesKey, KCVLegacy, hex.EncodeToString(CalculateKCV(aesKey)), nil},
+		{"cmac", aesKey, KCVCMAC, "7ad386", nil},
+		{"aes zero block", aesKey, KCVAESZero, "7df76b", nil},
+		{"cmac of a DES key", aesKey[:8], KCVCMAC, "", ErrInvalidKeyLength},
+		{"legacy of an AES-256 key", bytes.Repeat(aesKey, 2), KCVLegacy, "", ErrInvalidKeyLength},
+		{"unknown type", aesKey, KCVType(9), "", ErrInvalidKCVType},
+	}
+	for _, tc := range tests {
+		got, err := CalculateKCVType(tc.key, tc.kcvType)
+		if !errors.Is(err, tc.wantErr) {
+			t.Errorf("%s: error = %v, want %v", tc.name, err, tc.wantErr)
+
+			continue
+		}
+		if hex.EncodeToString(got) != tc.want {
+			t.Errorf("%s: KCV = %x, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestKeyCheckValues(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		length int
+		want   []KCVType
+	}{
+		{8, []KCVType{KCVLegacy}},
+		{16, []KCVType{KCVLegacy, KCVCMAC, KCVAESZero}},
+		{32, []KCVType{KCVCMAC, KCVAESZero}},
+	} {
+		kcvs := KeyCheckValues(bytes.Repeat([]byte{0x1F}, tc.length))
+		if len(kcvs) != len(tc.want) {
+			t.Fatalf("%d byte key: got %d check values, want %d", tc.length, len(kcvs), len(tc.want))
+		}
+		for i, kcv := range kcvs {
+			if kcv.Type != tc.want[i] || len(kcv.Value) != KCVLength {
+				t.Errorf("%d byte key: check value %d = %v %x", tc.length, i, kcv.Type, kcv.Value)
+			}
+		}
+	}
+}
+
+func TestParseKCVType(t *testing.T) {
+	t.Parallel()
+
+	for _, kcvType := range []KCVType{KCVLegacy, KCVCMAC, KCVAESZero} {
+		got, err := ParseKCVType(kcvType.String())
+		if err != nil || got != kcvType {
+			t.Errorf("ParseKCVType(%q) = %v, %v", kcvType.String(), got, err)
+		}
+	}
+	if got, err := ParseKCVType("CMAC"); err != nil || got != KCVCMAC {
+		t.Errorf("ParseKCVType(CMAC) = %v, %v", got, err)
+	}
+	if _, err := ParseKCVType("sha"); !errors.Is(err, ErrInvalidKCVType) {
+		t.Errorf("ParseKCVType(sha) error = %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+// Package cryptoprovider abstracts the cryptographic primitives used by the HSM: DES, TDES
+// and AES block ciphers, AES CMAC, RSA and the random source. Command logic and the key
+// formatting packages obtain them from the default Provider, so an organization that must
+// use a certified crypto module can install its own Provider with SetDefault without
+// touching command logic. The default Stdlib provider uses the Go standard library, which
+// also covers BoringCrypto builds (GOEXPERIMENT=boringcrypto) and the Go FIPS 140-3 module
+// (GODEBUG=fips140=on).
+package cryptoprovider
+
+import (
+	"crypto"
+	"crypto/cipher"
+	"crypto/rsa"
+	"io"
+	"sync/atomic"
+)
+
+// Provider supplies the cryptographic primitives used by the HSM.
+type Provider interface {
+	// Name identifies the provider in logs.
+	Name() string
+	// NewDESCipher returns a single DES cipher for an 8-byte key.
+	NewDESCipher(key []byte) (cipher.Block, error)
+	// NewTripleDESCipher returns a TDES cipher for a 24-byte key.
+	NewTripleDESCipher(key []byte) (cipher.Block, error)
+	// NewAESCipher returns an AES cipher for a 16, 24 or 32-byte key.
+	NewAESCipher(key []byte) (cipher.Block, error)
+	// AESCMAC returns the 16-byte AES CMAC (NIST SP 800-38B) of msg.
+	AESCMAC(key, msg []byte) ([]byte, error)
+	// GenerateRSAKey generates an RSA key pair of the given size in bits.
+	GenerateRSAKey(bits int) (*rsa.PrivateKey, error)
+	// SignRSA signs a digest with RSASSA-PKCS1-v1_5.
+	SignRSA(key *rsa.PrivateKey, hash crypto.Hash, digest []byte) ([]byte, error)
+	// VerifyRSA verifies an RSASSA-PKCS1-v1_5 signature of a digest.
+	VerifyRSA(key *rsa.PublicKey, hash crypto.Hash, digest, sig []byte) error
+	// Rand returns the random source for keys, padding and nonces.
+	Rand() io.Reader
+}
+
+var current atomic.Pointer[Provider]
+
+// Default returns the provider in use, Stdlib unless SetDefault installed another one.
+func Default() Provider {
+	if p := current.Load(); p != nil {
+		return *p
+	}
+
+	return Stdlib{}
+}
+
+// SetDefault installs p as the provider for all subsequent operations; nil restores Stdlib.
+// It is meant to be called once at startup, before any keys are processed.
+func SetDefault(p Provider) {
+	if p == nil {
+		current.Store(nil)
+
+		return
+	}
+	current.Store(&p)
+}
+
+// NewDESCipher returns a single DES cipher from the default provider.
+func NewDESCipher(key []byte) (cipher.Block, error) {
+	return Default().NewDESCipher(key)
+}
+
+// NewTripleDESCipher returns a TDES cipher from the default provider.
+func NewTripleDESCipher(key []byte) (cipher.Block, error) {
+	return Default().NewTripleDESCipher(key)
+}
+
+// NewAESCipher returns an AES cipher from the default provider.
+func NewAESCipher(key []byte) (cipher.Block, error) {
+	return Default().NewAESCipher(key)
+}
+
+// AESCMAC returns the AES CMAC of msg from the default provider.
+func AESCMAC(key, msg []byte) ([]byte, error) {
+	return Default().AESCMAC(key, msg)
+}
+
+// Reader returns the random source of the default provider.
+func Reader() io.Reader {
+	return Default().Rand()
+}
+
+// Read fills b from the random source of the default provider, like crypto/rand.Read.
+func Read(b []byte) (int, error) {
+	return io.ReadFull(Reader(), b)
+}
@@ -0,0 +1,71 @@
+package cryptoprovider_test
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/hex"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
+)
+
+// TestAESCMAC verifies the stdlib CMAC against the RFC 4493 test vectors.
+func TestAESCMAC(t *testing.T) {
+	t.Parallel()
+
+	key, _ := hex.DecodeString("2b7e151628aed2a6abf7158809cf4f3c")
+	msg, _ := hex.DecodeString("6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e51" +
+		"30c81c46a35ce411e5fbc1191a0a52eff69f2445df4f9b17ad2b417be66c3710")
+	tests := []struct {
+		length int
+		want   string
+	}{
+		{0, "bb1d6929e95937287fa37d129b756746"},
+		{16, "070a16b46b4d4144f79bdd9dd04a287c"},
+		{40, "dfa66747de9ae63030ca32611497c827"},
+		{64, "51f0bebf7e3b9d92fc49741779363cfe"},
+	}
+	for _, tc := range tests {
+		got, err := cryptoprovider.Stdlib{}.AESCMAC(key, msg[:tc.length])
+		if err != nil || hex.EncodeToString(got) != tc.want {
+			t.Errorf("AESCMAC(%d bytes) = %x, %v, want %s", tc.length, got, err, tc.want)
+		}
+	}
+}
+
+// countingProvider wraps Stdlib and counts the AES ciphers it creates.
+type countingProvider struct {
+	cryptoprovider.Stdlib
+	aes int
+}
+
+func (p *countingProvider) Name() string { return "counting" }
+
+func (p *countingProvider) NewAESCipher(key []byte) (cipher.Block, error) {
+	p.aes++
+
+	return p.Stdlib.NewAESCipher(key)
+}
+
+// TestSetDefault verifies that the package functions use the installed provider.
+func TestSetDefault(t *testing.T) {
+	p := &countingProvider{}
+	cryptoprovider.SetDefault(p)
+	t.Cleanup(func() { cryptoprovider.SetDefault(nil) })
+
+	if name := cryptoprovider.Default().Name(); name != "counting" {
+		t.Fatalf("Default().Name() = %s", name)
+	}
+	if _, err := cryptoprovider.NewAESCipher(make([]byte, 16)); err != nil || p.aes != 1 {
+		t.Errorf("NewAESCipher() error = %v, calls = %d", err, p.aes)
+	}
+
+	cryptoprovider.SetDefault(nil)
+	if name := cryptoprovider.Default().Name(); name != "stdlib" {
+		t.Errorf("Default().Name() after reset = %s", name)
+	}
+	b := make([]byte, 16)
+	if n, err := cryptoprovider.Read(b); n != 16 || err != nil || bytes.Equal(b, make([]byte, 16)) {
+		t.Errorf("Read() = %d, %v, %x", n, err, b)
+	}
+}
@@ -0,0 +1,126 @@
+package cryptoprovider
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+)
+
+// Stdlib implements Provider with the Go standard library.
+type Stdlib struct{}
+
+// Name implements Provider.
+func (Stdlib) Name() string {
+	return "stdlib"
+}
+
+// NewDESCipher implements Provider.
+func (Stdlib) NewDESCipher(key []byte) (cipher.Block, error) {
+	return des.NewCipher(key)
+}
+
+// NewTripleDESCipher implements Provider.
+func (Stdlib) NewTripleDESCipher(key []byte) (cipher.Block, error) {
+	return des.NewTripleDESCipher(key)
+}
+
+// NewAESCipher implements Provider.
+func (Stdlib) NewAESCipher(key []byte) (cipher.Block, error) {
+	return aes.NewCipher(key)
+}
+
+// AESCMAC implements Provider.
+func (Stdlib) AESCMAC(key, msg []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return CMAC(block, msg), nil
+}
+
+// GenerateRSAKey implements Provider.
+func (Stdlib) GenerateRSAKey(bits int) (*rsa.PrivateKey, error) {
+	return rsa.GenerateKey(rand.Reader, bits)
+}
+
+// SignRSA implements Provider.
+func (Stdlib) SignRSA(key *rsa.PrivateKey, hash crypto.Hash, digest []byte) ([]byte, error) {
+	return rsa.SignPKCS1v15(rand.Reader, key, hash, digest)
+}
+
+// VerifyRSA implements Provider.
+func (Stdlib) VerifyRSA(key *rsa.PublicKey, hash crypto.Hash, digest, sig []byte) error {
+	return rsa.VerifyPKCS1v15(key, hash, digest, sig)
+}
+
+// Rand implements Provider.
+func (Stdlib) Rand() io.Reader {
+	return rand.Reader
+}
+
+// CMAC computes the CMAC (NIST SP 800-38B) of msg with any block cipher, so providers that
+// only supply block ciphers can reuse it for AESCMAC.
+func CMAC(block cipher.Block, msg []byte) []byte {
+	bs := block.BlockSize()
+	rb := byte(0x87)
+	if bs == 8 {
+		rb = 0x1B
+	}
+
+	l := make([]byte, bs)
+	block.Encrypt(l, l)
+	k1 := shiftSubkey(l, rb)
+	k2 := shiftSubkey(k1, rb)
+
+	// The last block is XORed with K1 when complete and padded and XORed with K2 otherwise.
+	n := (len(msg) + bs - 1) / bs
+	last := make([]byte, bs)
+	subkey := k1
+	if n == 0 || len(msg)%bs != 0 {
+		if n == 0 {
+			n = 1
+		}
+		copy(last, msg[(n-1)*bs:])
+		last[len(msg)-(n-1)*bs] = 0x80
+		subkey = k2
+	} else {
+		copy(last, msg[(n-1)*bs:])
+	}
+	for i := range last {
+		last[i] ^= subkey[i]
+	}
+
+	x := make([]byte, bs)
+	for i := 0; i < n-1; i++ {
+		for j := range x {
+			x[j] ^= msg[i*bs+j]
+		}
+		block.Encrypt(x, x)
+	}
+	for j := range x {
+		x[j] ^= last[j]
+	}
+	block.Encrypt(x, x)
+
+	return x
+}
+
+// shiftSubkey shifts b left by one bit and XORs the constant rb when the dropped bit was set.
+func shiftSubkey(b []byte, rb byte) []byte {
+	out := make([]byte, len(b))
+	var carry byte
+	for i := len(b) - 1; i >= 0; i-- {
+		out[i] = b[i]<<1 | carry
+		carry = b[i] >> 7
+	}
+	if b[0]&0x80 != 0 {
+		out[len(out)-1] ^= rb
+	}
+
+	return out
+}
@@ -11,8 +11,8 @@ import (
 // pan, psn: ASCII PAN and PSN used for ICC MK derivation.
 // Uses ISO7816-4 padding and DES3-CBC with zero IV.
 func GenerateARQC10(issMKAC, data []byte, pan, psn string) ([]byte, error) {
-	// 1. Derive ICC Master Key AC using Option A (3DES).
-	iccMKAC, err := DeriveICCKey(issMKAC, pan, psn, "A")
+	// 1. Derive ICC Master Key AC (Option A, or Option B for PANs over 16 digits).
+	iccMKAC, err := DeriveICCKeyForPAN(issMKAC, pan, psn, false)
 	if err != nil {
 		return nil, err
 	}
@@ -31,7 +31,7 @@ func GenerateARQC10(issMKAC, data []byte, pan, psn string) ([]byte, error) {
 
 // GenerateARPC10 computes the 8-byte ARPC per Visa CVN10 (Method 1).
 func GenerateARPC10(issMKAC, arqc, arpcRc []byte, pan, psn string) ([]byte, error) {
-	iccMKAC, err := DeriveICCKey(issMKAC, pan, psn, "A")
+	iccMKAC, err := DeriveICCKeyForPAN(issMKAC, pan, psn, false)
 	if err != nil {
 		return nil, err
 	}
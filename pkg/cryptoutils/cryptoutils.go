@@ -3,17 +3,17 @@
 package cryptoutils
 
 import (
+	"crypto/aes"
 	"crypto/cipher"
-	"crypto/des"
-	"crypto/rand"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"slices"
 	"strconv"
 	"strings"
-	"time"
 	"unicode"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
 )
 
 // ecb wraps a cipher.Block to provide ECB mode.
@@ -157,6 +157,8 @@ func (x *ecbDecrypter) CryptBlocks(dst, src []byte) {
 	}
 }
 
+// KeyCV returns the first kcvLen hex characters of the encryption of zeros under the DES or
+// TDES key in keyHex.
 func KeyCV(keyHex []byte, kcvLen int) ([]byte, error) {
 	rawKey, err := hex.DecodeString(string(keyHex))
 	if err != nil {
@@ -181,7 +183,7 @@ func KeyCV(keyHex []byte, kcvLen int) ([]byte, error) {
 		return nil, fmt.Errorf("keycv: invalid key length %d", len(rawKey))
 	}
 
-	block, err := des.NewTripleDESCipher(fullKey)
+	block, err := cryptoprovider.NewTripleDESCipher(fullKey)
 	if err != nil {
 		return nil, err
 	}
@@ -199,6 +201,25 @@ func KeyCV(keyHex []byte, kcvLen int) ([]byte, error) {
 	return hv[:kcvLen], nil
 }
 
+// AESKeyCV returns the first kcvLen hex characters of the AES-CMAC of a block of zeros under
+// the AES key in keyHex, the key check value of ANSI X9.24-1 for AES keys.
+func AESKeyCV(keyHex []byte, kcvLen int) ([]byte, error) {
+	rawKey, err := hex.DecodeString(string(keyHex))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode keyHex for AESKeyCV: %w", err)
+	}
+	mac, err := AESCMAC(make([]byte, aes.BlockSize), rawKey)
+	if err != nil {
+		return nil, fmt.Errorf("aeskeycv: %w", err)
+	}
+	hv := Raw2B(mac)
+	if kcvLen > len(hv) {
+		return nil, fmt.Errorf("aeskeycv: kcv_length %d too large", kcvLen)
+	}
+
+	return hv[:kcvLen], nil
+}
+
 // GetDigitsFromString extracts up to 'length' decimal digits from a hex string,
 // applying a second pass on non-decimal hex chars if needed.
 func GetDigitsFromString(ct string, length int) string {
@@ -235,6 +256,15 @@ func GetDigitsFromString(ct string, length int) string {
 
 // GetVisaPVV generates a 4-digit PIN Verification Value (PVV) using 3DES ECB.
 func GetVisaPVV(accountNumber, keyIndex, pin string, pvkHex []byte) ([]byte, error) {
+	return GetVisaPVVWith(DefaultDecimalizer, accountNumber, keyIndex, pin, pvkHex)
+}
+
+// GetVisaPVVWith generates a 4-digit PVV using dec to decimalize the encrypted TSP.
+func GetVisaPVVWith(
+	dec Decimalizer,
+	accountNumber, keyIndex, pin string,
+	pvkHex []byte,
+) ([]byte, error) {
 	pan11 := accountNumber[len(accountNumber)-11:] // last 11 digits before check digit
 	// Build TSP: 11 PAN digits + PVKeyIndex + PIN (only first 4 digits)
 	tspHex := pan11 + keyIndex + pin[:4]
@@ -244,7 +274,7 @@ func GetVisaPVV(accountNumber, keyIndex, pin string, pvkHex []byte) ([]byte, err
 		pvkHex = append(pvkHex, pvkHex[:8]...)
 	}
 
-	block, err := des.NewTripleDESCipher(pvkHex)
+	block, err := cryptoprovider.NewTripleDESCipher(pvkHex)
 	if err != nil {
 		return nil, err
 	}
@@ -256,7 +286,10 @@ func GetVisaPVV(accountNumber, keyIndex, pin string, pvkHex []byte) ([]byte, err
 	// 3DES-ECB encrypt TSP
 	dst := make([]byte, len(rawTsp))
 	NewECBEncrypter(block).CryptBlocks(dst, rawTsp)
-	digits := GetDigitsFromString(Raw2Str(dst), 4)
+	digits, err := dec.Digits(Raw2Str(dst), 4)
+	if err != nil {
+		return nil, err
+	}
 
 	return []byte(digits), nil
 }
@@ -267,6 +300,11 @@ func GetVisaPVV(accountNumber, keyIndex, pin string, pvkHex []byte) ([]byte, err
 // servCode: Service code, 3 digits.
 // cvkRaw: The raw Card Verification Key bytes (must be 16 bytes for double-length key).
 func GetVisaCVV(panHex, expDate, servCode string, cvkRaw []byte) ([]byte, error) {
+	return GetVisaCVVWith(DefaultDecimalizer, panHex, expDate, servCode, cvkRaw)
+}
+
+// GetVisaCVVWith calculates the CVV using dec to decimalize the final cipher block.
+func GetVisaCVVWith(dec Decimalizer, panHex, expDate, servCode string, cvkRaw []byte) ([]byte, error) {
 	// Step 1: Validate double-length (16-byte) key
 	if len(cvkRaw) != 16 {
 		return nil, fmt.Errorf(
@@ -303,7 +341,7 @@ func GetVisaCVV(panHex, expDate, servCode string, cvkRaw []byte) ([]byte, error)
 	}
 
 	// Step 7: Encrypt first half of data with first half of key
-	block1, err := des.NewCipher(key1)
+	block1, err := cryptoprovider.NewDESCipher(key1)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create first DES cipher: %w", err)
 	}
@@ -325,7 +363,7 @@ func GetVisaCVV(panHex, expDate, servCode string, cvkRaw []byte) ([]byte, error)
 	block1.Encrypt(encrypted2, xored)
 
 	// Step 10: Decrypt with second half of key
-	block2, err := des.NewCipher(key2)
+	block2, err := cryptoprovider.NewDESCipher(key2)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create second DES cipher: %w", err)
 	}
@@ -338,8 +376,12 @@ func GetVisaCVV(panHex, expDate, servCode string, cvkRaw []byte) ([]byte, error)
 
 	// Step 12: Get first 3 digits from result
 	hexResult := Raw2Str(finalEncrypted)
+	digits, err := dec.Digits(hexResult, 3)
+	if err != nil {
+		return nil, err
+	}
 
-	return []byte(GetDigitsFromString(hexResult, 3)), nil
+	return []byte(digits), nil
 }
 
 // ParityOf returns 0 for even number of set bits, -1 for odd.
@@ -384,69 +426,53 @@ func FixKeyParity(key []byte) []byte {
 	return res
 }
 
-// seedRandom ensures proper entropy for random number generation.
-// While crypto/rand doesn't need seeding as it uses system entropy,
-// we add extra entropy mixing to ensure uniqueness across WASM calls.
-func seedRandom() error {
-	seed := make([]byte, 32)
-	if _, err := rand.Read(seed); err != nil {
-		return fmt.Errorf("failed to read random seed: %w", err)
+// GenerateRandomKey generates a cryptographically secure random key of specified length.
+// Length must be 8 (single), 16 (double) or 24 (triple) bytes, whose bytes are adjusted to
+// odd DES parity, or 32 bytes for an AES-256 key. The key is read from the default
+// KeyGenerator. DES keys with a weak or semi-weak component (see IsWeakDESKey) are
+// discarded and regenerated.
+func GenerateRandomKey(length int) ([]byte, error) {
+	if length != 8 && length != 16 && length != 24 && length != 32 {
+		return nil, errors.New("invalid key length: must be 8, 16, 24 or 32 bytes")
 	}
 
-	// Mix in current time for additional entropy
-	timeBytes := []byte(time.Now().UTC().String())
-	for i := range timeBytes {
-		if i < len(seed) {
-			seed[i] ^= timeBytes[i]
+	for {
+		finalKey, err := randomKey(length)
+		if err != nil {
+			return nil, err
+		}
+		if length == 32 {
+			return finalKey, nil
 		}
-	}
 
-	// Read more random bytes to mix the entropy pool
-	extraEntropy := make([]byte, 32)
-	if _, err := rand.Read(extraEntropy); err != nil {
-		return fmt.Errorf("failed to read extra entropy: %w", err)
+		// Adjust parity for DES keys.
+		if !CheckKeyParity(finalKey) {
+			finalKey = FixKeyParity(finalKey)
+		}
+		if !IsWeakDESKey(finalKey) {
+			return finalKey, nil
+		}
 	}
-
-	return nil
 }
 
-// GenerateRandomKey generates a cryptographically secure random key of specified length.
-// Length must be 8 (single), 16 (double), or 24 (triple) bytes.
-func GenerateRandomKey(length int) ([]byte, error) {
-	// Seed the random generator on every call.
-	if err := seedRandom(); err != nil {
-		return nil, fmt.Errorf("failed to seed random generator: %w", err)
-	}
-
-	if length != 8 && length != 16 && length != 24 {
-		return nil, errors.New("invalid key length: must be 8, 16, or 24 bytes")
-	}
-
-	// Generate two separate random values.
-	key1 := make([]byte, length)
-	key2 := make([]byte, length)
-
-	if _, err := rand.Read(key1); err != nil {
-		return nil, fmt.Errorf("failed to generate first random key: %w", err)
-	}
-	if _, err := rand.Read(key2); err != nil {
-		return nil, fmt.Errorf("failed to generate second random key: %w", err)
+// GenerateRandomAESKey generates a cryptographically secure random AES key of 16, 24 or 32
+// bytes. Unlike GenerateRandomKey it leaves every bit of the key random.
+func GenerateRandomAESKey(length int) ([]byte, error) {
+	if length != 16 && length != 24 && length != 32 {
+		return nil, errors.New("invalid AES key length: must be 16, 24 or 32 bytes")
 	}
 
-	// Mix the two random values.
-	finalKey := make([]byte, length)
-	for i := range length {
-		// Use XOR to mix the values and add timestamp byte for extra entropy.
-		timeByte := byte(time.Now().UnixNano() >> uint((i%8)*8))
-		finalKey[i] = key1[i] ^ key2[i] ^ timeByte
-	}
+	return randomKey(length)
+}
 
-	// Adjust parity for DES keys.
-	if !CheckKeyParity(finalKey) {
-		finalKey = FixKeyParity(finalKey)
+// randomKey returns length bytes from the default KeyGenerator.
+func randomKey(length int) ([]byte, error) {
+	key := make([]byte, length)
+	if err := DefaultKeyGenerator().Generate(key); err != nil {
+		return nil, fmt.Errorf("failed to generate random key: %w", err)
 	}
 
-	return finalKey, nil
+	return key, nil
 }
 
 // ExtendDoubleToTripleKey extends a 16-byte double-length key to a 24-byte triple-length key (K1K2K1).
@@ -278,3 +278,47 @@ func TestParityAndKeyParity(t *testing.T) {
 		})
 	}
 }
+
+func TestAESKeyCV(t *testing.T) {
+	t.Parallel()
+
+	got, err := AESKeyCV([]byte("2B7E151628AED2A6ABF7158809CF4F3C"), 6)
+	if err != nil {
+		t.Fatalf("AESKeyCV() error = %v", err)
+	}
+	if string(got) != "7AD386" {
+		t.Errorf("AESKeyCV() = %s, want 7AD386", got)
+	}
+	if _, err := AESKeyCV([]byte("0123456789ABCDEF"), 6); err == nil {
+		t.Error("AESKeyCV() accepted a DES key")
+	}
+}
+
+func TestGenerateRandomKey(t *testing.T) {
+	t.Parallel()
+
+	for _, length := range []int{8, 16, 24, 32} {
+		key, err := GenerateRandomKey(length)
+		if err != nil {
+			t.Fatalf("GenerateRandomKey(%d) error = %v", length, err)
+		}
+		if len(key) != length {
+			t.Errorf("GenerateRandomKey(%d) returned %d bytes", length, len(key))
+		}
+		if length != 32 && !CheckKeyParity(key) {
+			t.Errorf("GenerateRandomKey(%d) returned a key without odd parity", length)
+		}
+	}
+	for _, length := range []int{16, 24, 32} {
+		key, err := GenerateRandomAESKey(length)
+		if err != nil || len(key) != length {
+			t.Errorf("GenerateRandomAESKey(%d) = %d bytes, %v", length, len(key), err)
+		}
+	}
+	if _, err := GenerateRandomKey(12); err == nil {
+		t.Error("GenerateRandomKey(12) succeeded")
+	}
+	if _, err := GenerateRandomAESKey(8); err == nil {
+		t.Error("GenerateRandomAESKey(8) succeeded")
+	}
+}
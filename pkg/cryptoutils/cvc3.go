@@ -0,0 +1,60 @@
+package cryptoutils
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"slices"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
+)
+
+// CVC3Digits is the number of digits of a dynamic CVC3 returned by GetCVC3.
+const CVC3Digits = 3
+
+// GetCVC3IV computes IVCVC3 over the track data (hex, padded with F to whole bytes): the two
+// rightmost bytes of an ISO/IEC 9797-1 MAC algorithm 3 with padding method 1 under the
+// 16-byte ICC key kd.
+func GetCVC3IV(kd []byte, trackData string) ([]byte, error) {
+	if len(trackData)%2 != 0 {
+		trackData += "F"
+	}
+	data, err := hex.DecodeString(trackData)
+	if err != nil {
+		return nil, fmt.Errorf("invalid track data %q", trackData)
+	}
+	mac, err := X919MAC(data, kd)
+	if err != nil {
+		return nil, err
+	}
+
+	return mac[len(mac)-2:], nil
+}
+
+// GetCVC3 computes a dynamic CVC3 under the 16-byte ICC key kd derived from an MK-CVC3. The
+// block IVCVC3 (from the track data) || unpredictable number (4 bytes) || ATC (2 bytes) is
+// encrypted under kd and the two rightmost bytes of the result are returned as the
+// rightmost CVC3Digits decimal digits.
+func GetCVC3(kd []byte, trackData string, un, atc []byte) ([]byte, error) {
+	if len(un) != 4 {
+		return nil, fmt.Errorf("unpredictable number must be 4 bytes, got %d", len(un))
+	}
+	if len(atc) != 2 {
+		return nil, fmt.Errorf("atc must be 2 bytes, got %d", len(atc))
+	}
+	iv, err := GetCVC3IV(kd, trackData)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := cryptoprovider.NewTripleDESCipher(PrepareTripleDESKey(kd))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 8)
+	block.Encrypt(out, slices.Concat(iv, un, atc))
+
+	digits := fmt.Sprintf("%05d", binary.BigEndian.Uint16(out[6:]))
+
+	return []byte(digits[len(digits)-CVC3Digits:]), nil
+}
@@ -0,0 +1,45 @@
+package cryptoutils
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestGetCVC3(t *testing.T) {
+	mk, _ := hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+	kd, err := DeriveICCKeyOptionA(mk, "4111111111111111", "01")
+	if err != nil {
+		t.Fatalf("DeriveICCKeyOptionA() error = %v", err)
+	}
+	const trackData = "4111111111111111D2412123"
+	un, _ := hex.DecodeString("12345678")
+	atc, _ := hex.DecodeString("0001")
+
+	iv, err := GetCVC3IV(kd, trackData)
+	if err != nil || hex.EncodeToString(iv) != "8d12" {
+		t.Errorf("GetCVC3IV() = %X, %v, want 8D12", iv, err)
+	}
+	cvc3, err := GetCVC3(kd, trackData, un, atc)
+	if err != nil || string(cvc3) != "393" {
+		t.Errorf("GetCVC3() = %s, %v, want 393", cvc3, err)
+	}
+
+	// The CVC3 changes with the ATC.
+	next, _ := hex.DecodeString("0002")
+	if other, err := GetCVC3(kd, trackData, un, next); err != nil || string(other) == "393" {
+		t.Errorf("GetCVC3() with the next ATC = %s, %v", other, err)
+	}
+
+	if _, err := GetCVC3(kd, trackData, un[:3], atc); err == nil {
+		t.Error("GetCVC3() accepted a 3-byte unpredictable number")
+	}
+	if _, err := GetCVC3(kd, trackData, un, atc[:1]); err == nil {
+		t.Error("GetCVC3() accepted a 1-byte ATC")
+	}
+	if _, err := GetCVC3(kd[:8], trackData, un, atc); err == nil {
+		t.Error("GetCVC3() accepted a single-length key")
+	}
+	if _, err := GetCVC3IV(kd, "41Z1"); err == nil {
+		t.Error("GetCVC3IV() accepted non-hex track data")
+	}
+}
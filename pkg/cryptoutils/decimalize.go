@@ -0,0 +1,121 @@
+package cryptoutils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Decimalizer extracts decimal digits from the hex result of a verification value
+// calculation (PVV, CVV).
+type Decimalizer interface {
+	// Digits returns length decimal digits derived from hexStr.
+	Digits(hexStr string, length int) (string, error)
+}
+
+// Decimalizer specifications accepted by ParseDecimalizer.
+const (
+	DecimalizerVisa          = "visa"    // standard Visa two-pass extraction
+	DecimalizerTablePrefix   = "table:"  // single pass through a decimalization table
+	DecimalizerTwoPassPrefix = "table2:" // decimal digits first, then A-F through a table
+)
+
+var errDecimalizationLength = errors.New("not enough digits after decimalization")
+
+// DefaultDecimalizer is the decimalization used when none is configured.
+var DefaultDecimalizer Decimalizer = VisaDecimalizer{}
+
+// VisaDecimalizer is the standard Visa two-pass extraction: decimal digits left to right,
+// then hex digits A-F reduced by 10.
+type VisaDecimalizer struct{}
+
+// Digits implements Decimalizer.
+func (VisaDecimalizer) Digits(hexStr string, length int) (string, error) {
+	digits := GetDigitsFromString(strings.ToUpper(hexStr), length)
+	if len(digits) < length {
+		return "", errDecimalizationLength
+	}
+
+	return digits, nil
+}
+
+// TableDecimalizer maps hex digits to decimal digits through a 16-digit decimalization
+// table, where Table[i] replaces hex digit i.
+type TableDecimalizer struct {
+	Table [16]byte
+	// TwoPass takes decimal digits as they are in a first pass and maps only A-F through
+	// the table in a second pass, as the Visa method does. Otherwise every digit is
+	// mapped in a single left-to-right pass.
+	TwoPass bool
+}
+
+// NewTableDecimalizer creates a TableDecimalizer from a 16-digit decimalization table.
+func NewTableDecimalizer(table string, twoPass bool) (TableDecimalizer, error) {
+	if len(table) != 16 {
+		return TableDecimalizer{}, fmt.Errorf("decimalization table must be 16 digits, got %d", len(table))
+	}
+
+	d := TableDecimalizer{TwoPass: twoPass}
+	for i := 0; i < 16; i++ {
+		if table[i] < '0' || table[i] > '9' {
+			return TableDecimalizer{}, fmt.Errorf("invalid decimalization table digit %q", table[i])
+		}
+		d.Table[i] = table[i]
+	}
+
+	return d, nil
+}
+
+// Digits implements Decimalizer.
+func (d TableDecimalizer) Digits(hexStr string, length int) (string, error) {
+	nibbles := make([]int, 0, len(hexStr))
+	for _, c := range strings.ToUpper(hexStr) {
+		n := strings.IndexRune("0123456789ABCDEF", c)
+		if n < 0 {
+			return "", fmt.Errorf("invalid hex digit %q", c)
+		}
+		nibbles = append(nibbles, n)
+	}
+
+	digits := make([]byte, 0, length)
+	if d.TwoPass {
+		for _, n := range nibbles {
+			if len(digits) < length && n < 10 {
+				digits = append(digits, byte('0'+n))
+			}
+		}
+		for _, n := range nibbles {
+			if len(digits) < length && n >= 10 {
+				digits = append(digits, d.Table[n])
+			}
+		}
+	} else {
+		for _, n := range nibbles {
+			if len(digits) < length {
+				digits = append(digits, d.Table[n])
+			}
+		}
+	}
+	if len(digits) < length {
+		return "", errDecimalizationLength
+	}
+
+	return string(digits), nil
+}
+
+// ParseDecimalizer creates a Decimalizer from a specification: "visa" (or empty) for the
+// standard Visa method, "table:<16 digits>" for single-pass table decimalization and
+// "table2:<16 digits>" for two-pass table decimalization.
+func ParseDecimalizer(spec string) (Decimalizer, error) {
+	spec = strings.TrimSpace(spec)
+	switch {
+	case spec == "" || strings.EqualFold(spec, DecimalizerVisa):
+		return VisaDecimalizer{}, nil
+	case strings.HasPrefix(spec, DecimalizerTwoPassPrefix):
+		return NewTableDecimalizer(strings.TrimPrefix(spec, DecimalizerTwoPassPrefix), true)
+	case strings.HasPrefix(spec, DecimalizerTablePrefix):
+		return NewTableDecimalizer(strings.TrimPrefix(spec, DecimalizerTablePrefix), false)
+	default:
+		return nil, fmt.Errorf("unknown decimalization %q", spec)
+	}
+}
@@ -0,0 +1,81 @@
+//nolint:all // test package
+package cryptoutils
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestDecimalizers(t *testing.T) {
+	t.Parallel()
+
+	const ct = "A1B2C3D4E5F6A7B8"
+
+	tests := []struct {
+		name   string
+		spec   string
+		length int
+		want   string
+	}{
+		{name: "visa", spec: "visa", length: 4, want: "1234"},
+		{name: "visa second pass", spec: "", length: 10, want: "1234567801"},
+		{name: "single pass identity table", spec: "table:0123456789012345", length: 6, want: "011223"},
+		{name: "single pass custom table", spec: "table:9876543210987654", length: 4, want: "9887"},
+		{name: "two pass custom table", spec: "table2:0123456789999999", length: 10, want: "1234567899"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			dec, err := ParseDecimalizer(tc.spec)
+			if err != nil {
+				t.Fatalf("ParseDecimalizer(%q) error: %v", tc.spec, err)
+			}
+			got, err := dec.Digits(ct, tc.length)
+			if err != nil {
+				t.Fatalf("Digits error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("Digits() = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseDecimalizerErrors(t *testing.T) {
+	t.Parallel()
+
+	for _, spec := range []string{"ibm", "table:0123", "table:0123456789ABCDEF", "table2:"} {
+		if _, err := ParseDecimalizer(spec); err == nil {
+			t.Errorf("ParseDecimalizer(%q) expected error", spec)
+		}
+	}
+
+	if _, err := (TableDecimalizer{}).Digits("ABC", 4); err == nil {
+		t.Error("expected error when not enough digits")
+	}
+}
+
+func TestGetVisaPVVWithDefaultMatches(t *testing.T) {
+	t.Parallel()
+
+	pvk, _ := hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+	want, err := GetVisaPVV("4000001234562", "1", "1234", pvk)
+	if err != nil {
+		t.Fatalf("GetVisaPVV error: %v", err)
+	}
+	got, err := GetVisaPVVWith(VisaDecimalizer{}, "4000001234562", "1", "1234", pvk)
+	if err != nil {
+		t.Fatalf("GetVisaPVVWith error: %v", err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("GetVisaPVVWith() = %s, want %s", got, want)
+	}
+
+	custom, _ := NewTableDecimalizer("0000000000000000", false)
+	got, err = GetVisaPVVWith(custom, "4000001234562", "1", "1234", pvk)
+	if err != nil || string(got) != "0000" {
+		t.Errorf("GetVisaPVVWith(custom) = %s, %v; want 0000", got, err)
+	}
+}
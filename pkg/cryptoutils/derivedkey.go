@@ -9,22 +9,67 @@ import (
 	"fmt"
 	"slices"
 	"strings"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
+)
+
+// EMV ICC master key derivation options (EMV Book 2, A1.4).
+const (
+	DerivationOptionA = "A" // 3DES, PAN of up to 16 digits.
+	DerivationOptionB = "B" // 3DES with SHA-1 decimalization, PAN longer than 16 digits.
+	DerivationOptionC = "C" // AES.
 )
 
 // DeriveICCKey derives the k-bit ICC Master Key (UDK) per EMV A1.4 (Option A, B or C).
 func DeriveICCKey(imk []byte, pan, panSeq, option string) ([]byte, error) {
 	switch strings.ToUpper(option) {
-	case "A":
+	case DerivationOptionA:
 		return deriveOptionA(imk, pan, panSeq)
-	case "B":
+	case DerivationOptionB:
 		return deriveOptionB(imk, pan, panSeq)
-	case "C":
+	case DerivationOptionC:
 		return deriveOptionC(imk, pan, panSeq)
 	default:
 		return nil, fmt.Errorf("unsupported derivation option %q", option)
 	}
 }
 
+// SelectDerivationOption returns the EMV derivation option for a PAN and issuer master key
+// algorithm: Option C for AES keys, Option B for 3DES keys with PANs longer than 16 digits
+// and Option A otherwise.
+func SelectDerivationOption(pan string, aesKey bool) string {
+	switch {
+	case aesKey:
+		return DerivationOptionC
+	case len(pan) > 16:
+		return DerivationOptionB
+	default:
+		return DerivationOptionA
+	}
+}
+
+// DeriveICCKeyForPAN derives the ICC Master Key using the option selected by
+// SelectDerivationOption.
+func DeriveICCKeyForPAN(imk []byte, pan, panSeq string, aesKey bool) ([]byte, error) {
+	return DeriveICCKey(imk, pan, panSeq, SelectDerivationOption(pan, aesKey))
+}
+
+// DeriveICCKeyOptionA derives a 3DES ICC Master Key using EMV Option A.
+func DeriveICCKeyOptionA(imk []byte, pan, panSeq string) ([]byte, error) {
+	return deriveOptionA(imk, pan, panSeq)
+}
+
+// DeriveICCKeyOptionB derives a 3DES ICC Master Key using EMV Option B.
+// PANs of 16 digits or fewer fall back to Option A as required by the specification.
+func DeriveICCKeyOptionB(imk []byte, pan, panSeq string) ([]byte, error) {
+	return deriveOptionB(imk, pan, panSeq)
+}
+
+// DeriveICCKeyOptionC derives an AES ICC Master Key using EMV Option C.
+func DeriveICCKeyOptionC(imk []byte, pan, panSeq string) ([]byte, error) {
+	return deriveOptionC(imk, pan, panSeq)
+}
+
 // --- Option A (3DES only) ---------------------------------------------------.
 
 func deriveOptionA(imk []byte, pan, panSeq string) ([]byte, error) {
@@ -126,7 +171,7 @@ func derive3DESKey(imk, block8 []byte) ([]byte, error) {
 	if len(block8) != des.BlockSize {
 		return nil, errors.New("invalid block size for 3DES")
 	}
-	c, err := des.NewTripleDESCipher(PrepareTripleDESKey(imk))
+	c, err := cryptoprovider.NewTripleDESCipher(PrepareTripleDESKey(imk))
 	if err != nil {
 		return nil, err
 	}
@@ -149,7 +194,7 @@ func aesECBEncryptBlock(key, blk []byte) ([]byte, error) {
 	if len(blk) != aes.BlockSize {
 		return nil, errors.New("invalid block size for AES")
 	}
-	c, err := aes.NewCipher(key)
+	c, err := cryptoprovider.NewAESCipher(key)
 	if err != nil {
 		return nil, err
 	}
@@ -62,3 +62,62 @@ func TestDerive3DESKey(t *testing.T) {
 		t.Error("derive3DESKey() with bad block size: want error, got nil")
 	}
 }
+
+func TestSelectDerivationOption(t *testing.T) {
+	tests := []struct {
+		pan    string
+		aesKey bool
+		want   string
+	}{
+		{"4111111111111111", false, DerivationOptionA},
+		{"4111111111111111123", false, DerivationOptionB},
+		{"4111111111111111", true, DerivationOptionC},
+		{"4111111111111111123", true, DerivationOptionC},
+	}
+	for _, tt := range tests {
+		if got := SelectDerivationOption(tt.pan, tt.aesKey); got != tt.want {
+			t.Errorf("SelectDerivationOption(%q, %v) = %q, want %q", tt.pan, tt.aesKey, got, tt.want)
+		}
+	}
+}
+
+func TestDeriveICCKeyForPAN(t *testing.T) {
+	imk := bytesRepeat(0x11, 16)
+	aesIMK := bytesRepeat(0x22, 16)
+
+	short := "4111111111111111"
+	long := "4111111111111111123"
+
+	a, err := DeriveICCKeyOptionA(imk, short, "01")
+	if err != nil {
+		t.Fatalf("DeriveICCKeyOptionA() error = %v", err)
+	}
+	got, err := DeriveICCKeyForPAN(imk, short, "01", false)
+	if err != nil || !reflect.DeepEqual(got, a) {
+		t.Errorf("DeriveICCKeyForPAN(short) = %X, %v, want %X", got, err, a)
+	}
+
+	// Option B falls back to Option A for short PANs.
+	b, err := DeriveICCKeyOptionB(imk, short, "01")
+	if err != nil || !reflect.DeepEqual(b, a) {
+		t.Errorf("DeriveICCKeyOptionB(short) = %X, %v, want %X", b, err, a)
+	}
+
+	b, err = DeriveICCKeyOptionB(imk, long, "01")
+	if err != nil {
+		t.Fatalf("DeriveICCKeyOptionB() error = %v", err)
+	}
+	got, err = DeriveICCKeyForPAN(imk, long, "01", false)
+	if err != nil || !reflect.DeepEqual(got, b) {
+		t.Errorf("DeriveICCKeyForPAN(long) = %X, %v, want %X", got, err, b)
+	}
+
+	c, err := DeriveICCKeyOptionC(aesIMK, long, "01")
+	if err != nil {
+		t.Fatalf("DeriveICCKeyOptionC() error = %v", err)
+	}
+	got, err = DeriveICCKeyForPAN(aesIMK, long, "01", true)
+	if err != nil || !reflect.DeepEqual(got, c) {
+		t.Errorf("DeriveICCKeyForPAN(aes) = %X, %v, want %X", got, err, c)
+	}
+}
@@ -0,0 +1,54 @@
+package cryptoutils
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/sha1" //nolint:gosec // HMAC-SHA1 remains an approved MAC.
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+// ErrUnsupportedHash is returned for a hash function HMAC is not available with.
+var ErrUnsupportedHash = errors.New("unsupported hash function")
+
+// hmacHashes lists the hash functions HMAC is computed with.
+var hmacHashes = map[crypto.Hash]func() hash.Hash{
+	crypto.SHA1:   sha1.New,
+	crypto.SHA224: sha256.New224,
+	crypto.SHA256: sha256.New,
+	crypto.SHA384: sha512.New384,
+	crypto.SHA512: sha512.New,
+}
+
+// HMAC computes the full HMAC (RFC 2104) over msg under key with the hash function h, one
+// of SHA-1, SHA-224, SHA-256, SHA-384 or SHA-512.
+func HMAC(h crypto.Hash, key, msg []byte) ([]byte, error) {
+	newHash, ok := hmacHashes[h]
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedHash, h)
+	}
+	if len(key) == 0 {
+		return nil, errors.New("hmac key must not be empty")
+	}
+	m := hmac.New(newHash, key)
+	m.Write(msg)
+
+	return m.Sum(nil), nil
+}
+
+// VerifyHMAC reports whether mac matches the HMAC over msg under key with the hash function
+// h, truncated to the length of mac. mac must not be empty or longer than the hash output.
+func VerifyHMAC(h crypto.Hash, key, msg, mac []byte) (bool, error) {
+	full, err := HMAC(h, key, msg)
+	if err != nil {
+		return false, err
+	}
+	if len(mac) == 0 || len(mac) > len(full) {
+		return false, fmt.Errorf("invalid HMAC length %d", len(mac))
+	}
+
+	return hmac.Equal(mac, full[:len(mac)]), nil
+}
@@ -0,0 +1,51 @@
+package cryptoutils
+
+import (
+	"crypto"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestHMAC(t *testing.T) {
+	// RFC 2202 and RFC 4231 test case 2.
+	key := []byte("Jefe")
+	msg := []byte("what do ya want for nothing?")
+	tests := []struct {
+		hash crypto.Hash
+		want string
+	}{
+		{crypto.SHA1, "effcdf6ae5eb2fa2d27416d5f184df9c259a7c79"},
+		{crypto.SHA224, "a30e01098bc6dbbf45690f3a7e9e6d0f8bbea2a39e6148008fd05e44"},
+		{crypto.SHA256, "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"},
+		{crypto.SHA384, "af45d2e376484031617f78d2b58a6b1b9c7ef464f5a01b47" +
+			"e42ec3736322445e8e2240ca5e69e2c78b3239ecfab21649"},
+		{crypto.SHA512, "164b7a7bfcf819e2e395fbe73b56e0a387bd64222e831fd610270cd7ea250554" +
+			"9758bf75c05a994a6d034f65f8f0e6fdcaeab1a34d4a6b4b636e070a38bce737"},
+	}
+	for _, tt := range tests {
+		got, err := HMAC(tt.hash, key, msg)
+		if err != nil {
+			t.Fatalf("HMAC(%v) error = %v", tt.hash, err)
+		}
+		if hex.EncodeToString(got) != tt.want {
+			t.Errorf("HMAC(%v) = %x, want %s", tt.hash, got, tt.want)
+		}
+
+		ok, err := VerifyHMAC(tt.hash, key, msg, got[:10])
+		if err != nil || !ok {
+			t.Errorf("VerifyHMAC(%v) truncated = %v, %v, want true", tt.hash, ok, err)
+		}
+		got[0] ^= 1
+		if ok, _ := VerifyHMAC(tt.hash, key, msg, got); ok {
+			t.Errorf("VerifyHMAC(%v) with a modified HMAC = true, want false", tt.hash)
+		}
+	}
+
+	if _, err := HMAC(crypto.MD5, key, msg); !errors.Is(err, ErrUnsupportedHash) {
+		t.Errorf("HMAC(MD5) error = %v, want ErrUnsupportedHash", err)
+	}
+	if _, err := VerifyHMAC(crypto.SHA1, key, msg, make([]byte, 21)); err == nil {
+		t.Error("VerifyHMAC() with an over-long HMAC want error, got nil")
+	}
+}
@@ -0,0 +1,63 @@
+package cryptoutils
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
+)
+
+// IBM 3624 PIN lengths.
+const (
+	IBM3624MinPINLength = 4
+	IBM3624MaxPINLength = 12
+)
+
+// GetIBM3624NaturalPIN derives the IBM 3624 natural PIN of pinLen digits: the validation
+// data (16H) is encrypted under the PVK (8 or 16 bytes) and the result decimalized through
+// the 16-digit decimalization table.
+func GetIBM3624NaturalPIN(pvk []byte, validationData, decTable string, pinLen int) (string, error) {
+	if pinLen < IBM3624MinPINLength || pinLen > IBM3624MaxPINLength {
+		return "", fmt.Errorf("invalid PIN length %d", pinLen)
+	}
+	if len(pvk) != 8 && len(pvk) != 16 {
+		return "", fmt.Errorf("pvk must be 8 or 16 bytes, got %d", len(pvk))
+	}
+	data, err := hex.DecodeString(validationData)
+	if err != nil || len(data) != 8 {
+		return "", fmt.Errorf("validation data must be 16 hex digits, got %q", validationData)
+	}
+	dec, err := NewTableDecimalizer(decTable, false)
+	if err != nil {
+		return "", err
+	}
+
+	block, err := cryptoprovider.NewTripleDESCipher(PrepareTripleDESKey(pvk))
+	if err != nil {
+		return "", err
+	}
+	encrypted := make([]byte, 8)
+	block.Encrypt(encrypted, data)
+
+	return dec.Digits(Raw2Str(encrypted), pinLen)
+}
+
+// GetIBM3624Offset calculates the IBM 3624 PIN offset of pin: each offset digit is the PIN
+// digit minus the natural PIN digit, modulo 10. The offset has as many digits as pin; an
+// offset verifies the leftmost digits of a PIN when calculated over those digits only.
+func GetIBM3624Offset(pvk []byte, validationData, decTable, pin string) (string, error) {
+	natural, err := GetIBM3624NaturalPIN(pvk, validationData, decTable, len(pin))
+	if err != nil {
+		return "", err
+	}
+
+	offset := make([]byte, len(pin))
+	for i := range pin {
+		if pin[i] < '0' || pin[i] > '9' {
+			return "", fmt.Errorf("invalid PIN digit %q", pin[i])
+		}
+		offset[i] = '0' + (pin[i]-natural[i]+10)%10
+	}
+
+	return string(offset), nil
+}
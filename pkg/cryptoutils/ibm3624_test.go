@@ -0,0 +1,64 @@
+package cryptoutils
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestIBM3624Offset(t *testing.T) {
+	pvk, _ := hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+	const (
+		validationData = "1234567890123456" // encrypts to A92FD76424820AD1.
+		decTable       = "0123456789012345"
+	)
+
+	tests := []struct {
+		name    string
+		pin     string
+		natural string
+		offset  string
+	}{
+		{"4 digit PIN", "1234", "0925", "1319"},
+		{"6 digit PIN", "123456", "092537", "131929"},
+		{"PIN equal to natural PIN", "09253764", "09253764", "00000000"},
+		{"12 digit PIN", "000000000000", "092537642482", "018573468628"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			natural, err := GetIBM3624NaturalPIN(pvk, validationData, decTable, len(tt.pin))
+			if err != nil || natural != tt.natural {
+				t.Errorf("GetIBM3624NaturalPIN() = %s, %v, want %s", natural, err, tt.natural)
+			}
+			offset, err := GetIBM3624Offset(pvk, validationData, decTable, tt.pin)
+			if err != nil || offset != tt.offset {
+				t.Errorf("GetIBM3624Offset() = %s, %v, want %s", offset, err, tt.offset)
+			}
+		})
+	}
+
+	// A single-length PVK is used as single DES.
+	offset, err := GetIBM3624Offset(pvk[:8], validationData, decTable, "1234")
+	if err != nil || len(offset) != 4 {
+		t.Errorf("GetIBM3624Offset() single length = %s, %v", offset, err)
+	}
+
+	invalid := []struct {
+		name           string
+		pvk            []byte
+		validationData string
+		decTable       string
+		pin            string
+	}{
+		{"short PIN", pvk, validationData, decTable, "123"},
+		{"long PIN", pvk, validationData, decTable, "1234567890123"},
+		{"non-numeric PIN", pvk, validationData, decTable, "12A4"},
+		{"short validation data", pvk, validationData[:12], decTable, "1234"},
+		{"invalid decimalization table", pvk, validationData, "0123456789ABCDEF", "1234"},
+		{"triple-length PVK", append(pvk, pvk[:8]...), validationData, decTable, "1234"},
+	}
+	for _, tt := range invalid {
+		if _, err := GetIBM3624Offset(tt.pvk, tt.validationData, tt.decTable, tt.pin); err == nil {
+			t.Errorf("GetIBM3624Offset() with %s want error, got nil", tt.name)
+		}
+	}
+}
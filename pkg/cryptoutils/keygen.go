@@ -0,0 +1,257 @@
+package cryptoutils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
+)
+
+// KeyGenerator is the random bit generator of key material.
+type KeyGenerator interface {
+	// Generate fills b with random bytes.
+	Generate(b []byte) error
+}
+
+// ProviderKeyGenerator reads keys directly from the random source of the default
+// cryptoprovider.Provider, crypto/rand for the Stdlib provider. It is the default
+// KeyGenerator.
+type ProviderKeyGenerator struct{}
+
+// Generate implements KeyGenerator.
+func (ProviderKeyGenerator) Generate(b []byte) error {
+	_, err := cryptoprovider.Read(b)
+
+	return err
+}
+
+var keyGenerator atomic.Pointer[KeyGenerator]
+
+// DefaultKeyGenerator returns the key generator in use, ProviderKeyGenerator unless
+// SetKeyGenerator installed another one.
+func DefaultKeyGenerator() KeyGenerator {
+	if g := keyGenerator.Load(); g != nil {
+		return *g
+	}
+
+	return ProviderKeyGenerator{}
+}
+
+// SetKeyGenerator installs g as the generator of all subsequent random keys; nil restores
+// ProviderKeyGenerator.
+func SetKeyGenerator(g KeyGenerator) {
+	if g == nil {
+		keyGenerator.Store(nil)
+
+		return
+	}
+	keyGenerator.Store(&g)
+}
+
+// CTR_DRBG parameters for AES-256 (SP 800-90A Rev. 1, Table 3).
+const (
+	// DRBGSeedSize is the length of the entropy input, personalization string and additional
+	// input of CTRDRBG: the 256-bit key plus the 128-bit counter block.
+	DRBGSeedSize = drbgKeySize + drbgBlockSize
+	// DRBGMaxRequest is the largest output of a single generate request in bytes (2^19 bits).
+	DRBGMaxRequest = 1 << 16
+
+	drbgKeySize        = 32
+	drbgBlockSize      = 16
+	drbgReseedInterval = 1 << 48
+)
+
+// ErrDRBGEntropy indicates that the entropy source of a CTRDRBG failed or, for a
+// deterministic DRBG, ran out of entropy input.
+var ErrDRBGEntropy = errors.New("drbg entropy source failed")
+
+// CTRDRBG is a NIST SP 800-90A Rev. 1 CTR_DRBG using AES-256 without a derivation function,
+// so its entropy input must be full entropy. It reseeds from its entropy source every
+// reseed interval. The AES cipher comes from the default cryptoprovider.Provider. A CTRDRBG
+// is safe for concurrent use.
+type CTRDRBG struct {
+	mu            sync.Mutex
+	entropy       io.Reader
+	key           []byte
+	v             [drbgBlockSize]byte
+	reseedCounter uint64
+}
+
+// NewCTRDRBG instantiates a CTR_DRBG from DRBGSeedSize bytes of entropy and an optional
+// personalization string of at most DRBGSeedSize bytes. A nil entropy source uses the random
+// source of the default cryptoprovider.Provider.
+func NewCTRDRBG(entropy io.Reader, personalization []byte) (*CTRDRBG, error) {
+	if entropy == nil {
+		entropy = cryptoprovider.Reader()
+	}
+	if len(personalization) > DRBGSeedSize {
+		return nil, fmt.Errorf(
+			"personalization string too long: %d bytes, maximum %d",
+			len(personalization),
+			DRBGSeedSize,
+		)
+	}
+
+	d := &CTRDRBG{entropy: entropy, key: make([]byte, drbgKeySize)}
+	seed, err := d.seed(personalization)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.update(seed); err != nil {
+		return nil, err
+	}
+	d.reseedCounter = 1
+
+	return d, nil
+}
+
+// NewDeterministicCTRDRBG instantiates a CTR_DRBG whose entropy input is read from entropy,
+// the concatenated entropy inputs of instantiation and every reseed. Its output is fully
+// determined by its inputs, for known-answer tests and reproducible test vectors only; it
+// fails with ErrDRBGEntropy once entropy is exhausted.
+func NewDeterministicCTRDRBG(entropy, personalization []byte) (*CTRDRBG, error) {
+	return NewCTRDRBG(bytes.NewReader(entropy), personalization)
+}
+
+// Generate implements KeyGenerator. Requests larger than DRBGMaxRequest are split.
+func (d *CTRDRBG) Generate(b []byte) error {
+	for len(b) > 0 {
+		n := min(len(b), DRBGMaxRequest)
+		if err := d.GenerateAdditional(b[:n], nil); err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+
+	return nil
+}
+
+// GenerateAdditional fills b, at most DRBGMaxRequest bytes, with the output of one generate
+// request with optional additional input of at most DRBGSeedSize bytes.
+func (d *CTRDRBG) GenerateAdditional(b, additionalInput []byte) error {
+	if len(b) > DRBGMaxRequest {
+		return fmt.Errorf("drbg request too large: %d bytes, maximum %d", len(b), DRBGMaxRequest)
+	}
+	input, err := padSeed(additionalInput)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.reseedCounter > drbgReseedInterval {
+		if err := d.reseed(input); err != nil {
+			return err
+		}
+		input = make([]byte, DRBGSeedSize)
+	} else if len(additionalInput) > 0 {
+		if err := d.update(input); err != nil {
+			return err
+		}
+	}
+
+	block, err := cryptoprovider.NewAESCipher(d.key)
+	if err != nil {
+		return err
+	}
+	for off := 0; off < len(b); off += drbgBlockSize {
+		var out [drbgBlockSize]byte
+		increment(&d.v)
+		block.Encrypt(out[:], d.v[:])
+		copy(b[off:], out[:])
+	}
+	if err := d.update(input); err != nil {
+		return err
+	}
+	d.reseedCounter++
+
+	return nil
+}
+
+// Reseed reseeds the DRBG from its entropy source with optional additional input of at most
+// DRBGSeedSize bytes.
+func (d *CTRDRBG) Reseed(additionalInput []byte) error {
+	input, err := padSeed(additionalInput)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.reseed(input)
+}
+
+// reseed implements CTR_DRBG_Reseed_algorithm (10.2.1.4.1); d.mu must be held.
+func (d *CTRDRBG) reseed(additionalInput []byte) error {
+	seed, err := d.seed(additionalInput)
+	if err != nil {
+		return err
+	}
+	if err := d.update(seed); err != nil {
+		return err
+	}
+	d.reseedCounter = 1
+
+	return nil
+}
+
+// seed reads entropy input and XORs it with input, zero padded to DRBGSeedSize.
+func (d *CTRDRBG) seed(input []byte) ([]byte, error) {
+	seed := make([]byte, DRBGSeedSize)
+	if _, err := io.ReadFull(d.entropy, seed); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDRBGEntropy, err)
+	}
+	for i, b := range input {
+		seed[i] ^= b
+	}
+
+	return seed, nil
+}
+
+// update implements CTR_DRBG_Update (10.2.1.2) with provided data of DRBGSeedSize bytes.
+func (d *CTRDRBG) update(provided []byte) error {
+	block, err := cryptoprovider.NewAESCipher(d.key)
+	if err != nil {
+		return err
+	}
+
+	temp := make([]byte, DRBGSeedSize)
+	for off := 0; off < len(temp); off += drbgBlockSize {
+		increment(&d.v)
+		block.Encrypt(temp[off:], d.v[:])
+	}
+	for i := range temp {
+		temp[i] ^= provided[i]
+	}
+	d.key = temp[:drbgKeySize]
+	copy(d.v[:], temp[drbgKeySize:])
+
+	return nil
+}
+
+// padSeed returns input zero padded to DRBGSeedSize bytes.
+func padSeed(input []byte) ([]byte, error) {
+	if len(input) > DRBGSeedSize {
+		return nil, fmt.Errorf("drbg input too long: %d bytes, maximum %d", len(input), DRBGSeedSize)
+	}
+	padded := make([]byte, DRBGSeedSize)
+	copy(padded, input)
+
+	return padded, nil
+}
+
+// increment increments the counter block v as a big-endian integer.
+func increment(v *[drbgBlockSize]byte) {
+	for i := len(v) - 1; i >= 0; i-- {
+		v[i]++
+		if v[i] != 0 {
+			return
+		}
+	}
+}
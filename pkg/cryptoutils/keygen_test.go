@@ -0,0 +1,91 @@
+package cryptoutils
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// sequence returns n bytes counting up from first.
+func sequence(first byte, n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = first + byte(i)
+	}
+
+	return b
+}
+
+func TestCTRDRBGKnownAnswer(t *testing.T) {
+	// The CTR_DRBG known-answer test of the Go FIPS 140-3 module: instantiate, reseed with
+	// additional input and generate with additional input.
+	entropy := append(sequence(0x01, DRBGSeedSize), sequence(0x31, DRBGSeedSize)...)
+	additional := sequence(0x61, DRBGSeedSize)
+	want := "6e6e479d24f86a3b7787a8f8186d985a53bebeeddeab9228f0f4ac6e10bf0193"
+
+	d, err := NewDeterministicCTRDRBG(entropy, nil)
+	if err != nil {
+		t.Fatalf("NewDeterministicCTRDRBG() error = %v", err)
+	}
+	if err := d.Reseed(additional); err != nil {
+		t.Fatalf("Reseed() error = %v", err)
+	}
+	got := make([]byte, 32)
+	if err := d.GenerateAdditional(got, additional); err != nil {
+		t.Fatalf("GenerateAdditional() error = %v", err)
+	}
+	if hex.EncodeToString(got) != want {
+		t.Errorf("GenerateAdditional() = %x, want %s", got, want)
+	}
+
+	if err := d.Reseed(nil); !errors.Is(err, ErrDRBGEntropy) {
+		t.Errorf("Reseed() with exhausted entropy error = %v, want ErrDRBGEntropy", err)
+	}
+	if err := d.GenerateAdditional(make([]byte, DRBGMaxRequest+1), nil); err == nil {
+		t.Error("GenerateAdditional() of an oversized request succeeded")
+	}
+}
+
+func TestDeterministicKeyGenerator(t *testing.T) {
+	generate := func(personalization string) []byte {
+		t.Helper()
+
+		d, err := NewDeterministicCTRDRBG(sequence(0, DRBGSeedSize), []byte(personalization))
+		if err != nil {
+			t.Fatalf("NewDeterministicCTRDRBG() error = %v", err)
+		}
+		SetKeyGenerator(d)
+		defer SetKeyGenerator(nil)
+
+		key, err := GenerateRandomKey(16)
+		if err != nil {
+			t.Fatalf("GenerateRandomKey() error = %v", err)
+		}
+		if !CheckKeyParity(key) {
+			t.Errorf("GenerateRandomKey() = %X without odd parity", key)
+		}
+
+		return key
+	}
+
+	first := generate("test")
+	if !bytes.Equal(first, generate("test")) {
+		t.Error("deterministic key generator is not reproducible")
+	}
+	if bytes.Equal(first, generate("other")) {
+		t.Error("personalization string does not change the output")
+	}
+	if _, ok := DefaultKeyGenerator().(ProviderKeyGenerator); !ok {
+		t.Errorf("SetKeyGenerator(nil) left %T installed", DefaultKeyGenerator())
+	}
+
+	d, err := NewCTRDRBG(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCTRDRBG() error = %v", err)
+	}
+	large := make([]byte, DRBGMaxRequest+drbgBlockSize+1)
+	if err := d.Generate(large); err != nil {
+		t.Errorf("Generate() of %d bytes error = %v", len(large), err)
+	}
+}
@@ -1,10 +1,11 @@
 package cryptoutils
 
 import (
-	"crypto/aes"
-	"crypto/des"
 	"errors"
 	"fmt"
+	"slices"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
 )
 
 // CalculateMAC computes an s-byte MAC (4 ≤ s ≤ 8) over msg using
@@ -20,17 +21,45 @@ func CalculateMAC(msg, ks []byte, s, algo int) ([]byte, error) {
 		return nil, fmt.Errorf("ks must be 8 or 16 bytes, got %d", len(ks))
 	}
 
-	// 1. split into 8-byte blocks
-	blocks := Chunk(msg, 8)
+	h, err := CBCMACChain(msg, ks[:8], nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(ks) == 8 {
+		algo = 1
+	}
+	result, err := CBCMACFinal(h, ks, algo)
+	if err != nil {
+		return nil, err
+	}
 
-	// 2. CBC-3DES with k1 (prepared as triple-length) and zero IV
+	return result[:s], nil
+}
+
+// CBCMACChain runs single DES CBC under the 8-byte key k1 over msg, which must be a multiple
+// of 8 bytes, starting from the chaining value iv (zeros when nil), and returns the last
+// chaining value. A long message can be MACed in pieces by passing each result as the iv of
+// the next piece.
+func CBCMACChain(msg, k1, iv []byte) ([]byte, error) {
+	if len(k1) != 8 {
+		return nil, fmt.Errorf("k1 must be 8 bytes, got %d", len(k1))
+	}
+	if len(msg)%8 != 0 {
+		return nil, fmt.Errorf("message length %d is not a multiple of 8", len(msg))
+	}
 	h := make([]byte, 8)
-	k1 := ks[:8]
-	cipher1, err := des.NewTripleDESCipher(PrepareTripleDESKey(k1))
+	if iv != nil {
+		if len(iv) != 8 {
+			return nil, fmt.Errorf("iv must be 8 bytes, got %d", len(iv))
+		}
+		copy(h, iv)
+	}
+
+	cipher1, err := cryptoprovider.NewTripleDESCipher(PrepareTripleDESKey(k1))
 	if err != nil {
 		return nil, err
 	}
-	for _, x := range blocks {
+	for _, x := range Chunk(msg, 8) {
 		xorIn, err := XORBytes(x, h)
 		if err != nil {
 			return nil, err
@@ -38,121 +67,104 @@ func CalculateMAC(msg, ks []byte, s, algo int) ([]byte, error) {
 		cipher1.Encrypt(h, xorIn)
 	}
 
-	// 3. Final transform
-	var result []byte
-	switch {
-	case algo == 1, len(ks) == 8:
-		// Alg 1: just take h
-		result = h
-	case algo == 3:
-		k2 := ks[8:16]
-		cipher2, err := des.NewTripleDESCipher(PrepareTripleDESKey(k2))
+	return h, nil
+}
+
+// CBCMACFinal applies the ISO/IEC 9797-1 output transformation of MAC algorithm 1 or 3
+// (algo == 1 or 3) to the last chaining value h under ks (8 or 16 bytes). Algorithm 3 needs
+// a 16-byte key.
+func CBCMACFinal(h, ks []byte, algo int) ([]byte, error) {
+	switch algo {
+	case 1:
+		return slices.Clone(h), nil
+	case 3:
+		if len(ks) != 16 {
+			return nil, fmt.Errorf("algorithm 3 requires a 16 byte key, got %d", len(ks))
+		}
+		cipher1, err := cryptoprovider.NewTripleDESCipher(PrepareTripleDESKey(ks[:8]))
+		if err != nil {
+			return nil, err
+		}
+		cipher2, err := cryptoprovider.NewTripleDESCipher(PrepareTripleDESKey(ks[8:16]))
 		if err != nil {
 			return nil, err
 		}
 		tmp := make([]byte, 8)
 		cipher2.Decrypt(tmp, h)
 		cipher1.Encrypt(tmp, tmp)
-		result = tmp
+
+		return tmp, nil
 	default:
 		return nil, errors.New("unknown algorithm, must be 1 or 3")
 	}
+}
 
-	return result[:s], nil
+// X99MAC computes an ANSI X9.9 MAC: single DES CBC-MAC with zero padding
+// (ISO/IEC 9797-1 MAC algorithm 1, padding method 1) under the 8-byte key ks.
+func X99MAC(msg, ks []byte) ([]byte, error) {
+	if len(ks) != 8 {
+		return nil, fmt.Errorf("x9.9 requires an 8 byte key, got %d", len(ks))
+	}
+
+	return CalculateMAC(padISO9797Method1(msg, 8), ks, 8, 1)
+}
+
+// X919MAC computes an ANSI X9.19 retail MAC with zero padding
+// (ISO/IEC 9797-1 MAC algorithm 3, padding method 1) under the 16-byte key ks.
+func X919MAC(msg, ks []byte) ([]byte, error) {
+	if len(ks) != 16 {
+		return nil, fmt.Errorf("x9.19 requires a 16 byte key, got %d", len(ks))
+	}
+
+	return CalculateMAC(padISO9797Method1(msg, 8), ks, 8, 3)
 }
 
 // CMAC computes an s-byte AES-CMAC (4 ≤ s ≤ 8) over msg using key ks.
 // Implements ISO/IEC 9797-1 Algorithm 5 (CMAC).
 func CMAC(msg, ks []byte, s int) ([]byte, error) {
-	const blockSize = aes.BlockSize // 16
 	if s < 4 || s > 8 {
 		return nil, fmt.Errorf("invalid MAC length %d", s)
 	}
-	if len(ks) != 16 && len(ks) != 24 && len(ks) != 32 {
-		return nil, fmt.Errorf("AES key must be 16/24/32 bytes, got %d", len(ks))
-	}
-
-	// 1. derive subkeys k1, k2
-	k1, k2, err := deriveSubkeys(ks)
+	mac, err := AESCMAC(msg, ks)
 	if err != nil {
 		return nil, err
 	}
 
-	// 2. pad & mask final block
-	var blocks [][]byte
-	if len(msg)%blockSize == 0 {
-		blocks = Chunk(msg, blockSize)
-		last, err := XORBytes(blocks[len(blocks)-1], k1)
-		if err != nil {
-			return nil, err
-		}
-		blocks[len(blocks)-1] = last
-	} else {
-		padded := padISO9797Method2(msg, blockSize)
-		blocks = Chunk(padded, blockSize)
-		last, err := XORBytes(blocks[len(blocks)-1], k2)
-		if err != nil {
-			return nil, err
-		}
-		blocks[len(blocks)-1] = last
-	}
+	return mac[:s], nil
+}
 
-	// 3. CBC-AES with zero IV
-	cipherBlock, err := aes.NewCipher(ks)
-	if err != nil {
-		return nil, err
+// AESCMAC computes the full 16-byte AES-CMAC (NIST SP 800-38B) over a non-empty msg using
+// key ks.
+func AESCMAC(msg, ks []byte) ([]byte, error) {
+	if len(msg) == 0 {
+		return nil, errors.New("cmac message must not be empty")
 	}
-	h := make([]byte, blockSize)
-	for _, x := range blocks {
-		xorIn, err := XORBytes(x, h)
-		if err != nil {
-			return nil, err
-		}
-		cipherBlock.Encrypt(h, xorIn)
+	if len(ks) != 16 && len(ks) != 24 && len(ks) != 32 {
+		return nil, fmt.Errorf("AES key must be 16/24/32 bytes, got %d", len(ks))
 	}
 
-	return h[:s], nil
+	return cryptoprovider.AESCMAC(ks, msg)
 }
 
-// deriveSubkeys generates AES-CMAC subkeys k1, k2 per NIST SP 800-38B.
-func deriveSubkeys(key []byte) ([]byte, []byte, error) {
-	const blockSize = aes.BlockSize
-	cipherBlock, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, nil, err
+// ComponentKCVMAC computes a 4-byte combined check value over a set of component key
+// check values using ISO/IEC 9797-1 MAC algorithm 3 with padding method 2 under the
+// double-length key ks. The KCVs are MACed in the order given so custodians can confirm
+// the full component set without revealing any component.
+func ComponentKCVMAC(kcvs [][]byte, ks []byte) ([]byte, error) {
+	if len(kcvs) == 0 {
+		return nil, errors.New("no component check values")
 	}
-	zero := make([]byte, blockSize)
-	l := make([]byte, blockSize)
-	cipherBlock.Encrypt(l, zero)
-
-	// Rb constant
-	const rb = 0x87
-
-	k1 := make([]byte, blockSize)
-	var carry byte
-	// k1 = l << 1
-	for i := blockSize - 1; i >= 0; i-- {
-		b := l[i]
-		k1[i] = (b << 1) | carry
-		carry = (b >> 7) & 1
-	}
-	// if msb(l) == 1, k1 ^= Rb
-	if (l[0] >> 7) == 1 {
-		k1[blockSize-1] ^= rb
+	if len(ks) != 16 {
+		return nil, fmt.Errorf("ks must be 16 bytes, got %d", len(ks))
 	}
 
-	k2 := make([]byte, blockSize)
-	carry = 0
-	// k2 = k1 << 1
-	for i := blockSize - 1; i >= 0; i-- {
-		b := k1[i]
-		k2[i] = (b << 1) | carry
-		carry = (b >> 7) & 1
-	}
-	// if msb(k1) == 1, k2 ^= Rb
-	if (k1[0] >> 7) == 1 {
-		k2[blockSize-1] ^= rb
+	var data []byte
+	for _, kcv := range kcvs {
+		if len(kcv) == 0 {
+			return nil, errors.New("empty component check value")
+		}
+		data = append(data, kcv...)
 	}
 
-	return k1, k2, nil
+	return CalculateMAC(padISO9797Method2(data, 8), ks, 4, 3)
 }
@@ -1,5 +1,100 @@
 //nolint:all // test package
 package cryptoutils
 
-// MAC tests will be added here when MAC functionality is tested.
-// Currently, no tests exist for MAC functions in the original cryptoutils_test.go.
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestComponentKCVMAC(t *testing.T) {
+	ks, _ := hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+	kcvs := [][]byte{{0x08, 0xD7, 0xB4}, {0xD2, 0xDB, 0x51}, {0x1F, 0xA2, 0x4C}}
+
+	mac, err := ComponentKCVMAC(kcvs, ks)
+	if err != nil {
+		t.Fatalf("ComponentKCVMAC() error = %v", err)
+	}
+	if len(mac) != 4 {
+		t.Fatalf("ComponentKCVMAC() length = %d, want 4", len(mac))
+	}
+
+	want, _ := CalculateMAC(padISO9797Method2(bytes.Join(kcvs, nil), 8), ks, 4, 3)
+	if !bytes.Equal(mac, want) {
+		t.Errorf("ComponentKCVMAC() = %X, want %X", mac, want)
+	}
+
+	reordered := [][]byte{kcvs[1], kcvs[0], kcvs[2]}
+	other, _ := ComponentKCVMAC(reordered, ks)
+	if bytes.Equal(mac, other) {
+		t.Error("ComponentKCVMAC() must depend on component order")
+	}
+
+	if _, err := ComponentKCVMAC(nil, ks); err == nil {
+		t.Error("ComponentKCVMAC(nil) want error, got nil")
+	}
+	if _, err := ComponentKCVMAC(kcvs, ks[:8]); err == nil {
+		t.Error("ComponentKCVMAC() with single length key want error, got nil")
+	}
+}
+
+func TestX9MACs(t *testing.T) {
+	msg := []byte("Now is the time for all ")
+	ks, _ := hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+
+	tests := []struct {
+		name string
+		fn   func([]byte, []byte) ([]byte, error)
+		key  []byte
+		want string
+	}{
+		{"X9.9", X99MAC, ks[:8], "70A30640CC76DD8B"},
+		{"X9.19", X919MAC, ks, "A1C72E74EA3FA9B6"},
+	}
+	for _, tt := range tests {
+		got, err := tt.fn(msg, tt.key)
+		if err != nil {
+			t.Fatalf("%s error = %v", tt.name, err)
+		}
+		if hex.EncodeToString(got) != strings.ToLower(tt.want) {
+			t.Errorf("%s = %X, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := X99MAC(msg, ks); err == nil {
+		t.Error("X99MAC() with double length key want error, got nil")
+	}
+	if _, err := X919MAC(msg, ks[:8]); err == nil {
+		t.Error("X919MAC() with single length key want error, got nil")
+	}
+}
+
+func TestCBCMACChain(t *testing.T) {
+	msg := []byte("Now is the time for all ")
+	ks, _ := hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+
+	// Chaining a message in pieces gives the same MAC as a single pass.
+	h, err := CBCMACChain(msg[:8], ks[:8], nil)
+	if err != nil {
+		t.Fatalf("CBCMACChain() error = %v", err)
+	}
+	h, err = CBCMACChain(msg[8:], ks[:8], h)
+	if err != nil {
+		t.Fatalf("CBCMACChain() error = %v", err)
+	}
+	got, err := CBCMACFinal(h, ks, 3)
+	if err != nil {
+		t.Fatalf("CBCMACFinal() error = %v", err)
+	}
+	if hex.EncodeToString(got) != "a1c72e74ea3fa9b6" {
+		t.Errorf("chained X9.19 MAC = %X, want A1C72E74EA3FA9B6", got)
+	}
+
+	if _, err := CBCMACChain(msg[:5], ks[:8], nil); err == nil {
+		t.Error("CBCMACChain() with a partial block want error, got nil")
+	}
+	if _, err := CBCMACFinal(h, ks[:8], 3); err == nil {
+		t.Error("CBCMACFinal() algorithm 3 with single length key want error, got nil")
+	}
+}
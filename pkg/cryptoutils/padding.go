@@ -0,0 +1,167 @@
+package cryptoutils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// PadMode selects the padding of data encrypted by the data encryption commands. The values
+// are the single-character codes of their pad mode field.
+type PadMode byte
+
+// Pad modes.
+const (
+	// PadModeNone requires data to be a multiple of the block size.
+	PadModeNone PadMode = '0'
+	// PadModeISO9797Method1 appends zero bytes (ISO/IEC 9797-1 method 1).
+	PadModeISO9797Method1 PadMode = '1'
+	// PadModeISO9797Method2 appends 0x80 and zero bytes (ISO/IEC 9797-1 method 2).
+	PadModeISO9797Method2 PadMode = '2'
+	// PadModePKCS7 appends N bytes of value N (PKCS#7, RFC 5652).
+	PadModePKCS7 PadMode = '3'
+	// PadModeX923 appends N-1 zero bytes and a final byte N (ANSI X9.23).
+	PadModeX923 PadMode = '4'
+)
+
+// ErrInvalidPadding indicates data whose padding does not match the pad mode.
+var ErrInvalidPadding = errors.New("invalid padding")
+
+// ParsePadMode validates a pad mode field.
+func ParsePadMode(b byte) (PadMode, error) {
+	switch m := PadMode(b); m {
+	case PadModeNone, PadModeISO9797Method1, PadModeISO9797Method2, PadModePKCS7, PadModeX923:
+		return m, nil
+	default:
+		return 0, fmt.Errorf("unsupported pad mode %q", b)
+	}
+}
+
+// Pad pads data to a multiple of blockSize with the given mode.
+func Pad(data []byte, blockSize int, mode PadMode) ([]byte, error) {
+	if blockSize <= 0 || blockSize > 255 {
+		return nil, fmt.Errorf("invalid block size %d", blockSize)
+	}
+
+	switch mode {
+	case PadModeNone:
+		if len(data) == 0 || len(data)%blockSize != 0 {
+			return nil, fmt.Errorf("%w: data length %d is not a multiple of %d",
+				ErrInvalidPadding, len(data), blockSize)
+		}
+
+		return data, nil
+	case PadModeISO9797Method1:
+		return padISO9797Method1(data, blockSize), nil
+	case PadModeISO9797Method2:
+		return padISO9797Method2(data, blockSize), nil
+	case PadModePKCS7:
+		return PadPKCS7(data, blockSize), nil
+	case PadModeX923:
+		return PadX923(data, blockSize), nil
+	default:
+		return nil, fmt.Errorf("unsupported pad mode %q", byte(mode))
+	}
+}
+
+// Unpad removes the padding added by Pad. ISO/IEC 9797-1 method 1 padding cannot be told
+// apart from trailing zero data bytes, so data padded that way is returned unchanged.
+func Unpad(data []byte, blockSize int, mode PadMode) ([]byte, error) {
+	if blockSize <= 0 || blockSize > 255 {
+		return nil, fmt.Errorf("invalid block size %d", blockSize)
+	}
+	if len(data) == 0 || len(data)%blockSize != 0 {
+		return nil, fmt.Errorf("%w: data length %d is not a multiple of %d",
+			ErrInvalidPadding, len(data), blockSize)
+	}
+
+	switch mode {
+	case PadModeNone, PadModeISO9797Method1:
+		return data, nil
+	case PadModeISO9797Method2:
+		return unpadISO9797Method2(data, blockSize)
+	case PadModePKCS7:
+		return UnpadPKCS7(data, blockSize)
+	case PadModeX923:
+		return UnpadX923(data, blockSize)
+	default:
+		return nil, fmt.Errorf("unsupported pad mode %q", byte(mode))
+	}
+}
+
+// PadPKCS7 implements PKCS#7 padding: appends N bytes of value N, 1 <= N <= blockSize, so
+// data that is already a multiple of the block size gains a full block.
+func PadPKCS7(data []byte, blockSize int) []byte {
+	n := blockSize - len(data)%blockSize
+
+	return slices.Concat(data, bytes.Repeat([]byte{byte(n)}, n))
+}
+
+// UnpadPKCS7 removes PKCS#7 padding, checking every padding byte.
+func UnpadPKCS7(data []byte, blockSize int) ([]byte, error) {
+	n, err := paddingLength(data, blockSize)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range data[len(data)-n:] {
+		if int(b) != n {
+			return nil, fmt.Errorf("%w: PKCS#7 padding bytes differ", ErrInvalidPadding)
+		}
+	}
+
+	return data[:len(data)-n], nil
+}
+
+// PadX923 implements ANSI X9.23 padding: appends N-1 zero bytes and a final byte N,
+// 1 <= N <= blockSize.
+func PadX923(data []byte, blockSize int) []byte {
+	n := blockSize - len(data)%blockSize
+	padding := make([]byte, n)
+	padding[n-1] = byte(n)
+
+	return slices.Concat(data, padding)
+}
+
+// UnpadX923 removes ANSI X9.23 padding, checking that the filler bytes are zero.
+func UnpadX923(data []byte, blockSize int) ([]byte, error) {
+	n, err := paddingLength(data, blockSize)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range data[len(data)-n : len(data)-1] {
+		if b != 0 {
+			return nil, fmt.Errorf("%w: X9.23 filler bytes are not zero", ErrInvalidPadding)
+		}
+	}
+
+	return data[:len(data)-n], nil
+}
+
+// paddingLength returns the padding length N held in the last byte of data.
+func paddingLength(data []byte, blockSize int) (int, error) {
+	if len(data) == 0 || len(data)%blockSize != 0 {
+		return 0, fmt.Errorf("%w: data length %d is not a multiple of %d",
+			ErrInvalidPadding, len(data), blockSize)
+	}
+	n := int(data[len(data)-1])
+	if n == 0 || n > blockSize {
+		return 0, fmt.Errorf("%w: padding length %d", ErrInvalidPadding, n)
+	}
+
+	return n, nil
+}
+
+// unpadISO9797Method2 removes ISO/IEC 9797-1 method 2 padding: trailing zero bytes preceded
+// by 0x80 within the last block.
+func unpadISO9797Method2(data []byte, blockSize int) ([]byte, error) {
+	i := len(data) - 1
+	for i >= 0 && data[i] == 0 && len(data)-i <= blockSize {
+		i--
+	}
+	if i < 0 || data[i] != 0x80 || len(data)-i > blockSize {
+		return nil, fmt.Errorf("%w: no ISO 9797-1 method 2 padding marker", ErrInvalidPadding)
+	}
+
+	return data[:i], nil
+}
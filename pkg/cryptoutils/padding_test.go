@@ -0,0 +1,105 @@
+package cryptoutils
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestPadRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		mode   PadMode
+		data   string
+		padded string
+	}{
+		{"none", PadModeNone, "0011223344556677", "0011223344556677"},
+		{"iso 9797 method 2", PadModeISO9797Method2, "001122", "0011228000000000"},
+		{"iso 9797 method 2 marker ends block", PadModeISO9797Method2, "00112233445566", "0011223344556680"},
+		{"pkcs7", PadModePKCS7, "001122", "0011220505050505"},
+		{"pkcs7 full block", PadModePKCS7, "0011223344556677", "00112233445566770808080808080808"},
+		{"pkcs7 empty", PadModePKCS7, "", "0808080808080808"},
+		{"x9.23", PadModeX923, "001122", "0011220000000005"},
+		{"x9.23 one byte", PadModeX923, "00112233445566", "0011223344556601"},
+		{"x9.23 full block", PadModeX923, "0011223344556677", "00112233445566770000000000000008"},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			data, _ := hex.DecodeString(tc.data)
+			want, _ := hex.DecodeString(tc.padded)
+			padded, err := Pad(data, 8, tc.mode)
+			if err != nil {
+				t.Fatalf("Pad() error = %v", err)
+			}
+			if !bytes.Equal(padded, want) {
+				t.Fatalf("Pad() = %X, want %X", padded, want)
+			}
+			unpadded, err := Unpad(padded, 8, tc.mode)
+			if err != nil {
+				t.Fatalf("Unpad() error = %v", err)
+			}
+			if !bytes.Equal(unpadded, data) {
+				t.Errorf("Unpad() = %X, want %X", unpadded, data)
+			}
+		})
+	}
+}
+
+func TestUnpadInvalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		mode PadMode
+		data string
+	}{
+		{"pkcs7 zero length", PadModePKCS7, "0011223344556600"},
+		{"pkcs7 length over block", PadModePKCS7, "0011223344556609"},
+		{"pkcs7 mismatched bytes", PadModePKCS7, "0011223344050305"},
+		{"x9.23 non-zero filler", PadModeX923, "0011220000010005"},
+		{"x9.23 zero length", PadModeX923, "0011223344556600"},
+		{"iso 9797 method 2 no marker", PadModeISO9797Method2, "0011223344556677"},
+		{"iso 9797 method 2 all zero", PadModeISO9797Method2, "0000000000000000"},
+		{"partial block", PadModePKCS7, "00112203"},
+		{"empty", PadModeX923, ""},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			data, _ := hex.DecodeString(tc.data)
+			if _, err := Unpad(data, 8, tc.mode); !errors.Is(err, ErrInvalidPadding) {
+				t.Errorf("Unpad() error = %v, want ErrInvalidPadding", err)
+			}
+		})
+	}
+}
+
+func TestPadMode(t *testing.T) {
+	t.Parallel()
+
+	for _, b := range []byte("01234") {
+		if m, err := ParsePadMode(b); err != nil || byte(m) != b {
+			t.Errorf("ParsePadMode(%q) = %q, %v", b, m, err)
+		}
+	}
+	if _, err := ParsePadMode('9'); err == nil {
+		t.Error("expected error for pad mode 9")
+	}
+	if _, err := Pad([]byte{1, 2, 3}, 8, PadModeNone); !errors.Is(err, ErrInvalidPadding) {
+		t.Errorf("Pad(none) error = %v, want ErrInvalidPadding", err)
+	}
+	if _, err := Pad([]byte{1}, 8, PadMode('9')); err == nil {
+		t.Error("expected error for an unsupported pad mode")
+	}
+	if _, err := Pad([]byte{1}, 0, PadModePKCS7); err == nil {
+		t.Error("expected error for block size 0")
+	}
+}
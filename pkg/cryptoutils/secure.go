@@ -0,0 +1,30 @@
+package cryptoutils
+
+import "crypto/subtle"
+
+// Zeroize overwrites buffers holding clear key material, PINs or other secrets with zeros.
+// Handlers defer it as soon as they obtain a clear value, so the value does not linger on
+// the heap after the command completes:
+//
+//	key, err := decrypt(...)
+//	if err != nil { ... }
+//	defer cryptoutils.Zeroize(key)
+//
+// Go strings are immutable and cannot be zeroized, so secrets should be kept in byte slices.
+func Zeroize(buffers ...[]byte) {
+	for _, b := range buffers {
+		clear(b)
+	}
+}
+
+// ConstantTimeEqual reports whether a and b are equal in time that depends only on their
+// lengths, for comparing calculated and received verification values (PVV, CVV, MAC, ARQC)
+// without leaking the position of the first mismatch.
+func ConstantTimeEqual(a, b []byte) bool {
+	return subtle.ConstantTimeCompare(a, b) == 1
+}
+
+// ConstantTimeEqualString is ConstantTimeEqual for strings.
+func ConstantTimeEqualString(a, b string) bool {
+	return ConstantTimeEqual([]byte(a), []byte(b))
+}
@@ -0,0 +1,35 @@
+package cryptoutils
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestZeroize(t *testing.T) {
+	a := []byte{1, 2, 3}
+	b := []byte{4, 5}
+	Zeroize(a, nil, b)
+	if !bytes.Equal(a, make([]byte, 3)) || !bytes.Equal(b, make([]byte, 2)) {
+		t.Errorf("Zeroize() left %v %v", a, b)
+	}
+}
+
+func TestConstantTimeEqual(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"1234", "1234", true},
+		{"1234", "1235", false},
+		{"1234", "123", false},
+		{"", "", true},
+	}
+	for _, tc := range tests {
+		if got := ConstantTimeEqualString(tc.a, tc.b); got != tc.want {
+			t.Errorf("ConstantTimeEqualString(%q, %q) = %v, want %v", tc.a, tc.b, got, tc.want)
+		}
+		if got := ConstantTimeEqual([]byte(tc.a), []byte(tc.b)); got != tc.want {
+			t.Errorf("ConstantTimeEqual(%q, %q) = %v, want %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package cryptoutils
+
+import (
+	"crypto/cipher"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
+)
+
+// SecureMessagingMAC computes the 8-byte EMV secure messaging MAC (EMV Book 2, 9.2) of an
+// issuer script command: ISO/IEC 9797-1 MAC algorithm 3 with padding method 2 under the
+// double-length SK-SMI session key.
+func SecureMessagingMAC(msg, skSMI []byte) ([]byte, error) {
+	if len(skSMI) != 16 {
+		return nil, fmt.Errorf("SK-SMI must be 16 bytes, got %d", len(skSMI))
+	}
+
+	return CalculateMAC(padISO9797Method2(msg, 8), skSMI, 8, 3)
+}
+
+// EncipherSecureMessagingData enciphers issuer script data for EMV secure messaging for
+// confidentiality (EMV Book 2, 9.3): the data is padded with ISO/IEC 9797-1 method 2 and
+// encrypted with TDES in CBC mode with a zero IV under the double-length SK-SMC session key.
+func EncipherSecureMessagingData(data, skSMC []byte) ([]byte, error) {
+	if len(skSMC) != 16 {
+		return nil, fmt.Errorf("SK-SMC must be 16 bytes, got %d", len(skSMC))
+	}
+	if len(data) == 0 {
+		return nil, errors.New("no data to encipher")
+	}
+
+	block, err := cryptoprovider.NewTripleDESCipher(PrepareTripleDESKey(skSMC))
+	if err != nil {
+		return nil, err
+	}
+	out := padISO9797Method2(data, 8)
+	cipher.NewCBCEncrypter(block, make([]byte, 8)).CryptBlocks(out, out)
+
+	return out, nil
+}
+
+// OfflinePINChangeData returns the plaintext PIN data of an EMV PIN change script: the
+// length of the 8-byte ICC PIN block (control nibble 2, PIN length, PIN digits, F padding)
+// followed by the block, ready for EncipherSecureMessagingData.
+func OfflinePINChangeData(pin string) ([]byte, error) {
+	if len(pin) < 4 || len(pin) > 12 {
+		return nil, fmt.Errorf("PIN must be 4 to 12 digits, got %d", len(pin))
+	}
+	for _, c := range pin {
+		if c < '0' || c > '9' {
+			return nil, errors.New("PIN must be numeric")
+		}
+	}
+
+	block := fmt.Sprintf("2%X%s%s", len(pin), pin, strings.Repeat("F", 14-len(pin)))
+	data, _ := hex.DecodeString("08" + block)
+
+	return data, nil
+}
@@ -0,0 +1,60 @@
+//nolint:all // test package
+package cryptoutils
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/hex"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
+)
+
+func TestOfflinePINChangeData(t *testing.T) {
+	tests := []struct {
+		pin     string
+		want    string
+		wantErr bool
+	}{
+		{"1234", "08241234FFFFFFFFFF", false},
+		{"123456789012", "082C123456789012FF", false},
+		{"123", "", true},
+		{"1234567890123", "", true},
+		{"12A4", "", true},
+	}
+	for _, tc := range tests {
+		got, err := OfflinePINChangeData(tc.pin)
+		if (err != nil) != tc.wantErr {
+			t.Fatalf("OfflinePINChangeData(%q) error = %v, wantErr %v", tc.pin, err, tc.wantErr)
+		}
+		if err == nil && hex.EncodeToString(got) != string(bytes.ToLower([]byte(tc.want))) {
+			t.Errorf("OfflinePINChangeData(%q) = %X, want %s", tc.pin, got, tc.want)
+		}
+	}
+}
+
+func TestEncipherSecureMessagingData(t *testing.T) {
+	sk, _ := hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+	data, _ := OfflinePINChangeData("1234")
+
+	enc, err := EncipherSecureMessagingData(data, sk)
+	if err != nil {
+		t.Fatalf("EncipherSecureMessagingData() error = %v", err)
+	}
+	if len(enc) != 16 {
+		t.Fatalf("enciphered length = %d, want 16", len(enc))
+	}
+	block, _ := cryptoprovider.NewTripleDESCipher(PrepareTripleDESKey(sk))
+	plain := make([]byte, len(enc))
+	cipher.NewCBCDecrypter(block, make([]byte, 8)).CryptBlocks(plain, enc)
+	if want := padISO9797Method2(data, 8); !bytes.Equal(plain, want) {
+		t.Errorf("deciphered data = %X, want %X", plain, want)
+	}
+
+	if _, err := EncipherSecureMessagingData(data, sk[:8]); err == nil {
+		t.Error("expected error for a single-length SK-SMC")
+	}
+	if _, err := SecureMessagingMAC(data, sk[:8]); err == nil {
+		t.Error("expected error for a single-length SK-SMI")
+	}
+}
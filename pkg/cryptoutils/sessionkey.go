@@ -6,6 +6,8 @@ import (
 	"crypto/des"
 	"fmt"
 	"slices"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
 )
 
 // DeriveSessionKey derives an EMV session key KS from master key km and
@@ -25,13 +27,13 @@ func DeriveSessionKey(km, r []byte) ([]byte, error) {
 		out := make([]byte, n)
 		switch n {
 		case des.BlockSize:
-			c, err := des.NewCipher(km)
+			c, err := cryptoprovider.NewDESCipher(km)
 			if err != nil {
 				return nil, err
 			}
 			c.Encrypt(out, r)
 		case aes.BlockSize:
-			c, err := aes.NewCipher(km)
+			c, err := cryptoprovider.NewAESCipher(km)
 			if err != nil {
 				return nil, err
 			}
@@ -64,7 +66,7 @@ func DeriveSessionKey(km, r []byte) ([]byte, error) {
 		switch n {
 		case des.BlockSize:
 			// DES3 for klen == 16 or 24
-			c, err := des.NewTripleDESCipher(PrepareTripleDESKey(km))
+			c, err := cryptoprovider.NewTripleDESCipher(PrepareTripleDESKey(km))
 			if err != nil {
 				return nil, err
 			}
@@ -72,7 +74,7 @@ func DeriveSessionKey(km, r []byte) ([]byte, error) {
 			c.Encrypt(blk2, f2)
 		case aes.BlockSize:
 			// AES ECB for 16-byte blocks
-			c, err := aes.NewCipher(km)
+			c, err := cryptoprovider.NewAESCipher(km)
 			if err != nil {
 				return nil, err
 			}
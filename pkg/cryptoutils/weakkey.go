@@ -0,0 +1,37 @@
+package cryptoutils
+
+import "encoding/binary"
+
+// weakDESKeys holds the 4 weak and 12 semi-weak single DES keys (FIPS 74, NIST SP 800-67)
+// with their parity bits cleared.
+var weakDESKeys = map[uint64]bool{
+	// Weak keys: encryption and decryption are the same operation.
+	0x0000000000000000: true,
+	0xFEFEFEFEFEFEFEFE: true,
+	0x1E1E1E1E0E0E0E0E: true,
+	0xE0E0E0E0F0F0F0F0: true,
+	// Semi-weak key pairs: encryption under one key is decryption under the other.
+	0x00FE00FE00FE00FE: true, 0xFE00FE00FE00FE00: true,
+	0x1EE01EE00EF00EF0: true, 0xE01EE01EF00EF00E: true,
+	0x00E000E000F000F0: true, 0xE000E000F000F000: true,
+	0x1EFE1EFE0EFE0EFE: true, 0xFE1EFE1EFE0EFE0E: true,
+	0x001E001E000E000E: true, 0x1E001E000E000E00: true,
+	0xE0FEE0FEF0FEF0FE: true, 0xFEE0FEE0FEF0FEF0: true,
+}
+
+// IsWeakDESKey reports whether a DES or TDES key of 8, 16 or 24 bytes has a weak or
+// semi-weak single DES key as any of its components. Parity bits are ignored. Keys of other
+// lengths, such as AES keys, are never weak.
+func IsWeakDESKey(key []byte) bool {
+	if len(key) != 8 && len(key) != 16 && len(key) != 24 {
+		return false
+	}
+
+	for i := 0; i < len(key); i += 8 {
+		if weakDESKeys[binary.BigEndian.Uint64(key[i:i+8])&0xFEFEFEFEFEFEFEFE] {
+			return true
+		}
+	}
+
+	return false
+}
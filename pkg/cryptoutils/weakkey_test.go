@@ -0,0 +1,65 @@
+package cryptoutils
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestIsWeakDESKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"0101010101010101", true},
+		{"0000000000000000", true},
+		{"FEFEFEFEFEFEFEFE", true},
+		{"1F1F1F1F0E0E0E0E", true},
+		{"E0E0E0E0F1F1F1F1", true},
+		{"01FE01FE01FE01FE", true},
+		{"FE01FE01FE01FE01", true},
+		{"1FE01FE00EF10EF1", true},
+		{"E0FEE0FEF1FEF1FE", true},
+		{"0123456789ABCDEF", false},
+		{"0123456789ABCDEF1F1F1F1F0E0E0E0E", true},
+		{"0123456789ABCDEFFEDCBA9876543210", false},
+		{"0123456789ABCDEFFEDCBA98765432100101010101010101", true},
+		{"0101010101010101010101010101010101010101010101010101010101010101", false},
+	}
+	for _, tc := range tests {
+		key, _ := hex.DecodeString(tc.key)
+		if got := IsWeakDESKey(key); got != tc.want {
+			t.Errorf("IsWeakDESKey(%s) = %v, want %v", tc.key, got, tc.want)
+		}
+	}
+}
+
+func TestGenerateRandomKeyRejectsWeakKeys(t *testing.T) {
+	// The first 8 bytes of the generator output form a weak key, so the key is regenerated.
+	SetKeyGenerator(sequenceGenerator{make([]byte, 8), []byte("\x01\x23\x45\x67\x89\xAB\xCD\xEF")})
+	defer SetKeyGenerator(nil)
+
+	key, err := GenerateRandomKey(8)
+	if err != nil {
+		t.Fatalf("GenerateRandomKey() error = %v", err)
+	}
+	if hex.EncodeToString(key) != "0123456789abcdef" {
+		t.Errorf("GenerateRandomKey() = %X, want the second generated key", key)
+	}
+}
+
+// sequenceGenerator returns its keys in turn.
+type sequenceGenerator [][]byte
+
+func (g sequenceGenerator) Generate(b []byte) error {
+	for i, key := range g {
+		if key != nil {
+			copy(b, key)
+			g[i] = nil
+
+			return nil
+		}
+	}
+	clear(b)
+
+	return nil
+}
@@ -0,0 +1,166 @@
+package dukpt
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
+)
+
+// AES DUKPT sizes.
+const (
+	// AESKSNLength is the length of an AES DUKPT key serial number in bytes: the initial key
+	// ID followed by a 32-bit transaction counter.
+	AESKSNLength = 12
+	// InitialKeyIDLength is the length of an AES DUKPT initial key ID in bytes.
+	InitialKeyIDLength = 8
+)
+
+// KeyType is the algorithm and length of a key derived with AES DUKPT.
+type KeyType uint16
+
+// AES DUKPT key types.
+const (
+	KeyTDES2  KeyType = 0x0000 // double-length TDES
+	KeyTDES3  KeyType = 0x0001 // triple-length TDES
+	KeyAES128 KeyType = 0x0002
+	KeyAES192 KeyType = 0x0003
+	KeyAES256 KeyType = 0x0004
+)
+
+// Length returns the key length in bytes, or 0 for an unknown key type.
+func (t KeyType) Length() int {
+	switch t {
+	case KeyTDES2, KeyAES128:
+		return 16
+	case KeyTDES3, KeyAES192:
+		return 24
+	case KeyAES256:
+		return 32
+	default:
+		return 0
+	}
+}
+
+// AESKeyType returns the AES key type of a key of n bytes, or false for other lengths.
+func AESKeyType(n int) (KeyType, bool) {
+	switch n {
+	case 16:
+		return KeyAES128, true
+	case 24:
+		return KeyAES192, true
+	case 32:
+		return KeyAES256, true
+	default:
+		return 0, false
+	}
+}
+
+// KeyUsage is the purpose of a key derived with AES DUKPT.
+type KeyUsage uint16
+
+// AES DUKPT key usages.
+const (
+	UsageKeyEncryption   KeyUsage = 0x0002
+	UsagePINEncryption   KeyUsage = 0x1000
+	UsageMACGeneration   KeyUsage = 0x2000
+	UsageMACVerification KeyUsage = 0x2001
+	UsageMACBoth         KeyUsage = 0x2002
+	UsageDataEncrypt     KeyUsage = 0x3000
+	UsageDataDecrypt     KeyUsage = 0x3001
+	UsageDataBoth        KeyUsage = 0x3002
+	UsageKeyDerivation   KeyUsage = 0x8000
+	UsageInitialKey      KeyUsage = 0x8001
+)
+
+// derivationDataVersion is the version byte of AES DUKPT derivation data.
+const derivationDataVersion = 0x01
+
+// DeriveInitialKey derives the AES DUKPT initial key of type keyType from an AES BDK and an
+// 8-byte initial key ID.
+func DeriveInitialKey(bdk []byte, keyType KeyType, initialKeyID []byte) ([]byte, error) {
+	if len(initialKeyID) != InitialKeyIDLength {
+		return nil, fmt.Errorf("%w: initial key ID of %d bytes", ErrKSN, len(initialKeyID))
+	}
+	data := derivationData(UsageInitialKey, keyType)
+	copy(data[8:], initialKeyID)
+
+	return deriveAESKey(bdk, keyType, data)
+}
+
+// DeriveWorkingKey derives the working key of type keyType for usage and the transaction
+// counter in ksn from an initial key of type initialKeyType.
+func DeriveWorkingKey(
+	initialKey []byte,
+	initialKeyType KeyType,
+	usage KeyUsage,
+	keyType KeyType,
+	ksn []byte,
+) ([]byte, error) {
+	if len(ksn) != AESKSNLength {
+		return nil, fmt.Errorf("%w: %d bytes", ErrKSN, len(ksn))
+	}
+	counter := binary.BigEndian.Uint32(ksn[8:])
+
+	// Intermediate derivation keys follow the set bits of the counter from the left.
+	key := initialKey
+	var working uint32
+	for bit := uint32(1) << 31; bit != 0; bit >>= 1 {
+		if counter&bit == 0 {
+			continue
+		}
+		working |= bit
+		next, err := deriveAESKey(key, initialKeyType,
+			counterDerivationData(UsageKeyDerivation, initialKeyType, ksn, working))
+		if err != nil {
+			return nil, err
+		}
+		key = next
+	}
+
+	return deriveAESKey(key, keyType, counterDerivationData(usage, keyType, ksn, counter))
+}
+
+// derivationData returns the 16-byte derivation data with its header set.
+func derivationData(usage KeyUsage, keyType KeyType) []byte {
+	data := make([]byte, 16)
+	data[0] = derivationDataVersion
+	binary.BigEndian.PutUint16(data[2:], uint16(usage))
+	binary.BigEndian.PutUint16(data[4:], uint16(keyType))
+	binary.BigEndian.PutUint16(data[6:], uint16(8*keyType.Length()))
+
+	return data
+}
+
+// counterDerivationData returns the derivation data of a key below the initial key: the
+// rightmost 4 bytes of the initial key ID and the transaction counter.
+func counterDerivationData(usage KeyUsage, keyType KeyType, ksn []byte, counter uint32) []byte {
+	data := derivationData(usage, keyType)
+	copy(data[8:12], ksn[4:8])
+	binary.BigEndian.PutUint32(data[12:], counter)
+
+	return data
+}
+
+// deriveAESKey encrypts the derivation data under the AES derivation key, once per 16 bytes
+// of the derived key with the block counter in byte 1, and truncates the result.
+func deriveAESKey(derivationKey []byte, keyType KeyType, data []byte) ([]byte, error) {
+	n := keyType.Length()
+	if n == 0 {
+		return nil, fmt.Errorf("%w: unknown key type %#04x", ErrKeyLength, uint16(keyType))
+	}
+	block, err := cryptoprovider.NewAESCipher(derivationKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrKeyLength, err)
+	}
+
+	out := make([]byte, 0, (n+15)/16*16)
+	for i := byte(1); len(out) < n; i++ {
+		data[1] = i
+		enc := make([]byte, 16)
+		block.Encrypt(enc, data)
+		out = append(out, enc...)
+	}
+
+	return out[:n], nil
+}
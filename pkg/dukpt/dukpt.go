@@ -0,0 +1,201 @@
+// Package dukpt implements Derived Unique Key Per Transaction key derivation as defined in
+// ANSI X9.24: the TDES scheme of X9.24-1 (2009), with the initial PIN encryption key (IPEK)
+// derived from a double-length BDK and a 10-byte KSN, and the AES scheme of X9.24-3, with
+// the initial key derived from a BDK and an 8-byte initial key ID and working keys derived
+// from a 12-byte KSN.
+package dukpt
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
+)
+
+// TDES DUKPT sizes.
+const (
+	// KSNLength is the length of a TDES DUKPT key serial number in bytes.
+	KSNLength = 10
+	// counterBits is the width of the TDES DUKPT transaction counter.
+	counterBits = 21
+)
+
+var (
+	// ErrKeyLength is returned for a BDK or derived key of the wrong length.
+	ErrKeyLength = errors.New("invalid DUKPT key length")
+	// ErrKSN is returned for a key serial number of the wrong length.
+	ErrKSN = errors.New("invalid key serial number")
+)
+
+// keyMask is XORed into a key to derive the right half of the IPEK and the second register
+// of the non-reversible key generation process.
+var keyMask = [16]byte{
+	0xC0, 0xC0, 0xC0, 0xC0, 0x00, 0x00, 0x00, 0x00,
+	0xC0, 0xC0, 0xC0, 0xC0, 0x00, 0x00, 0x00, 0x00,
+}
+
+// Variant is a TDES DUKPT key variant, XORed into a transaction key to obtain the key for a
+// particular use.
+type Variant [16]byte
+
+// TDES DUKPT key variants.
+var (
+	VariantPIN = Variant{
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xFF,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xFF,
+	}
+	VariantMACRequest = Variant{
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xFF, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xFF, 0x00,
+	}
+	VariantMACResponse = Variant{
+		0x00, 0x00, 0x00, 0x00, 0xFF, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0xFF, 0x00, 0x00, 0x00,
+	}
+	VariantDataRequest = Variant{
+		0x00, 0x00, 0x00, 0x00, 0x00, 0xFF, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0xFF, 0x00, 0x00,
+	}
+	VariantDataResponse = Variant{
+		0x00, 0x00, 0x00, 0xFF, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0xFF, 0x00, 0x00, 0x00, 0x00,
+	}
+)
+
+// Apply returns key XOR the variant. key must be 16 bytes.
+func (v Variant) Apply(key []byte) ([]byte, error) {
+	if len(key) != len(v) {
+		return nil, fmt.Errorf("%w: %d bytes", ErrKeyLength, len(key))
+	}
+	out := make([]byte, len(key))
+	for i := range key {
+		out[i] = key[i] ^ v[i]
+	}
+
+	return out, nil
+}
+
+// DeriveIPEK derives the TDES initial PIN encryption key from a double-length BDK and a KSN.
+// The transaction counter of the KSN is ignored.
+func DeriveIPEK(bdk, ksn []byte) ([]byte, error) {
+	if len(bdk) != 16 {
+		return nil, fmt.Errorf("%w: BDK of %d bytes", ErrKeyLength, len(bdk))
+	}
+	if len(ksn) != KSNLength {
+		return nil, fmt.Errorf("%w: %d bytes", ErrKSN, len(ksn))
+	}
+
+	initialKSN := make([]byte, 8)
+	copy(initialKSN, ksn[:8])
+	initialKSN[7] &= 0xE0
+
+	ipek := make([]byte, 16)
+	if err := tdesEncrypt(ipek[:8], bdk, initialKSN); err != nil {
+		return nil, err
+	}
+	masked := xor16(bdk, keyMask[:])
+	if err := tdesEncrypt(ipek[8:], masked, initialKSN); err != nil {
+		return nil, err
+	}
+
+	return ipek, nil
+}
+
+// SplitKSN returns the initial key serial number of ksn, which identifies the PIN entry
+// device, and the transaction counter of ksn.
+func SplitKSN(ksn []byte) ([]byte, uint32, error) {
+	if len(ksn) != KSNLength {
+		return nil, 0, fmt.Errorf("%w: %d bytes", ErrKSN, len(ksn))
+	}
+
+	device := append([]byte(nil), ksn...)
+	counter := uint32(device[7]&0x1F)<<16 | uint32(device[8])<<8 | uint32(device[9])
+	device[7] &^= 0x1F
+	device[8], device[9] = 0, 0
+
+	return device, counter, nil
+}
+
+// DeriveTransactionKey derives the TDES transaction key for the counter in ksn from the
+// IPEK, with the non-reversible key generation process. Apply a Variant to the result to
+// obtain the PIN, MAC or data key.
+func DeriveTransactionKey(ipek, ksn []byte) ([]byte, error) {
+	if len(ipek) != 16 {
+		return nil, fmt.Errorf("%w: IPEK of %d bytes", ErrKeyLength, len(ipek))
+	}
+	if len(ksn) != KSNLength {
+		return nil, fmt.Errorf("%w: %d bytes", ErrKSN, len(ksn))
+	}
+
+	// The rightmost 64 bits of the KSN with the counter cleared, and the counter.
+	var reg, counter uint64
+	for _, b := range ksn[2:] {
+		reg = reg<<8 | uint64(b)
+	}
+	counter = reg & (1<<counterBits - 1)
+	reg &^= 1<<counterBits - 1
+
+	key := append([]byte(nil), ipek...)
+	for bit := uint64(1) << (counterBits - 1); bit != 0; bit >>= 1 {
+		if counter&bit == 0 {
+			continue
+		}
+		reg |= bit
+		var data [8]byte
+		for i := range data {
+			data[i] = byte(reg >> (56 - 8*i))
+		}
+		next, err := nonReversibleKey(key, data[:])
+		if err != nil {
+			return nil, err
+		}
+		key = next
+	}
+
+	return key, nil
+}
+
+// nonReversibleKey runs one step of the non-reversible key generation process: each half of
+// the new key is the DES encryption of data XOR the right key half, under the left key
+// half, XOR the right key half, taken from the masked key for the left half.
+func nonReversibleKey(key, data []byte) ([]byte, error) {
+	out := make([]byte, 16)
+	masked := xor16(key, keyMask[:])
+	for i, k := range [][]byte{masked, key} {
+		reg := make([]byte, 8)
+		for j := range reg {
+			reg[j] = data[j] ^ k[8+j]
+		}
+		block, err := cryptoprovider.NewDESCipher(k[:8])
+		if err != nil {
+			return nil, err
+		}
+		block.Encrypt(reg, reg)
+		for j := range reg {
+			out[8*i+j] = reg[j] ^ k[8+j]
+		}
+	}
+
+	return out, nil
+}
+
+// tdesEncrypt encrypts one block under a double-length key.
+func tdesEncrypt(dst, key, src []byte) error {
+	block, err := cryptoprovider.NewTripleDESCipher(append(append([]byte(nil), key...), key[:8]...))
+	if err != nil {
+		return err
+	}
+	block.Encrypt(dst, src)
+
+	return nil
+}
+
+// xor16 returns a XOR b for two 16-byte values.
+func xor16(a, b []byte) []byte {
+	out := make([]byte, 16)
+	for i := range out {
+		out[i] = a[i] ^ b[i]
+	}
+
+	return out
+}
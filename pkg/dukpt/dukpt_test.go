@@ -0,0 +1,133 @@
+package dukpt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("invalid hex %q: %v", s, err)
+	}
+
+	return b
+}
+
+// The TDES vectors are those of the ANSI X9.24-1 examples.
+func TestDeriveIPEK(t *testing.T) {
+	t.Parallel()
+
+	bdk := mustHex(t, "0123456789ABCDEFFEDCBA9876543210")
+	want := mustHex(t, "6AC292FAA1315B4D858AB3A3D7D5933A")
+	for _, ksn := range []string{"FFFF9876543210E00000", "FFFF9876543210E00008"} {
+		got, err := DeriveIPEK(bdk, mustHex(t, ksn))
+		if err != nil {
+			t.Fatalf("DeriveIPEK(%s) error = %v", ksn, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("DeriveIPEK(%s) = %X, want %X", ksn, got, want)
+		}
+	}
+
+	if _, err := DeriveIPEK(bdk[:8], mustHex(t, "FFFF9876543210E00000")); !errors.Is(err, ErrKeyLength) {
+		t.Errorf("DeriveIPEK() with a single-length BDK error = %v, want ErrKeyLength", err)
+	}
+	if _, err := DeriveIPEK(bdk, mustHex(t, "FFFF9876543210E0")); !errors.Is(err, ErrKSN) {
+		t.Errorf("DeriveIPEK() with a short KSN error = %v, want ErrKSN", err)
+	}
+}
+
+func TestDeriveTransactionKey(t *testing.T) {
+	t.Parallel()
+
+	ipek := mustHex(t, "6AC292FAA1315B4D858AB3A3D7D5933A")
+	key, err := DeriveTransactionKey(ipek, mustHex(t, "FFFF9876543210E00001"))
+	if err != nil {
+		t.Fatalf("DeriveTransactionKey() error = %v", err)
+	}
+	if want := mustHex(t, "042666B49184CFA368DE9628D0397BC9"); !bytes.Equal(key, want) {
+		t.Errorf("transaction key = %X, want %X", key, want)
+	}
+	pinKey, err := VariantPIN.Apply(key)
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if want := mustHex(t, "042666B49184CF5C68DE9628D0397B36"); !bytes.Equal(pinKey, want) {
+		t.Errorf("PIN key = %X, want %X", pinKey, want)
+	}
+
+	// A zero counter leaves the IPEK unchanged.
+	key, err = DeriveTransactionKey(ipek, mustHex(t, "FFFF9876543210E00000"))
+	if err != nil || !bytes.Equal(key, ipek) {
+		t.Errorf("DeriveTransactionKey() with counter 0 = %X, %v", key, err)
+	}
+}
+
+func TestSplitKSN(t *testing.T) {
+	t.Parallel()
+
+	device, counter, err := SplitKSN(mustHex(t, "FFFF9876543210E1F00A"))
+	if err != nil {
+		t.Fatalf("SplitKSN() error = %v", err)
+	}
+	if want := mustHex(t, "FFFF9876543210E00000"); !bytes.Equal(device, want) || counter != 0x1F00A {
+		t.Errorf("SplitKSN() = %X, %X, want %X, 1F00A", device, counter, want)
+	}
+	if _, _, err := SplitKSN(mustHex(t, "FFFF9876543210E0")); !errors.Is(err, ErrKSN) {
+		t.Errorf("SplitKSN() with a short KSN error = %v, want ErrKSN", err)
+	}
+}
+
+// The AES vector is that of the ANSI X9.24-3 examples.
+func TestDeriveInitialKey(t *testing.T) {
+	t.Parallel()
+
+	bdk := mustHex(t, "FEDCBA9876543210F1F1F1F1F1F1F1F1")
+	ik, err := DeriveInitialKey(bdk, KeyAES128, mustHex(t, "1234567890123456"))
+	if err != nil {
+		t.Fatalf("DeriveInitialKey() error = %v", err)
+	}
+	if want := mustHex(t, "1273671EA26AC29AFA4D1084127652A1"); !bytes.Equal(ik, want) {
+		t.Errorf("initial key = %X, want %X", ik, want)
+	}
+
+	if _, err := DeriveInitialKey(bdk, KeyAES128, mustHex(t, "1234")); !errors.Is(err, ErrKSN) {
+		t.Errorf("DeriveInitialKey() with a short initial key ID error = %v, want ErrKSN", err)
+	}
+	if _, err := DeriveInitialKey(bdk, KeyType(9), mustHex(t, "1234567890123456")); !errors.Is(err, ErrKeyLength) {
+		t.Errorf("DeriveInitialKey() with an unknown key type error = %v, want ErrKeyLength", err)
+	}
+}
+
+func TestDeriveWorkingKey(t *testing.T) {
+	t.Parallel()
+
+	ik := mustHex(t, "1273671EA26AC29AFA4D1084127652A1")
+	ksn := mustHex(t, "123456789012345600000001")
+
+	pin, err := DeriveWorkingKey(ik, KeyAES128, UsagePINEncryption, KeyAES128, ksn)
+	if err != nil {
+		t.Fatalf("DeriveWorkingKey() error = %v", err)
+	}
+	// ANSI X9.24-3-2017 test vector for the first transaction of the AES-128 initial key.
+	want := mustHex(t, "AF8CB133A78F8DC2D1359F18527593FB")
+	if !bytes.Equal(pin, want) {
+		t.Errorf("PIN key = %X, want %X", pin, want)
+	}
+
+	mac, err := DeriveWorkingKey(ik, KeyAES128, UsageMACGeneration, KeyAES256, ksn)
+	if err != nil {
+		t.Fatalf("DeriveWorkingKey() error = %v", err)
+	}
+	if len(mac) != 32 || bytes.Equal(mac[:16], pin) {
+		t.Errorf("AES-256 MAC key = %X", mac)
+	}
+	if _, err := DeriveWorkingKey(ik, KeyAES128, UsagePINEncryption, KeyAES128, ksn[:10]); !errors.Is(err, ErrKSN) {
+		t.Errorf("DeriveWorkingKey() with a TDES KSN error = %v, want ErrKSN", err)
+	}
+}
@@ -0,0 +1,216 @@
+// Package emv implements EMV application cryptogram processing for issuer hosts: ARQC
+// generation and verification and ARPC generation under card profiles that combine an ICC
+// master key derivation, a pluggable session key derivation, the padding of the
+// transaction data and the ARPC method. Built-in profiles cover Visa CVN 10, 14, 18 and 22,
+// the EMV common session key and the Mastercard proprietary session key derivation; more
+// can be added with Register.
+package emv
+
+import (
+	"crypto/des"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+)
+
+// Transaction holds the card and transaction values keys are derived from.
+type Transaction struct {
+	PAN string // primary account number digits.
+	PSN string // PAN sequence number (2N); "00" when empty.
+	ATC []byte // application transaction counter (2 bytes).
+	UN  []byte // unpredictable number (4 bytes); used by MastercardSKD.
+}
+
+// ARPCMethod selects how the ARPC is computed (EMV Book 2, 8.2).
+type ARPCMethod int
+
+const (
+	// ARPCMethod1 encrypts ARQC XOR (ARC || 00...00) under the cryptogram key and returns
+	// 8 bytes.
+	ARPCMethod1 ARPCMethod = 1
+	// ARPCMethod2 MACs ARQC || CSU || proprietary authentication data under the cryptogram
+	// key and returns 4 bytes.
+	ARPCMethod2 ARPCMethod = 2
+)
+
+// Profile describes how a card computes its application cryptograms.
+type Profile struct {
+	Name string
+	// SessionKey derives the cryptogram key from the ICC master key.
+	SessionKey SessionKeyDerivation
+	// Padding is applied to the transaction data before the MAC.
+	Padding cryptoutils.PadMode
+	// ARPC is the ARPC method.
+	ARPC ARPCMethod
+}
+
+// ErrUnknownProfile is returned by Lookup for a profile that is not registered.
+var ErrUnknownProfile = errors.New("unknown emv profile")
+
+// Built-in profile names.
+const (
+	ProfileVisaCVN10     = "visa-cvn10"
+	ProfileVisaCVN14     = "visa-cvn14"
+	ProfileVisaCVN18     = "visa-cvn18"
+	ProfileVisaCVN22     = "visa-cvn22"
+	ProfileEMVCSK        = "emv-csk"
+	ProfileMastercardSKD = "mastercard-skd"
+)
+
+var registry = struct {
+	sync.RWMutex
+	profiles map[string]Profile
+}{
+	profiles: map[string]Profile{
+		ProfileVisaCVN10: {
+			Name: ProfileVisaCVN10, SessionKey: ICCMasterKey,
+			Padding: cryptoutils.PadModeISO9797Method1, ARPC: ARPCMethod1,
+		},
+		ProfileVisaCVN14: {
+			Name: ProfileVisaCVN14, SessionKey: DefaultEMV2000Tree,
+			Padding: cryptoutils.PadModeISO9797Method2, ARPC: ARPCMethod1,
+		},
+		ProfileVisaCVN18: {
+			Name: ProfileVisaCVN18, SessionKey: CommonSessionKey,
+			Padding: cryptoutils.PadModeISO9797Method2, ARPC: ARPCMethod2,
+		},
+		ProfileVisaCVN22: {
+			Name: ProfileVisaCVN22, SessionKey: CommonSessionKey,
+			Padding: cryptoutils.PadModeISO9797Method2, ARPC: ARPCMethod2,
+		},
+		ProfileEMVCSK: {
+			Name: ProfileEMVCSK, SessionKey: CommonSessionKey,
+			Padding: cryptoutils.PadModeISO9797Method2, ARPC: ARPCMethod1,
+		},
+		ProfileMastercardSKD: {
+			Name: ProfileMastercardSKD, SessionKey: MastercardSKD,
+			Padding: cryptoutils.PadModeISO9797Method2, ARPC: ARPCMethod1,
+		},
+	},
+}
+
+// Register makes p available under p.Name, replacing any existing profile.
+func Register(p Profile) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	registry.profiles[p.Name] = p
+}
+
+// Profiles returns the names of the registered profiles.
+func Profiles() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	names := make([]string, 0, len(registry.profiles))
+	for name := range registry.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Lookup returns the profile registered under name.
+func Lookup(name string) (Profile, error) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	p, ok := registry.profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("%w: %s", ErrUnknownProfile, name)
+	}
+
+	return p, nil
+}
+
+// CryptogramKey derives the key the profile computes cryptograms under: the ICC master key
+// is derived from the issuer master key imk (EMV option A, or B for PANs over 16 digits)
+// and passed through the session key derivation.
+func (p Profile) CryptogramKey(imk []byte, tx Transaction) ([]byte, error) {
+	if p.SessionKey == nil {
+		return nil, fmt.Errorf("emv profile %s has no session key derivation", p.Name)
+	}
+	iccMK, err := cryptoutils.DeriveICCKeyForPAN(imk, tx.PAN, tx.PSN, false)
+	if err != nil {
+		return nil, fmt.Errorf("derive icc master key: %w", err)
+	}
+
+	return p.SessionKey.SessionKey(iccMK, tx)
+}
+
+// GenerateARQC computes the 8-byte application cryptogram over the transaction data with
+// ISO/IEC 9797-1 MAC algorithm 3.
+func (p Profile) GenerateARQC(imk []byte, tx Transaction, data []byte) ([]byte, error) {
+	key, err := p.CryptogramKey(imk, tx)
+	if err != nil {
+		return nil, err
+	}
+	padded, err := cryptoutils.Pad(data, des.BlockSize, p.Padding)
+	if err != nil {
+		return nil, err
+	}
+
+	return cryptoutils.CalculateMAC(padded, key, des.BlockSize, 3)
+}
+
+// VerifyARQC reports whether arqc is the application cryptogram of the transaction data.
+func (p Profile) VerifyARQC(imk []byte, tx Transaction, data, arqc []byte) (bool, error) {
+	calculated, err := p.GenerateARQC(imk, tx, data)
+	if err != nil {
+		return false, err
+	}
+
+	return subtle.ConstantTimeCompare(calculated, arqc) == 1, nil
+}
+
+// GenerateARPC computes the ARPC of arqc. For ARPCMethod1 resp is the 2-byte authorization
+// response code; for ARPCMethod2 it is the 4-byte card status update, followed by up to 8
+// bytes of proprietary authentication data in propData.
+func (p Profile) GenerateARPC(imk []byte, tx Transaction, arqc, resp, propData []byte) ([]byte, error) {
+	if len(arqc) != des.BlockSize {
+		return nil, fmt.Errorf("arqc must be 8 bytes, got %d", len(arqc))
+	}
+	key, err := p.CryptogramKey(imk, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	switch p.ARPC {
+	case ARPCMethod1:
+		if len(resp) != 2 {
+			return nil, fmt.Errorf("arc must be 2 bytes, got %d", len(resp))
+		}
+		msg, err := cryptoutils.XORBytes(slices.Concat(resp, make([]byte, 6)), arqc)
+		if err != nil {
+			return nil, err
+		}
+
+		return cryptoutils.CalculateMAC(msg, key, des.BlockSize, 3)
+	case ARPCMethod2:
+		if len(resp) != 4 {
+			return nil, fmt.Errorf("csu must be 4 bytes, got %d", len(resp))
+		}
+		if len(propData) > 8 {
+			return nil, fmt.Errorf("proprietary authentication data exceeds 8 bytes: %d", len(propData))
+		}
+		padded, err := cryptoutils.Pad(slices.Concat(arqc, resp, propData), des.BlockSize,
+			cryptoutils.PadModeISO9797Method2)
+		if err != nil {
+			return nil, err
+		}
+		mac, err := cryptoutils.CalculateMAC(padded, key, des.BlockSize, 3)
+		if err != nil {
+			return nil, err
+		}
+
+		return mac[:4], nil
+	default:
+		return nil, fmt.Errorf("unsupported arpc method %d", p.ARPC)
+	}
+}
@@ -0,0 +1,169 @@
+package emv
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+)
+
+const (
+	testIMK  = "0123456789ABCDEFFEDCBA9876543210"
+	testPAN  = "4111111111111111"
+	testData = "0000000123000000000000000784800004800008402505220052BF45851800005E06011203"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("invalid hex %q: %v", s, err)
+	}
+
+	return b
+}
+
+func testTransaction(t *testing.T) Transaction {
+	t.Helper()
+
+	return Transaction{PAN: testPAN, PSN: "00", ATC: mustHex(t, "005E"), UN: mustHex(t, "52BF4585")}
+}
+
+func mustLookup(t *testing.T, name string) Profile {
+	t.Helper()
+
+	p, err := Lookup(name)
+	if err != nil {
+		t.Fatalf("Lookup(%s) error = %v", name, err)
+	}
+
+	return p
+}
+
+func TestVisaProfilesMatchCryptoutils(t *testing.T) {
+	imk, data, tx := mustHex(t, testIMK), mustHex(t, testData), testTransaction(t)
+	arc := []byte("00")
+	csu := mustHex(t, "00000000")
+
+	arqc10, err := mustLookup(t, ProfileVisaCVN10).GenerateARQC(imk, tx, data)
+	want, _ := cryptoutils.GenerateARQC10(imk, data, tx.PAN, tx.PSN)
+	if err != nil || !bytes.Equal(arqc10, want) || !bytes.Equal(arqc10, mustHex(t, "076C5766F738E9A6")) {
+		t.Errorf("visa-cvn10 ARQC = %X, %v, want %X", arqc10, err, want)
+	}
+	arpc10, err := mustLookup(t, ProfileVisaCVN10).GenerateARPC(imk, tx, arqc10, arc, nil)
+	want, _ = cryptoutils.GenerateARPC10(imk, arqc10, arc, tx.PAN, tx.PSN)
+	if err != nil || !bytes.Equal(arpc10, want) {
+		t.Errorf("visa-cvn10 ARPC = %X, %v, want %X", arpc10, err, want)
+	}
+
+	for _, name := range []string{ProfileVisaCVN18, ProfileVisaCVN22} {
+		p := mustLookup(t, name)
+		arqc, err := p.GenerateARQC(imk, tx, data)
+		want, _ := cryptoutils.GenerateARQC18(imk, data, tx.ATC, tx.PAN, tx.PSN)
+		if err != nil || !bytes.Equal(arqc, want) {
+			t.Errorf("%s ARQC = %X, %v, want %X", name, arqc, err, want)
+		}
+		arpc, err := p.GenerateARPC(imk, tx, arqc, csu, []byte{0x01})
+		want, _ = cryptoutils.GenerateARPC18(imk, tx.PAN, tx.PSN, tx.ATC, arqc, csu, []byte{0x01})
+		if err != nil || !bytes.Equal(arpc, want) || len(arpc) != 4 {
+			t.Errorf("%s ARPC = %X, %v, want %X", name, arpc, err, want)
+		}
+	}
+}
+
+func TestVerifyARQC(t *testing.T) {
+	imk, data, tx := mustHex(t, testIMK), mustHex(t, testData), testTransaction(t)
+
+	for _, name := range Profiles() {
+		t.Run(name, func(t *testing.T) {
+			p := mustLookup(t, name)
+			arqc, err := p.GenerateARQC(imk, tx, data)
+			if err != nil || len(arqc) != 8 {
+				t.Fatalf("GenerateARQC() = %X, %v", arqc, err)
+			}
+			if ok, err := p.VerifyARQC(imk, tx, data, arqc); !ok || err != nil {
+				t.Errorf("VerifyARQC() = %v, %v, want true", ok, err)
+			}
+			tampered := slices.Clone(data)
+			tampered[0] ^= 0x01
+			if ok, _ := p.VerifyARQC(imk, tx, tampered, arqc); ok {
+				t.Error("VerifyARQC() accepted tampered transaction data")
+			}
+		})
+	}
+}
+
+func TestSessionKeyDerivations(t *testing.T) {
+	iccMK, err := cryptoutils.DeriveICCKeyOptionA(mustHex(t, testIMK), testPAN, "00")
+	if err != nil {
+		t.Fatalf("DeriveICCKeyOptionA() error = %v", err)
+	}
+	tx := testTransaction(t)
+
+	csk, err := CommonSessionKey.SessionKey(iccMK, tx)
+	want, _ := cryptoutils.DeriveSessionKey(iccMK, mustHex(t, "005E000000000000"))
+	if err != nil || !bytes.Equal(csk, want) {
+		t.Errorf("CommonSessionKey = %X, %v, want %X", csk, err, want)
+	}
+
+	skd, err := MastercardSKD.SessionKey(iccMK, tx)
+	want, _ = cryptoutils.DeriveSessionKey(iccMK, mustHex(t, "005E000052BF4585"))
+	if err != nil || !bytes.Equal(skd, want) {
+		t.Errorf("MastercardSKD = %X, %v, want %X", skd, err, want)
+	}
+	if _, err := MastercardSKD.SessionKey(iccMK, Transaction{ATC: tx.ATC}); !errors.Is(err, ErrUN) {
+		t.Errorf("MastercardSKD without UN error = %v, want ErrUN", err)
+	}
+	if _, err := CommonSessionKey.SessionKey(iccMK, Transaction{}); !errors.Is(err, ErrATC) {
+		t.Errorf("CommonSessionKey without ATC error = %v, want ErrATC", err)
+	}
+
+	tree, err := DefaultEMV2000Tree.SessionKey(iccMK, tx)
+	if err != nil || len(tree) != 16 || !cryptoutils.CheckKeyParity(tree) {
+		t.Fatalf("EMV2000Tree = %X, %v", tree, err)
+	}
+	again, _ := DefaultEMV2000Tree.SessionKey(iccMK, tx)
+	next, _ := DefaultEMV2000Tree.SessionKey(iccMK, Transaction{ATC: mustHex(t, "005F")})
+	if !bytes.Equal(tree, again) || bytes.Equal(tree, next) || bytes.Equal(tree, csk) {
+		t.Errorf("EMV2000Tree keys: %X, %X, %X", tree, again, next)
+	}
+	withIV, _ := EMV2000Tree{Height: 16, Branch: 2, IV: bytes.Repeat([]byte{0x11}, 16)}.SessionKey(iccMK, tx)
+	if bytes.Equal(tree, withIV) {
+		t.Error("EMV2000Tree ignores the IV")
+	}
+	if _, err := (EMV2000Tree{Height: 4, Branch: 2}).SessionKey(iccMK, tx); err == nil {
+		t.Error("EMV2000Tree accepted an ATC beyond the tree")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	if _, err := Lookup("test-profile"); !errors.Is(err, ErrUnknownProfile) {
+		t.Fatalf("Lookup() of an unregistered profile error = %v", err)
+	}
+	fixed := SessionKeyFunc(func(_ []byte, _ Transaction) ([]byte, error) {
+		return mustHex(t, testIMK), nil
+	})
+	Register(Profile{
+		Name: "test-profile", SessionKey: fixed,
+		Padding: cryptoutils.PadModeISO9797Method2, ARPC: ARPCMethod1,
+	})
+	p := mustLookup(t, "test-profile")
+	if !slices.Contains(Profiles(), "test-profile") {
+		t.Errorf("Profiles() = %v, missing test-profile", Profiles())
+	}
+
+	data := mustHex(t, testData)
+	arqc, err := p.GenerateARQC(mustHex(t, testIMK), testTransaction(t), data)
+	want, _ := cryptoutils.CalculateMAC(
+		append(slices.Clone(data), 0x80, 0, 0), mustHex(t, testIMK), 8, 3)
+	if err != nil || !bytes.Equal(arqc, want) {
+		t.Errorf("GenerateARQC() with a custom derivation = %X, %v, want %X", arqc, err, want)
+	}
+	if _, err := p.GenerateARPC(mustHex(t, testIMK), testTransaction(t), arqc, []byte("0"), nil); err == nil {
+		t.Error("GenerateARPC() accepted a 1-byte ARC")
+	}
+}
@@ -0,0 +1,157 @@
+package emv
+
+import (
+	"crypto/des"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+)
+
+// SessionKeyDerivation derives the key an application cryptogram is computed under from the
+// ICC master key of the card.
+type SessionKeyDerivation interface {
+	SessionKey(iccMK []byte, tx Transaction) ([]byte, error)
+}
+
+// SessionKeyFunc adapts a function to the SessionKeyDerivation interface.
+type SessionKeyFunc func(iccMK []byte, tx Transaction) ([]byte, error)
+
+// SessionKey calls f.
+func (f SessionKeyFunc) SessionKey(iccMK []byte, tx Transaction) ([]byte, error) {
+	return f(iccMK, tx)
+}
+
+// ErrATC is returned for an application transaction counter that is not 2 bytes.
+var ErrATC = errors.New("atc must be 2 bytes")
+
+// ErrUN is returned for an unpredictable number that is not 4 bytes.
+var ErrUN = errors.New("unpredictable number must be 4 bytes")
+
+// Built-in session key derivations.
+var (
+	// ICCMasterKey uses the ICC master key itself, as Visa CVN 10 does.
+	ICCMasterKey SessionKeyDerivation = SessionKeyFunc(func(iccMK []byte, _ Transaction) ([]byte, error) {
+		return slices.Clone(iccMK), nil
+	})
+	// CommonSessionKey is the EMV common session key derivation (EMV Book 2, A1.3) with
+	// the diversification value ATC || 00...00.
+	CommonSessionKey SessionKeyDerivation = SessionKeyFunc(deriveCommonSessionKey)
+	// MastercardSKD is the Mastercard proprietary session key derivation with the
+	// diversification value ATC || 00 00 || unpredictable number.
+	MastercardSKD SessionKeyDerivation = SessionKeyFunc(deriveMastercardSessionKey)
+)
+
+func deriveCommonSessionKey(iccMK []byte, tx Transaction) ([]byte, error) {
+	if len(tx.ATC) != 2 {
+		return nil, ErrATC
+	}
+
+	return cryptoutils.DeriveSessionKey(iccMK, slices.Concat(tx.ATC, make([]byte, des.BlockSize-2)))
+}
+
+func deriveMastercardSessionKey(iccMK []byte, tx Transaction) ([]byte, error) {
+	if len(tx.ATC) != 2 {
+		return nil, ErrATC
+	}
+	if len(tx.UN) != 4 {
+		return nil, ErrUN
+	}
+
+	return cryptoutils.DeriveSessionKey(iccMK, slices.Concat(tx.ATC, []byte{0, 0}, tx.UN))
+}
+
+// EMV2000Tree is the EMV 2000 tree-based session key derivation (EMV 4.0 Book 2, A1.3) for
+// double-length TDES ICC master keys. The session key of ATC j is IK(H, j) XOR
+// IK(H-2, j div b²), where IK(0, 0) is the ICC master key, IK(-1, 0) is IV and
+// IK(i, j) = f(IK(i-1, j div b), IK(i-2, j div b²), j) with
+// f(X, Y, j) = DES3(X)[YL XOR (j mod b)] || DES3(X)[YR XOR (j mod b) XOR 'F0'].
+type EMV2000Tree struct {
+	Height int    // tree height H; Branch^Height must cover every ATC value.
+	Branch int    // branch factor b.
+	IV     []byte // 16-byte initial value; zeros when nil.
+}
+
+// DefaultEMV2000Tree is the EMV 2000 tree with branch factor 2, height 16 and a zero IV,
+// which covers the full 2-byte ATC range.
+var DefaultEMV2000Tree = EMV2000Tree{Height: 16, Branch: 2}
+
+// SessionKey implements SessionKeyDerivation.
+func (t EMV2000Tree) SessionKey(iccMK []byte, tx Transaction) ([]byte, error) {
+	if len(iccMK) != 16 {
+		return nil, fmt.Errorf("emv 2000 tree needs a 16 byte ICC master key, got %d", len(iccMK))
+	}
+	if len(tx.ATC) != 2 {
+		return nil, ErrATC
+	}
+	if t.Height < 2 || t.Branch < 2 {
+		return nil, fmt.Errorf("invalid emv 2000 tree height %d branch %d", t.Height, t.Branch)
+	}
+	iv := t.IV
+	if iv == nil {
+		iv = make([]byte, 16)
+	}
+	if len(iv) != 16 {
+		return nil, fmt.Errorf("emv 2000 tree IV must be 16 bytes, got %d", len(iv))
+	}
+
+	atc := uint64(binary.BigEndian.Uint16(tx.ATC))
+	b := uint64(t.Branch)
+	// node returns the index of the node on level i of the path to the leaf of the ATC.
+	node := func(i int) uint64 {
+		j := atc
+		for range t.Height - i {
+			j /= b
+		}
+
+		return j
+	}
+	if node(0) != 0 {
+		return nil, fmt.Errorf("atc %d exceeds the emv 2000 tree", atc)
+	}
+
+	// levels[i+1] holds IK(i, node(i)).
+	levels := make([][]byte, t.Height+2)
+	levels[0], levels[1] = iv, iccMK
+	for i := 1; i <= t.Height; i++ {
+		ik, err := emv2000Node(levels[i], levels[i-1], node(i)%b)
+		if err != nil {
+			return nil, err
+		}
+		levels[i+1] = ik
+	}
+
+	sk, err := cryptoutils.XORBytes(levels[t.Height+1], levels[t.Height-1])
+	if err != nil {
+		return nil, err
+	}
+
+	return cryptoutils.FixKeyParity(sk), nil
+}
+
+// emv2000Node computes f(X, Y, j) of the EMV 2000 tree for the key x, parent value y and
+// branch r = j mod b.
+func emv2000Node(x, y []byte, r uint64) ([]byte, error) {
+	c, err := cryptoprovider.NewTripleDESCipher(cryptoutils.PrepareTripleDESKey(x))
+	if err != nil {
+		return nil, err
+	}
+	left := slices.Clone(y[:8])
+	right := slices.Clone(y[8:16])
+	var rb [8]byte
+	binary.BigEndian.PutUint64(rb[:], r)
+	for i := range rb {
+		left[i] ^= rb[i]
+		right[i] ^= rb[i]
+	}
+	right[7] ^= 0xF0
+
+	out := make([]byte, 16)
+	c.Encrypt(out[:8], left)
+	c.Encrypt(out[8:], right)
+
+	return out, nil
+}
@@ -0,0 +1,157 @@
+package hsmplugin
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/tetratelabs/wazero/api"
+)
+
+// Plugin ABI versions.
+//
+// ABI v1 packs a pointer and a length into a single u64 (see Buffer): Alloc(size i32) i64,
+// Execute(buf i64) i64 and the metadata functions () i64. Errors are formatted into the
+// response by the plugin, and host functions return 0 on failure.
+//
+// ABI v2 uses WASM multi-value returns: Alloc(size i32) i32 returns the pointer,
+// Execute(ptr, len i32) (ptr, len, code i32) returns the response and an error code, and the
+// metadata functions return (ptr, len i32). A non-zero code (see EncodeErrorCode) is the
+// payShield error code of a failed command, and the response then holds the diagnostic
+// detail; the host formats the error response. The key host functions of HostModuleV2
+// return (ptr, len, code i32) in the same way.
+//
+// The host detects the ABI of a module at load time from the signature of its Execute
+// export, so modules built for v1 keep working.
+const (
+	ABIv1 = 1
+	ABIv2 = 2
+)
+
+// HostModuleV2 is the import module of the ABI v2 host functions.
+const HostModuleV2 = "hsm_v2"
+
+// ErrABI is returned for modules whose exports match no supported ABI.
+var ErrABI = errors.New("unsupported plugin ABI")
+
+// abiSignatures holds the params and results of the exports of each ABI.
+var abiSignatures = map[int]map[string][2][]api.ValueType{
+	ABIv1: {
+		"Alloc":       {{api.ValueTypeI32}, {api.ValueTypeI64}},
+		"Execute":     {{api.ValueTypeI64}, {api.ValueTypeI64}},
+		"version":     {nil, {api.ValueTypeI64}},
+		"description": {nil, {api.ValueTypeI64}},
+		"author":      {nil, {api.ValueTypeI64}},
+	},
+	ABIv2: {
+		"Alloc":       {{api.ValueTypeI32}, {api.ValueTypeI32}},
+		"Execute":     {{api.ValueTypeI32, api.ValueTypeI32}, {api.ValueTypeI32, api.ValueTypeI32, api.ValueTypeI32}},
+		"version":     {nil, {api.ValueTypeI32, api.ValueTypeI32}},
+		"description": {nil, {api.ValueTypeI32, api.ValueTypeI32}},
+		"author":      {nil, {api.ValueTypeI32, api.ValueTypeI32}},
+	},
+}
+
+// DetectABI returns the ABI version of a module from its exported functions: the signature
+// of Execute selects the ABI, and every other required export must match it.
+func DetectABI(exports map[string]api.FunctionDefinition) (int, error) {
+	execute, ok := exports["Execute"]
+	if !ok {
+		return 0, fmt.Errorf("%w: no Execute export", ErrABI)
+	}
+
+	for _, abi := range []int{ABIv2, ABIv1} {
+		signatures := abiSignatures[abi]
+		if !matches(execute, signatures["Execute"]) {
+			continue
+		}
+		var wrong []string
+		for name, sig := range signatures {
+			if fn, ok := exports[name]; ok && !matches(fn, sig) {
+				wrong = append(wrong, name)
+			}
+		}
+		if len(wrong) > 0 {
+			slices.Sort(wrong)
+
+			return 0, fmt.Errorf("%w: v%d exports with wrong signatures: %s", ErrABI, abi, strings.Join(wrong, ", "))
+		}
+
+		return abi, nil
+	}
+
+	return 0, fmt.Errorf("%w: Execute%v%v", ErrABI, execute.ParamTypes(), execute.ResultTypes())
+}
+
+func matches(fn api.FunctionDefinition, sig [2][]api.ValueType) bool {
+	return slices.Equal(fn.ParamTypes(), sig[0]) && slices.Equal(fn.ResultTypes(), sig[1])
+}
+
+// EncodeErrorCode returns the ABI v2 error code of a two character payShield error code: its
+// characters in the low 16 bits. Success (00) and malformed codes encode as 0.
+func EncodeErrorCode(code string) uint32 {
+	if len(code) != 2 || code == errorcodes.Err00.CodeOnly() {
+		return 0
+	}
+
+	return uint32(code[0])<<8 | uint32(code[1])
+}
+
+// DecodeErrorCode returns the payShield error code of an ABI v2 error code.
+func DecodeErrorCode(code uint32) string {
+	if code == 0 {
+		return errorcodes.Err00.CodeOnly()
+	}
+
+	return string([]byte{byte(code >> 8), byte(code)})
+}
+
+// ErrorCode returns the payShield error code and diagnostic detail of err: the code of an
+// HSMError, or 68 for other errors, as ErrorResponse formats them.
+func ErrorCode(err error) (code, detail string) {
+	code = errorcodes.Err68.CodeOnly()
+	var hsmErr errorcodes.HSMError
+	if errors.As(err, &hsmErr) {
+		code = hsmErr.CodeOnly()
+	}
+	var detailedErr errorcodes.DetailedError
+	if errors.As(err, &detailedErr) {
+		detail = detailedErr.Detail
+	}
+
+	return code, detail
+}
+
+// CodeError returns the error of a non-zero ABI v2 error code returned by a host function.
+func CodeError(code uint32) error {
+	return errorcodes.HSMError{Code: DecodeErrorCode(code), Description: "host function failed"}
+}
+
+// Result returns the ABI v2 results of a successful call returning data, copied into the
+// arena.
+func Result(data []byte) (ptr, size, code uint32) {
+	ptr, size = ToBuffer(data).AddressSize()
+
+	return ptr, size, 0
+}
+
+// ErrorResult returns the ABI v2 results of a call failed with err: its error code and its
+// diagnostic detail, if any, copied into the arena.
+func ErrorResult(err error) (ptr, size, code uint32) {
+	errCode, detail := ErrorCode(err)
+	ptr, size = ToBuffer([]byte(detail)).AddressSize()
+
+	return ptr, size, EncodeErrorCode(errCode)
+}
+
+// ReadResult returns a copy of the result of an ABI v2 host function call, or the error of
+// its code.
+func ReadResult(ptr, size, code uint32) ([]byte, error) {
+	if code != 0 {
+		return nil, CodeError(code)
+	}
+
+	return ReadBytesChecked(ptr, size)
+}
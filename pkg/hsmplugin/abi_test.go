@@ -0,0 +1,65 @@
+package hsmplugin
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+)
+
+func TestErrorCodeRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	for _, code := range []string{"00", "01", "10", "15", "68", "A1"} {
+		encoded := EncodeErrorCode(code)
+		if code == "00" && encoded != 0 {
+			t.Errorf("EncodeErrorCode(%q) = %d, want 0", code, encoded)
+		}
+		if got := DecodeErrorCode(encoded); got != code {
+			t.Errorf("DecodeErrorCode(EncodeErrorCode(%q)) = %q", code, got)
+		}
+	}
+	if got := EncodeErrorCode("1"); got != 0 {
+		t.Errorf("EncodeErrorCode(malformed) = %d, want 0", got)
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		err        error
+		wantCode   string
+		wantDetail string
+	}{
+		{name: "hsm error", err: errorcodes.Err15, wantCode: "15"},
+		{name: "wrapped hsm error", err: fmt.Errorf("parse: %w", errorcodes.Err10), wantCode: "10"},
+		{name: "generic error", err: errors.New("boom"), wantCode: "68"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			code, detail := ErrorCode(tc.err)
+			if code != tc.wantCode || detail != tc.wantDetail {
+				t.Errorf("ErrorCode() = %q, %q, want %q, %q", code, detail, tc.wantCode, tc.wantDetail)
+			}
+		})
+	}
+}
+
+func TestFormatErrorResponse(t *testing.T) {
+	t.Parallel()
+
+	if got := string(FormatErrorResponse("KZ", "15", "")); got != "KA15" {
+		t.Errorf("FormatErrorResponse() = %q, want KA15", got)
+	}
+	want := "A115" + string(errorcodes.DetailSeparator) + "bad key"
+	if got := string(FormatErrorResponse("A0", "15", "bad key")); got != want {
+		t.Errorf("FormatErrorResponse() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,170 @@
+// Package hsmplugin provides WASM memory management and helper utilities for plugin wrappers.
+package hsmplugin
+
+import (
+	"errors"
+	"unsafe"
+)
+
+const defaultChunkSize = 4096
+
+var (
+	// ErrOutOfBounds is returned when a buffer does not lie inside a live arena allocation.
+	ErrOutOfBounds = errors.New("buffer outside of arena allocation")
+
+	// defaultArena backs Alloc, ToBuffer and the checked read helpers of a plugin.
+	defaultArena = NewArena(defaultChunkSize)
+)
+
+// chunk is a contiguous slab of memory from which allocations are carved.
+type chunk struct {
+	buf  []byte
+	used int
+}
+
+// region records a single allocation handed out by the arena.
+type region struct {
+	start uintptr
+	size  uintptr
+}
+
+// Arena is a per-call allocator for plugin memory.
+//
+// Allocations stay reachable (and therefore are never moved or collected) until Reset is
+// called, which makes them safe to hand to the host as raw pointers. Every allocation is
+// recorded so that pointers received from the host can be validated before they are read.
+// Arena is not safe for concurrent use; WASM plugin instances are single threaded.
+type Arena struct {
+	chunkSize int
+	chunks    []*chunk
+	regions   []region
+}
+
+// NewArena creates an arena that carves allocations from chunks of chunkSize bytes.
+// Allocations larger than chunkSize get a dedicated chunk.
+func NewArena(chunkSize int) *Arena {
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+
+	return &Arena{chunkSize: chunkSize}
+}
+
+// Alloc returns a zeroed slice of size bytes owned by the arena.
+func (a *Arena) Alloc(size int) []byte {
+	if size <= 0 {
+		return nil
+	}
+
+	var c *chunk
+	if size > a.chunkSize {
+		c = &chunk{buf: make([]byte, size)}
+		a.chunks = append(a.chunks, c)
+	} else {
+		if n := len(a.chunks); n > 0 && len(a.chunks[n-1].buf)-a.chunks[n-1].used >= size {
+			c = a.chunks[n-1]
+		} else {
+			c = &chunk{buf: make([]byte, a.chunkSize)}
+			a.chunks = append(a.chunks, c)
+		}
+	}
+
+	out := c.buf[c.used : c.used+size : c.used+size]
+	c.used += size
+	a.regions = append(a.regions, region{
+		start: uintptr(unsafe.Pointer(&out[0])),
+		size:  uintptr(size),
+	})
+
+	return out
+}
+
+// Owns reports whether the range [ptr, ptr+length) lies entirely within one live allocation.
+func (a *Arena) Owns(ptr uintptr, length int) bool {
+	if ptr == 0 || length <= 0 {
+		return false
+	}
+
+	end := ptr + uintptr(length)
+	for _, r := range a.regions {
+		if ptr >= r.start && end <= r.start+r.size && end > ptr {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Reset releases all allocations. The first chunk is zeroed and kept for reuse.
+func (a *Arena) Reset() {
+	if len(a.chunks) > 0 {
+		first := a.chunks[0]
+		clear(first.buf[:first.used])
+		first.used = 0
+		if len(first.buf) == a.chunkSize {
+			a.chunks = a.chunks[:1]
+		} else {
+			a.chunks = a.chunks[:0]
+		}
+	}
+	clear(a.regions)
+	a.regions = a.regions[:0]
+}
+
+// Allocated returns the number of bytes currently handed out by the arena.
+func (a *Arena) Allocated() int {
+	total := 0
+	for _, r := range a.regions {
+		total += int(r.size)
+	}
+
+	return total
+}
+
+// Alloc allocates size bytes from the plugin arena and returns them as a Buffer.
+// It backs the exported Alloc function of generated plugin wrappers.
+func Alloc(size uint32) Buffer {
+	buf := defaultArena.Alloc(int(size))
+	if len(buf) == 0 {
+		return Buffer(0)
+	}
+
+	return Buffer(PackResult(addressOf(buf), size))
+}
+
+// ResetArena releases every allocation made since the previous reset.
+// Generated wrappers call it at the start of each Execute, after copying the input.
+func ResetArena() {
+	defaultArena.Reset()
+}
+
+// ReadBytesChecked returns a copy of length bytes at ptr after verifying that the
+// range lies inside a live arena allocation.
+//
+//nolint:gosec,govet // allow unsafe pointer usage for WASM memory access.
+func ReadBytesChecked(ptr, length uint32) ([]byte, error) {
+	if length == 0 {
+		return nil, nil
+	}
+	if !defaultArena.Owns(uintptr(ptr), int(length)) {
+		return nil, ErrOutOfBounds
+	}
+
+	out := make([]byte, length)
+	copy(out, ReadBytes(ptr, length))
+
+	return out, nil
+}
+
+// ToBytesChecked returns a copy of the bytes referenced by the Buffer after verifying
+// that they lie inside a live arena allocation.
+func (b Buffer) ToBytesChecked() ([]byte, error) {
+	ptr, length := b.AddressSize()
+
+	return ReadBytesChecked(ptr, length)
+}
+
+// addressOf returns the low 32 bits of the wasm-memory address of buf[0].
+func addressOf(buf []byte) uint32 {
+	return uint32(uintptr(unsafe.Pointer(&buf[0])))
+}
@@ -0,0 +1,77 @@
+package hsmplugin
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func TestArena_AllocAndOwns(t *testing.T) {
+	t.Parallel()
+	arena := NewArena(64)
+
+	buf1 := arena.Alloc(16)
+	buf2 := arena.Alloc(32)
+	if len(buf1) != 16 || len(buf2) != 32 {
+		t.Fatalf("unexpected allocation sizes %d and %d", len(buf1), len(buf2))
+	}
+
+	// Writing past the end of an allocation must not be possible through append.
+	if cap(buf1) != 16 {
+		t.Errorf("expected capacity to be clamped to 16, got %d", cap(buf1))
+	}
+
+	ptr1 := uintptr(unsafe.Pointer(&buf1[0]))
+	if !arena.Owns(ptr1, 16) {
+		t.Error("expected arena to own first allocation")
+	}
+	if arena.Owns(ptr1, 17) {
+		t.Error("expected range spanning past allocation to be rejected")
+	}
+	if arena.Owns(0, 1) {
+		t.Error("expected nil pointer to be rejected")
+	}
+
+	if got := arena.Allocated(); got != 48 {
+		t.Errorf("expected 48 allocated bytes, got %d", got)
+	}
+}
+
+func TestArena_LargeAllocation(t *testing.T) {
+	t.Parallel()
+	arena := NewArena(64)
+
+	big := arena.Alloc(200)
+	if len(big) != 200 {
+		t.Fatalf("expected 200 bytes, got %d", len(big))
+	}
+	if !arena.Owns(uintptr(unsafe.Pointer(&big[0])), 200) {
+		t.Error("expected arena to own large allocation")
+	}
+}
+
+func TestArena_Reset(t *testing.T) {
+	t.Parallel()
+	arena := NewArena(64)
+
+	buf := arena.Alloc(8)
+	for i := range buf {
+		buf[i] = 0xAA
+	}
+	ptr := uintptr(unsafe.Pointer(&buf[0]))
+
+	arena.Reset()
+	if arena.Owns(ptr, 8) {
+		t.Error("expected allocation to be released after reset")
+	}
+	if got := arena.Allocated(); got != 0 {
+		t.Errorf("expected no allocated bytes after reset, got %d", got)
+	}
+
+	// The first chunk is reused and must be zeroed.
+	reused := arena.Alloc(8)
+	for i, b := range reused {
+		if b != 0 {
+			t.Errorf("reused memory not cleared at %d: got %X", i, b)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package hsmplugin
 
 import (
 	"sync"
+	"sync/atomic"
 
 	"github.com/andrei-cloud/anet"
 )
@@ -28,6 +29,27 @@ type BufferPool struct {
 	resizeHints    map[int]int // Maps requested sizes to actual sizes
 	resizeHintsMu  sync.RWMutex
 	maxResizeHints int // Maximum number of resize hints to track
+
+	// Usage counters reported by Stats.
+	gets      atomic.Uint64
+	puts      atomic.Uint64
+	allocs    atomic.Uint64
+	oversized atomic.Uint64
+}
+
+// BufferPoolStats is a snapshot of buffer pool usage.
+type BufferPoolStats struct {
+	// Gets and Puts count the buffers taken from and returned to the pool.
+	Gets uint64
+	Puts uint64
+	// Allocs counts buffers allocated because no pooled buffer was available.
+	Allocs uint64
+	// Oversized counts requests larger than the largest bucket, which are never pooled.
+	Oversized uint64
+	// Ringed is the number of buffers held in the bucket rings.
+	Ringed uint64
+	// RingedBytes is the capacity of the buffers held in the bucket rings.
+	RingedBytes uint64
 }
 
 // NewBufferPool creates a new buffer pool with predefined size buckets
@@ -40,6 +62,10 @@ func NewBufferPool() *BufferPool {
 	// Define common buffer sizes for HSM operations.
 	sizeBuckets := []int{64, 128, 256, 512, 1024, 2048, 4096}
 	buckets := make(map[int]*bufferBucket, len(sizeBuckets))
+	bp := &BufferPool{
+		resizeHints:    make(map[int]int),
+		maxResizeHints: 1000, // Track up to 1000 size hints
+	}
 
 	for _, size := range sizeBuckets {
 		size := size // Capture for closure
@@ -47,6 +73,8 @@ func NewBufferPool() *BufferPool {
 			ring: anet.NewRingBuffer[[]byte](defaultRingSize),
 			pool: &sync.Pool{
 				New: func() any {
+					bp.allocs.Add(1)
+
 					return make([]byte, 0, size)
 				},
 			},
@@ -54,12 +82,10 @@ func NewBufferPool() *BufferPool {
 		}
 	}
 
-	return &BufferPool{
-		buckets:        buckets,
-		sizeBuckets:    sizeBuckets,
-		resizeHints:    make(map[int]int),
-		maxResizeHints: 1000, // Track up to 1000 size hints
-	}
+	bp.buckets = buckets
+	bp.sizeBuckets = sizeBuckets
+
+	return bp
 }
 
 // getBestBucketSize returns the optimal bucket size for a requested capacity
@@ -97,16 +123,22 @@ func (bp *BufferPool) Get(size int) []byte {
 	bp.mu.RLock()
 	defer bp.mu.RUnlock()
 
+	bp.gets.Add(1)
+
 	// Get optimal bucket size using hints
 	bucketSize := bp.getBestBucketSize(size)
 
 	// Check if we need an oversized buffer
 	if bucketSize > bp.sizeBuckets[len(bp.sizeBuckets)-1] {
+		bp.oversized.Add(1)
+
 		return make([]byte, size)
 	}
 
 	bucket := bp.buckets[bucketSize]
 	if bucket == nil {
+		bp.allocs.Add(1)
+
 		return make([]byte, size)
 	}
 
@@ -126,6 +158,8 @@ func (bp *BufferPool) Get(size int) []byte {
 	}
 
 	// Something went wrong with the type assertion
+	bp.allocs.Add(1)
+
 	return make([]byte, size)
 }
 
@@ -163,6 +197,7 @@ func (bp *BufferPool) Put(buf []byte) {
 	if buf == nil {
 		return
 	}
+	bp.puts.Add(1)
 
 	bufCap := cap(buf)
 	// Don't pool oversized buffers
@@ -228,3 +263,24 @@ func (bp *BufferPool) GetBucketSizes() []int {
 
 	return sizes
 }
+
+// Stats returns a snapshot of the pool usage counters and of the buffers held in the bucket
+// rings. Buffers parked in the sync.Pool fallback are owned by the runtime and not counted.
+func (bp *BufferPool) Stats() BufferPoolStats {
+	bp.mu.RLock()
+	defer bp.mu.RUnlock()
+
+	stats := BufferPoolStats{
+		Gets:      bp.gets.Load(),
+		Puts:      bp.puts.Load(),
+		Allocs:    bp.allocs.Load(),
+		Oversized: bp.oversized.Load(),
+	}
+	for size, bucket := range bp.buckets {
+		n := bucket.ring.Len()
+		stats.Ringed += n
+		stats.RingedBytes += n * uint64(size)
+	}
+
+	return stats
+}
@@ -368,3 +368,24 @@ func TestBufferPool_GetBucketSizes(t *testing.T) {
 		}
 	}
 }
+
+func TestBufferPool_Stats(t *testing.T) {
+	t.Parallel()
+
+	pool := NewBufferPool()
+	buf := pool.Get(100)
+	pool.Put(buf)
+	pool.Put(pool.Get(100))
+	_ = pool.Get(8192)
+
+	stats := pool.Stats()
+	if stats.Gets != 3 || stats.Puts != 2 {
+		t.Errorf("Gets, Puts = %d, %d, want 3, 2", stats.Gets, stats.Puts)
+	}
+	if stats.Allocs != 1 || stats.Oversized != 1 {
+		t.Errorf("Allocs, Oversized = %d, %d, want 1, 1", stats.Allocs, stats.Oversized)
+	}
+	if stats.Ringed != 1 || stats.RingedBytes != 128 {
+		t.Errorf("Ringed = %d (%d bytes), want 1 (128 bytes)", stats.Ringed, stats.RingedBytes)
+	}
+}
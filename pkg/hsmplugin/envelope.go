@@ -0,0 +1,141 @@
+package hsmplugin
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// EnvelopeVersion is the current version of the JSON command envelope accepted by the
+// hsm_call host function. Plugins written in any language pass a JSON request envelope
+// (ptr, len) to hsm_call and receive a packed Buffer holding the JSON response envelope.
+const EnvelopeVersion = 1
+
+// Envelope operations.
+const (
+	OpEncryptUnderLMK = "encrypt_under_lmk" // encrypt clear Data under the LMK for Key.Type
+	OpDecryptUnderLMK = "decrypt_under_lmk" // decrypt Key.Value under the LMK
+	OpRandomKey       = "random_key"        // generate Length random bytes
+	OpKCV             = "kcv"               // key check value of Key.Value
+)
+
+var (
+	// ErrEnvelopeVersion is returned for unsupported envelope versions.
+	ErrEnvelopeVersion = errors.New("unsupported envelope version")
+	// ErrEnvelopeSchema is returned when a request envelope violates the schema.
+	ErrEnvelopeSchema = errors.New("invalid envelope")
+)
+
+// KeyRef identifies a key held under the LMK.
+type KeyRef struct {
+	// Type is the 3-digit key type code, e.g. "001".
+	Type string `json:"type"`
+	// Scheme is the key scheme tag, e.g. "U".
+	Scheme string `json:"scheme"`
+	// Value is the key encrypted under the LMK, hex encoded.
+	Value string `json:"value,omitempty"`
+}
+
+// Request is a JSON command envelope.
+type Request struct {
+	Version int     `json:"version"`
+	Op      string  `json:"op"`
+	Key     *KeyRef `json:"key,omitempty"`
+	// Data is the hex encoded operation input.
+	Data string `json:"data,omitempty"`
+	// Length is the requested output length in bytes.
+	Length int `json:"length,omitempty"`
+}
+
+// Response is a JSON result envelope.
+type Response struct {
+	Version int    `json:"version"`
+	OK      bool   `json:"ok"`
+	Result  string `json:"result,omitempty"` // hex encoded
+	Error   string `json:"error,omitempty"`
+}
+
+// ParseRequest decodes and validates a request envelope. Unknown fields are rejected.
+func ParseRequest(data []byte) (Request, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var req Request
+	if err := dec.Decode(&req); err != nil {
+		return Request{}, fmt.Errorf("%w: %v", ErrEnvelopeSchema, err)
+	}
+	if dec.More() {
+		return Request{}, fmt.Errorf("%w: trailing data", ErrEnvelopeSchema)
+	}
+
+	return req, req.Validate()
+}
+
+// Validate checks the request against the envelope schema of its version.
+func (r Request) Validate() error {
+	if r.Version != EnvelopeVersion {
+		return fmt.Errorf("%w: %d", ErrEnvelopeVersion, r.Version)
+	}
+
+	switch r.Op {
+	case OpEncryptUnderLMK:
+		if err := r.Key.validate(false); err != nil {
+			return err
+		}
+		if r.Data == "" || !isHexString(r.Data) {
+			return fmt.Errorf("%w: data must be non-empty hex", ErrEnvelopeSchema)
+		}
+	case OpDecryptUnderLMK, OpKCV:
+		if err := r.Key.validate(true); err != nil {
+			return err
+		}
+	case OpRandomKey:
+		if r.Length != 8 && r.Length != 16 && r.Length != 24 && r.Length != 32 {
+			return fmt.Errorf("%w: length must be 8, 16, 24 or 32", ErrEnvelopeSchema)
+		}
+	case "":
+		return fmt.Errorf("%w: op is required", ErrEnvelopeSchema)
+	default:
+		return fmt.Errorf("%w: unknown op %q", ErrEnvelopeSchema, r.Op)
+	}
+
+	return nil
+}
+
+// MarshalResponse encodes a response envelope of the current version.
+func MarshalResponse(result []byte, err error) []byte {
+	resp := Response{Version: EnvelopeVersion, OK: err == nil}
+	if err != nil {
+		resp.Error = err.Error()
+	} else {
+		resp.Result = fmt.Sprintf("%X", result)
+	}
+	out, _ := json.Marshal(resp)
+
+	return out
+}
+
+func (k *KeyRef) validate(needValue bool) error {
+	if k == nil {
+		return fmt.Errorf("%w: key is required", ErrEnvelopeSchema)
+	}
+	if len(k.Type) != 3 {
+		return fmt.Errorf("%w: key type must be 3 characters", ErrEnvelopeSchema)
+	}
+	if len(k.Scheme) != 1 {
+		return fmt.Errorf("%w: key scheme must be 1 character", ErrEnvelopeSchema)
+	}
+	if needValue && (k.Value == "" || !isHexString(k.Value)) {
+		return fmt.Errorf("%w: key value must be non-empty hex", ErrEnvelopeSchema)
+	}
+
+	return nil
+}
+
+func isHexString(s string) bool {
+	_, err := hex.DecodeString(s)
+
+	return err == nil
+}
@@ -0,0 +1,74 @@
+package hsmplugin
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseRequest(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr error
+	}{
+		{
+			name:  "encrypt",
+			input: `{"version":1,"op":"encrypt_under_lmk","key":{"type":"001","scheme":"U"},"data":"0123456789ABCDEF"}`,
+		},
+		{
+			name:  "decrypt",
+			input: `{"version":1,"op":"decrypt_under_lmk","key":{"type":"001","scheme":"U","value":"00112233"}}`,
+		},
+		{name: "random", input: `{"version":1,"op":"random_key","length":16}`},
+		{name: "unsupported version", input: `{"version":2,"op":"random_key","length":16}`, wantErr: ErrEnvelopeVersion},
+		{name: "missing version", input: `{"op":"random_key","length":16}`, wantErr: ErrEnvelopeVersion},
+		{name: "unknown op", input: `{"version":1,"op":"sign"}`, wantErr: ErrEnvelopeSchema},
+		{name: "unknown field", input: `{"version":1,"op":"random_key","length":16,"x":1}`, wantErr: ErrEnvelopeSchema},
+		{name: "bad length", input: `{"version":1,"op":"random_key","length":7}`, wantErr: ErrEnvelopeSchema},
+		{name: "missing key", input: `{"version":1,"op":"kcv"}`, wantErr: ErrEnvelopeSchema},
+		{
+			name:    "bad key hex",
+			input:   `{"version":1,"op":"kcv","key":{"type":"001","scheme":"U","value":"XYZ"}}`,
+			wantErr: ErrEnvelopeSchema,
+		},
+		{name: "trailing data", input: `{"version":1,"op":"random_key","length":8}{}`, wantErr: ErrEnvelopeSchema},
+		{name: "not json", input: `random_key`, wantErr: ErrEnvelopeSchema},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := ParseRequest([]byte(tc.input))
+			if tc.wantErr == nil && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+				t.Fatalf("expected %v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestMarshalResponse(t *testing.T) {
+	t.Parallel()
+
+	var resp Response
+	if err := json.Unmarshal(MarshalResponse([]byte{0xAB, 0x01}, nil), &resp); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if !resp.OK || resp.Result != "AB01" || resp.Version != EnvelopeVersion {
+		t.Errorf("unexpected success response %+v", resp)
+	}
+
+	resp = Response{}
+	if err := json.Unmarshal(MarshalResponse(nil, ErrEnvelopeSchema), &resp); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if resp.OK || resp.Error != ErrEnvelopeSchema.Error() {
+		t.Errorf("unexpected error response %+v", resp)
+	}
+}
@@ -0,0 +1,65 @@
+package hsmplugin
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// fieldLengthSize is the size of the big-endian length preceding each marshalled field.
+const fieldLengthSize = 4
+
+// ErrFieldFormat is returned for marshalled fields that are truncated or do not hold the
+// expected number of fields.
+var ErrFieldFormat = errors.New("malformed host function fields")
+
+// MarshalFields encodes the arguments of a host function taking marshalled fields: each
+// field is preceded by its length as a 4-byte big-endian integer.
+func MarshalFields(fields ...[]byte) []byte {
+	size := 0
+	for _, f := range fields {
+		size += fieldLengthSize + len(f)
+	}
+
+	out := make([]byte, 0, size)
+	for _, f := range fields {
+		out = binary.BigEndian.AppendUint32(out, uint32(len(f)))
+		out = append(out, f...)
+	}
+
+	return out
+}
+
+// UnmarshalFields decodes exactly n fields encoded by MarshalFields. Every length is checked
+// against the data before it is used, and the fields are views into data.
+func UnmarshalFields(data []byte, n int) ([][]byte, error) {
+	fields := make([][]byte, 0, n)
+	for len(data) > 0 {
+		if len(fields) == n {
+			return nil, fmt.Errorf("%w: %d trailing bytes", ErrFieldFormat, len(data))
+		}
+		if len(data) < fieldLengthSize {
+			return nil, fmt.Errorf("%w: truncated length of field %d", ErrFieldFormat, len(fields))
+		}
+		size := binary.BigEndian.Uint32(data)
+		data = data[fieldLengthSize:]
+		if uint64(size) > uint64(len(data)) {
+			return nil, fmt.Errorf("%w: field %d of %d bytes, %d left", ErrFieldFormat, len(fields), size, len(data))
+		}
+		fields = append(fields, data[:size])
+		data = data[size:]
+	}
+	if len(fields) != n {
+		return nil, fmt.Errorf("%w: %d fields, want %d", ErrFieldFormat, len(fields), n)
+	}
+
+	return fields, nil
+}
+
+// callFields marshals fields into the arena, calls the ABI v2 host function fn with them and
+// returns a copy of its result.
+func callFields(fn func(ptr, size uint32) (uint32, uint32, uint32), fields ...[]byte) ([]byte, error) {
+	ptr, size := ToBuffer(MarshalFields(fields...)).AddressSize()
+
+	return ReadResult(fn(ptr, size))
+}
@@ -0,0 +1,41 @@
+package hsmplugin
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestMarshalFields(t *testing.T) {
+	t.Parallel()
+
+	fields := [][]byte{[]byte("1234"), nil, []byte("4000001234562"), {0x00, 0xFF}}
+	data := MarshalFields(fields...)
+
+	got, err := UnmarshalFields(data, len(fields))
+	if err != nil {
+		t.Fatalf("UnmarshalFields() error = %v", err)
+	}
+	for i := range fields {
+		if !bytes.Equal(got[i], fields[i]) {
+			t.Errorf("field %d = %q, want %q", i, got[i], fields[i])
+		}
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		n    int
+	}{
+		{name: "too few fields", data: data, n: len(fields) + 1},
+		{name: "trailing fields", data: data, n: len(fields) - 1},
+		{name: "truncated length", data: data[:2], n: 1},
+		{name: "length past the end", data: data[:6], n: 1},
+		{name: "oversized length", data: []byte{0xFF, 0xFF, 0xFF, 0xFF, '1'}, n: 1},
+	}
+	for _, tc := range tests {
+		if _, err := UnmarshalFields(tc.data, tc.n); !errors.Is(err, ErrFieldFormat) {
+			t.Errorf("%s: UnmarshalFields() error = %v, want ErrFieldFormat", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package hsmplugin
+
+// EncryptUnderLMK encrypts clearKey under the LMK with the host encrypt_under_lmk function.
+// For key blocks (scheme S) keyType is the header template of the block.
+func EncryptUnderLMK(clearKey []byte, keyType string, scheme byte) ([]byte, error) {
+	return callKey(hostEncryptUnderLMK, clearKey, keyType, scheme)
+}
+
+// DecryptUnderLMK decrypts a key encrypted under the LMK with the host decrypt_under_lmk
+// function.
+func DecryptUnderLMK(encryptedKey []byte, keyType string, scheme byte) ([]byte, error) {
+	return callKey(hostDecryptUnderLMK, encryptedKey, keyType, scheme)
+}
+
+// TranslateFromOldLMK translates a key from the old LMK to the current one with the host
+// translate_from_old_lmk function.
+func TranslateFromOldLMK(encryptedKey []byte, keyType string, scheme byte) ([]byte, error) {
+	return callKey(hostTranslateFromOldLMK, encryptedKey, keyType, scheme)
+}
+
+// RandomKey returns length random key bytes generated by the host.
+func RandomKey(length int) ([]byte, error) {
+	return ReadResult(hostRandomKey(uint32(length)))
+}
+
+// WrapKeyBlock wraps clearKey in a key block with the attributes of template, the scheme tag
+// and 16 character header of a key block, under the key block LMK it names.
+func WrapKeyBlock(template, clearKey []byte) ([]byte, error) {
+	templatePtr, templateLen := ToBuffer(template).AddressSize()
+	clearKeyPtr, clearKeyLen := ToBuffer(clearKey).AddressSize()
+
+	return ReadResult(hostWrapKeyBlock(templatePtr, templateLen, clearKeyPtr, clearKeyLen))
+}
+
+// UnwrapKeyBlock unwraps a key block under the key block LMK named in its header and returns
+// the clear key.
+func UnwrapKeyBlock(block []byte) ([]byte, error) {
+	blockPtr, blockLen := ToBuffer(block).AddressSize()
+
+	return ReadResult(hostUnwrapKeyBlock(blockPtr, blockLen))
+}
+
+// LMKCheckValue returns the check value of the LMK registered under lmkID with the host
+// lmk_check_value function.
+func LMKCheckValue(lmkID string) ([]byte, error) {
+	idPtr, idLen := ToBuffer([]byte(lmkID)).AddressSize()
+
+	return ReadResult(hostLMKCheckValue(idPtr, idLen))
+}
+
+// LogDebug, LogInfo and LogError write msg to the host log at their level.
+func LogDebug(msg string) { hostLogDebug(msg) }
+
+func LogInfo(msg string) { hostLogInfo(msg) }
+
+func LogError(msg string) { hostLogError(msg) }
+
+// callKey copies a key and its key type into the arena and calls the key host function fn
+// with them. The result is a copy, checked to lie in the arena.
+func callKey(
+	fn func(keyPtr, keyLen, typePtr, typeLen, scheme uint32) (uint32, uint32, uint32),
+	key []byte,
+	keyType string,
+	scheme byte,
+) ([]byte, error) {
+	keyPtr, keyLen := ToBuffer(key).AddressSize()
+	typePtr, typeLen := ToBuffer([]byte(keyType)).AddressSize()
+
+	return ReadResult(fn(keyPtr, keyLen, typePtr, typeLen, uint32(scheme)))
+}
@@ -0,0 +1,22 @@
+//go:build !wasm
+
+package hsmplugin
+
+// Outside WASM there is no host to call: the key host functions fail with error 68 and log
+// messages are dropped.
+var (
+	hostEncryptUnderLMK     = noHostKey
+	hostDecryptUnderLMK     = noHostKey
+	hostTranslateFromOldLMK = noHostKey
+	hostRandomKey           = func(_ uint32) (uint32, uint32, uint32) { return noHost(0, 0) }
+	hostWrapKeyBlock        = func(_, _, _, _ uint32) (uint32, uint32, uint32) { return noHost(0, 0) }
+	hostUnwrapKeyBlock      = noHost
+	hostLMKCheckValue       = noHost
+	hostLogDebug            = func(string) {}
+	hostLogInfo             = func(string) {}
+	hostLogError            = func(string) {}
+)
+
+func noHostKey(_, _, _, _, _ uint32) (uint32, uint32, uint32) {
+	return noHost(0, 0)
+}
@@ -0,0 +1,56 @@
+//go:build wasm
+
+package hsmplugin
+
+//go:wasm-module hsm_v2
+//export encrypt_under_lmk
+func wasmEncryptUnderLMK(keyPtr, keyLen, typePtr, typeLen, scheme uint32) (uint32, uint32, uint32)
+
+//go:wasm-module hsm_v2
+//export decrypt_under_lmk
+func wasmDecryptUnderLMK(keyPtr, keyLen, typePtr, typeLen, scheme uint32) (uint32, uint32, uint32)
+
+//go:wasm-module hsm_v2
+//export translate_from_old_lmk
+func wasmTranslateFromOldLMK(keyPtr, keyLen, typePtr, typeLen, scheme uint32) (uint32, uint32, uint32)
+
+//go:wasm-module hsm_v2
+//export random_key
+func wasmRandomKey(length uint32) (uint32, uint32, uint32)
+
+//go:wasm-module hsm_v2
+//export wrap_key_block
+func wasmWrapKeyBlock(templatePtr, templateLen, clearKeyPtr, clearKeyLen uint32) (uint32, uint32, uint32)
+
+//go:wasm-module hsm_v2
+//export unwrap_key_block
+func wasmUnwrapKeyBlock(blockPtr, blockLen uint32) (uint32, uint32, uint32)
+
+//go:wasm-module hsm_v2
+//export lmk_check_value
+func wasmLMKCheckValue(idPtr, idLen uint32) (uint32, uint32, uint32)
+
+//go:wasm-module env
+//export log_debug
+func wasmLogDebug(s string)
+
+//go:wasm-module env
+//export log_info
+func wasmLogInfo(s string)
+
+//go:wasm-module env
+//export log_error
+func wasmLogError(s string)
+
+var (
+	hostEncryptUnderLMK     = wasmEncryptUnderLMK
+	hostDecryptUnderLMK     = wasmDecryptUnderLMK
+	hostTranslateFromOldLMK = wasmTranslateFromOldLMK
+	hostRandomKey           = wasmRandomKey
+	hostWrapKeyBlock        = wasmWrapKeyBlock
+	hostUnwrapKeyBlock      = wasmUnwrapKeyBlock
+	hostLMKCheckValue       = wasmLMKCheckValue
+	hostLogDebug            = wasmLogDebug
+	hostLogInfo             = wasmLogInfo
+	hostLogError            = wasmLogError
+)
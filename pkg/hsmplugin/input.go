@@ -0,0 +1,46 @@
+package hsmplugin
+
+import "errors"
+
+// InputChunkSize is the number of bytes a plugin pulls from the host per input_read call.
+// The host streams command input larger than this instead of writing it through Alloc.
+const InputChunkSize = 16 << 10
+
+// ErrInputRead is returned when the host delivers less streamed input than announced.
+var ErrInputRead = errors.New("streamed input read failed")
+
+// Streamed reports whether the Buffer announces streamed input: the host passes a zero
+// pointer with the input length, and the plugin pulls the bytes with input_read.
+func (b Buffer) Streamed() bool {
+	ptr, size := UnpackResult(uint64(b))
+
+	return ptr == 0 && size > 0
+}
+
+// ReadInput pulls size bytes of streamed input from the host in chunks of InputChunkSize.
+// The result is allocated outside the arena, so it survives ResetArena.
+func ReadInput(size uint32) ([]byte, error) {
+	out := make([]byte, size)
+	for off := uint32(0); off < size; {
+		n := min(InputChunkSize, size-off)
+		got := readHostInput(off, out[off:off+n])
+		if got == 0 || got > n {
+			return nil, ErrInputRead
+		}
+		off += got
+	}
+
+	return out, nil
+}
+
+// ReadExecuteInput returns a copy of the input passed to Execute, whether it was written
+// through Alloc or is streamed by the host.
+func ReadExecuteInput(b Buffer) ([]byte, error) {
+	if b.Streamed() {
+		_, size := UnpackResult(uint64(b))
+
+		return ReadInput(size)
+	}
+
+	return b.ToBytesChecked()
+}
@@ -0,0 +1,9 @@
+//go:build !wasm
+
+package hsmplugin
+
+// readHostInput copies streamed input starting at offset into dst and returns the number
+// of bytes copied. Outside WASM there is no host to stream from.
+var readHostInput = func(_ uint32, _ []byte) uint32 {
+	return 0
+}
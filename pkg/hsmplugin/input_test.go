@@ -0,0 +1,44 @@
+package hsmplugin
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// TestReadInput verifies chunked reads of streamed input. It replaces readHostInput, so it
+// does not run in parallel.
+func TestReadInput(t *testing.T) {
+	input := bytes.Repeat([]byte("0123456789ABCDEF"), 3*InputChunkSize/16+5)
+	var calls int
+	orig := readHostInput
+	defer func() { readHostInput = orig }()
+	readHostInput = func(offset uint32, dst []byte) uint32 {
+		calls++
+		if len(dst) > InputChunkSize {
+			t.Errorf("chunk of %d bytes exceeds InputChunkSize", len(dst))
+		}
+
+		return uint32(copy(dst, input[offset:]))
+	}
+
+	buf := Buffer(PackResult(0, uint32(len(input))))
+	if !buf.Streamed() {
+		t.Fatal("Streamed() = false for a zero pointer with a length")
+	}
+	got, err := ReadExecuteInput(buf)
+	if err != nil {
+		t.Fatalf("ReadExecuteInput() error = %v", err)
+	}
+	if !bytes.Equal(got, input) {
+		t.Error("streamed input does not match")
+	}
+	if calls != 4 {
+		t.Errorf("input_read called %d times, want 4", calls)
+	}
+
+	readHostInput = func(uint32, []byte) uint32 { return 0 }
+	if _, err := ReadInput(uint32(len(input))); !errors.Is(err, ErrInputRead) {
+		t.Errorf("ReadInput() error = %v, want ErrInputRead", err)
+	}
+}
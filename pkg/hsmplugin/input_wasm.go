@@ -0,0 +1,13 @@
+//go:build wasm
+
+package hsmplugin
+
+//go:wasm-module env
+//export input_read
+func wasmInputRead(offset, ptr, size uint32) uint32
+
+// readHostInput copies streamed input starting at offset into dst and returns the number
+// of bytes copied.
+var readHostInput = func(offset uint32, dst []byte) uint32 {
+	return wasmInputRead(offset, addressOf(dst), uint32(len(dst)))
+}
@@ -10,20 +10,23 @@ import (
 
 // Buffer represents a pointer and length packed in a uint64 for WASM memory operations.
 //
-// The high 32 bits hold the pointer and the low 32 bits hold the length. This encoding is used
-// because the WASM ABI (as used by go_hsm) returns a single 64-bit value from guest functions,
-// and Go code can extract the pointer and length using UnpackResult. This approach is necessary
-// for compatibility with WASM's single-value return, but may be replaced by returning two uint32s
-// in future ABIs for clarity and simplicity.
+// The high 32 bits hold the pointer and the low 32 bits hold the length. This encoding is the
+// return value of guest functions in plugin ABI v1, which returns a single 64-bit value, and Go
+// code can extract the pointer and length using UnpackResult. ABI v2 returns the pointer and
+// length as separate values (see ABIv2).
 type Buffer uint64
 
-// ToBuffer allocates memory for data in WASM linear memory and returns a Buffer referencing it.
+// ToBuffer copies data into arena-owned WASM linear memory and returns a Buffer referencing it.
+// The memory stays valid until the next ResetArena call.
 func ToBuffer(data []byte) Buffer {
 	if len(data) == 0 {
 		return Buffer(0)
 	}
 
-	return Buffer(PackResult(writeBytes(data)))
+	buf := defaultArena.Alloc(len(data))
+	copy(buf, data)
+
+	return Buffer(PackResult(addressOf(buf), uint32(len(buf))))
 }
 
 // ToBytes reads and returns the byte slice from WASM memory pointed to by Buffer.
@@ -70,18 +73,6 @@ func ReadBytes(ptr, length uint32) []byte {
 	) //nolint:govet // WASM memory access requires unsafe pointer conversion
 }
 
-// writeBytes writes data into WASM linear memory at ptr.
-func writeBytes(data []byte) (uint32, uint32) {
-	if len(data) == 0 {
-		return 0, 0
-	}
-
-	// get the low 32 bits of the wasm-memory pointer to data[0].
-	ptr := uint32(uintptr(unsafe.Pointer(&data[0])))
-
-	return ptr, uint32(len(data))
-}
-
 // PackResult combines a pointer and a length into a single uint64 result.
 func PackResult(ptr, length uint32) uint64 {
 	return uint64(ptr)<<32 | uint64(length)
@@ -95,13 +86,26 @@ func UnpackResult(val uint64) (uint32, uint32) {
 }
 
 // WriteError allocates and writes an error response for the specified command.
-// If err is of type HSMError, formats response as "<cmd><code>", otherwise uses generic error 68.
+// The response is formatted by ErrorResponse.
 func WriteError(cmd string, err error) Buffer {
-	var errCode string
-	if hsmErr, ok := err.(errorcodes.HSMError); ok {
-		errCode = hsmErr.CodeOnly()
-	} else {
-		errCode = errorcodes.Err68.CodeOnly()
+	return ToBuffer(ErrorResponse(cmd, err))
+}
+
+// ErrorResponse returns the error response for the specified command.
+// If err is of type HSMError, formats response as "<cmd><code>", otherwise uses generic error 68.
+// If err carries a diagnostic detail, it is appended after errorcodes.DetailSeparator for the
+// host to expose or strip.
+func ErrorResponse(cmd string, err error) []byte {
+	code, detail := ErrorCode(err)
+
+	return FormatErrorResponse(cmd, code, detail)
+}
+
+// FormatErrorResponse returns the error response for the specified command with the given
+// error code and diagnostic detail.
+func FormatErrorResponse(cmd, code, detail string) []byte {
+	if detail != "" {
+		detail = string(errorcodes.DetailSeparator) + detail
 	}
 
 	// Format error response: increment command code + error code
@@ -116,5 +120,5 @@ func WriteError(cmd string, err error) Buffer {
 		nextCmd += string(b)
 	}
 
-	return ToBuffer([]byte(nextCmd + errCode))
+	return []byte(nextCmd + code + detail)
 }
@@ -0,0 +1,49 @@
+package hsmplugin
+
+// PIN and card verification host functions of HostModuleV2. Each takes its arguments as
+// fields marshalled by MarshalFields and returns (ptr, len, code) like the other ABI v2 host
+// functions.
+const (
+	// FuncPinBlockEncode takes a PIN, an account number and a Thales PIN block format code
+	// and returns the PIN block as hex.
+	FuncPinBlockEncode = "pin_block_encode"
+	// FuncPinBlockDecode takes a PIN block as hex, an account number and a Thales PIN block
+	// format code and returns the PIN.
+	FuncPinBlockDecode = "pin_block_decode"
+	// FuncVisaPVV takes an account number (the 12 rightmost digits excluding the check
+	// digit), a PVK index, a PIN and a clear PVK and returns the 4 digit Visa PVV.
+	FuncVisaPVV = "visa_pvv"
+	// FuncVisaCVV takes an account number, an expiry date (YYMM), a service code and a clear
+	// double length CVK and returns the 3 digit Visa CVV.
+	FuncVisaCVV = "visa_cvv"
+)
+
+// EncodePinBlock returns the PIN block of pin and pan in the format of the Thales format code
+// as hex, built by the host.
+func EncodePinBlock(pin, pan, formatCode string) (string, error) {
+	out, err := callFields(hostPinBlockEncode, []byte(pin), []byte(pan), []byte(formatCode))
+
+	return string(out), err
+}
+
+// DecodePinBlock returns the PIN of a PIN block given as hex in the format of the Thales
+// format code, extracted by the host.
+func DecodePinBlock(pinBlock, pan, formatCode string) (string, error) {
+	out, err := callFields(hostPinBlockDecode, []byte(pinBlock), []byte(pan), []byte(formatCode))
+
+	return string(out), err
+}
+
+// VisaPVV returns the Visa PVV of pin and pan under the clear pvk, computed by the host.
+func VisaPVV(pan, pvki, pin string, pvk []byte) (string, error) {
+	out, err := callFields(hostVisaPVV, []byte(pan), []byte(pvki), []byte(pin), pvk)
+
+	return string(out), err
+}
+
+// VisaCVV returns the Visa CVV of a card under the clear cvk, computed by the host.
+func VisaCVV(pan, expDate, serviceCode string, cvk []byte) (string, error) {
+	out, err := callFields(hostVisaCVV, []byte(pan), []byte(expDate), []byte(serviceCode), cvk)
+
+	return string(out), err
+}
@@ -0,0 +1,17 @@
+//go:build !wasm
+
+package hsmplugin
+
+import "github.com/andrei-cloud/go_hsm/internal/errorcodes"
+
+// Outside WASM there is no host to call, and the PIN host functions fail with error 68.
+var (
+	hostPinBlockEncode = noHost
+	hostPinBlockDecode = noHost
+	hostVisaPVV        = noHost
+	hostVisaCVV        = noHost
+)
+
+func noHost(_, _ uint32) (uint32, uint32, uint32) {
+	return 0, 0, EncodeErrorCode(errorcodes.Err68.CodeOnly())
+}
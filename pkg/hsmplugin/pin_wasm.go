@@ -0,0 +1,26 @@
+//go:build wasm
+
+package hsmplugin
+
+//go:wasm-module hsm_v2
+//export pin_block_encode
+func wasmPinBlockEncode(ptr, size uint32) (uint32, uint32, uint32)
+
+//go:wasm-module hsm_v2
+//export pin_block_decode
+func wasmPinBlockDecode(ptr, size uint32) (uint32, uint32, uint32)
+
+//go:wasm-module hsm_v2
+//export visa_pvv
+func wasmVisaPVV(ptr, size uint32) (uint32, uint32, uint32)
+
+//go:wasm-module hsm_v2
+//export visa_cvv
+func wasmVisaCVV(ptr, size uint32) (uint32, uint32, uint32)
+
+var (
+	hostPinBlockEncode = wasmPinBlockEncode
+	hostPinBlockDecode = wasmPinBlockDecode
+	hostVisaPVV        = wasmVisaPVV
+	hostVisaCVV        = wasmVisaCVV
+)
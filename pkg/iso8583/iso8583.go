@@ -0,0 +1,266 @@
+// Package iso8583 implements a minimal ISO 8583:1987 codec for HSM integration testing.
+// Messages use an ASCII MTI, binary bitmaps and ASCII field data with ASCII length
+// prefixes for variable fields; binary fields such as the PIN block (DE52) and MACs
+// are carried as raw bytes. Only the fields commonly seen on card switches are defined.
+package iso8583
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+const (
+	mtiSize    = 4
+	bitmapSize = 8
+)
+
+var (
+	// ErrMessageTooShort is returned when the input ends before a field is complete.
+	ErrMessageTooShort = errors.New("iso8583 message too short")
+	// ErrUnsupportedField is returned for fields without a definition.
+	ErrUnsupportedField = errors.New("unsupported iso8583 field")
+	// ErrFieldLength is returned when field data violates its length definition.
+	ErrFieldLength = errors.New("invalid iso8583 field length")
+	// ErrFieldNotPresent is returned when a requested field is absent.
+	ErrFieldNotPresent = errors.New("iso8583 field not present")
+)
+
+// fieldSpec describes the wire format of a data element.
+type fieldSpec struct {
+	length int  // fixed length, or maximum length for variable fields
+	prefix int  // number of ASCII length digits: 0 fixed, 2 LLVAR, 3 LLLVAR
+	binary bool // data is raw bytes rather than ASCII
+}
+
+// fieldSpecs holds the supported data element definitions.
+var fieldSpecs = map[int]fieldSpec{
+	2:   {length: 19, prefix: 2},
+	3:   {length: 6},
+	4:   {length: 12},
+	5:   {length: 12},
+	6:   {length: 12},
+	7:   {length: 10},
+	8:   {length: 8},
+	9:   {length: 8},
+	10:  {length: 8},
+	11:  {length: 6},
+	12:  {length: 6},
+	13:  {length: 4},
+	14:  {length: 4},
+	15:  {length: 4},
+	16:  {length: 4},
+	17:  {length: 4},
+	18:  {length: 4},
+	19:  {length: 3},
+	20:  {length: 3},
+	21:  {length: 3},
+	22:  {length: 3},
+	23:  {length: 3},
+	24:  {length: 3},
+	25:  {length: 2},
+	26:  {length: 2},
+	27:  {length: 1},
+	28:  {length: 9},
+	29:  {length: 9},
+	30:  {length: 9},
+	31:  {length: 9},
+	32:  {length: 11, prefix: 2},
+	33:  {length: 11, prefix: 2},
+	34:  {length: 28, prefix: 2},
+	35:  {length: 37, prefix: 2},
+	36:  {length: 104, prefix: 3},
+	37:  {length: 12},
+	38:  {length: 6},
+	39:  {length: 2},
+	40:  {length: 3},
+	41:  {length: 8},
+	42:  {length: 15},
+	43:  {length: 40},
+	44:  {length: 25, prefix: 2},
+	45:  {length: 76, prefix: 2},
+	46:  {length: 999, prefix: 3},
+	47:  {length: 999, prefix: 3},
+	48:  {length: 999, prefix: 3},
+	49:  {length: 3},
+	50:  {length: 3},
+	51:  {length: 3},
+	52:  {length: 8, binary: true},
+	53:  {length: 16},
+	54:  {length: 120, prefix: 3},
+	55:  {length: 999, prefix: 3, binary: true},
+	56:  {length: 999, prefix: 3},
+	57:  {length: 999, prefix: 3},
+	58:  {length: 999, prefix: 3},
+	59:  {length: 999, prefix: 3},
+	60:  {length: 999, prefix: 3},
+	61:  {length: 999, prefix: 3},
+	62:  {length: 999, prefix: 3},
+	63:  {length: 999, prefix: 3},
+	64:  {length: 8, binary: true},
+	70:  {length: 3},
+	90:  {length: 42},
+	95:  {length: 42},
+	100: {length: 11, prefix: 2},
+	102: {length: 28, prefix: 2},
+	103: {length: 28, prefix: 2},
+	128: {length: 8, binary: true},
+}
+
+// Message is a parsed ISO 8583 message.
+type Message struct {
+	MTI    string
+	Fields map[int][]byte
+}
+
+// NewMessage creates an empty message with the given MTI.
+func NewMessage(mti string) *Message {
+	return &Message{MTI: mti, Fields: make(map[int][]byte)}
+}
+
+// Field returns the data of field n or ErrFieldNotPresent.
+func (m *Message) Field(n int) ([]byte, error) {
+	v, ok := m.Fields[n]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrFieldNotPresent, n)
+	}
+
+	return v, nil
+}
+
+// Set stores the data of field n.
+func (m *Message) Set(n int, data []byte) {
+	m.Fields[n] = data
+}
+
+// Unpack parses an ISO 8583 message.
+func Unpack(data []byte) (*Message, error) {
+	if len(data) < mtiSize+bitmapSize {
+		return nil, ErrMessageTooShort
+	}
+
+	msg := NewMessage(string(data[:mtiSize]))
+	pos := mtiSize
+
+	bitmap := data[pos : pos+bitmapSize]
+	pos += bitmapSize
+	maxField := 64
+	if bitmap[0]&0x80 != 0 {
+		if len(data) < pos+bitmapSize {
+			return nil, ErrMessageTooShort
+		}
+		bitmap = append(append([]byte(nil), bitmap...), data[pos:pos+bitmapSize]...)
+		pos += bitmapSize
+		maxField = 128
+	}
+
+	for n := 2; n <= maxField; n++ {
+		if !bitSet(bitmap, n) {
+			continue
+		}
+
+		value, next, err := unpackField(data, pos, n)
+		if err != nil {
+			return nil, err
+		}
+		msg.Fields[n] = value
+		pos = next
+	}
+
+	if pos != len(data) {
+		return nil, fmt.Errorf("%w: %d trailing bytes", ErrFieldLength, len(data)-pos)
+	}
+
+	return msg, nil
+}
+
+// Pack serializes the message.
+func (m *Message) Pack() ([]byte, error) {
+	if len(m.MTI) != mtiSize {
+		return nil, fmt.Errorf("invalid mti %q", m.MTI)
+	}
+
+	fields := make([]int, 0, len(m.Fields))
+	secondary := false
+	for n := range m.Fields {
+		if _, ok := fieldSpecs[n]; !ok {
+			return nil, fmt.Errorf("%w: %d", ErrUnsupportedField, n)
+		}
+		if n > 64 {
+			secondary = true
+		}
+		fields = append(fields, n)
+	}
+	sort.Ints(fields)
+
+	bitmap := make([]byte, bitmapSize)
+	if secondary {
+		bitmap = make([]byte, 2*bitmapSize)
+		bitmap[0] |= 0x80
+	}
+	for _, n := range fields {
+		bitmap[(n-1)/8] |= 0x80 >> uint((n-1)%8)
+	}
+
+	out := append([]byte(m.MTI), bitmap...)
+	for _, n := range fields {
+		spec := fieldSpecs[n]
+		value := m.Fields[n]
+		if spec.prefix == 0 {
+			if len(value) != spec.length {
+				return nil, fmt.Errorf("%w: field %d", ErrFieldLength, n)
+			}
+			out = append(out, value...)
+
+			continue
+		}
+		if len(value) > spec.length {
+			return nil, fmt.Errorf("%w: field %d", ErrFieldLength, n)
+		}
+		out = fmt.Appendf(out, "%0*d", spec.prefix, len(value))
+		out = append(out, value...)
+	}
+
+	return out, nil
+}
+
+// ResponseMTI returns the response MTI for a request MTI (e.g. 0100 -> 0110).
+func ResponseMTI(mti string) string {
+	if len(mti) != mtiSize || mti[2] < '0' || mti[2] > '8' {
+		return mti
+	}
+	b := []byte(mti)
+	b[2]++
+
+	return string(b)
+}
+
+func unpackField(data []byte, pos, n int) ([]byte, int, error) {
+	spec, ok := fieldSpecs[n]
+	if !ok {
+		return nil, 0, fmt.Errorf("%w: %d", ErrUnsupportedField, n)
+	}
+
+	length := spec.length
+	if spec.prefix > 0 {
+		if len(data) < pos+spec.prefix {
+			return nil, 0, fmt.Errorf("%w: field %d", ErrMessageTooShort, n)
+		}
+		l, err := strconv.Atoi(string(data[pos : pos+spec.prefix]))
+		if err != nil || l > spec.length {
+			return nil, 0, fmt.Errorf("%w: field %d", ErrFieldLength, n)
+		}
+		length = l
+		pos += spec.prefix
+	}
+	if len(data) < pos+length {
+		return nil, 0, fmt.Errorf("%w: field %d", ErrMessageTooShort, n)
+	}
+
+	return append([]byte(nil), data[pos:pos+length]...), pos + length, nil
+}
+
+func bitSet(bitmap []byte, n int) bool {
+	return bitmap[(n-1)/8]&(0x80>>uint((n-1)%8)) != 0
+}
@@ -0,0 +1,113 @@
+package iso8583
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestPackUnpackRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	msg := NewMessage("0200")
+	msg.Set(FieldPAN, []byte("4000345513804937"))
+	msg.Set(3, []byte("000000"))
+	msg.Set(11, []byte("123456"))
+	msg.Set(FieldPINBlock, []byte{0xCB, 0x4E, 0xBC, 0x01, 0x80, 0xDF, 0xED, 0x6E})
+	msg.Set(FieldSecurityControl, []byte("2001010100000000"))
+	msg.Set(102, []byte("ACC1"))
+
+	data, err := msg.Pack()
+	if err != nil {
+		t.Fatalf("pack failed: %v", err)
+	}
+
+	got, err := Unpack(data)
+	if err != nil {
+		t.Fatalf("unpack failed: %v", err)
+	}
+	if got.MTI != "0200" {
+		t.Errorf("unexpected mti %s", got.MTI)
+	}
+	for n, want := range msg.Fields {
+		if !bytes.Equal(got.Fields[n], want) {
+			t.Errorf("field %d = %q, want %q", n, got.Fields[n], want)
+		}
+	}
+}
+
+func TestUnpackErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		input   []byte
+		wantErr error
+	}{
+		{
+			name:    "too short",
+			input:   []byte("0200"),
+			wantErr: ErrMessageTooShort,
+		},
+		{
+			name: "unsupported field",
+			input: append([]byte("0200"),
+				0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x40, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00),
+			wantErr: ErrUnsupportedField,
+		},
+		{
+			name:    "truncated field",
+			input:   append([]byte("0200"), 0x20, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, '0'),
+			wantErr: ErrMessageTooShort,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := Unpack(tc.input); !errors.Is(err, tc.wantErr) {
+				t.Errorf("expected %v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSecurityHelpers(t *testing.T) {
+	t.Parallel()
+
+	msg := NewMessage("0100")
+	msg.Set(FieldTrack2, []byte("4000345513804937=25121010000000000000"))
+	msg.Set(FieldSecurityControl, []byte("2001010100000000"))
+	if err := SetPINBlock(msg, "CB4EBC0180DFED6E"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	pb, err := PINBlock(msg)
+	if err != nil || pb != "CB4EBC0180DFED6E" {
+		t.Errorf("PINBlock() = %s, %v", pb, err)
+	}
+
+	info, err := SecurityControl(msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.PINBlockFormat != "01" || !info.ThalesFormatCodeOK || info.ThalesFormatCode != "01" {
+		t.Errorf("unexpected security control info %+v", info)
+	}
+
+	pan, err := PAN(msg)
+	if err != nil || pan != "4000345513804937" {
+		t.Errorf("PAN() = %s, %v", pan, err)
+	}
+	account, err := AccountNumber(pan)
+	if err != nil || account != "034551380493" {
+		t.Errorf("AccountNumber() = %s, %v", account, err)
+	}
+
+	if ResponseMTI("0100") != "0110" || ResponseMTI("0200") != "0210" {
+		t.Error("unexpected response mti")
+	}
+}
@@ -0,0 +1,111 @@
+package iso8583
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/andrei-cloud/go_hsm/pkg/pan"
+)
+
+// Data elements used by the PIN helpers.
+const (
+	FieldPAN             = 2
+	FieldTrack2          = 35
+	FieldResponseCode    = 39
+	FieldPINBlock        = 52
+	FieldSecurityControl = 53
+)
+
+// SecurityControlInfo is the decoded content of DE53 (Security Related Control Information)
+// in the common n16 layout used by card schemes.
+type SecurityControlInfo struct {
+	SecurityFormat     string // positions 1-2, security format code
+	PINAlgorithm       string // positions 3-4, PIN encryption algorithm identifier
+	PINBlockFormat     string // positions 5-6, PIN block format code
+	KeyIndex           string // positions 7-8, zone key index
+	PINDataType        string // positions 9-10, PIN data type
+	Reserved           string // positions 11-16, reserved for future use
+	ThalesFormatCode   string // PIN block format translated to the Thales code
+	ThalesFormatCodeOK bool   // whether the PIN block format has a Thales equivalent
+}
+
+// de53Formats maps DE53 PIN block format codes to Thales PIN block format codes.
+var de53Formats = map[string]string{
+	"01": "01", // ISO 9564-1 format 0.
+	"02": "02", // Docutel.
+	"03": "03", // Diebold / IBM 3624.
+	"04": "04", // PLUS network.
+	"05": "05", // ISO 9564-1 format 1.
+	"06": "47", // ISO 9564-1 format 3.
+}
+
+// PINBlock returns DE52 as an uppercase hex string.
+func PINBlock(m *Message) (string, error) {
+	v, err := m.Field(FieldPINBlock)
+	if err != nil {
+		return "", err
+	}
+	if len(v) != fieldSpecs[FieldPINBlock].length {
+		return "", fmt.Errorf("%w: field %d", ErrFieldLength, FieldPINBlock)
+	}
+
+	return strings.ToUpper(hex.EncodeToString(v)), nil
+}
+
+// SetPINBlock stores a hex PIN block into DE52.
+func SetPINBlock(m *Message, pinBlockHex string) error {
+	v, err := hex.DecodeString(pinBlockHex)
+	if err != nil || len(v) != fieldSpecs[FieldPINBlock].length {
+		return fmt.Errorf("%w: field %d", ErrFieldLength, FieldPINBlock)
+	}
+	m.Set(FieldPINBlock, v)
+
+	return nil
+}
+
+// SecurityControl decodes DE53.
+func SecurityControl(m *Message) (SecurityControlInfo, error) {
+	v, err := m.Field(FieldSecurityControl)
+	if err != nil {
+		return SecurityControlInfo{}, err
+	}
+	if len(v) != fieldSpecs[FieldSecurityControl].length {
+		return SecurityControlInfo{}, fmt.Errorf("%w: field %d", ErrFieldLength, FieldSecurityControl)
+	}
+
+	s := string(v)
+	info := SecurityControlInfo{
+		SecurityFormat: s[0:2],
+		PINAlgorithm:   s[2:4],
+		PINBlockFormat: s[4:6],
+		KeyIndex:       s[6:8],
+		PINDataType:    s[8:10],
+		Reserved:       s[10:16],
+	}
+	info.ThalesFormatCode, info.ThalesFormatCodeOK = de53Formats[info.PINBlockFormat]
+
+	return info, nil
+}
+
+// PAN returns the primary account number from DE2, or from track 2 (DE35) when DE2 is absent.
+func PAN(m *Message) (string, error) {
+	if v, ok := m.Fields[FieldPAN]; ok {
+		return string(v), nil
+	}
+
+	track2, err := m.Field(FieldTrack2)
+	if err != nil {
+		return "", fmt.Errorf("%w: neither field %d nor %d", ErrFieldNotPresent, FieldPAN, FieldTrack2)
+	}
+	pan, _, _ := strings.Cut(string(track2), "=")
+	pan, _, _ = strings.Cut(pan, "D")
+
+	return pan, nil
+}
+
+// AccountNumber returns the 12 rightmost PAN digits excluding the check digit, as used in
+// Thales host commands.
+func AccountNumber(p string) (string, error) {
+	return pan.AccountNumber(p)
+}
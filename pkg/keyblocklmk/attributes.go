@@ -0,0 +1,112 @@
+package keyblocklmk
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Key operations permitted by a mode of use.
+const (
+	opEncrypt = 1 << iota
+	opDecrypt
+	opGenerate
+	opVerify
+	opSign
+	opDerive
+	opVariant
+)
+
+// modeOperations maps each mode of use to the operations it permits.
+var modeOperations = map[byte]int{
+	'B': opEncrypt | opDecrypt,
+	'C': opGenerate | opVerify,
+	'D': opDecrypt,
+	'E': opEncrypt,
+	'G': opGenerate,
+	'N': opEncrypt | opDecrypt | opGenerate | opVerify | opSign | opDerive | opVariant,
+	'S': opSign,
+	'T': opSign | opDecrypt,
+	'V': opVerify,
+	'X': opDerive,
+	'Y': opVariant,
+}
+
+// exportRestriction ranks exportability from the least to the most restrictive.
+var exportRestriction = map[byte]int{'S': 0, 'E': 1, 'N': 2}
+
+var (
+	// ErrInvalidAttribute is returned for an unknown mode of use or exportability.
+	ErrInvalidAttribute = errors.New("invalid key block attribute")
+	// ErrAttributeRelaxed is returned for an attribute change that widens what the key may
+	// be used for or where it may be exported.
+	ErrAttributeRelaxed = errors.New("attribute change relaxes key restrictions")
+)
+
+// CheckAttributeChange checks a change of the mode of use and exportability of a key block
+// from one header to another. A change is restrictive when the new mode of use permits a
+// subset of the operations of the old one and the new exportability is at least as strict
+// (S, then E, then N). Other changes fail with ErrAttributeRelaxed.
+func CheckAttributeChange(from, to Header) error {
+	oldOps, ok := modeOperations[from.ModeOfUse]
+	if !ok {
+		return fmt.Errorf("%w: mode of use %q", ErrInvalidAttribute, from.ModeOfUse)
+	}
+	newOps, ok := modeOperations[to.ModeOfUse]
+	if !ok {
+		return fmt.Errorf("%w: mode of use %q", ErrInvalidAttribute, to.ModeOfUse)
+	}
+	oldExport, ok := exportRestriction[from.Exportability]
+	if !ok {
+		return fmt.Errorf("%w: exportability %q", ErrInvalidAttribute, from.Exportability)
+	}
+	newExport, ok := exportRestriction[to.Exportability]
+	if !ok {
+		return fmt.Errorf("%w: exportability %q", ErrInvalidAttribute, to.Exportability)
+	}
+
+	if newOps&^oldOps != 0 {
+		return fmt.Errorf("%w: mode of use %c to %c", ErrAttributeRelaxed, from.ModeOfUse, to.ModeOfUse)
+	}
+	if newExport < oldExport {
+		return fmt.Errorf("%w: exportability %c to %c",
+			ErrAttributeRelaxed, from.Exportability, to.Exportability)
+	}
+
+	return nil
+}
+
+// ChangeAttributes unwraps a key block under the LMK and rewraps its key with a new mode of
+// use and exportability; a zero value keeps the attribute. Optional blocks and the other
+// header fields are kept. Unless relax is set, the change must be restrictive as defined by
+// CheckAttributeChange. It returns the new key block and the old header.
+func ChangeAttributes(
+	lmk, block []byte,
+	modeOfUse, exportability byte,
+	relax bool,
+	opts WrapOptions,
+) ([]byte, *Header, error) {
+	header, optBlocks, key, err := unwrapKeyBlockInternal(StaticLMK(lmk), block)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	changed := *header
+	if modeOfUse != 0 {
+		changed.ModeOfUse = modeOfUse
+	}
+	if exportability != 0 {
+		changed.Exportability = exportability
+	}
+	if err := CheckAttributeChange(*header, changed); err != nil {
+		if !relax || !errors.Is(err, ErrAttributeRelaxed) {
+			return nil, nil, err
+		}
+	}
+
+	out, err := WrapKeyBlockWithOptions(lmk, changed, optBlocks, key, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return out, header, nil
+}
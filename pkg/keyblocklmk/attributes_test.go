@@ -0,0 +1,91 @@
+package keyblocklmk
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCheckAttributeChange(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		from, to string // mode of use and exportability
+		want     error
+	}{
+		{"BE", "BE", nil},
+		{"BE", "EE", nil},
+		{"BE", "DN", nil},
+		{"NS", "GE", nil},
+		{"CE", "VE", nil},
+		{"TE", "SE", nil},
+		{"EE", "BE", ErrAttributeRelaxed},
+		{"BE", "NE", ErrAttributeRelaxed},
+		{"EE", "DE", ErrAttributeRelaxed},
+		{"BN", "BE", ErrAttributeRelaxed},
+		{"BE", "BS", ErrAttributeRelaxed},
+		{"BE", "QE", ErrInvalidAttribute},
+		{"BE", "BX", ErrInvalidAttribute},
+	}
+	for _, tc := range tests {
+		from := Header{ModeOfUse: tc.from[0], Exportability: tc.from[1]}
+		to := Header{ModeOfUse: tc.to[0], Exportability: tc.to[1]}
+		if err := CheckAttributeChange(from, to); !errors.Is(err, tc.want) {
+			t.Errorf("CheckAttributeChange(%s, %s) = %v, want %v", tc.from, tc.to, err, tc.want)
+		}
+	}
+}
+
+func TestChangeAttributes(t *testing.T) {
+	t.Parallel()
+
+	lmk := getTestLMK()
+	key := bytes.Repeat([]byte{0x5A}, 16)
+	header := Header{
+		Version:        '1',
+		KeyUsage:       "K0",
+		Algorithm:      'A',
+		ModeOfUse:      'B',
+		KeyVersionNum:  "07",
+		Exportability:  'E',
+		OptionalBlocks: 1,
+	}
+	text := OptionalBlock{Tag: "05", Value: []byte("ceremony")}
+	block, err := WrapKeyBlock(lmk, header, []OptionalBlock{text}, key)
+	if err != nil {
+		t.Fatalf("WrapKeyBlock failed: %v", err)
+	}
+
+	out, old, err := ChangeAttributes(lmk, block, 'E', 'N', false, WrapOptions{})
+	if err != nil {
+		t.Fatalf("ChangeAttributes() error = %v", err)
+	}
+	if old.ModeOfUse != 'B' || old.Exportability != 'E' {
+		t.Errorf("old header = %+v", old)
+	}
+	got, blocks, clear, err := UnwrapKeyBlockWithOptionalBlocks(lmk, out)
+	if err != nil || !bytes.Equal(clear, key) {
+		t.Fatalf("unwrap of changed block = %X, %v", clear, err)
+	}
+	want := header
+	want.ModeOfUse, want.Exportability = 'E', 'N'
+	if *got != want || len(blocks) != 1 || string(blocks[0].Value) != "ceremony" {
+		t.Errorf("changed header = %+v %+v, want %+v with the text block", got, blocks, want)
+	}
+
+	// Relaxing the change back needs relax.
+	if _, _, err := ChangeAttributes(lmk, out, 'B', 0, false, WrapOptions{}); !errors.Is(err, ErrAttributeRelaxed) {
+		t.Errorf("relaxing change error = %v, want ErrAttributeRelaxed", err)
+	}
+	relaxed, _, err := ChangeAttributes(lmk, out, 'B', 'E', true, WrapOptions{})
+	if err != nil {
+		t.Fatalf("relaxed change error = %v", err)
+	}
+	if got, err := ParseHeader(relaxed); err != nil || got.ModeOfUse != 'B' || got.Exportability != 'E' {
+		t.Errorf("relaxed header = %+v, %v", got, err)
+	}
+	// Unknown attributes are refused even with relax.
+	if _, _, err := ChangeAttributes(lmk, out, 'Q', 0, true, WrapOptions{}); !errors.Is(err, ErrInvalidAttribute) {
+		t.Errorf("unknown mode error = %v, want ErrInvalidAttribute", err)
+	}
+}
@@ -0,0 +1,106 @@
+package keyblocklmk
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+)
+
+// Limits on the number of key components that can be combined.
+const (
+	MinComponents = 2
+	MaxComponents = 9
+)
+
+// CombinedKeyVersion is the key version number of a key combined from components.
+const CombinedKeyVersion = "00"
+
+// ErrComponent is returned for component key blocks that cannot be combined.
+var ErrComponent = errors.New("invalid key component")
+
+// ComponentNumber returns the component number n of a key version number "cn", or 0 when
+// the key version does not mark a component.
+func ComponentNumber(keyVersion string) int {
+	if len(keyVersion) != 2 || keyVersion[0] != 'c' || keyVersion[1] < '1' || keyVersion[1] > '9' {
+		return 0
+	}
+
+	return int(keyVersion[1] - '0')
+}
+
+// CombineComponents unwraps component key blocks under the LMK and XORs their keys into a
+// single key block. Component N of a set of N carries key version cN; every component
+// from c1 to cN must be given exactly once, and the headers and optional blocks must match
+// apart from the key version. The combined key block has key version 00, and DES keys are
+// given odd parity. It returns the key block and the clear key.
+func CombineComponents(lmk []byte, blocks [][]byte, opts WrapOptions) ([]byte, []byte, error) {
+	if len(blocks) < MinComponents || len(blocks) > MaxComponents {
+		return nil, nil, fmt.Errorf("%w: %d components given, need %d to %d",
+			ErrComponent, len(blocks), MinComponents, MaxComponents)
+	}
+
+	var (
+		first       *Header
+		firstBlocks []OptionalBlock
+		firstOpt    []byte
+		combined    []byte
+		seen        = make([]bool, len(blocks)+1)
+	)
+	for i, block := range blocks {
+		header, optBlocks, key, err := unwrapKeyBlockInternal(StaticLMK(lmk), block)
+		if err != nil {
+			return nil, nil, fmt.Errorf("component %d: %w", i+1, err)
+		}
+
+		n := ComponentNumber(header.KeyVersionNum)
+		if n == 0 || n > len(blocks) {
+			return nil, nil, fmt.Errorf("%w: component %d has key version %q, want c1 to c%d",
+				ErrComponent, i+1, header.KeyVersionNum, len(blocks))
+		}
+		if seen[n] {
+			return nil, nil, fmt.Errorf("%w: component c%d given twice", ErrComponent, n)
+		}
+		seen[n] = true
+
+		var opt []byte
+		for _, b := range optBlocks {
+			opt = append(opt, b.Marshal()...)
+		}
+		if first == nil {
+			first, firstBlocks, firstOpt, combined = header, optBlocks, opt, key
+
+			continue
+		}
+		if !sameComponentHeader(first, header) || !bytes.Equal(firstOpt, opt) {
+			return nil, nil, fmt.Errorf("%w: component %d header does not match component 1",
+				ErrComponent, i+1)
+		}
+		if combined, err = cryptoutils.XORBytes(combined, key); err != nil {
+			return nil, nil, fmt.Errorf("%w: component %d key length differs", ErrComponent, i+1)
+		}
+	}
+
+	if isDESAlgorithm(first.Algorithm) {
+		combined = cryptoutils.FixKeyParity(combined)
+	}
+
+	header := *first
+	header.KeyVersionNum = CombinedKeyVersion
+	keyBlock, err := WrapKeyBlockWithOptions(lmk, header, firstBlocks, combined, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return keyBlock, combined, nil
+}
+
+// sameComponentHeader reports whether two component headers match apart from the key
+// version.
+func sameComponentHeader(a, b *Header) bool {
+	x, y := *a, *b
+	x.KeyVersionNum, y.KeyVersionNum = "", ""
+
+	return x == y
+}
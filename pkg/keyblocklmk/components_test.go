@@ -0,0 +1,102 @@
+package keyblocklmk_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+)
+
+// TestCombineComponents verifies combining component key blocks and rejecting bad sets.
+func TestCombineComponents(t *testing.T) {
+	t.Parallel()
+
+	lmk := keyblocklmk.DefaultTestAESLMK
+	base := keyblocklmk.Header{
+		Version:       '1',
+		KeyUsage:      "K0",
+		Algorithm:     'A',
+		ModeOfUse:     'B',
+		Exportability: 'E',
+	}
+	wrap := func(h keyblocklmk.Header, version string, key []byte) []byte {
+		t.Helper()
+		h.KeyVersionNum = version
+		block, err := keyblocklmk.WrapKeyBlock(lmk, h, nil, key)
+		if err != nil {
+			t.Fatalf("WrapKeyBlock failed: %v", err)
+		}
+
+		return block
+	}
+
+	k1 := bytes.Repeat([]byte{0x11}, 16)
+	k2 := bytes.Repeat([]byte{0x22}, 16)
+	k3 := bytes.Repeat([]byte{0x48}, 16)
+	c1, c2, c3 := wrap(base, "c1", k1), wrap(base, "c2", k2), wrap(base, "c3", k3)
+
+	t.Run("aes", func(t *testing.T) {
+		t.Parallel()
+
+		block, clear, err := keyblocklmk.CombineComponents(lmk, [][]byte{c3, c1, c2},
+			keyblocklmk.WrapOptions{})
+		if err != nil {
+			t.Fatalf("CombineComponents failed: %v", err)
+		}
+		want := bytes.Repeat([]byte{0x11 ^ 0x22 ^ 0x48}, 16)
+		if !bytes.Equal(clear, want) {
+			t.Errorf("clear key = %X, want %X", clear, want)
+		}
+		header, unwrapped, err := keyblocklmk.UnwrapKeyBlock(lmk, block)
+		if err != nil || !bytes.Equal(unwrapped, want) {
+			t.Fatalf("UnwrapKeyBlock() = %X, %v", unwrapped, err)
+		}
+		if header.KeyVersionNum != keyblocklmk.CombinedKeyVersion || header.KeyUsage != "K0" {
+			t.Errorf("combined header = %+v", header)
+		}
+	})
+
+	t.Run("tdes parity", func(t *testing.T) {
+		t.Parallel()
+
+		h := base
+		h.Version, h.Algorithm = '0', 'T'
+		d1 := bytes.Repeat([]byte{0x01}, 16)
+		d2 := bytes.Repeat([]byte{0x02}, 16)
+		_, clear, err := keyblocklmk.CombineComponents(lmk,
+			[][]byte{wrap(h, "c1", d1), wrap(h, "c2", d2)}, keyblocklmk.WrapOptions{})
+		if err != nil {
+			t.Fatalf("CombineComponents failed: %v", err)
+		}
+		if !cryptoutils.CheckKeyParity(clear) {
+			t.Errorf("combined DES key %X does not have odd parity", clear)
+		}
+	})
+
+	other := base
+	other.ModeOfUse = 'E'
+	tests := []struct {
+		name   string
+		blocks [][]byte
+	}{
+		{"single component", [][]byte{c1}},
+		{"duplicate component", [][]byte{c1, c1}},
+		{"missing component", [][]byte{c1, c3}},
+		{"not a component", [][]byte{c1, wrap(base, "00", k2)}},
+		{"header mismatch", [][]byte{c1, wrap(other, "c2", k2)}},
+		{"length mismatch", [][]byte{c1, wrap(base, "c2", bytes.Repeat([]byte{0x22}, 32))}},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, _, err := keyblocklmk.CombineComponents(lmk, tc.blocks, keyblocklmk.WrapOptions{})
+			if !errors.Is(err, keyblocklmk.ErrComponent) {
+				t.Errorf("CombineComponents() error = %v, want ErrComponent", err)
+			}
+		})
+	}
+}
@@ -1,3 +1,4 @@
 // Package keyblocklmk provides functions to wrap and unwrap cryptographic keys
-// under a Local Master Key (LMK) using Thales 'S' key block format.
+// under a Local Master Key (LMK) using Thales 'S' key block format, and TR-31 version A, B
+// and C key blocks under TDES key block protection keys.
 package keyblocklmk
@@ -0,0 +1,226 @@
+package keyblocklmk
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DUKPT key usages.
+const (
+	KeyUsageBDK  = "B0" // Base Derivation Key.
+	KeyUsageIPEK = "B1" // DUKPT Initial Key (IPEK / IKEY).
+)
+
+// Optional block identifiers carrying the DUKPT key namespace (ANSI X9.143).
+const (
+	OptionalBlockKSN          = "KS" // Initial KSN of a TDES DUKPT initial key, 20 hex.
+	OptionalBlockInitialKeyID = "IK" // Initial key ID of an AES DUKPT initial key, 16 hex.
+	OptionalBlockBDKID        = "BI" // BDK identifier: "00"+10 hex KSI or "01"+8 hex BDK ID.
+)
+
+// BDK identifier types used as the first two characters of a BI optional block.
+const (
+	bdkIDTypeKSI = "00" // TDES DUKPT Key Set Identifier.
+	bdkIDTypeAES = "01" // AES DUKPT BDK ID.
+)
+
+const (
+	tdesKSNLen = 20 // TDES DUKPT KSN, hex characters.
+	aesKSNLen  = 24 // AES DUKPT KSN, hex characters.
+	ksiLen     = 10 // TDES Key Set Identifier, hex characters.
+	aesBDKLen  = 8  // AES BDK ID, hex characters.
+	aesIKLen   = 16 // AES initial key ID, hex characters.
+)
+
+// ErrDUKPTBlock indicates a DUKPT key block with a missing or inconsistent KSN namespace.
+var ErrDUKPTBlock = errors.New("invalid DUKPT key block")
+
+// NewKSNBlock creates the KS optional block carrying the initial KSN of a TDES IPEK.
+func NewKSNBlock(ksn string) (OptionalBlock, error) {
+	if err := checkHex(ksn, tdesKSNLen); err != nil {
+		return OptionalBlock{}, fmt.Errorf("initial KSN: %w", err)
+	}
+
+	return OptionalBlock{Tag: OptionalBlockKSN, Value: []byte(strings.ToUpper(ksn))}, nil
+}
+
+// NewInitialKeyIDBlock creates the IK optional block carrying the initial key ID of an
+// AES DUKPT initial key.
+func NewInitialKeyIDBlock(id string) (OptionalBlock, error) {
+	if err := checkHex(id, aesIKLen); err != nil {
+		return OptionalBlock{}, fmt.Errorf("initial key ID: %w", err)
+	}
+
+	return OptionalBlock{Tag: OptionalBlockInitialKeyID, Value: []byte(strings.ToUpper(id))}, nil
+}
+
+// NewBDKIDBlock creates the BI optional block identifying a BDK: a 10 hex digit TDES Key
+// Set Identifier or an 8 hex digit AES BDK ID.
+func NewBDKIDBlock(id string) (OptionalBlock, error) {
+	var idType string
+	switch len(id) {
+	case ksiLen:
+		idType = bdkIDTypeKSI
+	case aesBDKLen:
+		idType = bdkIDTypeAES
+	default:
+		return OptionalBlock{}, fmt.Errorf("BDK ID must be %d or %d hex digits, got %d",
+			ksiLen, aesBDKLen, len(id))
+	}
+	if err := checkHex(id, len(id)); err != nil {
+		return OptionalBlock{}, fmt.Errorf("BDK ID: %w", err)
+	}
+
+	return OptionalBlock{Tag: OptionalBlockBDKID, Value: []byte(idType + strings.ToUpper(id))}, nil
+}
+
+// FindOptionalBlock returns the first optional block with the given tag.
+func FindOptionalBlock(blocks []OptionalBlock, tag string) (OptionalBlock, bool) {
+	for _, b := range blocks {
+		if b.Tag == tag {
+			return b, true
+		}
+	}
+
+	return OptionalBlock{}, false
+}
+
+// ValidateDUKPTBlocks checks that a BDK (B0) carries a BI block and that an initial key
+// (B1) carries a KS or IK block. Key blocks with other usages are accepted unchanged.
+func ValidateDUKPTBlocks(header *Header, blocks []OptionalBlock) error {
+	_, err := dukptNamespace(header, blocks)
+
+	return err
+}
+
+// CheckKSN verifies that ksn belongs to the namespace of a DUKPT key block: for a BDK the
+// KSN must start with its BDK ID, for an initial key it must derive from the initial KSN
+// or initial key ID.
+func CheckKSN(header *Header, blocks []OptionalBlock, ksn string) error {
+	ns, err := dukptNamespace(header, blocks)
+	if err != nil {
+		return err
+	}
+	if ns == nil {
+		return fmt.Errorf("%w: key usage %s is not a DUKPT key", ErrDUKPTBlock, header.KeyUsage)
+	}
+	if err := checkHex(ksn, ns.ksnLen); err != nil {
+		return fmt.Errorf("%w: KSN: %v", ErrDUKPTBlock, err)
+	}
+
+	ksn = strings.ToUpper(ksn)
+	if ns.initialKSN != "" {
+		if !sameKeySet(ksn, ns.initialKSN) {
+			return fmt.Errorf("%w: KSN %s does not derive from initial KSN %s",
+				ErrDUKPTBlock, ksn, ns.initialKSN)
+		}
+
+		return nil
+	}
+	if !strings.HasPrefix(ksn, ns.prefix) {
+		return fmt.Errorf("%w: KSN %s is outside key namespace %s", ErrDUKPTBlock, ksn, ns.prefix)
+	}
+
+	return nil
+}
+
+// UnwrapDUKPTKeyBlock unwraps a BDK or initial key block, validates its KSN optional
+// blocks and, when ksn is not empty, checks that the KSN belongs to the key.
+func UnwrapDUKPTKeyBlock(
+	lmk, keyBlock []byte,
+	ksn string,
+) (*Header, []OptionalBlock, []byte, error) {
+	header, blocks, key, err := UnwrapKeyBlockWithOptionalBlocks(lmk, keyBlock)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if header.KeyUsage != KeyUsageBDK && header.KeyUsage != KeyUsageIPEK {
+		return nil, nil, nil, fmt.Errorf("%w: key usage %s is not a DUKPT key",
+			ErrDUKPTBlock, header.KeyUsage)
+	}
+	if err := ValidateDUKPTBlocks(header, blocks); err != nil {
+		return nil, nil, nil, err
+	}
+	if ksn != "" {
+		if err := CheckKSN(header, blocks, ksn); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	return header, blocks, key, nil
+}
+
+// ksnNamespace describes the KSNs a DUKPT key may serve.
+type ksnNamespace struct {
+	ksnLen     int    // expected KSN length in hex characters.
+	prefix     string // required KSN prefix.
+	initialKSN string // TDES initial KSN; KSNs must match it outside the counter bits.
+}
+
+// dukptNamespace extracts the KSN namespace of a DUKPT key block. It returns nil for key
+// blocks that are not BDKs or initial keys.
+func dukptNamespace(header *Header, blocks []OptionalBlock) (*ksnNamespace, error) {
+	switch header.KeyUsage {
+	case KeyUsageBDK:
+		bi, ok := FindOptionalBlock(blocks, OptionalBlockBDKID)
+		if !ok {
+			return nil, fmt.Errorf("%w: BDK without %s optional block", ErrDUKPTBlock, OptionalBlockBDKID)
+		}
+		value := string(bi.Value)
+		switch {
+		case strings.HasPrefix(value, bdkIDTypeKSI) && checkHex(value[2:], ksiLen) == nil:
+			return &ksnNamespace{ksnLen: tdesKSNLen, prefix: strings.ToUpper(value[2:])}, nil
+		case strings.HasPrefix(value, bdkIDTypeAES) && checkHex(value[2:], aesBDKLen) == nil:
+			return &ksnNamespace{ksnLen: aesKSNLen, prefix: strings.ToUpper(value[2:])}, nil
+		default:
+			return nil, fmt.Errorf("%w: invalid BDK ID %q", ErrDUKPTBlock, value)
+		}
+	case KeyUsageIPEK:
+		if ks, ok := FindOptionalBlock(blocks, OptionalBlockKSN); ok {
+			if err := checkHex(string(ks.Value), tdesKSNLen); err != nil {
+				return nil, fmt.Errorf("%w: initial KSN: %v", ErrDUKPTBlock, err)
+			}
+
+			return &ksnNamespace{ksnLen: tdesKSNLen, initialKSN: strings.ToUpper(string(ks.Value))}, nil
+		}
+		if ik, ok := FindOptionalBlock(blocks, OptionalBlockInitialKeyID); ok {
+			if err := checkHex(string(ik.Value), aesIKLen); err != nil {
+				return nil, fmt.Errorf("%w: initial key ID: %v", ErrDUKPTBlock, err)
+			}
+
+			return &ksnNamespace{ksnLen: aesKSNLen, prefix: strings.ToUpper(string(ik.Value))}, nil
+		}
+
+		return nil, fmt.Errorf("%w: initial key without %s or %s optional block",
+			ErrDUKPTBlock, OptionalBlockKSN, OptionalBlockInitialKeyID)
+	default:
+		return nil, nil
+	}
+}
+
+// sameKeySet reports whether two TDES KSNs differ only in their 21 counter bits.
+func sameKeySet(a, b string) bool {
+	ab, _ := hex.DecodeString(a)
+	bb, _ := hex.DecodeString(b)
+	// Clear the 21-bit transaction counter in the rightmost bytes.
+	ab[7] &= 0xE0
+	bb[7] &= 0xE0
+	ab[8], ab[9] = 0, 0
+	bb[8], bb[9] = 0, 0
+
+	return string(ab) == string(bb)
+}
+
+// checkHex verifies that s consists of exactly n hex digits.
+func checkHex(s string, n int) error {
+	if len(s) != n {
+		return fmt.Errorf("expected %d hex digits, got %d", n, len(s))
+	}
+	if _, err := hex.DecodeString(s); err != nil {
+		return fmt.Errorf("invalid hex %q", s)
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package keyblocklmk_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+)
+
+func wrapDUKPTKey(
+	t *testing.T,
+	usage string,
+	algorithm byte,
+	blocks []keyblocklmk.OptionalBlock,
+	key []byte,
+) []byte {
+	t.Helper()
+
+	header := keyblocklmk.Header{
+		Version:        'S',
+		KeyUsage:       usage,
+		Algorithm:      algorithm,
+		ModeOfUse:      'X',
+		KeyVersionNum:  "00",
+		Exportability:  'S',
+		OptionalBlocks: byte(len(blocks)),
+	}
+	block, err := keyblocklmk.WrapKeyBlock(keyblocklmk.DefaultTestAESLMK, header, blocks, key)
+	if err != nil {
+		t.Fatalf("WrapKeyBlock failed: %v", err)
+	}
+
+	return block
+}
+
+// TestDUKPTKeyBlocks verifies KSN namespace validation of BDK and initial key blocks.
+func TestDUKPTKeyBlocks(t *testing.T) {
+	t.Parallel()
+
+	key := bytes.Repeat([]byte{0x11}, 16)
+	ks, err := keyblocklmk.NewKSNBlock("FFFF9876543210E00000")
+	if err != nil {
+		t.Fatalf("NewKSNBlock failed: %v", err)
+	}
+	ik, err := keyblocklmk.NewInitialKeyIDBlock("123456789ABCDEF0")
+	if err != nil {
+		t.Fatalf("NewInitialKeyIDBlock failed: %v", err)
+	}
+	bdkTDES, err := keyblocklmk.NewBDKIDBlock("FFFF987654")
+	if err != nil {
+		t.Fatalf("NewBDKIDBlock failed: %v", err)
+	}
+	bdkAES, err := keyblocklmk.NewBDKIDBlock("12345678")
+	if err != nil {
+		t.Fatalf("NewBDKIDBlock failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		usage   string
+		alg     byte
+		blocks  []keyblocklmk.OptionalBlock
+		ksn     string
+		wantErr bool
+	}{
+		{"tdes ipek no ksn", "B1", 'T', []keyblocklmk.OptionalBlock{ks}, "", false},
+		{"tdes ipek counter", "B1", 'T', []keyblocklmk.OptionalBlock{ks}, "FFFF9876543210E1FFFF", false},
+		{"tdes ipek other device", "B1", 'T', []keyblocklmk.OptionalBlock{ks}, "FFFF9876543211E00001", true},
+		{"aes ipek", "B1", 'A', []keyblocklmk.OptionalBlock{ik}, "123456789ABCDEF000000005", false},
+		{"aes ipek other key", "B1", 'A', []keyblocklmk.OptionalBlock{ik}, "123456789ABCDEF100000005", true},
+		{"tdes bdk", "B0", 'T', []keyblocklmk.OptionalBlock{bdkTDES}, "FFFF9876540000200001", false},
+		{"tdes bdk other set", "B0", 'T', []keyblocklmk.OptionalBlock{bdkTDES}, "FFFF9876550000200001", true},
+		{"aes bdk", "B0", 'A', []keyblocklmk.OptionalBlock{bdkAES}, "123456780000000100000001", false},
+		{"ksn wrong length", "B0", 'A', []keyblocklmk.OptionalBlock{bdkAES}, "1234567800000001", true},
+		{"bdk without id", "B0", 'T', nil, "", true},
+		{"ipek without ksn", "B1", 'T', []keyblocklmk.OptionalBlock{bdkTDES}, "", true},
+		{"not dukpt", "P0", 'T', []keyblocklmk.OptionalBlock{ks}, "", true},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			block := wrapDUKPTKey(t, tc.usage, tc.alg, tc.blocks, key)
+			header, blocks, got, err := keyblocklmk.UnwrapDUKPTKeyBlock(
+				keyblocklmk.DefaultTestAESLMK,
+				block,
+				tc.ksn,
+			)
+			if tc.wantErr {
+				if !errors.Is(err, keyblocklmk.ErrDUKPTBlock) {
+					t.Fatalf("expected ErrDUKPTBlock, got %v", err)
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("UnwrapDUKPTKeyBlock failed: %v", err)
+			}
+			if header.KeyUsage != tc.usage || !bytes.Equal(got, key) {
+				t.Errorf("unexpected result: usage %s key %X", header.KeyUsage, got)
+			}
+			if len(blocks) != len(tc.blocks) || !bytes.Equal(blocks[0].Value, tc.blocks[0].Value) {
+				t.Errorf("optional blocks = %+v, want %+v", blocks, tc.blocks)
+			}
+		})
+	}
+}
+
+// TestDUKPTOptionalBlockConstructors verifies input validation of the KSN block helpers.
+func TestDUKPTOptionalBlockConstructors(t *testing.T) {
+	t.Parallel()
+
+	if _, err := keyblocklmk.NewKSNBlock("FFFF98765432"); err == nil {
+		t.Error("expected error for short initial KSN")
+	}
+	if _, err := keyblocklmk.NewInitialKeyIDBlock("ZZZZ56789ABCDEF0"); err == nil {
+		t.Error("expected error for non-hex initial key ID")
+	}
+	if _, err := keyblocklmk.NewBDKIDBlock("123"); err == nil {
+		t.Error("expected error for BDK ID of invalid length")
+	}
+
+	bi, err := keyblocklmk.NewBDKIDBlock("ffff987654")
+	if err != nil {
+		t.Fatalf("NewBDKIDBlock failed: %v", err)
+	}
+	if string(bi.Value) != "00FFFF987654" {
+		t.Errorf("BI value = %s, want 00FFFF987654", bi.Value)
+	}
+}
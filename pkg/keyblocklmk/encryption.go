@@ -5,7 +5,8 @@ import (
 	"fmt"
 )
 
-// deriveEncryptionAndMACKeys derives the KBEK and KBAK from the LMK using AES-CMAC per ISO 20038.
+// deriveEncryptionAndMACKeys derives the KBEK and KBAK of Thales key blocks from the LMK
+// using AES-CMAC over block-sized derivation data.
 func deriveEncryptionAndMACKeys(lmk []byte, keyLenBytes int) ([]byte, []byte, error) {
 	const (
 		usageEnc uint16 = 0x0000 // encryption
@@ -0,0 +1,62 @@
+package keyblocklmk
+
+import "fmt"
+
+// ParseError reports a malformed field of a key block. Offset counts bytes from the start of
+// the key block, where the scheme tag is at offset 0.
+type ParseError struct {
+	Field    string
+	Offset   int
+	Expected string
+	Actual   string
+}
+
+// Error implements the error interface.
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%v: field %s at offset %d: expected %s, got %s",
+		ErrKeyBlockFormat, e.Field, e.Offset, e.Expected, e.Actual)
+}
+
+// Unwrap returns ErrKeyBlockFormat.
+func (e *ParseError) Unwrap() error {
+	return ErrKeyBlockFormat
+}
+
+// parseError returns a ParseError for field at offset.
+func parseError(field string, offset int, expected, actual string) error {
+	return &ParseError{Field: field, Offset: offset, Expected: expected, Actual: actual}
+}
+
+// lengthError returns a ParseError for a key block that ends before field.
+func lengthError(field string, offset, need, have int) error {
+	return parseError(field, offset, fmt.Sprintf("%d bytes", need), fmt.Sprintf("%d bytes", have))
+}
+
+// checkDigits returns a ParseError when data, found at offset, is not all decimal digits.
+func checkDigits(field string, offset int, data []byte) error {
+	for i, c := range data {
+		if c < '0' || c > '9' {
+			return parseError(field, offset+i, "decimal digit", fmt.Sprintf("%q", c))
+		}
+	}
+
+	return nil
+}
+
+// checkHexDigits returns a ParseError when data, found at offset, is not all hex digits.
+func checkHexDigits(field string, offset int, data []byte) error {
+	for i, c := range data {
+		if !isHexDigit(c) {
+			return parseError(field, offset+i, "hex digit", fmt.Sprintf("%q", c))
+		}
+	}
+	if len(data)%2 != 0 {
+		return parseError(field, offset, "even number of hex digits", fmt.Sprintf("%d", len(data)))
+	}
+
+	return nil
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'A' && c <= 'F') || (c >= 'a' && c <= 'f')
+}
@@ -5,16 +5,32 @@ import (
 	"fmt"
 )
 
+// TR-31 key contexts, carried in byte 14 of 'R' key block headers.
+const (
+	// KeyContextAny leaves the context to the key wrapping the block: the key may be held
+	// in storage and exchanged.
+	KeyContextAny byte = 0
+	// KeyContextStorage allows the key to be wrapped only under a storage key such as an
+	// LMK, so it must not be exchanged with another party.
+	KeyContextStorage byte = 1
+	// KeyContextExchange allows the key to be wrapped only under a key exchange key, so it
+	// must not be imported into storage.
+	KeyContextExchange byte = 2
+)
+
+// ErrKeyContext is returned when a key block is used in a context its key context forbids.
+var ErrKeyContext = errors.New("key block key context forbids this use")
+
 // Header represents the 16-byte Key Block Header for Thales 'S' format.
 type Header struct {
-	Version        byte   // Key Block Version ID (byte 0: "0" for 3-DES, "1" for AES).
+	Version        byte   // Key Block Version ID (byte 0: "0" for 3-DES, "1" for AES, TR-31 "A"-"C", ISO 20038 "E").
 	KeyUsage       string // 2-byte usage code (bytes 5-6).
 	Algorithm      byte   // Algorithm character (byte 7).
 	ModeOfUse      byte   // Mode of use (byte 8).
 	KeyVersionNum  string // 2-digit key version number (bytes 9-10).
 	Exportability  byte   // Exportability (byte 11).
 	OptionalBlocks byte   // Number of optional header blocks (bytes 12-13: 0–99).
-	KeyContext     byte   // LMK identifier (bytes 14-15).
+	KeyContext     byte   // Bytes 14-15: LMK identifier of 'S' blocks, TR-31 key context (byte 14) of 'R' blocks.
 }
 
 // toBytes serializes the Header into its 16-byte representation.
@@ -35,12 +51,38 @@ func (h Header) toBytes() ([]byte, error) {
 	b[11] = h.Exportability
 	b[12] = '0' + (h.OptionalBlocks / 10)
 	b[13] = '0' + (h.OptionalBlocks % 10)
-	b[14] = '0' + (h.KeyContext / 10)
-	b[15] = '0' + (h.KeyContext % 10)
+	if isTR31Version(h.Version) {
+		// TR-31 reserves byte 15.
+		b[14] = '0' + h.KeyContext
+		b[15] = '0'
+	} else {
+		b[14] = '0' + (h.KeyContext / 10)
+		b[15] = '0' + (h.KeyContext % 10)
+	}
 
 	return b, nil
 }
 
+// MarshalBinary returns the 16-byte header with a zero block length, as key blocks carry
+// it outside of the Thales and TR-31 formats, for example in TR-34 key tokens.
+func (h Header) MarshalBinary() ([]byte, error) {
+	return h.toBytes()
+}
+
+// UnmarshalBinary parses a 16-byte header.
+func (h *Header) UnmarshalBinary(data []byte) error {
+	if len(data) != headerSize {
+		return lengthError("header", 0, headerSize, len(data))
+	}
+	parsed, err := parseHeader(data, 0)
+	if err != nil {
+		return err
+	}
+	*h = *parsed
+
+	return nil
+}
+
 // fromBytes parses a 16-byte slice into a Header.
 func (h *Header) fromBytes(data []byte) error {
 	if len(data) != 16 {
@@ -54,7 +96,32 @@ func (h *Header) fromBytes(data []byte) error {
 	h.KeyVersionNum = string(data[9:11])
 	h.Exportability = data[11]
 	h.OptionalBlocks = (data[12]-'0')*10 + (data[13] - '0')
-	h.KeyContext = (data[14]-'0')*10 + (data[15] - '0')
+	if isTR31Version(h.Version) {
+		h.KeyContext = data[14] - '0'
+	} else {
+		h.KeyContext = (data[14]-'0')*10 + (data[15] - '0')
+	}
+
+	return nil
+}
+
+// CheckStorage returns ErrKeyContext when the key of an 'R' block may only be exchanged,
+// so it must not be imported into storage or used as a stored key. 'S' blocks are held
+// under an LMK and always pass.
+func (h Header) CheckStorage() error {
+	if isTR31Version(h.Version) && h.KeyContext == KeyContextExchange {
+		return fmt.Errorf("%w: exchange only key in storage", ErrKeyContext)
+	}
+
+	return nil
+}
+
+// CheckExchange returns ErrKeyContext when the key of an 'R' block may only be held in
+// storage, so it must not be wrapped in a block for another party.
+func (h Header) CheckExchange() error {
+	if isTR31Version(h.Version) && h.KeyContext == KeyContextStorage {
+		return fmt.Errorf("%w: storage only key exported", ErrKeyContext)
+	}
 
 	return nil
 }
@@ -0,0 +1,181 @@
+package keyblocklmk
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+)
+
+// ISO20038VersionE is the ISO 20038 key block version ID. Version E blocks are protected
+// by an AES key block protection key and carry the TR31SchemeTag in host messages.
+const ISO20038VersionE byte = 'E'
+
+// ErrISO20038KBPK is returned when the key block protection key is not an AES key.
+var ErrISO20038KBPK = errors.New("invalid ISO 20038 key block protection key")
+
+// isTR31Version reports whether version is carried in TR-31 'R' format, that is a TDES
+// TR-31 version or ISO 20038 version E.
+func isTR31Version(version byte) bool {
+	return isTR31TDESVersion(version) || version == ISO20038VersionE
+}
+
+// deriveISO20038Keys returns the encryption and MAC keys of an ISO 20038 block, derived
+// from the KBPK with AES CMAC. Each derived key has the length of the KBPK.
+func deriveISO20038Keys(kbpk []byte) ([]byte, []byte, error) {
+	var algorithm byte
+	switch len(kbpk) {
+	case 16:
+		algorithm = 0x02
+	case 24:
+		algorithm = 0x03
+	case 32:
+		algorithm = 0x04
+	default:
+		return nil, nil, fmt.Errorf("%w: AES key of %d bytes", ErrISO20038KBPK, len(kbpk))
+	}
+
+	// Derivation data: counter, key usage (0000 encryption, 0001 MAC), separator,
+	// algorithm (0002, 0003, 0004 for AES-128, -192, -256) and key length in bits.
+	bits := len(kbpk) * 8
+	derive := func(usage byte) ([]byte, error) {
+		out := make([]byte, 0, 2*aes.BlockSize)
+		for counter := byte(1); len(out) < len(kbpk); counter++ {
+			data := []byte{counter, 0x00, usage, 0x00, 0x00, algorithm, byte(bits >> 8), byte(bits)}
+			mac, err := computeAESCMAC(kbpk, data)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, mac...)
+		}
+
+		return out[:len(kbpk)], nil
+	}
+
+	kbek, err := derive(0x00)
+	if err != nil {
+		return nil, nil, err
+	}
+	kbak, err := derive(0x01)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return kbek, kbak, nil
+}
+
+// wrapISO20038 encrypts key under the AES KBPK in ISO 20038 version E format and appends
+// the block with its 'R' scheme tag to dst. The header carries the real block length.
+func wrapISO20038(
+	dst []byte,
+	p LMKProvider,
+	header Header,
+	optBlocks []OptionalBlock,
+	key []byte,
+	random io.Reader,
+) ([]byte, error) {
+	kbek, kbak, err := p.WrappingKeys(header.Version)
+	if err != nil {
+		return dst, err
+	}
+	defer cryptoutils.Zeroize(kbek, kbak)
+	opt, count, err := marshalTR31OptionalBlocks(optBlocks, aes.BlockSize)
+	if err != nil {
+		return dst, err
+	}
+	header.OptionalBlocks = byte(count)
+
+	// Clear key data: 2-byte key length in bits, key, random padding to the block size.
+	keyBits := len(key) * 8
+	// The buffer has room for the padding, so the clear key data stays in one buffer.
+	plain := make([]byte, 0, 2+len(key)+aes.BlockSize)
+	defer cryptoutils.Zeroize(plain[:cap(plain)])
+	plain = append(plain, byte(keyBits>>8), byte(keyBits))
+	plain = append(plain, key...)
+	if pad := (aes.BlockSize - len(plain)%aes.BlockSize) % aes.BlockSize; pad > 0 {
+		padding := make([]byte, pad)
+		if _, err := io.ReadFull(random, padding); err != nil {
+			return dst, fmt.Errorf("random pad generation failed: %v", err)
+		}
+		plain = append(plain, padding...)
+	}
+
+	blockLen := headerSize + len(opt) + 2*len(plain) + 2*aes.BlockSize
+	if blockLen > 9999 {
+		return dst, errors.New("key block too long")
+	}
+	headerBytes, err := header.toBytes()
+	if err != nil {
+		return dst, err
+	}
+	copy(headerBytes[1:5], fmt.Sprintf("%04d", blockLen))
+	authenticated := slices.Concat(headerBytes, opt)
+
+	// The CMAC over header and clear key data is the initial counter block of the key
+	// data encryption.
+	mac, err := computeAESCMAC(kbak, slices.Concat(authenticated, plain))
+	if err != nil {
+		return dst, err
+	}
+	kbekBlock, err := cryptoprovider.NewAESCipher(kbek)
+	if err != nil {
+		return dst, err
+	}
+	encrypted := make([]byte, len(plain))
+	cipher.NewCTR(kbekBlock, mac).XORKeyStream(encrypted, plain)
+
+	dst = slices.Grow(dst, 1+blockLen)
+	dst = append(dst, TR31SchemeTag)
+	dst = append(dst, authenticated...)
+	dst = appendUpperHex(dst, encrypted)
+
+	return appendUpperHex(dst, mac), nil
+}
+
+// unwrapISO20038 authenticates and decrypts an ISO 20038 version E block. block follows
+// the scheme tag and header is its parsed header.
+func unwrapISO20038(
+	p LMKProvider,
+	block []byte,
+	header *Header,
+) (*Header, []OptionalBlock, []byte, error) {
+	parts, err := splitTR31Block(block, header, aes.BlockSize, aes.BlockSize)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	kbek, kbak, err := p.WrappingKeys(header.Version)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer cryptoutils.Zeroize(kbek, kbak)
+	kbekBlock, err := cryptoprovider.NewAESCipher(kbek)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	plain := make([]byte, len(parts.encrypted))
+	cipher.NewCTR(kbekBlock, parts.mac).XORKeyStream(plain, parts.encrypted)
+	calcMAC, err := computeAESCMAC(kbak, slices.Concat(parts.authenticated, plain))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if !cryptoutils.ConstantTimeEqual(calcMAC, parts.mac) {
+		clear(plain)
+
+		return nil, nil, nil, errors.New("mac verification failed")
+	}
+
+	key, err := tr31ClearKey(header, plain, parts.offset)
+	clear(plain)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return header, parts.optBlocks, key, nil
+}
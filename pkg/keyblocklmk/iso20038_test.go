@@ -0,0 +1,134 @@
+package keyblocklmk
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestISO20038RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	key, _ := hex.DecodeString("3F419E1CB7079442AA37474C2EFBF8B8")
+	ksn := OptionalBlock{Tag: "KS", Value: []byte("00604B120F9292800000")}
+
+	for _, kbpkLen := range []int{16, 24, 32} {
+		for _, opt := range [][]OptionalBlock{nil, {ksn}} {
+			t.Run(fmt.Sprintf("%d/%d", kbpkLen, len(opt)), func(t *testing.T) {
+				t.Parallel()
+
+				kbpk := bytes.Repeat([]byte{0x88, 0xE1}, kbpkLen/2)
+				header := Header{
+					Version:       ISO20038VersionE,
+					KeyUsage:      "P0",
+					Algorithm:     'A',
+					ModeOfUse:     'E',
+					KeyVersionNum: "00",
+					Exportability: 'E',
+				}
+				block, err := WrapKeyBlock(kbpk, header, opt, key)
+				if err != nil {
+					t.Fatalf("WrapKeyBlock() error = %v", err)
+				}
+				if block[0] != TR31SchemeTag || block[1] != ISO20038VersionE {
+					t.Fatalf("block starts with %q", block[:2])
+				}
+				if got := string(block[2:6]); got != fmt.Sprintf("%04d", len(block)-1) {
+					t.Errorf("block length field = %s, want %d", got, len(block)-1)
+				}
+
+				got, blocks, clear, err := UnwrapKeyBlockWithOptionalBlocks(kbpk, block)
+				if err != nil {
+					t.Fatalf("UnwrapKeyBlock() error = %v", err)
+				}
+				if !bytes.Equal(clear, key) {
+					t.Errorf("clear key = %X, want %X", clear, key)
+				}
+				if got.Version != ISO20038VersionE || got.KeyUsage != "P0" {
+					t.Errorf("header = %+v", got)
+				}
+				if len(blocks) != len(opt) ||
+					(len(opt) > 0 && !bytes.Equal(blocks[0].Value, ksn.Value)) {
+					t.Errorf("optional blocks = %+v, want %+v", blocks, opt)
+				}
+			})
+		}
+	}
+}
+
+func TestISO20038Binding(t *testing.T) {
+	t.Parallel()
+
+	kbpk, _ := hex.DecodeString("88E1AB2A2E3DD38C1FA039A536500CC8")
+	key, _ := hex.DecodeString("3F419E1CB7079442AA37474C2EFBF8B8")
+	header := Header{
+		Version: ISO20038VersionE, KeyUsage: "P0", Algorithm: 'A', ModeOfUse: 'E',
+		KeyVersionNum: "00", Exportability: 'E',
+	}
+	block, err := WrapKeyBlock(kbpk, header, nil, key)
+	if err != nil {
+		t.Fatalf("WrapKeyBlock() error = %v", err)
+	}
+	if want := "E0112P0AE00E0000"; string(block[1:17]) != want {
+		t.Errorf("header = %q, want %q", block[1:17], want)
+	}
+
+	// Decrypt independently: AES CTR under the CMAC derived encryption key with the MAC as
+	// initial counter, then check the MAC under the derived authentication key.
+	derive := func(usage byte) []byte {
+		k, _ := computeAESCMAC(kbpk, []byte{0x01, 0x00, usage, 0x00, 0x00, 0x02, 0x00, 0x80})
+
+		return k
+	}
+	mac, _ := hex.DecodeString(string(block[len(block)-32:]))
+	encrypted, _ := hex.DecodeString(string(block[17 : len(block)-32]))
+	plain := make([]byte, len(encrypted))
+	c, _ := aes.NewCipher(derive(0x00))
+	cipher.NewCTR(c, mac).XORKeyStream(plain, encrypted)
+	if bits := int(plain[0])<<8 | int(plain[1]); bits != 128 || !bytes.Equal(plain[2:18], key) {
+		t.Errorf("decrypted key data = %X", plain)
+	}
+	calc, _ := computeAESCMAC(derive(0x01), append(bytes.Clone(block[1:17]), plain...))
+	if !bytes.Equal(calc, mac) {
+		t.Errorf("MAC = %X, want %X", mac, calc)
+	}
+}
+
+func TestISO20038Errors(t *testing.T) {
+	t.Parallel()
+
+	kbpk, _ := hex.DecodeString("88E1AB2A2E3DD38C1FA039A536500CC8")
+	other, _ := hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+	key, _ := hex.DecodeString("3F419E1CB7079442AA37474C2EFBF8B8")
+	header := Header{
+		Version: ISO20038VersionE, KeyUsage: "K0", Algorithm: 'A', ModeOfUse: 'B',
+		KeyVersionNum: "00", Exportability: 'N',
+	}
+
+	if _, err := WrapKeyBlock(kbpk[:8], header, nil, key); !errors.Is(err, ErrISO20038KBPK) {
+		t.Errorf("WrapKeyBlock() with a DES KBPK error = %v, want ErrISO20038KBPK", err)
+	}
+
+	block, err := WrapKeyBlock(kbpk, header, nil, key)
+	if err != nil {
+		t.Fatalf("WrapKeyBlock() error = %v", err)
+	}
+	if _, _, err := UnwrapKeyBlock(other, block); err == nil {
+		t.Error("UnwrapKeyBlock() under another KBPK succeeded")
+	}
+
+	tampered := bytes.Clone(block)
+	tampered[20] ^= 0x01
+	if _, _, err := UnwrapKeyBlock(kbpk, tampered); err == nil {
+		t.Error("UnwrapKeyBlock() of a tampered block succeeded")
+	}
+
+	if _, err := TranslateKeyBlock(kbpk, block, getTestLMK(),
+		TranslateOptions{Version: '1'}); !errors.Is(err, ErrNotExportable) {
+		t.Errorf("TranslateKeyBlock() of a non-exportable block error = %v, want ErrNotExportable", err)
+	}
+}
@@ -0,0 +1,39 @@
+package keyblocklmk
+
+// LMKProvider supplies the keys protecting the key blocks of an LMK. Key blocks are wrapped
+// and unwrapped with the encryption key (KBEK) and MAC key (KBAK) that the provider returns
+// for the version of their header, so each LMK of a registry, and LMKs held outside the
+// process, can derive them in their own way.
+type LMKProvider interface {
+	// WrappingKeys returns the KBEK and KBAK of key blocks of the given version. The caller
+	// owns the returned slices and zeroizes them after use.
+	WrappingKeys(version byte) (kbek, kbak []byte, err error)
+}
+
+// StaticLMK is an LMKProvider holding the key block protection key of the LMK in memory.
+// The wrapping keys are derived with DeriveWrappingKeys.
+type StaticLMK []byte
+
+// WrappingKeys implements LMKProvider.
+func (l StaticLMK) WrappingKeys(version byte) ([]byte, []byte, error) {
+	return DeriveWrappingKeys(version, l)
+}
+
+// DeriveWrappingKeys derives the KBEK and KBAK of key blocks of the given version from the
+// key block protection key kbpk:
+//   - TR-31 versions A and C: the KBPK variants;
+//   - TR-31 version B: TDES CMAC derivation;
+//   - TR-31 version D and ISO 20038 version E: the AES CMAC derivation of ANSI X9.143, whose
+//     8-byte derivation data names the AES key size of the KBPK;
+//   - Thales versions such as '1': the payShield AES CMAC derivation, whose derivation data
+//     is padded to a full block and always names AES-256.
+func DeriveWrappingKeys(version byte, kbpk []byte) ([]byte, []byte, error) {
+	switch {
+	case isTR31TDESVersion(version):
+		return deriveTR31Keys(version, kbpk)
+	case version == TR31VersionD || version == ISO20038VersionE:
+		return deriveISO20038Keys(kbpk)
+	default:
+		return deriveEncryptionAndMACKeys(kbpk, len(kbpk))
+	}
+}
@@ -0,0 +1,83 @@
+package keyblocklmk
+
+import (
+	"bytes"
+	"testing"
+)
+
+// recordingLMK is an LMKProvider that records the versions it derives wrapping keys for.
+type recordingLMK struct {
+	StaticLMK
+	versions *[]byte
+}
+
+func (l recordingLMK) WrappingKeys(version byte) ([]byte, []byte, error) {
+	*l.versions = append(*l.versions, version)
+
+	return l.StaticLMK.WrappingKeys(version)
+}
+
+func TestDeriveWrappingKeys(t *testing.T) {
+	t.Parallel()
+	lmk := getTestLMK()
+
+	thalesEnc, thalesMAC, err := DeriveWrappingKeys('1', lmk)
+	if err != nil {
+		t.Fatalf("DeriveWrappingKeys('1') error = %v", err)
+	}
+	wantEnc, wantMAC, _ := deriveEncryptionAndMACKeys(lmk, len(lmk))
+	if !bytes.Equal(thalesEnc, wantEnc) || !bytes.Equal(thalesMAC, wantMAC) {
+		t.Error("version 1 does not use the Thales derivation")
+	}
+
+	tr31Enc, tr31MAC, err := DeriveWrappingKeys(TR31VersionD, lmk)
+	if err != nil {
+		t.Fatalf("DeriveWrappingKeys('D') error = %v", err)
+	}
+	wantEnc, wantMAC, _ = deriveISO20038Keys(lmk)
+	if !bytes.Equal(tr31Enc, wantEnc) || !bytes.Equal(tr31MAC, wantMAC) {
+		t.Error("version D does not use the X9.143 derivation")
+	}
+	if bytes.Equal(thalesEnc, tr31Enc) || bytes.Equal(thalesMAC, tr31MAC) {
+		t.Error("versions 1 and D derive the same wrapping keys")
+	}
+
+	if _, _, err := DeriveWrappingKeys(TR31VersionB, lmk); err == nil {
+		t.Error("DeriveWrappingKeys('B') accepted an AES-256 KBPK")
+	}
+}
+
+func TestWrapUnwrapWithProvider(t *testing.T) {
+	t.Parallel()
+	key := bytes.Repeat([]byte{0x5B}, 16)
+
+	for _, version := range []byte{'1', TR31VersionD} {
+		var versions []byte
+		p := recordingLMK{StaticLMK: getTestLMK(), versions: &versions}
+		header := Header{
+			Version:       version,
+			KeyUsage:      "K0",
+			Algorithm:     'A',
+			ModeOfUse:     'B',
+			KeyVersionNum: "00",
+			Exportability: 'S',
+		}
+
+		block, err := WrapKeyBlockWithProvider(p, header, nil, key, WrapOptions{})
+		if err != nil {
+			t.Fatalf("WrapKeyBlockWithProvider(%c) error = %v", version, err)
+		}
+		_, _, got, err := UnwrapKeyBlockWithProvider(p, block)
+		if err != nil || !bytes.Equal(got, key) {
+			t.Fatalf("UnwrapKeyBlockWithProvider(%c) = %X, %v", version, got, err)
+		}
+		if !bytes.Equal(versions, []byte{version, version}) {
+			t.Errorf("wrapping keys derived for versions %q, want %c twice", versions, version)
+		}
+
+		// The StaticLMK functions derive the same keys.
+		if _, got, err := UnwrapKeyBlock(getTestLMK(), block); err != nil || !bytes.Equal(got, key) {
+			t.Errorf("UnwrapKeyBlock(%c) = %X, %v", version, got, err)
+		}
+	}
+}
@@ -1,5 +1,14 @@
 package keyblocklmk
 
+// OptionalBlockKeyStatus is the Thales optional block carrying the status of a key.
+const OptionalBlockKeyStatus = "00"
+
+// Key status values of the 00 optional block.
+const (
+	KeyStatusLive byte = 'L' // Production key.
+	KeyStatusTest byte = 'T' // Key created under a test LMK.
+)
+
 // OptionalBlock represents a TLV-encoded optional header block.
 // Tag is a 2-character string, Value is the raw bytes of the TLV value.
 type OptionalBlock struct {
@@ -19,3 +28,14 @@ func (o OptionalBlock) Marshal() []byte {
 
 	return buf
 }
+
+// KeyStatus returns the value of the key status optional block, or zero when the key block
+// carries none.
+func KeyStatus(blocks []OptionalBlock) byte {
+	b, ok := FindOptionalBlock(blocks, OptionalBlockKeyStatus)
+	if !ok || len(b.Value) != 1 {
+		return 0
+	}
+
+	return b.Value[0]
+}
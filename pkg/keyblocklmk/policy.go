@@ -0,0 +1,118 @@
+package keyblocklmk
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync/atomic"
+)
+
+// PolicyOperation identifies the key block operation a PolicyValidator is consulted for.
+type PolicyOperation int
+
+const (
+	// PolicyUnwrap is an unwrap of an authenticated key block.
+	PolicyUnwrap PolicyOperation = iota
+	// PolicyWrap is a wrap of a clear key, before it is encrypted.
+	PolicyWrap
+)
+
+// String returns the operation name.
+func (op PolicyOperation) String() string {
+	switch op {
+	case PolicyUnwrap:
+		return "unwrap"
+	case PolicyWrap:
+		return "wrap"
+	default:
+		return fmt.Sprintf("PolicyOperation(%d)", int(op))
+	}
+}
+
+// ErrPolicyViolation is returned when the installed PolicyValidator rejects a key block.
+var ErrPolicyViolation = errors.New("key block rejected by policy")
+
+// PolicyValidator decides whether a key block may be unwrapped or wrapped, given its header
+// and optional blocks. A non-nil error rejects the key block.
+type PolicyValidator interface {
+	ValidateKeyBlock(op PolicyOperation, header Header, optBlocks []OptionalBlock) error
+}
+
+// PolicyFunc adapts a function to the PolicyValidator interface.
+type PolicyFunc func(op PolicyOperation, header Header, optBlocks []OptionalBlock) error
+
+// ValidateKeyBlock calls f.
+func (f PolicyFunc) ValidateKeyBlock(
+	op PolicyOperation,
+	header Header,
+	optBlocks []OptionalBlock,
+) error {
+	return f(op, header, optBlocks)
+}
+
+// policyValidator holds the validator installed with SetPolicyValidator.
+var policyValidator atomic.Pointer[PolicyValidator]
+
+// SetPolicyValidator installs v for every subsequent unwrap and wrap in the package,
+// including translation, attribute changes and component splits. nil removes it. Keys
+// are rejected after authentication on unwrap, so a tampered block still fails with a MAC
+// error, and before encryption on wrap.
+func SetPolicyValidator(v PolicyValidator) {
+	if v == nil {
+		policyValidator.Store(nil)
+
+		return
+	}
+	policyValidator.Store(&v)
+}
+
+// checkPolicy consults the installed validator. Rejections wrap ErrPolicyViolation.
+func checkPolicy(op PolicyOperation, header *Header, optBlocks []OptionalBlock) error {
+	v := policyValidator.Load()
+	if v == nil {
+		return nil
+	}
+	err := (*v).ValidateKeyBlock(op, *header, optBlocks)
+	if err == nil || errors.Is(err, ErrPolicyViolation) {
+		return err
+	}
+
+	return fmt.Errorf("%w: %w", ErrPolicyViolation, err)
+}
+
+// HeaderPolicy is a PolicyValidator that accepts key blocks whose header attributes are in
+// the allowed sets. An empty set allows any value.
+type HeaderPolicy struct {
+	KeyUsages      []string // allowed key usages, such as "P0" or "K0"
+	Algorithms     []byte   // allowed algorithms, such as 'A' or 'T'
+	ModesOfUse     []byte   // allowed modes of use
+	Exportability  []byte   // allowed exportability values
+	KeyVersionNums []string // allowed key version numbers
+	// Wrap also applies the policy to wraps; by default only unwraps are checked.
+	Wrap bool
+}
+
+// ValidateKeyBlock implements PolicyValidator.
+func (p HeaderPolicy) ValidateKeyBlock(
+	op PolicyOperation,
+	header Header,
+	_ []OptionalBlock,
+) error {
+	if op == PolicyWrap && !p.Wrap {
+		return nil
+	}
+	switch {
+	case len(p.KeyUsages) > 0 && !slices.Contains(p.KeyUsages, header.KeyUsage):
+		return fmt.Errorf("%w: key usage %s", ErrPolicyViolation, header.KeyUsage)
+	case len(p.Algorithms) > 0 && !slices.Contains(p.Algorithms, header.Algorithm):
+		return fmt.Errorf("%w: algorithm %q", ErrPolicyViolation, header.Algorithm)
+	case len(p.ModesOfUse) > 0 && !slices.Contains(p.ModesOfUse, header.ModeOfUse):
+		return fmt.Errorf("%w: mode of use %q", ErrPolicyViolation, header.ModeOfUse)
+	case len(p.Exportability) > 0 && !slices.Contains(p.Exportability, header.Exportability):
+		return fmt.Errorf("%w: exportability %q", ErrPolicyViolation, header.Exportability)
+	case len(p.KeyVersionNums) > 0 && !slices.Contains(p.KeyVersionNums, header.KeyVersionNum):
+		return fmt.Errorf("%w: key version %s", ErrPolicyViolation, header.KeyVersionNum)
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package keyblocklmk
+
+import (
+	"errors"
+	"testing"
+)
+
+// The tests below install a package-wide validator and must not run in parallel.
+
+func TestPolicyValidatorUnwrap(t *testing.T) {
+	lmk := getTestLMK()
+	key := []byte("0123456789ABCDEF")
+	header := Header{
+		Version: '1', KeyUsage: "P0", Algorithm: 'A', ModeOfUse: 'E',
+		KeyVersionNum: "00", Exportability: 'E',
+	}
+	block, err := WrapKeyBlock(lmk, header, nil, key)
+	if err != nil {
+		t.Fatalf("WrapKeyBlock() error = %v", err)
+	}
+
+	t.Cleanup(func() { SetPolicyValidator(nil) })
+	tests := []struct {
+		name    string
+		policy  HeaderPolicy
+		wantErr bool
+	}{
+		{"empty policy", HeaderPolicy{}, false},
+		{"usage allowed", HeaderPolicy{KeyUsages: []string{"K0", "P0"}}, false},
+		{"usage rejected", HeaderPolicy{KeyUsages: []string{"K0"}}, true},
+		{"algorithm rejected", HeaderPolicy{Algorithms: []byte{'T'}}, true},
+		{"mode of use rejected", HeaderPolicy{ModesOfUse: []byte{'D'}}, true},
+		{"exportability rejected", HeaderPolicy{Exportability: []byte{'N'}}, true},
+		{"key version rejected", HeaderPolicy{KeyVersionNums: []string{"01"}}, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			SetPolicyValidator(tc.policy)
+			got, clear, err := UnwrapKeyBlock(lmk, block)
+			if tc.wantErr {
+				if !errors.Is(err, ErrPolicyViolation) || clear != nil || got != nil {
+					t.Errorf("UnwrapKeyBlock() = %v, %X, %v, want ErrPolicyViolation", got, clear, err)
+				}
+
+				return
+			}
+			if err != nil || string(clear) != string(key) {
+				t.Errorf("UnwrapKeyBlock() = %X, %v", clear, err)
+			}
+		})
+	}
+}
+
+func TestPolicyValidatorWrap(t *testing.T) {
+	lmk := getTestLMK()
+	key := []byte("0123456789ABCDEF")
+	header := Header{
+		Version: '1', KeyUsage: "K0", Algorithm: 'A', ModeOfUse: 'B',
+		KeyVersionNum: "00", Exportability: 'S',
+	}
+	t.Cleanup(func() { SetPolicyValidator(nil) })
+
+	SetPolicyValidator(HeaderPolicy{Exportability: []byte{'N', 'E'}})
+	if _, err := WrapKeyBlock(lmk, header, nil, key); err != nil {
+		t.Errorf("WrapKeyBlock() with an unwrap-only policy error = %v", err)
+	}
+
+	SetPolicyValidator(HeaderPolicy{Exportability: []byte{'N', 'E'}, Wrap: true})
+	if _, err := WrapKeyBlock(lmk, header, nil, key); !errors.Is(err, ErrPolicyViolation) {
+		t.Errorf("WrapKeyBlock() error = %v, want ErrPolicyViolation", err)
+	}
+
+	// Errors from custom validators are wrapped and see the operation.
+	var ops []PolicyOperation
+	errDenied := errors.New("denied")
+	SetPolicyValidator(PolicyFunc(func(op PolicyOperation, _ Header, _ []OptionalBlock) error {
+		ops = append(ops, op)
+		if op == PolicyUnwrap {
+			return errDenied
+		}
+
+		return nil
+	}))
+	block, err := WrapKeyBlock(lmk, header, nil, key)
+	if err != nil {
+		t.Fatalf("WrapKeyBlock() error = %v", err)
+	}
+	_, _, err = UnwrapKeyBlock(lmk, block)
+	if !errors.Is(err, ErrPolicyViolation) || !errors.Is(err, errDenied) {
+		t.Errorf("UnwrapKeyBlock() error = %v, want ErrPolicyViolation wrapping errDenied", err)
+	}
+	if len(ops) != 2 || ops[0] != PolicyWrap || ops[1] != PolicyUnwrap {
+		t.Errorf("validator operations = %v, want [wrap unwrap]", ops)
+	}
+}
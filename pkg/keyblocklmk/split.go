@@ -0,0 +1,84 @@
+package keyblocklmk
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// KeyBlockDelimiter terminates a key block inside a command message when the block header
+// carries no block length.
+const KeyBlockDelimiter = ';'
+
+// headerSize is the length of the clear key block header.
+const headerSize = 16
+
+// ErrKeyBlockFormat is returned for key blocks that cannot be located or parsed.
+var ErrKeyBlockFormat = errors.New("key block format error")
+
+// ParseHeader parses the clear header of a key block that starts with its scheme tag
+// (e.g. "S1..."). The key block is not authenticated.
+func ParseHeader(keyBlock []byte) (*Header, error) {
+	if len(keyBlock) < 1+headerSize {
+		return nil, lengthError("header", 0, 1+headerSize, len(keyBlock))
+	}
+
+	return parseHeader(keyBlock[1:1+headerSize], 1)
+}
+
+// parseHeader validates the numeric fields of a 16-byte header found at offset and parses
+// it.
+func parseHeader(data []byte, offset int) (*Header, error) {
+	if err := checkDigits("block length", offset+1, data[1:5]); err != nil {
+		return nil, err
+	}
+	if err := checkDigits("optional block count", offset+12, data[12:14]); err != nil {
+		return nil, err
+	}
+	if err := checkDigits("key context", offset+14, data[14:16]); err != nil {
+		return nil, err
+	}
+	if isTR31Version(data[0]) && data[14] > '0'+KeyContextExchange {
+		return nil, parseError("key context", offset+14, "0, 1 or 2", string(data[14]))
+	}
+
+	var header Header
+	if err := header.fromBytes(data); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrKeyBlockFormat, err)
+	}
+
+	return &header, nil
+}
+
+// SplitKeyBlock separates a key block at the start of data, including its scheme tag, from
+// the bytes that follow it. The length is taken from the block length field of the header;
+// when that field is zero, as in blocks wrapped without StrictCompat, the key block must be
+// terminated by KeyBlockDelimiter, which is consumed.
+func SplitKeyBlock(data []byte) ([]byte, []byte, error) {
+	if len(data) < 1+headerSize {
+		return nil, nil, lengthError("header", 0, 1+headerSize, len(data))
+	}
+
+	if err := checkDigits("block length", 2, data[2:6]); err != nil {
+		return nil, nil, err
+	}
+	blockLen, _ := strconv.Atoi(string(data[2:6]))
+
+	if blockLen == 0 {
+		end := bytes.IndexByte(data, KeyBlockDelimiter)
+		if end < 0 {
+			return nil, nil, parseError("delimiter", len(data),
+				fmt.Sprintf("%q after a key block without length", KeyBlockDelimiter), "end of data")
+		}
+
+		return data[:end], data[end+1:], nil
+	}
+
+	if blockLen < headerSize || 1+blockLen > len(data) {
+		return nil, nil, parseError("block length", 2,
+			fmt.Sprintf("%d to %d", headerSize, len(data)-1), strconv.Itoa(blockLen))
+	}
+
+	return data[:1+blockLen], data[1+blockLen:], nil
+}
@@ -0,0 +1,111 @@
+package keyblocklmk_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+)
+
+// TestSplitKeyBlock verifies locating key blocks inside command messages.
+func TestSplitKeyBlock(t *testing.T) {
+	t.Parallel()
+
+	header := keyblocklmk.Header{
+		Version:       '1',
+		KeyUsage:      "M6",
+		Algorithm:     'A',
+		ModeOfUse:     'C',
+		KeyVersionNum: "00",
+		Exportability: 'N',
+		KeyContext:    1,
+	}
+	key := bytes.Repeat([]byte{0x2B}, 16)
+	lmk := keyblocklmk.DefaultTestAESLMK
+
+	plain, err := keyblocklmk.WrapKeyBlock(lmk, header, nil, key)
+	if err != nil {
+		t.Fatalf("WrapKeyBlock failed: %v", err)
+	}
+	strict, err := keyblocklmk.WrapKeyBlockWithOptions(lmk, header, nil, key,
+		keyblocklmk.WrapOptions{StrictCompat: true})
+	if err != nil {
+		t.Fatalf("WrapKeyBlockWithOptions failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []byte
+		wantErr bool
+	}{
+		{"length from header", append(bytes.Clone(strict), "0010"...), strict, false},
+		{"delimited", append(append(bytes.Clone(plain), ';'), "0010"...), plain, false},
+		{"no delimiter", append(bytes.Clone(plain), "0010"...), nil, true},
+		{"truncated", strict[:len(strict)-2], nil, true},
+		{"too short", []byte("S1"), nil, true},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			block, rest, err := keyblocklmk.SplitKeyBlock(tc.data)
+			if tc.wantErr {
+				if !errors.Is(err, keyblocklmk.ErrKeyBlockFormat) {
+					t.Fatalf("expected ErrKeyBlockFormat, got %v", err)
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("SplitKeyBlock failed: %v", err)
+			}
+			if !bytes.Equal(block, tc.want) || string(rest) != "0010" {
+				t.Errorf("SplitKeyBlock() = %s, %s", block, rest)
+			}
+
+			h, err := keyblocklmk.ParseHeader(block)
+			if err != nil || h.KeyUsage != "M6" || h.Algorithm != 'A' || h.ModeOfUse != 'C' {
+				t.Errorf("ParseHeader() = %+v, %v", h, err)
+			}
+			if _, clear, err := keyblocklmk.UnwrapKeyBlock(lmk, block); err != nil ||
+				!bytes.Equal(clear, key) {
+				t.Errorf("UnwrapKeyBlock() = %X, %v", clear, err)
+			}
+		})
+	}
+}
+
+// TestHeaderMarshalBinary verifies the round trip of the 16-byte header encoding.
+func TestHeaderMarshalBinary(t *testing.T) {
+	t.Parallel()
+
+	header := keyblocklmk.Header{
+		Version:       'D',
+		KeyUsage:      "K0",
+		Algorithm:     'A',
+		ModeOfUse:     'B',
+		KeyVersionNum: "01",
+		Exportability: 'E',
+	}
+	data, err := header.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	if string(data) != "D0000K0AB01E0000" {
+		t.Fatalf("unexpected header %q", data)
+	}
+
+	var parsed keyblocklmk.Header
+	if err := parsed.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+	if parsed != header {
+		t.Fatalf("round trip mismatch: got %+v, want %+v", parsed, header)
+	}
+	if err := parsed.UnmarshalBinary(data[:15]); !errors.Is(err, keyblocklmk.ErrKeyBlockFormat) {
+		t.Fatalf("expected ErrKeyBlockFormat for a short header, got %v", err)
+	}
+}
@@ -0,0 +1,378 @@
+package keyblocklmk
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/des"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+)
+
+// TR-31 key block version IDs.
+const (
+	// TR31VersionA uses key variant binding. It is deprecated in favour of version C, which
+	// computes the same block.
+	TR31VersionA byte = 'A'
+	// TR31VersionB uses TDES CMAC key derivation binding.
+	TR31VersionB byte = 'B'
+	// TR31VersionC uses key variant binding.
+	TR31VersionC byte = 'C'
+	// TR31VersionD uses AES CMAC key derivation binding under an AES key block protection
+	// key. Version D blocks are carried in Thales 'S' format.
+	TR31VersionD byte = 'D'
+)
+
+// TR31SchemeTag is the scheme tag prefixed to TR-31 key blocks in host messages.
+const TR31SchemeTag = 'R'
+
+// optionalBlockPadding is the TR-31 padding optional block that aligns the optional
+// blocks to the cipher block size.
+const optionalBlockPadding = "PB"
+
+// Variant binding masks applied to every byte of the KBPK.
+const (
+	tr31EncryptionVariant = 0x45
+	tr31MACVariant        = 0x4D
+)
+
+// ErrTR31KBPK is returned when the key block protection key does not suit a TR-31 version.
+var ErrTR31KBPK = errors.New("invalid TR-31 key block protection key")
+
+// isTR31TDESVersion reports whether version is a TR-31 version protected by a TDES KBPK.
+func isTR31TDESVersion(version byte) bool {
+	return version == TR31VersionA || version == TR31VersionB || version == TR31VersionC
+}
+
+// tr31MACLength returns the MAC length in bytes of a TDES TR-31 version.
+func tr31MACLength(version byte) int {
+	if version == TR31VersionB {
+		return des.BlockSize
+	}
+
+	return des.BlockSize / 2
+}
+
+// deriveTR31Keys returns the encryption and MAC keys of a TDES TR-31 block: KBPK variants
+// for versions A and C, and TDES CMAC derived keys for version B.
+func deriveTR31Keys(version byte, kbpk []byte) ([]byte, []byte, error) {
+	if len(kbpk) != 16 && len(kbpk) != 24 {
+		return nil, nil, fmt.Errorf("%w: TDES key of %d bytes", ErrTR31KBPK, len(kbpk))
+	}
+
+	if version != TR31VersionB {
+		kbek := make([]byte, len(kbpk))
+		kbak := make([]byte, len(kbpk))
+		for i, b := range kbpk {
+			kbek[i] = b ^ tr31EncryptionVariant
+			kbak[i] = b ^ tr31MACVariant
+		}
+
+		return kbek, kbak, nil
+	}
+
+	block, err := cryptoprovider.NewTripleDESCipher(cryptoutils.PrepareTripleDESKey(kbpk))
+	if err != nil {
+		return nil, nil, err
+	}
+	// Derivation data: counter, key usage (0000 encryption, 0001 MAC), separator,
+	// algorithm (0000 two-key, 0001 three-key TDES) and key length in bits.
+	algorithm, bits := byte(0x00), byte(0x80)
+	if len(kbpk) == 24 {
+		algorithm, bits = 0x01, 0xC0
+	}
+	derive := func(usage byte) []byte {
+		out := make([]byte, 0, len(kbpk))
+		for counter := byte(1); len(out) < len(kbpk); counter++ {
+			data := []byte{counter, 0x00, usage, 0x00, 0x00, algorithm, 0x00, bits}
+			out = append(out, cryptoprovider.CMAC(block, data)...)
+		}
+
+		return out
+	}
+
+	return derive(0x00), derive(0x01), nil
+}
+
+// marshalTR31OptionalBlocks encodes optional blocks in TR-31 form: a 2-character ID, the
+// block length as 2 hex digits including ID and length, and the data. A padding block is
+// appended when needed so header and optional blocks fill whole cipher blocks of
+// blockSize bytes. It returns the encoding and the number of blocks, padding included.
+func marshalTR31OptionalBlocks(blocks []OptionalBlock, blockSize int) ([]byte, int, error) {
+	var out []byte
+	for _, b := range blocks {
+		if len(b.Tag) != 2 || 4+len(b.Value) > 0xFF {
+			return nil, 0, fmt.Errorf("invalid optional block %q", b.Tag)
+		}
+		out = fmt.Appendf(out, "%s%02X", b.Tag, 4+len(b.Value))
+		out = append(out, b.Value...)
+	}
+	count := len(blocks)
+	if count > 0 && (headerSize+len(out))%blockSize != 0 {
+		pad := (blockSize - (headerSize+len(out)+4)%blockSize) % blockSize
+		out = fmt.Appendf(out, "%s%02X", optionalBlockPadding, 4+pad)
+		out = append(out, bytes.Repeat([]byte{'0'}, pad)...)
+		count++
+	}
+	if count > 99 {
+		return nil, 0, errors.New("too many optional blocks")
+	}
+
+	return out, count, nil
+}
+
+// parseTR31OptionalBlocks parses count TR-31 optional blocks at the start of data, found
+// at offset within the key block. The padding block is dropped. It returns the blocks and
+// the length of their encoding.
+func parseTR31OptionalBlocks(data []byte, count, offset int) ([]OptionalBlock, int, error) {
+	blocks := make([]OptionalBlock, 0, count)
+	pos := 0
+	for i := range count {
+		field := fmt.Sprintf("optional block %d", i+1)
+		if pos+4 > len(data) {
+			return nil, 0, lengthError(field, offset+pos, 4, len(data)-pos)
+		}
+		if err := checkHexDigits(field+" length", offset+pos+2, data[pos+2:pos+4]); err != nil {
+			return nil, 0, err
+		}
+		length, _ := strconv.ParseUint(string(data[pos+2:pos+4]), 16, 8)
+		if length < 4 || pos+int(length) > len(data) {
+			return nil, 0, parseError(field+" length", offset+pos+2,
+				fmt.Sprintf("4 to %d", len(data)-pos), strconv.Itoa(int(length)))
+		}
+		ob := OptionalBlock{
+			Tag:   string(data[pos : pos+2]),
+			Value: bytes.Clone(data[pos+4 : pos+int(length)]),
+		}
+		if ob.Tag != optionalBlockPadding {
+			blocks = append(blocks, ob)
+		}
+		pos += int(length)
+	}
+
+	return blocks, pos, nil
+}
+
+// wrapTR31TDES encrypts key under the TDES KBPK in TR-31 version A, B or C, as given by
+// header.Version, and appends the block with its 'R' scheme tag to dst. The header carries
+// the real block length.
+func wrapTR31TDES(
+	dst []byte,
+	p LMKProvider,
+	header Header,
+	optBlocks []OptionalBlock,
+	key []byte,
+	random io.Reader,
+) ([]byte, error) {
+	kbek, kbak, err := p.WrappingKeys(header.Version)
+	if err != nil {
+		return dst, err
+	}
+	defer cryptoutils.Zeroize(kbek, kbak)
+	opt, count, err := marshalTR31OptionalBlocks(optBlocks, des.BlockSize)
+	if err != nil {
+		return dst, err
+	}
+	header.OptionalBlocks = byte(count)
+
+	// Clear key data: 2-byte key length in bits, key, random padding to the block size.
+	keyBits := len(key) * 8
+	// The buffer has room for the padding, so the clear key data stays in one buffer.
+	plain := make([]byte, 0, 2+len(key)+des.BlockSize)
+	defer cryptoutils.Zeroize(plain[:cap(plain)])
+	plain = append(plain, byte(keyBits>>8), byte(keyBits))
+	plain = append(plain, key...)
+	if pad := (des.BlockSize - len(plain)%des.BlockSize) % des.BlockSize; pad > 0 {
+		padding := make([]byte, pad)
+		if _, err := io.ReadFull(random, padding); err != nil {
+			return dst, fmt.Errorf("random pad generation failed: %v", err)
+		}
+		plain = append(plain, padding...)
+	}
+
+	macLen := tr31MACLength(header.Version)
+	blockLen := headerSize + len(opt) + 2*len(plain) + 2*macLen
+	if blockLen > 9999 {
+		return dst, errors.New("key block too long")
+	}
+	headerBytes, err := header.toBytes()
+	if err != nil {
+		return dst, err
+	}
+	copy(headerBytes[1:5], fmt.Sprintf("%04d", blockLen))
+	authenticated := slices.Concat(headerBytes, opt)
+
+	kbekBlock, err := cryptoprovider.NewTripleDESCipher(cryptoutils.PrepareTripleDESKey(kbek))
+	if err != nil {
+		return dst, err
+	}
+	kbakBlock, err := cryptoprovider.NewTripleDESCipher(cryptoutils.PrepareTripleDESKey(kbak))
+	if err != nil {
+		return dst, err
+	}
+
+	encrypted := make([]byte, len(plain))
+	var mac []byte
+	if header.Version == TR31VersionB {
+		// The CMAC over header and clear key data is the IV of the key data encryption.
+		mac = cryptoprovider.CMAC(kbakBlock, slices.Concat(authenticated, plain))
+		cipher.NewCBCEncrypter(kbekBlock, mac).CryptBlocks(encrypted, plain)
+	} else {
+		// The key data is encrypted with the first 8 header bytes as IV and authenticated
+		// with a CBC-MAC over header and encrypted key data.
+		cipher.NewCBCEncrypter(kbekBlock, headerBytes[:des.BlockSize]).CryptBlocks(encrypted, plain)
+		mac = cbcMAC(kbakBlock, slices.Concat(authenticated, encrypted))[:macLen]
+	}
+
+	dst = slices.Grow(dst, 1+blockLen)
+	dst = append(dst, TR31SchemeTag)
+	dst = append(dst, authenticated...)
+	dst = appendUpperHex(dst, encrypted)
+
+	return appendUpperHex(dst, mac), nil
+}
+
+// unwrapTR31TDES authenticates and decrypts a TR-31 version A, B or C block. block follows
+// the scheme tag and header is its parsed header.
+func unwrapTR31TDES(
+	p LMKProvider,
+	block []byte,
+	header *Header,
+) (*Header, []OptionalBlock, []byte, error) {
+	parts, err := splitTR31Block(block, header, des.BlockSize, tr31MACLength(header.Version))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	kbek, kbak, err := p.WrappingKeys(header.Version)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer cryptoutils.Zeroize(kbek, kbak)
+	kbekBlock, err := cryptoprovider.NewTripleDESCipher(cryptoutils.PrepareTripleDESKey(kbek))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	kbakBlock, err := cryptoprovider.NewTripleDESCipher(cryptoutils.PrepareTripleDESKey(kbak))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	authenticated, encrypted, mac := parts.authenticated, parts.encrypted, parts.mac
+	plain := make([]byte, len(encrypted))
+	defer cryptoutils.Zeroize(plain)
+
+	var calcMAC []byte
+	if header.Version == TR31VersionB {
+		cipher.NewCBCDecrypter(kbekBlock, mac).CryptBlocks(plain, encrypted)
+		calcMAC = cryptoprovider.CMAC(kbakBlock, slices.Concat(authenticated, plain))
+	} else {
+		calcMAC = cbcMAC(kbakBlock, slices.Concat(authenticated, encrypted))[:len(mac)]
+		cipher.NewCBCDecrypter(kbekBlock, block[:des.BlockSize]).CryptBlocks(plain, encrypted)
+	}
+	if !cryptoutils.ConstantTimeEqual(calcMAC, mac) {
+		return nil, nil, nil, errors.New("mac verification failed")
+	}
+
+	key, err := tr31ClearKey(header, plain, parts.offset)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return header, parts.optBlocks, key, nil
+}
+
+// tr31Parts are the fields of a TR-31 style key block.
+type tr31Parts struct {
+	optBlocks     []OptionalBlock
+	authenticated []byte // header and optional blocks
+	encrypted     []byte
+	mac           []byte
+	offset        int // offset of the key data relative to the scheme tag
+}
+
+// splitTR31Block validates the layout of a TR-31 style key block following its scheme tag:
+// the block length, the optional blocks filling whole cipher blocks of blockSize bytes
+// with the header, the hex key data and a MAC of macLen bytes.
+func splitTR31Block(block []byte, header *Header, blockSize, macLen int) (*tr31Parts, error) {
+	// Offsets are reported relative to the scheme tag.
+	const base = 1
+
+	if err := checkDigits("block length", base+1, block[1:5]); err != nil {
+		return nil, err
+	}
+	if blockLen, _ := strconv.Atoi(string(block[1:5])); blockLen != len(block) {
+		return nil, parseError("block length", base+1,
+			strconv.Itoa(len(block)), strconv.Itoa(blockLen))
+	}
+
+	optBlocks, optLen, err := parseTR31OptionalBlocks(block[headerSize:],
+		int(header.OptionalBlocks), base+headerSize)
+	if err != nil {
+		return nil, err
+	}
+
+	offset := headerSize + optLen
+	if offset%blockSize != 0 {
+		return nil, parseError("optional blocks", base+headerSize,
+			fmt.Sprintf("a multiple of %d bytes with the header", blockSize), strconv.Itoa(offset))
+	}
+	macHexLen := 2 * macLen
+	if len(block) < offset+macHexLen {
+		return nil, lengthError("MAC", base+offset, macHexLen, len(block)-offset)
+	}
+	cipherText := block[offset : len(block)-macHexLen]
+	recvMAC := block[len(block)-macHexLen:]
+	if err := checkHexDigits("key data", base+offset, cipherText); err != nil {
+		return nil, err
+	}
+	if len(cipherText) == 0 || len(cipherText)%(2*blockSize) != 0 {
+		return nil, parseError("key data", base+offset,
+			fmt.Sprintf("a multiple of %d hex digits", 2*blockSize), strconv.Itoa(len(cipherText)))
+	}
+	if err := checkHexDigits("MAC", base+len(block)-macHexLen, recvMAC); err != nil {
+		return nil, err
+	}
+
+	encrypted, _ := hex.DecodeString(string(cipherText))
+	mac, _ := hex.DecodeString(string(recvMAC))
+
+	return &tr31Parts{
+		optBlocks:     optBlocks,
+		authenticated: block[:offset],
+		encrypted:     encrypted,
+		mac:           mac,
+		offset:        base + offset,
+	}, nil
+}
+
+// tr31ClearKey returns the key from decrypted key data: a 2-byte key length in bits, the
+// key and padding. offset locates the key data for errors.
+func tr31ClearKey(header *Header, plain []byte, offset int) ([]byte, error) {
+	keyBits := int(plain[0])<<8 | int(plain[1])
+	expectedBytes := (keyBits + 7) / 8
+	if isDESAlgorithm(header.Algorithm) && keyBits%56 == 0 {
+		expectedBytes = keyBits / 7
+	}
+	if expectedBytes == 0 || expectedBytes > len(plain)-2 {
+		return nil, parseError("key length", offset,
+			fmt.Sprintf("1 to %d bits", 8*(len(plain)-2)), fmt.Sprintf("%d bits", keyBits))
+	}
+
+	return bytes.Clone(plain[2 : 2+expectedBytes]), nil
+}
+
+// cbcMAC returns the ISO/IEC 9797-1 MAC algorithm 1 of data, a multiple of the block size,
+// under block with a zero IV.
+func cbcMAC(block cipher.Block, data []byte) []byte {
+	out := make([]byte, len(data))
+	cipher.NewCBCEncrypter(block, make([]byte, block.BlockSize())).CryptBlocks(out, data)
+
+	return out[len(out)-block.BlockSize():]
+}
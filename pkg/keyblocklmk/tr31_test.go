@@ -0,0 +1,244 @@
+package keyblocklmk
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/des"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+)
+
+func TestTR31TDESRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	kbpk16, _ := hex.DecodeString("89E88CF7931444F334BD7547FC3F380C")
+	kbpk24, _ := hex.DecodeString("89E88CF7931444F334BD7547FC3F380C0123456789ABCDEF")
+	key, _ := hex.DecodeString("F039121BEC83D26B169BDCD5B22AAF8F")
+	ksn := OptionalBlock{Tag: "KS", Value: []byte("00604B120F9292800000")}
+
+	for _, version := range []byte{TR31VersionA, TR31VersionB, TR31VersionC} {
+		for _, kbpk := range [][]byte{kbpk16, kbpk24} {
+			for _, opt := range [][]OptionalBlock{nil, {ksn}} {
+				name := fmt.Sprintf("%c/%d/%d", version, len(kbpk), len(opt))
+				t.Run(name, func(t *testing.T) {
+					t.Parallel()
+
+					header := Header{
+						Version:       version,
+						KeyUsage:      "B0",
+						Algorithm:     'T',
+						ModeOfUse:     'X',
+						KeyVersionNum: "12",
+						Exportability: 'S',
+					}
+					block, err := WrapKeyBlock(kbpk, header, opt, key)
+					if err != nil {
+						t.Fatalf("WrapKeyBlock() error = %v", err)
+					}
+					if block[0] != TR31SchemeTag || block[1] != version {
+						t.Fatalf("block starts with %q", block[:2])
+					}
+					if got := string(block[2:6]); got != fmt.Sprintf("%04d", len(block)-1) {
+						t.Errorf("block length field = %s, want %d", got, len(block)-1)
+					}
+
+					got, blocks, clear, err := UnwrapKeyBlockWithOptionalBlocks(kbpk, block)
+					if err != nil {
+						t.Fatalf("UnwrapKeyBlock() error = %v", err)
+					}
+					if !bytes.Equal(clear, key) {
+						t.Errorf("clear key = %X, want %X", clear, key)
+					}
+					if got.Version != version || got.KeyUsage != "B0" || got.ModeOfUse != 'X' {
+						t.Errorf("header = %+v", got)
+					}
+					if len(blocks) != len(opt) ||
+						(len(opt) > 0 && !bytes.Equal(blocks[0].Value, ksn.Value)) {
+						t.Errorf("optional blocks = %+v, want %+v", blocks, opt)
+					}
+				})
+			}
+		}
+	}
+}
+
+// TestTR31KnownAnswers unwraps the TR-31 Annex A example blocks to their published clear
+// keys and wraps the keys again with the published random pads to the same blocks.
+func TestTR31KnownAnswers(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		kbpk  string
+		key   string
+		pad   string
+		block string
+	}{
+		{
+			name:  "A.7.2 version A",
+			kbpk:  "89E88CF7931444F334BD7547FC3F380C",
+			key:   "F039121BEC83D26B169BDCD5B22AAF8F",
+			pad:   "720DF563BB07",
+			block: "A0072P0TE00E0000F5161ED902807AF26F1D62263644BD24192FDB3193C730301CEE8701",
+		},
+		{
+			name:  "A.7.3 version B",
+			kbpk:  "DD7515F2BFC17F85CE48F3CA25CB21F6",
+			key:   "3F419E1CB7079442AA37474C2EFBF8B8",
+			pad:   "1C2965473CE2",
+			block: "B0080P0TE00E000094B420079CC80BA3461F86FE26EFC4A3B8E4FA4C5F5341176EED7B727B8A248E",
+		},
+		{
+			name: "A.7.4 version C",
+			kbpk: "B8ED59E0A279A295E9F5ED7944FD06B9",
+			key:  "EDB380DD340BC2620247D445F5B8D678",
+			pad:  "8546A8ED98D1",
+			block: "C0096B0TX12S0100KS1800604B120F9292800000" +
+				"BFB9B689CB567E66FC3FEE5AD5F52161FC6545B9D60989015D02155C",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			kbpk, _ := hex.DecodeString(tc.kbpk)
+			key, _ := hex.DecodeString(tc.key)
+			pad, _ := hex.DecodeString(tc.pad)
+			block := append([]byte{TR31SchemeTag}, tc.block...)
+
+			header, blocks, clear, err := UnwrapKeyBlockWithOptionalBlocks(kbpk, block)
+			if err != nil {
+				t.Fatalf("UnwrapKeyBlock() error = %v", err)
+			}
+			if !bytes.Equal(clear, key) {
+				t.Errorf("clear key = %X, want %X", clear, key)
+			}
+
+			got, err := WrapKeyBlockWithOptions(kbpk, *header, blocks, key,
+				WrapOptions{Rand: bytes.NewReader(pad)})
+			if err != nil {
+				t.Fatalf("WrapKeyBlock() error = %v", err)
+			}
+			if !bytes.Equal(got, block) {
+				t.Errorf("WrapKeyBlock() = %s, want %s", got, block)
+			}
+		})
+	}
+}
+
+func TestTR31OptionalBlockPadding(t *testing.T) {
+	t.Parallel()
+
+	kbpk, _ := hex.DecodeString("89E88CF7931444F334BD7547FC3F380C")
+	key, _ := hex.DecodeString("F039121BEC83D26B169BDCD5B22AAF8F")
+	header := Header{
+		Version: TR31VersionC, KeyUsage: "B0", Algorithm: 'T', ModeOfUse: 'X',
+		KeyVersionNum: "12", Exportability: 'S',
+	}
+	tests := []struct {
+		value string
+		want  string
+	}{
+		// The KS block fills header and optional blocks to 40 bytes; no padding is needed.
+		{"00604B120F9292800000", "C0096B0TX12S0100KS1800604B120F9292800000"},
+		// A 7-byte block is followed by a 9-byte PB block, filling them to 32 bytes.
+		{"ABC", "C0088B0TX12S0200KS07ABCPB0900000"},
+	}
+	for _, tc := range tests {
+		opt := []OptionalBlock{{Tag: "KS", Value: []byte(tc.value)}}
+		block, err := WrapKeyBlock(kbpk, header, opt, key)
+		if err != nil {
+			t.Fatalf("WrapKeyBlock() error = %v", err)
+		}
+		if got := string(block[1 : 1+len(tc.want)]); got != tc.want {
+			t.Errorf("header and optional blocks = %q, want %q", got, tc.want)
+		}
+		_, blocks, _, err := UnwrapKeyBlockWithOptionalBlocks(kbpk, block)
+		if err != nil || len(blocks) != 1 || string(blocks[0].Value) != tc.value {
+			t.Errorf("UnwrapKeyBlock() optional blocks = %+v, %v", blocks, err)
+		}
+	}
+}
+
+func TestTR31VariantBinding(t *testing.T) {
+	t.Parallel()
+
+	kbpk, _ := hex.DecodeString("89E88CF7931444F334BD7547FC3F380C")
+	key, _ := hex.DecodeString("F039121BEC83D26B169BDCD5B22AAF8F")
+	header := Header{
+		Version: TR31VersionC, KeyUsage: "P0", Algorithm: 'T', ModeOfUse: 'E',
+		KeyVersionNum: "00", Exportability: 'E',
+	}
+	block, err := WrapKeyBlock(kbpk, header, nil, key)
+	if err != nil {
+		t.Fatalf("WrapKeyBlock() error = %v", err)
+	}
+
+	// Decrypt independently: TDES CBC under KBPK XOR 0x45 with the first 8 header bytes as
+	// IV, and a 4-byte CBC-MAC under KBPK XOR 0x4D over header and encrypted key data.
+	variant := func(mask byte) cipher.Block {
+		k := bytes.Clone(kbpk)
+		for i := range k {
+			k[i] ^= mask
+		}
+		c, _ := des.NewTripleDESCipher(cryptoutils.PrepareTripleDESKey(k))
+
+		return c
+	}
+	encrypted, _ := hex.DecodeString(string(block[17 : len(block)-8]))
+	plain := make([]byte, len(encrypted))
+	cipher.NewCBCDecrypter(variant(0x45), block[1:9]).CryptBlocks(plain, encrypted)
+	if bits := int(plain[0])<<8 | int(plain[1]); bits != 128 || !bytes.Equal(plain[2:18], key) {
+		t.Errorf("decrypted key data = %X", plain)
+	}
+
+	macData := append(bytes.Clone(block[1:17]), encrypted...)
+	chain := make([]byte, len(macData))
+	cipher.NewCBCEncrypter(variant(0x4D), make([]byte, 8)).CryptBlocks(chain, macData)
+	want := fmt.Sprintf("%X", chain[len(chain)-8:len(chain)-4])
+	if got := string(block[len(block)-8:]); got != want {
+		t.Errorf("MAC = %s, want %s", got, want)
+	}
+}
+
+func TestTR31Errors(t *testing.T) {
+	t.Parallel()
+
+	kbpk, _ := hex.DecodeString("89E88CF7931444F334BD7547FC3F380C")
+	other, _ := hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+	key, _ := hex.DecodeString("F039121BEC83D26B169BDCD5B22AAF8F")
+	header := Header{
+		Version: TR31VersionB, KeyUsage: "D0", Algorithm: 'T', ModeOfUse: 'B',
+		KeyVersionNum: "00", Exportability: 'N',
+	}
+
+	if _, err := WrapKeyBlock(getTestLMK(), header, nil, key); !errors.Is(err, ErrTR31KBPK) {
+		t.Errorf("WrapKeyBlock() with an AES LMK error = %v, want ErrTR31KBPK", err)
+	}
+
+	block, err := WrapKeyBlock(kbpk, header, nil, key)
+	if err != nil {
+		t.Fatalf("WrapKeyBlock() error = %v", err)
+	}
+	if _, _, err := UnwrapKeyBlock(other, block); err == nil {
+		t.Error("UnwrapKeyBlock() under another KBPK succeeded")
+	}
+
+	tampered := bytes.Clone(block)
+	tampered[len(tampered)-1] ^= 0x01
+	if _, _, err := UnwrapKeyBlock(kbpk, tampered); err == nil {
+		t.Error("UnwrapKeyBlock() of a tampered block succeeded")
+	}
+
+	short := bytes.Clone(block)
+	copy(short[2:6], fmt.Sprintf("%04d", len(block)))
+	var perr *ParseError
+	_, _, err = UnwrapKeyBlock(kbpk, short)
+	if !errors.As(err, &perr) || perr.Field != "block length" {
+		t.Errorf("UnwrapKeyBlock() with a wrong length error = %v, want block length error", err)
+	}
+}
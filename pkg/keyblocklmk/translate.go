@@ -0,0 +1,77 @@
+package keyblocklmk
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotExportable is returned when a translation would move a non-exportable key out of
+// its key block format.
+var ErrNotExportable = errors.New("key is not exportable")
+
+// TranslateOptions selects the target of a key block translation.
+type TranslateOptions struct {
+	// Version is the header version of the new block: '1' for a Thales 'S' block under an
+	// AES LMK, TR31VersionA, TR31VersionB or TR31VersionC for an 'R' block under a TDES
+	// LMK, or ISO20038VersionE for an 'R' block under an AES KBPK. Zero keeps the version
+	// of the source block.
+	Version byte
+	// LMKID is the LMK identifier written to 'S' blocks. 'R' blocks carry the key context
+	// of the source block instead, or KeyContextAny when translated from an 'S' block.
+	LMKID byte
+	// Wrap controls the wrapping of the new block.
+	Wrap WrapOptions
+}
+
+// TranslateKeyBlock unwraps a key block under fromLMK and rewraps its key under toLMK in a
+// single call, so keys can be migrated between LMKs without the clear key leaving the
+// package. See WrapKeyBlockFromBlock.
+func TranslateKeyBlock(fromLMK, block, toLMK []byte, opts TranslateOptions) ([]byte, error) {
+	return WrapKeyBlockFromBlock(nil, fromLMK, block, toLMK, opts)
+}
+
+// WrapKeyBlockFromBlock translates a key block like TranslateKeyBlock and appends the new
+// block to dst. The key usage, algorithm, mode of use, key version, exportability and
+// optional blocks are kept. A key moves between LMKs of one format regardless of its
+// exportability, but a change between the 'S' and 'R' formats exports it and requires
+// exportability E or S; non-exportable keys fail with ErrNotExportable. The TR-31 key
+// context of an 'R' source block is enforced with ErrKeyContext: exchange only keys are
+// not imported into 'S' blocks, and storage only keys are not wrapped in 'R' blocks. On
+// error dst is returned unchanged.
+func WrapKeyBlockFromBlock(
+	dst, fromLMK, block, toLMK []byte,
+	opts TranslateOptions,
+) ([]byte, error) {
+	header, optBlocks, key, err := unwrapKeyBlockInternal(StaticLMK(fromLMK), block)
+	if err != nil {
+		return dst, err
+	}
+	defer clear(key)
+
+	target := *header
+	if opts.Version != 0 {
+		target.Version = opts.Version
+	}
+	if isTR31Version(header.Version) != isTR31Version(target.Version) &&
+		header.Exportability != 'E' && header.Exportability != 'S' {
+		return dst, fmt.Errorf("%w: exportability %q does not allow translation from %c to %c blocks",
+			ErrNotExportable, header.Exportability, header.Version, target.Version)
+	}
+	if isTR31Version(target.Version) {
+		if err := header.CheckExchange(); err != nil {
+			return dst, err
+		}
+		if !isTR31Version(header.Version) {
+			target.KeyContext = KeyContextAny
+		}
+	} else {
+		if err := header.CheckStorage(); err != nil {
+			return dst, err
+		}
+		target.KeyContext = opts.LMKID
+	}
+	// TR-31 padding blocks are dropped on unwrap and added again as needed on wrap.
+	target.OptionalBlocks = byte(len(optBlocks))
+
+	return WrapKeyBlockAppend(dst, toLMK, target, optBlocks, key, opts.Wrap)
+}
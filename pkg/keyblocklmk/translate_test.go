@@ -0,0 +1,111 @@
+package keyblocklmk
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestTranslateKeyBlock(t *testing.T) {
+	t.Parallel()
+
+	aesLMK := getTestLMK()
+	otherLMK := bytes.Repeat([]byte{0x3C}, 32)
+	tdesLMK, _ := hex.DecodeString("89E88CF7931444F334BD7547FC3F380C")
+	key := bytes.Repeat([]byte{0x5A}, 16)
+	opt := []OptionalBlock{{Tag: "KS", Value: []byte("00604B120F9292800000")}}
+	header := Header{
+		Version:        '1',
+		KeyUsage:       "B0",
+		Algorithm:      'T',
+		ModeOfUse:      'X',
+		KeyVersionNum:  "12",
+		Exportability:  'E',
+		OptionalBlocks: 1,
+	}
+	block, err := WrapKeyBlock(aesLMK, header, opt, key)
+	if err != nil {
+		t.Fatalf("WrapKeyBlock() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		lmk    []byte
+		opts   TranslateOptions
+		prefix string
+	}{
+		{"S to S under another LMK", otherLMK, TranslateOptions{LMKID: 2}, "S1"},
+		{"S to R version B", tdesLMK, TranslateOptions{Version: TR31VersionB}, "RB"},
+		{"S to R version C", tdesLMK, TranslateOptions{Version: TR31VersionC}, "RC"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			out, err := TranslateKeyBlock(aesLMK, block, tc.lmk, tc.opts)
+			if err != nil {
+				t.Fatalf("TranslateKeyBlock() error = %v", err)
+			}
+			if string(out[:2]) != tc.prefix {
+				t.Errorf("translated block starts with %q, want %q", out[:2], tc.prefix)
+			}
+			got, blocks, clear, err := UnwrapKeyBlockWithOptionalBlocks(tc.lmk, out)
+			if err != nil {
+				t.Fatalf("UnwrapKeyBlock() error = %v", err)
+			}
+			if !bytes.Equal(clear, key) {
+				t.Errorf("clear key = %X, want %X", clear, key)
+			}
+			if got.KeyUsage != "B0" || got.ModeOfUse != 'X' || got.KeyVersionNum != "12" ||
+				got.Exportability != 'E' || got.KeyContext != tc.opts.LMKID {
+				t.Errorf("header = %+v", got)
+			}
+			if len(blocks) != 1 || !bytes.Equal(blocks[0].Value, opt[0].Value) {
+				t.Errorf("optional blocks = %+v", blocks)
+			}
+
+			// Translating back restores an 'S' block under the original LMK.
+			back, err := TranslateKeyBlock(tc.lmk, out, aesLMK, TranslateOptions{Version: '1'})
+			if err != nil {
+				t.Fatalf("TranslateKeyBlock() back error = %v", err)
+			}
+			if _, clear, err := UnwrapKeyBlock(aesLMK, back); err != nil || !bytes.Equal(clear, key) {
+				t.Errorf("UnwrapKeyBlock() back = %X, %v", clear, err)
+			}
+		})
+	}
+}
+
+func TestTranslateKeyBlockExportability(t *testing.T) {
+	t.Parallel()
+
+	aesLMK := getTestLMK()
+	tdesLMK, _ := hex.DecodeString("89E88CF7931444F334BD7547FC3F380C")
+	header := Header{
+		Version:       '1',
+		KeyUsage:      "P0",
+		Algorithm:     'T',
+		ModeOfUse:     'B',
+		KeyVersionNum: "00",
+		Exportability: 'N',
+	}
+	block, err := WrapKeyBlock(aesLMK, header, nil, bytes.Repeat([]byte{0x11}, 16))
+	if err != nil {
+		t.Fatalf("WrapKeyBlock() error = %v", err)
+	}
+
+	dst := []byte("prefix")
+	out, err := WrapKeyBlockFromBlock(dst, aesLMK, block, tdesLMK, TranslateOptions{Version: TR31VersionB})
+	if !errors.Is(err, ErrNotExportable) || string(out) != "prefix" {
+		t.Errorf("WrapKeyBlockFromBlock() = %q, %v, want dst unchanged and ErrNotExportable", out, err)
+	}
+
+	// Migration to another LMK of the same format is allowed.
+	if _, err := TranslateKeyBlock(aesLMK, block, bytes.Repeat([]byte{0x3C}, 32), TranslateOptions{}); err != nil {
+		t.Errorf("TranslateKeyBlock() to another AES LMK error = %v", err)
+	}
+	if _, err := TranslateKeyBlock(tdesLMK, block, aesLMK, TranslateOptions{}); err == nil {
+		t.Error("TranslateKeyBlock() under the wrong source LMK succeeded")
+	}
+}
@@ -7,6 +7,9 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
 )
 
 // UnwrapDiagnostics contains diagnostic information from key block unwrapping.
@@ -16,127 +19,190 @@ type UnwrapDiagnostics struct {
 }
 
 // UnwrapKeyBlock decrypts a key block using the LMK and returns the Header and clear key.
+// TR-31 blocks of version A, B or C are authenticated and decrypted under a TDES LMK. Keys
+// rejected by the PolicyValidator installed with SetPolicyValidator fail with
+// ErrPolicyViolation.
 func UnwrapKeyBlock(lmk, keyBlock []byte) (*Header, []byte, error) {
-	header, clearKey, err := unwrapKeyBlockInternal(lmk, keyBlock)
+	header, _, clearKey, err := unwrapKeyBlockInternal(StaticLMK(lmk), keyBlock)
 
 	return header, clearKey, err
 }
 
-// unwrapKeyBlockInternal decrypts a key block using the LMK and returns the Header and clear key.
-func unwrapKeyBlockInternal(lmk, keyBlock []byte) (*Header, []byte, error) {
-	// Store first byte as format and keyBlockStr from next byte.
-	if len(keyBlock) == 0 {
-		return nil, nil, errors.New("key block is empty")
+// UnwrapKeyBlockWithOptionalBlocks decrypts a key block using the LMK and returns the
+// Header, the authenticated optional blocks and the clear key.
+func UnwrapKeyBlockWithOptionalBlocks(
+	lmk, keyBlock []byte,
+) (*Header, []OptionalBlock, []byte, error) {
+	return unwrapKeyBlockInternal(StaticLMK(lmk), keyBlock)
+}
+
+// UnwrapKeyBlockWithProvider decrypts a key block with the wrapping keys that p supplies for
+// its version and returns the Header, the authenticated optional blocks and the clear key.
+func UnwrapKeyBlockWithProvider(
+	p LMKProvider,
+	keyBlock []byte,
+) (*Header, []OptionalBlock, []byte, error) {
+	return unwrapKeyBlockInternal(p, keyBlock)
+}
+
+// UnwrapKeyBlockAppend decrypts a key block using the LMK like UnwrapKeyBlock and appends
+// the clear key to dst, so batch callers can reuse one buffer across keys.
+func UnwrapKeyBlockAppend(dst, lmk, keyBlock []byte) (*Header, []byte, error) {
+	header, _, clearKey, err := unwrapKeyBlockInternal(StaticLMK(lmk), keyBlock)
+	if err != nil {
+		return nil, dst, err
+	}
+
+	return header, append(dst, clearKey...), nil
+}
+
+// unwrapKeyBlockInternal decrypts a key block under the LMK of p and returns the Header,
+// optional blocks and clear key, once the installed PolicyValidator accepts them.
+func unwrapKeyBlockInternal(p LMKProvider, keyBlock []byte) (*Header, []OptionalBlock, []byte, error) {
+	header, optBlocks, clearKey, err := decryptKeyBlock(p, keyBlock)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := checkPolicy(PolicyUnwrap, header, optBlocks); err != nil {
+		clear(clearKey)
+
+		return nil, nil, nil, err
 	}
 
-	_ = keyBlock[0]
-	keyBlockStr := string(keyBlock[1:])
+	return header, optBlocks, clearKey, nil
+}
 
-	var (
-		header     Header
-		macInput   []byte
-		cipherText []byte
-		recvMac    []byte
-		macLen     int
-	)
+// decryptKeyBlock decrypts a key block under the LMK of p and returns the Header, optional
+// blocks and clear key. Malformed blocks are reported with a ParseError that gives the
+// offset within keyBlock.
+func decryptKeyBlock(p LMKProvider, keyBlock []byte) (*Header, []OptionalBlock, []byte, error) {
+	if len(keyBlock) == 0 {
+		return nil, nil, nil, lengthError("scheme tag", 0, 1, 0)
+	}
 
-	// Input should always be binary.
-	binaryKeyBlock := []byte(keyBlockStr)
+	// The key block follows the scheme tag; offsets below are within the block and
+	// reported relative to the tag.
+	const base = 1
+	block := keyBlock[base:]
 
 	// Minimum length: 16-byte header + 8-byte MAC.
-	if len(binaryKeyBlock) < 16+8 {
-		return nil, nil, errors.New("key block too short")
+	if len(block) < headerSize+8 {
+		return nil, nil, nil, lengthError("header", base, headerSize+8, len(block))
 	}
 
-	if err := header.fromBytes(binaryKeyBlock[:16]); err != nil {
-		return nil, nil, fmt.Errorf("invalid header: %v", err)
+	header, err := parseHeader(block[:headerSize], base)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if isTR31TDESVersion(header.Version) {
+		return unwrapTR31TDES(p, block, header)
+	}
+	if header.Version == ISO20038VersionE {
+		return unwrapISO20038(p, block, header)
 	}
 
-	macLen = aes.BlockSize // 16 bytes for CMAC
+	macLen := aes.BlockSize // 16 hex characters of an 8-byte CMAC.
 
 	// Parse optional blocks.
-	offset := 16
+	offset := headerSize
 	optCount := int(header.OptionalBlocks)
+	optBlocks := make([]OptionalBlock, 0, optCount)
 	for i := 0; i < optCount; i++ {
-		if offset+3 > len(binaryKeyBlock) {
-			return nil, nil, errors.New("truncated optional block")
+		field := fmt.Sprintf("optional block %d", i+1)
+		if offset+3 > len(block) {
+			return nil, nil, nil, lengthError(field, base+offset, 3, len(block)-offset)
 		}
-		length := int(binaryKeyBlock[offset+2])
+		length := int(block[offset+2])
 		blockEnd := offset + 3 + length
-		if blockEnd > len(binaryKeyBlock) {
-			return nil, nil, errors.New("optional block length out of range")
+		if blockEnd > len(block) {
+			return nil, nil, nil, parseError(field+" length", base+offset+2,
+				fmt.Sprintf("at most %d", len(block)-offset-3), fmt.Sprintf("%d", length))
 		}
+		optBlocks = append(optBlocks, OptionalBlock{
+			Tag:   string(block[offset : offset+2]),
+			Value: bytes.Clone(block[offset+3 : blockEnd]),
+		})
 		offset = blockEnd
 	}
 
 	// Extract ciphertext and MAC.
-	if len(binaryKeyBlock) < offset+macLen {
-		return nil, nil, errors.New("key block data too short for MAC")
+	if len(block) < offset+macLen {
+		return nil, nil, nil, lengthError("MAC", base+offset, macLen, len(block)-offset)
 	}
 
-	cipherText = binaryKeyBlock[offset : len(binaryKeyBlock)-macLen]
-	recvMac = binaryKeyBlock[len(binaryKeyBlock)-macLen:]
+	cipherText := block[offset : len(block)-macLen]
+	recvMac := block[len(block)-macLen:]
+	if err := checkHexDigits("key data", base+offset, cipherText); err != nil {
+		return nil, nil, nil, err
+	}
+	if len(cipherText)%(2*aes.BlockSize) != 0 {
+		return nil, nil, nil, parseError("key data", base+offset,
+			"a multiple of 32 hex digits", fmt.Sprintf("%d", len(cipherText)))
+	}
+	if err := checkHexDigits("MAC", base+len(block)-macLen, recvMac); err != nil {
+		return nil, nil, nil, err
+	}
 
 	// MAC input is binary representation.
-	macInput = make([]byte, 0, offset+len(cipherText))
-	macInput = append(macInput, binaryKeyBlock[:offset]...)
-	macInput = append(macInput, cipherText...)
+	macInput := block[:offset+len(cipherText)]
 
-	// Derive KBEK and KBAK.
-	kbek, kbak, err := deriveEncryptionAndMACKeys(lmk, len(lmk))
+	kbek, kbak, err := p.WrappingKeys(header.Version)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
+	defer cryptoutils.Zeroize(kbek, kbak)
 
 	// Compute CMAC on the prepared MAC input.
 	calcFull, err := computeAESCMAC(kbak, macInput)
 	if err != nil {
-		return nil, nil, fmt.Errorf("cmac computation failed: %v", err)
+		return nil, nil, nil, fmt.Errorf("cmac computation failed: %v", err)
 	}
 
 	macCalc := calcFull[:macLen/2]
 
-	binRecvMac, err := hex.DecodeString(string(recvMac))
-	if err != nil {
-		return nil, nil, fmt.Errorf("invalid received MAC: %v", err)
-	}
+	binRecvMac, _ := hex.DecodeString(string(recvMac))
 	// Verify MAC.
-	if !bytes.Equal(binRecvMac, macCalc) {
-		return nil, nil, errors.New("mac verification failed")
+	if !cryptoutils.ConstantTimeEqual(binRecvMac, macCalc) {
+		return nil, nil, nil, errors.New("mac verification failed")
 	}
 
 	// Decrypt ciphertext using AES-CBC with IV = header bytes.
 	headerBytes, err := header.toBytes()
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
-	cipherBlockObj, err := aes.NewCipher(kbek)
+	cipherBlockObj, err := cryptoprovider.NewAESCipher(kbek)
 	if err != nil {
-		return nil, nil, fmt.Errorf("aes cipher init failed: %v", err)
-	}
-	binCipherText, err := hex.DecodeString(string(cipherText))
-	if err != nil {
-		return nil, nil, fmt.Errorf("invalid ciphertext hex: %v", err)
+		return nil, nil, nil, fmt.Errorf("aes cipher init failed: %v", err)
 	}
+	binCipherText, _ := hex.DecodeString(string(cipherText))
 
 	cbc := cipher.NewCBCDecrypter(cipherBlockObj, headerBytes)
 	plainPadded := make([]byte, len(binCipherText))
 	cbc.CryptBlocks(plainPadded, binCipherText)
+	defer cryptoutils.Zeroize(plainPadded)
 
 	// Remove length prefix and padding.
 	if len(plainPadded) < 2 {
-		return nil, nil, errors.New("decrypted data too short")
+		return nil, nil, nil, lengthError("key data", base+offset, 2*aes.BlockSize, len(cipherText))
 	}
 
 	keyBits := int(plainPadded[0])<<8 | int(plainPadded[1])
 	expectedBytes := (keyBits + 7) / 8
+	if isDESAlgorithm(header.Algorithm) && keyBits%56 == 0 {
+		// Some devices encode only the effective DES key bits (56, 112 or 168), masking
+		// the parity bit of every byte.
+		expectedBytes = keyBits / 7
+	}
 
 	if expectedBytes > len(plainPadded)-2 {
-		return nil, nil, errors.New("invalid key length in data")
+		// The length is encrypted, so the offset is that of the key data.
+		return nil, nil, nil, parseError("key length", base+offset,
+			fmt.Sprintf("at most %d bits", 8*(len(plainPadded)-2)), fmt.Sprintf("%d bits", keyBits))
 	}
 
-	clearKey := plainPadded[2 : 2+expectedBytes]
+	clearKey := bytes.Clone(plainPadded[2 : 2+expectedBytes])
 
-	return &header, clearKey, nil
+	return header, optBlocks, clearKey, nil
 }
@@ -4,31 +4,137 @@ package keyblocklmk
 import (
 	"crypto/aes"
 	"crypto/cipher"
-	"crypto/rand"
-	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"slices"
-	"strings"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
 )
 
-// WrapKeyBlock encrypts a clear key under the LMK in Thales 'S' key block format.
+// WrapOptions controls payShield compatibility details of WrapKeyBlockWithOptions.
+type WrapOptions struct {
+	// StrictCompat produces blocks byte-compatible with payShield: the header carries the
+	// real key block length, and DES/TDES keys (algorithm 'D' or 'T') must be 8, 16 or 24
+	// bytes long, are stored with odd parity and have their length encoded including
+	// parity bits (64, 128 or 192).
+	StrictCompat bool
+	// Rand is the source of padding bytes; crypto/rand is used when nil.
+	Rand io.Reader
+	// KeyStatus, when set, adds a key status optional block (00) with this value to blocks
+	// that do not carry one, such as KeyStatusTest for keys created under a test LMK.
+	KeyStatus byte
+}
+
+// WrapKeyBlock encrypts a clear key under the LMK in Thales 'S' key block format. A header
+// version of TR31VersionA, TR31VersionB or TR31VersionC selects a TR-31 block under a TDES
+// LMK instead, and ISO20038VersionE an ISO 20038 block under an AES KBPK; both are tagged
+// TR31SchemeTag.
 func WrapKeyBlock(
 	lmk []byte,
 	header Header,
 	optBlocks []OptionalBlock,
 	key []byte,
 ) ([]byte, error) {
-	// derive encryption and MAC keys.
-	kbek, kbak, err := deriveEncryptionAndMACKeys(lmk, len(lmk))
+	return WrapKeyBlockWithOptions(lmk, header, optBlocks, key, WrapOptions{})
+}
+
+// WrapKeyBlockWithOptions encrypts a clear key under the LMK in Thales 'S' key block
+// format using the given compatibility options.
+func WrapKeyBlockWithOptions(
+	lmk []byte,
+	header Header,
+	optBlocks []OptionalBlock,
+	key []byte,
+	opts WrapOptions,
+) ([]byte, error) {
+	return WrapKeyBlockAppend(nil, lmk, header, optBlocks, key, opts)
+}
+
+// WrapKeyBlockAppend encrypts a clear key like WrapKeyBlockWithOptions and appends the key
+// block to dst, so batch callers can reuse one buffer across keys. On error dst is returned
+// unchanged.
+func WrapKeyBlockAppend(
+	dst []byte,
+	lmk []byte,
+	header Header,
+	optBlocks []OptionalBlock,
+	key []byte,
+	opts WrapOptions,
+) ([]byte, error) {
+	return wrapKeyBlockAppend(dst, StaticLMK(lmk), header, optBlocks, key, opts)
+}
+
+// WrapKeyBlockWithProvider encrypts a clear key like WrapKeyBlockWithOptions with the
+// wrapping keys that p supplies for the version of header.
+func WrapKeyBlockWithProvider(
+	p LMKProvider,
+	header Header,
+	optBlocks []OptionalBlock,
+	key []byte,
+	opts WrapOptions,
+) ([]byte, error) {
+	return wrapKeyBlockAppend(nil, p, header, optBlocks, key, opts)
+}
+
+// wrapKeyBlockAppend encrypts a clear key under the LMK of p and appends the key block to
+// dst.
+func wrapKeyBlockAppend(
+	dst []byte,
+	p LMKProvider,
+	header Header,
+	optBlocks []OptionalBlock,
+	key []byte,
+	opts WrapOptions,
+) ([]byte, error) {
+	if opts.StrictCompat && isDESAlgorithm(header.Algorithm) {
+		if err := checkDESKeyLength(header.Algorithm, len(key)); err != nil {
+			return dst, err
+		}
+		// Parity bits are not part of the effective key; payShield stores them odd.
+		key = cryptoutils.FixKeyParity(key)
+	}
+	random := opts.Rand
+	if random == nil {
+		random = cryptoprovider.Reader()
+	}
+	if opts.KeyStatus != 0 {
+		if _, ok := FindOptionalBlock(optBlocks, OptionalBlockKeyStatus); !ok {
+			if header.OptionalBlocks >= 99 {
+				return dst, errors.New("too many optional blocks")
+			}
+			status := OptionalBlock{Tag: OptionalBlockKeyStatus, Value: []byte{opts.KeyStatus}}
+			optBlocks = slices.Concat([]OptionalBlock{status}, optBlocks)
+			header.OptionalBlocks++
+		}
+	}
+	if isTR31Version(header.Version) && header.KeyContext > KeyContextExchange {
+		return dst, fmt.Errorf("%w: invalid key context %d", ErrKeyBlockFormat, header.KeyContext)
+	}
+	if err := checkPolicy(PolicyWrap, &header, optBlocks); err != nil {
+		return dst, err
+	}
+	if isTR31TDESVersion(header.Version) {
+		return wrapTR31TDES(dst, p, header, optBlocks, key, random)
+	}
+	if header.Version == ISO20038VersionE {
+		return wrapISO20038(dst, p, header, optBlocks, key, random)
+	}
+
+	kbek, kbak, err := p.WrappingKeys(header.Version)
 	if err != nil {
-		return nil, fmt.Errorf("key derivation failed: %v", err)
+		return dst, fmt.Errorf("key derivation failed: %v", err)
 	}
+	defer cryptoutils.Zeroize(kbek, kbak)
 
 	// build length-prefixed plaintext.
 	keyBits := len(key) * 8
-	lengthField := []byte{byte(keyBits >> 8), byte(keyBits & 0xFF)}
-	plain := slices.Concat(lengthField, key)
+	// The buffer has room for the padding, so the clear key data stays in one buffer.
+	plain := make([]byte, 0, 2+len(key)+aes.BlockSize)
+	defer cryptoutils.Zeroize(plain[:cap(plain)])
+	plain = append(plain, byte(keyBits>>8), byte(keyBits))
+	plain = append(plain, key...)
 
 	// Apply padding to multiple of AES block size.
 	blockSize := aes.BlockSize
@@ -39,8 +145,8 @@ func WrapKeyBlock(
 
 	if padLen > 0 {
 		padding := make([]byte, padLen)
-		if _, err := rand.Read(padding); err != nil {
-			return nil, fmt.Errorf("random pad generation failed: %v", err)
+		if _, err := io.ReadFull(random, padding); err != nil {
+			return dst, fmt.Errorf("random pad generation failed: %v", err)
 		}
 
 		plain = append(plain, padding...)
@@ -49,15 +155,15 @@ func WrapKeyBlock(
 	// encrypt plaintext under KBEK using AES-CBC with IV = header bytes.
 	headerBytes, err := header.toBytes()
 	if err != nil {
-		return nil, err
+		return dst, err
 	}
 	if len(headerBytes) != blockSize {
-		return nil, errors.New("header length invalid")
+		return dst, errors.New("header length invalid")
 	}
 
-	cipherBlock, err := aes.NewCipher(kbek)
+	cipherBlock, err := cryptoprovider.NewAESCipher(kbek)
 	if err != nil {
-		return nil, fmt.Errorf("aes cipher init failed: %v", err)
+		return dst, fmt.Errorf("aes cipher init failed: %v", err)
 	}
 	iv := headerBytes
 	cbc := cipher.NewCBCEncrypter(cipherBlock, iv)
@@ -70,7 +176,18 @@ func WrapKeyBlock(
 		optionalBlocksSize += len(opt.Marshal())
 	}
 	// Prepare hex-encoded ciphertext for MAC calculation to match unwrap expectations.
-	hexCiphertext := []byte(strings.ToUpper(hex.EncodeToString(ciphertext)))
+	hexCiphertext := appendUpperHex(nil, ciphertext)
+
+	// The IV uses a zero length field; in strict mode the transmitted and authenticated
+	// header carries the real block length: header, optional blocks, data and 16 hex MAC.
+	if opts.StrictCompat {
+		blockLen := len(headerBytes) + optionalBlocksSize + len(hexCiphertext) + 16
+		if blockLen > 9999 {
+			return dst, errors.New("key block too long")
+		}
+		headerBytes = slices.Clone(headerBytes)
+		copy(headerBytes[1:5], fmt.Sprintf("%04d", blockLen))
+	}
 
 	// Now compute AES-CMAC over header, optional blocks, and hex-encoded ciphertext.
 	macInput := make([]byte, 0, len(headerBytes)+len(hexCiphertext)+optionalBlocksSize)
@@ -81,31 +198,44 @@ func WrapKeyBlock(
 	macInput = append(macInput, hexCiphertext...)
 	authFull, err := computeAESCMAC(kbak, macInput)
 	if err != nil {
-		return nil, fmt.Errorf("cmac computation failed: %v", err)
+		return dst, fmt.Errorf("cmac computation failed: %v", err)
 	}
 	// Use 8 bytes for Thales 'S' format.
 	authField := authFull[:8]
 
-	// Assemble the final result according to Thales 'S' specification:
-	// - Header and optional blocks: ASCII format (not hex-encoded)
-	// - Encrypted key data and MAC: ASCII hex encoded
-	var result strings.Builder
-
-	// Add key scheme tag for Thales format.
-	result.WriteString("S")
+	// Assemble the final result according to Thales 'S' specification: the scheme tag,
+	// header and optional blocks as ASCII, followed by the encrypted key data and MAC as
+	// ASCII hex. The MAC input already holds everything but the tag and MAC.
+	dst = slices.Grow(dst, 1+len(macInput)+2*len(authField))
+	dst = append(dst, 'S')
+	dst = append(dst, macInput...)
 
-	// Add header as ASCII characters (not hex-encoded).
-	result.Write(headerBytes)
+	return appendUpperHex(dst, authField), nil
+}
 
-	// Add optional blocks as ASCII characters (not hex-encoded).
-	for _, opt := range optBlocks {
-		optBytes := opt.Marshal()
-		result.Write(optBytes)
+// appendUpperHex appends the upper case hex encoding of src to dst.
+func appendUpperHex(dst, src []byte) []byte {
+	const digits = "0123456789ABCDEF"
+	for _, b := range src {
+		dst = append(dst, digits[b>>4], digits[b&0x0F])
 	}
 
-	// Add encrypted key data and MAC as ASCII hex encoded.
-	result.WriteString(strings.ToUpper(hex.EncodeToString(ciphertext)))
-	result.WriteString(strings.ToUpper(hex.EncodeToString(authField)))
+	return dst
+}
+
+// isDESAlgorithm reports whether the key block algorithm is single DES or TDES.
+func isDESAlgorithm(algorithm byte) bool {
+	return algorithm == 'D' || algorithm == 'T'
+}
+
+// checkDESKeyLength validates the key length for a DES ('D') or TDES ('T') key.
+func checkDESKeyLength(algorithm byte, n int) error {
+	switch {
+	case algorithm == 'D' && n == 8:
+	case algorithm == 'T' && (n == 16 || n == 24):
+	default:
+		return fmt.Errorf("invalid key length %d for algorithm %c", n, algorithm)
+	}
 
-	return []byte(result.String()), nil
+	return nil
 }
@@ -2,8 +2,12 @@ package keyblocklmk
 
 import (
 	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -234,10 +238,16 @@ func TestMACValidation(t *testing.T) {
 		t.Fatalf("UnwrapKeyBlock failed for valid key block: %v", err)
 	}
 
-	// Corrupt the key block by changing the last byte (MAC).
+	// Corrupt the key block by changing the last MAC digit to another hex digit, so the
+	// block stays well formed and only the MAC check fails.
 	corruptedKeyBlock := make([]byte, len(keyBlock))
 	copy(corruptedKeyBlock, keyBlock)
-	corruptedKeyBlock[len(corruptedKeyBlock)-1] ^= 0x01 // Flip one bit.
+	last := len(corruptedKeyBlock) - 1
+	if corruptedKeyBlock[last] == '0' {
+		corruptedKeyBlock[last] = '1'
+	} else {
+		corruptedKeyBlock[last] = '0'
+	}
 
 	// Verify MAC validation fails.
 	_, _, err = UnwrapKeyBlock(lmk, corruptedKeyBlock)
@@ -333,6 +343,88 @@ func TestInvalidInputs(t *testing.T) {
 	}
 }
 
+// TestWrapKeyBlockAppend verifies appending key blocks to a reused buffer.
+func TestWrapKeyBlockAppend(t *testing.T) {
+	t.Parallel()
+
+	lmk := getTestLMK()
+	header := Header{
+		Version:       '1',
+		KeyUsage:      "B0",
+		Algorithm:     'A',
+		ModeOfUse:     'E',
+		KeyVersionNum: "00",
+		Exportability: 'S',
+	}
+	opts := WrapOptions{StrictCompat: true, Rand: bytes.NewReader(make([]byte, 64))}
+	want, err := WrapKeyBlockWithOptions(lmk, header, nil, bytes.Repeat([]byte{0x01}, 16), opts)
+	if err != nil {
+		t.Fatalf("WrapKeyBlockWithOptions failed: %v", err)
+	}
+
+	buf := make([]byte, 0, 256)
+	buf = append(buf, "prefix;"...)
+	opts.Rand = bytes.NewReader(make([]byte, 64))
+	buf, err = WrapKeyBlockAppend(buf, lmk, header, nil, bytes.Repeat([]byte{0x01}, 16), opts)
+	if err != nil {
+		t.Fatalf("WrapKeyBlockAppend failed: %v", err)
+	}
+	if string(buf) != "prefix;"+string(want) {
+		t.Errorf("WrapKeyBlockAppend() = %s, want prefix;%s", buf, want)
+	}
+
+	bad := header
+	bad.KeyUsage = ""
+	if out, err := WrapKeyBlockAppend(buf, lmk, bad, nil, []byte("key"), opts); err == nil ||
+		!bytes.Equal(out, buf) {
+		t.Errorf("WrapKeyBlockAppend() = %s, %v, want unchanged buffer and error", out, err)
+	}
+
+	header2, key, err := UnwrapKeyBlockAppend([]byte{0xFF}, lmk, want)
+	wantKey := append([]byte{0xFF}, bytes.Repeat([]byte{0x01}, 16)...)
+	if err != nil || header2.KeyUsage != "B0" || !bytes.Equal(key, wantKey) {
+		t.Errorf("UnwrapKeyBlockAppend() = %X, %v", key, err)
+	}
+}
+
+// TestUnwrapParseErrors verifies the field and offset reported for malformed key blocks.
+func TestUnwrapParseErrors(t *testing.T) {
+	t.Parallel()
+
+	lmk := getTestLMK()
+	valid := "S10064B0AE00S000079EAFA5D0F6575FE50C1BD5BB847E4F699B7B5E878D52956"
+	tests := []struct {
+		name       string
+		keyBlock   string
+		wantField  string
+		wantOffset int
+	}{
+		{"empty", "", "scheme tag", 0},
+		{"short header", "S1006", "header", 1},
+		{"block length", "S10X64" + valid[6:], "block length", 3},
+		{"optional block count", valid[:13] + "A" + valid[14:], "optional block count", 13},
+		{"optional block length", valid[:13] + "01" + valid[15:], "optional block 1 length", 19},
+		{"key data not hex", valid[:20] + "G" + valid[21:], "key data", 20},
+		{"key data length", valid[:17] + valid[19:], "key data", 17},
+		{"MAC not hex", valid[:len(valid)-1] + "Z", "MAC", len(valid) - 1},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, _, err := UnwrapKeyBlock(lmk, []byte(tc.keyBlock))
+			var pe *ParseError
+			if !errors.As(err, &pe) || !errors.Is(err, ErrKeyBlockFormat) {
+				t.Fatalf("UnwrapKeyBlock() error = %v, want ParseError", err)
+			}
+			if pe.Field != tc.wantField || pe.Offset != tc.wantOffset {
+				t.Errorf("ParseError = %+v, want field %s at offset %d", pe, tc.wantField, tc.wantOffset)
+			}
+		})
+	}
+}
+
 // BenchmarkWrapKeyBlock benchmarks the WrapKeyBlock function.
 func BenchmarkWrapKeyBlock(b *testing.B) {
 	lmk := getTestLMK()
@@ -370,3 +462,245 @@ func BenchmarkUnwrapKeyBlock(b *testing.B) {
 		}
 	}
 }
+
+// TestStrictCompatKnownKeyBlock reproduces the known device key block byte for byte.
+func TestStrictCompatKnownKeyBlock(t *testing.T) {
+	t.Parallel()
+	const keyBlockStr = "S10064B0AE00S000079EAFA5D0F6575FE50C1BD5BB847E4F699B7B5E878D52956"
+	lmk := getTestLMK()
+
+	header, clearKey, err := UnwrapKeyBlock(lmk, []byte(keyBlockStr))
+	if err != nil {
+		t.Fatalf("UnwrapKeyBlock failed: %v", err)
+	}
+
+	// Recover the random padding of the device block so the wrap is deterministic.
+	kbek, _, err := deriveEncryptionAndMACKeys(lmk, len(lmk))
+	if err != nil {
+		t.Fatalf("key derivation failed: %v", err)
+	}
+	iv, _ := header.toBytes()
+	ciphertext, _ := hex.DecodeString(keyBlockStr[17:49])
+	block, _ := aes.NewCipher(kbek)
+	plain := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, ciphertext)
+	padding := plain[2+len(clearKey):]
+
+	got, err := WrapKeyBlockWithOptions(lmk, *header, nil, clearKey, WrapOptions{
+		StrictCompat: true,
+		Rand:         bytes.NewReader(padding),
+	})
+	if err != nil {
+		t.Fatalf("WrapKeyBlockWithOptions failed: %v", err)
+	}
+	if string(got) != keyBlockStr {
+		t.Errorf("strict wrap mismatch:\n got %s\nwant %s", got, keyBlockStr)
+	}
+}
+
+// TestStrictCompatTDES tests TDES key length encoding and parity in strict mode.
+func TestStrictCompatTDES(t *testing.T) {
+	t.Parallel()
+	lmk := getTestLMK()
+	header := Header{
+		Version:       '1',
+		KeyUsage:      "K0",
+		Algorithm:     'T',
+		ModeOfUse:     'B',
+		KeyVersionNum: "00",
+		Exportability: 'S',
+	}
+
+	for _, keyHex := range []string{
+		"0023456789ABCDEFFEDCBA9876543210",
+		"0023456789ABCDEFFEDCBA987654321089ABCDEF01234567",
+	} {
+		key, _ := hex.DecodeString(keyHex)
+		kb, err := WrapKeyBlockWithOptions(lmk, header, nil, key, WrapOptions{StrictCompat: true})
+		if err != nil {
+			t.Fatalf("WrapKeyBlockWithOptions(%d bytes) failed: %v", len(key), err)
+		}
+		if want := fmt.Sprintf("%04d", len(kb)-1); string(kb[2:6]) != want {
+			t.Errorf("length field = %s, want %s", kb[2:6], want)
+		}
+
+		_, clearKey, err := UnwrapKeyBlock(lmk, kb)
+		if err != nil {
+			t.Fatalf("UnwrapKeyBlock failed: %v", err)
+		}
+		// The first byte has even parity and is stored with its parity bit set.
+		if clearKey[0] != 0x01 || !bytes.Equal(clearKey[1:], key[1:]) {
+			t.Errorf("unwrapped key = %X, want odd parity form of %X", clearKey, key)
+		}
+	}
+
+	if _, err := WrapKeyBlockWithOptions(lmk, header, nil, make([]byte, 8), WrapOptions{StrictCompat: true}); err == nil {
+		t.Error("expected error for single length key with algorithm T")
+	}
+}
+
+// TestUnwrapEffectiveBitLength tests key length fields that encode effective DES bits.
+func TestUnwrapEffectiveBitLength(t *testing.T) {
+	t.Parallel()
+	lmk := getTestLMK()
+	header := Header{
+		Version:       '1',
+		KeyUsage:      "K0",
+		Algorithm:     'T',
+		ModeOfUse:     'B',
+		KeyVersionNum: "00",
+		Exportability: 'S',
+	}
+	key, _ := hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+
+	// Build a block whose length field holds 112 effective bits.
+	kbek, kbak, _ := deriveEncryptionAndMACKeys(lmk, len(lmk))
+	iv, _ := header.toBytes()
+	plain := append([]byte{0x00, 112}, key...)
+	plain = append(plain, make([]byte, 14)...)
+	ciphertext := make([]byte, len(plain))
+	block, _ := aes.NewCipher(kbek)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, plain)
+	hexCiphertext := strings.ToUpper(hex.EncodeToString(ciphertext))
+	mac, _ := computeAESCMAC(kbak, append(iv, hexCiphertext...))
+	kb := "S" + string(iv) + hexCiphertext + strings.ToUpper(hex.EncodeToString(mac[:8]))
+
+	_, clearKey, err := UnwrapKeyBlock(lmk, []byte(kb))
+	if err != nil {
+		t.Fatalf("UnwrapKeyBlock failed: %v", err)
+	}
+	if !bytes.Equal(clearKey, key) {
+		t.Errorf("unwrapped key = %X, want %X", clearKey, key)
+	}
+}
+
+// TestWrapKeyStatus verifies that a key status option adds a status block once.
+func TestWrapKeyStatus(t *testing.T) {
+	t.Parallel()
+
+	lmk := getTestLMK()
+	key := bytes.Repeat([]byte{0x5A}, 16)
+	header := Header{
+		Version:       '1',
+		KeyUsage:      "K0",
+		Algorithm:     'A',
+		ModeOfUse:     'B',
+		KeyVersionNum: "00",
+		Exportability: 'E',
+	}
+	opts := WrapOptions{KeyStatus: KeyStatusTest}
+
+	block, err := WrapKeyBlockWithOptions(lmk, header, nil, key, opts)
+	if err != nil {
+		t.Fatalf("WrapKeyBlockWithOptions failed: %v", err)
+	}
+	got, blocks, clear, err := UnwrapKeyBlockWithOptionalBlocks(lmk, block)
+	if err != nil || !bytes.Equal(clear, key) {
+		t.Fatalf("UnwrapKeyBlockWithOptionalBlocks() = %X, %v", clear, err)
+	}
+	if got.OptionalBlocks != 1 || KeyStatus(blocks) != KeyStatusTest {
+		t.Errorf("optional blocks = %d %+v, want a test key status", got.OptionalBlocks, blocks)
+	}
+
+	// An existing status block is kept.
+	live := OptionalBlock{Tag: OptionalBlockKeyStatus, Value: []byte{KeyStatusLive}}
+	header.OptionalBlocks = 1
+	block, err = WrapKeyBlockWithOptions(lmk, header, []OptionalBlock{live}, key, opts)
+	if err != nil {
+		t.Fatalf("WrapKeyBlockWithOptions failed: %v", err)
+	}
+	_, blocks, _, err = UnwrapKeyBlockWithOptionalBlocks(lmk, block)
+	if err != nil || len(blocks) != 1 || KeyStatus(blocks) != KeyStatusLive {
+		t.Errorf("optional blocks = %+v, %v, want the live status only", blocks, err)
+	}
+
+	if KeyStatus(nil) != 0 {
+		t.Error("KeyStatus(nil) must be zero")
+	}
+}
+
+// TestWrapKeyContext verifies that 'R' blocks carry the TR-31 key context in header byte
+// 14, and that translations enforce it.
+func TestWrapKeyContext(t *testing.T) {
+	t.Parallel()
+
+	kbpk, _ := hex.DecodeString("89E88CF7931444F334BD7547FC3F380C")
+	other, _ := hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+	lmk := getTestLMK()
+	key := bytes.Repeat([]byte{0x5A}, 16)
+	header := Header{
+		Version:       TR31VersionB,
+		KeyUsage:      "K0",
+		Algorithm:     'T',
+		ModeOfUse:     'B',
+		KeyVersionNum: "00",
+		Exportability: 'E',
+	}
+
+	tests := []struct {
+		ctx       byte
+		toStorage error
+		toR       error
+	}{
+		{KeyContextAny, nil, nil},
+		{KeyContextStorage, nil, ErrKeyContext},
+		{KeyContextExchange, ErrKeyContext, nil},
+	}
+	for _, tc := range tests {
+		header.KeyContext = tc.ctx
+		block, err := WrapKeyBlock(kbpk, header, nil, key)
+		if err != nil {
+			t.Fatalf("wrap with context %d failed: %v", tc.ctx, err)
+		}
+		if got := string(block[15:17]); got != fmt.Sprintf("%d0", tc.ctx) {
+			t.Errorf("header bytes 14-15 = %s, want key context %d and reserved 0", got, tc.ctx)
+		}
+		got, clear, err := UnwrapKeyBlock(kbpk, block)
+		if err != nil || !bytes.Equal(clear, key) || got.KeyContext != tc.ctx {
+			t.Fatalf("unwrap with context %d = %+v, %X, %v", tc.ctx, got, clear, err)
+		}
+
+		// Importing into an 'S' block stores the key; rewrapping in an 'R' block exchanges it.
+		_, err = TranslateKeyBlock(kbpk, block, lmk, TranslateOptions{Version: '1'})
+		if !errors.Is(err, tc.toStorage) {
+			t.Errorf("import with context %d error = %v, want %v", tc.ctx, err, tc.toStorage)
+		}
+		_, err = TranslateKeyBlock(kbpk, block, other, TranslateOptions{})
+		if !errors.Is(err, tc.toR) {
+			t.Errorf("rewrap with context %d error = %v, want %v", tc.ctx, err, tc.toR)
+		}
+	}
+
+	// 'S' blocks hold the LMK identifier in bytes 14-15, which is not a key context.
+	stored, err := WrapKeyBlock(lmk, Header{
+		Version: '1', KeyUsage: "K0", Algorithm: 'A', ModeOfUse: 'B', KeyVersionNum: "00",
+		Exportability: 'E', KeyContext: 1,
+	}, nil, key)
+	if err != nil {
+		t.Fatalf("WrapKeyBlock() error = %v", err)
+	}
+	exported, err := TranslateKeyBlock(lmk, stored, kbpk, TranslateOptions{Version: TR31VersionB})
+	if err != nil {
+		t.Fatalf("export error = %v", err)
+	}
+	if got, _, err := UnwrapKeyBlock(kbpk, exported); err != nil || got.KeyContext != KeyContextAny {
+		t.Errorf("exported header = %+v, %v, want key context %d", got, err, KeyContextAny)
+	}
+
+	header.KeyContext = 3
+	if _, err := WrapKeyBlock(kbpk, header, nil, key); err == nil {
+		t.Error("expected error for key context 3")
+	}
+
+	// An unknown key context is a parse error on unwrap, reported before the MAC check.
+	header.KeyContext = KeyContextAny
+	block, err := WrapKeyBlock(kbpk, header, nil, key)
+	if err != nil {
+		t.Fatalf("wrap failed: %v", err)
+	}
+	block[15] = '3'
+	var pe *ParseError
+	if _, _, err := UnwrapKeyBlock(kbpk, block); !errors.As(err, &pe) || pe.Field != "key context" {
+		t.Errorf("unwrap of invalid key context = %v, want a key context ParseError", err)
+	}
+}
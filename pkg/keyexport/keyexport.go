@@ -0,0 +1,407 @@
+// Package keyexport wraps keys for export under a zone master key (ZMK) or other
+// key-encrypting key (KEK). Partner institutions differ in the wrapping they accept, so
+// the scheme is selected per request: ANSI X9.17 ECB, TDES CBC, Thales variant wrapping,
+// or an AES key block (ANSI X9.143 / TR-31 version D).
+package keyexport
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+)
+
+// Scheme is a key export wrapping scheme.
+type Scheme byte
+
+// Export schemes. The values are the key scheme tags prefixed to exported keys.
+const (
+	SchemeX917     Scheme = 'X' // ANSI X9.17: each 8-byte block encrypted in ECB mode
+	SchemeCBC      Scheme = 'C' // TDES CBC with a zero IV
+	SchemeVariant  Scheme = 'U' // Thales variant: each key part under its own ZMK variant
+	SchemeKeyBlock Scheme = 'R' // AES key block, TR-31 version D
+)
+
+var (
+	// ErrUnknownScheme is returned for an unsupported export scheme.
+	ErrUnknownScheme = errors.New("unknown export scheme")
+	// ErrKeyLength is returned when the key or KEK length does not suit the scheme.
+	ErrKeyLength = errors.New("invalid key length for export scheme")
+	// ErrKeyBlock is returned for malformed or unauthenticated key blocks.
+	ErrKeyBlock = errors.New("invalid key block")
+)
+
+// Thales key length variants applied to the leftmost byte of the ZMK, one per 8-byte
+// part of the exported key.
+var (
+	doubleLengthVariants = []byte{0xA6, 0x5A}
+	tripleLengthVariants = []byte{0x6A, 0xDE, 0x2B}
+)
+
+// ParseScheme maps a scheme tag to a Scheme. 'Y' and 'T' are the triple-length forms of
+// 'X' and 'U'.
+func ParseScheme(tag byte) (Scheme, error) {
+	switch tag {
+	case 'X', 'Y':
+		return SchemeX917, nil
+	case 'C':
+		return SchemeCBC, nil
+	case 'U', 'T':
+		return SchemeVariant, nil
+	case 'R':
+		return SchemeKeyBlock, nil
+	default:
+		return 0, fmt.Errorf("%w: %q", ErrUnknownScheme, tag)
+	}
+}
+
+// KeyBlockHeader holds the header attributes of an exported AES key block.
+type KeyBlockHeader struct {
+	KeyUsage      string // 2 characters, e.g. "P0".
+	Algorithm     byte   // algorithm of the wrapped key, e.g. 'T' or 'A'.
+	ModeOfUse     byte
+	KeyVersion    string // 2 characters.
+	Exportability byte
+}
+
+// Options carries scheme specific parameters.
+type Options struct {
+	// Header describes the wrapped key for SchemeKeyBlock.
+	Header KeyBlockHeader
+	// Rand is the source of key block padding; crypto/rand is used when nil.
+	Rand io.Reader
+}
+
+// Wrap encrypts key under kek using the given scheme. DES schemes return the encrypted
+// key bytes; SchemeKeyBlock returns the ASCII key block.
+func Wrap(scheme Scheme, kek, key []byte, opts Options) ([]byte, error) {
+	switch scheme {
+	case SchemeX917:
+		return tdesECB(kek, key)
+	case SchemeCBC:
+		return tdesCBC(kek, key)
+	case SchemeVariant:
+		return variantWrap(kek, key)
+	case SchemeKeyBlock:
+		return wrapKeyBlockD(kek, key, opts)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownScheme, byte(scheme))
+	}
+}
+
+// Unwrap reverses Wrap. For SchemeKeyBlock the header of the block is returned as well.
+func Unwrap(scheme Scheme, kek, data []byte) ([]byte, *KeyBlockHeader, error) {
+	var (
+		key []byte
+		err error
+	)
+	switch scheme {
+	case SchemeX917:
+		key, err = tdesECBDecrypt(kek, data)
+	case SchemeCBC:
+		key, err = tdesCBCDecrypt(kek, data)
+	case SchemeVariant:
+		key, err = variantUnwrap(kek, data)
+	case SchemeKeyBlock:
+		return unwrapKeyBlockD(kek, data)
+	default:
+		err = fmt.Errorf("%w: %q", ErrUnknownScheme, byte(scheme))
+	}
+
+	return key, nil, err
+}
+
+func tdesCipher(kek []byte) (cipher.Block, error) {
+	if len(kek) != 8 && len(kek) != 16 && len(kek) != 24 {
+		return nil, fmt.Errorf("%w: kek of %d bytes", ErrKeyLength, len(kek))
+	}
+
+	return cryptoprovider.NewTripleDESCipher(cryptoutils.PrepareTripleDESKey(kek))
+}
+
+func checkDESKey(key []byte) error {
+	if len(key) != 8 && len(key) != 16 && len(key) != 24 {
+		return fmt.Errorf("%w: key of %d bytes", ErrKeyLength, len(key))
+	}
+
+	return nil
+}
+
+func tdesECB(kek, key []byte) ([]byte, error) {
+	if err := checkDESKey(key); err != nil {
+		return nil, err
+	}
+	block, err := tdesCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(key))
+	cryptoutils.NewECBEncrypter(block).CryptBlocks(out, key)
+
+	return out, nil
+}
+
+func tdesECBDecrypt(kek, data []byte) ([]byte, error) {
+	if err := checkDESKey(data); err != nil {
+		return nil, err
+	}
+	block, err := tdesCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(data))
+	cryptoutils.NewECBDecrypter(block).CryptBlocks(out, data)
+
+	return out, nil
+}
+
+func tdesCBC(kek, key []byte) ([]byte, error) {
+	if err := checkDESKey(key); err != nil {
+		return nil, err
+	}
+	block, err := tdesCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(key))
+	cipher.NewCBCEncrypter(block, make([]byte, des.BlockSize)).CryptBlocks(out, key)
+
+	return out, nil
+}
+
+func tdesCBCDecrypt(kek, data []byte) ([]byte, error) {
+	if err := checkDESKey(data); err != nil {
+		return nil, err
+	}
+	block, err := tdesCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, make([]byte, des.BlockSize)).CryptBlocks(out, data)
+
+	return out, nil
+}
+
+// variantKEKs returns the ZMK variants for each 8-byte part of a key of keyLen bytes.
+// Single-length keys are wrapped under the ZMK itself.
+func variantKEKs(kek []byte, keyLen int) ([]cipher.Block, error) {
+	var variants []byte
+	switch keyLen {
+	case 8:
+		variants = []byte{0x00}
+	case 16:
+		variants = doubleLengthVariants
+	case 24:
+		variants = tripleLengthVariants
+	default:
+		return nil, fmt.Errorf("%w: key of %d bytes", ErrKeyLength, keyLen)
+	}
+
+	blocks := make([]cipher.Block, len(variants))
+	for i, v := range variants {
+		variant := slices.Clone(kek)
+		variant[0] ^= v
+		block, err := tdesCipher(variant)
+		if err != nil {
+			return nil, err
+		}
+		blocks[i] = block
+	}
+
+	return blocks, nil
+}
+
+func variantWrap(kek, key []byte) ([]byte, error) {
+	blocks, err := variantKEKs(kek, len(key))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(key))
+	for i, block := range blocks {
+		block.Encrypt(out[i*8:], key[i*8:i*8+8])
+	}
+
+	return out, nil
+}
+
+func variantUnwrap(kek, data []byte) ([]byte, error) {
+	blocks, err := variantKEKs(kek, len(data))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(data))
+	for i, block := range blocks {
+		block.Decrypt(out[i*8:], data[i*8:i*8+8])
+	}
+
+	return out, nil
+}
+
+// deriveKeyBlockKeys derives the key block encryption and MAC keys from an AES KBPK with
+// the CMAC based derivation of TR-31 version D.
+func deriveKeyBlockKeys(kbpk []byte) ([]byte, []byte, error) {
+	var algorithm uint16
+	switch len(kbpk) {
+	case 16:
+		algorithm = 0x0002
+	case 24:
+		algorithm = 0x0003
+	case 32:
+		algorithm = 0x0004
+	default:
+		return nil, nil, fmt.Errorf("%w: aes kek of %d bytes", ErrKeyLength, len(kbpk))
+	}
+	bits := uint16(len(kbpk) * 8)
+
+	derive := func(usage uint16) ([]byte, error) {
+		out := make([]byte, 0, 32)
+		for counter := byte(1); len(out) < len(kbpk); counter++ {
+			data := []byte{
+				counter,
+				byte(usage >> 8), byte(usage),
+				0x00,
+				byte(algorithm >> 8), byte(algorithm),
+				byte(bits >> 8), byte(bits),
+			}
+			mac, err := cryptoutils.AESCMAC(data, kbpk)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, mac...)
+		}
+
+		return out[:len(kbpk)], nil
+	}
+
+	kbek, err := derive(0x0000)
+	if err != nil {
+		return nil, nil, err
+	}
+	kbmk, err := derive(0x0001)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return kbek, kbmk, nil
+}
+
+func (h KeyBlockHeader) marshal(blockLen int) ([]byte, error) {
+	if len(h.KeyUsage) != 2 || len(h.KeyVersion) != 2 {
+		return nil, fmt.Errorf("%w: key usage and key version must be 2 characters", ErrKeyBlock)
+	}
+	if blockLen > 9999 {
+		return nil, fmt.Errorf("%w: block too long", ErrKeyBlock)
+	}
+
+	return fmt.Appendf(nil, "D%04d%s%c%c%s%c0000",
+		blockLen, h.KeyUsage, h.Algorithm, h.ModeOfUse, h.KeyVersion, h.Exportability), nil
+}
+
+func wrapKeyBlockD(kbpk, key []byte, opts Options) ([]byte, error) {
+	kbek, kbmk, err := deriveKeyBlockKeys(kbpk)
+	if err != nil {
+		return nil, err
+	}
+	random := opts.Rand
+	if random == nil {
+		random = cryptoprovider.Reader()
+	}
+
+	// Clear key data: 2-byte key length in bits, key, random padding to the block size.
+	plain := append([]byte{byte(len(key) * 8 >> 8), byte(len(key) * 8)}, key...)
+	if pad := (aes.BlockSize - len(plain)%aes.BlockSize) % aes.BlockSize; pad > 0 {
+		padding := make([]byte, pad)
+		if _, err := io.ReadFull(random, padding); err != nil {
+			return nil, fmt.Errorf("random pad generation failed: %w", err)
+		}
+		plain = append(plain, padding...)
+	}
+
+	header, err := opts.Header.marshal(16 + 2*len(plain) + 2*aes.BlockSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// The MAC over header and clear key data is the IV of the key data encryption.
+	mac, err := cryptoutils.AESCMAC(slices.Concat(header, plain), kbmk)
+	if err != nil {
+		return nil, err
+	}
+	block, err := cryptoprovider.NewAESCipher(kbek)
+	if err != nil {
+		return nil, err
+	}
+	encrypted := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(block, mac).CryptBlocks(encrypted, plain)
+
+	return slices.Concat(
+		header,
+		[]byte(strings.ToUpper(hex.EncodeToString(encrypted))),
+		[]byte(strings.ToUpper(hex.EncodeToString(mac))),
+	), nil
+}
+
+func unwrapKeyBlockD(kbpk, keyBlock []byte) ([]byte, *KeyBlockHeader, error) {
+	const headerLen, macHexLen = 16, 2 * aes.BlockSize
+	if len(keyBlock) < headerLen+macHexLen || keyBlock[0] != 'D' {
+		return nil, nil, fmt.Errorf("%w: not a version D key block", ErrKeyBlock)
+	}
+	if string(keyBlock[1:5]) != fmt.Sprintf("%04d", len(keyBlock)) {
+		return nil, nil, fmt.Errorf("%w: length field mismatch", ErrKeyBlock)
+	}
+	if string(keyBlock[12:14]) != "00" {
+		return nil, nil, fmt.Errorf("%w: optional blocks are not supported", ErrKeyBlock)
+	}
+
+	header := keyBlock[:headerLen]
+	encrypted, err := hex.DecodeString(string(keyBlock[headerLen : len(keyBlock)-macHexLen]))
+	if err != nil || len(encrypted) == 0 || len(encrypted)%aes.BlockSize != 0 {
+		return nil, nil, fmt.Errorf("%w: malformed key data", ErrKeyBlock)
+	}
+	mac, err := hex.DecodeString(string(keyBlock[len(keyBlock)-macHexLen:]))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: malformed mac", ErrKeyBlock)
+	}
+
+	kbek, kbmk, err := deriveKeyBlockKeys(kbpk)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, err := cryptoprovider.NewAESCipher(kbek)
+	if err != nil {
+		return nil, nil, err
+	}
+	plain := make([]byte, len(encrypted))
+	cipher.NewCBCDecrypter(block, mac).CryptBlocks(plain, encrypted)
+
+	expected, err := cryptoutils.AESCMAC(slices.Concat(header, plain), kbmk)
+	if err != nil {
+		return nil, nil, err
+	}
+	if subtle.ConstantTimeCompare(expected, mac) != 1 {
+		return nil, nil, fmt.Errorf("%w: mac verification failed", ErrKeyBlock)
+	}
+
+	keyLen := (int(plain[0])<<8 | int(plain[1])) / 8
+	if keyLen == 0 || 2+keyLen > len(plain) {
+		return nil, nil, fmt.Errorf("%w: invalid key length field", ErrKeyBlock)
+	}
+
+	return plain[2 : 2+keyLen], &KeyBlockHeader{
+		KeyUsage:      string(header[5:7]),
+		Algorithm:     header[7],
+		ModeOfUse:     header[8],
+		KeyVersion:    string(header[9:11]),
+		Exportability: header[11],
+	}, nil
+}
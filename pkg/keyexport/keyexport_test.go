@@ -0,0 +1,146 @@
+package keyexport
+
+import (
+	"bytes"
+	"crypto/des"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("invalid hex %q: %v", s, err)
+	}
+
+	return b
+}
+
+// TestCompatibilityMatrix wraps and unwraps every key length under every KEK length for
+// each export scheme.
+func TestCompatibilityMatrix(t *testing.T) {
+	t.Parallel()
+
+	keys := map[string][]byte{
+		"single": mustHex(t, "0123456789ABCDEF"),
+		"double": mustHex(t, "0123456789ABCDEFFEDCBA9876543210"),
+		"triple": mustHex(t, "0123456789ABCDEFFEDCBA987654321089ABCDEF01234567"),
+	}
+	deskeks := map[string][]byte{
+		"double": mustHex(t, "1C1C1C1C1C1C1C1C1F1F1F1F1F1F1F1F"),
+		"triple": mustHex(t, "1C1C1C1C1C1C1C1C1F1F1F1F1F1F1F1F2A2A2A2A2A2A2A2A"),
+	}
+	aeskeks := map[string][]byte{
+		"aes128": mustHex(t, "000102030405060708090A0B0C0D0E0F"),
+		"aes192": mustHex(t, "000102030405060708090A0B0C0D0E0F1011121314151617"),
+		"aes256": mustHex(t, "000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F"),
+	}
+	header := KeyBlockHeader{KeyUsage: "P0", Algorithm: 'T', ModeOfUse: 'N', KeyVersion: "00", Exportability: 'E'}
+
+	for _, scheme := range []Scheme{SchemeX917, SchemeCBC, SchemeVariant, SchemeKeyBlock} {
+		keks := deskeks
+		if scheme == SchemeKeyBlock {
+			keks = aeskeks
+		}
+		for kekName, kek := range keks {
+			for keyName, key := range keys {
+				name := string(scheme) + "/" + kekName + "/" + keyName
+				t.Run(name, func(t *testing.T) {
+					t.Parallel()
+
+					wrapped, err := Wrap(scheme, kek, key, Options{Header: header})
+					if err != nil {
+						t.Fatalf("Wrap error: %v", err)
+					}
+					if bytes.Contains(wrapped, key) {
+						t.Fatal("wrapped output contains the clear key")
+					}
+					got, _, err := Unwrap(scheme, kek, wrapped)
+					if err != nil {
+						t.Fatalf("Unwrap error: %v", err)
+					}
+					if !bytes.Equal(got, key) {
+						t.Errorf("Unwrap = %X, want %X", got, key)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestSchemesDiffer(t *testing.T) {
+	t.Parallel()
+
+	kek := mustHex(t, "1C1C1C1C1C1C1C1C1F1F1F1F1F1F1F1F")
+	key := mustHex(t, "0123456789ABCDEF0123456789ABCDEF")
+
+	ecb, _ := Wrap(SchemeX917, kek, key, Options{})
+	cbc, _ := Wrap(SchemeCBC, kek, key, Options{})
+	variant, _ := Wrap(SchemeVariant, kek, key, Options{})
+
+	// ECB encrypts equal halves identically; CBC and variant wrapping do not.
+	if !bytes.Equal(ecb[:8], ecb[8:]) {
+		t.Error("expected identical ECB blocks for identical key halves")
+	}
+	if bytes.Equal(cbc[:8], cbc[8:]) || bytes.Equal(variant[:8], variant[8:]) {
+		t.Error("expected CBC and variant wrapping to hide identical key halves")
+	}
+	if !bytes.Equal(ecb[:8], cbc[:8]) {
+		t.Error("expected first CBC block to match ECB with a zero IV")
+	}
+
+	// The first variant block is the key half under the ZMK with its first byte XOR A6.
+	variantKEK := bytes.Clone(kek)
+	variantKEK[0] ^= 0xA6
+	block, _ := des.NewTripleDESCipher(append(bytes.Clone(variantKEK), variantKEK[:8]...))
+	want := make([]byte, 8)
+	block.Encrypt(want, key[:8])
+	if !bytes.Equal(variant[:8], want) {
+		t.Errorf("variant block = %X, want %X", variant[:8], want)
+	}
+}
+
+func TestUnwrapKnownKeyBlock(t *testing.T) {
+	t.Parallel()
+
+	kbpk := mustHex(t, "88E1AB2A2E3DD38C1FA039A536500CC8A87AB9D62DC92C01058FA79F44657DE6")
+	block := "D0112P0AE00E0000B82679114F470F540165EDFBF7E250FCEA43F810D215F8D207E2E417C07156A27E8E31DA05F7425509593D03A457DC34"
+
+	key, header, err := Unwrap(SchemeKeyBlock, kbpk, []byte(block))
+	if err != nil {
+		t.Fatalf("Unwrap error: %v", err)
+	}
+	if want := mustHex(t, "3F419E1CB7079442AA37474C2EFBF8B8"); !bytes.Equal(key, want) {
+		t.Errorf("key = %X, want %X", key, want)
+	}
+	if header.KeyUsage != "P0" || header.Algorithm != 'A' || header.ModeOfUse != 'E' {
+		t.Errorf("unexpected header %+v", header)
+	}
+
+	tampered := []byte(block)
+	tampered[20] ^= 0x01
+	if _, _, err := Unwrap(SchemeKeyBlock, kbpk, tampered); !errors.Is(err, ErrKeyBlock) {
+		t.Errorf("expected ErrKeyBlock for tampered block, got %v", err)
+	}
+}
+
+func TestWrapErrors(t *testing.T) {
+	t.Parallel()
+
+	kek := mustHex(t, "1C1C1C1C1C1C1C1C1F1F1F1F1F1F1F1F")
+	if _, err := Wrap(SchemeX917, kek, []byte{1, 2, 3}, Options{}); !errors.Is(err, ErrKeyLength) {
+		t.Errorf("expected ErrKeyLength, got %v", err)
+	}
+	if _, err := Wrap(SchemeKeyBlock, kek[:8], kek, Options{}); !errors.Is(err, ErrKeyLength) {
+		t.Errorf("expected ErrKeyLength for short AES KEK, got %v", err)
+	}
+	if _, err := Wrap(Scheme('Q'), kek, kek, Options{}); !errors.Is(err, ErrUnknownScheme) {
+		t.Errorf("expected ErrUnknownScheme, got %v", err)
+	}
+	if _, err := ParseScheme('Q'); !errors.Is(err, ErrUnknownScheme) {
+		t.Errorf("expected ErrUnknownScheme from ParseScheme, got %v", err)
+	}
+}
@@ -0,0 +1,196 @@
+// Package keyschemes parses the key scheme tags that prefix keys encrypted under the LMK in
+// host commands and CLI input, and maps each tag to its key length and algorithm. Host
+// commands follow the payShield convention, where X is a double-length ANSI X9.17 key; the
+// variant LMK engines and the CLI use X for single-length keys, see LMKLength. The A, B and C
+// tags, for AES keys under a variant LMK, are a simulator extension: payShield holds AES keys
+// in key blocks only.
+package keyschemes
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+)
+
+// Key scheme tags.
+const (
+	SchemeZ byte = 'Z' // single-length DES, ANSI X9.17.
+	SchemeU byte = 'U' // double-length TDES, variant.
+	SchemeT byte = 'T' // triple-length TDES, variant.
+	SchemeX byte = 'X' // double-length TDES, ANSI X9.17.
+	SchemeY byte = 'Y' // triple-length TDES, ANSI X9.17.
+	SchemeS byte = 'S' // Thales key block.
+	SchemeK byte = 'K' // Thales key block, alternative tag.
+	SchemeR byte = 'R' // ANSI TR-31 key block.
+	SchemeA byte = 'A' // AES-128, variant.
+	SchemeB byte = 'B' // AES-192, variant.
+	SchemeC byte = 'C' // AES-256, variant.
+)
+
+// Algorithm hints, using the key block algorithm codes.
+const (
+	AlgorithmDES  byte = 'D'
+	AlgorithmTDES byte = 'T'
+	AlgorithmAES  byte = 'A'
+)
+
+var (
+	// ErrUnknownScheme is returned for a scheme tag that is not accepted.
+	ErrUnknownScheme = errors.New("unknown key scheme")
+	// ErrTooShort is returned when the data ends before the key.
+	ErrTooShort = errors.New("key too short")
+	// ErrInvalidKey is returned for keys that are not valid hex or key blocks.
+	ErrInvalidKey = errors.New("invalid key")
+)
+
+// Key is an encrypted key parsed from a message.
+type Key struct {
+	Scheme    byte   // scheme tag, or 0 for an unprefixed key.
+	Algorithm byte   // algorithm hint: D, T, or the algorithm of a key block header.
+	Length    int    // clear key length in bytes; 0 for key blocks.
+	Text      string // hex characters of the key, or a key block including its tag.
+}
+
+// IsKeyBlock reports whether the key is a key block.
+func (k Key) IsKeyBlock() bool {
+	return IsKeyBlock(k.Scheme)
+}
+
+// Bytes returns the encrypted key: the decoded hex of a variant key, or a key block as is.
+func (k Key) Bytes() ([]byte, error) {
+	if k.IsKeyBlock() {
+		return []byte(k.Text), nil
+	}
+
+	return hex.DecodeString(k.Text)
+}
+
+// Length returns the clear key length in bytes for a DES variant or X9.17 scheme tag, and 0
+// for key blocks, AES and unknown tags.
+func Length(scheme byte) int {
+	switch scheme {
+	case SchemeZ:
+		return 8
+	case SchemeU, SchemeX:
+		return 16
+	case SchemeT, SchemeY:
+		return 24
+	default:
+		return 0
+	}
+}
+
+// LMKLength returns the clear key length in bytes for a scheme tag as used by the variant
+// LMK engines and the CLI, where X marks a single-length key, and 0 for other tags.
+func LMKLength(scheme byte) int {
+	switch scheme {
+	case SchemeX, SchemeZ:
+		return 8
+	case SchemeU, SchemeA:
+		return 16
+	case SchemeT, SchemeB:
+		return 24
+	case SchemeC:
+		return 32
+	default:
+		return 0
+	}
+}
+
+// IsAES reports whether the scheme tag marks an AES key under a variant LMK.
+func IsAES(scheme byte) bool {
+	return scheme == SchemeA || scheme == SchemeB || scheme == SchemeC
+}
+
+// IsKeyBlock reports whether the scheme tag introduces a key block.
+func IsKeyBlock(scheme byte) bool {
+	return scheme == SchemeS || scheme == SchemeK || scheme == SchemeR
+}
+
+// Parse parses the key at the start of data and returns it with the bytes that follow.
+// allowed lists the accepted scheme tags. Data that does not start with one of them is read
+// as an unprefixed key of unprefixedLen hex characters, or rejected with ErrUnknownScheme
+// when unprefixedLen is 0.
+func Parse(data []byte, allowed string, unprefixedLen int) (Key, []byte, error) {
+	if len(data) == 0 {
+		return Key{}, nil, ErrTooShort
+	}
+
+	scheme := data[0]
+	if strings.IndexByte(allowed, scheme) < 0 {
+		if unprefixedLen == 0 {
+			return Key{}, nil, fmt.Errorf("%w: %q", ErrUnknownScheme, scheme)
+		}
+
+		return parseHex(data, 0, unprefixedLen)
+	}
+
+	if IsKeyBlock(scheme) {
+		block, rest, err := keyblocklmk.SplitKeyBlock(data)
+		if err != nil {
+			return Key{}, nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+		}
+		header, err := keyblocklmk.ParseHeader(block)
+		if err != nil {
+			return Key{}, nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+		}
+
+		return Key{Scheme: scheme, Algorithm: header.Algorithm, Text: string(block)}, rest, nil
+	}
+
+	n := 2 * Length(scheme)
+	if IsAES(scheme) {
+		n = 2 * LMKLength(scheme)
+	}
+	if n == 0 {
+		return Key{}, nil, fmt.Errorf("%w: %q", ErrUnknownScheme, scheme)
+	}
+
+	return parseHex(data[1:], scheme, n)
+}
+
+// parseHex reads a key of n hex characters.
+func parseHex(data []byte, scheme byte, n int) (Key, []byte, error) {
+	if len(data) < n {
+		return Key{}, nil, ErrTooShort
+	}
+	text := string(data[:n])
+	if _, err := hex.DecodeString(text); err != nil {
+		return Key{}, nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+
+	algorithm := AlgorithmTDES
+	switch {
+	case IsAES(scheme):
+		algorithm = AlgorithmAES
+	case n == 16:
+		algorithm = AlgorithmDES
+	}
+
+	return Key{Scheme: scheme, Algorithm: algorithm, Length: n / 2, Text: text}, data[n:], nil
+}
+
+// ParseLMKKey parses a variant key given on the command line: an X, U, T, A, B or C scheme
+// tag followed by exactly the hex characters of a key of LMKLength bytes.
+func ParseLMKKey(text string) (Key, error) {
+	if text == "" {
+		return Key{}, ErrTooShort
+	}
+
+	scheme := text[0]
+	if LMKLength(scheme) == 0 || scheme == SchemeZ {
+		return Key{}, fmt.Errorf("%w: %q", ErrUnknownScheme, scheme)
+	}
+	n := 2 * LMKLength(scheme)
+	if len(text)-1 != n {
+		return Key{}, fmt.Errorf("%w: scheme %c needs %d hex characters, got %d",
+			ErrInvalidKey, scheme, n, len(text)-1)
+	}
+
+	key, _, err := parseHex([]byte(text[1:]), scheme, n)
+
+	return key, err
+}
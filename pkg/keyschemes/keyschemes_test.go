@@ -0,0 +1,143 @@
+package keyschemes_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+	"github.com/andrei-cloud/go_hsm/pkg/keyschemes"
+)
+
+// TestParse verifies scheme detection, lengths and remainders of parsed keys.
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	hex16 := "0123456789ABCDEF"
+	hex32 := hex16 + "FEDCBA9876543210"
+	hex48 := hex32 + hex16
+
+	tests := []struct {
+		name       string
+		data       string
+		allowed    string
+		unprefixed int
+		wantScheme byte
+		wantAlg    byte
+		wantLen    int
+		wantText   string
+		wantRest   string
+		wantErr    error
+	}{
+		{"Z", "Z" + hex16 + "rest", "ZUT", 0, 'Z', 'D', 8, hex16, "rest", nil},
+		{"U", "U" + hex32 + "rest", "UT", 0, 'U', 'T', 16, hex32, "rest", nil},
+		{"X double length", "X" + hex32, "UTX", 0, 'X', 'T', 16, hex32, "", nil},
+		{"T", "T" + hex48 + "1", "UT", 0, 'T', 'T', 24, hex48, "1", nil},
+		{"Y", "Y" + hex48, "XY", 0, 'Y', 'T', 24, hex48, "", nil},
+		{"AES-128", "A" + hex32, "A", 0, 'A', 'A', 16, hex32, "", nil},
+		{"AES-256", "C" + hex32 + hex32 + "1", "ABC", 0, 'C', 'A', 32, hex32 + hex32, "1", nil},
+		{"unprefixed pair", hex32 + "rest", "U", 32, 0, 'T', 16, hex32, "rest", nil},
+		{"unprefixed single", hex16, "U", 16, 0, 'D', 8, hex16, "", nil},
+		{"scheme not allowed", "T" + hex48, "U", 0, 0, 0, 0, "", "", keyschemes.ErrUnknownScheme},
+		{"unknown allowed tag", "Q" + hex32, "Q", 0, 0, 0, 0, "", "", keyschemes.ErrUnknownScheme},
+		{"too short", "U" + hex16, "U", 0, 0, 0, 0, "", "", keyschemes.ErrTooShort},
+		{"empty", "", "U", 32, 0, 0, 0, "", "", keyschemes.ErrTooShort},
+		{"invalid hex", "U" + strings.Repeat("G", 32), "U", 0, 0, 0, 0, "", "", keyschemes.ErrInvalidKey},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			key, rest, err := keyschemes.Parse([]byte(tc.data), tc.allowed, tc.unprefixed)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("Parse() error = %v, want %v", err, tc.wantErr)
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if key.Scheme != tc.wantScheme || key.Algorithm != tc.wantAlg ||
+				key.Length != tc.wantLen || key.Text != tc.wantText {
+				t.Errorf("Parse() = %+v", key)
+			}
+			if string(rest) != tc.wantRest {
+				t.Errorf("rest = %q, want %q", rest, tc.wantRest)
+			}
+			if raw, err := key.Bytes(); err != nil || len(raw) != tc.wantLen {
+				t.Errorf("Bytes() = %X, %v", raw, err)
+			}
+		})
+	}
+}
+
+// TestParseKeyBlock verifies that key blocks are split using their header.
+func TestParseKeyBlock(t *testing.T) {
+	t.Parallel()
+
+	header := keyblocklmk.Header{
+		Version:       '1',
+		KeyUsage:      "P0",
+		Algorithm:     'T',
+		ModeOfUse:     'B',
+		KeyVersionNum: "00",
+		Exportability: 'N',
+	}
+	block, err := keyblocklmk.WrapKeyBlockWithOptions(keyblocklmk.DefaultTestAESLMK, header, nil,
+		bytes.Repeat([]byte{0x01}, 16), keyblocklmk.WrapOptions{StrictCompat: true})
+	if err != nil {
+		t.Fatalf("WrapKeyBlockWithOptions failed: %v", err)
+	}
+
+	key, rest, err := keyschemes.Parse(append(bytes.Clone(block), "0010"...), "US", 0)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !key.IsKeyBlock() || key.Scheme != 'S' || key.Algorithm != 'T' || key.Length != 0 {
+		t.Errorf("Parse() = %+v", key)
+	}
+	if raw, _ := key.Bytes(); !bytes.Equal(raw, block) || string(rest) != "0010" {
+		t.Errorf("Parse() block = %s, rest = %s", raw, rest)
+	}
+
+	if _, _, err := keyschemes.Parse([]byte("S1"), "S", 0); !errors.Is(err, keyschemes.ErrInvalidKey) {
+		t.Errorf("Parse() error = %v, want ErrInvalidKey", err)
+	}
+}
+
+// TestParseLMKKey verifies the single-length X convention of the LMK engines.
+func TestParseLMKKey(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		text    string
+		wantLen int
+		wantErr error
+	}{
+		{"X0123456789ABCDEF", 8, nil},
+		{"U0123456789ABCDEFFEDCBA9876543210", 16, nil},
+		{"T" + strings.Repeat("01", 24), 24, nil},
+		{"A" + strings.Repeat("01", 16), 16, nil},
+		{"B" + strings.Repeat("01", 24), 24, nil},
+		{"C" + strings.Repeat("01", 32), 32, nil},
+		{"C" + strings.Repeat("01", 24), 0, keyschemes.ErrInvalidKey},
+		{"X0123456789ABCDEFFEDCBA9876543210", 0, keyschemes.ErrInvalidKey},
+		{"Z0123456789ABCDEF", 0, keyschemes.ErrUnknownScheme},
+		{"", 0, keyschemes.ErrTooShort},
+	}
+	for _, tc := range tests {
+		key, err := keyschemes.ParseLMKKey(tc.text)
+		if !errors.Is(err, tc.wantErr) {
+			t.Errorf("ParseLMKKey(%q) error = %v, want %v", tc.text, err, tc.wantErr)
+
+			continue
+		}
+		if err == nil && key.Length != tc.wantLen {
+			t.Errorf("ParseLMKKey(%q) length = %d, want %d", tc.text, key.Length, tc.wantLen)
+		}
+	}
+}
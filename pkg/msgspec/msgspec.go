@@ -0,0 +1,312 @@
+// Package msgspec provides declarative HSM command message layouts.
+// A Spec lists the fields of a command in wire order and Parse walks the input
+// once, validating lengths and encodings, so command handlers no longer need to
+// track offsets by hand.
+package msgspec
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/andrei-cloud/go_hsm/pkg/keyschemes"
+)
+
+// Supported field encodings.
+const (
+	EncodingAny          Encoding = iota // Any byte.
+	EncodingHex                          // Hexadecimal digits 0-9, A-F (either case).
+	EncodingNumeric                      // Decimal digits 0-9.
+	EncodingAlphanumeric                 // Letters and decimal digits.
+)
+
+// Supported field kinds.
+const (
+	KindFixed     Kind = iota // Field with a fixed length.
+	KindKey                   // Encrypted key with an optional scheme prefix.
+	KindDelimited             // Variable length field terminated by a delimiter.
+	KindRemainder             // All remaining bytes of the message.
+)
+
+var (
+	// ErrTooShort is returned when the input ends before a mandatory field.
+	ErrTooShort = errors.New("message too short")
+	// ErrInvalidEncoding is returned when a field contains bytes outside its encoding.
+	ErrInvalidEncoding = errors.New("invalid field encoding")
+	// ErrInvalidLength is returned when a field violates its length bounds.
+	ErrInvalidLength = errors.New("invalid field length")
+	// ErrMissingDelimiter is returned when a delimited field has no terminator.
+	ErrMissingDelimiter = errors.New("missing field delimiter")
+	// ErrTrailingData is returned when bytes remain after the last field.
+	ErrTrailingData = errors.New("unexpected trailing data")
+)
+
+// Encoding describes the allowed character set of a field.
+type Encoding int
+
+// Kind describes how the length of a field is determined.
+type Kind int
+
+// Field describes a single element of a command message.
+type Field struct {
+	// Name identifies the field in the parsed Message.
+	Name string
+	// Kind selects the parsing strategy.
+	Kind Kind
+	// Length is the fixed length for KindFixed, the unprefixed key length for
+	// KindKey and the maximum length for KindDelimited (0 means unbounded).
+	Length int
+	// MinLength is the minimum length for KindDelimited and KindRemainder fields.
+	MinLength int
+	// Encoding restricts the characters accepted in the field.
+	Encoding Encoding
+	// Delimiter terminates a KindDelimited field; it is consumed but not stored.
+	Delimiter byte
+	// Schemes lists the key scheme tags accepted as a prefix for KindKey fields.
+	Schemes string
+	// Optional marks a field that may be absent. Optional fixed fields are
+	// present only when Present reports true for the remaining input.
+	Optional bool
+	// Present decides whether an optional field is present at the current position.
+	Present func(rest []byte) bool
+}
+
+// Spec is the declarative layout of a command message.
+type Spec struct {
+	// Command is the two-character command code, used in error messages.
+	Command string
+	// Fields lists the message fields in wire order.
+	Fields []Field
+	// AllowTrailing permits unparsed bytes after the last field.
+	AllowTrailing bool
+}
+
+// Value holds a parsed field.
+type Value struct {
+	// Data is the raw field content without scheme prefix or delimiter.
+	Data string
+	// Scheme is the key scheme tag for KindKey fields, or zero if unprefixed.
+	Scheme byte
+	// Offset is the position of the field within the input.
+	Offset int
+}
+
+// Message is the result of parsing an input against a Spec.
+type Message struct {
+	values map[string]Value
+	rest   []byte
+}
+
+// FieldError reports a parse failure for a specific field.
+type FieldError struct {
+	Command string
+	Field   string
+	Offset  int
+	Err     error
+}
+
+// Error implements the error interface.
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: field %s at offset %d: %v", e.Command, e.Field, e.Offset, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// Fixed returns a mandatory fixed length field.
+func Fixed(name string, length int, enc Encoding) Field {
+	return Field{Name: name, Kind: KindFixed, Length: length, Encoding: enc}
+}
+
+// Key returns a key field that accepts one of the given scheme prefixes or,
+// without a prefix, an unprefixed hex key of defaultLength characters.
+func Key(name, schemes string, defaultLength int) Field {
+	return Field{
+		Name:     name,
+		Kind:     KindKey,
+		Length:   defaultLength,
+		Encoding: EncodingHex,
+		Schemes:  schemes,
+	}
+}
+
+// Delimited returns a field terminated by delim with a length between minLen and maxLen.
+func Delimited(name string, delim byte, minLen, maxLen int, enc Encoding) Field {
+	return Field{
+		Name:      name,
+		Kind:      KindDelimited,
+		Length:    maxLen,
+		MinLength: minLen,
+		Encoding:  enc,
+		Delimiter: delim,
+	}
+}
+
+// Remainder returns a field that consumes the rest of the input.
+func Remainder(name string, minLen int, enc Encoding) Field {
+	return Field{Name: name, Kind: KindRemainder, MinLength: minLen, Encoding: enc}
+}
+
+// KeySchemeLength returns the number of hex characters that follow a key scheme tag.
+func KeySchemeLength(scheme byte) int {
+	return 2 * keyschemes.Length(scheme)
+}
+
+// Parse validates data against the spec and returns the parsed message.
+func (s Spec) Parse(data []byte) (*Message, error) {
+	msg := &Message{values: make(map[string]Value, len(s.Fields))}
+	pos := 0
+
+	for _, f := range s.Fields {
+		rest := data[pos:]
+		if f.Optional && (len(rest) == 0 || (f.Present != nil && !f.Present(rest))) {
+			continue
+		}
+
+		v, n, err := parseField(f, rest)
+		if err != nil {
+			return nil, &FieldError{Command: s.Command, Field: f.Name, Offset: pos, Err: err}
+		}
+		v.Offset = pos
+		msg.values[f.Name] = v
+		pos += n
+	}
+
+	msg.rest = data[pos:]
+	if len(msg.rest) > 0 && !s.AllowTrailing {
+		return nil, &FieldError{Command: s.Command, Field: "", Offset: pos, Err: ErrTrailingData}
+	}
+
+	return msg, nil
+}
+
+// MinLength returns the minimum message length accepted by the spec.
+func (s Spec) MinLength() int {
+	total := 0
+	for _, f := range s.Fields {
+		if f.Optional {
+			continue
+		}
+		switch f.Kind {
+		case KindFixed, KindKey:
+			total += f.Length
+		case KindDelimited:
+			total += f.MinLength + 1
+		case KindRemainder:
+			total += f.MinLength
+		}
+	}
+
+	return total
+}
+
+// Get returns the data of a field, or an empty string if it is absent.
+func (m *Message) Get(name string) string {
+	return m.values[name].Data
+}
+
+// Value returns the parsed value of a field and whether it was present.
+func (m *Message) Value(name string) (Value, bool) {
+	v, ok := m.values[name]
+
+	return v, ok
+}
+
+// Has reports whether a field was present in the input.
+func (m *Message) Has(name string) bool {
+	_, ok := m.values[name]
+
+	return ok
+}
+
+// Rest returns unparsed trailing bytes when the spec allows them.
+func (m *Message) Rest() []byte {
+	return m.rest
+}
+
+func parseField(f Field, rest []byte) (Value, int, error) {
+	switch f.Kind {
+	case KindFixed:
+		if len(rest) < f.Length {
+			return Value{}, 0, ErrTooShort
+		}
+		raw := rest[:f.Length]
+		if !validEncoding(raw, f.Encoding) {
+			return Value{}, 0, ErrInvalidEncoding
+		}
+
+		return Value{Data: string(raw)}, f.Length, nil
+	case KindKey:
+		return parseKey(f, rest)
+	case KindDelimited:
+		idx := strings.IndexByte(string(rest), f.Delimiter)
+		if idx < 0 {
+			return Value{}, 0, ErrMissingDelimiter
+		}
+		if idx < f.MinLength || (f.Length > 0 && idx > f.Length) {
+			return Value{}, 0, ErrInvalidLength
+		}
+		raw := rest[:idx]
+		if !validEncoding(raw, f.Encoding) {
+			return Value{}, 0, ErrInvalidEncoding
+		}
+
+		return Value{Data: string(raw)}, idx + 1, nil
+	case KindRemainder:
+		if len(rest) < f.MinLength {
+			return Value{}, 0, ErrTooShort
+		}
+		if !validEncoding(rest, f.Encoding) {
+			return Value{}, 0, ErrInvalidEncoding
+		}
+
+		return Value{Data: string(rest)}, len(rest), nil
+	default:
+		return Value{}, 0, fmt.Errorf("unsupported field kind %d", f.Kind)
+	}
+}
+
+func parseKey(f Field, rest []byte) (Value, int, error) {
+	key, tail, err := keyschemes.Parse(rest, f.Schemes, f.Length)
+	switch {
+	case errors.Is(err, keyschemes.ErrTooShort):
+		return Value{}, 0, ErrTooShort
+	case errors.Is(err, keyschemes.ErrInvalidKey):
+		return Value{}, 0, ErrInvalidEncoding
+	case err != nil:
+		return Value{}, 0, ErrInvalidLength
+	}
+
+	return Value{Data: key.Text, Scheme: key.Scheme}, len(rest) - len(tail), nil
+}
+
+func validEncoding(data []byte, enc Encoding) bool {
+	for _, c := range data {
+		switch enc {
+		case EncodingHex:
+			if !isHex(c) {
+				return false
+			}
+		case EncodingNumeric:
+			if c < '0' || c > '9' {
+				return false
+			}
+		case EncodingAlphanumeric:
+			if !isAlnum(c) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'A' && c <= 'F') || (c >= 'a' && c <= 'f')
+}
+
+func isAlnum(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
+}
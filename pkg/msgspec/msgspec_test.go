@@ -0,0 +1,154 @@
+package msgspec
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSpecParse(t *testing.T) {
+	t.Parallel()
+
+	spec := Spec{
+		Command: "XX",
+		Fields: []Field{
+			Key("key", "UT", 16),
+			Fixed("format", 2, EncodingNumeric),
+			Delimited("pan", ';', 12, 19, EncodingNumeric),
+			Remainder("data", 1, EncodingAny),
+		},
+	}
+
+	tests := []struct {
+		name       string
+		input      string
+		wantErr    error
+		wantKey    string
+		wantScheme byte
+		wantPan    string
+		wantData   string
+	}{
+		{
+			name:       "double length key with scheme",
+			input:      "U0123456789ABCDEF0123456789ABCDEF011234567890123;X",
+			wantKey:    "0123456789ABCDEF0123456789ABCDEF",
+			wantScheme: 'U',
+			wantPan:    "1234567890123",
+			wantData:   "X",
+		},
+		{
+			name:     "single length key without scheme",
+			input:    "0123456789ABCDEF01123456789012;ZZ",
+			wantKey:  "0123456789ABCDEF",
+			wantPan:  "123456789012",
+			wantData: "ZZ",
+		},
+		{
+			name:    "truncated key",
+			input:   "T0123456789ABCDEF",
+			wantErr: ErrTooShort,
+		},
+		{
+			name:    "non hex key",
+			input:   "0123456789ABCDEG01123456789012;X",
+			wantErr: ErrInvalidEncoding,
+		},
+		{
+			name:    "non numeric format",
+			input:   "0123456789ABCDEFA1123456789012;X",
+			wantErr: ErrInvalidEncoding,
+		},
+		{
+			name:    "missing delimiter",
+			input:   "0123456789ABCDEF01123456789012X",
+			wantErr: ErrMissingDelimiter,
+		},
+		{
+			name:    "pan too short",
+			input:   "0123456789ABCDEF0112345;X",
+			wantErr: ErrInvalidLength,
+		},
+		{
+			name:    "missing remainder",
+			input:   "0123456789ABCDEF01123456789012;",
+			wantErr: ErrTooShort,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			msg, err := spec.Parse([]byte(tc.input))
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			key, ok := msg.Value("key")
+			if !ok {
+				t.Fatal("expected key field to be present")
+			}
+			if key.Data != tc.wantKey || key.Scheme != tc.wantScheme {
+				t.Errorf("key = %q/%q, want %q/%q", key.Data, key.Scheme, tc.wantKey, tc.wantScheme)
+			}
+			if got := msg.Get("pan"); got != tc.wantPan {
+				t.Errorf("pan = %q, want %q", got, tc.wantPan)
+			}
+			if got := msg.Get("data"); got != tc.wantData {
+				t.Errorf("data = %q, want %q", got, tc.wantData)
+			}
+		})
+	}
+}
+
+func TestSpecParseOptionalAndTrailing(t *testing.T) {
+	t.Parallel()
+
+	spec := Spec{
+		Command: "XX",
+		Fields: []Field{
+			Fixed("a", 2, EncodingAlphanumeric),
+			{
+				Name:     "flag",
+				Kind:     KindFixed,
+				Length:   2,
+				Encoding: EncodingAny,
+				Optional: true,
+				Present:  func(rest []byte) bool { return rest[0] == '%' },
+			},
+		},
+	}
+
+	msg, err := spec.Parse([]byte("AB%0"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !msg.Has("flag") || msg.Get("flag") != "%0" {
+		t.Errorf("expected optional flag to be parsed, got %q", msg.Get("flag"))
+	}
+
+	msg, err = spec.Parse([]byte("AB"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if msg.Has("flag") {
+		t.Error("expected optional flag to be absent")
+	}
+
+	_, err = spec.Parse([]byte("AB12"))
+	var fe *FieldError
+	if !errors.As(err, &fe) || !errors.Is(err, ErrTrailingData) || fe.Offset != 2 {
+		t.Errorf("expected trailing data error at offset 2, got %v", err)
+	}
+
+	if got := spec.MinLength(); got != 2 {
+		t.Errorf("MinLength() = %d, want 2", got)
+	}
+}
@@ -0,0 +1,90 @@
+package msgspec
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Delimiters that introduce optional trailing fields of Thales host commands.
+const (
+	// DelimKeySchemes introduces key scheme and check value type fields.
+	DelimKeySchemes byte = ';'
+	// DelimLMKID introduces the 2 digit LMK identifier.
+	DelimLMKID byte = '%'
+	// DelimKeyBlock introduces key block related fields.
+	DelimKeyBlock byte = '&'
+	// DelimKeyBlockHeader introduces the key block attributes of a key under a key block
+	// LMK.
+	DelimKeyBlockHeader byte = '#'
+	// DelimExtension introduces vendor extension fields.
+	DelimExtension byte = '!'
+)
+
+// ErrDuplicateDelimiter is returned when a delimiter-tagged field occurs twice.
+var ErrDuplicateDelimiter = errors.New("duplicate delimited field")
+
+// Tagged is an optional field introduced by a delimiter.
+type Tagged struct {
+	// Delimiter is the character that introduced the field.
+	Delimiter byte
+	// Data is the field content up to the next delimiter, without the delimiter.
+	Data []byte
+	// Offset is the position of the delimiter within the tokenized input.
+	Offset int
+}
+
+// Tokens is a message tail split into its positional part and delimiter-tagged fields.
+type Tokens struct {
+	// Positional holds the bytes before the first delimiter.
+	Positional []byte
+	// Tagged lists the delimiter-tagged fields in input order.
+	Tagged []Tagged
+}
+
+// Tokenize splits data at the delimiters in delims. The bytes before the first delimiter
+// are positional; every delimiter starts a tagged field that runs to the next delimiter.
+// Each delimiter may occur once. Fields such as binary data that may contain delimiter
+// characters must be parsed before tokenizing the rest of the message.
+func Tokenize(data []byte, delims string) (*Tokens, error) {
+	t := &Tokens{}
+	start := -1
+	for i := 0; i <= len(data); i++ {
+		if i < len(data) && strings.IndexByte(delims, data[i]) < 0 {
+			continue
+		}
+		if start < 0 {
+			t.Positional = data[:i]
+		} else {
+			t.Tagged[len(t.Tagged)-1].Data = data[start+1 : i]
+		}
+		if i == len(data) {
+			break
+		}
+		if t.Has(data[i]) {
+			return nil, fmt.Errorf("%w %q at offset %d", ErrDuplicateDelimiter, data[i], i)
+		}
+		t.Tagged = append(t.Tagged, Tagged{Delimiter: data[i], Offset: i})
+		start = i
+	}
+
+	return t, nil
+}
+
+// Field returns the data of the field introduced by delim and whether it is present.
+func (t *Tokens) Field(delim byte) ([]byte, bool) {
+	for _, f := range t.Tagged {
+		if f.Delimiter == delim {
+			return f.Data, true
+		}
+	}
+
+	return nil, false
+}
+
+// Has reports whether the field introduced by delim is present.
+func (t *Tokens) Has(delim byte) bool {
+	_, ok := t.Field(delim)
+
+	return ok
+}
@@ -0,0 +1,56 @@
+package msgspec
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	t.Parallel()
+
+	tok, err := Tokenize([]byte("U0123;ZU1%01&N"), ";%&!")
+	if err != nil {
+		t.Fatalf("Tokenize() error = %v", err)
+	}
+	if string(tok.Positional) != "U0123" || len(tok.Tagged) != 3 {
+		t.Fatalf("Tokenize() = %q %+v", tok.Positional, tok.Tagged)
+	}
+	for _, tc := range []struct {
+		delim  byte
+		data   string
+		offset int
+	}{
+		{DelimKeySchemes, "ZU1", 5},
+		{DelimLMKID, "01", 9},
+		{DelimKeyBlock, "N", 12},
+	} {
+		data, ok := tok.Field(tc.delim)
+		if !ok || string(data) != tc.data {
+			t.Errorf("Field(%c) = %q, %v, want %q", tc.delim, data, ok, tc.data)
+		}
+	}
+	if tok.Tagged[1].Offset != 9 {
+		t.Errorf("offset of %% field = %d", tok.Tagged[1].Offset)
+	}
+	if tok.Has(DelimExtension) {
+		t.Error("Has(!) = true for an absent field")
+	}
+
+	// Only the given delimiters split; an empty tail has no fields.
+	tok, err = Tokenize([]byte("AB%01"), ";")
+	if err != nil || string(tok.Positional) != "AB%01" || len(tok.Tagged) != 0 {
+		t.Errorf("Tokenize() with other delimiters = %+v, %v", tok, err)
+	}
+	tok, err = Tokenize(nil, ";%")
+	if err != nil || len(tok.Positional) != 0 || len(tok.Tagged) != 0 {
+		t.Errorf("Tokenize(nil) = %+v, %v", tok, err)
+	}
+	tok, err = Tokenize([]byte(";%"), ";%")
+	if err != nil || !tok.Has(';') || !tok.Has('%') {
+		t.Errorf("Tokenize() of empty fields = %+v, %v", tok, err)
+	}
+
+	if _, err := Tokenize([]byte("A%01%02"), ";%"); !errors.Is(err, ErrDuplicateDelimiter) {
+		t.Errorf("Tokenize() duplicate error = %v, want ErrDuplicateDelimiter", err)
+	}
+}
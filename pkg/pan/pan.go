@@ -0,0 +1,152 @@
+// Package pan provides primary account number (PAN) utilities: Luhn check digits, masking
+// for logs and the account number extractions used by PIN blocks and host commands.
+package pan
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// AccountNumberLength is the number of PAN digits in the account number of host commands.
+const AccountNumberLength = 12
+
+var (
+	// ErrNoDigits indicates a PAN without any decimal digits.
+	ErrNoDigits = errors.New("pan contains no processable digits")
+	// ErrInvalidLength indicates a PAN with too few digits for the requested extraction.
+	ErrInvalidLength = errors.New("invalid pan length")
+	// ErrCheckDigit indicates a PAN whose last digit is not its Luhn check digit.
+	ErrCheckDigit = errors.New("pan check digit mismatch")
+)
+
+// Digits returns the decimal digits of pan, dropping separators such as spaces and dashes.
+func Digits(pan string) string {
+	var b strings.Builder
+	for i := 0; i < len(pan); i++ {
+		if pan[i] >= '0' && pan[i] <= '9' {
+			b.WriteByte(pan[i])
+		}
+	}
+
+	return b.String()
+}
+
+// CheckDigit calculates the Luhn (mod 10) check digit to append to the digits of partial.
+func CheckDigit(partial string) (byte, error) {
+	if partial == "" {
+		return 0, ErrNoDigits
+	}
+
+	sum := 0
+	double := true
+	for i := len(partial) - 1; i >= 0; i-- {
+		c := partial[i]
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("pan contains non-digit %q", c)
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+
+	return byte('0' + (10-sum%10)%10), nil
+}
+
+// Validate checks that pan consists of at least two digits, the last of which is the Luhn
+// check digit of the others.
+func Validate(pan string) error {
+	if len(pan) < 2 {
+		return fmt.Errorf("%w: %d digits", ErrInvalidLength, len(pan))
+	}
+	want, err := CheckDigit(pan[:len(pan)-1])
+	if err != nil {
+		return err
+	}
+	if pan[len(pan)-1] != want {
+		return ErrCheckDigit
+	}
+
+	return nil
+}
+
+// Valid reports whether pan passes the Luhn check.
+func Valid(pan string) bool {
+	return Validate(pan) == nil
+}
+
+// Mask hides the digits of pan for logging. PANs of 13 digits or more keep the first six
+// and last four digits, as permitted by PCI DSS; shorter values keep at most the last four
+// and at least half of the value is hidden.
+func Mask(pan string) string {
+	keepLeft, keepRight := 0, min(4, len(pan)/2)
+	if len(pan) >= 13 {
+		keepLeft = 6
+	}
+
+	b := []byte(pan)
+	for i := keepLeft; i < len(b)-keepRight; i++ {
+		if b[i] >= '0' && b[i] <= '9' {
+			b[i] = '*'
+		}
+	}
+
+	return string(b)
+}
+
+// Leftmost12 returns the 12 leftmost digits of pan.
+func Leftmost12(pan string) (string, error) {
+	digits, err := digitsOf(pan)
+	if err != nil {
+		return "", err
+	}
+	if len(digits) < AccountNumberLength {
+		return "", fmt.Errorf("%w: %d digits", ErrInvalidLength, len(digits))
+	}
+
+	return digits[:AccountNumberLength], nil
+}
+
+// AccountNumber returns the 12 rightmost digits of pan excluding the check digit, as used
+// in ISO 9564 format 0 PIN blocks and Thales host commands.
+func AccountNumber(pan string) (string, error) {
+	digits, err := digitsOf(pan)
+	if err != nil {
+		return "", err
+	}
+	if len(digits) < AccountNumberLength+1 {
+		return "", fmt.Errorf("%w: %d digits", ErrInvalidLength, len(digits))
+	}
+
+	return digits[len(digits)-AccountNumberLength-1 : len(digits)-1], nil
+}
+
+// Rightmost11WithCheckDigit returns the 11 rightmost digits of pan excluding the check
+// digit, followed by the check digit, as used in VISA-1 PIN blocks.
+func Rightmost11WithCheckDigit(pan string) (string, error) {
+	digits, err := digitsOf(pan)
+	if err != nil {
+		return "", err
+	}
+	if len(digits) < 12 {
+		return "", fmt.Errorf("%w: %d digits", ErrInvalidLength, len(digits))
+	}
+
+	return digits[len(digits)-12:], nil
+}
+
+// digitsOf returns the digits of pan, failing when there are none.
+func digitsOf(pan string) (string, error) {
+	digits := Digits(pan)
+	if digits == "" {
+		return "", ErrNoDigits
+	}
+
+	return digits, nil
+}
@@ -0,0 +1,96 @@
+package pan
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLuhn(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		partial string
+		check   byte
+	}{
+		{"7992739871", '3'},
+		{"400000000000000", '2'},
+		{"411111111111111", '1'},
+		{"555555555555444", '4'},
+		{"0", '0'},
+	}
+	for _, tc := range tests {
+		got, err := CheckDigit(tc.partial)
+		if err != nil || got != tc.check {
+			t.Errorf("CheckDigit(%s) = %c, %v, want %c", tc.partial, got, err, tc.check)
+		}
+		if err := Validate(tc.partial + string(tc.check)); err != nil {
+			t.Errorf("Validate(%s%c) = %v", tc.partial, tc.check, err)
+		}
+	}
+
+	if !Valid("4111111111111111") || Valid("4111111111111112") {
+		t.Error("Valid() misjudged a test card number")
+	}
+	if err := Validate("4111111111111112"); !errors.Is(err, ErrCheckDigit) {
+		t.Errorf("Validate() = %v, want ErrCheckDigit", err)
+	}
+	if err := Validate("4"); !errors.Is(err, ErrInvalidLength) {
+		t.Errorf("Validate(4) = %v, want ErrInvalidLength", err)
+	}
+	if err := Validate("4111-1111"); err == nil {
+		t.Error("expected error for a non-digit")
+	}
+	if _, err := CheckDigit(""); !errors.Is(err, ErrNoDigits) {
+		t.Errorf("CheckDigit(\"\") = %v, want ErrNoDigits", err)
+	}
+}
+
+func TestMask(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"4111111111111111":    "411111******1111",
+		"4000001234567899":    "400000******7899",
+		"1234567890123":       "123456***0123",
+		"4111-1111-1111-1111": "4111-1***-****-1111",
+		"123456789012":        "********9012",
+		"1234":                "**34",
+		"":                    "",
+	}
+	for in, want := range tests {
+		if got := Mask(in); got != want {
+			t.Errorf("Mask(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestExtraction(t *testing.T) {
+	t.Parallel()
+
+	const card = "4000001234567899"
+	if got, err := AccountNumber(card); err != nil || got != "000123456789" {
+		t.Errorf("AccountNumber() = %s, %v", got, err)
+	}
+	if got, err := AccountNumber("4000-0012-3456-7899"); err != nil || got != "000123456789" {
+		t.Errorf("AccountNumber() with separators = %s, %v", got, err)
+	}
+	if got, err := Leftmost12(card); err != nil || got != "400000123456" {
+		t.Errorf("Leftmost12() = %s, %v", got, err)
+	}
+	if got, err := Rightmost11WithCheckDigit(card); err != nil || got != "001234567899" {
+		t.Errorf("Rightmost11WithCheckDigit() = %s, %v", got, err)
+	}
+
+	if _, err := AccountNumber("123456789012"); !errors.Is(err, ErrInvalidLength) {
+		t.Errorf("AccountNumber(12 digits) = %v, want ErrInvalidLength", err)
+	}
+	if _, err := Leftmost12("12345"); !errors.Is(err, ErrInvalidLength) {
+		t.Errorf("Leftmost12(5 digits) = %v, want ErrInvalidLength", err)
+	}
+	if _, err := Rightmost11WithCheckDigit("abc"); !errors.Is(err, ErrNoDigits) {
+		t.Errorf("Rightmost11WithCheckDigit(abc) = %v, want ErrNoDigits", err)
+	}
+	if got := Digits(" 4000-0012 "); got != "40000012" {
+		t.Errorf("Digits() = %s", got)
+	}
+}
@@ -15,19 +15,7 @@ func encodeISO0(pin, pan string) (string, error) {
 		pinBlock1Str += "F" // Specification: pad character (hexadecimal F)
 	}
 
-	if pan == "" {
-		return "", errPanRequired
-	}
-	panDigits := ""
-	for _, r := range pan {
-		if r >= '0' && r <= '9' {
-			panDigits += string(r)
-		}
-	}
 	// pan can be provided as 12 right-most digits excluding  check digit.
-	if len(panDigits) < 12 {
-		return "", errInvalidPanLength
-	}
 	relevantPan, err := get12PanDigits(pan, false) // false for fromRight.
 	if err != nil {
 		return "", err
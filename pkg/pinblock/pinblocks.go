@@ -6,6 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+
+	"github.com/andrei-cloud/go_hsm/pkg/pan"
 )
 
 // Supported PIN block formats.
@@ -38,12 +40,12 @@ const (
 
 var (
 	errInvalidPinLength      = errors.New("invalid pin length")
-	errInvalidPanLength      = errors.New("invalid pan length")
+	errInvalidPanLength      = pan.ErrInvalidLength
 	errInvalidPinBlockLength = errors.New("invalid pin block length")
 	errInvalidPinBlockFormat = errors.New("unsupported or invalid pin block format")
 	errPinBlockDecoding      = errors.New("pin block decoding failed")
 	errPanRequired           = errors.New("pan is required for this pin block format")
-	errPanNoDigits           = errors.New("pan contains no processable digits")
+	errPanNoDigits           = pan.ErrNoDigits
 	errInternalEncoding      = errors.New("internal error during encoding")
 	errInternalDecoding      = errors.New("internal error during decoding")
 	errFormatNotImplemented  = errors.New("pin block format not implemented")
@@ -2,21 +2,64 @@
 package pinblock
 
 import (
-	"crypto/rand"
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
+	"io"
+	"math/rand/v2"
 	"strings"
+	"sync/atomic"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
+	"github.com/andrei-cloud/go_hsm/pkg/pan"
 )
 
+// randomSource holds the reader installed with SetRandomSource.
+var randomSource atomic.Pointer[io.Reader]
+
+// SetRandomSource replaces the random source of PIN block padding and fill digits (ISO
+// formats 1 and 3) with r, so golden tests can produce stable PIN blocks. nil restores the
+// default crypto provider. It must not be used outside tests: predictable padding weakens
+// the PIN blocks.
+func SetRandomSource(r io.Reader) {
+	if r == nil {
+		randomSource.Store(nil)
+
+		return
+	}
+	randomSource.Store(&r)
+}
+
+// NewSeededSource returns a deterministic random source for SetRandomSource that yields
+// the same bytes for the same seed.
+func NewSeededSource(seed uint64) io.Reader {
+	var key [32]byte
+	binary.BigEndian.PutUint64(key[:], seed)
+
+	return rand.NewChaCha8(key)
+}
+
+// readRandom fills b from the installed random source or the default crypto provider.
+func readRandom(b []byte) error {
+	if r := randomSource.Load(); r != nil {
+		_, err := io.ReadFull(*r, b)
+
+		return err
+	}
+	_, err := cryptoprovider.Read(b)
+
+	return err
+}
+
 // GetRandomHexDigit returns a random hex digit (0-F).
 func GetRandomHexDigit() string {
 	b := make([]byte, 1)
-	_, err := rand.Read(b)
+	err := readRandom(b)
 	if err != nil {
 		// Fallback to a pseudo-random digit if crypto/rand fails, though this is unlikely.
 		// In a real scenario, this error should be handled more robustly.
 		// For HSM operations, cryptographic randomness is critical.
-		// Consider panicking or returning a clear error if rand.Read fails.
+		// Consider panicking or returning a clear error if the random source fails.
 		return "0" // Or handle error appropriately.
 	}
 
@@ -26,7 +69,7 @@ func GetRandomHexDigit() string {
 // GetRandomHexDigitAF returns a random hex digit (A-F).
 func GetRandomHexDigitAF() string {
 	b := make([]byte, 1)
-	_, err := rand.Read(b)
+	err := readRandom(b)
 	if err != nil {
 		// Fallback if crypto/rand fails.
 		return "A" // Or handle error appropriately.
@@ -38,37 +81,16 @@ func GetRandomHexDigitAF() string {
 // getVisa1PanComponent extracts the PAN component for VISA1 format.
 // It takes the 11 rightmost digits of the PAN (excluding the check digit)
 // and appends the check digit itself.
-func getVisa1PanComponent(pan string) (string, error) {
-	panDigits := ""
-	for _, r := range pan {
-		if r >= '0' && r <= '9' {
-			panDigits += string(r)
-		}
-	}
-
-	// VISA1 requires at least 11 digits for the main part + 1 check digit.
-	if len(panDigits) < 12 {
+func getVisa1PanComponent(panNumber string) (string, error) {
+	component, err := pan.Rightmost11WithCheckDigit(panNumber)
+	if err != nil {
 		return "", fmt.Errorf(
 			"%w: pan must contain at least 12 digits for visa1 format",
 			errInvalidPanLength,
 		)
 	}
 
-	checkDigit := string(panDigits[len(panDigits)-1])
-	panWithoutCheckDigit := panDigits[:len(panDigits)-1]
-
-	if len(panWithoutCheckDigit) < 11 {
-		// This case should ideally be caught by the len(panDigits) < 12 check,
-		// but it's good for robustness.
-		return "", fmt.Errorf(
-			"%w: pan (after excluding check digit) must contain at least 11 digits for visa1 format",
-			errInvalidPanLength,
-		)
-	}
-
-	elevenRightmost := panWithoutCheckDigit[len(panWithoutCheckDigit)-11:]
-
-	return elevenRightmost + checkDigit, nil
+	return component, nil
 }
 
 // Helper to XOR two hex strings. Result is uppercase hex.
@@ -102,43 +124,17 @@ func xorHexStrings(s1, s2 string) (string, error) {
 // If fromLeft is true, returns the leftmost 12 digits.
 // If fromLeft is false, returns the rightmost 12 digits excluding check digit.
 // Accepts pans already provided as 12 digits excluding check digit.
-func get12PanDigits(pan string, fromLeft bool) (string, error) {
-	if pan == "" {
+func get12PanDigits(panNumber string, fromLeft bool) (string, error) {
+	if panNumber == "" {
 		return "", errPanRequired
 	}
-	panDigits := ""
-	for _, r := range pan {
-		if r >= '0' && r <= '9' {
-			panDigits += string(r)
-		}
-	}
-
-	if len(panDigits) == 12 {
-		return panDigits, nil
-	}
-
-	if panDigits == "" {
-		return "", errPanNoDigits
-	}
-
-	// For ISO0, we need at least 13 digits to extract 12 rightmost excluding check digit.
-	if !fromLeft && len(panDigits) < 13 {
-		return "", errInvalidPanLength
-	}
-
-	if len(panDigits) < 12 {
-		return "", errInvalidPanLength
+	if digits := pan.Digits(panNumber); len(digits) == pan.AccountNumberLength {
+		return digits, nil
 	}
 
 	if fromLeft {
-		return panDigits[:12], nil
-	}
-
-	// For rightmost extraction, we need at least 13 digits to get 12 rightmost excluding check digit.
-	panWithoutCheckDigit := panDigits[:len(panDigits)-1]
-	if len(panWithoutCheckDigit) < 12 {
-		return "", errInvalidPanLength
+		return pan.Leftmost12(panNumber)
 	}
 
-	return panWithoutCheckDigit[len(panWithoutCheckDigit)-12:], nil
+	return pan.AccountNumber(panNumber)
 }
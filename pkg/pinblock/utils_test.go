@@ -0,0 +1,37 @@
+// nolint:all // test package
+package pinblock
+
+import (
+	"testing"
+)
+
+// TestSetRandomSource verifies that a seeded source makes ISO 1 and ISO 3 PIN blocks stable.
+// It does not run in parallel because it replaces the package random source.
+func TestSetRandomSource(t *testing.T) {
+	t.Cleanup(func() { SetRandomSource(nil) })
+
+	for _, format := range []PinBlockFormat{ISO1, ISO3} {
+		encode := func(seed uint64) string {
+			SetRandomSource(NewSeededSource(seed))
+			block, err := EncodePinBlock("1234", "4111111111111111", format)
+			if err != nil {
+				t.Fatalf("EncodePinBlock(%v) failed: %v", format, err)
+			}
+
+			return block
+		}
+
+		first, second := encode(42), encode(42)
+		if first != second {
+			t.Errorf("format %v: same seed gave %s and %s", format, first, second)
+		}
+		if other := encode(7); other == first {
+			t.Errorf("format %v: different seeds gave the same block %s", format, first)
+		}
+
+		pin, err := DecodePinBlock(first, "4111111111111111", format)
+		if err != nil || pin != "1234" {
+			t.Errorf("format %v: DecodePinBlock(%s) = %q, %v", format, first, pin, err)
+		}
+	}
+}
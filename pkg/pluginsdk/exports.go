@@ -0,0 +1,46 @@
+//go:build tinygo.wasm
+
+package pluginsdk
+
+import "github.com/andrei-cloud/go_hsm/pkg/hsmplugin"
+
+// The exports of plugin ABI v2, see hsmplugin.ABIv2.
+
+//export version
+func version() (uint32, uint32) {
+	return hsmplugin.ToBuffer([]byte(info.Version)).AddressSize()
+}
+
+//export description
+func description() (uint32, uint32) {
+	return hsmplugin.ToBuffer([]byte(info.Description)).AddressSize()
+}
+
+//export author
+func author() (uint32, uint32) {
+	return hsmplugin.ToBuffer([]byte(info.Author)).AddressSize()
+}
+
+//export Alloc
+func alloc(size uint32) uint32 {
+	ptr, _ := hsmplugin.Alloc(size).AddressSize()
+
+	return ptr
+}
+
+//export Execute
+func executeExport(ptr, size uint32) (uint32, uint32, uint32) {
+	in, err := hsmplugin.ReadExecuteInput(hsmplugin.Buffer(hsmplugin.PackResult(ptr, size)))
+	// Release memory from the previous call; the input has been copied out.
+	hsmplugin.ResetArena()
+	if err != nil {
+		return hsmplugin.ErrorResult(err)
+	}
+
+	out, err := execute(in)
+	if err != nil {
+		return hsmplugin.ErrorResult(err)
+	}
+
+	return hsmplugin.Result(out)
+}
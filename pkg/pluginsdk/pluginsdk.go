@@ -0,0 +1,153 @@
+// Package pluginsdk is the API for writing go_hsm command plugins in Go. A plugin registers
+// the handler of its command and its metadata, and the package provides the exports of plugin
+// ABI v2, the guest memory management, logging and the HSM host functions:
+//
+//	package main
+//
+//	import "github.com/andrei-cloud/go_hsm/pkg/pluginsdk"
+//
+//	func init() {
+//		pluginsdk.SetInfo(pluginsdk.Info{Version: "1.0.0", Description: "Echo", Author: "ACME"})
+//		pluginsdk.RegisterCommand(func(input []byte) ([]byte, error) {
+//			if len(input) == 0 {
+//				return nil, pluginsdk.NewError("15", "no input")
+//			}
+//
+//			return append([]byte("ZZ00"), input...), nil
+//		})
+//	}
+//
+//	func main() {}
+//
+// Build the plugin with TinyGo for GOOS=wasip1 GOARCH=wasm and install it as <CMD>.wasm in
+// the plugin directory. The handler gets the command payload after the command code and
+// returns the whole response, response code and error code included; a returned error is
+// turned into the error response of the command by the host. Memory the handler gets or
+// returns is managed by the SDK: guest memory handed to the host is allocated from an arena
+// that is released at the start of the next command, so handlers never deal in pointers.
+package pluginsdk
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/andrei-cloud/go_hsm/internal/errorcodes"
+	"github.com/andrei-cloud/go_hsm/pkg/hsmplugin"
+)
+
+// Handler executes a command. It receives the payload of the request after the command code
+// and returns the response.
+type Handler func(input []byte) ([]byte, error)
+
+// Info is the metadata of a plugin, reported by the version, description and author exports.
+type Info struct {
+	Version     string
+	Description string
+	Author      string
+}
+
+// ErrNoHandler is returned for commands executed before RegisterCommand is called.
+var ErrNoHandler = errors.New("no command handler registered")
+
+var (
+	handler Handler
+	info    Info
+)
+
+// RegisterCommand registers the handler of the plugin's command, replacing any previous one.
+// Plugins call it from an init function.
+func RegisterCommand(h Handler) {
+	handler = h
+}
+
+// SetInfo sets the metadata of the plugin.
+func SetInfo(i Info) {
+	info = i
+}
+
+// NewError returns an error answered with the two character payShield error code and a
+// diagnostic detail, which the host strips from the response unless diagnostics are enabled.
+func NewError(code, detail string) error {
+	hsmErr := errorcodes.HSMError{Code: code, Description: detail}
+	if detail == "" {
+		return hsmErr
+	}
+
+	return errorcodes.WithDetail(hsmErr, detail)
+}
+
+// execute runs the registered handler on the input of an Execute call.
+func execute(input []byte) ([]byte, error) {
+	if handler == nil {
+		return nil, ErrNoHandler
+	}
+
+	return handler(input)
+}
+
+// LogDebugf, LogInfof and LogErrorf write a formatted message to the host log at their level.
+func LogDebugf(format string, args ...any) { hsmplugin.LogDebug(fmt.Sprintf(format, args...)) }
+
+func LogInfof(format string, args ...any) { hsmplugin.LogInfo(fmt.Sprintf(format, args...)) }
+
+func LogErrorf(format string, args ...any) { hsmplugin.LogError(fmt.Sprintf(format, args...)) }
+
+// EncryptUnderLMK encrypts a clear key of keyType under the LMK in the key scheme. For key
+// blocks (scheme S) keyType is the header template of the block.
+func EncryptUnderLMK(clearKey []byte, keyType string, scheme byte) ([]byte, error) {
+	return hsmplugin.EncryptUnderLMK(clearKey, keyType, scheme)
+}
+
+// DecryptUnderLMK decrypts a key of keyType encrypted under the LMK in the key scheme.
+func DecryptUnderLMK(encryptedKey []byte, keyType string, scheme byte) ([]byte, error) {
+	return hsmplugin.DecryptUnderLMK(encryptedKey, keyType, scheme)
+}
+
+// TranslateFromOldLMK translates a key of keyType from the old LMK to the current one.
+func TranslateFromOldLMK(encryptedKey []byte, keyType string, scheme byte) ([]byte, error) {
+	return hsmplugin.TranslateFromOldLMK(encryptedKey, keyType, scheme)
+}
+
+// RandomKey returns length random key bytes.
+func RandomKey(length int) ([]byte, error) {
+	return hsmplugin.RandomKey(length)
+}
+
+// WrapKeyBlock wraps a clear key in a key block with the attributes of template, the scheme
+// tag and 16 character header of a key block, under the key block LMK it names.
+func WrapKeyBlock(template, clearKey []byte) ([]byte, error) {
+	return hsmplugin.WrapKeyBlock(template, clearKey)
+}
+
+// UnwrapKeyBlock unwraps a key block and returns the clear key.
+func UnwrapKeyBlock(block []byte) ([]byte, error) {
+	return hsmplugin.UnwrapKeyBlock(block)
+}
+
+// LMKCheckValue returns the check value of the LMK registered under lmkID.
+func LMKCheckValue(lmkID string) ([]byte, error) {
+	return hsmplugin.LMKCheckValue(lmkID)
+}
+
+// EncodePinBlock returns the PIN block of pin and pan in the format of the Thales format code
+// as hex.
+func EncodePinBlock(pin, pan, formatCode string) (string, error) {
+	return hsmplugin.EncodePinBlock(pin, pan, formatCode)
+}
+
+// DecodePinBlock returns the PIN of a PIN block given as hex in the format of the Thales
+// format code.
+func DecodePinBlock(pinBlock, pan, formatCode string) (string, error) {
+	return hsmplugin.DecodePinBlock(pinBlock, pan, formatCode)
+}
+
+// VisaPVV returns the Visa PVV of pin for the account number (the 12 rightmost digits
+// excluding the check digit) under the clear pvk.
+func VisaPVV(pan, pvki, pin string, pvk []byte) (string, error) {
+	return hsmplugin.VisaPVV(pan, pvki, pin, pvk)
+}
+
+// VisaCVV returns the Visa CVV of a card under the clear double length cvk.
+func VisaCVV(pan, expDate, serviceCode string, cvk []byte) (string, error) {
+	return hsmplugin.VisaCVV(pan, expDate, serviceCode, cvk)
+}
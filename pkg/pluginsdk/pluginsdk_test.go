@@ -0,0 +1,56 @@
+package pluginsdk
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/pkg/hsmplugin"
+)
+
+// TestExecute replaces the registered handler, so it does not run in parallel.
+func TestExecute(t *testing.T) {
+	defer RegisterCommand(nil)
+
+	RegisterCommand(nil)
+	if _, err := execute([]byte("x")); !errors.Is(err, ErrNoHandler) {
+		t.Fatalf("execute() without a handler error = %v, want ErrNoHandler", err)
+	}
+
+	RegisterCommand(func(input []byte) ([]byte, error) {
+		if len(input) == 0 {
+			return nil, NewError("15", "no input")
+		}
+
+		return append([]byte("ZZ00"), input...), nil
+	})
+	out, err := execute([]byte("AB"))
+	if err != nil || string(out) != "ZZ00AB" {
+		t.Errorf("execute() = %q, %v, want ZZ00AB", out, err)
+	}
+
+	_, err = execute(nil)
+	if code, detail := hsmplugin.ErrorCode(err); code != "15" || detail != "no input" {
+		t.Errorf("ErrorCode() of the handler error = %q, %q, want 15, no input", code, detail)
+	}
+}
+
+func TestNewError(t *testing.T) {
+	t.Parallel()
+
+	if code, detail := hsmplugin.ErrorCode(NewError("24", "")); code != "24" || detail != "" {
+		t.Errorf("ErrorCode(NewError(24)) = %q, %q", code, detail)
+	}
+}
+
+// TestHostCallsOutsideWASM verifies the host calls fail cleanly without a host.
+func TestHostCallsOutsideWASM(t *testing.T) {
+	t.Parallel()
+
+	if _, err := RandomKey(16); err == nil {
+		t.Error("RandomKey() outside WASM succeeded")
+	}
+	if _, err := VisaCVV("4000001234562", "2512", "101", make([]byte, 16)); err == nil {
+		t.Error("VisaCVV() outside WASM succeeded")
+	}
+	LogInfof("dropped %d", 1)
+}
@@ -0,0 +1,222 @@
+// Package rsapub exports RSA public keys in the encodings host systems expect and signs the
+// exported keys, so hosts that only accept public keys signed by a trusted key (for example
+// an MK-KE or a dedicated signature key) can be tested.
+package rsapub
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
+)
+
+// Encoding is a public key export encoding.
+type Encoding string
+
+// Export encodings.
+const (
+	// EncodingDER is the PKCS#1 RSAPublicKey in DER, with two's complement integers. This is
+	// Thales public key encoding rule 02.
+	EncodingDER Encoding = "der"
+	// EncodingPEM is the X.509 SubjectPublicKeyInfo in a "PUBLIC KEY" PEM block.
+	EncodingPEM Encoding = "pem"
+	// EncodingThales is the PKCS#1 RSAPublicKey in DER with unsigned integers, without the
+	// leading zero byte that a modulus with its top bit set needs in DER. This is Thales
+	// public key encoding rule 01, used by the payShield host commands.
+	EncodingThales Encoding = "thales"
+)
+
+// pemType is the type of the PEM block of an exported public key.
+const pemType = "PUBLIC KEY"
+
+// ASN.1 tags of the RSAPublicKey structure.
+const (
+	tagInteger  = 0x02
+	tagSequence = 0x30
+)
+
+var (
+	// ErrUnknownEncoding indicates an unsupported export encoding.
+	ErrUnknownEncoding = errors.New("unknown public key encoding")
+	// ErrMalformedKey indicates exported data that does not hold an RSA public key.
+	ErrMalformedKey = errors.New("malformed rsa public key")
+)
+
+// ParseEncoding returns the encoding named s.
+func ParseEncoding(s string) (Encoding, error) {
+	switch e := Encoding(s); e {
+	case EncodingDER, EncodingPEM, EncodingThales:
+		return e, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnknownEncoding, s)
+	}
+}
+
+// Export encodes pub in the given encoding.
+func Export(pub *rsa.PublicKey, enc Encoding) ([]byte, error) {
+	if pub == nil || pub.N == nil || pub.E <= 0 {
+		return nil, ErrMalformedKey
+	}
+
+	switch enc {
+	case EncodingDER:
+		return x509.MarshalPKCS1PublicKey(pub), nil
+	case EncodingPEM:
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			return nil, err
+		}
+
+		return pem.EncodeToMemory(&pem.Block{Type: pemType, Bytes: der}), nil
+	case EncodingThales:
+		modulus := derElement(tagInteger, pub.N.Bytes())
+		exponent := derElement(tagInteger, big.NewInt(int64(pub.E)).Bytes())
+
+		return derElement(tagSequence, append(modulus, exponent...)), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownEncoding, enc)
+	}
+}
+
+// Import decodes a public key exported in the given encoding.
+func Import(data []byte, enc Encoding) (*rsa.PublicKey, error) {
+	switch enc {
+	case EncodingDER:
+		pub, err := x509.ParsePKCS1PublicKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMalformedKey, err)
+		}
+
+		return pub, nil
+	case EncodingPEM:
+		block, _ := pem.Decode(data)
+		if block == nil || block.Type != pemType {
+			return nil, fmt.Errorf("%w: no %s PEM block", ErrMalformedKey, pemType)
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMalformedKey, err)
+		}
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: not an RSA key", ErrMalformedKey)
+		}
+
+		return pub, nil
+	case EncodingThales:
+		return parseUnsigned(data)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownEncoding, enc)
+	}
+}
+
+// Sign signs an exported public key with RSASSA-PKCS1-v1_5 over its hash under signer.
+func Sign(exported []byte, signer *rsa.PrivateKey, hash crypto.Hash) ([]byte, error) {
+	digest, err := digestOf(exported, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return cryptoprovider.Default().SignRSA(signer, hash, digest)
+}
+
+// Verify checks the signature of an exported public key under the signer's public key.
+func Verify(exported, sig []byte, signer *rsa.PublicKey, hash crypto.Hash) error {
+	digest, err := digestOf(exported, hash)
+	if err != nil {
+		return err
+	}
+
+	return cryptoprovider.Default().VerifyRSA(signer, hash, digest, sig)
+}
+
+// digestOf hashes data with hash.
+func digestOf(data []byte, hash crypto.Hash) ([]byte, error) {
+	if !hash.Available() {
+		return nil, fmt.Errorf("hash %v is not available", hash)
+	}
+	h := hash.New()
+	h.Write(data)
+
+	return h.Sum(nil), nil
+}
+
+// derElement returns the DER element with the given tag and contents.
+func derElement(tag byte, contents []byte) []byte {
+	n := len(contents)
+	out := []byte{tag}
+	switch {
+	case n < 0x80:
+		out = append(out, byte(n))
+	case n <= 0xFF:
+		out = append(out, 0x81, byte(n))
+	default:
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	}
+
+	return append(out, contents...)
+}
+
+// readElement reads the DER element with the given tag at the start of data and returns its
+// contents and the rest of data.
+func readElement(data []byte, tag byte) ([]byte, []byte, error) {
+	if len(data) < 2 || data[0] != tag {
+		return nil, nil, fmt.Errorf("%w: expected tag %02X", ErrMalformedKey, tag)
+	}
+	n, off := int(data[1]), 2
+	switch data[1] {
+	case 0x81:
+		if len(data) < 3 {
+			return nil, nil, ErrMalformedKey
+		}
+		n, off = int(data[2]), 3
+	case 0x82:
+		if len(data) < 4 {
+			return nil, nil, ErrMalformedKey
+		}
+		n, off = int(data[2])<<8|int(data[3]), 4
+	default:
+		if n >= 0x80 {
+			return nil, nil, fmt.Errorf("%w: unsupported length encoding", ErrMalformedKey)
+		}
+	}
+	if len(data)-off < n {
+		return nil, nil, fmt.Errorf("%w: truncated element", ErrMalformedKey)
+	}
+
+	return data[off : off+n], data[off+n:], nil
+}
+
+// parseUnsigned parses a PKCS#1 RSAPublicKey whose integers are unsigned.
+func parseUnsigned(data []byte) (*rsa.PublicKey, error) {
+	seq, rest, err := readElement(data, tagSequence)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%w: trailing data", ErrMalformedKey)
+	}
+	modulus, seq, err := readElement(seq, tagInteger)
+	if err != nil {
+		return nil, err
+	}
+	exponent, seq, err := readElement(seq, tagInteger)
+	if err != nil {
+		return nil, err
+	}
+	if len(seq) != 0 || len(modulus) == 0 || len(exponent) == 0 || len(exponent) > 4 {
+		return nil, ErrMalformedKey
+	}
+
+	e := new(big.Int).SetBytes(exponent).Int64()
+	if e < 3 {
+		return nil, fmt.Errorf("%w: invalid exponent", ErrMalformedKey)
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(modulus), E: int(e)}, nil
+}
@@ -0,0 +1,90 @@
+package rsapub
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
+)
+
+func TestExportImport(t *testing.T) {
+	t.Parallel()
+
+	key, err := cryptoprovider.Default().GenerateRSAKey(1024)
+	if err != nil {
+		t.Fatalf("GenerateRSAKey() error = %v", err)
+	}
+
+	for _, enc := range []Encoding{EncodingDER, EncodingPEM, EncodingThales} {
+		data, err := Export(&key.PublicKey, enc)
+		if err != nil {
+			t.Fatalf("Export(%s) error = %v", enc, err)
+		}
+		pub, err := Import(data, enc)
+		if err != nil {
+			t.Fatalf("Import(%s) error = %v", enc, err)
+		}
+		if !pub.Equal(&key.PublicKey) {
+			t.Errorf("Import(%s) returned a different key", enc)
+		}
+	}
+
+	// The modulus has its top bit set: DER pads it with a zero byte, rule 01 does not.
+	der, _ := Export(&key.PublicKey, EncodingDER)
+	thales, _ := Export(&key.PublicKey, EncodingThales)
+	if len(der) != len(thales)+1 {
+		t.Errorf("DER length %d, Thales length %d; want one padding byte of difference",
+			len(der), len(thales))
+	}
+	if !bytes.HasPrefix(thales, []byte{0x30, 0x81, 0x88, 0x02, 0x81, 0x80}) {
+		t.Errorf("Thales encoding starts %X", thales[:6])
+	}
+
+	if _, err := Export(&key.PublicKey, Encoding("xml")); !errors.Is(err, ErrUnknownEncoding) {
+		t.Errorf("Export(xml) error = %v, want ErrUnknownEncoding", err)
+	}
+	if _, err := Import(thales[:20], EncodingThales); !errors.Is(err, ErrMalformedKey) {
+		t.Errorf("Import(truncated) error = %v, want ErrMalformedKey", err)
+	}
+	if _, err := Import(der, EncodingPEM); !errors.Is(err, ErrMalformedKey) {
+		t.Errorf("Import(DER as PEM) error = %v, want ErrMalformedKey", err)
+	}
+	if _, err := ParseEncoding("thales"); err != nil {
+		t.Errorf("ParseEncoding(thales) error = %v", err)
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	t.Parallel()
+
+	signer, err := cryptoprovider.Default().GenerateRSAKey(1024)
+	if err != nil {
+		t.Fatalf("GenerateRSAKey() error = %v", err)
+	}
+	key, err := cryptoprovider.Default().GenerateRSAKey(1024)
+	if err != nil {
+		t.Fatalf("GenerateRSAKey() error = %v", err)
+	}
+
+	exported, err := Export(&key.PublicKey, EncodingThales)
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	sig, err := Sign(exported, signer, crypto.SHA256)
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	if err := Verify(exported, sig, &signer.PublicKey, crypto.SHA256); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+
+	exported[len(exported)-1] ^= 1
+	if err := Verify(exported, sig, &signer.PublicKey, crypto.SHA256); err == nil {
+		t.Error("Verify() accepted a modified key")
+	}
+	if err := Verify(exported, sig, &key.PublicKey, crypto.SHA256); err == nil {
+		t.Error("Verify() accepted the wrong signer")
+	}
+}
@@ -0,0 +1,165 @@
+// Package testutil helps command tests compare HSM responses. A response is split into its
+// response code, error code and the fields of a msgspec layout, so a mismatch is reported
+// field by field instead of as two opaque byte slices.
+package testutil
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/pkg/msgspec"
+)
+
+// trailingField names the bytes that remain after the last field of a layout.
+const trailingField = "(trailing)"
+
+// ErrShortResponse indicates a response without a response code and an error code.
+var ErrShortResponse = errors.New("response shorter than response and error codes")
+
+// Field is one named field of a parsed response.
+type Field struct {
+	Name  string
+	Value string
+}
+
+// Response is an HSM response in canonical form.
+type Response struct {
+	// Code is the two-character response code, such as CX for a CW command.
+	Code string
+	// ErrorCode is the two-digit error code.
+	ErrorCode string
+	// Fields lists the fields after the error code in wire order. Key fields keep their
+	// scheme tag. Fields are parsed for error code 00 only, since other responses carry none.
+	Fields []Field
+}
+
+// ParseResponse splits resp into its codes and the fields of layout, which describes the
+// bytes after the error code. layout.Command is the expected response code; an empty one
+// accepts any code. Bytes after the last field are kept as a trailing field.
+func ParseResponse(layout msgspec.Spec, resp []byte) (Response, error) {
+	if len(resp) < 4 {
+		return Response{}, fmt.Errorf("%w: %q", ErrShortResponse, resp)
+	}
+
+	r := Response{Code: string(resp[:2]), ErrorCode: string(resp[2:4])}
+	if layout.Command != "" && r.Code != layout.Command {
+		return r, fmt.Errorf("response code %s, want %s", r.Code, layout.Command)
+	}
+	if r.ErrorCode != "00" {
+		if len(resp) > 4 {
+			r.Fields = append(r.Fields, Field{Name: trailingField, Value: string(resp[4:])})
+		}
+
+		return r, nil
+	}
+
+	layout.AllowTrailing = true
+	msg, err := layout.Parse(resp[4:])
+	if err != nil {
+		return r, err
+	}
+	for _, f := range layout.Fields {
+		v, ok := msg.Value(f.Name)
+		if !ok {
+			continue
+		}
+		value := v.Data
+		if v.Scheme != 0 {
+			value = string(v.Scheme) + value
+		}
+		r.Fields = append(r.Fields, Field{Name: f.Name, Value: value})
+	}
+	if rest := msg.Rest(); len(rest) > 0 {
+		r.Fields = append(r.Fields, Field{Name: trailingField, Value: string(rest)})
+	}
+
+	return r, nil
+}
+
+// Get returns the value of the named field, or an empty string if it is absent.
+func (r Response) Get(name string) string {
+	for _, f := range r.Fields {
+		if f.Name == name {
+			return f.Value
+		}
+	}
+
+	return ""
+}
+
+// String renders the response one field per line.
+func (r Response) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "response code: %s\nerror code: %s\n", r.Code, r.ErrorCode)
+	for _, f := range r.Fields {
+		fmt.Fprintf(&b, "%s: %s\n", f.Name, f.Value)
+	}
+
+	return b.String()
+}
+
+// Diff compares two responses under layout and returns one line per differing field, or an
+// empty string when they are equal. Responses that do not fit the layout are compared as
+// raw bytes from the first difference.
+func Diff(layout msgspec.Spec, got, want []byte) string {
+	if string(got) == string(want) {
+		return ""
+	}
+
+	g, gerr := ParseResponse(layout, got)
+	w, werr := ParseResponse(layout, want)
+	if gerr != nil || werr != nil {
+		return rawDiff(got, want)
+	}
+
+	var lines []string
+	add := func(name, got, want string) {
+		if got != want {
+			lines = append(lines, fmt.Sprintf("%s: got %q, want %q", name, got, want))
+		}
+	}
+	add("response code", g.Code, w.Code)
+	add("error code", g.ErrorCode, w.ErrorCode)
+
+	gotFields := make(map[string]string, len(g.Fields))
+	for _, f := range g.Fields {
+		gotFields[f.Name] = f.Value
+	}
+	seen := make(map[string]bool, len(w.Fields))
+	for _, f := range w.Fields {
+		seen[f.Name] = true
+		if v, ok := gotFields[f.Name]; ok {
+			add(f.Name, v, f.Value)
+		} else {
+			lines = append(lines, fmt.Sprintf("%s: missing, want %q", f.Name, f.Value))
+		}
+	}
+	for _, f := range g.Fields {
+		if !seen[f.Name] {
+			lines = append(lines, fmt.Sprintf("%s: unexpected %q", f.Name, f.Value))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// rawDiff describes the first difference of two byte slices.
+func rawDiff(got, want []byte) string {
+	i := 0
+	for i < len(got) && i < len(want) && got[i] == want[i] {
+		i++
+	}
+
+	return fmt.Sprintf("responses differ at offset %d:\n got: %q\nwant: %q", i, got, want)
+}
+
+// AssertResponse reports a test error with a field by field diff when got differs from want.
+func AssertResponse(t testing.TB, layout msgspec.Spec, got, want []byte) {
+	t.Helper()
+
+	if d := Diff(layout, got, want); d != "" {
+		t.Errorf("%s response mismatch:\n%s", layout.Command, d)
+	}
+}
@@ -0,0 +1,89 @@
+package testutil_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/andrei-cloud/go_hsm/pkg/msgspec"
+	"github.com/andrei-cloud/go_hsm/pkg/testutil"
+)
+
+// a1Layout describes an A1 response: a key under LMK followed by its check value.
+var a1Layout = msgspec.Spec{
+	Command: "A1",
+	Fields: []msgspec.Field{
+		msgspec.Key("key", "UT", 16),
+		msgspec.Fixed("kcv", 6, msgspec.EncodingHex),
+	},
+}
+
+// TestParseResponse verifies splitting responses into codes and fields.
+func TestParseResponse(t *testing.T) {
+	t.Parallel()
+
+	key := "U" + strings.Repeat("AB", 16)
+	r, err := testutil.ParseResponse(a1Layout, []byte("A100"+key+"123456XY"))
+	if err != nil {
+		t.Fatalf("ParseResponse failed: %v", err)
+	}
+	want := []testutil.Field{{"key", key}, {"kcv", "123456"}, {"(trailing)", "XY"}}
+	if r.Code != "A1" || r.ErrorCode != "00" || len(r.Fields) != len(want) {
+		t.Fatalf("ParseResponse() = %+v", r)
+	}
+	for i, f := range want {
+		if r.Fields[i] != f {
+			t.Errorf("field %d = %+v, want %+v", i, r.Fields[i], f)
+		}
+	}
+
+	if r.Get("kcv") != "123456" || r.Get("missing") != "" {
+		t.Errorf("Get() = %q, %q", r.Get("kcv"), r.Get("missing"))
+	}
+
+	if r, err := testutil.ParseResponse(a1Layout, []byte("A168")); err != nil || len(r.Fields) != 0 {
+		t.Errorf("error response = %+v, %v", r, err)
+	}
+	if _, err := testutil.ParseResponse(a1Layout, []byte("A1")); !errors.Is(err, testutil.ErrShortResponse) {
+		t.Errorf("short response error = %v, want ErrShortResponse", err)
+	}
+	if _, err := testutil.ParseResponse(a1Layout, []byte("B100")); err == nil {
+		t.Error("expected error for a wrong response code")
+	}
+}
+
+// TestDiff verifies field by field response diffs.
+func TestDiff(t *testing.T) {
+	t.Parallel()
+
+	key := "U" + strings.Repeat("AB", 16)
+	other := "U" + strings.Repeat("CD", 16)
+	tests := []struct {
+		name      string
+		got, want string
+		contains  []string
+	}{
+		{"equal", "A100" + key + "123456", "A100" + key + "123456", nil},
+		{"kcv", "A100" + key + "123456", "A100" + key + "654321", []string{`kcv: got "123456", want "654321"`}},
+		{"key and kcv", "A100" + other + "123456", "A100" + key + "654321", []string{"key: got", "kcv: got"}},
+		{"error code", "A168", "A100" + key + "123456", []string{`error code: got "68", want "00"`, "key: missing"}},
+		{"unexpected field", "A100" + key + "123456ZZ", "A100" + key + "123456", []string{`(trailing): unexpected "ZZ"`}},
+		{"raw", "A100XYZ", "A100" + key + "123456", []string{"responses differ at offset 4"}},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			d := testutil.Diff(a1Layout, []byte(tc.got), []byte(tc.want))
+			if len(tc.contains) == 0 && d != "" {
+				t.Errorf("Diff() = %q, want no difference", d)
+			}
+			for _, s := range tc.contains {
+				if !strings.Contains(d, s) {
+					t.Errorf("Diff() = %q, want it to contain %q", d, s)
+				}
+			}
+		})
+	}
+}
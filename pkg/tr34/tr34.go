@@ -0,0 +1,575 @@
+// Package tr34 creates and opens ANSI X9 TR-34 key tokens, which carry a symmetric key such
+// as a ZMK or BDK from a key distribution host (KDH) to a key receiving device (KRD) using
+// RSA. A token is a CMS SignedData, signed by the KDH, around an EnvelopedData for the KRD:
+// the clear key and its TR-31 attribute header are encrypted under a random AES-128 content
+// key, and the content key under the KRD public key with RSAES-OAEP and SHA-256. The header
+// and an optional KRD nonce are also carried as signed attributes.
+package tr34
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"slices"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoutils"
+	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+)
+
+// Object identifiers of the CMS structures and algorithms of a key token.
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidEnvelopedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidRandomNonce   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 25, 3}
+	oidRSAESOAEP     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 7}
+	oidMGF1          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 8}
+	oidSHA256WithRSA = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidAES128CBC     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+)
+
+// Versions of the CMS structures and of the key block content.
+const (
+	signedDataVersion    = 1
+	envelopedDataVersion = 0
+	keyBlockVersion      = 1
+)
+
+var (
+	// ErrFormat indicates a token that is not a well-formed TR-34 key token.
+	ErrFormat = errors.New("malformed tr34 key token")
+	// ErrCertificate indicates a KDH certificate that does not chain to a trusted CA.
+	ErrCertificate = errors.New("untrusted tr34 kdh certificate")
+	// ErrSignature indicates a token whose KDH signature or message digest does not verify.
+	ErrSignature = errors.New("invalid tr34 signature")
+	// ErrNonce indicates a token that does not carry the expected KRD nonce.
+	ErrNonce = errors.New("tr34 nonce mismatch")
+)
+
+// Party is a TR-34 party: its certificate and, for the local party, its private key.
+type Party struct {
+	Cert *x509.Certificate
+	Key  *rsa.PrivateKey
+}
+
+// KeyBlock is the content of a key token.
+type KeyBlock struct {
+	// Header holds the TR-31 attributes of the key.
+	Header keyblocklmk.Header
+	// Key is the clear key.
+	Key []byte
+	// Nonce is the random nonce of the KRD for two-pass distribution; nil for one-pass.
+	Nonce []byte
+	// KDH is the certificate of the signer; set by Open.
+	KDH *x509.Certificate
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue // [0] EXPLICIT.
+}
+
+type issuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue // SET holding one value.
+}
+
+type keyTransRecipientInfo struct {
+	Version                int
+	RID                    issuerAndSerial
+	KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedKey           []byte
+}
+
+type encryptedContentInfo struct {
+	ContentType      asn1.ObjectIdentifier
+	Algorithm        pkix.AlgorithmIdentifier
+	EncryptedContent []byte `asn1:"tag:0"`
+}
+
+type envelopedData struct {
+	Version              int
+	RecipientInfos       []keyTransRecipientInfo `asn1:"set"`
+	EncryptedContentInfo encryptedContentInfo
+}
+
+// keyBlockContent is the plaintext of the envelope.
+type keyBlockContent struct {
+	Version         int
+	IDKDH           issuerAndSerial
+	ClearKey        []byte
+	AttributeHeader attribute
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,tag:0"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                issuerAndSerial
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue // [0] IMPLICIT SET OF attribute.
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     asn1.RawValue // [0] IMPLICIT SET OF Certificate.
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type oaepParams struct {
+	Hash pkix.AlgorithmIdentifier `asn1:"explicit,tag:0"`
+	MGF  pkix.AlgorithmIdentifier `asn1:"explicit,tag:1"`
+}
+
+// Create builds a key token carrying kb for krd, signed by kdh. kdh.Key must belong to
+// kdh.Cert.
+func Create(kdh Party, krd *x509.Certificate, kb KeyBlock) ([]byte, error) {
+	if kdh.Cert == nil || kdh.Key == nil {
+		return nil, errors.New("tr34: kdh certificate and private key are required")
+	}
+	krdKey, ok := krd.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("tr34: krd certificate does not hold an rsa key")
+	}
+	header, err := kb.Header.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("tr34: %w", err)
+	}
+	headerAttr, err := newAttribute(oidData, header)
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := asn1.Marshal(keyBlockContent{
+		Version:         keyBlockVersion,
+		IDKDH:           idOf(kdh.Cert),
+		ClearKey:        kb.Key,
+		AttributeHeader: headerAttr,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("tr34: %w", err)
+	}
+	enveloped, err := envelope(krd, krdKey, plain)
+	if err != nil {
+		return nil, err
+	}
+
+	return sign(kdh, enveloped, header, kb.Nonce)
+}
+
+// envelope encrypts plain under a random content key for the KRD and returns the DER of the
+// EnvelopedData.
+func envelope(krd *x509.Certificate, pub *rsa.PublicKey, plain []byte) ([]byte, error) {
+	random := cryptoprovider.Reader()
+	cek := make([]byte, 16)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(random, cek); err != nil {
+		return nil, fmt.Errorf("tr34: content key: %w", err)
+	}
+	if _, err := io.ReadFull(random, iv); err != nil {
+		return nil, fmt.Errorf("tr34: iv: %w", err)
+	}
+
+	block, err := cryptoprovider.NewAESCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	padded := cryptoutils.PadPKCS7(plain, aes.BlockSize)
+	encrypted := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, padded)
+
+	wrappedCEK, err := rsa.EncryptOAEP(sha256.New(), random, pub, cek, nil)
+	if err != nil {
+		return nil, fmt.Errorf("tr34: encrypt content key: %w", err)
+	}
+	oaep, err := oaepAlgorithm()
+	if err != nil {
+		return nil, err
+	}
+	ivParam, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(envelopedData{
+		Version: envelopedDataVersion,
+		RecipientInfos: []keyTransRecipientInfo{{
+			RID:                    idOf(krd),
+			KeyEncryptionAlgorithm: oaep,
+			EncryptedKey:           wrappedCEK,
+		}},
+		EncryptedContentInfo: encryptedContentInfo{
+			ContentType: oidData,
+			Algorithm: pkix.AlgorithmIdentifier{
+				Algorithm: oidAES128CBC, Parameters: asn1.RawValue{FullBytes: ivParam},
+			},
+			EncryptedContent: encrypted,
+		},
+	})
+}
+
+// sign wraps the EnvelopedData in a SignedData signed by the KDH and returns the DER of its
+// ContentInfo.
+func sign(kdh Party, enveloped, header, nonce []byte) ([]byte, error) {
+	digest := sha256.Sum256(enveloped)
+	oids := []asn1.ObjectIdentifier{oidContentType, oidMessageDigest, oidData}
+	values := []any{oidEnvelopedData, digest[:], header}
+	if nonce != nil {
+		oids = append(oids, oidRandomNonce)
+		values = append(values, nonce)
+	}
+	attrs := make([][]byte, 0, len(values))
+	for i, oid := range oids {
+		attr, err := newAttribute(oid, values[i])
+		if err != nil {
+			return nil, err
+		}
+		der, err := asn1.Marshal(attr)
+		if err != nil {
+			return nil, fmt.Errorf("tr34: %w", err)
+		}
+		attrs = append(attrs, der)
+	}
+	// DER orders the elements of a SET OF by their encoding.
+	slices.SortFunc(attrs, bytes.Compare)
+	signed, err := asn1.Marshal(asn1.RawValue{
+		Tag: asn1.TagSet, IsCompound: true, Bytes: slices.Concat(attrs...),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	attrsDigest := sha256.Sum256(signed)
+	signature, err := cryptoprovider.Default().SignRSA(kdh.Key, crypto.SHA256, attrsDigest[:])
+	if err != nil {
+		return nil, fmt.Errorf("tr34: sign: %w", err)
+	}
+
+	sha256ID := pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue}
+	sd, err := asn1.Marshal(signedData{
+		Version:          signedDataVersion,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256ID},
+		EncapContentInfo: encapsulatedContentInfo{EContentType: oidEnvelopedData, EContent: enveloped},
+		Certificates: asn1.RawValue{
+			Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: kdh.Cert.Raw,
+		},
+		SignerInfos: []signerInfo{{
+			Version:         1,
+			SID:             idOf(kdh.Cert),
+			DigestAlgorithm: sha256ID,
+			SignedAttrs: asn1.RawValue{
+				Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: slices.Concat(attrs...),
+			},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{
+				Algorithm: oidSHA256WithRSA, Parameters: asn1.NullRawValue,
+			},
+			Signature: signature,
+		}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("tr34: %w", err)
+	}
+
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd},
+	})
+}
+
+// Open verifies a key token and decrypts its key block with the private key of krd. The
+// KDH certificate carried in the token must chain to roots, and the token must carry nonce
+// when nonce is not nil.
+func Open(token []byte, krd Party, roots *x509.CertPool, nonce []byte) (*KeyBlock, error) {
+	if krd.Key == nil {
+		return nil, errors.New("tr34: krd private key is required")
+	}
+
+	var ci contentInfo
+	if err := unmarshalAll(token, &ci); err != nil || !ci.ContentType.Equal(oidSignedData) ||
+		!isContextTag(ci.Content) {
+		return nil, fmt.Errorf("%w: not a signed data content info", ErrFormat)
+	}
+	var sd signedData
+	if err := unmarshalAll(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("%w: signed data: %v", ErrFormat, err)
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(oidEnvelopedData) || len(sd.SignerInfos) != 1 ||
+		!isContextTag(sd.Certificates) {
+		return nil, fmt.Errorf("%w: signed data must hold one signer and the kdh certificate",
+			ErrFormat)
+	}
+
+	kdh, err := verifyKDH(sd.Certificates.Bytes, roots)
+	if err != nil {
+		return nil, err
+	}
+	signed, err := verifySigner(sd.SignerInfos[0], kdh, sd.EncapContentInfo.EContent)
+	if err != nil {
+		return nil, err
+	}
+	if nonce != nil && subtle.ConstantTimeCompare(signed[oidRandomNonce.String()], nonce) != 1 {
+		return nil, ErrNonce
+	}
+
+	content, err := decryptEnvelope(sd.EncapContentInfo.EContent, krd)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(content.IDKDH.Issuer.FullBytes, kdh.RawIssuer) ||
+		content.IDKDH.Serial == nil || content.IDKDH.Serial.Cmp(kdh.SerialNumber) != 0 {
+		return nil, fmt.Errorf("%w: key block names another kdh", ErrFormat)
+	}
+	header, err := attributeValue(content.AttributeHeader)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(header, signed[oidData.String()]) {
+		return nil, fmt.Errorf("%w: key block header differs from the signed header", ErrSignature)
+	}
+
+	kb := &KeyBlock{Key: content.ClearKey, Nonce: signed[oidRandomNonce.String()], KDH: kdh}
+	if err := kb.Header.UnmarshalBinary(header); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFormat, err)
+	}
+
+	return kb, nil
+}
+
+// verifyKDH parses the KDH certificate and checks that it chains to roots.
+func verifyKDH(der []byte, roots *x509.CertPool) (*x509.Certificate, error) {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("%w: kdh certificate: %v", ErrFormat, err)
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCertificate, err)
+	}
+	if _, ok := cert.PublicKey.(*rsa.PublicKey); !ok {
+		return nil, fmt.Errorf("%w: kdh certificate does not hold an rsa key", ErrCertificate)
+	}
+
+	return cert, nil
+}
+
+// verifySigner checks the signer's signature over its signed attributes and the message
+// digest of content, and returns the attribute values by object identifier.
+func verifySigner(si signerInfo, kdh *x509.Certificate, content []byte) (map[string][]byte, error) {
+	if !si.DigestAlgorithm.Algorithm.Equal(oidSHA256) ||
+		!si.SignatureAlgorithm.Algorithm.Equal(oidSHA256WithRSA) || !isContextTag(si.SignedAttrs) {
+		return nil, fmt.Errorf("%w: signer must use sha256 with rsa and signed attributes", ErrFormat)
+	}
+	if !bytes.Equal(si.SID.Issuer.FullBytes, kdh.RawIssuer) || si.SID.Serial == nil ||
+		si.SID.Serial.Cmp(kdh.SerialNumber) != 0 {
+		return nil, fmt.Errorf("%w: signer is not the kdh certificate", ErrSignature)
+	}
+
+	// The signature covers the attributes encoded as a SET rather than with their [0] tag.
+	signed, err := asn1.Marshal(asn1.RawValue{
+		Tag: asn1.TagSet, IsCompound: true, Bytes: si.SignedAttrs.Bytes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(signed)
+	pub, _ := kdh.PublicKey.(*rsa.PublicKey)
+	if err := cryptoprovider.Default().VerifyRSA(pub, crypto.SHA256, digest[:], si.Signature); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSignature, err)
+	}
+
+	values := make(map[string][]byte)
+	for rest := si.SignedAttrs.Bytes; len(rest) > 0; {
+		var attr attribute
+		if rest, err = asn1.Unmarshal(rest, &attr); err != nil {
+			return nil, fmt.Errorf("%w: signed attribute: %v", ErrFormat, err)
+		}
+		if attr.Type.Equal(oidContentType) {
+			var ct asn1.ObjectIdentifier
+			if _, err := asn1.Unmarshal(attr.Values.Bytes, &ct); err != nil || !ct.Equal(oidEnvelopedData) {
+				return nil, fmt.Errorf("%w: signed content type is not enveloped data", ErrFormat)
+			}
+
+			continue
+		}
+		v, err := attributeValue(attr)
+		if err != nil {
+			return nil, err
+		}
+		values[attr.Type.String()] = v
+	}
+
+	contentDigest := sha256.Sum256(content)
+	if subtle.ConstantTimeCompare(values[oidMessageDigest.String()], contentDigest[:]) != 1 {
+		return nil, fmt.Errorf("%w: message digest mismatch", ErrSignature)
+	}
+
+	return values, nil
+}
+
+// decryptEnvelope decrypts the content key with the KRD private key and returns the key
+// block content of the EnvelopedData.
+func decryptEnvelope(der []byte, krd Party) (*keyBlockContent, error) {
+	var ed envelopedData
+	if err := unmarshalAll(der, &ed); err != nil {
+		return nil, fmt.Errorf("%w: enveloped data: %v", ErrFormat, err)
+	}
+	if len(ed.RecipientInfos) != 1 {
+		return nil, fmt.Errorf("%w: enveloped data must have one recipient", ErrFormat)
+	}
+	ri := ed.RecipientInfos[0]
+	if krd.Cert != nil && (!bytes.Equal(ri.RID.Issuer.FullBytes, krd.Cert.RawIssuer) ||
+		ri.RID.Serial == nil || ri.RID.Serial.Cmp(krd.Cert.SerialNumber) != 0) {
+		return nil, fmt.Errorf("%w: token is for another krd", ErrFormat)
+	}
+	if err := checkOAEP(ri.KeyEncryptionAlgorithm); err != nil {
+		return nil, err
+	}
+	cek, err := rsa.DecryptOAEP(sha256.New(), nil, krd.Key, ri.EncryptedKey, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: content key: %v", ErrFormat, err)
+	}
+
+	eci := ed.EncryptedContentInfo
+	var iv []byte
+	if !eci.Algorithm.Algorithm.Equal(oidAES128CBC) {
+		return nil, fmt.Errorf("%w: unsupported content encryption %v", ErrFormat, eci.Algorithm.Algorithm)
+	}
+	if _, err := asn1.Unmarshal(eci.Algorithm.Parameters.FullBytes, &iv); err != nil ||
+		len(iv) != aes.BlockSize || len(cek) != 16 {
+		return nil, fmt.Errorf("%w: invalid content encryption parameters", ErrFormat)
+	}
+	if len(eci.EncryptedContent) == 0 || len(eci.EncryptedContent)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("%w: encrypted content length %d", ErrFormat, len(eci.EncryptedContent))
+	}
+	block, err := cryptoprovider.NewAESCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	padded := make([]byte, len(eci.EncryptedContent))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(padded, eci.EncryptedContent)
+	plain, err := cryptoutils.UnpadPKCS7(padded, aes.BlockSize)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFormat, err)
+	}
+
+	var content keyBlockContent
+	if err := unmarshalAll(plain, &content); err != nil || content.Version != keyBlockVersion {
+		return nil, fmt.Errorf("%w: key block content", ErrFormat)
+	}
+
+	return &content, nil
+}
+
+// oaepAlgorithm returns the RSAES-OAEP algorithm identifier with SHA-256 and MGF1 SHA-256.
+func oaepAlgorithm() (pkix.AlgorithmIdentifier, error) {
+	sha256ID := pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue}
+	hashParam, err := asn1.Marshal(sha256ID)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, err
+	}
+	params, err := asn1.Marshal(oaepParams{
+		Hash: sha256ID,
+		MGF: pkix.AlgorithmIdentifier{
+			Algorithm: oidMGF1, Parameters: asn1.RawValue{FullBytes: hashParam},
+		},
+	})
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, err
+	}
+
+	return pkix.AlgorithmIdentifier{Algorithm: oidRSAESOAEP, Parameters: asn1.RawValue{FullBytes: params}}, nil
+}
+
+// checkOAEP checks that alg is RSAES-OAEP with SHA-256 and MGF1 SHA-256.
+func checkOAEP(alg pkix.AlgorithmIdentifier) error {
+	var params oaepParams
+	if !alg.Algorithm.Equal(oidRSAESOAEP) {
+		return fmt.Errorf("%w: unsupported key encryption %v", ErrFormat, alg.Algorithm)
+	}
+	if err := unmarshalAll(alg.Parameters.FullBytes, &params); err != nil {
+		return fmt.Errorf("%w: oaep parameters: %v", ErrFormat, err)
+	}
+	var mgfHash pkix.AlgorithmIdentifier
+	if _, err := asn1.Unmarshal(params.MGF.Parameters.FullBytes, &mgfHash); err != nil ||
+		!params.Hash.Algorithm.Equal(oidSHA256) || !params.MGF.Algorithm.Equal(oidMGF1) ||
+		!mgfHash.Algorithm.Equal(oidSHA256) {
+		return fmt.Errorf("%w: oaep must use sha256 and mgf1 with sha256", ErrFormat)
+	}
+
+	return nil
+}
+
+// newAttribute returns an attribute holding the single value v.
+func newAttribute(oid asn1.ObjectIdentifier, v any) (attribute, error) {
+	der, err := asn1.Marshal(v)
+	if err != nil {
+		return attribute{}, fmt.Errorf("tr34: %w", err)
+	}
+
+	return attribute{
+		Type:   oid,
+		Values: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: der},
+	}, nil
+}
+
+// attributeValue returns the single OCTET STRING value of attr.
+func attributeValue(attr attribute) ([]byte, error) {
+	var v []byte
+	if err := unmarshalAll(attr.Values.Bytes, &v); err != nil {
+		return nil, fmt.Errorf("%w: attribute %v: %v", ErrFormat, attr.Type, err)
+	}
+
+	return v, nil
+}
+
+// idOf returns the issuer and serial number of cert.
+func idOf(cert *x509.Certificate) issuerAndSerial {
+	return issuerAndSerial{Issuer: asn1.RawValue{FullBytes: cert.RawIssuer}, Serial: cert.SerialNumber}
+}
+
+// isContextTag reports whether v is a constructed [0] value.
+func isContextTag(v asn1.RawValue) bool {
+	return v.Class == asn1.ClassContextSpecific && v.Tag == 0 && v.IsCompound
+}
+
+// unmarshalAll parses der into v and rejects trailing data.
+func unmarshalAll(der []byte, v any) error {
+	rest, err := asn1.Unmarshal(der, v)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return errors.New("trailing data")
+	}
+
+	return nil
+}
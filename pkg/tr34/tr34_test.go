@@ -0,0 +1,178 @@
+package tr34_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andrei-cloud/go_hsm/pkg/keyblocklmk"
+	"github.com/andrei-cloud/go_hsm/pkg/tr34"
+)
+
+// testPKI holds a CA and the KDH and KRD parties it certified.
+type testPKI struct {
+	roots *x509.CertPool
+	kdh   tr34.Party
+	krd   tr34.Party
+}
+
+var newTestPKI = sync.OnceValues(func() (*testPKI, error) {
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "TR-34 Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, err
+	}
+
+	party := func(serial int64, name string) (tr34.Party, error) {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return tr34.Party{}, err
+		}
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		if err != nil {
+			return tr34.Party{}, err
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return tr34.Party{}, err
+		}
+
+		return tr34.Party{Cert: cert, Key: key}, nil
+	}
+
+	kdh, err := party(2, "KDH")
+	if err != nil {
+		return nil, err
+	}
+	krd, err := party(3, "KRD")
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	return &testPKI{roots: roots, kdh: kdh, krd: krd}, nil
+})
+
+func mustTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+
+	pki, err := newTestPKI()
+	if err != nil {
+		t.Fatalf("test PKI setup failed: %v", err)
+	}
+
+	return pki
+}
+
+var testKeyBlock = tr34.KeyBlock{
+	Header: keyblocklmk.Header{
+		Version:       'D',
+		KeyUsage:      "K0",
+		Algorithm:     'T',
+		ModeOfUse:     'B',
+		KeyVersionNum: "00",
+		Exportability: 'E',
+	},
+	Key:   bytes.Repeat([]byte{0x3C}, 16),
+	Nonce: []byte{1, 2, 3, 4, 5, 6, 7, 8},
+}
+
+// TestCreateOpen verifies that a key token carries the key and header to the KRD.
+func TestCreateOpen(t *testing.T) {
+	t.Parallel()
+
+	pki := mustTestPKI(t)
+	token, err := tr34.Create(pki.kdh, pki.krd.Cert, testKeyBlock)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	kb, err := tr34.Open(token, pki.krd, pki.roots, testKeyBlock.Nonce)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if !bytes.Equal(kb.Key, testKeyBlock.Key) {
+		t.Errorf("key mismatch: got %X", kb.Key)
+	}
+	if kb.Header != testKeyBlock.Header {
+		t.Errorf("header mismatch: got %+v", kb.Header)
+	}
+	if !bytes.Equal(kb.Nonce, testKeyBlock.Nonce) {
+		t.Errorf("nonce mismatch: got %X", kb.Nonce)
+	}
+	if !kb.KDH.Equal(pki.kdh.Cert) {
+		t.Error("KDH certificate mismatch")
+	}
+}
+
+// TestOpenRejects verifies that tokens failing a check are rejected.
+func TestOpenRejects(t *testing.T) {
+	t.Parallel()
+
+	pki := mustTestPKI(t)
+	token, err := tr34.Create(pki.kdh, pki.krd.Cert, testKeyBlock)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	// A token for the KDH cannot be opened by the KRD.
+	otherToken, err := tr34.Create(pki.kdh, pki.kdh.Cert, testKeyBlock)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	tampered := bytes.Clone(token)
+	tampered[len(tampered)-1] ^= 0x01
+
+	tests := []struct {
+		name  string
+		token []byte
+		roots *x509.CertPool
+		nonce []byte
+		want  error
+	}{
+		{"untrusted CA", token, x509.NewCertPool(), nil, tr34.ErrCertificate},
+		{"wrong nonce", token, pki.roots, []byte{8, 7, 6, 5, 4, 3, 2, 1}, tr34.ErrNonce},
+		{"tampered signature", tampered, pki.roots, nil, tr34.ErrSignature},
+		{"other recipient", otherToken, pki.roots, nil, tr34.ErrFormat},
+		{"not a token", []byte{0x30, 0x00}, pki.roots, nil, tr34.ErrFormat},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := tr34.Open(tc.token, pki.krd, tc.roots, tc.nonce); !errors.Is(err, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, err)
+			}
+		})
+	}
+}
@@ -2,8 +2,6 @@ package variantlmk
 
 import "fmt"
 
-var pciHSMComplianceMode bool
-
 // KeyTypes maps key type codes to their LMK pair and variant mappings.
 // This table is based on the Thales payShield documentation for Variant LMKs,
 // specifically the "Key Type Table" (non-PCI compliant version shown first in spec).
@@ -23,7 +21,7 @@ var KeyTypes = map[string]KeyType{
 	"002": {Name: "PVK/Generic", Code: "002", LMKPair: 7, VariantID: 0},
 	"102": {Name: "TMK1 (AS2805)", Code: "102", LMKPair: 7, VariantID: 1},
 	"202": {Name: "TMK2 (AS2805)", Code: "202", LMKPair: 7, VariantID: 2},
-	// IPEK would use LMKPair: 7, VariantID: 3.
+	"302": {Name: "IKEY/IPEK", Code: "302", LMKPair: 7, VariantID: 3},
 	"402": {Name: "CVK/CSCK", Code: "402", LMKPair: 7, VariantID: 4},
 	// KIA1 would use LMKPair: 7, VariantID: 6.
 	"602": {Name: "KIA (AS2805)", Code: "602", LMKPair: 7, VariantID: 6},
@@ -130,6 +128,7 @@ var KeyTypesPCI = map[string]KeyType{
 	"002": {Name: "PVK", Code: "002", LMKPair: 7, VariantID: 0},
 	"102": {Name: "TMK1 (AS2805)", Code: "102", LMKPair: 7, VariantID: 1},
 	"202": {Name: "TMK2 (AS2805)", Code: "202", LMKPair: 7, VariantID: 2},
+	"302": {Name: "IKEY/IPEK", Code: "302", LMKPair: 7, VariantID: 3},
 	"402": {Name: "CVK/CSCK", Code: "402", LMKPair: 7, VariantID: 4},
 	"602": {Name: "KIA (AS2805)", Code: "602", LMKPair: 7, VariantID: 6},
 
@@ -247,17 +246,6 @@ func (kt KeyType) String() string {
 	)
 }
 
-// SetPCIComplianceMode sets the HSM operating mode for key type table selection.
-// If enabled is true, the PCI-HSM compliant key type table will be used.
-func SetPCIComplianceMode(enabled bool) {
-	pciHSMComplianceMode = enabled
-}
-
-// GetPCIComplianceMode returns true if the HSM is set to operate in PCI-HSM compliant mode.
-func GetPCIComplianceMode() bool {
-	return pciHSMComplianceMode
-}
-
 // GetKeyTypeDetails returns the LMK pair index and variant ID for a given key type string.
 // It considers the PCI compliance mode to select the correct key type table.
 func GetKeyTypeDetails(keyTypeStr string, pciMode bool) (KeyType, error) {
@@ -50,3 +50,36 @@ func LoadDefaultLMKSet() (LMKSet, error) {
 
 	return lmkSet, nil
 }
+
+// LMKSetSize is the size in bytes of a variant LMK set: 20 pairs of two DES keys.
+const LMKSetSize = 20 * 16
+
+// ParseLMKSet reads a variant LMK set from its LMKSetSize bytes, the pairs in order with the
+// left key of each pair first.
+func ParseLMKSet(data []byte) (LMKSet, error) {
+	if len(data) != LMKSetSize {
+		return LMKSet{}, fmt.Errorf("variant LMK set must be %d bytes, got %d", LMKSetSize, len(data))
+	}
+
+	var lmkSet LMKSet
+	for i := range lmkSet {
+		pair := data[i*16 : i*16+16]
+		lmkSet[i] = LMKPair{
+			Left:  append([]byte(nil), pair[:8]...),
+			Right: append([]byte(nil), pair[8:]...),
+		}
+	}
+
+	return lmkSet, nil
+}
+
+// Bytes returns the LMKSetSize bytes of the set in the layout read by ParseLMKSet.
+func (s LMKSet) Bytes() []byte {
+	data := make([]byte, 0, LMKSetSize)
+	for _, pair := range s {
+		data = append(data, pair.Left...)
+		data = append(data, pair.Right...)
+	}
+
+	return data
+}
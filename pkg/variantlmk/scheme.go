@@ -7,17 +7,19 @@ import (
 
 // EncryptKeyUnderScheme encrypts inputKey under the correct LMK based on keyTypeCode and schemeTag.
 // If isKeyComponent is true, an additional 0xFF variant is applied to the LMK after the key-type variant.
+// pciMode selects the PCI-HSM compliant key type table.
 func EncryptKeyUnderScheme(
 	keyTypeCode string,
 	schemeTag byte,
 	inputKey []byte,
 	lmkSet LMKSet,
 	isKeyComponent bool,
+	pciMode bool,
 ) ([]byte, error) {
 	var kt KeyType
 	var ok bool
 
-	if GetPCIComplianceMode() {
+	if pciMode {
 		kt, ok = KeyTypesPCI[keyTypeCode]
 	} else {
 		kt, ok = KeyTypes[keyTypeCode]
@@ -48,17 +50,19 @@ func EncryptKeyUnderScheme(
 
 // DecryptKeyUnderScheme decrypts an encryptedKey using the LMK associated with keyTypeCode and schemeTag.
 // If isKeyComponent is true, an additional 0xFF variant is applied to the LMK after the key-type variant.
+// pciMode selects the PCI-HSM compliant key type table.
 func DecryptKeyUnderScheme(
 	keyTypeCode string,
 	schemeTag byte,
 	encryptedKey []byte,
 	lmkSet LMKSet,
 	isKeyComponent bool,
+	pciMode bool,
 ) ([]byte, error) {
 	var kt KeyType
 	var ok bool
 
-	if GetPCIComplianceMode() {
+	if pciMode {
 		kt, ok = KeyTypesPCI[keyTypeCode]
 	} else {
 		kt, ok = KeyTypes[keyTypeCode]
@@ -2,10 +2,11 @@
 package variantlmk
 
 import (
-	"crypto/des"
 	"encoding/hex"
 	"errors"
 	"fmt"
+
+	"github.com/andrei-cloud/go_hsm/pkg/cryptoprovider"
 )
 
 var VariantMap = map[int]byte{
@@ -20,6 +21,14 @@ var VariantMap = map[int]byte{
 	9: 0xFA,
 }
 
+// aesSchemeVariants are the scheme variants of the 8-byte parts of AES keys under the A
+// (AES-128), B (AES-192) and C (AES-256) scheme tags, a simulator extension. They differ
+// from those of the U and T schemes, so an AES key does not decrypt as a TDES key.
+var aesSchemeVariants = []byte{0x50, 0x74, 0x9C, 0xFA}
+
+// aesSchemeLengths maps the AES scheme tags to their key lengths in bytes.
+var aesSchemeLengths = map[byte]int{'A': 16, 'B': 24, 'C': 32}
+
 type LMKPair struct {
 	Left  []byte
 	Right []byte
@@ -71,6 +80,12 @@ func EncryptUnderVariantLMK(inputKey []byte, pair LMKPair, schemeTag byte) ([]by
 			return nil, errors.New("single-length key required for scheme X")
 		}
 		variants = []byte{0xA6} // Use first variant for single length
+	case 'A', 'B', 'C':
+		if len(inputKey) != aesSchemeLengths[schemeTag] {
+			return nil, fmt.Errorf("%d-byte AES key required for scheme %c",
+				aesSchemeLengths[schemeTag], schemeTag)
+		}
+		variants = aesSchemeVariants[:len(inputKey)/8]
 	default:
 		return nil, fmt.Errorf("unknown scheme tag: %c", schemeTag)
 	}
@@ -83,7 +98,7 @@ func EncryptUnderVariantLMK(inputKey []byte, pair LMKPair, schemeTag byte) ([]by
 		variantLMK[8] ^= v // Apply scheme variant to first byte of right half
 
 		variantLMK = append(variantLMK, variantLMK[:8]...)
-		block, err := des.NewTripleDESCipher(variantLMK)
+		block, err := cryptoprovider.NewTripleDESCipher(variantLMK)
 		if err != nil {
 			return nil, err
 		}
@@ -129,6 +144,12 @@ func DecryptUnderVariantLMK(encryptedKey []byte, pair LMKPair, schemeTag byte) (
 			return nil, errors.New("single-length encrypted key required for scheme X")
 		}
 		variants = []byte{0xA6} // Use first variant for single length
+	case 'A', 'B', 'C':
+		if len(encryptedKey) != aesSchemeLengths[schemeTag] {
+			return nil, fmt.Errorf("%d-byte encrypted AES key required for scheme %c",
+				aesSchemeLengths[schemeTag], schemeTag)
+		}
+		variants = aesSchemeVariants[:len(encryptedKey)/8]
 	default:
 		return nil, fmt.Errorf("unknown scheme tag: %c", schemeTag)
 	}
@@ -144,7 +165,7 @@ func DecryptUnderVariantLMK(encryptedKey []byte, pair LMKPair, schemeTag byte) (
 		// Prepare 3DES key (K1K2K1).
 		variantLMKForKeyPart = append(variantLMKForKeyPart, variantLMKForKeyPart[:8]...)
 		desKey := variantLMKForKeyPart
-		block, err := des.NewTripleDESCipher(desKey)
+		block, err := cryptoprovider.NewTripleDESCipher(desKey)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create 3DES cipher for decryption: %w", err)
 		}